@@ -0,0 +1,80 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// osc-annotation-webhook is an optional validating admission webhook rejecting the
+// Services whose osc/aws load balancer annotations would make the reconciliation of
+// their load balancer fail, using the same annotation parsing as the CCM.
+
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	osc "github.com/outscale-dev/cloud-provider-osc/cloud-controller-manager/osc"
+)
+
+func main() {
+	klog.InitFlags(nil)
+	bindAddress := flag.String("bind-address", ":8443", "Address on which the webhook is served.")
+	certFile := flag.String("tls-cert-file", "", "File containing the TLS certificate of the webhook.")
+	keyFile := flag.String("tls-private-key-file", "", "File containing the TLS private key of the webhook.")
+	cloudConfig := flag.String("cloud-config", "", "Cloud config of the CCM, for its cluster-wide defaults.")
+	flag.Parse()
+	defer klog.Flush()
+
+	if *certFile == "" || *keyFile == "" {
+		klog.Fatalf("--tls-cert-file and --tls-private-key-file are required")
+	}
+
+	cfg, err := readCloudConfig(*cloudConfig)
+	if err != nil {
+		klog.Fatalf("Unable to read the cloud config: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/validate", osc.AnnotationValidationHandler(cfg))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              *bindAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	klog.Infof("Serving the annotation webhook on %s", *bindAddress)
+	if err := server.ListenAndServeTLS(*certFile, *keyFile); err != nil {
+		klog.Fatalf("Unable to serve the annotation webhook: %v", err)
+	}
+}
+
+// readCloudConfig reads the cloud config at path, an empty config when path is empty
+func readCloudConfig(path string) (*osc.CloudConfig, error) {
+	if path == "" {
+		return osc.ReadCloudConfig(nil)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return osc.ReadCloudConfig(file)
+}
@@ -25,10 +25,12 @@ limitations under the License.
 package main
 
 import (
+	"fmt"
 	"math/rand"
 	"os"
 	"time"
 
+	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/util/wait"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/cloud-provider/app"
@@ -43,6 +45,13 @@ import (
 	osc "github.com/outscale-dev/cloud-provider-osc/cloud-controller-manager/osc"
 )
 
+// refuseUnsupportedKubernetesVersion makes the CCM exit when the API server
+// runs a Kubernetes version which has not been tested with this release
+var refuseUnsupportedKubernetesVersion bool
+
+// cloudHealthBindAddress is the address serving the cloud health, disabled when empty
+var cloudHealthBindAddress string
+
 func main() {
 	rand.Seed(time.Now().UTC().UnixNano())
 	logs.InitLogs()
@@ -55,13 +64,64 @@ func main() {
 
 	controllerInitializers := app.DefaultInitFuncConstructors
 	fss := cliflag.NamedFlagSets{}
+	oscFlags := fss.FlagSet("osc")
+	oscFlags.BoolVar(&refuseUnsupportedKubernetesVersion, "refuse-unsupported-kubernetes-version", false,
+		"Exit when the Kubernetes API server version is outside of the range supported by this release.")
+	oscFlags.StringVar(&osc.CredentialsFile, "osc-credentials-file", "",
+		"JSON or INI file, or directory of a mounted Secret, containing the Outscale access key, secret key and optional session token, region and endpoints, reloaded when it changes. Takes precedence over the environment and the CredentialsFile of the cloud config.")
+	oscFlags.StringVar(&osc.LoadBalancerNameTemplate, "load-balancer-name-template", "",
+		"Go template of the load balancer names, e.g. '{{.ClusterName}}-{{.Namespace}}-{{.ServiceName}}'. Takes precedence over the LoadBalancerNameTemplate of the cloud config.")
+	oscFlags.StringVar(&osc.AllowedOwnerClusterIDs, "allowed-owner-cluster-ids", "",
+		"Comma separated list of the cluster IDs that Services may set as owner of their load balancer. Takes precedence over the AllowedOwnerClusterIDs of the cloud config.")
+	oscFlags.StringVar(&osc.NodeAddressPriority, "node-address-priority", "",
+		"Comma separated list of the subnet IDs or device numbers of the NICs whose private IPs are reported first in the node addresses, e.g. 'subnet-12345678,1'. Takes precedence over the NodeAddressPriority of the cloud config.")
+	oscFlags.StringVar(&osc.LogVerbosity, "log-verbosity", "",
+		"Comma separated verbosity of the modules of the cloud provider (api, instances, loadbalancer and securitygroups), e.g. 'loadbalancer=4,api=2'. Takes precedence over the LogVerbosity of the cloud config, the --vmodule flag takes precedence over both.")
+	oscFlags.StringVar(&osc.ResourceTags, "resource-tags", "",
+		"Comma separated key=value tags set on all the resources created by the cloud provider (load balancers, security groups and public IPs), e.g. 'team=platform,cost-center=1234'. Takes precedence over the ResourceTags of the cloud config.")
+	oscFlags.StringVar(&osc.ExcludedNodesSelector, "excluded-nodes-selector", "",
+		"Label selector of the nodes never registered with the load balancers, e.g. 'node-role.kubernetes.io/gpu'. Takes precedence over the ExcludedNodesSelector of the cloud config.")
+	oscFlags.StringVar(&cloudHealthBindAddress, "cloud-health-bind-address", "",
+		"Address serving /healthz and /readyz with the checks of the connectivity to the cloud (oAPI, credentials and metadata), e.g. ':10270'. Disabled when empty.")
 	command := app.NewCloudControllerManagerCommand(opts, cloudInitializer, controllerInitializers, fss, wait.NeverStop)
+	command.AddCommand(newCheckCommand())
 
 	if err := command.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
+// newCheckCommand returns the check subcommand, validating the environment of the cloud
+// provider before its installation
+func newCheckCommand() *cobra.Command {
+	var cloudConfigFile string
+	command := &cobra.Command{
+		Use:   "check",
+		Short: "Validate the environment of the cloud provider",
+		Long: "Check the metadata service, the credentials, the cluster tags of the VMs and subnets, " +
+			"and the permissions of the credentials, and print a report. Exits with an error when a check fails.",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return osc.Preflight(cloudConfigFile, cmd.OutOrStdout())
+		},
+	}
+	command.Flags().StringVar(&cloudConfigFile, "cloud-config", "", "The path to the cloud provider configuration file.")
+	command.Flags().StringVar(&osc.CredentialsFile, "osc-credentials-file", "",
+		"JSON or INI file, or directory of a mounted Secret, containing the Outscale credentials.")
+	// The usage of the cloud controller manager lists its own flags
+	command.SetUsageFunc(func(cmd *cobra.Command) error {
+		fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n  %s\n\nFlags:\n%s", cmd.UseLine(), cmd.LocalFlags().FlagUsages())
+		return nil
+	})
+	command.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n", cmd.Long)
+		_ = cmd.Usage()
+	})
+	return command
+}
+
 func cloudInitializer(config *cloudcontrollerconfig.CompletedConfig) cloudprovider.Interface {
 	cloudConfig := config.ComponentConfig.KubeCloudShared.CloudProvider
 	providerName := cloudConfig.Name
@@ -86,5 +146,22 @@ func cloudInitializer(config *cloudcontrollerconfig.CompletedConfig) cloudprovid
 		}
 	}
 
+	if err := osc.CheckKubernetesVersion(config.Client.Discovery()); err != nil {
+		if refuseUnsupportedKubernetesVersion {
+			klog.Fatalf("Kubernetes version check failed: %v", err)
+		}
+		klog.Warningf("Kubernetes version check failed, running anyway: %v", err)
+	}
+
+	if cloudHealthBindAddress != "" {
+		if err := osc.ServeCloudHealth(cloud, cloudHealthBindAddress); err != nil {
+			klog.Fatalf("Unable to serve the cloud health: %v", err)
+		}
+	}
+
+	if err := osc.HandleShutdown(cloud); err != nil {
+		klog.Fatalf("Unable to handle the shutdown: %v", err)
+	}
+
 	return cloud
 }
@@ -22,22 +22,34 @@ package osc
 import (
 	"fmt"
 	"io"
+	"net/http"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"gopkg.in/gcfg.v1"
 
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 )
 
+// ReadCloudConfig reads the cloud config of the CCM, for the tools sharing it
+func ReadCloudConfig(config io.Reader) (*CloudConfig, error) {
+	return readCloudConfig(config)
+}
+
 func readCloudConfig(config io.Reader) (*CloudConfig, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("readAWSCloudConfig(%v)", config)
 	var cfg CloudConfig
-	var err error
 
 	if config != nil {
-		err = gcfg.ReadInto(&cfg, config)
+		data, err := io.ReadAll(config)
+		if err != nil {
+			return nil, err
+		}
+		if isCloudConfigV2(data) {
+			return readCloudConfigV2(data)
+		}
+		err = gcfg.ReadStringInto(&cfg, string(data))
 		if err != nil {
 			return nil, err
 		}
@@ -47,7 +59,6 @@ func readCloudConfig(config io.Reader) (*CloudConfig, error) {
 }
 
 func newCloud(cfg CloudConfig, awsServices Services) (*Cloud, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("newAWSCloud(%v, %v)", cfg, awsServices)
 	// We have some state in the Cloud object - in particular the attaching map
 	// Log so that if we are building multiple Cloud objects, it is obvious!
@@ -79,6 +90,205 @@ func newCloud(cfg CloudConfig, awsServices Services) (*Cloud, error) {
 		klog.Warningf("Strict OSC zone checking is disabled.  Proceeding with zone: %s", zone)
 	}
 
+	if cfg.Global.NodeUpdateCoalesceSeconds < 0 {
+		return nil, fmt.Errorf("invalid NodeUpdateCoalesceSeconds in config file: %d", cfg.Global.NodeUpdateCoalesceSeconds)
+	}
+
+	if cfg.Global.LoadBalancerStatusIntervalSeconds < 0 {
+		return nil, fmt.Errorf("invalid LoadBalancerStatusIntervalSeconds in config file: %d", cfg.Global.LoadBalancerStatusIntervalSeconds)
+	}
+
+	if cfg.Global.NodeSyncBatchWindowMilliseconds < 0 {
+		return nil, fmt.Errorf("invalid NodeSyncBatchWindowMilliseconds in config file: %d", cfg.Global.NodeSyncBatchWindowMilliseconds)
+	}
+
+	podCIDRPool, podCIDRMaskSize, err := parsePodCIDRPool(cfg.Global.PodCIDRPool, cfg.Global.PodCIDRMaskSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PodCIDRPool in config file: %v", err)
+	}
+
+	if cfg.Global.RouteTableCacheTTLSeconds < 0 {
+		return nil, fmt.Errorf("invalid RouteTableCacheTTLSeconds in config file: %d", cfg.Global.RouteTableCacheTTLSeconds)
+	}
+
+	if cfg.Global.SecurityGroupCacheTTLSeconds < 0 {
+		return nil, fmt.Errorf("invalid SecurityGroupCacheTTLSeconds in config file: %d", cfg.Global.SecurityGroupCacheTTLSeconds)
+	}
+
+	if cfg.Global.LoadBalancerMetricsIntervalSeconds < 0 {
+		return nil, fmt.Errorf("invalid LoadBalancerMetricsIntervalSeconds in config file: %d", cfg.Global.LoadBalancerMetricsIntervalSeconds)
+	}
+
+	if cfg.Global.HealthCheckHealthyThreshold < 0 || cfg.Global.HealthCheckUnhealthyThreshold < 0 ||
+		cfg.Global.HealthCheckTimeout < 0 || cfg.Global.HealthCheckInterval < 0 {
+		return nil, fmt.Errorf("invalid health check defaults in config file: values must not be negative")
+	}
+
+	if cfg.Global.LoadBalancerReadinessGateIntervalSeconds < 0 {
+		return nil, fmt.Errorf("invalid LoadBalancerReadinessGateIntervalSeconds in config file: %d", cfg.Global.LoadBalancerReadinessGateIntervalSeconds)
+	}
+
+	if cfg.Global.VMTerminationIntervalSeconds < 0 {
+		return nil, fmt.Errorf("invalid VMTerminationIntervalSeconds in config file: %d", cfg.Global.VMTerminationIntervalSeconds)
+	}
+
+	logVerbosity := cfg.Global.LogVerbosity
+	if LogVerbosity != "" {
+		logVerbosity = LogVerbosity
+	}
+	if err := setLogVerbosity(logVerbosity); err != nil {
+		return nil, fmt.Errorf("invalid LogVerbosity: %v", err)
+	}
+
+	if cfg.Global.DriftDetectionIntervalSeconds < 0 {
+		return nil, fmt.Errorf("invalid DriftDetectionIntervalSeconds in config file: %d", cfg.Global.DriftDetectionIntervalSeconds)
+	}
+
+	if cfg.Global.TargetVMTagsResyncIntervalSeconds < 0 {
+		return nil, fmt.Errorf("invalid TargetVMTagsResyncIntervalSeconds in config file: %d", cfg.Global.TargetVMTagsResyncIntervalSeconds)
+	}
+
+	if cfg.Global.OrphanSweepIntervalSeconds < 0 {
+		return nil, fmt.Errorf("invalid OrphanSweepIntervalSeconds in config file: %d", cfg.Global.OrphanSweepIntervalSeconds)
+	}
+
+	if cfg.Global.InstanceCacheTTLSeconds < 0 {
+		return nil, fmt.Errorf("invalid InstanceCacheTTLSeconds in config file: %d", cfg.Global.InstanceCacheTTLSeconds)
+	}
+
+	if cfg.Global.LoadBalancerReadyTimeoutSeconds < 0 || cfg.Global.LoadBalancerReadyTimeoutSeconds > maxLoadBalancerReadyTimeoutSeconds {
+		return nil, fmt.Errorf("invalid LoadBalancerReadyTimeoutSeconds in config file: %d", cfg.Global.LoadBalancerReadyTimeoutSeconds)
+	}
+
+	if cfg.Global.LoadBalancerProvisioningDeadlineSeconds < 0 || cfg.Global.LoadBalancerStalledRetrySeconds < 0 {
+		return nil, fmt.Errorf("invalid load balancer provisioning settings in config file: values must not be negative")
+	}
+
+	if cfg.Global.LoadBalancerBackendBatchSize < 0 || cfg.Global.LoadBalancerBackendWorkers < 0 {
+		return nil, fmt.Errorf("invalid load balancer backend settings in config file: values must not be negative")
+	}
+
+	if cfg.Global.ShutdownGracePeriodSeconds < 0 {
+		return nil, fmt.Errorf("invalid ShutdownGracePeriodSeconds in config file: %d", cfg.Global.ShutdownGracePeriodSeconds)
+	}
+
+	if cfg.Global.SecurityGroupRuleLimit < 0 {
+		return nil, fmt.Errorf("invalid SecurityGroupRuleLimit in config file: %d", cfg.Global.SecurityGroupRuleLimit)
+	}
+
+	if cfg.Global.SecurityGroupPoolSize < 0 {
+		return nil, fmt.Errorf("invalid SecurityGroupPoolSize in config file: %d", cfg.Global.SecurityGroupPoolSize)
+	}
+
+	if cfg.Global.LoadBalancerAPICallBudget < 0 || cfg.Global.LoadBalancerAPICallBudgetWindowSeconds < 0 {
+		return nil, fmt.Errorf("invalid load balancer API call budget settings in config file: values must not be negative")
+	}
+
+	if cfg.Global.KubeProxyHealthzPort < 0 || cfg.Global.KubeProxyHealthzPort > 65535 {
+		return nil, fmt.Errorf("invalid KubeProxyHealthzPort in config file: %d", cfg.Global.KubeProxyHealthzPort)
+	}
+
+	if cfg.Global.OapiQPS < 0 || cfg.Global.OapiBurst < 0 || cfg.Global.LbuQPS < 0 || cfg.Global.LbuBurst < 0 ||
+		cfg.Global.ThrottleMaxRetries < 0 {
+		return nil, fmt.Errorf("invalid API rate limiting settings in config file: values must not be negative")
+	}
+
+	if _, err := parseSecurityGroupMode(cfg.Global.SecurityGroupMode); err != nil {
+		return nil, fmt.Errorf("invalid SecurityGroupMode in config file: %v", err)
+	}
+	if _, err := parseBackendRuleGranularity(cfg.Global.BackendSecurityGroupRules); err != nil {
+		return nil, fmt.Errorf("invalid BackendSecurityGroupRules in config file: %v", err)
+	}
+
+	namePrefix, err := sanitizeResourceNamePrefix(cfg.Global.ResourceNamePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ResourceNamePrefix in config file: %v", err)
+	}
+
+	nameTemplate := cfg.Global.LoadBalancerNameTemplate
+	if LoadBalancerNameTemplate != "" {
+		nameTemplate = LoadBalancerNameTemplate
+	}
+	loadBalancerNameTemplate, err := parseLoadBalancerNameTemplate(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LoadBalancerNameTemplate: %v", err)
+	}
+
+	clusterTagPrefix, legacyClusterTagPrefixes, err := parseClusterTagPrefixes(cfg.Global.KubernetesClusterTagPrefix,
+		cfg.Global.LegacyKubernetesClusterTagPrefixes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KubernetesClusterTagPrefix in config file: %v", err)
+	}
+
+	providerIDScheme, err := parseProviderIDScheme(cfg.Global.ProviderIDScheme)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ProviderIDScheme in config file: %v", err)
+	}
+
+	nodeNames, err := parseNodeNameStrategy(cfg.Global.NodeNameStrategy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NodeNameStrategy in config file: %v", err)
+	}
+
+	secondaryRegions, err := parseSecondaryRegions(cfg.Global.SecondaryRegions, regionName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SecondaryRegions in config file: %v", err)
+	}
+
+	allowedOwnerClusterIDs := parseAllowedOwnerClusterIDs(cfg.Global.AllowedOwnerClusterIDs)
+	if AllowedOwnerClusterIDs != "" {
+		allowedOwnerClusterIDs = parseAllowedOwnerClusterIDs(AllowedOwnerClusterIDs)
+	}
+
+	resourceTagsValue := cfg.Global.ResourceTags
+	if ResourceTags != "" {
+		resourceTagsValue = ResourceTags
+	}
+	resourceTags, err := parseResourceTags(resourceTagsValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ResourceTags: %v", err)
+	}
+	for key := range resourceTags {
+		for _, prefix := range append([]string{clusterTagPrefix}, legacyClusterTagPrefixes...) {
+			if strings.HasPrefix(key, prefix) {
+				return nil, fmt.Errorf("invalid ResourceTags: tag %q is reserved for the cloud provider", key)
+			}
+		}
+	}
+
+	excludedNodesSelector := cfg.Global.ExcludedNodesSelector
+	if ExcludedNodesSelector != "" {
+		excludedNodesSelector = ExcludedNodesSelector
+	}
+	excludedNodes, err := parseExcludedNodesSelector(excludedNodesSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ExcludedNodesSelector: %v", err)
+	}
+
+	nodeIPFamilies, err := parseNodeIPFamilies(cfg.Global.NodeIPFamilies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NodeIPFamilies in config file: %v", err)
+	}
+
+	addressPriority := cfg.Global.NodeAddressPriority
+	if NodeAddressPriority != "" {
+		addressPriority = NodeAddressPriority
+	}
+	nodeAddressPriority, err := newNodeAddressPriority(addressPriority, cfg.Global.NodeAddressExcludedNics,
+		cfg.Global.NodeAddressPrimaryNicOnly)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NodeAddressPriority: %v", err)
+	}
+	nodePortNic, err := parseNodePortNic(cfg.Global.NodePortNic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NodePortNic in config file: %v", err)
+	}
+
+	loadBalancerDefaults, err := parseLoadBalancerDefaults(cfg.LoadBalancerDefaults.Annotation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LoadBalancerDefaults in config file: %v", err)
+	}
+
 	klog.Infof("OSC CCM cfg.Global: %v", cfg.Global)
 	klog.Infof("OSC CCM cfg: %v", cfg)
 
@@ -93,14 +303,92 @@ func newCloud(cfg CloudConfig, awsServices Services) (*Cloud, error) {
 		return nil, fmt.Errorf("error creating OSC ELB client: %v", err)
 	}
 
+	klog.Infof("Init Services/ObjectStorage")
+	objectStorage, err := awsServices.ObjectStorage(regionName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OSC OOS client: %v", err)
+	}
+
+	var records *dnsRecords
+	if cfg.Global.DNSHostedZoneID != "" {
+		klog.Infof("Init Services/DNS")
+		dns, err := awsServices.DNS(regionName)
+		if err != nil {
+			return nil, fmt.Errorf("error creating DNS client: %v", err)
+		}
+		records = newDNSRecords(dns, cfg.Global.DNSHostedZoneID, cfg.Global.DNSRecordTTL)
+	}
+
+	apiBudget := newAPICallBudget(cfg.Global.LoadBalancerAPICallBudget,
+		time.Duration(cfg.Global.LoadBalancerAPICallBudgetWindowSeconds)*time.Second)
+
+	securityGroups := newSecurityGroupCache(time.Duration(cfg.Global.SecurityGroupCacheTTLSeconds) * time.Second)
 	awsCloud := &Cloud{
-		compute:      computeService,
-		loadBalancer: elb,
-		metadata:     metadata,
-		cfg:          &cfg,
-		region:       regionName,
+		compute:             newSecurityGroupInvalidatingCompute(computeService, securityGroups),
+		loadBalancer:        newBudgetedLoadBalancer(elb, apiBudget),
+		metadata:            metadata,
+		cfg:                 &cfg,
+		region:              regionName,
+		nodeUpdates:         newNodeUpdateCoalescer(time.Duration(cfg.Global.NodeUpdateCoalesceSeconds) * time.Second),
+		nodeIPFamilies:      nodeIPFamilies,
+		nodeAddressPriority: nodeAddressPriority,
+		nodePortNic:         nodePortNic,
+		instanceMetadata:    newInstanceMetadataCache(instanceMetadataCacheTTL),
+		routeTables:         newRouteTableCache(time.Duration(cfg.Global.RouteTableCacheTTLSeconds) * time.Second),
+		securityGroups:      securityGroups,
+		draining:            newLoadBalancerDraining(),
+		provisioning: newLoadBalancerProvisioning(
+			time.Duration(cfg.Global.LoadBalancerProvisioningDeadlineSeconds)*time.Second,
+			time.Duration(cfg.Global.LoadBalancerStalledRetrySeconds)*time.Second),
+		apiBudget:        apiBudget,
+		backendGate:      newNodeHealthzGate(cfg.Global.BackendHealthzGating, cfg.Global.KubeProxyHealthzPort),
+		nodePortCheck:    newNodePortReachabilityCheck(cfg.Global.NodePortReachabilityCheck),
+		accessLogBuckets: newAccessLogBuckets(objectStorage, cfg.Global.CreateAccessLogBuckets),
+		dnsRecords:       records,
+
+		loadBalancerNameTemplate: loadBalancerNameTemplate,
+		allowedOwnerClusterIDs:   allowedOwnerClusterIDs,
+		excludedNodes:            excludedNodes,
+		loadBalancerDefaults:     loadBalancerDefaults,
 	}
+	awsCloud.tagging.namePrefix = namePrefix
+	awsCloud.tagging.extraTags = resourceTags
+	awsCloud.providerIDScheme = providerIDScheme
+	awsCloud.nodeNames = nodeNames
+	awsCloud.tagging.prefix = clusterTagPrefix
+	awsCloud.tagging.legacyPrefixes = legacyClusterTagPrefixes
+	awsCloud.securityGroupPool = newSecurityGroupPool(awsCloud, cfg.Global.SecurityGroupPoolSize)
+	awsCloud.initServices()
 	awsCloud.instanceCache.cloud = awsCloud
+	awsCloud.loadBalancerMetrics = newLoadBalancerMetricsCollector(awsCloud,
+		time.Duration(cfg.Global.LoadBalancerMetricsIntervalSeconds)*time.Second)
+	awsCloud.readinessGates = newLoadBalancerReadinessController(awsCloud,
+		time.Duration(cfg.Global.LoadBalancerReadinessGateIntervalSeconds)*time.Second)
+	awsCloud.vmTermination = newVMTerminationController(awsCloud,
+		time.Duration(cfg.Global.VMTerminationIntervalSeconds)*time.Second)
+	awsCloud.orphanSweeper = newOrphanSweeper(awsCloud,
+		time.Duration(cfg.Global.OrphanSweepIntervalSeconds)*time.Second)
+	awsCloud.securityGroupGC = newSecurityGroupGC(awsCloud, securityGroupGCInterval)
+	awsCloud.driftDetector = newLoadBalancerDriftDetector(awsCloud,
+		time.Duration(cfg.Global.DriftDetectionIntervalSeconds)*time.Second)
+	awsCloud.loadBalancerStatus = newLoadBalancerStatusController(awsCloud,
+		time.Duration(cfg.Global.LoadBalancerStatusIntervalSeconds)*time.Second)
+	awsCloud.nodeIPAM, err = newNodeIPAM(awsCloud, podCIDRPool, podCIDRMaskSize, cfg.Global.PodCIDRAllocationStore)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PodCIDRAllocationStore in config file: %v", err)
+	}
+	awsCloud.nodeSync = newNodeSyncBatcher(time.Duration(cfg.Global.NodeSyncBatchWindowMilliseconds)*time.Millisecond,
+		func(instanceIDs []InstanceID) (*allInstancesSnapshot, error) {
+			return awsCloud.instanceCache.describeAllInstancesCached(cacheCriteria{HasInstances: instanceIDs})
+		})
+	awsCloud.shutdown = newShutdownManager(awsCloud,
+		time.Duration(cfg.Global.ShutdownGracePeriodSeconds)*time.Second)
+	awsCloud.providerIDMigration = newProviderIDMigrator(awsCloud,
+		time.Duration(cfg.Global.ProviderIDMigrationIntervalSeconds)*time.Second)
+	awsCloud.loadBalancerClasses = newLoadBalancerClassController(awsCloud)
+	awsCloud.backendResync = newServiceQueue(awsCloud, "backend-resync", awsCloud.resyncBackends)
+	awsCloud.targetVMTagsResync = newTargetVMTagsResync(awsCloud,
+		time.Duration(cfg.Global.TargetVMTagsResyncIntervalSeconds)*time.Second)
 
 	tagged := cfg.Global.KubernetesClusterTag != "" || cfg.Global.KubernetesClusterID != ""
 
@@ -114,6 +402,7 @@ func newCloud(cfg CloudConfig, awsServices Services) (*Cloud, error) {
 			subnetID: cfg.Global.SubnetID,
 		}
 		awsCloud.vpcID = cfg.Global.VPC
+		awsCloud.selfSubnetID = cfg.Global.SubnetID
 	} else {
 		selfAWSInstance, err := awsCloud.buildSelfAWSInstance()
 		if err != nil {
@@ -121,6 +410,7 @@ func newCloud(cfg CloudConfig, awsServices Services) (*Cloud, error) {
 		}
 		awsCloud.selfAWSInstance = selfAWSInstance
 		awsCloud.vpcID = selfAWSInstance.vpcID
+		awsCloud.selfSubnetID = selfAWSInstance.subnetID
 		klog.Infof("OSC CCM Instance (%v)", selfAWSInstance)
 		klog.Infof("OSC CCM vpcID (%v)", selfAWSInstance.vpcID)
 
@@ -141,7 +431,19 @@ func newCloud(cfg CloudConfig, awsServices Services) (*Cloud, error) {
 		}
 	}
 
-	instances, err := newInstancesV2(zone, &awsCloud.tagging)
+	// The instances share the oAPI rate limiter of the compute client
+	var oapiHTTPClient *http.Client
+	signed := false
+	if provider, ok := awsServices.(*awsSDKProvider); ok {
+		oapiHTTPClient = provider.oapiHTTPClient()
+		signed = provider.refreshedCreds
+	}
+	awsCloud.nodeTagLabels = newNodeTagLabels(cfg.Global.NodeLabelTagPrefix,
+		cfg.Global.NodeLabelAllowedPrefixes, cfg.Global.NodeLabelDeniedPrefixes)
+	awsCloud.nodeTopologyLabels = newNodeTopologyLabels()
+	instances, err := newInstancesV2(zone, &awsCloud.tagging, nodeIPFamilies, nodeAddressPriority,
+		time.Duration(cfg.Global.InstanceCacheTTLSeconds)*time.Second, awsCloud.instanceMetadata, awsCloud.nodeTagLabels,
+		awsCloud.nodeTopologyLabels, awsCloud.providerIDScheme, &awsCloud.nodeNames, secondaryRegions, oapiHTTPClient, signed)
 	if err != nil {
 		return nil, err
 	}
@@ -153,7 +455,6 @@ func newCloud(cfg CloudConfig, awsServices Services) (*Cloud, error) {
 }
 
 func init() {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("init()")
 	registerMetrics()
 	cloudprovider.RegisterCloudProvider(ProviderName, func(config io.Reader) (cloudprovider.Interface, error) {
@@ -166,14 +467,22 @@ func init() {
 			return nil, fmt.Errorf("unable to validate custom endpoint overrides: %v", err)
 		}
 
-		provider := []credentials.Provider{
-			&credentials.EnvProvider{},
-			&credentials.SharedCredentialsProvider{},
+		if apiClients, err = newAPIClientSettings(cfg); err != nil {
+			return nil, fmt.Errorf("unable to configure the API clients: %v", err)
 		}
 
-		creds := credentials.NewChainCredentials(provider)
+		creds, err := newCloudCredentials(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize credentials: %v", err)
+		}
 
-		aws := newAWSSDKProvider(creds, cfg)
-		return newCloud(*cfg, aws)
+		aws := newAWSSDKProvider(creds.Credentials, creds.refreshed, cfg)
+		aws.credentialsFile = creds.file
+		cloud, err := newCloud(*cfg, aws)
+		if err != nil {
+			return nil, err
+		}
+		cloud.credentialsFile = creds.file
+		return cloud, nil
 	})
 }
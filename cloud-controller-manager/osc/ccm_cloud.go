@@ -24,17 +24,20 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"time"
+	"text/template"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/elb"
 	"github.com/outscale/osc-sdk-go/v2"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/informers"
 	informercorev1 "k8s.io/client-go/informers/core/v1"
+	informerdiscoveryv1 "k8s.io/client-go/informers/discovery/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -55,7 +58,17 @@ type Cloud struct {
 	metadata     EC2Metadata
 	cfg          *CloudConfig
 	region       string
-	vpcID        string
+
+	cloudNetwork
+
+	// Services wrapping the oAPI and LBU calls, see initServices
+	instanceService      InstanceService
+	subnetService        SubnetService
+	securityGroupService SecurityGroupService
+	loadBalancerService  LoadBalancerService
+
+	// Zones of the cluster, see GetClusterZones
+	zones *zoneCache
 
 	instances cloudprovider.InstancesV2
 
@@ -67,14 +80,162 @@ type Cloud struct {
 
 	instanceCache instanceCache
 
+	// Immutable metadata of the instances by provider ID, shared with the InstancesV2
+	instanceMetadata *instanceMetadataCache
+
+	// Coalesces node-change-driven load balancer updates
+	nodeUpdates *nodeUpdateCoalescer
+
+	// Batches the node-change-driven updates of all the load balancers on a snapshot of the VMs
+	nodeSync *nodeSyncBatcher
+
+	// IP families reported in the node addresses, in order of preference
+	nodeIPFamilies []v1.IPFamily
+
+	// Order of the NICs of the node addresses, nil to report them as discovered
+	nodeAddressPriority *nodeAddressPriority
+
+	// NIC of the nodes whose security groups are opened to the load balancers, "" for the
+	// security groups of the VMs
+	nodePortNic string
+
+	// Caches the route tables used for subnet classification
+	routeTables *routeTableCache
+	// Security groups tagged for the cluster, disabled when SecurityGroupCacheTTLSeconds is not set
+	securityGroups *securityGroupCache
+
+	// Publishes the backend health of the managed load balancers
+	loadBalancerMetrics *loadBalancerMetricsCollector
+
+	// Updates the load balancer readiness gate of the backend pods
+	readinessGates *loadBalancerReadinessController
+
+	// Cordons and drains the nodes whose VM is being stopped or terminated
+	vmTermination *vmTerminationController
+
+	// Checks the buckets of the load balancer access logs
+	accessLogBuckets *accessLogBuckets
+
+	// Registers the DNS names of the load balancers, nil when disabled
+	dnsRecords *dnsRecords
+
+	// Labels the nodes from the tags of their VM, nil when disabled
+	nodeTagLabels *nodeTagLabels
+
+	// Labels the nodes with the tenancy and placement group of their VM
+	nodeTopologyLabels *nodeTopologyLabels
+
+	// Deletes the load balancers and security groups left behind by deleted services
+	orphanSweeper *orphanSweeper
+
+	// Deletes the load balancer security groups which were still in use when their load
+	// balancer was deleted
+	securityGroupGC *securityGroupGC
+
+	// Pre-created security groups leased to the new load balancers
+	securityGroupPool *securityGroupPool
+
+	// Reconciles the services whose load balancer was modified out of band
+	driftDetector *loadBalancerDriftDetector
+
+	// Mirrors the load balancers in OSCLoadBalancer custom resources
+	loadBalancerStatus *loadBalancerStatusController
+
+	// Allocates the pod CIDRs of the nodes from the PodCIDRPool
+	nodeIPAM *nodeIPAM
+
+	// Tracks the in-flight load balancer reconciliations to interrupt them on shutdown
+	shutdown *shutdownManager
+
+	// Scheme of the provider IDs of the new nodes, see ProviderIDScheme
+	providerIDScheme string
+
+	// Derives the names of the nodes from their VM, see NodeNameStrategy
+	nodeNames nodeNameStrategy
+
+	// Recreates the drained nodes having a legacy provider ID with the osc:// scheme
+	providerIDMigration *providerIDMigrator
+
+	// Reconciles the services of the load balancer class of the cloud provider
+	loadBalancerClasses *loadBalancerClassController
+
+	// Updates again the backends of the services having instances not serving yet
+	backendResync *serviceQueue
+
+	// Periodically updates the backends of the services selecting their VMs by tags
+	targetVMTagsResync *targetVMTagsResync
+
+	// Reloads the credentials file when it changes
+	credentialsFile *fileCredentialsProvider
+
+	// Cluster IDs that services may set as owner of their load balancer
+	allowedOwnerClusterIDs sets.String
+
+	// Nodes never registered with the load balancers, see filterExcludedNodes
+	excludedNodes labels.Selector
+
+	// Renders the load balancer names, nil to derive them from the service UID
+	loadBalancerNameTemplate *template.Template
+
+	// Default values of the load balancer annotations
+	loadBalancerDefaults map[string]string
+
+	// Tracks the load balancers that are not ready yet
+	provisioning *loadBalancerProvisioning
+
+	// Limits the API calls made for each load balancer
+	apiBudget *apiCallBudget
+
+	// Tracks the load balancers draining their connections before deletion
+	draining *loadBalancerDraining
+
+	// Probes the nodes before registering them as load balancer backends
+	backendGate *nodeHealthzGate
+
+	// Checks that the NodePorts are reachable before reporting the load balancer ready
+	nodePortCheck *nodePortReachabilityCheck
+
+	// Records the mutations instead of executing them, only set on the copies of the
+	// cloud planning a dry run
+	plan *loadBalancerPlan
+
 	clientBuilder cloudprovider.ControllerClientBuilder
 	kubeClient    clientset.Interface
 
 	nodeInformer informercorev1.NodeInformer
 	// Extract the function out to make it easier to test
 	nodeInformerHasSynced cache.InformerSynced
-	eventBroadcaster      record.EventBroadcaster
-	eventRecorder         record.EventRecorder
+	// Indexes the services by load balancer name, see claimLoadBalancerName
+	serviceInformer          informercorev1.ServiceInformer
+	serviceInformerHasSynced cache.InformerSynced
+	// Watches the ConfigMaps of the source ranges labeled with LabelSourceRanges, see
+	// loadBalancerSourceRanges
+	configMapInformer informercorev1.ConfigMapInformer
+	// Watches the endpoints of the services with externalTrafficPolicy Local, see
+	// filterLocalEndpointInstances
+	endpointSliceInformer          informerdiscoveryv1.EndpointSliceInformer
+	endpointSliceInformerHasSynced cache.InformerSynced
+	eventBroadcaster               record.EventBroadcaster
+	eventRecorder                  record.EventRecorder
+}
+
+// cloudNetwork is the network the cluster runs in, shared with the services
+type cloudNetwork struct {
+	vpcID string
+	// Subnet of the VM running the CCM, used when no subnet is tagged for the cluster
+	selfSubnetID string
+}
+
+// initServices builds the services from the clients of the cloud
+func (c *Cloud) initServices() {
+	c.instanceService = newInstanceService(c.compute, &c.tagging, &c.nodeNames)
+	c.subnetService = newSubnetService(c.compute, &c.tagging, &c.cloudNetwork, c.routeTables)
+	securityGroupService := newSecurityGroupService(c.compute, &c.tagging, &c.cloudNetwork, c.cfg.Global.ElbSecurityGroup,
+		c.cfg.Global.SecurityGroupRuleLimit, c.securityGroups)
+	securityGroupService.pool = c.securityGroupPool
+	c.securityGroupService = securityGroupService
+	c.loadBalancerService = newLoadBalancerService(c.loadBalancer)
+	c.zones = newZoneCache(c.subnetService, zoneCacheTTL)
 }
 
 // ********************* CCM Cloud Object functions *********************
@@ -83,7 +244,6 @@ type Cloud struct {
 // Builds the awsInstance for the EC2 instance on which we are running.
 // This is called when the AWSCloud is initialized, and should not be called otherwise (because the awsInstance for the local instance is a singleton with drive mapping state)
 func (c *Cloud) buildSelfAWSInstance() (*VM, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("buildSelfAWSInstance()")
 	if c.selfAWSInstance != nil {
 		panic("do not call buildSelfAWSInstance directly")
@@ -101,33 +261,52 @@ func (c *Cloud) buildSelfAWSInstance() (*VM, error) {
 	// information from the instance returned by the EC2 API - it is a
 	// single API call to get all the information, and it means we don't
 	// have two code paths.
-	instance, err := c.getInstanceByID(instanceID)
+	instance, err := c.instanceService.getInstanceByID(instanceID)
 	if err != nil {
 		return nil, fmt.Errorf("error finding instance %s: %q", instanceID, err)
 	}
-	return newAWSInstance(c.compute, instance), nil
+	return newAWSInstance(c.compute, instance, &c.nodeNames), nil
 }
 
 // SetInformers implements InformerUser interface by setting up informer-fed caches for aws lib to
 // leverage Kubernetes API for caching
 func (c *Cloud) SetInformers(informerFactory informers.SharedInformerFactory) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("SetInformers(%v)", informerFactory)
 	klog.Infof("Setting up informers for Cloud")
 	c.nodeInformer = informerFactory.Core().V1().Nodes()
 	c.nodeInformerHasSynced = c.nodeInformer.Informer().HasSynced
+	c.serviceInformer = informerFactory.Core().V1().Services()
+	err := c.serviceInformer.Informer().AddIndexers(cache.Indexers{loadBalancerNameIndex: c.indexServiceByLoadBalancerName})
+	if err != nil {
+		klog.Warningf("Error indexing the services by load balancer name: %v", err)
+		return
+	}
+	c.serviceInformerHasSynced = c.serviceInformer.Informer().HasSynced
+	err = c.serviceInformer.Informer().AddIndexers(cache.Indexers{sourceRangesRefIndex: c.indexServiceBySourceRangesRef})
+	if err != nil {
+		klog.Warningf("Error indexing the services by source ranges ConfigMap: %v", err)
+		return
+	}
+	c.loadBalancerClasses.watch()
+	c.configMapInformer = informercorev1.New(informerFactory, metav1.NamespaceAll, func(options *metav1.ListOptions) {
+		options.LabelSelector = LabelSourceRanges
+	}).ConfigMaps()
+	c.watchSourceRangesRefs()
+	if c.cfg.Global.DeregisterNodesWithoutLocalEndpoints {
+		c.endpointSliceInformer = informerFactory.Discovery().V1().EndpointSlices()
+		c.endpointSliceInformerHasSynced = c.endpointSliceInformer.Informer().HasSynced
+		c.watchLocalEndpoints()
+	}
 }
 
 // AddSSHKeyToAllInstances is currently not implemented.
 func (c *Cloud) AddSSHKeyToAllInstances(ctx context.Context, user string, keyData []byte) error {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("AddSSHKeyToAllInstances(%v,%v)", user, keyData)
+	klog.V(5).InfoS("AddSSHKeyToAllInstances", "user", user, "keyDataLength", len(keyData))
 	return cloudprovider.NotImplemented
 }
 
 // CurrentNodeName returns the name of the current node
 func (c *Cloud) CurrentNodeName(ctx context.Context, hostname string) (types.NodeName, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("CurrentNodeName(%v)", hostname)
 	return c.selfAWSInstance.nodeName, nil
 }
@@ -135,7 +314,6 @@ func (c *Cloud) CurrentNodeName(ctx context.Context, hostname string) (types.Nod
 // Initialize passes a Kubernetes clientBuilder interface to the cloud provider
 func (c *Cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder,
 	stop <-chan struct{}) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("Initialize(%v,%v)", clientBuilder, stop)
 	c.clientBuilder = clientBuilder
 	c.kubeClient = clientBuilder.ClientOrDie("aws-cloud-provider")
@@ -143,32 +321,48 @@ func (c *Cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder,
 	c.eventBroadcaster.StartLogging(klog.Infof)
 	c.eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: c.kubeClient.CoreV1().Events("")})
 	c.eventRecorder = c.eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "aws-cloud-provider"})
+	c.nodeTagLabels.setClient(c.kubeClient)
+	c.nodeTopologyLabels.setClient(c.kubeClient)
+	c.routeTables.invalidateOnSignal(stop)
+	c.securityGroups.run(stop, c.securityGroupService.readTaggedSecurityGroups)
+	c.loadBalancerMetrics.run(stop)
+	c.readinessGates.run(stop)
+	c.vmTermination.run(stop)
+	c.orphanSweeper.run(stop)
+	c.securityGroupGC.run(stop)
+	c.securityGroupPool.run(stop)
+	c.driftDetector.run(stop)
+	c.loadBalancerStatus.setClient(clientBuilder)
+	c.loadBalancerStatus.run(stop)
+	c.nodeIPAM.run(stop)
+	c.providerIDMigration.run(stop)
+	c.loadBalancerClasses.run(stop)
+	c.backendResync.run(stop)
+	c.targetVMTagsResync.run(stop)
+	c.credentialsFile.watch(stop)
+	c.primeCaches()
 }
 
 // Clusters returns the list of clusters.
 func (c *Cloud) Clusters() (cloudprovider.Clusters, bool) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("Clusters()")
 	return nil, false
 }
 
 // ProviderName returns the cloud provider ID.
 func (c *Cloud) ProviderName() string {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("ProviderName")
 	return ProviderName
 }
 
 // LoadBalancer returns an implementation of LoadBalancer for Amazon Web Services.
 func (c *Cloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("LoadBalancer()")
 	return c, true
 }
 
 // Instances returns an implementation of Instances for Amazon Web Services.
 func (c *Cloud) Instances() (cloudprovider.Instances, bool) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("Instances()")
 	return c, true
 }
@@ -183,25 +377,21 @@ func (c *Cloud) InstancesV2() (cloudprovider.InstancesV2, bool) {
 
 // Zones returns an implementation of Zones for Amazon Web Services.
 func (c *Cloud) Zones() (cloudprovider.Zones, bool) {
-	debugPrintCallerFunctionName()
 	return c, true
 }
 
 // Routes returns an implementation of Routes for Amazon Web Services.
 func (c *Cloud) Routes() (cloudprovider.Routes, bool) {
-	debugPrintCallerFunctionName()
 	return c, false
 }
 
 // HasClusterID returns true if the cluster has a clusterID
 func (c *Cloud) HasClusterID() bool {
-	debugPrintCallerFunctionName()
 	return len(c.tagging.clusterID()) > 0
 }
 
 // NodeAddresses is an implementation of Instances.NodeAddresses.
 func (c *Cloud) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.NodeAddress, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("NodeAddresses(%v)", name)
 	if c.selfAWSInstance.nodeName == name || len(name) == 0 {
 		addresses := []v1.NodeAddress{}
@@ -211,10 +401,17 @@ func (c *Cloud) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.No
 			return nil, fmt.Errorf("error querying AWS metadata for %q: %q", "network/interfaces/macs", err)
 		}
 
+		nics := []nicAddresses{}
 		for _, macID := range strings.Split(macs, "\n") {
 			if macID == "" {
 				continue
 			}
+			nic := nicAddresses{}
+			if c.nodeAddressPriority != nil {
+				if nic, err = c.getMetadataNic(macID); err != nil {
+					return nil, err
+				}
+			}
 			macPath := path.Join("network/interfaces/macs/", macID, "local-ipv4s")
 			internalIPs, err := c.metadata.GetMetadata(macPath)
 			if err != nil {
@@ -224,9 +421,28 @@ func (c *Cloud) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.No
 				if internalIP == "" {
 					continue
 				}
-				addresses = append(addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: internalIP})
+				nic.addresses = append(nic.addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: internalIP})
+			}
+			nics = append(nics, nic)
+
+			if !hasIPFamily(c.nodeIPFamilies, v1.IPv6Protocol) {
+				continue
+			}
+			macPath = path.Join("network/interfaces/macs/", macID, "ipv6s")
+			internalIPv6s, err := c.metadata.GetMetadata(macPath)
+			if err != nil {
+				// Not every interface has an IPv6 address
+				klog.V(4).Infof("Could not determine IPv6 addresses of interface %s from metadata: %q", macID, err)
+				continue
+			}
+			for _, internalIP := range strings.Split(internalIPv6s, "\n") {
+				if internalIP == "" {
+					continue
+				}
+				nics[len(nics)-1].addresses = append(nics[len(nics)-1].addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: internalIP})
 			}
 		}
+		addresses = append(addresses, c.nodeAddressPriority.order(nics)...)
 
 		externalIP, err := c.metadata.GetMetadata("public-ipv4")
 		if err != nil {
@@ -259,21 +475,24 @@ func (c *Cloud) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.No
 			addresses = append(addresses, v1.NodeAddress{Type: v1.NodeExternalDNS, Address: externalDNS})
 		}
 
-		return addresses, nil
+		return sortNodeAddressesByIPFamily(addresses, c.nodeIPFamilies), nil
 	}
 
 	instance, err := c.getInstanceByNodeName(name)
 	if err != nil {
 		return nil, fmt.Errorf("getInstanceByNodeName failed for %q with %q", name, err)
 	}
-	return extractNodeAddresses(instance)
+	addresses, err := extractNodeAddresses(instance, c.nodeAddressPriority)
+	if err != nil {
+		return nil, err
+	}
+	return sortNodeAddressesByIPFamily(addresses, c.nodeIPFamilies), nil
 }
 
 // NodeAddressesByProviderID returns the node addresses of an instances with the specified unique providerID
 // This method will not be called from the node that is requesting this ID. i.e. metadata service
 // and other local methods cannot be used here
 func (c *Cloud) NodeAddressesByProviderID(ctx context.Context, providerID string) ([]v1.NodeAddress, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("NodeAddressesByProviderID(%v)", providerID)
 	instanceID, err := KubernetesInstanceID(providerID).MapToAWSInstanceID()
 	if err != nil {
@@ -285,13 +504,16 @@ func (c *Cloud) NodeAddressesByProviderID(ctx context.Context, providerID string
 		return nil, err
 	}
 
-	return extractNodeAddresses(instance)
+	addresses, err := extractNodeAddresses(instance, c.nodeAddressPriority)
+	if err != nil {
+		return nil, err
+	}
+	return sortNodeAddressesByIPFamily(addresses, c.nodeIPFamilies), nil
 }
 
 // InstanceExistsByProviderID returns true if the instance with the given provider id still exists.
 // If false is returned with no error, the instance will be immediately deleted by the cloud controller manager.
 func (c *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("InstanceExistsByProviderID(%v)", providerID)
 	instanceID, err := KubernetesInstanceID(providerID).MapToAWSInstanceID()
 	if err != nil {
@@ -326,7 +548,6 @@ func (c *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID strin
 
 // InstanceShutdownByProviderID returns true if the instance is in safe state to detach volumes
 func (c *Cloud) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("InstanceShutdownByProviderID(%v)", providerID)
 	instanceID, err := KubernetesInstanceID(providerID).MapToAWSInstanceID()
 	if err != nil {
@@ -365,7 +586,6 @@ func (c *Cloud) InstanceShutdownByProviderID(ctx context.Context, providerID str
 
 // InstanceID returns the cloud provider ID of the node with the specified nodeName.
 func (c *Cloud) InstanceID(ctx context.Context, nodeName types.NodeName) (string, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("InstanceID(%v)", nodeName)
 	// In the future it is possible to also return an endpoint as:
 	// <endpoint>/<zone>/<instanceid>
@@ -387,8 +607,10 @@ func (c *Cloud) InstanceID(ctx context.Context, nodeName types.NodeName) (string
 // This method will not be called from the node that is requesting this ID. i.e. metadata service
 // and other local methods cannot be used here
 func (c *Cloud) InstanceTypeByProviderID(ctx context.Context, providerID string) (string, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("InstanceTypeByProviderID(%v)", providerID)
+	if metadata, found := c.instanceMetadata.get(providerID); found {
+		return metadata.instanceType, nil
+	}
 	instanceID, err := KubernetesInstanceID(providerID).MapToAWSInstanceID()
 	if err != nil {
 		return "", err
@@ -404,7 +626,6 @@ func (c *Cloud) InstanceTypeByProviderID(ctx context.Context, providerID string)
 
 // InstanceType returns the type of the node with the specified nodeName.
 func (c *Cloud) InstanceType(ctx context.Context, nodeName types.NodeName) (string, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("InstanceType(%v)", nodeName)
 	if c.selfAWSInstance.nodeName == nodeName {
 		return c.selfAWSInstance.instanceType, nil
@@ -418,7 +639,6 @@ func (c *Cloud) InstanceType(ctx context.Context, nodeName types.NodeName) (stri
 
 // GetZone implements Zones.GetZone
 func (c *Cloud) GetZone(ctx context.Context) (cloudprovider.Zone, error) {
-	debugPrintCallerFunctionName()
 	return cloudprovider.Zone{
 		FailureDomain: c.selfAWSInstance.availabilityZone,
 		Region:        c.region,
@@ -429,13 +649,15 @@ func (c *Cloud) GetZone(ctx context.Context) (cloudprovider.Zone, error) {
 // This is particularly useful in external cloud providers where the kubelet
 // does not initialize node data.
 func (c *Cloud) GetZoneByProviderID(ctx context.Context, providerID string) (cloudprovider.Zone, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("GetZoneByProviderID(%v)", providerID)
+	if metadata, found := c.instanceMetadata.get(providerID); found {
+		return cloudprovider.Zone{FailureDomain: metadata.zone, Region: c.region}, nil
+	}
 	instanceID, err := KubernetesInstanceID(providerID).MapToAWSInstanceID()
 	if err != nil {
 		return cloudprovider.Zone{}, err
 	}
-	instance, err := c.getInstanceByID(string(instanceID))
+	instance, err := c.instanceService.getInstanceByID(string(instanceID))
 	if err != nil {
 		return cloudprovider.Zone{}, err
 	}
@@ -452,7 +674,6 @@ func (c *Cloud) GetZoneByProviderID(ctx context.Context, providerID string) (clo
 // This is particularly useful in external cloud providers where the kubelet
 // does not initialize node data.
 func (c *Cloud) GetZoneByNodeName(ctx context.Context, nodeName types.NodeName) (cloudprovider.Zone, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("GetZoneByNodeName(%v)", nodeName)
 	instance, err := c.getInstanceByNodeName(nodeName)
 	if err != nil {
@@ -469,7 +690,6 @@ func (c *Cloud) GetZoneByNodeName(ctx context.Context, nodeName types.NodeName)
 
 // Retrieves instance's vpc id from metadata
 func (c *Cloud) findVPCID() (string, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("findVPCID()")
 	macs, err := c.metadata.GetMetadata("network/interfaces/macs/")
 	if err != nil {
@@ -493,785 +713,272 @@ func (c *Cloud) findVPCID() (string, error) {
 
 // ********************* CCM Cloud Resource LBU Functions  *********************
 
-func (c *Cloud) addLoadBalancerTags(loadBalancerName string, requested map[string]string) error {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("addLoadBalancerTags(%v,%v)", loadBalancerName, requested)
-	var tags []*elb.Tag
-	for k, v := range requested {
-		tag := &elb.Tag{
-			Key:   aws.String(k),
-			Value: aws.String(v),
-		}
-		tags = append(tags, tag)
-	}
-
-	request := &elb.AddTagsInput{}
-	request.LoadBalancerNames = []*string{&loadBalancerName}
-	request.Tags = tags
+// buildELBSecurityGroupList returns list of SecurityGroups which should be
+// attached to ELB created by a service. List always consist of at least
+// 1 member which is an SG created for this service or a SG from the Global config.
+// Extra groups can be specified via annotation, as can extra tags for any
+// new groups. The annotation "ServiceAnnotationLoadBalancerSecurityGroups" allows for
+// setting the security groups specified.
+func (c *Cloud) buildELBSecurityGroupList(service *v1.Service, loadBalancerName string, annotations map[string]string) ([]string, error) {
+	klog.V(5).Infof("buildELBSecurityGroupList(%v,%v,%v)", service, loadBalancerName, annotations)
+	var err error
+	var securityGroupID string
+	serviceName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
 
-	_, err := c.loadBalancer.AddTags(request)
+	mode, err := c.securityGroupMode(annotations)
 	if err != nil {
-		return fmt.Errorf("error adding tags to load balancer: %v", err)
+		return nil, err
 	}
-	return nil
-}
-
-// Gets the current load balancer state
-func (c *Cloud) describeLoadBalancer(name string) (*elb.LoadBalancerDescription, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("describeLoadBalancer(%v)", name)
-	request := &elb.DescribeLoadBalancersInput{}
-	request.LoadBalancerNames = []*string{&name}
 
-	response, err := c.loadBalancer.DescribeLoadBalancers(request)
-	if err != nil {
-		if awsError, ok := err.(awserr.Error); ok {
-			if awsError.Code() == "LoadBalancerNotFound" {
-				return nil, nil
-			}
+	if selector, ok := annotations[ServiceAnnotationLoadBalancerSecurityGroupSelector]; ok {
+		securityGroupID, err = c.securityGroupService.findSecurityGroupBySelector(parseKeyValueList(selector))
+		if err != nil {
+			klog.Errorf("Error selecting load balancer security group: %q", err)
+			return nil, err
+		}
+	} else if c.cfg.Global.ElbSecurityGroup != "" {
+		securityGroupID = c.cfg.Global.ElbSecurityGroup
+	} else if mode == securityGroupModeNone {
+		if strings.TrimSpace(annotations[ServiceAnnotationLoadBalancerSecurityGroups]) == "" {
+			return nil, fmt.Errorf("security group mode %q requires the %s or %s annotation",
+				mode, ServiceAnnotationLoadBalancerSecurityGroups, ServiceAnnotationLoadBalancerSecurityGroupSelector)
+		}
+	} else if mode == securityGroupModeShared {
+		if c.isPeeredLoadBalancer(annotations) {
+			return nil, fmt.Errorf("security group mode %q is not supported for the load balancers in Net %s, peered with the Net of the nodes",
+				mode, c.loadBalancerNetID(annotations))
+		}
+		securityGroupID, err = c.ensureSharedSecurityGroup()
+		if err != nil {
+			klog.Errorf("Error creating shared load balancer security group: %q", err)
+			return nil, err
+		}
+	} else {
+		tagging, err := c.serviceTagging(annotations)
+		if err != nil {
+			return nil, err
+		}
+		// Create a security group for the load balancer
+		sgName := c.tagging.prefixedName("k8s-elb-" + loadBalancerName)
+		sgDescription := fmt.Sprintf("Security group for Kubernetes ELB %s (%v)", loadBalancerName, serviceName)
+		var created bool
+		// The service is recorded in a tag as well, the security groups leased from the pool
+		// not having the description
+		sgTags := getLoadBalancerAdditionalTags(annotations)
+		sgTags[TagNameKubernetesService] = serviceName.String()
+		securityGroupID, created, err = c.loadBalancerSecurityGroupService(annotations).ensureSecurityGroup(sgName, sgDescription, tagging, sgTags)
+		if err != nil {
+			klog.Errorf("Error creating load balancer security group: %q", err)
+			return nil, err
+		}
+		if created {
+			c.shutdown.securityGroupCreated(loadBalancerName, securityGroupID)
+			c.recordLoadBalancerEvent(service, EventCreatedSecurityGroup, "Created security group %s (%s) for load balancer %s",
+				securityGroupID, sgName, loadBalancerName)
 		}
-		return nil, err
 	}
 
-	var ret *elb.LoadBalancerDescription
-	for _, loadBalancer := range response.LoadBalancerDescriptions {
-		if ret != nil {
-			klog.Errorf("Found multiple load balancers with name: %s", name)
+	sgList := []string{}
+
+	for _, extraSG := range strings.Split(annotations[ServiceAnnotationLoadBalancerSecurityGroups], ",") {
+		extraSG = strings.TrimSpace(extraSG)
+		if len(extraSG) > 0 {
+			sgList = append(sgList, extraSG)
 		}
-		ret = loadBalancer
 	}
-	return ret, nil
-}
 
-// Retrieves the specified security group from the AWS API, or returns nil if not found
-func (c *Cloud) findSecurityGroup(securityGroupID string) (*osc.SecurityGroup, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("findSecurityGroup(%v)", securityGroupID)
-	readSecurityGroupsRequest := osc.ReadSecurityGroupsRequest{
-		Filters: &osc.FiltersSecurityGroup{
-			SecurityGroupIds: &[]string{
-				securityGroupID,
-			},
-		},
+	// If no Security Groups have been specified with the ServiceAnnotationLoadBalancerSecurityGroups annotation, we add the default one.
+	if len(sgList) == 0 {
+		sgList = append(sgList, securityGroupID)
 	}
-	// We don't apply our tag filters because we are retrieving by ID
 
-	groups, err := c.compute.ReadSecurityGroups(&readSecurityGroupsRequest)
-	if err != nil {
-		klog.Warningf("Error retrieving security group: %q", err)
-		return nil, err
+	for _, extraSG := range strings.Split(annotations[ServiceAnnotationLoadBalancerExtraSecurityGroups], ",") {
+		extraSG = strings.TrimSpace(extraSG)
+		if len(extraSG) > 0 {
+			sgList = append(sgList, extraSG)
+		}
 	}
 
-	if len(groups) == 0 {
-		return nil, nil
-	}
-	if len(groups) != 1 {
-		// This should not be possible - ids should be unique
-		return nil, fmt.Errorf("multiple security groups found with same id %q", securityGroupID)
-	}
-	group := groups[0]
-	return &group, nil
+	return sgList, nil
 }
 
-// Makes sure the security group ingress is exactly the specified permissions
-// Returns true if and only if changes were made
-// The security group must already exist
-func (c *Cloud) setSecurityGroupIngress(securityGroupID string, permissions IPRulesSet) (bool, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("setSecurityGroupIngress(%v,%v)", securityGroupID, permissions)
-	// We do not want to make changes to the Global defined SG
-	if securityGroupID == c.cfg.Global.ElbSecurityGroup {
-		return false, nil
+// EnsureLoadBalancer implements LoadBalancer.EnsureLoadBalancer
+func (c *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, apiService *v1.Service,
+	nodes []*v1.Node) (_ *v1.LoadBalancerStatus, err error) {
+	logger := serviceLogger(ctx, apiService)
+	ctx = klog.NewContext(ctx, logger)
+	logger.V(5).Info("Ensuring load balancer", "cluster", clusterName, "nodes", klog.KObjSlice(nodes))
+	apiService = c.withLoadBalancerDefaults(apiService)
+	defer func() {
+		c.recordLoadBalancerError(apiService, err)
+		c.loadBalancerStatus.reconciled(apiService, err)
+	}()
+	if !c.managesLoadBalancerClass(apiService) {
+		return nil, fmt.Errorf("load balancer class %q of service %s/%s is not managed by this cloud provider",
+			*apiService.Spec.LoadBalancerClass, apiService.Namespace, apiService.Name)
+	}
+	nodes = c.filterExcludedNodes(nodes)
+	logger.V(6).Info("Load balancer annotations", "annotations", apiService.Annotations)
+	annotations, err := expandLoadBalancerProfile(apiService.Annotations)
+	if err != nil {
+		return nil, err
 	}
-
-	group, err := c.findSecurityGroup(securityGroupID)
+	dryRun, err := c.isLoadBalancerDryRun(annotations)
 	if err != nil {
-		klog.Warningf("Error retrieving security group %q", err)
-		return false, err
+		return nil, err
 	}
-
-	if group == nil {
-		return false, fmt.Errorf("security group not found: %s", securityGroupID)
+	if dryRun {
+		return c.planEnsureLoadBalancer(ctx, clusterName, apiService, nodes)
 	}
-
-	klog.V(2).Infof("Existing security group ingress: %s %v", securityGroupID, group.GetInboundRules())
-
-	actual := NewIPRulesSet(group.GetInboundRules()...)
-
-	// OSC groups rules together, for example combining:
-	//
-	// { Port=80, Range=[A] } and { Port=80, Range=[B] }
-	//
-	// into { Port=80, Range=[A,B] }
-	//
-	// We have to ungroup them, because otherwise the logic becomes really
-	// complicated, and also because if we have Range=[A,B] and we try to
-	// add Range=[A] then OSC complains about a duplicate rule.
-	permissions = permissions.Ungroup()
-	actual = actual.Ungroup()
-
-	remove := actual.Difference(permissions)
-	add := permissions.Difference(actual)
-
-	if add.Len() == 0 && remove.Len() == 0 {
-		return false, nil
+	if len(apiService.Spec.Ports) == 0 {
+		return nil, fmt.Errorf("requested load balancer with no ports")
 	}
 
-	// TODO: There is a limit in VPC of 100 rules per security group, so we
-	// probably should try grouping or combining to fit under this limit.
-	// But this is only used on the ELB security group currently, so it
-	// would require (ports * CIDRS) > 100.  Also, it isn't obvious exactly
-	// how removing single permissions from compound rules works, and we
-	// don't want to accidentally open more than intended while we're
-	// applying changes.
-	if add.Len() != 0 {
-		klog.V(2).Infof("Adding security group ingress: %s %v", securityGroupID, add.List())
-
-		list := add.List()
-		request := osc.CreateSecurityGroupRuleRequest{
-			Flow:            "Inbound",
-			SecurityGroupId: securityGroupID,
-			Rules:           &list,
-		}
+	// Figure out what mappings we want on the load balancer
+	listeners := []*elb.Listener{}
 
-		_, err = c.compute.CreateSecurityGroupRule(&request)
-		if err != nil {
-			return false, fmt.Errorf("error authorizing security group ingress: %q", err)
-		}
+	sslPorts := getPortSets(annotations[ServiceAnnotationLoadBalancerSSLPorts])
+	instancePorts, err := getBackendPorts(annotations)
+	if err != nil {
+		return nil, err
 	}
-	if remove.Len() != 0 {
-		klog.V(2).Infof("Remove security group ingress: %s %v", securityGroupID, remove.List())
 
-		list := remove.List()
-		request := osc.DeleteSecurityGroupRuleRequest{
-			Flow:            "Inbound",
-			SecurityGroupId: securityGroupID,
-			Rules:           &list,
+	c.recordAppProtocolConflicts(apiService, annotations)
+	for _, port := range apiService.Spec.Ports {
+		if err := c.checkListenerProtocol(port); err != nil {
+			return nil, err
+		}
+		// The NodePort is not needed when the instance port is mapped, e.g. to the host
+		// port of an ingress controller
+		instancePort := instancePorts.instancePort(port)
+		if instancePort == 0 {
+			klog.Errorf("Ignoring port without NodePort defined: %v", port)
+			continue
 		}
 
-		_, err = c.compute.DeleteSecurityGroupRule(&request)
+		listener, err := buildListener(port, annotations, sslPorts)
 		if err != nil {
-			return false, fmt.Errorf("error revoking security group ingress: %q", err)
+			return nil, err
 		}
+		listener.InstancePort = &instancePort
+		listeners = append(listeners, listener)
 	}
 
-	return true, nil
-}
-
-// Makes sure the security group includes the specified permissions
-// Returns true if and only if changes were made
-// The security group must already exist
-func (c *Cloud) addSecurityGroupRules(securityGroupID string, addPermissions *[]osc.SecurityGroupRule, isPublicCloud bool) (bool, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("addSecurityGroupRules(%v,%v,%v)", securityGroupID, addPermissions, isPublicCloud)
-	// We do not want to make changes to the Global defined SG
-	if securityGroupID == c.cfg.Global.ElbSecurityGroup {
-		return false, nil
-	}
-
-	group, err := c.findSecurityGroup(securityGroupID)
+	extraListeners, err := getExtraListeners(annotations, listeners)
 	if err != nil {
-		klog.Warningf("Error retrieving security group: %q", err)
-		return false, err
+		return nil, err
 	}
-
-	if group == nil {
-		return false, fmt.Errorf("security group not found: %s", securityGroupID)
+	for _, extraListener := range extraListeners {
+		listeners = append(listeners, extraListener.listeners()...)
 	}
 
-	klog.Infof("Existing security group ingress: %s %v", securityGroupID, group.GetInboundRules())
-
-	changes := []osc.SecurityGroupRule{}
-	for _, addPermission := range *addPermissions {
-		hasUserID := false
-		for _, member := range addPermission.GetSecurityGroupsMembers() {
-			if member.HasAccountId() {
-				hasUserID = true
-			}
-		}
-
-		found := false
-		for _, groupPermission := range group.GetInboundRules() {
-			if ruleExists(&addPermission, &groupPermission, hasUserID) {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			changes = append(changes, addPermission)
-		}
+	if apiService.Spec.SessionAffinity != v1.ServiceAffinityNone && !hasHTTPListener(listeners) {
+		// LBU supports sticky sessions, but only when configured for HTTP/HTTPS
+		return nil, fmt.Errorf("unsupported load balancer affinity: %v without HTTP or HTTPS listener", apiService.Spec.SessionAffinity)
+	}
+	if _, found := annotations[ServiceAnnotationLoadBalancerStickinessPolicy]; found && !hasHTTPListener(listeners) {
+		klog.Warningf("Ignoring annotation %s of service %s/%s without HTTP or HTTPS listener",
+			ServiceAnnotationLoadBalancerStickinessPolicy, apiService.Namespace, apiService.Name)
 	}
 
-	if len(changes) == 0 && !isPublicCloud {
-		return false, nil
+	if apiService.Spec.LoadBalancerIP != "" {
+		return nil, fmt.Errorf("LoadBalancerIP cannot be specified for AWS ELB")
 	}
 
-	klog.Infof("Adding security group ingress: %s %v isPublic %v)", securityGroupID, changes, isPublicCloud)
+	if _, found := annotations[ServiceAnnotationLoadBalancerPrivateIP]; found {
+		return nil, errLoadBalancerPrivateIP
+	}
 
-	request := osc.CreateSecurityGroupRuleRequest{
-		Flow:            "Inbound",
-		SecurityGroupId: securityGroupID,
+	sourceRanges, err := c.loadBalancerSourceRanges(apiService, annotations)
+	if err != nil {
+		return nil, err
 	}
-	if !isPublicCloud {
-		request.SetRules(changes)
-	} else {
-		request.SetSecurityGroupNameToLink(DefaultSrcSgName)
-		request.SetSecurityGroupAccountIdToLink(DefaultSgOwnerID)
+
+	// Determine if this is tagged as an Internal ELB
+	internalELB := false
+	internalAnnotation := apiService.Annotations[ServiceAnnotationLoadBalancerInternal]
+	if internalAnnotation == "false" {
+		internalELB = false
+	} else if internalAnnotation != "" {
+		internalELB = true
 	}
-	_, err = c.compute.CreateSecurityGroupRule(&request)
-	if err != nil {
-		ignore := false
-		if isPublicCloud {
-			if strings.Contains(err.Error(), "Conflict") {
-				klog.V(2).Infof("Ignoring Duplicate for security group (%s), assuming is used by other public LB", securityGroupID)
-				ignore = true
+	logger.V(5).Info("Load balancer scheme", "internal", internalELB, "sourceRanges", sourceRanges.StringSlice())
 
-			}
-		}
-		if !ignore {
-			klog.Warningf("Error authorizing security group ingress %q", err)
-			return false, fmt.Errorf("error authorizing security group ingress: %q", err)
-		}
+	proxyProtocolPolicy, err := c.proxyProtocolPolicy(annotations)
+	if err != nil {
+		return nil, err
 	}
 
-	return true, nil
-}
+	loadBalancerAttributes, err := getLoadBalancerAttributes(annotations)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.ensureAccessLogBucket(apiService, loadBalancerAttributes); err != nil {
+		return nil, err
+	}
 
-// Makes sure the security group no longer includes the specified permissions
-// Returns true if and only if changes were made
-// If the security group no longer exists, will return (false, nil)
-func (c *Cloud) removeSecurityGroupRules(securityGroupID string, removePermissions *[]osc.SecurityGroupRule, isPublicCloud bool) (bool, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("removeSecurityGroupRules(%v,%v)", securityGroupID, removePermissions)
-	// We do not want to make changes to the Global defined SG
-	if securityGroupID == c.cfg.Global.ElbSecurityGroup {
-		return false, nil
+	readyTimeout, err := c.getLoadBalancerReadyTimeout(annotations)
+	if err != nil {
+		return nil, err
 	}
 
-	group, err := c.findSecurityGroup(securityGroupID)
+	sgMode, err := c.securityGroupMode(annotations)
 	if err != nil {
-		klog.Warningf("Error retrieving security group: %q", err)
-		return false, err
+		return nil, err
 	}
 
-	if group == nil {
-		klog.Warning("Security group not found: ", securityGroupID)
-		return false, nil
+	backendRules, err := c.backendRuleGranularity(annotations, sgMode)
+	if err != nil {
+		return nil, err
 	}
 
-	changes := []osc.SecurityGroupRule{}
-	for _, removePermission := range *removePermissions {
-		hasUserID := false
-		for _, member := range removePermission.GetSecurityGroupsMembers() {
-			if member.HasAccountId() {
-				hasUserID = true
-			}
+	if c.plan == nil {
+		if err := c.persistLoadBalancerName(apiService); err != nil {
+			return nil, err
 		}
-
-		for _, groupPermission := range group.GetInboundRules() {
-			if ruleExists(&removePermission, &groupPermission, hasUserID) {
-				changes = append(changes, removePermission)
-				break
-			}
+		if err := c.addLoadBalancerFinalizer(apiService); err != nil {
+			return nil, err
 		}
-
 	}
 
-	if len(changes) == 0 && !isPublicCloud {
-		return false, nil
+	// Find the instances and the subnets that the ELB will live in
+	discovery, err := c.discoverLoadBalancerResources(annotations, nodes, internalELB)
+	if err != nil {
+		return nil, err
 	}
+	instances := discovery.instances
+	subnetIDs := discovery.subnetIDs
 
-	klog.Infof("Removing security group ingress: %s %v", securityGroupID, changes)
-
-	request := osc.DeleteSecurityGroupRuleRequest{
-		Flow:            "Inbound",
-		SecurityGroupId: securityGroupID,
-	}
-	if !isPublicCloud {
-		request.SetRules(changes)
-	} else {
-		request.SetSecurityGroupNameToUnlink(DefaultSrcSgName)
-		request.SetSecurityGroupAccountIdToUnlink(DefaultSgOwnerID)
+	// Bail out early if there are no subnets
+	if len(subnetIDs) == 0 && c.isPeeredLoadBalancer(annotations) {
+		return nil, fmt.Errorf("could not find any suitable subnet tagged for the cluster in Net %s", c.loadBalancerNetID(annotations))
 	}
-
-	_, err = c.compute.DeleteSecurityGroupRule(&request)
-	if err != nil {
-		klog.Warningf("Error revoking security group ingress: %q", err)
-		return false, err
+	if len(subnetIDs) == 0 {
+		klog.Warningf("could not find any suitable subnets for creating the ELB")
 	}
 
-	return true, nil
-}
-
-// Makes sure the security group exists.
-// For multi-cluster isolation, name must be globally unique, for example derived from the service UUID.
-// Additional tags can be specified
-// Returns the security group id or error
-func (c *Cloud) ensureSecurityGroup(name string, description string, additionalTags map[string]string) (string, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("ensureSecurityGroup (%v,%v,%v)", name, description, additionalTags)
-
-	groupID := ""
-	attempt := 0
-	for {
-		attempt++
-
-		// Note that we do _not_ add our tag filters; group-name + vpc-id is the EC2 primary key.
-		// However, we do check that it matches our tags.
-		// If it doesn't have any tags, we tag it; this is how we recover if we failed to tag before.
-		// If it has a different cluster's tags, that is an error.
-		// This shouldn't happen because name is expected to be globally unique (UUID derived)
-		request := osc.ReadSecurityGroupsRequest{
-			Filters: &osc.FiltersSecurityGroup{
-				SecurityGroupNames: &[]string{name},
-			},
-		}
-
-		if c.vpcID != "" {
-			request.Filters.NetIds = &[]string{c.vpcID}
+	if az := annotations[ServiceAnnotationLoadBalancerSubnetAZ]; az != "" {
+		if annotations[ServiceAnnotationLoadBalancerSubnetID] != "" || annotations[ServiceAnnotationLoadBalancerSubnetIDs] != "" {
+			return nil, fmt.Errorf("annotation %v is mutually exclusive with %v and %v", ServiceAnnotationLoadBalancerSubnetAZ,
+				ServiceAnnotationLoadBalancerSubnetID, ServiceAnnotationLoadBalancerSubnetIDs)
 		}
-
-		securityGroups, err := c.compute.ReadSecurityGroups(&request)
+		subnetID, err := selectLoadBalancerSubnetByAZ(discovery.subnetsByAZ, az)
 		if err != nil {
-			return "", err
-		}
-
-		if len(securityGroups) >= 1 {
-			if len(securityGroups) > 1 {
-				klog.Warningf("Found multiple security groups with name: %q", name)
-			}
-			err := c.tagging.readRepairClusterTags(
-				c.compute, securityGroups[0].GetSecurityGroupId(),
-				ResourceLifecycleOwned, nil, securityGroups[0].Tags)
-			if err != nil {
-				return "", err
-			}
-
-			return securityGroups[0].GetSecurityGroupId(), nil
+			return nil, err
 		}
-
-		createRequest := osc.CreateSecurityGroupRequest{}
-		if c.vpcID != "" {
-			createRequest.SetNetId(c.vpcID)
+		klog.V(2).Infof("User subregion %v found, override list of subnets (%v) to ([%v])", az, subnetIDs, subnetID)
+		subnetIDs = []string{subnetID}
+	} else if annotations[ServiceAnnotationLoadBalancerSubnetIDs] != "" {
+		if annotations[ServiceAnnotationLoadBalancerSubnetID] != "" {
+			return nil, fmt.Errorf("annotations %v and %v are mutually exclusive",
+				ServiceAnnotationLoadBalancerSubnetID, ServiceAnnotationLoadBalancerSubnetIDs)
 		}
-		createRequest.SetSecurityGroupName(name)
-		createRequest.SetDescription(description)
-
-		createResponse, err := c.compute.CreateSecurityGroup(&createRequest)
+		subnetIDs, err = parseLoadBalancerSubnetIDs(annotations[ServiceAnnotationLoadBalancerSubnetIDs], subnetIDs)
 		if err != nil {
-			ignore := false
-			if strings.Contains(err.Error(), "Conflict") && attempt < MaxReadThenCreateRetries {
-				klog.V(2).Infof("Got InvalidGroup.Duplicate while creating security group (race?); will retry")
-				ignore = true
-			}
-			if !ignore {
-				klog.Errorf("Error creating security group: %q", err)
-				return "", err
-			}
-			time.Sleep(1 * time.Second)
-		} else {
-			groupID = createResponse.SecurityGroup.GetSecurityGroupId()
-			break
+			return nil, err
 		}
-	}
-	if groupID == "" {
-		return "", fmt.Errorf("created security group, but id was not returned: %s", name)
-	}
-
-	err := c.tagging.createTags(c.compute, groupID, ResourceLifecycleOwned, additionalTags)
-	if err != nil {
-		// If we retry, ensureClusterTags will recover from this - it
-		// will add the missing tags.  We could delete the security
-		// group here, but that doesn't feel like the right thing, as
-		// the caller is likely to retry the create
-		return "", fmt.Errorf("error tagging security group: %q", err)
-	}
-	return groupID, nil
-}
-
-// Finds the subnets associated with the cluster, by matching tags.
-// For maximal backwards compatibility, if no subnets are tagged, it will fall-back to the current subnet.
-// However, in future this will likely be treated as an error.
-func (c *Cloud) findSubnets() ([]*osc.Subnet, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("findSubnets()")
-	request := osc.ReadSubnetsRequest{}
-	if c.vpcID != "" {
-		request.SetFilters(osc.FiltersSubnet{
-			NetIds: &[]string{
-				c.vpcID,
-			},
-		})
-
-		subnets, err := c.compute.DescribeSubnets(&request)
-		if err != nil {
-			return nil, fmt.Errorf("error describing subnets: %q", err)
-		}
-
-		var matches []*osc.Subnet
-		for _, subnet := range subnets {
-			if c.tagging.hasClusterTag(subnet.Tags) {
-				subnetRef := subnet
-				matches = append(matches, &subnetRef)
-			}
-		}
-
-		if len(matches) != 0 {
-			return matches, nil
-		}
-	}
-
-	if c.selfAWSInstance.subnetID != "" {
-		// Fall back to the current instance subnets, if nothing is tagged
-		klog.Warningf("No tagged subnets found; will fall-back to the current subnet only.  This is likely to be an error in a future version of k8s.")
-		request = osc.ReadSubnetsRequest{}
-		request.SetFilters(osc.FiltersSubnet{
-			SubnetIds: &[]string{
-				c.selfAWSInstance.subnetID,
-			},
-		})
-		subnets, err := c.compute.DescribeSubnets(&request)
-		if err != nil {
-			return nil, fmt.Errorf("error describing subnets: %q", err)
-		}
-
-		var matches []*osc.Subnet
-		for _, subnet := range subnets {
-			subnetRef := subnet
-			matches = append(matches, &subnetRef)
-		}
-		return matches, nil
-
-	}
-
-	return []*osc.Subnet{}, nil
-
-}
-
-// Finds the subnets to use for an ELB we are creating.
-// Normal (Internet-facing) ELBs must use public subnets, so we skip private subnets.
-// Internal ELBs can use public or private subnets, but if we have a private subnet we should prefer that.
-func (c *Cloud) findELBSubnets(internalELB bool) ([]string, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("findELBSubnets(%v)", internalELB)
-
-	subnets, err := c.findSubnets()
-	if err != nil {
-		return nil, err
-	}
-	var rt []osc.RouteTable
-	if c.vpcID != "" {
-		readRequest := osc.ReadRouteTablesRequest{
-			Filters: &osc.FiltersRouteTable{
-				NetIds: &[]string{c.vpcID},
-			},
-		}
-		rt, err = c.compute.ReadRouteTables(&readRequest)
-		if err != nil {
-			return nil, fmt.Errorf("error describe route table: %q", err)
-		}
-	}
-
-	// Try to break the tie using a tag
-	var tagName string
-	if internalELB {
-		tagName = TagNameSubnetInternalELB
-	} else {
-		tagName = TagNameSubnetPublicELB
-	}
-
-	subnetsByAZ := make(map[string]*osc.Subnet)
-	for _, subnet := range subnets {
-		az := subnet.GetSubregionName()
-		id := subnet.GetSubnetId()
-		if az == "" || id == "" {
-			klog.Warningf("Ignoring subnet with empty az/id: %v", subnet)
-			continue
-		}
-
-		isPublic, err := isSubnetPublic(&rt, id)
-		if err != nil {
-			return nil, err
-		}
-		if !internalELB && !isPublic {
-			klog.V(2).Infof("Ignoring private subnet for public ELB %q", id)
-			continue
-		}
-
-		existing := subnetsByAZ[az]
-		_, subnetHasTag := findTag(subnet.Tags, tagName)
-		if existing == nil {
-			if subnetHasTag {
-				subnetsByAZ[az] = subnet
-			} else if isPublic && !internalELB {
-				subnetsByAZ[az] = subnet
-			}
-			continue
-		}
-
-		_, existingHasTag := findTag(existing.Tags, tagName)
-
-		if existingHasTag != subnetHasTag {
-			if subnetHasTag {
-				subnetsByAZ[az] = subnet
-			}
-			continue
-		}
-
-		// If we have two subnets for the same AZ we arbitrarily choose the one that is first lexicographically.
-		// TODO: Should this be an error.
-		if strings.Compare(existing.GetSubnetId(), subnet.GetSubnetId()) > 0 {
-			klog.Warningf("Found multiple subnets in AZ %q; choosing %q between subnets %q and %q", az, *subnet.SubnetId, *existing.SubnetId, *subnet.SubnetId)
-			subnetsByAZ[az] = subnet
-			continue
-		}
-
-		klog.Warningf("Found multiple subnets in AZ %q; choosing %q between subnets %q and %q", az, *existing.SubnetId, *existing.SubnetId, *subnet.SubnetId)
-		continue
-	}
-
-	var azNames []string
-	for key := range subnetsByAZ {
-		azNames = append(azNames, key)
-	}
-
-	sort.Strings(azNames)
-
-	var subnetIDs []string
-	for _, key := range azNames {
-		subnetIDs = append(subnetIDs, aws.StringValue(subnetsByAZ[key].SubnetId))
-	}
-
-	return subnetIDs, nil
-}
-
-// buildELBSecurityGroupList returns list of SecurityGroups which should be
-// attached to ELB created by a service. List always consist of at least
-// 1 member which is an SG created for this service or a SG from the Global config.
-// Extra groups can be specified via annotation, as can extra tags for any
-// new groups. The annotation "ServiceAnnotationLoadBalancerSecurityGroups" allows for
-// setting the security groups specified.
-func (c *Cloud) buildELBSecurityGroupList(serviceName types.NamespacedName, loadBalancerName string, annotations map[string]string) ([]string, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("buildELBSecurityGroupList(%v,%v,%v)", serviceName, loadBalancerName, annotations)
-	var err error
-	var securityGroupID string
-
-	if c.cfg.Global.ElbSecurityGroup != "" {
-		securityGroupID = c.cfg.Global.ElbSecurityGroup
-	} else {
-		// Create a security group for the load balancer
-		sgName := "k8s-elb-" + loadBalancerName
-		sgDescription := fmt.Sprintf("Security group for Kubernetes ELB %s (%v)", loadBalancerName, serviceName)
-		securityGroupID, err = c.ensureSecurityGroup(sgName, sgDescription, getLoadBalancerAdditionalTags(annotations))
-		if err != nil {
-			klog.Errorf("Error creating load balancer security group: %q", err)
-			return nil, err
-		}
-	}
-
-	sgList := []string{}
-
-	for _, extraSG := range strings.Split(annotations[ServiceAnnotationLoadBalancerSecurityGroups], ",") {
-		extraSG = strings.TrimSpace(extraSG)
-		if len(extraSG) > 0 {
-			sgList = append(sgList, extraSG)
-		}
-	}
-
-	// If no Security Groups have been specified with the ServiceAnnotationLoadBalancerSecurityGroups annotation, we add the default one.
-	if len(sgList) == 0 {
-		sgList = append(sgList, securityGroupID)
-	}
-
-	for _, extraSG := range strings.Split(annotations[ServiceAnnotationLoadBalancerExtraSecurityGroups], ",") {
-		extraSG = strings.TrimSpace(extraSG)
-		if len(extraSG) > 0 {
-			sgList = append(sgList, extraSG)
-		}
-	}
-
-	return sgList, nil
-}
-
-// EnsureLoadBalancer implements LoadBalancer.EnsureLoadBalancer
-func (c *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, apiService *v1.Service,
-	nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("EnsureLoadBalancer(%v, %v, %v)", clusterName, apiService, nodes)
-	klog.V(5).Infof("EnsureLoadBalancer.annotations(%v)", apiService.Annotations)
-	annotations := apiService.Annotations
-	if apiService.Spec.SessionAffinity != v1.ServiceAffinityNone {
-		// ELB supports sticky sessions, but only when configured for HTTP/HTTPS
-		return nil, fmt.Errorf("unsupported load balancer affinity: %v", apiService.Spec.SessionAffinity)
-	}
-
-	if len(apiService.Spec.Ports) == 0 {
-		return nil, fmt.Errorf("requested load balancer with no ports")
-	}
-
-	// Figure out what mappings we want on the load balancer
-	listeners := []*elb.Listener{}
-
-	sslPorts := getPortSets(annotations[ServiceAnnotationLoadBalancerSSLPorts])
-
-	for _, port := range apiService.Spec.Ports {
-		if port.Protocol != v1.ProtocolTCP {
-			return nil, fmt.Errorf("Only TCP LoadBalancer is supported for AWS ELB")
-		}
-		if port.NodePort == 0 {
-			klog.Errorf("Ignoring port without NodePort defined: %v", port)
-			continue
-		}
-
-		listener, err := buildListener(port, annotations, sslPorts)
-		if err != nil {
-			return nil, err
-		}
-		listeners = append(listeners, listener)
-	}
-
-	if apiService.Spec.LoadBalancerIP != "" {
-		return nil, fmt.Errorf("LoadBalancerIP cannot be specified for AWS ELB")
-	}
-
-	instances, err := c.findInstancesForELB(nodes)
-	klog.V(5).Infof("Debug OSC: c.findInstancesForELB(nodes) : %v", instances)
-	if err != nil {
-		return nil, err
-	}
-
-	sourceRanges, err := servicehelpers.GetLoadBalancerSourceRanges(apiService)
-	klog.V(5).Infof("Debug OSC:  servicehelpers.GetLoadBalancerSourceRanges : %v", sourceRanges)
-	if err != nil {
-		return nil, err
-	}
-
-	// Determine if this is tagged as an Internal ELB
-	internalELB := false
-	internalAnnotation := apiService.Annotations[ServiceAnnotationLoadBalancerInternal]
-	if internalAnnotation == "false" {
-		internalELB = false
-	} else if internalAnnotation != "" {
-		internalELB = true
-	}
-	klog.V(5).Infof("Debug OSC:  internalELB : %v", internalELB)
-
-	// Determine if we need to set the Proxy protocol policy
-	proxyProtocol := false
-	proxyProtocolAnnotation := apiService.Annotations[ServiceAnnotationLoadBalancerProxyProtocol]
-	if proxyProtocolAnnotation != "" {
-		if proxyProtocolAnnotation != "*" {
-			return nil, fmt.Errorf("annotation %q=%q detected, but the only value supported currently is '*'", ServiceAnnotationLoadBalancerProxyProtocol, proxyProtocolAnnotation)
-		}
-		proxyProtocol = true
-	}
-
-	// Some load balancer attributes are required, so defaults are set. These can be overridden by annotations.
-	loadBalancerAttributes := &elb.LoadBalancerAttributes{
-		ConnectionDraining: &elb.ConnectionDraining{Enabled: aws.Bool(false)},
-		ConnectionSettings: &elb.ConnectionSettings{IdleTimeout: aws.Int64(60)},
-	}
-
-	if annotations[ServiceAnnotationLoadBalancerAccessLogS3BucketName] != "" &&
-		annotations[ServiceAnnotationLoadBalancerAccessLogS3BucketPrefix] != "" {
-
-		loadBalancerAttributes.AccessLog = &elb.AccessLog{Enabled: aws.Bool(false)}
-
-		// Determine if access log enabled/disabled has been specified
-		accessLogEnabledAnnotation := annotations[ServiceAnnotationLoadBalancerAccessLogEnabled]
-		if accessLogEnabledAnnotation != "" {
-			accessLogEnabled, err := strconv.ParseBool(accessLogEnabledAnnotation)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing service annotation: %s=%s",
-					ServiceAnnotationLoadBalancerAccessLogEnabled,
-					accessLogEnabledAnnotation,
-				)
-			}
-			loadBalancerAttributes.AccessLog.Enabled = &accessLogEnabled
-		}
-		// Determine if an access log emit interval has been specified
-		accessLogEmitIntervalAnnotation := annotations[ServiceAnnotationLoadBalancerAccessLogEmitInterval]
-		if accessLogEmitIntervalAnnotation != "" {
-			accessLogEmitInterval, err := strconv.ParseInt(accessLogEmitIntervalAnnotation, 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing service annotation: %s=%s",
-					ServiceAnnotationLoadBalancerAccessLogEmitInterval,
-					accessLogEmitIntervalAnnotation,
-				)
-			}
-			loadBalancerAttributes.AccessLog.EmitInterval = &accessLogEmitInterval
-		}
-
-		// Determine if access log s3 bucket name has been specified
-		accessLogS3BucketNameAnnotation := annotations[ServiceAnnotationLoadBalancerAccessLogS3BucketName]
-		if accessLogS3BucketNameAnnotation != "" {
-			loadBalancerAttributes.AccessLog.S3BucketName = &accessLogS3BucketNameAnnotation
-		}
-
-		// Determine if access log s3 bucket prefix has been specified
-		accessLogS3BucketPrefixAnnotation := annotations[ServiceAnnotationLoadBalancerAccessLogS3BucketPrefix]
-		if accessLogS3BucketPrefixAnnotation != "" {
-			loadBalancerAttributes.AccessLog.S3BucketPrefix = &accessLogS3BucketPrefixAnnotation
-		}
-		klog.V(5).Infof("Debug OSC:  loadBalancerAttributes.AccessLog : %v", loadBalancerAttributes.AccessLog)
-	}
-
-	// Determine if connection draining enabled/disabled has been specified
-	connectionDrainingEnabledAnnotation := annotations[ServiceAnnotationLoadBalancerConnectionDrainingEnabled]
-	if connectionDrainingEnabledAnnotation != "" {
-		connectionDrainingEnabled, err := strconv.ParseBool(connectionDrainingEnabledAnnotation)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing service annotation: %s=%s",
-				ServiceAnnotationLoadBalancerConnectionDrainingEnabled,
-				connectionDrainingEnabledAnnotation,
-			)
-		}
-		loadBalancerAttributes.ConnectionDraining.Enabled = &connectionDrainingEnabled
-	}
-
-	// Determine if connection draining timeout has been specified
-	connectionDrainingTimeoutAnnotation := annotations[ServiceAnnotationLoadBalancerConnectionDrainingTimeout]
-	if connectionDrainingTimeoutAnnotation != "" {
-		connectionDrainingTimeout, err := strconv.ParseInt(connectionDrainingTimeoutAnnotation, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing service annotation: %s=%s",
-				ServiceAnnotationLoadBalancerConnectionDrainingTimeout,
-				connectionDrainingTimeoutAnnotation,
-			)
-		}
-		loadBalancerAttributes.ConnectionDraining.Timeout = &connectionDrainingTimeout
-	}
-
-	// Determine if connection idle timeout has been specified
-	connectionIdleTimeoutAnnotation := annotations[ServiceAnnotationLoadBalancerConnectionIdleTimeout]
-	if connectionIdleTimeoutAnnotation != "" {
-		connectionIdleTimeout, err := strconv.ParseInt(connectionIdleTimeoutAnnotation, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing service annotation: %s=%s",
-				ServiceAnnotationLoadBalancerConnectionIdleTimeout,
-				connectionIdleTimeoutAnnotation,
-			)
-		}
-		loadBalancerAttributes.ConnectionSettings.IdleTimeout = &connectionIdleTimeout
-	}
-
-	// Find the subnets that the ELB will live in
-	subnetIDs, err := c.findELBSubnets(internalELB)
-	klog.V(2).Infof("Debug OSC:  c.findELBSubnets(internalELB) : %v", subnetIDs)
-
-	if err != nil {
-		klog.Errorf("Error listing subnets in VPC: %q", err)
-		return nil, err
-	}
-
-	// Bail out early if there are no subnets
-	if len(subnetIDs) == 0 {
-		klog.Warningf("could not find any suitable subnets for creating the ELB")
-	}
-
-	if len(subnetIDs) > 0 && annotations[ServiceAnnotationLoadBalancerSubnetID] != "" {
+		klog.V(2).Infof("User subnets found, override list of subnets to (%v)", subnetIDs)
+	} else if len(subnetIDs) > 0 && annotations[ServiceAnnotationLoadBalancerSubnetID] != "" {
 		targetSubnet := annotations[ServiceAnnotationLoadBalancerSubnetID]
 
 		if Contains(subnetIDs, targetSubnet) {
@@ -1294,99 +1001,113 @@ func (c *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, apiS
 	}
 
 	loadBalancerName := c.GetLoadBalancerName(ctx, clusterName, apiService)
+	// The load balancer replaced by a scheme switch, see ensureLoadBalancerScheme
+	previousLoadBalancerName := ""
 	serviceName := types.NamespacedName{Namespace: apiService.Namespace, Name: apiService.Name}
+	if err := c.claimLoadBalancerName(apiService, loadBalancerName); err != nil {
+		return nil, err
+	}
 
-	klog.V(5).Infof("Debug OSC:  loadBalancerName : %v", loadBalancerName)
-	klog.V(5).Infof("Debug OSC:  serviceName : %v", serviceName)
-	klog.V(5).Infof("Debug OSC:  serviceName : %v", annotations)
+	if c.plan == nil {
+		if err := c.provisioning.throttled(loadBalancerName); err != nil {
+			return nil, err
+		}
+		if err := c.admitLoadBalancerReconciliation(apiService, loadBalancerName); err != nil {
+			return nil, err
+		}
+		schemeName, err := c.ensureLoadBalancerScheme(ctx, clusterName, apiService, annotations, loadBalancerName, internalELB)
+		if err != nil {
+			return nil, err
+		}
+		if schemeName != loadBalancerName {
+			previousLoadBalancerName, loadBalancerName = loadBalancerName, schemeName
+		}
+	}
+	if c.plan == nil {
+		end, beginErr := c.shutdown.begin(apiService, loadBalancerName)
+		if beginErr != nil {
+			return nil, beginErr
+		}
+		defer func() { end(err) }()
+	}
+
+	logger = logger.WithValues("loadBalancer", loadBalancerName)
+	ctx = klog.NewContext(ctx, logger)
 
 	var securityGroupIDs []string
 
 	if len(subnetIDs) == 0 || c.vpcID == "" {
 		securityGroupIDs = []string{DefaultSrcSgName}
 	} else {
-		securityGroupIDs, err = c.buildELBSecurityGroupList(serviceName, loadBalancerName, annotations)
+		securityGroupIDs, err = c.buildELBSecurityGroupList(apiService, loadBalancerName, annotations)
 	}
 
-	klog.V(5).Infof("Debug OSC:  ensured securityGroupIDs : %v", securityGroupIDs)
-
 	if err != nil {
 		return nil, err
 	}
+	logger.V(5).Info("Ensured security groups", "securityGroups", securityGroupIDs)
 	if len(securityGroupIDs) == 0 {
 		return nil, fmt.Errorf("[BUG] ELB can't have empty list of Security Groups to be assigned, this is a Kubernetes bug, please report")
 	}
 
-	if len(subnetIDs) > 0 && c.vpcID != "" {
+	if len(subnetIDs) > 0 && c.vpcID != "" && sgMode != securityGroupModeNone {
 		oscSGRanges := []string{}
 		for _, sourceRange := range sourceRanges.StringSlice() {
 			oscSGRanges = append(oscSGRanges, sourceRange)
 		}
 
-		permissions := NewIPRulesSet()
-		for _, port := range apiService.Spec.Ports {
-
-			protocol := strings.ToLower(string(port.Protocol))
-
-			permission := osc.SecurityGroupRule{}
-			permission.SetFromPortRange(port.Port)
-			permission.SetToPortRange(port.Port)
-			permission.SetIpRanges(oscSGRanges)
-			permission.SetIpProtocol(protocol)
-
-			permissions.Insert(permission)
-		}
-
-		// Allow ICMP fragmentation packets, important for MTU discovery
-		{
-			fromPort := int32(3)
-			toPort := int32(4)
-			permission := osc.SecurityGroupRule{
-				IpProtocol:    aws.String("icmp"),
-				FromPortRange: &fromPort,
-				ToPortRange:   &toPort,
-				IpRanges:      &oscSGRanges,
+		permissions := loadBalancerIngressRules(apiService, oscSGRanges, extraListeners)
+		if sgMode == securityGroupModeShared {
+			permissions, err = c.sharedSecurityGroupIngress(serviceName, permissions)
+			if err != nil {
+				return nil, err
 			}
-
-			permissions.Insert(permission)
 		}
-		_, err = c.setSecurityGroupIngress(securityGroupIDs[0], permissions)
+		changed, err := c.securityGroupService.setSecurityGroupIngress(securityGroupIDs[0], permissions)
 		if err != nil {
 			return nil, err
 		}
+		if changed {
+			c.recordLoadBalancerEvent(apiService, EventUpdatedSecurityGroupRules,
+				"Updated the ingress rules of security group %s to %d rules", securityGroupIDs[0], permissions.Ungroup().Len())
+		}
 	}
 
 	// Build the load balancer itself
+	c.shutdown.setPhase(loadBalancerName, shutdownPhaseLoadBalancer)
 	loadBalancer, err := c.ensureLoadBalancer(
-		serviceName,
+		apiService,
 		loadBalancerName,
 		listeners,
 		subnetIDs,
 		securityGroupIDs,
 		internalELB,
-		proxyProtocol,
+		proxyProtocolPolicy,
 		loadBalancerAttributes,
 		annotations,
 	)
 	if err != nil {
 		return nil, err
 	}
-
-	if sslPolicyName, ok := annotations[ServiceAnnotationLoadBalancerSSLNegotiationPolicy]; ok {
-		err := c.ensureSSLNegotiationPolicy(loadBalancer, sslPolicyName)
-		if err != nil {
+	if previousLoadBalancerName != "" {
+		if err := c.setSchemeSwitchAnnotations(apiService, loadBalancerName, previousLoadBalancerName); err != nil {
 			return nil, err
 		}
+	}
 
-		for _, port := range c.getLoadBalancerTLSPorts(loadBalancer) {
-			err := c.setSSLNegotiationPolicy(loadBalancerName, sslPolicyName, port)
-			if err != nil {
-				return nil, err
-			}
-		}
+	c.shutdown.setPhase(loadBalancerName, shutdownPhaseBackends)
+
+	if err := c.ensureLoadBalancerPublicIP(serviceName, loadBalancerName, internalELB, annotations); err != nil {
+		return nil, err
+	}
+
+	if err := c.ensureListenerPolicies(apiService, loadBalancer, annotations); err != nil {
+		return nil, err
 	}
 
-	if path, healthCheckNodePort := servicehelpers.GetServiceHealthCheckPathPort(apiService); path != "" {
+	previousHealthCheckNodePort := healthCheckNodePortFromTarget(loadBalancer.HealthCheck)
+	path, healthCheckNodePort := servicehelpers.GetServiceHealthCheckPathPort(apiService)
+	if path != "" {
 		klog.V(4).Infof("service %v (%v) needs health checks on :%d%s)", apiService.Name, loadBalancerName, healthCheckNodePort, path)
 		err = c.ensureLoadBalancerHealthCheck(loadBalancer, "HTTP", healthCheckNodePort, path, annotations)
 		if err != nil {
@@ -1394,36 +1115,70 @@ func (c *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, apiS
 		}
 	} else {
 		klog.V(4).Infof("service %v does not need custom health checks", apiService.Name)
-		// We only configure a TCP health-check on the first port
-		var tcpHealthCheckPort int32
-		for _, listener := range listeners {
-			if listener.InstancePort == nil {
-				continue
-			}
-			tcpHealthCheckPort = int32(*listener.InstancePort)
-			break
+		tcpHealthCheckPort, annotationProtocol, err := healthCheckPort(apiService, annotations, listeners, instancePorts)
+		if err != nil {
+			return nil, err
 		}
-		annotationProtocol := strings.ToLower(annotations[ServiceAnnotationLoadBalancerBEProtocol])
+		annotationProtocol = strings.ToLower(annotationProtocol)
 		var hcProtocol string
 		if annotationProtocol == "https" || annotationProtocol == "ssl" {
 			hcProtocol = "SSL"
 		} else {
 			hcProtocol = "TCP"
 		}
-		// there must be no path on TCP health check
-		err = c.ensureLoadBalancerHealthCheck(loadBalancer, hcProtocol, tcpHealthCheckPort, "", annotations)
+		if tcpHealthCheckPort == 0 {
+			// Only SCTP listeners, the kube-proxy healthz server tells whether the node forwards traffic
+			err = c.ensureLoadBalancerHealthCheck(loadBalancer, "HTTP", c.kubeProxyHealthzPort(), "/healthz", annotations)
+		} else {
+			// there must be no path on TCP health check
+			err = c.ensureLoadBalancerHealthCheck(loadBalancer, hcProtocol, tcpHealthCheckPort, "", annotations)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	peered := c.isPeeredNet(loadBalancer, annotations)
+	if peered != c.isPeeredLoadBalancer(annotations) {
+		klog.Warningf("Load balancer %s is in Net %s, the Net of an existing load balancer is not changed",
+			loadBalancerName, aws.StringValue(loadBalancer.VPCId))
+	}
+	if sgMode != securityGroupModeNone && peered {
+		// The security groups can't be referenced across the peering
+		err = c.ensurePeeredBackendIngress(apiService, loadBalancer, instances)
+		if err != nil {
+			klog.Warningf("Error opening ingress rules for the peered load balancer to the instances: %q", err)
+			return nil, err
+		}
+	} else if sgMode != securityGroupModeNone {
+		err = c.updateInstanceSecurityGroupsForLoadBalancer(loadBalancer, instances, securityGroupIDs, backendRules)
+		if err != nil {
+			klog.Warningf("Error opening ingress rules for the load balancer to the instances: %q", err)
+			return nil, err
+		}
+
+		err = c.ensureHealthCheckNodePortIngress(loadBalancer, instances, securityGroupIDs, healthCheckNodePort, previousHealthCheckNodePort)
+		if err != nil {
+			klog.Warningf("Error opening ingress rules for the health check node port to the instances: %q", err)
+			return nil, err
+		}
+	}
+
+	if sgMode != securityGroupModeNone {
+		err = c.ensureExternalIPsIngress(apiService, instances)
 		if err != nil {
+			klog.Warningf("Error opening ingress rules for the external IPs to the instances: %q", err)
 			return nil, err
 		}
 	}
 
-	err = c.updateInstanceSecurityGroupsForLoadBalancer(loadBalancer, instances, securityGroupIDs)
-	if err != nil {
-		klog.Warningf("Error opening ingress rules for the load balancer to the instances: %q", err)
-		return nil, err
+	localInstances := c.filterNodeBackendInstances(apiService, annotations, nodes, instances)
+	servingInstances, skipped := c.filterServingInstances(apiService, loadBalancer.Instances, localInstances)
+	if len(skipped) > 0 {
+		// Register the skipped instances once they are serving
+		c.backendResync.retry(apiService)
 	}
-
-	err = c.ensureLoadBalancerInstances(aws.StringValue(loadBalancer.LoadBalancerName), loadBalancer.Instances, instances)
+	err = c.ensureLoadBalancerInstances(apiService, aws.StringValue(loadBalancer.LoadBalancerName), loadBalancer.Instances, servingInstances)
 	if err != nil {
 		klog.Warningf("Error registering instances with the load balancer: %q", err)
 		return nil, err
@@ -1433,17 +1188,47 @@ func (c *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, apiS
 
 	// TODO: Wait for creation?
 
+	if c.plan != nil {
+		// A planned load balancer is neither checked nor waited for
+		return toStatus(loadBalancer), nil
+	}
+
+	if err := c.checkNodePortReachability(apiService, loadBalancerName, listeners, servingInstances); err != nil {
+		return nil, err
+	}
+
+	loadBalancer, err = c.waitForLoadBalancerReady(ctx, apiService, loadBalancerName, loadBalancer, readyTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkLoadBalancerProvisioning(apiService, loadBalancerName, loadBalancer); err != nil {
+		return nil, err
+	}
+
+	if err := c.ensureLoadBalancerDNSRecord(apiService, loadBalancer, annotations); err != nil {
+		return nil, err
+	}
+
+	if err := c.deletePreviousLoadBalancer(apiService, loadBalancer); err != nil {
+		return nil, err
+	}
+
+	c.loadBalancerMetrics.track(loadBalancerName, serviceName)
 	status := toStatus(loadBalancer)
 	return status, nil
 }
 
 // GetLoadBalancer is an implementation of LoadBalancer.GetLoadBalancer
 func (c *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("GetLoadBalancer(%v,%v)", clusterName, service)
+	service = c.withLoadBalancerDefaults(service)
+	if !c.managesLoadBalancerClass(service) {
+		return nil, false, nil
+	}
 	loadBalancerName := c.GetLoadBalancerName(ctx, clusterName, service)
+	serviceLogger(ctx, service).V(5).Info("Getting load balancer", "loadBalancer", loadBalancerName)
 
-	lb, err := c.describeLoadBalancer(loadBalancerName)
+	lb, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
 	if err != nil {
 		return nil, false, err
 	}
@@ -1458,12 +1243,15 @@ func (c *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, service
 
 // GetLoadBalancerName is an implementation of LoadBalancer.GetLoadBalancerName
 func (c *Cloud) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("GetLoadBalancerName(%v,%v)", clusterName, service)
+	service = c.withLoadBalancerDefaults(service)
+	if name := service.Annotations[ServiceAnnotationLoadBalancerActiveName]; name != "" {
+		// The load balancer was recreated by a scheme switch
+		return name
+	}
 
 	//The unique name of the load balancer (32 alphanumeric or hyphen characters maximum, but cannot start or end with a hyphen).
-	ret := strings.Replace(string(service.UID), "-", "", -1)
-
+	ret := ""
 	if s, ok := service.Annotations[ServiceAnnotationLoadBalancerName]; ok {
 		re := regexp.MustCompile("^[a-zA-Z0-9-]+$")
 		fmt.Println("e.MatchString(s): ", s, re.MatchString(s))
@@ -1473,6 +1261,12 @@ func (c *Cloud) GetLoadBalancerName(ctx context.Context, clusterName string, ser
 			ret = s
 		}
 	}
+	if ret == "" && !hasLoadBalancer(service) {
+		ret = c.templatedLoadBalancerName(service)
+	}
+	if ret == "" {
+		ret = c.tagging.prefixedName(strings.Replace(string(service.UID), "-", "", -1))
+	}
 
 	nameLength := LbNameMaxLength
 	if s, ok := service.Annotations[ServiceAnnotationLoadBalancerNameLength]; ok {
@@ -1489,51 +1283,9 @@ func (c *Cloud) GetLoadBalancerName(ctx context.Context, clusterName string, ser
 	return strings.Trim(ret, "-")
 }
 
-// Return all the security groups that are tagged as being part of our cluster
-func (c *Cloud) getTaggedSecurityGroups() (map[string]osc.SecurityGroup, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("getTaggedSecurityGroups()")
-	request := osc.ReadSecurityGroupsRequest{
-		Filters: &osc.FiltersSecurityGroup{
-			TagKeys: &[]string{c.tagging.clusterTagKey()},
-			Tags:    &[]string{fmt.Sprintf("%s%s=%s", TagNameMainSG, c.tagging.clusterID(), "True")},
-		},
-	}
-
-	groups, err := c.compute.ReadSecurityGroups(&request)
-	if err != nil {
-		return nil, fmt.Errorf("error querying security groups: %q", err)
-	}
-
-	m := make(map[string]osc.SecurityGroup)
-	for _, group := range groups {
-		if !c.tagging.hasClusterTag(group.Tags) {
-			continue
-		}
-
-		id := group.GetSecurityGroupId()
-		if id == "" {
-			klog.Warningf("Ignoring group without id: %v", group)
-			continue
-		}
-		m[id] = group
-	}
-	return m, nil
-}
-
-// Open security group ingress rules on the instances so that the load balancer can talk to them
-// Will also remove any security groups ingress rules for the load balancer that are _not_ needed for allInstances
-func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancerDescription,
-	instances map[InstanceID]*osc.Vm,
-	securityGroupIDs []string) error {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("updateInstanceSecurityGroupsForLoadBalancer(%v, %v, %v)", lb, instances, securityGroupIDs)
-
-	if c.cfg.Global.DisableSecurityGroupIngress {
-		return nil
-	}
-
-	// Determine the load balancer security group id
+// loadBalancerSecurityGroup returns the security group of the load balancer, falling back
+// to the given security groups when the load balancer has none
+func loadBalancerSecurityGroup(lb *elb.LoadBalancerDescription, securityGroupIDs []string) (string, error) {
 	loadBalancerSecurityGroupID := ""
 	securityGroupsItem := []string{}
 	if len(lb.SecurityGroups) > 0 {
@@ -1556,14 +1308,37 @@ func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancer
 	}
 
 	if loadBalancerSecurityGroupID == "" {
-		return fmt.Errorf("could not determine security group for load balancer: %s", aws.StringValue(lb.LoadBalancerName))
+		return "", fmt.Errorf("could not determine security group for load balancer: %s", aws.StringValue(lb.LoadBalancerName))
+	}
+	return loadBalancerSecurityGroupID, nil
+}
+
+// Open security group ingress rules on the instances so that the load balancer can talk to them
+// Will also remove any security groups ingress rules for the load balancer that are _not_ needed for allInstances
+// The granularity tells whether all the protocols and ports are opened, or only the ports of the load balancer
+func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancerDescription,
+	instances map[InstanceID]*osc.Vm,
+	securityGroupIDs []string, granularity backendRuleGranularity) error {
+	klog.V(5).Infof("updateInstanceSecurityGroupsForLoadBalancer(%v, %v, %v, %v)", lb, instances, securityGroupIDs, granularity)
+
+	if c.cfg.Global.DisableSecurityGroupIngress {
+		return nil
+	}
+
+	// Determine the load balancer security group id
+	loadBalancerSecurityGroupID, err := loadBalancerSecurityGroup(lb, securityGroupIDs)
+	if err != nil {
+		return err
 	}
 
 	klog.V(5).Infof("loadBalancerSecurityGroupID(%v)", loadBalancerSecurityGroupID)
 
-	// Get the actual list of groups that allow ingress from the load-balancer
+	// Get the actual list of groups that allow ingress from the load-balancer, and the
+	// tagged security groups of the instances, concurrently
 	var actualGroups []osc.SecurityGroup
-	{
+	var taggedSecurityGroups map[string]osc.SecurityGroup
+	group := newDiscoveryGroup()
+	group.Go(func() error {
 		describeRequest := osc.ReadSecurityGroupsRequest{
 			Filters: &osc.FiltersSecurityGroup{},
 		}
@@ -1583,14 +1358,21 @@ func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancer
 			}
 			actualGroups = append(actualGroups, sg)
 		}
+		return nil
+	})
+	group.Go(func() error {
+		var err error
+		taggedSecurityGroups, err = c.securityGroupService.getTaggedSecurityGroups()
+		if err != nil {
+			return fmt.Errorf("error querying for tagged security groups: %q", err)
+		}
+		return nil
+	})
+	if err := group.Wait(); err != nil {
+		return err
 	}
 
 	klog.V(5).Infof("actualGroups(%v)", actualGroups)
-
-	taggedSecurityGroups, err := c.getTaggedSecurityGroups()
-	if err != nil {
-		return fmt.Errorf("error querying for tagged security groups: %q", err)
-	}
 	klog.V(5).Infof("taggedSecurityGroups(%v)", taggedSecurityGroups)
 
 	// Open the firewall from the load balancer to the instance
@@ -1603,7 +1385,7 @@ func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancer
 
 	// Scan instances for groups we want open
 	for _, instance := range instances {
-		securityGroup, err := findSecurityGroupForInstance(instance, taggedSecurityGroups)
+		securityGroup, err := findSecurityGroupForInstance(instance, taggedSecurityGroups, c.nodePortNic)
 		if err != nil {
 			return err
 		}
@@ -1623,7 +1405,12 @@ func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancer
 
 	klog.V(5).Infof("instanceSecurityGroupIds(%v)", instanceSecurityGroupIds)
 
+	if granularity == backendRulesPorts && loadBalancerSecurityGroupID != DefaultSrcSgName {
+		return c.updateBackendPortRules(lb, loadBalancerSecurityGroupID, instanceSecurityGroupIds, actualGroups)
+	}
+
 	// Compare to actual groups
+	allProtocols := allProtocolsRule(loadBalancerSecurityGroupID)
 	for _, actualGroup := range actualGroups {
 		actualGroupID := actualGroup.GetSecurityGroupId()
 		if actualGroupID == "" {
@@ -1633,8 +1420,12 @@ func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancer
 
 		adding, found := instanceSecurityGroupIds[actualGroupID]
 		if found && adding {
-			// We don't need to make a change; the permission is already in place
-			delete(instanceSecurityGroupIds, actualGroupID)
+			// We don't need to make a change when the permission is already in place, the
+			// group may also only have per port rules from the load balancer
+			_, opened := loadBalancerSourcedRules(actualGroup, loadBalancerSecurityGroupID)[keyForIPRules(&allProtocols)]
+			if opened || loadBalancerSecurityGroupID == DefaultSrcSgName {
+				delete(instanceSecurityGroupIds, actualGroupID)
+			}
 		} else {
 			// This group is not needed by allInstances; delete it
 			instanceSecurityGroupIds[actualGroupID] = false
@@ -1652,25 +1443,11 @@ func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancer
 		permissions := []osc.SecurityGroupRule{}
 		if !isPublicCloud {
 			// This setting is applied when we are in a vpc
-			sourceGroupID := osc.SecurityGroupsMember{
-				SecurityGroupId: &loadBalancerSecurityGroupID,
-			}
-
-			allProtocols := "-1"
-			toPort := int32(-1)
-			fromPort := int32(-1)
-
-			permission := osc.SecurityGroupRule{
-				IpProtocol:            &allProtocols,
-				SecurityGroupsMembers: &[]osc.SecurityGroupsMember{sourceGroupID},
-				FromPortRange:         &fromPort,
-				ToPortRange:           &toPort,
-			}
-			permissions = append(permissions, permission)
+			permissions = append(permissions, allProtocols)
 		}
 
 		if add {
-			changed, err := c.addSecurityGroupRules(instanceSecurityGroupID, &permissions, isPublicCloud)
+			changed, err := c.securityGroupService.addSecurityGroupRules(instanceSecurityGroupID, &permissions, isPublicCloud)
 			if err != nil {
 				return err
 			}
@@ -1678,7 +1455,7 @@ func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancer
 				klog.Warning("Allowing ingress was not needed; concurrent change? groupId=", instanceSecurityGroupID)
 			}
 		} else {
-			changed, err := c.removeSecurityGroupRules(instanceSecurityGroupID, &permissions, isPublicCloud)
+			changed, err := c.securityGroupService.removeSecurityGroupRules(instanceSecurityGroupID, &permissions, isPublicCloud)
 			if err != nil {
 				return err
 			}
@@ -1692,21 +1469,75 @@ func (c *Cloud) updateInstanceSecurityGroupsForLoadBalancer(lb *elb.LoadBalancer
 }
 
 // EnsureLoadBalancerDeleted implements LoadBalancer.EnsureLoadBalancerDeleted.
-func (c *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("EnsureLoadBalancerDeleted(%v, %v)", clusterName, service)
+func (c *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) (err error) {
+	service = c.withLoadBalancerDefaults(service)
+	defer func() {
+		c.recordLoadBalancerError(service, err)
+		if err != nil {
+			c.loadBalancerStatus.reconciled(service, err)
+		} else {
+			c.loadBalancerStatus.forget(service)
+		}
+	}()
+	if !c.managesLoadBalancerClass(service) {
+		return nil
+	}
 	loadBalancerName := c.GetLoadBalancerName(ctx, clusterName, service)
+	logger := serviceLogger(ctx, service).WithValues("loadBalancer", loadBalancerName)
+	logger.V(5).Info("Deleting load balancer", "cluster", clusterName)
+	if c.hasSharedLoadBalancerName(service.Annotations) {
+		// The load balancer of another service with the same name is never deleted
+		owner, err := c.checkLoadBalancerNameOwner(loadBalancerName)
+		if err != nil {
+			return err
+		}
+		if serviceName := (types.NamespacedName{Namespace: service.Namespace, Name: service.Name}).String(); owner != "" && owner != serviceName {
+			logger.Info("Keeping the load balancer of another service", "owner", owner)
+			return c.removeLoadBalancerFinalizer(service)
+		}
+	}
+	if err := c.checkDeletionProtection(service, loadBalancerName); err != nil {
+		return err
+	}
+	if previous := service.Annotations[ServiceAnnotationLoadBalancerPreviousName]; previous != "" && previous != loadBalancerName {
+		// The service is deleted during a scheme switch
+		if err := c.deleteLoadBalancer(service, previous, false); err != nil {
+			return err
+		}
+	}
+	if err := c.deleteLoadBalancer(service, loadBalancerName, false); err != nil {
+		return err
+	}
+	return c.removeLoadBalancerFinalizer(service)
+}
 
-	lb, err := c.describeLoadBalancer(loadBalancerName)
+// deleteLoadBalancer deletes the load balancer of the service and its security groups.
+// When orphan is set the service no longer exists, its annotations are unknown, and only
+// the security group created for the load balancer is deleted.
+func (c *Cloud) deleteLoadBalancer(service *v1.Service, loadBalancerName string, orphan bool) error {
+	klog.V(5).Infof("deleteLoadBalancer(%v, %v, %v)", service, loadBalancerName, orphan)
+	c.nodeUpdates.forget(loadBalancerName)
+	c.loadBalancerMetrics.forget(loadBalancerName)
+	c.provisioning.forget(loadBalancerName)
+	// The deletion is never delayed, and its calls are not charged to a later load balancer of the same name
+	defer c.apiBudget.forget(loadBalancerName)
+
+	lb, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
 	if err != nil {
 		return err
 	}
 
 	if lb == nil {
 		klog.Info("Load balancer already deleted: ", loadBalancerName)
+		c.draining.forget(loadBalancerName)
+		c.updateNodeLoadBalancerMembership(loadBalancerName, sets.NewString())
 		return nil
 	}
 
+	if err := c.drainLoadBalancer(service, lb); err != nil {
+		return err
+	}
+
 	loadBalancerSGs := []string{}
 	if len(lb.SecurityGroups) == 0 && c.vpcID == "" {
 		loadBalancerSGs = append(loadBalancerSGs, DefaultSrcSgName)
@@ -1714,9 +1545,19 @@ func (c *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName strin
 		loadBalancerSGs = aws.StringValueSlice(lb.SecurityGroups)
 	}
 
+	sgMode, err := c.securityGroupMode(service.Annotations)
+	if err != nil {
+		klog.Warningf("Deleting load balancer %s as managed: %v", loadBalancerName, err)
+		sgMode = securityGroupModeManaged
+	}
+	sharedSecurityGroupID, err := c.findSharedSecurityGroup(loadBalancerSGs)
+	if err != nil {
+		return err
+	}
+
 	{
 		// De-register the load balancer security group from the instances security group
-		err = c.ensureLoadBalancerInstances(aws.StringValue(lb.LoadBalancerName),
+		err = c.ensureLoadBalancerInstances(service, aws.StringValue(lb.LoadBalancerName),
 			lb.Instances,
 			map[InstanceID]*osc.Vm{})
 		if err != nil {
@@ -1728,8 +1569,16 @@ func (c *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName strin
 
 		// De-authorize the load balancer security group from the instances security group
 		// Due to limit	tion of public cloud, we skip the deletion in the public cloud
-		if c.vpcID != "" {
-			err = c.updateInstanceSecurityGroupsForLoadBalancer(lb, nil, loadBalancerSGs)
+		if c.vpcID != "" && (sgMode == securityGroupModeNone || sharedSecurityGroupID != "") {
+			klog.V(2).Infof("Keeping the load balancer SG rules in the Node SG (security group mode %s)", sgMode)
+		} else if c.vpcID != "" {
+			err = c.ensureHealthCheckNodePortIngress(lb, nil, loadBalancerSGs, 0, healthCheckNodePortFromTarget(lb.HealthCheck))
+			if err != nil {
+				klog.Errorf("Error revoking the health check node port from instance security groups: %q", err)
+				return err
+			}
+			// Without instances, all the rules from the load balancer are removed
+			err = c.updateInstanceSecurityGroupsForLoadBalancer(lb, nil, loadBalancerSGs, backendRulesPorts)
 			if err != nil {
 				klog.Errorf("Error deregistering load balancer from instance security groups: %q", err)
 				return err
@@ -1737,6 +1586,27 @@ func (c *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName strin
 		} else {
 			klog.V(2).Info("Ignore deletion of LoadBalancer SG rule in the Node SG in Public cloud")
 		}
+
+		// The rules opened to the external IPs and to the subnets of a load balancer in a
+		// peered Net do not depend on the load balancer security group
+		if c.vpcID != "" && sgMode != securityGroupModeNone {
+			err = c.ensureExternalIPsIngress(service, nil)
+			if err != nil {
+				klog.Errorf("Error revoking the external IPs from instance security groups: %q", err)
+				return err
+			}
+			if c.isPeeredNet(lb, service.Annotations) {
+				err = c.ensurePeeredBackendIngress(service, lb, nil)
+				if err != nil {
+					klog.Errorf("Error revoking the peered load balancer from instance security groups: %q", err)
+					return err
+				}
+			}
+		}
+	}
+
+	if err := c.deleteLoadBalancerDNSRecord(service, lb); err != nil {
+		return err
 	}
 
 	{
@@ -1751,11 +1621,31 @@ func (c *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName strin
 			return err
 		}
 	}
+	c.updateNodeLoadBalancerMembership(loadBalancerName, sets.NewString())
+
+	err = c.releaseLoadBalancerPublicIPs(types.NamespacedName{Namespace: service.Namespace, Name: service.Name}, "")
+	if err != nil {
+		return err
+	}
+
+	if sgMode == securityGroupModeNone {
+		return nil
+	}
+
+	if sharedSecurityGroupID != "" {
+		// Close the ports of the load balancer in the shared security group
+		permissions, err := c.sharedSecurityGroupIngress(types.NamespacedName{Namespace: service.Namespace, Name: service.Name}, NewIPRulesSet())
+		if err != nil {
+			return err
+		}
+		if _, err := c.securityGroupService.setSecurityGroupIngress(sharedSecurityGroupID, permissions); err != nil {
+			return err
+		}
+	}
 
 	{
-		// Delete the security group(s) for the load balancer
-		// Note that this is annoying: the load balancer disappears from the API immediately, but it is still
-		// deleting in the background.  We get a DependencyViolation until the load balancer has deleted itself
+		// Delete the security group(s) for the load balancer, in the background when they are
+		// still used by the load balancer being deleted
 
 		describeRequest := osc.ReadSecurityGroupsRequest{
 			Filters: &osc.FiltersSecurityGroup{
@@ -1773,16 +1663,30 @@ func (c *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName strin
 		for _, sg := range response {
 			sgID := sg.GetSecurityGroupId()
 
-			if sgID == c.cfg.Global.ElbSecurityGroup {
-				//We don't want to delete a security group that was defined in the Cloud Configuration.
+			if sgID == c.cfg.Global.ElbSecurityGroup || sgID == sharedSecurityGroupID {
+				//We don't want to delete a security group that was defined in the Cloud Configuration,
+				//or that is shared by the load balancers.
+				continue
+			}
+			if isSelectedSecurityGroup(sg.Tags) {
+				//We don't want to delete a pre-existing security group selected by a Service.
+				continue
+			}
+			if selector, ok := service.Annotations[ServiceAnnotationLoadBalancerSecurityGroupSelector]; ok &&
+				securityGroupMatchesSelector(sg, parseKeyValueList(selector)) {
+				//We don't want to delete a pre-existing security group selected by the Service.
 				continue
 			}
 			if sgID == "" {
 				klog.Warningf("Ignoring empty security group in %s", service.Name)
 				continue
 			}
+			if orphan && loadBalancerSecurityGroupName(&sg) != c.tagging.prefixedName("k8s-elb-"+loadBalancerName) {
+				//The selector of the deleted Service is unknown, only its own security group is deleted.
+				continue
+			}
 
-			if !c.tagging.hasClusterTag(sg.Tags) {
+			if !c.tagging.hasClusterTag(sg.Tags) && !c.tagging.isManagedBy(sg.Tags) {
 				klog.Warningf("Ignoring security group with no cluster tag in %s", service.Name)
 				continue
 			}
@@ -1790,45 +1694,13 @@ func (c *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName strin
 			securityGroupIDs[sgID] = struct{}{}
 		}
 
-		// Loop through and try to delete them
-		timeoutAt := time.Now().Add(time.Second * 600)
-		for {
-			for securityGroupID := range securityGroupIDs {
-				request := osc.DeleteSecurityGroupRequest{
-					SecurityGroupId: &securityGroupID,
-				}
-				_, err := c.compute.DeleteSecurityGroup(&request)
-				if err == nil {
-					delete(securityGroupIDs, securityGroupID)
-				} else {
-					ignore := false
-					if strings.Contains(err.Error(), "Conflict") {
-						klog.V(2).Infof("Ignoring Conflict while deleting load-balancer security group (%s), assuming because LB is in process of deleting", securityGroupID)
-						ignore = true
-					}
-					if !ignore {
-						return fmt.Errorf("error while deleting load balancer security group (%s): %q", securityGroupID, err)
-					}
-				}
-			}
-
-			if len(securityGroupIDs) == 0 {
-				klog.V(2).Info("Deleted all security groups for load balancer: ", service.Name)
-				break
-			}
-
-			if time.Now().After(timeoutAt) {
-				ids := []string{}
-				for id := range securityGroupIDs {
-					ids = append(ids, id)
-				}
-
-				return fmt.Errorf("timed out deleting ELB: %s. Could not delete security groups %v", service.Name, strings.Join(ids, ","))
-			}
-
-			klog.V(2).Info("Waiting for load-balancer to delete so we can delete security groups: ", service.Name)
-
-			time.Sleep(10 * time.Second)
+		ids := make([]string, 0, len(securityGroupIDs))
+		for id := range securityGroupIDs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		if err := c.deleteLoadBalancerSecurityGroups(service.Name, ids); err != nil {
+			return err
 		}
 	}
 
@@ -1836,203 +1708,130 @@ func (c *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName strin
 }
 
 // UpdateLoadBalancer implements LoadBalancer.UpdateLoadBalancer
-func (c *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("UpdateLoadBalancer(%v, %v, %s)", clusterName, service, nodes)
-	instances, err := c.findInstancesForELB(nodes)
-	if err != nil {
-		return err
+func (c *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (err error) {
+	service = c.withLoadBalancerDefaults(service)
+	defer func() {
+		c.recordLoadBalancerError(service, err)
+		c.loadBalancerStatus.reconciled(service, err)
+	}()
+	if !c.managesLoadBalancerClass(service) {
+		return nil
 	}
-
 	loadBalancerName := c.GetLoadBalancerName(ctx, clusterName, service)
-	lb, err := c.describeLoadBalancer(loadBalancerName)
+	serviceLogger(ctx, service).WithValues("loadBalancer", loadBalancerName).V(5).Info("Updating load balancer hosts",
+		"cluster", clusterName, "nodes", klog.KObjSlice(nodes))
+	nodes = c.filterExcludedNodes(nodes)
+	annotations, err := expandLoadBalancerProfile(service.Annotations)
 	if err != nil {
 		return err
 	}
 
-	if lb == nil {
-		return fmt.Errorf("Load balancer not found")
+	dryRun, err := c.isLoadBalancerDryRun(annotations)
+	if err != nil {
+		return err
 	}
-
-	if sslPolicyName, ok := service.Annotations[ServiceAnnotationLoadBalancerSSLNegotiationPolicy]; ok {
-		err := c.ensureSSLNegotiationPolicy(lb, sslPolicyName)
-		if err != nil {
-			return err
-		}
-		for _, port := range c.getLoadBalancerTLSPorts(lb) {
-			err := c.setSSLNegotiationPolicy(loadBalancerName, sslPolicyName, port)
-			if err != nil {
-				return err
-			}
-		}
+	if dryRun {
+		return c.planUpdateLoadBalancerHosts(loadBalancerName, service, annotations, nodes)
 	}
-
-	err = c.ensureLoadBalancerInstances(aws.StringValue(lb.LoadBalancerName), lb.Instances, instances)
-	if err != nil {
-		return nil
+	if err := c.admitLoadBalancerReconciliation(service, loadBalancerName); err != nil {
+		return err
 	}
-
-	securityGroupsItem := []string{}
-	if len(lb.SecurityGroups) == 0 && c.vpcID == "" {
-		securityGroupsItem = append(securityGroupsItem, DefaultSrcSgName)
+	if err := c.claimLoadBalancerName(service, loadBalancerName); err != nil {
+		return err
 	}
-
-	err = c.updateInstanceSecurityGroupsForLoadBalancer(lb, instances, securityGroupsItem)
-	if err != nil {
+	if err := c.nodeSync.wait(ctx, nodes); err != nil {
 		return err
 	}
 
-	return nil
+	return c.nodeUpdates.run(loadBalancerName, nodes, func(nodes []*v1.Node) error {
+		return c.updateLoadBalancerHosts(loadBalancerName, service, annotations, nodes)
+	}, func() { c.backendResync.retry(service) })
 }
 
-// ********************* CCM Node Resource Functions  *********************
-
-// Returns the instance with the specified ID
-func (c *Cloud) getInstanceByID(instanceID string) (*osc.Vm, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("getInstanceByID(%v)", instanceID)
-	instances, err := c.getInstancesByIDs(&[]string{instanceID})
+// updateLoadBalancerHosts registers exactly the given nodes with the load balancer, the
+// annotations of the service being expanded with its profile
+func (c *Cloud) updateLoadBalancerHosts(loadBalancerName string, service *v1.Service, annotations map[string]string,
+	nodes []*v1.Node) error {
+	klog.V(5).InfoS("updateLoadBalancerHosts", "loadBalancer", loadBalancerName, "service", klog.KObj(service),
+		"nodes", klog.KObjSlice(nodes))
+	instances, err := c.findBackendInstances(annotations, nodes)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if len(instances) == 0 {
-		return nil, cloudprovider.InstanceNotFound
-	}
-	if len(instances) > 1 {
-		return nil, fmt.Errorf("multiple instances found for instance: %s", instanceID)
+	lb, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
+	if err != nil {
+		return err
 	}
 
-	return instances[instanceID], nil
-}
-
-func (c *Cloud) getInstancesByIDs(instanceIDs *[]string) (map[string]*osc.Vm, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("getInstancesByIDs(%v)", instanceIDs)
-
-	instancesByID := make(map[string]*osc.Vm)
-	if instanceIDs == nil || len(*instanceIDs) == 0 {
-		return instancesByID, nil
+	if lb == nil {
+		return fmt.Errorf("Load balancer not found")
 	}
 
-	request := &osc.ReadVmsRequest{
-		Filters: &osc.FiltersVm{
-			VmIds: instanceIDs,
-		},
+	sgMode, err := c.securityGroupMode(annotations)
+	if err != nil {
+		return err
 	}
-
-	instances, err := c.compute.ReadVms(request)
+	backendRules, err := c.backendRuleGranularity(annotations, sgMode)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	for _, instance := range instances {
-		instanceRef := instance
-		instanceID := instance.GetVmId()
-		if instanceID == "" {
-			continue
-		}
-
-		instancesByID[instanceID] = &instanceRef
+	if err := c.reconcileLoadBalancerTags(loadBalancerName, annotations); err != nil {
+		return err
 	}
 
-	return instancesByID, nil
-}
-
-func (c *Cloud) getInstancesByNodeNames(nodeNames []string, states ...string) ([]*osc.Vm, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("getInstancesByNodeNames(%v, %v)", nodeNames, states)
-
-	names := nodeNames
-	oscInstances := []*osc.Vm{}
-
-	filters := osc.FiltersVm{}
-
-	instances, err := c.describeInstances(&filters)
+	// The attributes may have been changed since the last reconciliation of the service
+	attributes, err := getLoadBalancerAttributes(annotations)
 	if err != nil {
-		klog.V(2).Infof("Failed to describe instances %v", nodeNames)
-		return nil, err
-	}
-
-	for _, instance := range instances {
-		if Contains(names, instance.GetPrivateDnsName()) &&
-			(len(states) == 0 || Contains(states, instance.GetState())) {
-			oscInstances = append(oscInstances, instance)
-		}
+		return err
 	}
-
-	if len(oscInstances) == 0 {
-		klog.V(3).Infof("Failed to find any instances %v", nodeNames)
-		return nil, nil
+	if _, err := c.ensureLoadBalancerAttributes(service, loadBalancerName, attributes); err != nil {
+		return err
 	}
-	return oscInstances, nil
-}
-
-// TODO: Move to instanceCache
-func (c *Cloud) describeInstances(filters *osc.FiltersVm) ([]*osc.Vm, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("describeInstances(%v)", filters)
 
-	request := &osc.ReadVmsRequest{
-		Filters: filters,
+	if err := c.ensureListenerPolicies(service, lb, annotations); err != nil {
+		return err
 	}
 
-	response, err := c.compute.ReadVms(request)
+	localInstances := c.filterNodeBackendInstances(service, annotations, nodes, instances)
+	servingInstances, skipped := c.filterServingInstances(service, lb.Instances, localInstances)
+	err = c.ensureLoadBalancerInstances(service, aws.StringValue(lb.LoadBalancerName), lb.Instances, servingInstances)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var matches []*osc.Vm
-	for _, instance := range response {
-		if c.tagging.hasClusterTag(instance.Tags) {
-			instanceRef := instance
-			matches = append(matches, &instanceRef)
-		}
+	securityGroupsItem := []string{}
+	if len(lb.SecurityGroups) == 0 && c.vpcID == "" {
+		securityGroupsItem = append(securityGroupsItem, DefaultSrcSgName)
 	}
-	return matches, nil
-}
 
-// Returns the instance with the specified node name
-// Returns nil if it does not exist
-func (c *Cloud) findInstanceByNodeName(nodeName types.NodeName) (*osc.Vm, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("findInstanceByNodeName(%v)", nodeName)
-
-	privateDNSName := mapNodeNameToPrivateDNSName(nodeName)
-	filters := osc.FiltersVm{
-		TagKeys: &[]string{
-			c.tagging.clusterTagKey(),
-		},
-		Tags: &[]string{
-			fmt.Sprintf("%s=%s", TagNameClusterNode, privateDNSName),
-		},
+	if c.isPeeredNet(lb, annotations) {
+		err = c.ensurePeeredBackendIngress(service, lb, instances)
+	} else {
+		err = c.updateInstanceSecurityGroupsForLoadBalancer(lb, instances, securityGroupsItem, backendRules)
 	}
-
-	instances, err := c.describeInstances(&filters)
-
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if len(instances) == 0 {
-		return nil, nil
-	}
-	if len(instances) > 1 {
-		return nil, fmt.Errorf("multiple instances found for name: %s", nodeName)
+	err = c.ensureExternalIPsIngress(service, instances)
+	if err != nil {
+		return err
 	}
 
-	if *instances[0].State == "terminated" {
-		// We only want alive instances but oAPI does not have a filter for that
-		return nil, nil
+	if len(skipped) > 0 {
+		// Retry later so that the skipped instances get registered once they are serving
+		return newLoadBalancerNotReadyError(loadBalancerName, NotReadyWaitingForState, "instances %v are not serving yet", skipped)
 	}
-
-	return instances[0], nil
+	return nil
 }
 
+// ********************* CCM Node Resource Functions  *********************
+
 // Returns the instance with the specified node name
 // Like findInstanceByNodeName, but returns error if node not found
 func (c *Cloud) getInstanceByNodeName(nodeName types.NodeName) (*osc.Vm, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("getInstanceByNodeName(%v)", nodeName)
 
 	var instance *osc.Vm
@@ -2043,11 +1842,11 @@ func (c *Cloud) getInstanceByNodeName(nodeName types.NodeName) (*osc.Vm, error)
 	vmID, err := c.nodeNameToProviderID(nodeName)
 	if err != nil {
 		klog.V(3).Infof("Unable to convert node name %q to aws instanceID, fall back to findInstanceByNodeName: %v", nodeName, err)
-		instance, err = c.findInstanceByNodeName(nodeName)
+		instance, err = c.instanceService.findInstanceByNodeName(nodeName)
 		// we need to set provider id for next calls
 
 	} else {
-		instance, err = c.getInstanceByID(string(vmID))
+		instance, err = c.instanceService.getInstanceByID(string(vmID))
 	}
 	if err == nil && instance == nil {
 		return nil, cloudprovider.InstanceNotFound
@@ -2056,7 +1855,6 @@ func (c *Cloud) getInstanceByNodeName(nodeName types.NodeName) (*osc.Vm, error)
 }
 
 func (c *Cloud) nodeNameToProviderID(nodeName types.NodeName) (InstanceID, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("nodeNameToProviderID(%v)", nodeName)
 	if len(nodeName) == 0 {
 		return "", fmt.Errorf("no nodeName provided")
@@ -46,9 +46,23 @@ type CloudConfig struct {
 		// RouteTableID enables using a specific RouteTable
 		RouteTableID string
 
-		// RoleARN is the IAM role to assume when interaction with AWS APIs.
+		// RoleARN is the EIM role to assume when interacting with the Outscale APIs.
+		// Its temporary credentials are refreshed before they expire.
 		RoleARN string
 
+		//When set, the credentials are read from this JSON file ({"access_key": "...",
+		//"secret_key": "...", "session_token": "..."}) or INI file (access_key, secret_key
+		//and session_token keys of the default section) instead of the environment, or from
+		//the directory of a mounted Secret (see readCredentialsSecret). The region, endpoint_api
+		//and endpoint_lbu keys optionally set the region of the EIM endpoint and override the
+		//oAPI and LBU endpoints. The file is read again when it changes and every
+		//CredentialsRefreshSeconds, so that rotated credentials and endpoints are used without
+		//restarting the CCM. The session token is optional. The --osc-credentials-file flag
+		//takes precedence.
+		CredentialsFile string
+		//Defaults to 300.
+		CredentialsRefreshSeconds int
+
 		// KubernetesClusterTag is the legacy cluster id we'll use to identify our cluster resources
 		KubernetesClusterTag string
 		// KubernetesClusterID is the cluster id we'll use to identify our cluster resources
@@ -78,6 +92,406 @@ type CloudConfig struct {
 		//yourself in an non-AWS cloud and open an issue, please indicate that in the
 		//issue body.
 		DisableStrictZoneCheck bool
+
+		//Rapid node churn triggers an UpdateLoadBalancer call per node event and per service.
+		//When set, the node updates of a load balancer received within this window (in seconds)
+		//are coalesced and only the latest node set is applied at the end of the window, the
+		//Service being requeued when it fails. Defaults to 0, which applies every update
+		//immediately.
+		NodeUpdateCoalesceSeconds int
+
+		//When many nodes join at once, the node updates of the load balancers of all the
+		//services received within this window (in milliseconds) wait for a single read of the
+		//VMs of their nodes, instead of each update reading the VMs on its own. Defaults to 0,
+		//which disables the batching.
+		NodeSyncBatchWindowMilliseconds int
+
+		//Comma-separated list of the IP families (ipv4, ipv6) reported first in the node
+		//addresses, in order of preference, the addresses of the other families following.
+		//The first family is used for the primary node IP. For example "ipv4,ipv6" on a
+		//dual-stack cluster.
+		//Defaults to empty, which reports the addresses as discovered.
+		NodeIPFamilies string
+
+		//Comma-separated list of the subnet IDs or device numbers of the NICs whose private
+		//IPs are reported first in the node addresses, in order of preference, for the CNIs
+		//expecting the InternalIP of the node on a given NIC, e.g. "subnet-12345678" or "1".
+		//The OscK8sNodeAddressPriority tag of a VM takes precedence, and the
+		//--node-address-priority flag takes precedence over it.
+		//Defaults to empty, which reports the NICs as discovered.
+		NodeAddressPriority string
+
+		//When set, only the private IPs of the primary NIC (device number 0) of the VMs are
+		//reported in the node addresses. Defaults to false, which reports all the NICs.
+		NodeAddressPrimaryNicOnly bool
+
+		//Comma-separated list of the subnet IDs or device numbers of the NICs whose private
+		//IPs are not reported in the node addresses, e.g. the NICs of a storage network. The
+		//OscK8sNodeAddressExcludedNics tag of a VM takes precedence. Defaults to empty.
+		NodeAddressExcludedNics string
+
+		//Subnet ID or device number of the NIC of the nodes carrying the NodePort traffic,
+		//whose security group is opened to the load balancers. The OscK8sNodePortNic tag of
+		//a VM takes precedence. Defaults to empty, which opens the security group of the VMs.
+		NodePortNic string
+
+		//Route tables are read to classify subnets as public or private each time a load
+		//balancer subnet is selected. When set, they are cached for this duration (in seconds).
+		//Sending SIGHUP to the process invalidates the cache after a routing change.
+		//Defaults to 0, which disables the cache.
+		RouteTableCacheTTLSeconds int
+
+		//The security groups tagged for the cluster are listed at each reconciliation of a
+		//load balancer. When set, they are cached for this duration (in seconds), refreshed in
+		//the background, and invalidated when the cloud provider modifies a security group.
+		//Defaults to 0, which disables the cache.
+		SecurityGroupCacheTTLSeconds int
+
+		//When set, the backend health of the managed load balancers is scraped every
+		//interval (in seconds) and exposed as Prometheus metrics labeled by Service, and a
+		//BackendHealthChanged event is recorded on the Service when its number of healthy
+		//backends changes. Defaults to 0, which disables the collector.
+		LoadBalancerMetricsIntervalSeconds int
+
+		//Cluster-wide defaults of the load balancer health checks, applied when a Service
+		//does not set the corresponding health check annotation. A value of 0 keeps the
+		//built-in default.
+		HealthCheckHealthyThreshold   int64
+		HealthCheckUnhealthyThreshold int64
+		HealthCheckTimeout            int64
+		HealthCheckInterval           int64
+
+		//When set, the pods declaring the service.beta.kubernetes.io/osc-load-balancer-ready
+		//readiness gate get their condition updated every interval (in seconds) from the
+		//backend health reported by the load balancers.
+		//Defaults to 0, which disables the readiness gate controller.
+		LoadBalancerReadinessGateIntervalSeconds int
+
+		//When set, the VMs of the nodes are polled every interval (in seconds), and the
+		//nodes whose VM is being stopped or terminated are cordoned and drained before the
+		//VM is reclaimed. Defaults to 0, which disables the VM termination controller.
+		VMTerminationIntervalSeconds int
+
+		//Scheme of the provider IDs of the new nodes: aws (aws:///<subregion>/<vm id>, the
+		//default, expected by the tools written for the AWS cloud provider) or osc
+		//(osc://<subregion>/<vm id>). Both schemes are understood whatever the setting, the
+		//nodes keep the provider ID they were registered with.
+		ProviderIDScheme string
+
+		//Source of the names of the nodes in their VM, used to find the VM of a node without
+		//provider ID, to name the targets of the routes and the node of the CCM: privateDnsName
+		//(the private DNS name of the VM), privateIp (its private IP), vmId (its ID) or
+		//tag:<key> (the value of its tag <key>, e.g. a hostname set by cloud-init). The VMs
+		//tagged OscK8sNodeName=<node name> are also found whatever the strategy. Defaults to
+		//privateDnsName.
+		NodeNameStrategy string
+
+		//When set with the osc ProviderIDScheme, the nodes with an aws:// provider ID which
+		//are cordoned and drained are recreated with an osc:// provider ID every interval (in
+		//seconds), as the provider ID of a node can't be changed. The DaemonSet and mirror
+		//pods are kept, and the node stays cordoned. Defaults to 0, which disables the
+		//migration.
+		ProviderIDMigrationIntervalSeconds int
+
+		//Interval (in seconds) of the update of the backends of the services whose backend
+		//VMs are selected by tags, see service.beta.kubernetes.io/osc-load-balancer-target-vm-tags.
+		//Defaults to 0, which updates them every 60 seconds.
+		TargetVMTagsResyncIntervalSeconds int
+
+		//When set, the load balancers and security groups tagged for the cluster are checked
+		//every interval (in seconds), and the ones left behind by deleted Services (e.g. when the
+		//CCM was stopped during the deletion) are deleted. It requires KubernetesClusterID.
+		//Defaults to 0, which disables the orphan sweeper.
+		OrphanSweepIntervalSeconds int
+
+		//When set, the load balancers of the services and their security groups are compared
+		//every interval (in seconds) with the state derived from the services, and the
+		//services whose load balancer was modified out of band (e.g. from the console or by
+		//Terraform) are reconciled, with a LoadBalancerDriftDetected event.
+		//Defaults to 0, which disables the drift detection.
+		DriftDetectionIntervalSeconds int
+
+		//When set, the load balancers of the services (listeners, security groups, backends,
+		//attributes, drift and result of the last reconciliation) are mirrored every interval
+		//(in seconds) in the status of OSCLoadBalancer custom resources named after the
+		//services, whose CRD must be installed. Defaults to 0, which disables the
+		//OSCLoadBalancer resources.
+		LoadBalancerStatusIntervalSeconds int
+
+		//When set, the CCM allocates the pod CIDRs of the nodes from this CIDR of the Net
+		//(e.g. 10.244.0.0/16) and writes them into their spec, instead of the range allocator
+		//of kube-controller-manager, whose --allocate-node-cidrs must then be disabled.
+		//Defaults to empty, which disables the pod CIDR allocation.
+		PodCIDRPool string
+
+		//The prefix length of the pod CIDRs allocated from the PodCIDRPool.
+		//Defaults to 24 for an IPv4 pool and 64 for an IPv6 pool.
+		PodCIDRMaskSize int
+
+		//Where the pod CIDRs allocated from the PodCIDRPool are recorded: "tags" records
+		//them in the OscK8sPodCIDR tag of the VMs, released with the VMs, the clusters of a
+		//Net being given disjoint pools, "configmap" records them in the
+		//kube-system/osc-pod-cidrs ConfigMap. Defaults to "tags".
+		PodCIDRAllocationStore string
+
+		//When set, the CCM handles SIGTERM and SIGINT by refusing the new load balancer
+		//reconciliations and waiting up to this grace period (in seconds) for the in-flight
+		//ones. Those still running after it are rolled back when their load balancer was not
+		//created yet, deleting the security groups they created, and otherwise their load
+		//balancer is tagged OscK8sResumeHint with the interrupted phase until the next leader
+		//completes the reconciliation. Defaults to 0, which disables the graceful shutdown.
+		ShutdownGracePeriodSeconds int
+
+		//When set, the VMs looked up by the node lifecycle calls (existence, shutdown and
+		//metadata) are cached for this duration (in seconds), and concurrent lookups are
+		//coalesced into a single ReadVms request.
+		//Defaults to 0, which disables the cache.
+		InstanceCacheTTLSeconds int
+
+		//Comma-separated regions where the VMs of the nodes are also looked up, in this
+		//order, when they are not found in the region of the CCM, for clusters stretched
+		//over paired regions (e.g. disaster recovery). Each region may be followed by
+		//=<oAPI endpoint>, which defaults to the EndpointAPI of the region. Only ReadVms
+		//calls are issued in these regions.
+		//Defaults to empty.
+		SecondaryRegions string
+
+		//When set, the tags of the VMs whose key starts with this prefix are set as labels
+		//on their node, without the prefix. For example, with osc.node.label/ the tag
+		//osc.node.label/team=web labels the node with team=web.
+		//Defaults to empty, which disables the labels.
+		NodeLabelTagPrefix string
+
+		//Comma-separated prefixes of the label keys set from the VM tags. The keys of the
+		//reserved kubernetes.io and k8s.io domains, and of their subdomains, are only set
+		//when matching one of these prefixes, e.g. node-role.kubernetes.io/.
+		//Defaults to empty, which allows all the keys but the reserved ones.
+		NodeLabelAllowedPrefixes string
+
+		//Comma-separated prefixes of the label keys never set from the VM tags.
+		NodeLabelDeniedPrefixes string
+
+		//When set, a load balancer without DNS name is reported as not ready, and once it is
+		//still not ready after this deadline (in seconds) a StalledProvisioning event is
+		//emitted and it is only checked again every LoadBalancerStalledRetrySeconds
+		//(defaults to 300). Defaults to 0, which disables the readiness check.
+		LoadBalancerProvisioningDeadlineSeconds int
+		LoadBalancerStalledRetrySeconds         int
+
+		//When set, EnsureLoadBalancer waits up to this duration (in seconds, at most 600) for
+		//the load balancer to have a DNS name and a backend in service, reporting the progress
+		//in the events of the Service, instead of returning as soon as the load balancer is
+		//created. The osc-load-balancer-ready-timeout annotation overrides it per Service.
+		//Defaults to 0, which disables the wait.
+		LoadBalancerReadyTimeoutSeconds int
+
+		//When set, a node is only registered to a load balancer once it serves traffic: the
+		//CCM probes the healthCheckNodePort of Services with externalTrafficPolicy Local, or
+		//the kube-proxy healthz server on KubeProxyHealthzPort (defaults to 10256) otherwise.
+		//It requires the CCM to reach the node private IPs. Defaults to false.
+		BackendHealthzGating bool
+		KubeProxyHealthzPort int
+
+		//Client-side rate limits (queries per second and burst) of the oAPI and LBU calls,
+		//shared by all the clients of an API family. Throttled calls are retried up to
+		//ThrottleMaxRetries times (defaults to 5) with a jittered exponential backoff.
+		//Defaults to 0, which disables the rate limiter of the API family.
+		OapiQPS            float32
+		OapiBurst          int
+		LbuQPS             float32
+		LbuBurst           int
+		ThrottleMaxRetries int
+
+		//Prefix of the names of the resources created by the cloud provider (default load
+		//balancer names and security group names), also set as the OscK8sNamePrefix tag, to
+		//tell the clusters of an account apart. Characters other than alphanumerics and hyphens
+		//are replaced by hyphens, e.g. "prod/eu" becomes "prod-eu". Changing it renames the
+		//load balancers of existing Services, it should be set when creating the cluster.
+		ResourceNamePrefix string
+
+		//Go template of the load balancer names, e.g. "{{.ClusterName}}-{{.Namespace}}-{{.ServiceName}}",
+		//instead of the names derived from the Service UID. The variables are ClusterName (the
+		//cluster ID), Namespace, ServiceName and ServiceUID. Characters other than alphanumerics
+		//and hyphens are replaced by hyphens, the ResourceNamePrefix is not prepended and the
+		//name is truncated to 32 characters. A Service whose name is already used by the load
+		//balancer of another Service is rejected. The osc-load-balancer-name annotation takes
+		//precedence, and the --load-balancer-name-template flag takes precedence over it.
+		//It only applies to the Services without load balancer yet: the rendered name is recorded
+		//in the osc-load-balancer-active-name annotation, and changing the template does not
+		//rename the existing load balancers.
+		LoadBalancerNameTemplate string
+
+		//Comma separated list of the cluster IDs that Services may set in the
+		//osc-load-balancer-owner-cluster-id annotation, to tag their load balancer and its
+		//security group as owned by another cluster (e.g. multi-cluster gateways). This
+		//cluster keeps reconciling them, tracked by the OscK8sManagedBy tag. The
+		//--allowed-owner-cluster-ids flag takes precedence. Defaults to none.
+		AllowedOwnerClusterIDs string
+
+		//Prefix of the key of the cluster tag, the key being the prefix followed by the cluster
+		//ID, e.g. "kubernetes.io/cluster/" for clusters created by kops or CAPOSC. The cluster
+		//tag of the resources created by the CCM uses this prefix, and the resources read
+		//are recognized with this prefix or one of LegacyKubernetesClusterTagPrefixes.
+		//Defaults to OscK8sClusterID/.
+		KubernetesClusterTagPrefix string
+
+		//Comma separated list of the prefixes of the cluster tags of the resources tagged by
+		//other tooling or before a change of KubernetesClusterTagPrefix, e.g.
+		//"OscK8sClusterID/,kubernetes.io/cluster/". The resources tagged with them are
+		//recognized as resources of the cluster without being retagged; the CCM adds the tag
+		//with KubernetesClusterTagPrefix to the resources it repairs. Defaults to none.
+		LegacyKubernetesClusterTagPrefixes string
+
+		//Comma separated key=value tags set on all the resources created by the CCM (load
+		//balancers, security groups and public IPs), e.g. for cost allocation:
+		//team=platform,cost-center=1234. The tags of the additional resource tags annotation
+		//take precedence, and the tags reserved for the CCM (OscK8s*) are refused. The
+		//--resource-tags flag takes precedence. Defaults to none.
+		ResourceTags string
+
+		//Default management of the load balancer security groups, overridden by the
+		//osc-load-balancer-security-group-mode annotation: "managed" (default) creates a
+		//security group per load balancer, "shared" uses a security group shared by the load
+		//balancers of the cluster with the rules of all of them, and "none" never creates,
+		//modifies or deletes security groups, which are then set with the
+		//aws-load-balancer-security-groups annotation.
+		SecurityGroupMode string
+
+		//When set, once the backends are registered the CCM opens a TCP connection to the
+		//NodePort of every listener on a backend, and reports the load balancer as not ready
+		//while none accepts connections. It requires the CCM to reach the node private IPs.
+		//Defaults to false.
+		NodePortReachabilityCheck bool
+
+		//When set, only the nodes with a ready local endpoint are registered as backends of
+		//the load balancers of Services with externalTrafficPolicy Local. The backends are
+		//updated when the Service, the nodes or the nodes of its ready endpoints change,
+		//the EndpointSlices being watched. Defaults to false.
+		DeregisterNodesWithoutLocalEndpoints bool
+
+		//When set, the OOS bucket of the load balancer access logs is created when it does
+		//not exist, and the reconciliation of the load balancer fails when it can't be.
+		//Otherwise a missing or unreadable bucket is only reported with an
+		//InvalidAccessLogBucket event. Defaults to false.
+		CreateAccessLogBuckets bool
+
+		//When set, a public IP is allocated for the load balancers annotated with an IP pool
+		//having no free public IP, and released when the load balancer is deleted.
+		//Defaults to false.
+		AllocateLoadBalancerPublicIps bool
+
+		//When set, the load balancers are neither created nor updated: the changes that would
+		//be made are logged and reported as DryRun events of the services. The services may
+		//override it with the osc-load-balancer-dry-run annotation. Defaults to false.
+		LoadBalancerDryRun bool
+
+		//Class of the Services reconciled by the cloud provider besides the Services without
+		//spec.loadBalancerClass. The Services of other classes are left to their controller.
+		//Defaults to service.k8s.outscale.com/lbu.
+		LoadBalancerClass string
+
+		//Set when the LBU API of the region accepts SCTP listeners. The SCTP ports of the
+		//Services are then passed through to the nodes, and the load balancers having only
+		//SCTP listeners are health checked on the kube-proxy healthz server (KubeProxyHealthzPort).
+		//Defaults to false, which fails the reconciliation of the Services with SCTP ports.
+		LoadBalancerSCTPListeners bool
+
+		//Set when the LBU API of the region accepts proxy protocol v2 policies, requested with
+		//the osc-load-balancer-proxy-protocol-version annotation. Defaults to false, which fails
+		//the reconciliation of the Services requesting the proxy protocol v2.
+		LoadBalancerProxyProtocolV2 bool
+
+		//The VMs are registered with and deregistered from the load balancers by batches of
+		//LoadBalancerBackendBatchSize VMs (defaults to 100), with LoadBalancerBackendWorkers
+		//concurrent calls (defaults to 4). The Services of the load balancer class of the
+		//cloud provider are reconciled with as many workers.
+		LoadBalancerBackendBatchSize int
+		LoadBalancerBackendWorkers   int
+
+		//Default rules opening the node security groups to the load balancers, overridden by
+		//the osc-load-balancer-backend-security-group-rules annotation: "all" (default) opens
+		//all the protocols and ports, "ports" only the node ports of the listeners and the
+		//health check port, removing the rules of the ports no longer used.
+		BackendSecurityGroupRules string
+
+		//Maximum number of inbound rules of the load balancer security groups, the rules with
+		//the same protocol and ports being grouped into one rule with all their source
+		//ranges. The reconciliation of a Service whose security group would exceed it fails
+		//before any change. Defaults to 100.
+		SecurityGroupRuleLimit int
+
+		//When set, the CCM keeps this number of security groups pre-created and tagged for
+		//the cluster in the Net of the nodes, refilled when no load balancer is being
+		//reconciled, and leases them to the new load balancers instead of creating their
+		//security group. Defaults to 0, which disables the pool.
+		SecurityGroupPoolSize int
+
+		//Net of the load balancers, peered with the Net of the nodes (e.g. a shared "edge" Net
+		//terminating the traffic), whose subnets tagged for the cluster are used by the load
+		//balancers. The node security groups are opened to the IP ranges of the subnets of the
+		//load balancers. The osc-load-balancer-net-id annotation overrides it per Service.
+		//Defaults to empty, which creates the load balancers in the Net of the nodes.
+		LoadBalancerNetID string
+
+		//Label selector of the nodes never registered with the load balancers, e.g.
+		//"node-role.kubernetes.io/gpu,dedicated in (storage)", besides the nodes labeled with
+		//service.osc.outscale.com/exclude-from-external-load-balancers. The
+		//--excluded-nodes-selector flag takes precedence.
+		ExcludedNodesSelector string
+
+		//Maximum number of mutating LBU calls made for a load balancer within
+		//LoadBalancerAPICallBudgetWindowSeconds (defaults to 600). Once exceeded, an
+		//APICallBudgetExceeded event is emitted and the reconciliations of the Service are
+		//delayed, by 1 minute and then twice longer every time it is exceeded again, up to 30
+		//minutes. Defaults to 0, which disables the budget.
+		LoadBalancerAPICallBudget              int
+		LoadBalancerAPICallBudgetWindowSeconds int
+
+		//Endpoints of the oAPI, LBU, EIM, OOS and metadata services, for the installations of
+		//Outscale-compatible APIs, e.g. https://api.{region}.example.com/api/v1 where {region}
+		//is replaced with the region of the client. The OSC_ENDPOINT_API, OSC_ENDPOINT_LBU,
+		//OSC_ENDPOINT_EIM and OSC_ENDPOINT_OOS environment variables and the ServiceOverride
+		//sections take precedence. Defaults to the Outscale endpoints. EndpointDNS is the
+		//endpoint of the Route 53 compatible DNS service of DNSHostedZoneID.
+		EndpointAPI      string
+		EndpointLBU      string
+		EndpointEIM      string
+		EndpointOOS      string
+		EndpointMetadata string
+		EndpointDNS      string
+
+		//PEM file of the certificate authorities trusted by the API clients besides the
+		//system ones, for endpoints using a private CA. InsecureSkipVerify disables the
+		//verification of the certificates of the endpoints, it should only be used for tests.
+		CABundle           string
+		InsecureSkipVerify bool
+
+		//Proxy of the API calls, e.g. http://proxy.example.com:3128, and comma-separated list
+		//of the hosts, domains and CIDRs reached without proxy, in the format of NO_PROXY.
+		//Default to the HTTPS_PROXY and NO_PROXY environment variables. The metadata service is
+		//never reached through the proxy.
+		Proxy   string
+		NoProxy string
+
+		//ID of the hosted zone of the Route 53 compatible DNS service (see EndpointDNS) in
+		//which the osc-load-balancer-dns-name annotation registers the DNS names of the load
+		//balancers, with a TTL of DNSRecordTTL seconds (defaults to 60). Defaults to empty,
+		//which disables the DNS records.
+		DNSHostedZoneID string
+		DNSRecordTTL    int
+
+		//Comma-separated verbosity of the modules of the cloud provider, as module=level, e.g.
+		//loadbalancer=4,api=2. The modules are api, instances, loadbalancer and securitygroups.
+		//The --vmodule flag takes precedence. Defaults to empty, which uses the --v flag.
+		LogVerbosity string
+	}
+	//Default values of the load balancer annotations, applied to the Services which don't
+	//set them, so that a policy holds without changing every Service manifest:
+	// [LoadBalancerDefaults]
+	//  Annotation = service.beta.kubernetes.io/aws-load-balancer-internal=true
+	//  Annotation = service.beta.kubernetes.io/aws-load-balancer-additional-resource-tags=team=platform
+	LoadBalancerDefaults struct {
+		Annotation []string
 	}
 	// [ServiceOverride "1"]
 	//  Service = s3
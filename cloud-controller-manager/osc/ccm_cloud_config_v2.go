@@ -0,0 +1,350 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// ********************* CCM CloudConfig v2 *********************
+
+const (
+	// CloudConfigAPIVersionV2 is the apiVersion of the YAML cloud config
+	CloudConfigAPIVersionV2 = "ccm.k8s.outscale.com/v2"
+	// CloudConfigKind is the kind of the YAML cloud config
+	CloudConfigKind = "CloudConfig"
+)
+
+// cloudConfigV2 is the YAML schema of the cloud config, selected by its apiVersion. Its
+// sections are translated into the CloudConfig of the INI config, which remains supported:
+//
+//	apiVersion: ccm.k8s.outscale.com/v2
+//	kind: CloudConfig
+//	global:
+//	  kubernetesClusterID: my-cluster
+//	endpoints:
+//	  api: https://api.{region}.example.com/api/v1
+//	  caBundle: /etc/ssl/private-ca.pem
+//	  proxy: http://proxy.example.com:3128
+//	  overrides:
+//	  - service: elasticloadbalancing
+//	    region: eu-west-2
+//	    url: https://lbu.eu-west-2.outscale.com
+//	    signingRegion: eu-west-2
+//	rateLimits:
+//	  oapi: {qps: 10, burst: 20}
+//	  lbu: {qps: 5, burst: 10}
+//	  throttleMaxRetries: 5
+//	defaultTags:
+//	  team: platform
+//	resourceTags:
+//	  cost-center: "1234"
+//	subnets:
+//	  subnetID: subnet-12345678
+//	securityGroups:
+//	  mode: shared
+//	  backendRules: ports
+//	loadBalancerDefaults:
+//	  service.beta.kubernetes.io/aws-load-balancer-internal: "true"
+type cloudConfigV2 struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Fields of the [Global] section not covered by the other sections, with the same names
+	Global               json.RawMessage         `json:"global,omitempty"`
+	Endpoints            cloudConfigV2Endpoints  `json:"endpoints,omitempty"`
+	RateLimits           cloudConfigV2RateLimits `json:"rateLimits,omitempty"`
+	DefaultTags          map[string]string       `json:"defaultTags,omitempty"`
+	ResourceTags         map[string]string       `json:"resourceTags,omitempty"`
+	Subnets              cloudConfigV2Subnets    `json:"subnets,omitempty"`
+	SecurityGroups       cloudConfigV2SecGroups  `json:"securityGroups,omitempty"`
+	LoadBalancerDefaults map[string]string       `json:"loadBalancerDefaults,omitempty"`
+}
+
+type cloudConfigV2Endpoints struct {
+	API                string `json:"api,omitempty"`
+	LBU                string `json:"lbu,omitempty"`
+	EIM                string `json:"eim,omitempty"`
+	OOS                string `json:"oos,omitempty"`
+	Metadata           string `json:"metadata,omitempty"`
+	DNS                string `json:"dns,omitempty"`
+	CABundle           string `json:"caBundle,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	Proxy              string `json:"proxy,omitempty"`
+	NoProxy            string `json:"noProxy,omitempty"`
+	// Overrides of the endpoints of the AWS compatible services, as the [ServiceOverride]
+	// sections of the INI config
+	Overrides []cloudConfigV2EndpointOverride `json:"overrides,omitempty"`
+}
+
+type cloudConfigV2EndpointOverride struct {
+	Service       string `json:"service"`
+	Region        string `json:"region"`
+	URL           string `json:"url"`
+	SigningRegion string `json:"signingRegion"`
+	SigningMethod string `json:"signingMethod,omitempty"`
+	SigningName   string `json:"signingName,omitempty"`
+}
+
+// serviceOverride is a [ServiceOverride] section of the INI config
+type serviceOverride = struct {
+	Service       string
+	Region        string
+	URL           string
+	SigningRegion string
+	SigningMethod string
+	SigningName   string
+}
+
+type cloudConfigV2RateLimits struct {
+	Oapi               cloudConfigV2RateLimit `json:"oapi,omitempty"`
+	Lbu                cloudConfigV2RateLimit `json:"lbu,omitempty"`
+	ThrottleMaxRetries int                    `json:"throttleMaxRetries,omitempty"`
+}
+
+type cloudConfigV2RateLimit struct {
+	QPS   float32 `json:"qps,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+type cloudConfigV2Subnets struct {
+	VPC          string `json:"vpc,omitempty"`
+	SubnetID     string `json:"subnetID,omitempty"`
+	RouteTableID string `json:"routeTableID,omitempty"`
+}
+
+type cloudConfigV2SecGroups struct {
+	Mode                string `json:"mode,omitempty"`
+	BackendRules        string `json:"backendRules,omitempty"`
+	ElbSecurityGroup    string `json:"elbSecurityGroup,omitempty"`
+	DisableIngressRules bool   `json:"disableIngressRules,omitempty"`
+}
+
+// isCloudConfigV2 returns whether the config is a YAML document with an apiVersion, which
+// INI configs can't be mistaken for
+func isCloudConfigV2(data []byte) bool {
+	header := struct {
+		APIVersion string `json:"apiVersion"`
+	}{}
+	return yaml.Unmarshal(data, &header) == nil && header.APIVersion != ""
+}
+
+// readCloudConfigV2 parses and validates a YAML cloud config. Unknown fields are rejected,
+// and the errors are reported with the path of the field.
+func readCloudConfigV2(data []byte) (*CloudConfig, error) {
+	v2 := cloudConfigV2{}
+	if err := yaml.UnmarshalStrict(data, &v2); err != nil {
+		return nil, fmt.Errorf("invalid cloud config: %v", err)
+	}
+	if v2.APIVersion != CloudConfigAPIVersionV2 {
+		return nil, fmt.Errorf("unsupported cloud config apiVersion %q, expected %q", v2.APIVersion, CloudConfigAPIVersionV2)
+	}
+	if v2.Kind != CloudConfigKind {
+		return nil, fmt.Errorf("unsupported cloud config kind %q, expected %q", v2.Kind, CloudConfigKind)
+	}
+
+	cfg := CloudConfig{}
+	if len(v2.Global) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(v2.Global))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg.Global); err != nil {
+			return nil, fmt.Errorf("invalid cloud config: global: %v", err)
+		}
+	}
+
+	if allErrs := v2.apply(&cfg); len(allErrs) > 0 {
+		return nil, fmt.Errorf("invalid cloud config: %v", allErrs.ToAggregate())
+	}
+	return &cfg, nil
+}
+
+// apply sets the sections of the YAML config into the INI config, on top of the global
+// section, and returns their errors
+func (v2 *cloudConfigV2) apply(cfg *CloudConfig) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	endpoints := v2.Endpoints
+	endpointsPath := field.NewPath("endpoints")
+	for _, endpoint := range []struct {
+		path   *field.Path
+		global *string
+		value  string
+	}{
+		{endpointsPath.Child("api"), &cfg.Global.EndpointAPI, endpoints.API},
+		{endpointsPath.Child("lbu"), &cfg.Global.EndpointLBU, endpoints.LBU},
+		{endpointsPath.Child("eim"), &cfg.Global.EndpointEIM, endpoints.EIM},
+		{endpointsPath.Child("oos"), &cfg.Global.EndpointOOS, endpoints.OOS},
+		{endpointsPath.Child("metadata"), &cfg.Global.EndpointMetadata, endpoints.Metadata},
+		{endpointsPath.Child("dns"), &cfg.Global.EndpointDNS, endpoints.DNS},
+		{endpointsPath.Child("proxy"), &cfg.Global.Proxy, endpoints.Proxy},
+	} {
+		if endpoint.value == "" {
+			continue
+		}
+		if u, err := url.Parse(strings.ReplaceAll(endpoint.value, regionPlaceholder, "region")); err != nil || u.Scheme == "" || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(endpoint.path, endpoint.value, "expected an absolute URL"))
+		}
+		allErrs = setCloudConfigV2(allErrs, endpoint.path, endpoint.global, endpoint.value)
+	}
+	allErrs = setCloudConfigV2(allErrs, endpointsPath.Child("caBundle"), &cfg.Global.CABundle, endpoints.CABundle)
+	allErrs = setCloudConfigV2(allErrs, endpointsPath.Child("insecureSkipVerify"), &cfg.Global.InsecureSkipVerify, endpoints.InsecureSkipVerify)
+	allErrs = setCloudConfigV2(allErrs, endpointsPath.Child("noProxy"), &cfg.Global.NoProxy, endpoints.NoProxy)
+
+	overridesPath := endpointsPath.Child("overrides")
+	for i, override := range endpoints.Overrides {
+		path := overridesPath.Index(i)
+		if u, err := url.Parse(override.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(path.Child("url"), override.URL, "expected an absolute URL"))
+		}
+		if cfg.ServiceOverride == nil {
+			cfg.ServiceOverride = make(map[string]*serviceOverride)
+		}
+		cfg.ServiceOverride[strconv.Itoa(i)] = &serviceOverride{
+			Service:       override.Service,
+			Region:        override.Region,
+			URL:           override.URL,
+			SigningRegion: override.SigningRegion,
+			SigningMethod: override.SigningMethod,
+			SigningName:   override.SigningName,
+		}
+	}
+	if len(allErrs) == 0 {
+		if err := cfg.validateOverrides(); err != nil {
+			allErrs = append(allErrs, field.Invalid(overridesPath, "", err.Error()))
+		}
+	}
+
+	rateLimitsPath := field.NewPath("rateLimits")
+	limits := v2.RateLimits
+	for _, value := range []struct {
+		path  *field.Path
+		value float64
+	}{
+		{rateLimitsPath.Child("oapi", "qps"), float64(limits.Oapi.QPS)},
+		{rateLimitsPath.Child("oapi", "burst"), float64(limits.Oapi.Burst)},
+		{rateLimitsPath.Child("lbu", "qps"), float64(limits.Lbu.QPS)},
+		{rateLimitsPath.Child("lbu", "burst"), float64(limits.Lbu.Burst)},
+		{rateLimitsPath.Child("throttleMaxRetries"), float64(limits.ThrottleMaxRetries)},
+	} {
+		if value.value < 0 {
+			allErrs = append(allErrs, field.Invalid(value.path, value.value, "must not be negative"))
+		}
+	}
+	allErrs = setCloudConfigV2(allErrs, rateLimitsPath.Child("oapi", "qps"), &cfg.Global.OapiQPS, limits.Oapi.QPS)
+	allErrs = setCloudConfigV2(allErrs, rateLimitsPath.Child("oapi", "burst"), &cfg.Global.OapiBurst, limits.Oapi.Burst)
+	allErrs = setCloudConfigV2(allErrs, rateLimitsPath.Child("lbu", "qps"), &cfg.Global.LbuQPS, limits.Lbu.QPS)
+	allErrs = setCloudConfigV2(allErrs, rateLimitsPath.Child("lbu", "burst"), &cfg.Global.LbuBurst, limits.Lbu.Burst)
+	allErrs = setCloudConfigV2(allErrs, rateLimitsPath.Child("throttleMaxRetries"), &cfg.Global.ThrottleMaxRetries, limits.ThrottleMaxRetries)
+
+	subnetsPath := field.NewPath("subnets")
+	if v2.Subnets.SubnetID != "" && !subnetIDRegexp.MatchString(v2.Subnets.SubnetID) {
+		allErrs = append(allErrs, field.Invalid(subnetsPath.Child("subnetID"), v2.Subnets.SubnetID, "not a valid subnet ID"))
+	}
+	allErrs = setCloudConfigV2(allErrs, subnetsPath.Child("vpc"), &cfg.Global.VPC, v2.Subnets.VPC)
+	allErrs = setCloudConfigV2(allErrs, subnetsPath.Child("subnetID"), &cfg.Global.SubnetID, v2.Subnets.SubnetID)
+	allErrs = setCloudConfigV2(allErrs, subnetsPath.Child("routeTableID"), &cfg.Global.RouteTableID, v2.Subnets.RouteTableID)
+
+	securityGroupsPath := field.NewPath("securityGroups")
+	securityGroups := v2.SecurityGroups
+	if _, err := parseSecurityGroupMode(securityGroups.Mode); err != nil {
+		allErrs = append(allErrs, field.Invalid(securityGroupsPath.Child("mode"), securityGroups.Mode, err.Error()))
+	}
+	if _, err := parseBackendRuleGranularity(securityGroups.BackendRules); err != nil {
+		allErrs = append(allErrs, field.Invalid(securityGroupsPath.Child("backendRules"), securityGroups.BackendRules, err.Error()))
+	}
+	if securityGroups.ElbSecurityGroup != "" && !securityGroupIDRegexp.MatchString(securityGroups.ElbSecurityGroup) {
+		allErrs = append(allErrs, field.Invalid(securityGroupsPath.Child("elbSecurityGroup"), securityGroups.ElbSecurityGroup,
+			"not a valid security group ID"))
+	}
+	allErrs = setCloudConfigV2(allErrs, securityGroupsPath.Child("mode"), &cfg.Global.SecurityGroupMode, securityGroups.Mode)
+	allErrs = setCloudConfigV2(allErrs, securityGroupsPath.Child("backendRules"), &cfg.Global.BackendSecurityGroupRules, securityGroups.BackendRules)
+	allErrs = setCloudConfigV2(allErrs, securityGroupsPath.Child("elbSecurityGroup"), &cfg.Global.ElbSecurityGroup, securityGroups.ElbSecurityGroup)
+	allErrs = setCloudConfigV2(allErrs, securityGroupsPath.Child("disableIngressRules"), &cfg.Global.DisableSecurityGroupIngress,
+		securityGroups.DisableIngressRules)
+
+	if len(v2.ResourceTags) > 0 {
+		resourceTagsPath := field.NewPath("resourceTags")
+		for key, value := range v2.ResourceTags {
+			if strings.ContainsAny(key, ",=") || strings.Contains(value, ",") {
+				allErrs = append(allErrs, field.Invalid(resourceTagsPath.Key(key), value, "keys must not contain ',' or '=', values must not contain ','"))
+			}
+		}
+		resourceTags := formatResourceTags(v2.ResourceTags)
+		if _, err := parseResourceTags(resourceTags); err != nil {
+			allErrs = append(allErrs, field.Invalid(resourceTagsPath, v2.ResourceTags, err.Error()))
+		}
+		allErrs = setCloudConfigV2(allErrs, resourceTagsPath, &cfg.Global.ResourceTags, resourceTags)
+	}
+
+	// The default tags are the default of the additional resource tags annotation
+	defaults := make(map[string]string, len(v2.LoadBalancerDefaults)+1)
+	for key, value := range v2.LoadBalancerDefaults {
+		defaults[key] = value
+	}
+	if len(v2.DefaultTags) > 0 {
+		tagsPath := field.NewPath("defaultTags")
+		if _, found := defaults[ServiceAnnotationLoadBalancerAdditionalTags]; found {
+			allErrs = append(allErrs, field.Forbidden(tagsPath,
+				fmt.Sprintf("mutually exclusive with loadBalancerDefaults[%s]", ServiceAnnotationLoadBalancerAdditionalTags)))
+		}
+		tags := make([]string, 0, len(v2.DefaultTags))
+		for key, value := range v2.DefaultTags {
+			if key == "" || strings.ContainsAny(key, ",=") || strings.ContainsAny(value, ",=") {
+				allErrs = append(allErrs, field.Invalid(tagsPath.Key(key), value, "tag keys must not be empty, keys and values must not contain ',' or '='"))
+				continue
+			}
+			tags = append(tags, key+"="+value)
+		}
+		sort.Strings(tags)
+		defaults[ServiceAnnotationLoadBalancerAdditionalTags] = strings.Join(tags, ",")
+	}
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cfg.LoadBalancerDefaults.Annotation = append(cfg.LoadBalancerDefaults.Annotation, key+"="+defaults[key])
+	}
+	if _, err := parseLoadBalancerDefaults(cfg.LoadBalancerDefaults.Annotation); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("loadBalancerDefaults"), "", err.Error()))
+	}
+
+	return allErrs
+}
+
+// setCloudConfigV2 sets a field of the global section from another section, refusing to
+// override a value set in the global section
+func setCloudConfigV2[T comparable](allErrs field.ErrorList, path *field.Path, global *T, value T) field.ErrorList {
+	var zero T
+	if value == zero {
+		return allErrs
+	}
+	if *global != zero {
+		return append(allErrs, field.Forbidden(path, "also set in the global section"))
+	}
+	*global = value
+	return allErrs
+}
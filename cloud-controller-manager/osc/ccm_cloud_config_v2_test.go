@@ -0,0 +1,146 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCloudConfigV2(t *testing.T) {
+	cfg, err := readCloudConfig(strings.NewReader(`
+apiVersion: ccm.k8s.outscale.com/v2
+kind: CloudConfig
+global:
+  kubernetesClusterID: my-cluster
+  LoadBalancerDryRun: true
+endpoints:
+  overrides:
+  - service: elasticloadbalancing
+    region: eu-west-2
+    url: https://lbu.example.com
+    signingRegion: eu-west-2
+rateLimits:
+  oapi: {qps: 10, burst: 20}
+  lbu: {qps: 2.5, burst: 5}
+  throttleMaxRetries: 3
+defaultTags:
+  team: platform
+  env: prod
+resourceTags:
+  cost-center: "1234"
+subnets:
+  subnetID: subnet-0a1b2c3d
+securityGroups:
+  mode: shared
+  backendRules: ports
+loadBalancerDefaults:
+  service.beta.kubernetes.io/aws-load-balancer-internal: "true"
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "my-cluster", cfg.Global.KubernetesClusterID)
+	assert.True(t, cfg.Global.LoadBalancerDryRun)
+	assert.Equal(t, float32(10), cfg.Global.OapiQPS)
+	assert.Equal(t, 20, cfg.Global.OapiBurst)
+	assert.Equal(t, float32(2.5), cfg.Global.LbuQPS)
+	assert.Equal(t, 5, cfg.Global.LbuBurst)
+	assert.Equal(t, 3, cfg.Global.ThrottleMaxRetries)
+	assert.Equal(t, "subnet-0a1b2c3d", cfg.Global.SubnetID)
+	assert.Equal(t, "cost-center=1234", cfg.Global.ResourceTags)
+	assert.Equal(t, "shared", cfg.Global.SecurityGroupMode)
+	assert.Equal(t, "ports", cfg.Global.BackendSecurityGroupRules)
+	assert.Equal(t, []string{
+		ServiceAnnotationLoadBalancerAdditionalTags + "=env=prod,team=platform",
+		ServiceAnnotationLoadBalancerInternal + "=true",
+	}, cfg.LoadBalancerDefaults.Annotation)
+	require.Len(t, cfg.ServiceOverride, 1)
+	resolved, err := cfg.getResolver()("elasticloadbalancing", "eu-west-2")
+	require.NoError(t, err)
+	assert.Equal(t, "https://lbu.example.com", resolved.URL)
+
+	// The INI config is still supported
+	cfg, err = readCloudConfig(strings.NewReader(`
+[Global]
+KubernetesClusterID = my-cluster
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "my-cluster", cfg.Global.KubernetesClusterID)
+}
+
+func TestReadCloudConfigV2Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name:   "unknown version",
+			config: "apiVersion: ccm.k8s.outscale.com/v3\nkind: CloudConfig\n",
+			err:    `unsupported cloud config apiVersion "ccm.k8s.outscale.com/v3"`,
+		},
+		{
+			name:   "wrong kind",
+			config: "apiVersion: ccm.k8s.outscale.com/v2\nkind: Config\n",
+			err:    `unsupported cloud config kind "Config"`,
+		},
+		{
+			name:   "unknown field",
+			config: "apiVersion: ccm.k8s.outscale.com/v2\nkind: CloudConfig\nrateLimit: {}\n",
+			err:    `unknown field "rateLimit"`,
+		},
+		{
+			name:   "unknown global field",
+			config: "apiVersion: ccm.k8s.outscale.com/v2\nkind: CloudConfig\nglobal:\n  clusterID: foo\n",
+			err:    `global: json: unknown field "clusterID"`,
+		},
+		{
+			name:   "invalid values",
+			config: "apiVersion: ccm.k8s.outscale.com/v2\nkind: CloudConfig\nrateLimits:\n  lbu: {qps: -1}\nsecurityGroups:\n  mode: private\n",
+			err:    `[rateLimits.lbu.qps: Invalid value: -1: must not be negative, securityGroups.mode: Invalid value: "private": unknown security group mode "private", expected managed, shared or none]`,
+		},
+		{
+			name:   "set twice",
+			config: "apiVersion: ccm.k8s.outscale.com/v2\nkind: CloudConfig\nglobal:\n  SubnetID: subnet-0a1b2c3d\nsubnets:\n  subnetID: subnet-0a1b2c3e\n",
+			err:    "subnets.subnetID: Forbidden: also set in the global section",
+		},
+		{
+			name:   "invalid endpoint",
+			config: "apiVersion: ccm.k8s.outscale.com/v2\nkind: CloudConfig\nendpoints:\n  overrides:\n  - service: ec2\n    url: fcu\n",
+			err:    `endpoints.overrides[0].url: Invalid value: "fcu": expected an absolute URL`,
+		},
+		{
+			name:   "reserved resource tag",
+			config: "apiVersion: ccm.k8s.outscale.com/v2\nkind: CloudConfig\nresourceTags: {OscK8sService: web}\n",
+			err:    `tag "OscK8sService" is reserved for the cloud provider`,
+		},
+		{
+			name:   "tags and default tags",
+			config: "apiVersion: ccm.k8s.outscale.com/v2\nkind: CloudConfig\ndefaultTags: {team: web}\nloadBalancerDefaults:\n  service.beta.kubernetes.io/aws-load-balancer-additional-resource-tags: team=db\n",
+			err:    "defaultTags: Forbidden: mutually exclusive with loadBalancerDefaults",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readCloudConfig(strings.NewReader(test.config))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+}
@@ -62,6 +62,11 @@ const ServiceAnnotationLoadBalancerInternal = "service.beta.kubernetes.io/aws-lo
 // certain backends.
 const ServiceAnnotationLoadBalancerProxyProtocol = "service.beta.kubernetes.io/aws-load-balancer-proxy-protocol"
 
+// ServiceAnnotationLoadBalancerProxyProtocolVersion is the annotation used on the
+// service to choose the version of the proxy protocol enabled by
+// ServiceAnnotationLoadBalancerProxyProtocol: "1" (default) or "2".
+const ServiceAnnotationLoadBalancerProxyProtocolVersion = "service.beta.kubernetes.io/osc-load-balancer-proxy-protocol-version"
+
 // ServiceAnnotationLoadBalancerAccessLogEmitInterval is the annotation used to
 // specify access log emit interval.
 const ServiceAnnotationLoadBalancerAccessLogEmitInterval = "service.beta.kubernetes.io/aws-load-balancer-access-log-emit-interval"
@@ -94,6 +99,11 @@ const ServiceAnnotationLoadBalancerConnectionIdleTimeout = "service.beta.kuberne
 // used on the service to enable or disable cross-zone load balancing.
 const ServiceAnnotationLoadBalancerCrossZoneLoadBalancingEnabled = "service.beta.kubernetes.io/aws-load-balancer-cross-zone-load-balancing-enabled"
 
+// ServiceAnnotationLoadBalancerCrossZoneEnabled is the annotation used on the
+// service to enable or disable cross-zone load balancing. It takes precedence over
+// ServiceAnnotationLoadBalancerCrossZoneLoadBalancingEnabled.
+const ServiceAnnotationLoadBalancerCrossZoneEnabled = "service.beta.kubernetes.io/osc-load-balancer-cross-zone-enabled"
+
 // ServiceAnnotationLoadBalancerExtraSecurityGroups is the annotation used
 // on the service to specify additional security groups to be added to ELB created
 const ServiceAnnotationLoadBalancerExtraSecurityGroups = "service.beta.kubernetes.io/aws-load-balancer-extra-security-groups"
@@ -103,6 +113,12 @@ const ServiceAnnotationLoadBalancerExtraSecurityGroups = "service.beta.kubernete
 // "service.beta.kubernetes.io/aws-load-balancer-extra-security-groups", this replaces all other security groups previously assigned to the ELB.
 const ServiceAnnotationLoadBalancerSecurityGroups = "service.beta.kubernetes.io/aws-load-balancer-security-groups"
 
+// ServiceAnnotationLoadBalancerSecurityGroupSelector is the annotation used
+// on the service to select a pre-existing security group by its tags instead of its id,
+// as a comma-separated list of key-value pairs. For example: "Key1=Val1,KeyNoVal"
+// The selected security group replaces the one created for the ELB.
+const ServiceAnnotationLoadBalancerSecurityGroupSelector = "service.beta.kubernetes.io/osc-load-balancer-security-group-selector"
+
 // ServiceAnnotationLoadBalancerCertificate is the annotation used on the
 // service to request a secure listener. Value is a valid certificate ARN.
 // For more, see http://docs.aws.amazon.com/ElasticLoadBalancing/latest/DeveloperGuide/elb-listener-config.html
@@ -119,6 +135,12 @@ const ServiceAnnotationLoadBalancerSSLPorts = "service.beta.kubernetes.io/aws-lo
 // of your load balancer. Defaults to AWS's default
 const ServiceAnnotationLoadBalancerSSLNegotiationPolicy = "service.beta.kubernetes.io/aws-load-balancer-ssl-negotiation-policy"
 
+// ServiceAnnotationLoadBalancerSSLPolicy is the annotation used on the service to
+// choose a predefined SSL negotiation policy ("default", "tls-1-1", "tls-1-2" or
+// "modern") for the HTTPS/SSL listeners of the load balancer. It takes precedence over
+// ServiceAnnotationLoadBalancerSSLNegotiationPolicy.
+const ServiceAnnotationLoadBalancerSSLPolicy = "service.beta.kubernetes.io/osc-load-balancer-ssl-policy"
+
 // ServiceAnnotationLoadBalancerBEProtocol is the annotation used on the service
 // to specify the protocol spoken by the backend (pod) behind a listener.
 // If `http` (default) or `https`, an HTTPS listener that terminates the
@@ -128,6 +150,12 @@ const ServiceAnnotationLoadBalancerSSLNegotiationPolicy = "service.beta.kubernet
 // a HTTP listener is used.
 const ServiceAnnotationLoadBalancerBEProtocol = "service.beta.kubernetes.io/aws-load-balancer-backend-protocol"
 
+// ServiceAnnotationLoadBalancerBEProtocolMap is the annotation used on the service
+// to specify the backend protocol of each port, as a comma-separated list of
+// "<port number or name>=<protocol>" entries, for example "443=https,80=http,6443=tcp".
+// The ports not listed use ServiceAnnotationLoadBalancerBEProtocol.
+const ServiceAnnotationLoadBalancerBEProtocolMap = "service.beta.kubernetes.io/osc-load-balancer-backend-protocol-map"
+
 // ServiceAnnotationLoadBalancerAdditionalTags is the annotation used on the service
 // to specify a comma-separated list of key-value pairs which will be recorded as
 // additional tags in the ELB.
@@ -165,6 +193,200 @@ const ServiceAnnotationLoadBalancerName = "service.beta.kubernetes.io/osc-load-b
 // service to specify, the subnet in which to create the load balancer.
 const ServiceAnnotationLoadBalancerSubnetID = "service.beta.kubernetes.io/osc-load-balancer-subnet-id"
 
+// ServiceAnnotationLoadBalancerNetID is the annotation used on the service to specify the
+// Net in which to create the load balancer, peered with the Net of the nodes, overriding
+// LoadBalancerNetID of the cloud config.
+const ServiceAnnotationLoadBalancerNetID = "service.beta.kubernetes.io/osc-load-balancer-net-id"
+
+// ServiceAnnotationLoadBalancerSubnetIDs is the annotation used on the
+// service to specify, as a comma-separated list, the subnets in which to create
+// the load balancer, for example one per subregion.
+const ServiceAnnotationLoadBalancerSubnetIDs = "service.beta.kubernetes.io/osc-load-balancer-subnet-ids"
+
+// ServiceAnnotationLoadBalancerSubnetAZ is the annotation used on the
+// service to specify the subregion, e.g. eu-west-2b, of the subnet in which to
+// create the load balancer, among the subnets discovered for the cluster.
+const ServiceAnnotationLoadBalancerSubnetAZ = "service.beta.kubernetes.io/osc-load-balancer-subnet-az"
+
+// ServiceAnnotationLoadBalancerOwnerClusterID is the annotation used on the
+// service to tag the load balancer and its security group as owned by another
+// cluster. The cluster ID must be allowed by AllowedOwnerClusterIDs.
+const ServiceAnnotationLoadBalancerOwnerClusterID = "service.beta.kubernetes.io/osc-load-balancer-owner-cluster-id"
+
+// ServiceAnnotationLoadBalancerExtraListeners is the annotation used on the
+// service to declare listeners which are not Service ports, as a comma separated
+// list of "<port>[-<end port>][:<instance port>][/<protocol>]" entries.
+const ServiceAnnotationLoadBalancerExtraListeners = "service.beta.kubernetes.io/osc-load-balancer-extra-listeners"
+
+// ServiceAnnotationLoadBalancerHealthCheckPortName is the annotation used on the service to
+// select the service port, by name, whose NodePort is checked by the TCP health check of the
+// load balancer, instead of the port of its first listener
+const ServiceAnnotationLoadBalancerHealthCheckPortName = "service.beta.kubernetes.io/osc-load-balancer-healthcheck-port-name"
+
+// ServiceAnnotationLoadBalancerBackendPorts is the annotation used on the service to
+// forward the listeners of service ports to other instance ports than their NodePorts, as
+// a comma separated list of "<port name or number>=<instance port>" entries, e.g. for the
+// host ports of a hostNetwork ingress controller.
+const ServiceAnnotationLoadBalancerBackendPorts = "service.beta.kubernetes.io/osc-load-balancer-backend-ports"
+
+// ServiceAnnotationLoadBalancerTargetVMTags is the annotation used on the service to
+// select the backend VMs of the load balancer by tags, as a comma separated list of
+// "<key>=<value>" entries, rather than from the nodes of the cluster.
+const ServiceAnnotationLoadBalancerTargetVMTags = "service.beta.kubernetes.io/osc-load-balancer-target-vm-tags"
+
+// ServiceAnnotationLoadBalancerExternalIPsIngress is the annotation used on the service to
+// open the security groups of the nodes to the spec.externalIPs of the service on its
+// NodePorts, when set to true.
+const ServiceAnnotationLoadBalancerExternalIPsIngress = "service.beta.kubernetes.io/osc-load-balancer-external-ips-ingress"
+
+// ServiceAnnotationLoadBalancerStickinessPolicy is the annotation used on the service to
+// enable the cookie stickiness of the HTTP and HTTPS listeners of the load balancer:
+// lb-cookie for a cookie generated by the load balancer, or app-cookie to follow the cookie
+// of the application.
+const ServiceAnnotationLoadBalancerStickinessPolicy = "service.beta.kubernetes.io/osc-load-balancer-stickiness-policy"
+
+// ServiceAnnotationLoadBalancerStickinessCookieName is the annotation used on the service to
+// specify the name of the cookie of the application followed by the app-cookie stickiness
+// policy.
+const ServiceAnnotationLoadBalancerStickinessCookieName = "service.beta.kubernetes.io/osc-load-balancer-stickiness-cookie-name"
+
+// ServiceAnnotationLoadBalancerStickinessCookieExpiration is the annotation used on the
+// service to specify, in seconds, the lifetime of the cookie of the lb-cookie stickiness
+// policy. The cookie lasts for the browser session when unset.
+const ServiceAnnotationLoadBalancerStickinessCookieExpiration = "service.beta.kubernetes.io/osc-load-balancer-stickiness-cookie-expiration"
+
+// ServiceAnnotationLoadBalancerSecurityGroupMode is the annotation used on the
+// service to choose how the security groups of its load balancer are managed:
+// "managed", "shared" or "none". It overrides the SecurityGroupMode of the cloud config.
+const ServiceAnnotationLoadBalancerSecurityGroupMode = "service.beta.kubernetes.io/osc-load-balancer-security-group-mode"
+
+// ServiceAnnotationLoadBalancerBackendSecurityGroupRules is the annotation used on the
+// service to choose the rules opening the node security groups to its load balancer:
+// "all" protocols and ports, or only the node "ports" of the listeners and the health
+// check. It overrides the BackendSecurityGroupRules of the cloud config.
+const ServiceAnnotationLoadBalancerBackendSecurityGroupRules = "service.beta.kubernetes.io/osc-load-balancer-backend-security-group-rules"
+
+// ServiceAnnotationLoadBalancerPrivateIP is the annotation requesting the private IP
+// of an internal load balancer. LBU assigns the private IPs of the load balancers
+// itself, so the Services setting it are rejected.
+const ServiceAnnotationLoadBalancerPrivateIP = "service.beta.kubernetes.io/osc-load-balancer-private-ip"
+
+// ServiceAnnotationLoadBalancerDrainOnDelete is the annotation used on the
+// service to specify, in seconds, how long the load balancer drains the connections
+// of its backends before being deleted.
+const ServiceAnnotationLoadBalancerDrainOnDelete = "service.beta.kubernetes.io/osc-load-balancer-drain-on-delete"
+
+// ServiceAnnotationLoadBalancerReadyTimeout is the annotation used on the service
+// to specify how long, in seconds, the CCM waits for its load balancer to have a
+// backend in service before reporting it. It overrides LoadBalancerReadyTimeoutSeconds
+// of the cloud config, "0" disabling the wait.
+const ServiceAnnotationLoadBalancerReadyTimeout = "service.beta.kubernetes.io/osc-load-balancer-ready-timeout"
+
+// ServiceAnnotationLoadBalancerIPPool is the annotation used on the service to give
+// its internet-facing load balancer a public IP of a pool, the public IPs tagged
+// with TagNameIPPool and the value of the annotation.
+const ServiceAnnotationLoadBalancerIPPool = "service.beta.kubernetes.io/osc-load-balancer-ip-pool"
+
+// ServiceAnnotationLoadBalancerDryRun is the annotation used on the service to only
+// report, as a DryRun event and in the logs, the changes the CCM would make to its
+// load balancer. It overrides LoadBalancerDryRun of the cloud config.
+const ServiceAnnotationLoadBalancerDryRun = "service.beta.kubernetes.io/osc-load-balancer-dry-run"
+
+// ServiceAnnotationLoadBalancerDeletionProtection is the annotation used on the service
+// to keep its load balancer from being deleted, "true" or "false". The deletion is refused
+// until the annotation is removed.
+const ServiceAnnotationLoadBalancerDeletionProtection = "service.beta.kubernetes.io/osc-load-balancer-deletion-protection"
+
+// ServiceAnnotationLoadBalancerDNSName is the annotation used on the service to register
+// the DNS name of its load balancer as a CNAME record of this name, e.g. api.example.internal,
+// in the hosted zone DNSHostedZoneID of the cloud config. The record is deleted with the
+// load balancer.
+const ServiceAnnotationLoadBalancerDNSName = "service.beta.kubernetes.io/osc-load-balancer-dns-name"
+
+// ServiceAnnotationLoadBalancerProfile is the annotation used on the service to
+// configure its load balancer with a preset ("websocket", "grpc", "http" or "tcp-proxy")
+// of the backend protocol, proxy protocol and idle timeout annotations. The annotations
+// set on the service take precedence over the preset.
+const ServiceAnnotationLoadBalancerProfile = "service.beta.kubernetes.io/osc-load-balancer-profile"
+
+// ServiceAnnotationLoadBalancerDriftDetected is the annotation set by the cloud provider on
+// the service, to the time the out of band modification of its load balancer was detected,
+// which triggers the reconciliation of the service
+const ServiceAnnotationLoadBalancerDriftDetected = "service.beta.kubernetes.io/osc-load-balancer-drift-detected"
+
+// ServiceAnnotationLoadBalancerSourceRangesRef is the annotation used on the service to
+// allow the source ranges listed in a ConfigMap, as "<namespace>/<configmap>" or
+// "<namespace>/<configmap>:<key>" to only allow the named CIDR set of the key. The changes
+// of the ConfigMap are applied to the services referencing it.
+const ServiceAnnotationLoadBalancerSourceRangesRef = "service.beta.kubernetes.io/osc-load-balancer-source-ranges-ref"
+
+// ServiceAnnotationLoadBalancerSourceRangesVersion is the annotation set by the cloud
+// provider on the service, to the resource version of the ConfigMap of its
+// ServiceAnnotationLoadBalancerSourceRangesRef annotation, which triggers the reconciliation
+// of the service when the ConfigMap changes
+const ServiceAnnotationLoadBalancerSourceRangesVersion = "service.beta.kubernetes.io/osc-load-balancer-source-ranges-version"
+
+// ServiceAnnotationLoadBalancerSchemeSwitch is the annotation used on the service to
+// acknowledge that changing ServiceAnnotationLoadBalancerInternal recreates its load balancer,
+// with a new address, "true" or "false". The scheme change is refused without it.
+const ServiceAnnotationLoadBalancerSchemeSwitch = "service.beta.kubernetes.io/osc-load-balancer-scheme-switch"
+
+// ServiceAnnotationLoadBalancerActiveName is the annotation set by the cloud provider on the
+// service to the name of the load balancer recreated by a scheme switch, or rendered from the
+// LoadBalancerNameTemplate, which takes precedence over the name derived from the service
+const ServiceAnnotationLoadBalancerActiveName = "service.beta.kubernetes.io/osc-load-balancer-active-name"
+
+// ServiceAnnotationLoadBalancerPreviousName is the annotation set by the cloud provider on
+// the service to the name of the load balancer replaced by a scheme switch, deleted once the
+// status of the service is the new load balancer
+const ServiceAnnotationLoadBalancerPreviousName = "service.beta.kubernetes.io/osc-load-balancer-previous-name"
+
+// NodeAnnotationLoadBalancers is the annotation set on each node to list the
+// load balancers it is registered to, as a comma-separated list of name=health
+// pairs. For example: "lb-a=InService,lb-b=OutOfService"
+const NodeAnnotationLoadBalancers = "node.osc.outscale.com/load-balancers"
+
+// NodeAnnotationLoadBalancersLegacy is the former name of the NodeAnnotationLoadBalancers
+// annotation, removed from the nodes
+const NodeAnnotationLoadBalancersLegacy = "service.beta.kubernetes.io/osc-load-balancers"
+
+// NodeAnnotationVMTermination is the annotation set on a node whose VM is being
+// stopped or terminated, with the state of the VM. The node is cordoned and drained
+// by the CCM once the annotation is set.
+const NodeAnnotationVMTermination = "service.beta.kubernetes.io/osc-vm-termination"
+
+// LabelSourceRanges is the label of the ConfigMaps of the ServiceAnnotationLoadBalancerSourceRangesRef
+// annotation watched by the CCM, the changes of the other ConfigMaps being applied at the next
+// reconciliation of their services
+const LabelSourceRanges = "service.osc.outscale.com/source-ranges"
+
+// LabelNodeExcludeFromLoadBalancers is the node label excluding the node from the backends
+// of the load balancers, like node.kubernetes.io/exclude-from-external-load-balancers, for
+// dedicated nodes (GPU, ingress-only, storage, ...)
+const LabelNodeExcludeFromLoadBalancers = "service.osc.outscale.com/exclude-from-external-load-balancers"
+
+// LabelTopologyTenancy is the node label carrying the tenancy of the VM of the node,
+// "default" or "dedicated"
+const LabelTopologyTenancy = "topology.osc.outscale.com/tenancy"
+
+// LabelTopologyPlacementGroup is the node label carrying the placement group of the VM of
+// the node, from its TagNamePlacementGroup tag
+const LabelTopologyPlacementGroup = "topology.osc.outscale.com/placement-group"
+
+// TagNamePlacementGroup is the VM tag naming the placement group of the VM, e.g. the
+// dedicated group it was created in, which oAPI doesn't report with the VM
+const TagNamePlacementGroup = "OscK8sPlacementGroup"
+
+// NodeAnnotationTagLabels is the annotation set on a node to list, comma-separated,
+// the keys of the labels set from the tags of its VM. The labels whose tag is removed
+// are removed from the node.
+const NodeAnnotationTagLabels = "service.beta.kubernetes.io/osc-tag-labels"
+
+// PodConditionLoadBalancerReady is the pod condition set by the CCM once the load
+// balancers of the Services selecting the pod report its node as InService. Pods
+// opt in by declaring it in their readinessGates.
+const PodConditionLoadBalancerReady = "service.beta.kubernetes.io/osc-load-balancer-ready"
+
 // LbNameMaxLength the load balancer name max length value.
 const LbNameMaxLength = int64(32)
 
@@ -202,11 +424,108 @@ const MaxReadThenCreateRetries = 30
 // The tag value host name kubernetes.io/hostname
 const TagNameClusterNode = "OscK8sNodeName"
 
+// TagNameNodeAddressPriority is the VM tag giving the priority of its NICs in the node
+// addresses, as the NodeAddressPriority of the cloud config which it takes precedence over
+const TagNameNodeAddressPriority = "OscK8sNodeAddressPriority"
+
+// TagNameNodeAddressExcludedNics is the VM tag listing the NICs whose private IPs are not
+// reported in its node addresses, as the NodeAddressExcludedNics of the cloud config
+const TagNameNodeAddressExcludedNics = "OscK8sNodeAddressExcludedNics"
+
+// TagNameNodePortNic is the VM tag selecting the NIC carrying the NodePort traffic, whose
+// security group is opened to the load balancers, as the NodePortNic of the cloud config
+const TagNameNodePortNic = "OscK8sNodePortNic"
+
 // TagNameMainSG The main sg Tag
 // The tag key = OscK8sMainSG/clusterId
 // The tag value = True
 const TagNameMainSG = "OscK8sMainSG/"
 
+// TagNameResourceNamePrefix is the tag carrying the ResourceNamePrefix of the cluster
+// on the resources created by the cloud provider
+const TagNameResourceNamePrefix = "OscK8sNamePrefix"
+
+// TagNameManagedBy is the tag carrying the cluster ID of the cluster reconciling a
+// resource owned by another cluster (see ServiceAnnotationLoadBalancerOwnerClusterID)
+const TagNameManagedBy = "OscK8sManagedBy"
+
+// TagNameSecurityGroupDeletion is the tag of the load balancer security groups which
+// couldn't be deleted with their load balancer, giving when the deletion was requested. They
+// are deleted in the background, see securityGroupGC
+const TagNameSecurityGroupDeletion = "OscK8sToDelete"
+
+// TagNameResumeHint is the tag of the load balancers whose reconciliation was interrupted by
+// the shutdown of the CCM, giving the phase of the reconciliation. It is removed once the
+// reconciliation is completed, see shutdownManager
+const TagNameResumeHint = "OscK8sResumeHint"
+
+// LoadBalancerCleanupFinalizer is the finalizer set on the services with a load balancer,
+// removed once the load balancer and its security groups are deleted
+const LoadBalancerCleanupFinalizer = "osc.outscale.com/lb-cleanup"
+
+// DefaultLoadBalancerClass is the spec.loadBalancerClass of the Services reconciled by the
+// cloud provider besides those without class, unless LoadBalancerClass is set in the cloud config
+const DefaultLoadBalancerClass = "service.k8s.outscale.com/lbu"
+
+// TagNameRuleMarkersPrefix is the prefix of the security group tags marking the ingress rules
+// created by the cloud provider, see securityGroupRuleOwnership
+const TagNameRuleMarkersPrefix = "OscK8sRules/"
+
+// TagNameRulePrefix is the prefix of the legacy security group tags marking a single ingress
+// rule created by the cloud provider, replaced by the TagNameRuleMarkersPrefix tags
+const TagNameRulePrefix = "OscK8sRule/"
+
+// TagNameExternalIPRulesPrefix is the prefix of the node security group tags marking the
+// ingress rules opened to the external IPs of a service, see ensureExternalIPsIngress
+const TagNameExternalIPRulesPrefix = "OscK8sExternalIPRules/"
+
+// TagNameExternalIPRulePrefix is the prefix of the legacy node security group tags marking a
+// single ingress rule opened to the external IPs of a service, replaced by the
+// TagNameExternalIPRulesPrefix tags
+const TagNameExternalIPRulePrefix = "OscK8sExternalIPRule/"
+
+// TagNamePeeredRulesPrefix is the prefix of the node security group tags marking the ingress
+// rules opened to the subnets of a load balancer in a peered Net, see ensurePeeredBackendIngress
+const TagNamePeeredRulesPrefix = "OscK8sPeeredRules/"
+
+// TagNamePeeredRulePrefix is the prefix of the legacy node security group tags marking a
+// single ingress rule opened to the subnets of a load balancer in a peered Net, replaced by
+// the TagNamePeeredRulesPrefix tags
+const TagNamePeeredRulePrefix = "OscK8sPeeredRule/"
+
+// TagNameAdditionalTags is the tag of a load balancer listing, comma-separated, the keys of
+// the tags set from the ServiceAnnotationLoadBalancerAdditionalTags annotation, so that the
+// tags removed from the annotation are removed from the load balancer
+const TagNameAdditionalTags = "OscK8sAdditionalTags"
+
+// TagNameDNSName is the tag of a load balancer giving the name of the DNS record pointing
+// to it, see ServiceAnnotationLoadBalancerDNSName
+const TagNameDNSName = "OscK8sDNSName"
+
+// TagNameIPPool is the tag of the public IPs giving the pool they belong to, see
+// ServiceAnnotationLoadBalancerIPPool
+const TagNameIPPool = "OscK8sIpPool"
+
+// TagNamePodCIDR is the tag of the VMs giving the pod CIDR allocated to their node from the
+// PodCIDRPool, see PodCIDRAllocationStore
+const TagNamePodCIDR = "OscK8sPodCIDR"
+
+// TagNameSecurityGroupPool is the tag of the security groups of the warm pool waiting to be
+// leased, see SecurityGroupPoolSize
+const TagNameSecurityGroupPool = "OscK8sSecurityGroupPool"
+
+// TagNameSecurityGroupLease is the tag of the security groups leased from the warm pool
+// giving the name of the load balancer security group they stand for
+const TagNameSecurityGroupLease = "OscK8sSecurityGroupLease"
+
+// TagNameSecurityGroupSelected is the tag of the pre-existing security groups selected with
+// ServiceAnnotationLoadBalancerSecurityGroupSelector, never deleted by the CCM
+const TagNameSecurityGroupSelected = "OscK8sSelectedSecurityGroup"
+
+// ResourceNamePrefixMaxLength is the maximum length of the ResourceNamePrefix, so that
+// the generated load balancer names keep enough of the Service UID to remain unique
+const ResourceNamePrefixMaxLength = 16
+
 // DefaultSrcSgName default SG Name used when creating LB Public Cloud
 const DefaultSrcSgName = "outscale-elb-sg"
 
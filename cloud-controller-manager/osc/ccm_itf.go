@@ -22,5 +22,7 @@ package osc
 type Services interface {
 	Compute(region string) (Compute, error)
 	LoadBalancing(region string) (LoadBalancer, error)
+	ObjectStorage(region string) (ObjectStorage, error)
+	DNS(region string) (DNS, error)
 	Metadata() (EC2Metadata, error)
 }
@@ -0,0 +1,70 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+
+	"github.com/outscale-dev/cloud-provider-osc/cloud-controller-manager/utils"
+)
+
+// ********************* CCM Kubernetes Compatibility *********************
+
+const (
+	// MinSupportedKubernetesVersion is the oldest Kubernetes minor version tested with this release
+	MinSupportedKubernetesVersion = "1.20"
+	// MaxSupportedKubernetesVersion is the newest Kubernetes minor version tested with this release
+	MaxSupportedKubernetesVersion = "1.26"
+)
+
+// CheckKubernetesVersion compares the API server version against the versions supported
+// by this release. It returns an error when the server is running an untested version.
+func CheckKubernetesVersion(client discovery.ServerVersionInterface) error {
+	info, err := client.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve Kubernetes server version: %v", err)
+	}
+	return checkKubernetesVersion(info.GitVersion)
+}
+
+func checkKubernetesVersion(serverVersion string) error {
+	server, err := version.ParseGeneric(serverVersion)
+	if err != nil {
+		return fmt.Errorf("unable to parse Kubernetes server version %q: %v", serverVersion, err)
+	}
+	minVersion := version.MustParseGeneric(MinSupportedKubernetesVersion)
+	maxVersion := version.MustParseGeneric(MaxSupportedKubernetesVersion)
+
+	// Only compare major.minor, patch releases are always supported
+	serverMinor := version.MustParseGeneric(fmt.Sprintf("%d.%d", server.Major(), server.Minor()))
+	if serverMinor.LessThan(minVersion) || maxVersion.LessThan(serverMinor) {
+		klog.InfoS("Kubernetes version is not supported by this cloud controller manager release",
+			"serverVersion", serverVersion,
+			"ccmVersion", utils.GetVersion(),
+			"minSupportedVersion", MinSupportedKubernetesVersion,
+			"maxSupportedVersion", MaxSupportedKubernetesVersion)
+		return fmt.Errorf("Kubernetes version %s is outside of the supported range [%s, %s]",
+			serverVersion, MinSupportedKubernetesVersion, MaxSupportedKubernetesVersion)
+	}
+
+	klog.V(2).InfoS("Kubernetes version is supported", "serverVersion", serverVersion, "ccmVersion", utils.GetVersion())
+	return nil
+}
@@ -46,17 +46,17 @@ type InstanceID string
 // the following form
 //   - aws:///<zone>/<awsInstanceId>
 //   - aws:////<awsInstanceId>
+//   - osc://<zone>/<awsInstanceId>
 //   - <awsInstanceId>
 type KubernetesInstanceID string
 
 // MapToAWSInstanceID extracts the InstanceID from the KubernetesInstanceID
 func (name KubernetesInstanceID) MapToAWSInstanceID() (InstanceID, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("MapToAWSInstanceID(%v)", name)
 
 	s := string(name)
 
-	if !strings.HasPrefix(s, "aws://") {
+	if !isProviderID(s) {
 		// Assume a bare aws volume id (vol-1234...)
 		// Build a URL with an empty host (AZ)
 		s = "aws://" + "/" + "/" + s
@@ -65,12 +65,16 @@ func (name KubernetesInstanceID) MapToAWSInstanceID() (InstanceID, error) {
 	if err != nil {
 		return "", fmt.Errorf("Invalid instance name (%s): %v", name, err)
 	}
-	if url.Scheme != "aws" {
+	if url.Scheme != ProviderIDSchemeAWS && url.Scheme != ProviderIDSchemeOsc {
 		return "", fmt.Errorf("Invalid scheme for AWS instance (%s)", name)
 	}
 
 	awsID := ""
 	tokens := strings.Split(strings.Trim(url.Path, "/"), "/")
+	if url.Host != "" {
+		// osc://az/instanceId
+		tokens = append([]string{url.Host}, tokens...)
+	}
 	if len(tokens) == 1 {
 		// instanceId
 		awsID = tokens[0]
@@ -161,7 +165,7 @@ func (c *instanceCache) describeAllInstancesUncached() (*allInstancesSnapshot, e
 	klog.V(4).Infof("EC2 DescribeInstances - fetching all instances")
 
 	var filters *osc.FiltersVm
-	instances, err := c.cloud.describeInstances(filters)
+	instances, err := c.cloud.instanceService.describeInstances(filters)
 	if err != nil {
 		return nil, err
 	}
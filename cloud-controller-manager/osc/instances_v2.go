@@ -16,52 +16,96 @@ package osc
 import (
 	"context"
 	"errors"
-	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	"k8s.io/klog/v2"
 
 	"github.com/outscale/osc-sdk-go/v2"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	cloudprovider "k8s.io/cloud-provider"
 )
 
 // newInstances returns an implementation of cloudprovider.InstancesV2
-func newInstancesV2(az string, tagging *resourceTagging) (cloudprovider.InstancesV2, error) {
+func newInstancesV2(az string, tagging *resourceTagging, nodeIPFamilies []v1.IPFamily, addressPriority *nodeAddressPriority,
+	cacheTTL time.Duration, metadataCache *instanceMetadataCache, tagLabels *nodeTagLabels,
+	topologyLabels *nodeTopologyLabels, providerIDScheme string, nodeNames *nodeNameStrategy,
+	secondaryRegions []secondaryRegion, httpClient *http.Client, signed bool) (cloudprovider.InstancesV2, error) {
 
 	region, err := azToRegion(az)
 	if err != nil {
 		return nil, err
 	}
-	ctx, client, err := NewOscClient(region)
-	if err != nil {
-		return nil, err
+	endpoints := make([]*vmEndpoint, 0, len(secondaryRegions)+1)
+	for order, r := range append([]secondaryRegion{{region: region}}, secondaryRegions...) {
+		endpoint, err := newVMEndpoint(r, order, httpClient, signed)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
 	}
-	return &instancesV2{
+	i := &instancesV2{
 		availabilityZone: az,
 		region:           region,
-		client:           client,
-		ctx:              ctx,
+		endpoints:        endpoints,
 		tags:             tagging,
-	}, nil
+		nodeIPFamilies:   nodeIPFamilies,
+		addressPriority:  addressPriority,
+		metadataCache:    metadataCache,
+		tagLabels:        tagLabels,
+		topologyLabels:   topologyLabels,
+		providerIDScheme: providerIDScheme,
+		nodeNames:        nodeNames,
+	}
+	if cacheTTL > 0 {
+		i.cache = newVMCache(cacheTTL, i.readVmsByID)
+	}
+	return i, nil
 }
 
 // instances is an implementation of cloudprovider.InstancesV2
 type instancesV2 struct {
 	availabilityZone string
-	client           *osc.APIClient
-	ctx              context.Context
 	region           string
 	tags             *resourceTagging
+	nodeIPFamilies   []v1.IPFamily
+	addressPriority  *nodeAddressPriority
+
+	// oAPI endpoints where the VMs are looked up, in this order: the region of the CCM then
+	// the SecondaryRegions
+	endpoints []*vmEndpoint
+
+	// Shared cache of the VMs looked up by provider ID, nil when disabled
+	cache *vmCache
+
+	// Caches the immutable metadata of the instances for the lifetime of their node
+	metadataCache *instanceMetadataCache
+
+	// Labels the nodes from the tags of their VM, nil when disabled
+	tagLabels *nodeTagLabels
+
+	// Labels the nodes with the tenancy and placement group of their VM
+	topologyLabels *nodeTopologyLabels
+
+	// Scheme of the provider IDs of the new nodes, see ProviderIDScheme
+	providerIDScheme string
+
+	// Derives the names of the nodes from their VM, see NodeNameStrategy
+	nodeNames *nodeNameStrategy
 }
 
 // InstanceExists indicates whether a given node exists according to the cloud provider
 func (i *instancesV2) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
+	ctx = klog.NewContext(ctx, nodeLogger(ctx, node))
 	_, err := i.getInstance(ctx, node)
 
 	if err == cloudprovider.InstanceNotFound {
-		klog.V(6).Infof("instance not found for node: %s", node.Name)
+		klog.FromContext(ctx).V(6).Info("Instance not found")
+		i.metadataCache.forget(node.Spec.ProviderID)
 		return false, nil
 	}
 
@@ -74,6 +118,7 @@ func (i *instancesV2) InstanceExists(ctx context.Context, node *v1.Node) (bool,
 
 // InstanceShutdown returns true if the instance is shutdown according to the cloud provider.
 func (i *instancesV2) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
+	ctx = klog.NewContext(ctx, nodeLogger(ctx, node))
 	ec2Instance, err := i.getInstance(ctx, node)
 	if err != nil {
 		return false, err
@@ -94,6 +139,12 @@ func (i *instancesV2) InstanceShutdown(ctx context.Context, node *v1.Node) (bool
 func (i *instancesV2) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
 	var err error
 	var oscInstance *osc.Vm
+	logger := nodeLogger(ctx, node)
+	ctx = klog.NewContext(ctx, logger)
+
+	// The VM is still read for the node addresses and the labels, which may change, the
+	// metadata cached for the node being looked up first
+	cached, found := i.metadataCache.getForNode(node)
 
 	//  TODO: support node name policy other than private DNS names
 	oscInstance, err = i.getInstance(ctx, node)
@@ -101,42 +152,93 @@ func (i *instancesV2) InstanceMetadata(ctx context.Context, node *v1.Node) (*clo
 		return nil, err
 	}
 
-	nodeAddresses, err := extractNodeAddresses(oscInstance)
+	nodeAddresses, err := extractNodeAddresses(oscInstance, i.addressPriority)
 	if err != nil {
 		return nil, err
 	}
+	nodeAddresses = sortNodeAddressesByIPFamily(nodeAddresses, i.nodeIPFamilies)
 
-	providerID, err := getInstanceProviderIDV2(oscInstance)
+	providerID, err := getInstanceProviderIDV2(oscInstance, i.providerIDScheme)
 	if err != nil {
 		return nil, err
 	}
+	// The provider ID of a node can't change: the nodes registered with the legacy scheme
+	// keep it until they are migrated
+	if isProviderID(node.Spec.ProviderID) {
+		providerID = node.Spec.ProviderID
+	}
 
-	zone := oscInstance.Placement.GetSubregionName()
-	region, err := azToRegion(zone)
-	if err != nil {
-		return nil, err
+	if !found {
+		zone := oscInstance.Placement.GetSubregionName()
+		region, err := azToRegion(zone)
+		if err != nil {
+			return nil, err
+		}
+		cached = instanceMetadata{
+			nodeUID:      node.UID,
+			instanceType: oscInstance.GetVmType(),
+			zone:         zone,
+			region:       region,
+		}
+		i.metadataCache.set(providerID, cached)
 	}
 
 	metadata := &cloudprovider.InstanceMetadata{
 		ProviderID:    providerID,
-		InstanceType:  oscInstance.GetVmType(),
+		InstanceType:  cached.instanceType,
 		NodeAddresses: nodeAddresses,
-		Zone:          zone,
-		Region:        region,
+		Zone:          cached.zone,
+		Region:        cached.region,
 	}
 
-	klog.Warningf("InstanceMetadata is %+v", metadata)
+	if err := i.tagLabels.sync(ctx, node, oscInstance.GetTags()); err != nil {
+		logger.Error(err, "Unable to label node from the tags of its VM")
+	}
+	if err := i.topologyLabels.sync(ctx, node, oscInstance); err != nil {
+		logger.Error(err, "Unable to set the topology labels of node")
+	}
+
+	logger.V(4).Info("Instance metadata", "providerID", metadata.ProviderID, "instanceType", metadata.InstanceType,
+		"zone", metadata.Zone, "region", metadata.Region, "addresses", metadata.NodeAddresses)
 	return metadata, nil
 }
 
 // getInstance returns the instance if the instance with the given node info still exists.
 // If false an error will be returned, the instance will be immediately deleted by the cloud controller manager.
 func (i *instancesV2) getInstance(ctx context.Context, node *v1.Node) (*osc.Vm, error) {
+	if i.cache != nil && node.Spec.ProviderID != "" {
+		return i.getCachedInstance(ctx, node)
+	}
+
+	// The instance is only reported as not found when no endpoint failed
+	var lookupErr error
+	for _, endpoint := range i.endpoints {
+		instance, err := i.getInstanceFrom(ctx, endpoint, node)
+		if endpoint.order > 0 {
+			recordInstanceFallbackMetric(endpoint.region, instance != nil, ignoreInstanceNotFound(err))
+		}
+		if err == nil {
+			return instance, nil
+		}
+		if err != cloudprovider.InstanceNotFound {
+			klog.FromContext(ctx).V(3).Info("Unable to look up the VM", "region", endpoint.region, "err", err)
+			lookupErr = err
+		}
+	}
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	return nil, cloudprovider.InstanceNotFound
+}
+
+// getInstanceFrom returns the instance of the node from the given endpoint
+func (i *instancesV2) getInstanceFrom(ctx context.Context, endpoint *vmEndpoint, node *v1.Node) (*osc.Vm, error) {
+	logger := klog.FromContext(ctx).WithValues("region", endpoint.region)
 	var request *osc.ReadVmsRequest
 	if node.Spec.ProviderID == "" {
-		// get Instance by private DNS name
+		// get Instance by node name
 		request = &osc.ReadVmsRequest{}
-		klog.V(4).Infof("looking for node by private DNS name %v", node.Name)
+		logger.V(4).Info("Looking for the VM by node name")
 	} else {
 		// get Instance by provider ID
 		instanceID, err := parseInstanceIDFromProviderIDV2(node.Spec.ProviderID)
@@ -149,56 +251,31 @@ func (i *instancesV2) getInstance(ctx context.Context, node *v1.Node) (*osc.Vm,
 				VmIds: &[]string{instanceID},
 			},
 		}
-		klog.V(4).Infof("looking for node by provider ID %v", node.Spec.ProviderID)
+		logger.V(4).Info("Looking for the VM by provider ID", "providerID", node.Spec.ProviderID)
 	}
 
 	// Add cluster tagging to reduce the search and possible collisions
 	if request.Filters == nil {
 		request.Filters = &osc.FiltersVm{}
 	}
-	request.Filters.TagKeys = &[]string{i.tags.clusterTagKey()}
-
-	response, httpRes, err := i.client.VmApi.ReadVms(i.ctx).ReadVmsRequest(*request).Execute()
-	klog.V(4).Infof("Get Response from Describe Instances  %v", response)
+	request.Filters.TagKeys = i.tags.clusterTagKeysFilter()
 
+	vms, err := endpoint.readVms(request)
 	if err != nil {
-		if httpRes != nil {
-			return nil, fmt.Errorf("error describing ec2 instances: %v (Status:%v)", err, httpRes.Status)
-		}
-		return nil, fmt.Errorf("error describing ec2 instances: %v", err)
-	}
-
-	if !response.HasVms() {
-		return nil, fmt.Errorf("error describing ec2 instances: %v", err)
+		return nil, err
 	}
 
 	instances := []osc.Vm{}
 
 	if node.Spec.ProviderID == "" {
-		// Match NodeName with the privateDNS
-		for _, instance := range response.GetVms() {
-			if instance.GetPrivateDnsName() == node.Name {
+		// Match NodeName with the name derived from the VM or its TagNameClusterNode tag
+		for _, instance := range vms {
+			if i.nodeNames.matches(&instance, types.NodeName(node.Name)) {
 				instances = append(instances, instance)
 			}
 		}
-		// Fallback to NodeName
-		if len(instances) == 0 {
-			klog.V(4).Infof("looking for node by tag %v", TagNameClusterNode)
-			for _, instance := range response.GetVms() {
-				tags, ok := instance.GetTagsOk()
-				if !ok {
-					continue
-				}
-
-				for _, tag := range *tags {
-					if tag.GetKey() == TagNameClusterNode && tag.GetValue() == node.Name {
-						instances = append(instances, instance)
-					}
-				}
-			}
-		}
 	} else {
-		instances = response.GetVms()
+		instances = vms
 	}
 
 	if len(instances) == 0 {
@@ -217,10 +294,74 @@ func (i *instancesV2) getInstance(ctx context.Context, node *v1.Node) (*osc.Vm,
 	return &instances[0], nil
 }
 
+// getCachedInstance returns the instance of the node from the shared VM cache
+func (i *instancesV2) getCachedInstance(ctx context.Context, node *v1.Node) (*osc.Vm, error) {
+	instanceID, err := parseInstanceIDFromProviderIDV2(node.Spec.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	klog.FromContext(ctx).V(4).Info("Looking for the VM by provider ID in the VM cache", "providerID", node.Spec.ProviderID)
+
+	instance, err := i.cache.get(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	if instance == nil || instance.GetState() == "terminated" {
+		return nil, cloudprovider.InstanceNotFound
+	}
+	return instance, nil
+}
+
+// readVmsByID returns the VMs of the cluster with the given ids, the VMs not found in the
+// region of the CCM being looked up in the SecondaryRegions
+func (i *instancesV2) readVmsByID(ids []string) ([]osc.Vm, error) {
+	var vms []osc.Vm
+	var lookupErr error
+	missing := sets.NewString(ids...)
+	for _, endpoint := range i.endpoints {
+		if missing.Len() == 0 {
+			break
+		}
+		pending := missing.List()
+		found, err := endpoint.readVms(&osc.ReadVmsRequest{
+			Filters: &osc.FiltersVm{
+				VmIds:   &pending,
+				TagKeys: i.tags.clusterTagKeysFilter(),
+			},
+		})
+		if endpoint.order > 0 {
+			recordInstanceFallbackMetric(endpoint.region, len(found) > 0, err)
+		}
+		if err != nil {
+			klog.V(3).InfoS("Unable to look up the VMs", "region", endpoint.region, "err", err)
+			lookupErr = err
+			continue
+		}
+		for _, vm := range found {
+			missing.Delete(vm.GetVmId())
+		}
+		vms = append(vms, found...)
+	}
+	// The missing VMs may exist in a failing endpoint
+	if lookupErr != nil && missing.Len() > 0 {
+		return nil, lookupErr
+	}
+	return vms, nil
+}
+
+// ignoreInstanceNotFound returns the error unless it is cloudprovider.InstanceNotFound
+func ignoreInstanceNotFound(err error) error {
+	if err == cloudprovider.InstanceNotFound {
+		return nil
+	}
+	return err
+}
+
 // getInstanceProviderID returns the provider ID of an instance which is ultimately set in the node.Spec.ProviderID field.
-// The well-known format for a node's providerID is:
+// The well-known formats for a node's providerID are:
 //   - aws:///<availability-zone>/<instance-id>
-func getInstanceProviderIDV2(instance *osc.Vm) (string, error) {
+//   - osc://<availability-zone>/<instance-id>, with the osc ProviderIDScheme
+func getInstanceProviderIDV2(instance *osc.Vm, scheme string) (string, error) {
 	if instance.Placement.GetSubregionName() == "" {
 		return "", errors.New("instance availability zone was not set")
 	}
@@ -229,13 +370,13 @@ func getInstanceProviderIDV2(instance *osc.Vm) (string, error) {
 		return "", errors.New("instance ID was not set")
 	}
 
-	// TODO: Check the impact of changing this ?
-	return "aws:///" + instance.Placement.GetSubregionName() + "/" + instance.GetVmId(), nil
+	return buildProviderID(scheme, instance.Placement.GetSubregionName(), instance.GetVmId()), nil
 }
 
 // parseInstanceIDFromProviderID parses the node's instance ID based on the following formats:
 //   - aws://<availability-zone>/<instance-id>
 //   - aws:///<instance-id>
+//   - osc://<availability-zone>/<instance-id>
 //   - <instance-id>
 //
 // This function always assumes a valid providerID format was provided.
@@ -245,7 +386,7 @@ func parseInstanceIDFromProviderIDV2(providerID string) (string, error) {
 	// * /<availability-zone>/<instance-id>
 	// * <instance-id>
 	instanceID := ""
-	metadata := strings.Split(strings.TrimPrefix(providerID, "aws://"), "/")
+	metadata := strings.Split(strings.TrimPrefix(strings.TrimPrefix(providerID, "aws://"), "osc://"), "/")
 	if len(metadata) == 1 {
 		// instance-id
 		instanceID = metadata[0]
@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// vmBatchWindow is how long lookups of uncached VMs are collected before a single
+// ReadVms request is issued for all of them
+const vmBatchWindow = 50 * time.Millisecond
+
+// vmCache is a TTL cache of VMs shared by the InstancesV2 calls. Lookups of uncached
+// VMs received within vmBatchWindow are coalesced into a single ReadVms request.
+type vmCache struct {
+	ttl   time.Duration
+	fetch func(ids []string) ([]osc.Vm, error)
+
+	mutex   sync.Mutex
+	entries map[string]vmCacheEntry
+	pending *vmBatch
+}
+
+// vmCacheEntry is a cached VM along with its retrieval time
+type vmCacheEntry struct {
+	vm        *osc.Vm
+	fetchedAt time.Time
+}
+
+// vmBatch collects the VM ids of a pending ReadVms request
+type vmBatch struct {
+	ids  sets.String
+	done chan struct{}
+
+	vms map[string]*osc.Vm
+	err error
+}
+
+func newVMCache(ttl time.Duration, fetch func(ids []string) ([]osc.Vm, error)) *vmCache {
+	return &vmCache{
+		ttl:     ttl,
+		fetch:   fetch,
+		entries: make(map[string]vmCacheEntry),
+	}
+}
+
+// get returns the VM with the given id, or nil when it does not exist
+func (c *vmCache) get(id string) (*osc.Vm, error) {
+	c.mutex.Lock()
+	if entry, found := c.entries[id]; found && time.Since(entry.fetchedAt) < c.ttl {
+		c.mutex.Unlock()
+		recordInstanceCacheMetric(true)
+		return entry.vm, nil
+	}
+	recordInstanceCacheMetric(false)
+
+	batch := c.pending
+	if batch == nil {
+		batch = &vmBatch{ids: sets.NewString(), done: make(chan struct{})}
+		c.pending = batch
+		time.AfterFunc(vmBatchWindow, c.flush)
+	}
+	batch.ids.Insert(id)
+	c.mutex.Unlock()
+
+	<-batch.done
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	return batch.vms[id], nil
+}
+
+// flush issues the ReadVms request of the pending batch and caches its result
+func (c *vmCache) flush() {
+	c.mutex.Lock()
+	batch := c.pending
+	c.pending = nil
+	c.mutex.Unlock()
+	if batch == nil {
+		return
+	}
+
+	klog.V(4).Infof("Reading %d VMs in a single request", batch.ids.Len())
+	vms, err := c.fetch(batch.ids.List())
+	batch.vms = make(map[string]*osc.Vm)
+	batch.err = err
+	if err == nil {
+		now := time.Now()
+		c.mutex.Lock()
+		// Drop expired entries, their VMs may have been deleted since
+		for id, entry := range c.entries {
+			if now.Sub(entry.fetchedAt) >= c.ttl {
+				delete(c.entries, id)
+			}
+		}
+		for i := range vms {
+			vm := &vms[i]
+			batch.vms[vm.GetVmId()] = vm
+			c.entries[vm.GetVmId()] = vmCacheEntry{vm: vm, fetchedAt: now}
+		}
+		c.mutex.Unlock()
+	}
+	close(batch.done)
+}
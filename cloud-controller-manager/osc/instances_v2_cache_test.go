@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedVMFetches struct {
+	mutex sync.Mutex
+	calls [][]string
+	err   error
+}
+
+func (r *recordedVMFetches) fetch(ids []string) ([]osc.Vm, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, ids)
+	if r.err != nil {
+		return nil, r.err
+	}
+	vms := []osc.Vm{}
+	for _, id := range ids {
+		if id != "i-missing" {
+			vms = append(vms, osc.Vm{VmId: aws.String(id)})
+		}
+	}
+	return vms, nil
+}
+
+func TestVMCacheCoalescesLookups(t *testing.T) {
+	recorder := &recordedVMFetches{}
+	cache := newVMCache(time.Minute, recorder.fetch)
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"i-1", "i-2", "i-3", "i-missing"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			vm, err := cache.get(id)
+			assert.NoError(t, err)
+			if id == "i-missing" {
+				assert.Nil(t, vm)
+			} else if assert.NotNil(t, vm) {
+				assert.Equal(t, id, vm.GetVmId())
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	assert.Len(t, recorder.calls, 1, "concurrent lookups should be coalesced")
+	assert.ElementsMatch(t, []string{"i-1", "i-2", "i-3", "i-missing"}, recorder.calls[0])
+
+	vm, err := cache.get("i-2")
+	assert.NoError(t, err)
+	assert.Equal(t, "i-2", vm.GetVmId())
+	assert.Len(t, recorder.calls, 1, "cached VMs should not be read again")
+}
+
+func TestVMCacheExpiryAndErrors(t *testing.T) {
+	recorder := &recordedVMFetches{}
+	cache := newVMCache(time.Millisecond, recorder.fetch)
+
+	_, err := cache.get("i-1")
+	assert.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = cache.get("i-1")
+	assert.NoError(t, err)
+	assert.Len(t, recorder.calls, 2, "expired VMs should be read again")
+
+	recorder.err = errors.New("boom")
+	time.Sleep(5 * time.Millisecond)
+	_, err = cache.get("i-1")
+	assert.Error(t, err)
+}
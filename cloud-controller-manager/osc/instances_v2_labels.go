@@ -0,0 +1,188 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Node Labels from VM Tags *********************
+
+// nodeTagLabels translates the VM tags starting with tagPrefix into node labels
+type nodeTagLabels struct {
+	tagPrefix string
+	// Prefixes of the label keys which are propagated, all when empty
+	allowed []string
+	// Prefixes of the label keys which are never propagated
+	denied []string
+
+	// Set once the cloud is initialized
+	kubeClient clientset.Interface
+}
+
+// newNodeTagLabels returns the translation of the VM tags, nil when tagPrefix is empty
+func newNodeTagLabels(tagPrefix string, allowed string, denied string) *nodeTagLabels {
+	if tagPrefix == "" {
+		return nil
+	}
+	return &nodeTagLabels{
+		tagPrefix: tagPrefix,
+		allowed:   splitPrefixes(allowed),
+		denied:    splitPrefixes(denied),
+	}
+}
+
+func splitPrefixes(value string) []string {
+	prefixes := []string{}
+	for _, prefix := range strings.Split(value, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// reservedLabelDomains are the domains of the label keys reserved for Kubernetes, with their
+// subdomains such as node-role.kubernetes.io
+var reservedLabelDomains = []string{"kubernetes.io", "k8s.io"}
+
+// isReservedLabelKey returns whether the prefix of the label key is a reserved domain
+func isReservedLabelKey(key string) bool {
+	domain, _, found := strings.Cut(key, "/")
+	if !found {
+		return false
+	}
+	for _, reserved := range reservedLabelDomains {
+		if domain == reserved || strings.HasSuffix(domain, "."+reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// setClient sets the client used to label the nodes
+func (l *nodeTagLabels) setClient(kubeClient clientset.Interface) {
+	if l != nil {
+		l.kubeClient = kubeClient
+	}
+}
+
+// labels returns the node labels of the VM tags
+func (l *nodeTagLabels) labels(tags []osc.ResourceTag) map[string]string {
+	labels := make(map[string]string)
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag.GetKey(), l.tagPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(tag.GetKey(), l.tagPrefix)
+		if key == "" {
+			continue
+		}
+		if (len(l.allowed) > 0 && !hasAnyPrefix(key, l.allowed)) || hasAnyPrefix(key, l.denied) {
+			continue
+		}
+		// The reserved labels are only set when explicitly allowed
+		if isReservedLabelKey(key) && !hasAnyPrefix(key, l.allowed) {
+			klog.V(4).Infof("Ignoring tag %s: reserved label key", tag.GetKey())
+			continue
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			klog.Warningf("Ignoring tag %s: invalid label key: %v", tag.GetKey(), errs)
+			continue
+		}
+		if errs := validation.IsValidLabelValue(tag.GetValue()); len(errs) > 0 {
+			klog.Warningf("Ignoring tag %s: invalid label value: %v", tag.GetKey(), errs)
+			continue
+		}
+		labels[key] = tag.GetValue()
+	}
+	return labels
+}
+
+// sync sets the labels of the VM tags on the node, and removes the labels previously set
+// whose tag was removed. The keys of the labels set are recorded in the
+// NodeAnnotationTagLabels annotation.
+func (l *nodeTagLabels) sync(ctx context.Context, node *v1.Node, tags []osc.ResourceTag) error {
+	if l == nil || l.kubeClient == nil {
+		return nil
+	}
+	klog.V(5).Infof("nodeTagLabels.sync(%v,%v)", node.Name, tags)
+
+	labels := l.labels(tags)
+	keys := make([]string, 0, len(labels))
+	patchLabels := make(map[string]interface{})
+	for key, value := range labels {
+		keys = append(keys, key)
+		if current, found := node.Labels[key]; !found || current != value {
+			patchLabels[key] = value
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range splitPrefixes(node.Annotations[NodeAnnotationTagLabels]) {
+		if _, found := labels[key]; !found {
+			if _, labeled := node.Labels[key]; labeled {
+				patchLabels[key] = nil
+			}
+		}
+	}
+	patchAnnotations := make(map[string]interface{})
+	managed := strings.Join(keys, ",")
+	if node.Annotations[NodeAnnotationTagLabels] != managed {
+		if managed == "" {
+			patchAnnotations[NodeAnnotationTagLabels] = nil
+		} else {
+			patchAnnotations[NodeAnnotationTagLabels] = managed
+		}
+	}
+	if len(patchLabels) == 0 && len(patchAnnotations) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      patchLabels,
+			"annotations": patchAnnotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("Updating the labels of node %s from the tags of its VM: %s", node.Name, patch)
+	_, err = l.kubeClient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeTagLabels(t *testing.T) {
+	assert.Nil(t, newNodeTagLabels("", "", ""))
+
+	tagLabels := newNodeTagLabels("osc.node.label/", "", "kubernetes.io/, node-role")
+	tags := []osc.ResourceTag{
+		{Key: "osc.node.label/team", Value: "web"},
+		{Key: "osc.node.label/example.com/tier", Value: "front"},
+		{Key: "osc.node.label/kubernetes.io/hostname", Value: "other"},
+		{Key: "osc.node.label/node-role.kubernetes.io/master", Value: ""},
+		{Key: "osc.node.label/invalid key", Value: "value"},
+		{Key: "osc.node.label/description", Value: "not a label value"},
+		{Key: "Name", Value: "node-1"},
+	}
+	assert.Equal(t, map[string]string{"team": "web", "example.com/tier": "front"}, tagLabels.labels(tags))
+
+	tagLabels = newNodeTagLabels("osc.node.label/", "example.com/", "")
+	assert.Equal(t, map[string]string{"example.com/tier": "front"}, tagLabels.labels(tags))
+
+	// The reserved labels are ignored unless explicitly allowed
+	tags = []osc.ResourceTag{
+		{Key: "osc.node.label/team", Value: "web"},
+		{Key: "osc.node.label/kubernetes.io/hostname", Value: "other"},
+		{Key: "osc.node.label/node-role.kubernetes.io/worker", Value: ""},
+		{Key: "osc.node.label/k8s.io/role", Value: "web"},
+		{Key: "osc.node.label/topology.k8s.io/zone", Value: "eu-west-2a"},
+		{Key: "osc.node.label/notkubernetes.io/role", Value: "web"},
+	}
+	tagLabels = newNodeTagLabels("osc.node.label/", "", "")
+	assert.Equal(t, map[string]string{"team": "web", "notkubernetes.io/role": "web"}, tagLabels.labels(tags))
+	tagLabels = newNodeTagLabels("osc.node.label/", "team, notkubernetes.io/, node-role.kubernetes.io/", "")
+	assert.Equal(t, map[string]string{"team": "web", "notkubernetes.io/role": "web", "node-role.kubernetes.io/worker": ""},
+		tagLabels.labels(tags))
+}
+
+func TestNodeTagLabelsSync(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{"kubernetes.io/hostname": "node-1"},
+	}}
+	client := fake.NewSimpleClientset(node)
+	tagLabels := newNodeTagLabels("osc.node.label/", "", "")
+
+	// Without client the nodes are not labeled
+	assert.NoError(t, tagLabels.sync(context.TODO(), node, nil))
+	tagLabels.setClient(client)
+
+	current := func() *v1.Node {
+		current, err := client.CoreV1().Nodes().Get(context.TODO(), "node-1", metav1.GetOptions{})
+		assert.NoError(t, err)
+		return current
+	}
+
+	assert.NoError(t, tagLabels.sync(context.TODO(), node, []osc.ResourceTag{
+		{Key: "osc.node.label/team", Value: "web"},
+		{Key: "osc.node.label/tier", Value: "front"},
+	}))
+	node = current()
+	assert.Equal(t, map[string]string{"kubernetes.io/hostname": "node-1", "team": "web", "tier": "front"}, node.Labels)
+	assert.Equal(t, "team,tier", node.Annotations[NodeAnnotationTagLabels])
+
+	// Removing a tag removes its label, the other labels are left untouched
+	assert.NoError(t, tagLabels.sync(context.TODO(), node, []osc.ResourceTag{
+		{Key: "osc.node.label/team", Value: "api"},
+	}))
+	node = current()
+	assert.Equal(t, map[string]string{"kubernetes.io/hostname": "node-1", "team": "api"}, node.Labels)
+	assert.Equal(t, "team", node.Annotations[NodeAnnotationTagLabels])
+
+	assert.NoError(t, tagLabels.sync(context.TODO(), node, nil))
+	node = current()
+	assert.Equal(t, map[string]string{"kubernetes.io/hostname": "node-1"}, node.Labels)
+	assert.NotContains(t, node.Annotations, NodeAnnotationTagLabels)
+
+	// Nothing is patched when the node is up to date
+	client.ClearActions()
+	assert.NoError(t, tagLabels.sync(context.TODO(), node, nil))
+	assert.Empty(t, client.Actions())
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Instance Metadata Cache *********************
+
+// instanceMetadataCacheTTL bounds the age of the cached instance types, which change when
+// the type of a stopped VM is updated
+const instanceMetadataCacheTTL = 10 * time.Minute
+
+// instanceMetadata holds the fields of the metadata of an instance which do not change
+// during its lifetime
+type instanceMetadata struct {
+	// UID of the node the metadata was computed for, empty when looked up without a node
+	nodeUID      types.UID
+	instanceType string
+	zone         string
+	region       string
+	// Time the metadata was cached, set by the cache
+	cachedAt time.Time
+}
+
+// instanceMetadataCache caches the metadata of the instances by provider ID, for the
+// lifetime of their node and at most for ttl, the instance type being able to change. The
+// entries are refreshed when the node is recreated, and dropped when the instance no longer
+// exists. A nil cache caches nothing.
+type instanceMetadataCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]instanceMetadata
+}
+
+func newInstanceMetadataCache(ttl time.Duration) *instanceMetadataCache {
+	return &instanceMetadataCache{ttl: ttl, entries: make(map[string]instanceMetadata)}
+}
+
+// get returns the cached metadata of the provider ID, whatever its node
+func (c *instanceMetadataCache) get(providerID string) (instanceMetadata, bool) {
+	if c == nil {
+		return instanceMetadata{}, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lookup(providerID)
+}
+
+// getForNode returns the cached metadata of the node, a recreated node invalidating the
+// metadata of its previous incarnation
+func (c *instanceMetadataCache) getForNode(node *v1.Node) (instanceMetadata, bool) {
+	if c == nil || node.Spec.ProviderID == "" {
+		return instanceMetadata{}, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	metadata, found := c.lookup(node.Spec.ProviderID)
+	if found && metadata.nodeUID != "" && metadata.nodeUID != node.UID {
+		klog.V(4).Infof("Node %s was recreated, refreshing the metadata of %s", node.Name, node.Spec.ProviderID)
+		delete(c.entries, node.Spec.ProviderID)
+		found = false
+	}
+	return metadata, found
+}
+
+// lookup returns the metadata of the provider ID unless expired, with the mutex held
+func (c *instanceMetadataCache) lookup(providerID string) (instanceMetadata, bool) {
+	metadata, found := c.entries[providerID]
+	if found && time.Since(metadata.cachedAt) >= c.ttl {
+		delete(c.entries, providerID)
+		return instanceMetadata{}, false
+	}
+	return metadata, found
+}
+
+// set caches the metadata of the provider ID
+func (c *instanceMetadataCache) set(providerID string, metadata instanceMetadata) {
+	if c == nil || providerID == "" {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	metadata.cachedAt = time.Now()
+	c.entries[providerID] = metadata
+}
+
+// forget drops the metadata of the provider ID, once the instance no longer exists
+func (c *instanceMetadataCache) forget(providerID string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, providerID)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstanceMetadataCache(t *testing.T) {
+	cache := newInstanceMetadataCache(time.Minute)
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a", UID: "uid-1"},
+		Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-aaaaaaaa"},
+	}
+	_, found := cache.getForNode(node)
+	assert.False(t, found)
+
+	metadata := instanceMetadata{nodeUID: node.UID, instanceType: "tinav5.c2r4p1", zone: "eu-west-2a", region: "eu-west-2"}
+	cache.set(node.Spec.ProviderID, metadata)
+	cached, found := cache.getForNode(node)
+	assert.True(t, found)
+	assert.Equal(t, metadata.instanceType, cached.instanceType)
+	cached, found = cache.get(node.Spec.ProviderID)
+	assert.True(t, found)
+	assert.Equal(t, metadata.instanceType, cached.instanceType)
+
+	// A recreated node refreshes the metadata
+	recreated := node.DeepCopy()
+	recreated.UID = "uid-2"
+	_, found = cache.getForNode(recreated)
+	assert.False(t, found)
+	_, found = cache.get(node.Spec.ProviderID)
+	assert.False(t, found)
+
+	// Nodes without provider ID are not cached
+	_, found = cache.getForNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}})
+	assert.False(t, found)
+
+	cache.set(node.Spec.ProviderID, metadata)
+	cache.forget(node.Spec.ProviderID)
+	_, found = cache.get(node.Spec.ProviderID)
+	assert.False(t, found)
+
+	// The metadata expires, the instance type of the VM being able to change
+	cache.set(node.Spec.ProviderID, metadata)
+	cache.entries[node.Spec.ProviderID] = instanceMetadata{nodeUID: node.UID, cachedAt: time.Now().Add(-time.Minute)}
+	_, found = cache.getForNode(node)
+	assert.False(t, found)
+	_, found = cache.get(node.Spec.ProviderID)
+	assert.False(t, found)
+
+	// A nil cache caches nothing
+	var disabled *instanceMetadataCache
+	disabled.set(node.Spec.ProviderID, metadata)
+	_, found = disabled.getForNode(node)
+	assert.False(t, found)
+}
+
+func TestZoneByProviderIDFromInstanceMetadataCache(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+
+	// The cached metadata is returned without reading the VM, which does not exist
+	providerID := "aws:///eu-west-2b/i-bbbbbbbb"
+	c.instanceMetadata.set(providerID, instanceMetadata{instanceType: "tinav5.c4r8p1", zone: "eu-west-2b", region: "eu-west-2"})
+	zone, err := c.GetZoneByProviderID(context.TODO(), providerID)
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-2b", zone.FailureDomain)
+	instanceType, err := c.InstanceTypeByProviderID(context.TODO(), providerID)
+	require.NoError(t, err)
+	assert.Equal(t, "tinav5.c4r8p1", instanceType)
+
+	_, err = c.GetZoneByProviderID(context.TODO(), "aws:///eu-west-2b/i-cccccccc")
+	assert.Error(t, err)
+}
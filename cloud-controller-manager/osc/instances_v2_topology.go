@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Node Topology Labels *********************
+
+// topologyLabelKeys are the node labels managed by nodeTopologyLabels
+var topologyLabelKeys = []string{LabelTopologyTenancy, LabelTopologyPlacementGroup}
+
+// nodeTopologyLabels sets the tenancy and the placement group of the VMs as node labels,
+// for the topology spread constraints of the workloads
+type nodeTopologyLabels struct {
+	// Set once the cloud is initialized
+	kubeClient clientset.Interface
+}
+
+func newNodeTopologyLabels() *nodeTopologyLabels {
+	return &nodeTopologyLabels{}
+}
+
+// setClient sets the client used to label the nodes
+func (l *nodeTopologyLabels) setClient(kubeClient clientset.Interface) {
+	if l != nil {
+		l.kubeClient = kubeClient
+	}
+}
+
+// vmTopologyLabels returns the topology labels of the VM
+func vmTopologyLabels(vm *osc.Vm) map[string]string {
+	labels := make(map[string]string)
+	if tenancy := vm.Placement.GetTenancy(); tenancy != "" {
+		labels[LabelTopologyTenancy] = tenancy
+	}
+	for _, tag := range vm.GetTags() {
+		if tag.GetKey() != TagNamePlacementGroup || tag.GetValue() == "" {
+			continue
+		}
+		if errs := validation.IsValidLabelValue(tag.GetValue()); len(errs) > 0 {
+			klog.Warningf("Ignoring tag %s of VM %s: invalid label value: %v", tag.GetKey(), vm.GetVmId(), errs)
+			continue
+		}
+		labels[LabelTopologyPlacementGroup] = tag.GetValue()
+	}
+	return labels
+}
+
+// sync sets the topology labels of the VM on the node, and removes those the VM no longer has
+func (l *nodeTopologyLabels) sync(ctx context.Context, node *v1.Node, vm *osc.Vm) error {
+	if l == nil || l.kubeClient == nil {
+		return nil
+	}
+	klog.V(5).Infof("nodeTopologyLabels.sync(%v,%v)", node.Name, vm.GetVmId())
+
+	labels := vmTopologyLabels(vm)
+	patchLabels := make(map[string]interface{})
+	for _, key := range topologyLabelKeys {
+		value, found := labels[key]
+		current, labeled := node.Labels[key]
+		if found && (!labeled || current != value) {
+			patchLabels[key] = value
+		} else if !found && labeled {
+			patchLabels[key] = nil
+		}
+	}
+	if len(patchLabels) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": patchLabels},
+	})
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("Updating the topology labels of node %s: %s", node.Name, patch)
+	_, err = l.kubeClient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
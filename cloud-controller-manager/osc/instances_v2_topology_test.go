@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestVMTopologyLabels(t *testing.T) {
+	tenancy := "dedicated"
+	vm := &osc.Vm{
+		Placement: &osc.Placement{Tenancy: &tenancy},
+		Tags: &[]osc.ResourceTag{
+			{Key: TagNamePlacementGroup, Value: "group-a"},
+			{Key: "Name", Value: "node-1"},
+		},
+	}
+	assert.Equal(t, map[string]string{
+		LabelTopologyTenancy:        "dedicated",
+		LabelTopologyPlacementGroup: "group-a",
+	}, vmTopologyLabels(vm))
+
+	vm.Tags = &[]osc.ResourceTag{{Key: TagNamePlacementGroup, Value: "not a label value"}}
+	assert.Equal(t, map[string]string{LabelTopologyTenancy: "dedicated"}, vmTopologyLabels(vm))
+
+	assert.Empty(t, vmTopologyLabels(&osc.Vm{}))
+}
+
+func TestNodeTopologyLabelsSync(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{"kubernetes.io/hostname": "node-1"},
+	}}
+	client := fake.NewSimpleClientset(node)
+	topologyLabels := newNodeTopologyLabels()
+	tenancy := "default"
+	vm := &osc.Vm{
+		VmId:      osc.PtrString("i-00000001"),
+		Placement: &osc.Placement{Tenancy: &tenancy},
+		Tags:      &[]osc.ResourceTag{{Key: TagNamePlacementGroup, Value: "group-a"}},
+	}
+
+	// Without client the nodes are not labeled
+	assert.NoError(t, topologyLabels.sync(context.TODO(), node, vm))
+	topologyLabels.setClient(client)
+
+	assert.NoError(t, topologyLabels.sync(context.TODO(), node, vm))
+	node, err := client.CoreV1().Nodes().Get(context.TODO(), "node-1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"kubernetes.io/hostname":    "node-1",
+		LabelTopologyTenancy:        "default",
+		LabelTopologyPlacementGroup: "group-a",
+	}, node.Labels)
+
+	// The placement group label is removed with the tag
+	vm.Tags = &[]osc.ResourceTag{}
+	assert.NoError(t, topologyLabels.sync(context.TODO(), node, vm))
+	node, err = client.CoreV1().Nodes().Get(context.TODO(), "node-1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"kubernetes.io/hostname": "node-1",
+		LabelTopologyTenancy:     "default",
+	}, node.Labels)
+}
@@ -27,17 +27,18 @@ import (
 // Handler for aws-sdk-go that logs all requests
 func awsHandlerLogger(req *request.Request) {
 	service, name := awsServiceAndName(req)
-	klog.V(2).Infof("AWS request: %s %s", service, name)
+	klog.V(2).InfoS("AWS request", "service", service, "operation", name)
 }
 
 func awsSendHandlerLogger(req *request.Request) {
 	service, name := awsServiceAndName(req)
-	klog.V(2).Infof("AWS API Send: %s %s %v %v", service, name, req.Operation, req.Params)
+	klog.V(2).InfoS("AWS API Send", "service", service, "operation", name)
+	klog.V(5).InfoS("AWS API Send parameters", "service", service, "operation", name, "params", redact(req.Params))
 }
 
 func awsValidateResponseHandlerLogger(req *request.Request) {
 	service, name := awsServiceAndName(req)
-	klog.V(2).Infof("AWS API ValidateResponse: %s %s %v %v %s", service, name, req.Operation, req.Params, req.HTTPResponse.Status)
+	klog.V(2).InfoS("AWS API ValidateResponse", "service", service, "operation", name, "status", req.HTTPResponse.Status)
 }
 
 func awsServiceAndName(req *request.Request) (string, string) {
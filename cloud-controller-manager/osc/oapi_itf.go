@@ -19,6 +19,8 @@ package osc
 import (
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
 
 	osc "github.com/outscale/osc-sdk-go/v2"
 )
@@ -40,12 +42,32 @@ type Compute interface {
 	DescribeSubnets(*osc.ReadSubnetsRequest) ([]osc.Subnet, error)
 
 	CreateTags(*osc.CreateTagsRequest) (*osc.CreateTagsResponse, error)
+	DeleteTags(*osc.DeleteTagsRequest) (*osc.DeleteTagsResponse, error)
 
 	ReadRouteTables(request *osc.ReadRouteTablesRequest) ([]osc.RouteTable, error)
 	CreateRoute(request *osc.CreateRouteRequest) (*osc.CreateRouteResponse, error)
 	DeleteRoute(request *osc.DeleteRouteRequest) (*osc.DeleteRouteResponse, error)
 
 	UpdateVM(request *osc.UpdateVmRequest) (*osc.UpdateVmResponse, error)
+
+	ReadPublicIps(request *osc.ReadPublicIpsRequest) ([]osc.PublicIp, error)
+	CreatePublicIp(request *osc.CreatePublicIpRequest) (*osc.CreatePublicIpResponse, error)
+	DeletePublicIp(request *osc.DeletePublicIpRequest) (*osc.DeletePublicIpResponse, error)
+
+	ReadLoadBalancers(request *osc.ReadLoadBalancersRequest) ([]osc.LoadBalancer, error)
+	UpdateLoadBalancer(request *osc.UpdateLoadBalancerRequest) (*osc.UpdateLoadBalancerResponse, error)
+}
+
+// ObjectStorage is a simple pass-through of Outscale' OOS client interface, which allows for testing
+type ObjectStorage interface {
+	HeadBucket(*s3.HeadBucketInput) (*s3.HeadBucketOutput, error)
+	CreateBucket(*s3.CreateBucketInput) (*s3.CreateBucketOutput, error)
+}
+
+// DNS is a simple pass-through of a Route 53 compatible client interface, which allows for testing
+type DNS interface {
+	ListResourceRecordSets(*route53.ListResourceRecordSetsInput) (*route53.ListResourceRecordSetsOutput, error)
+	ChangeResourceRecordSets(*route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error)
 }
 
 // LoadBalancer is a simple pass-through of Outscale' LoadBalancer client interface, which allows for testing
@@ -54,13 +76,18 @@ type LoadBalancer interface {
 	DeleteLoadBalancer(*elb.DeleteLoadBalancerInput) (*elb.DeleteLoadBalancerOutput, error)
 	DescribeLoadBalancers(*elb.DescribeLoadBalancersInput) (*elb.DescribeLoadBalancersOutput, error)
 	AddTags(*elb.AddTagsInput) (*elb.AddTagsOutput, error)
+	RemoveTags(*elb.RemoveTagsInput) (*elb.RemoveTagsOutput, error)
+	DescribeTags(*elb.DescribeTagsInput) (*elb.DescribeTagsOutput, error)
 	RegisterInstancesWithLoadBalancer(*elb.RegisterInstancesWithLoadBalancerInput) (*elb.RegisterInstancesWithLoadBalancerOutput, error)
 	DeregisterInstancesFromLoadBalancer(*elb.DeregisterInstancesFromLoadBalancerInput) (*elb.DeregisterInstancesFromLoadBalancerOutput, error)
 	CreateLoadBalancerPolicy(*elb.CreateLoadBalancerPolicyInput) (*elb.CreateLoadBalancerPolicyOutput, error)
+	CreateLBCookieStickinessPolicy(*elb.CreateLBCookieStickinessPolicyInput) (*elb.CreateLBCookieStickinessPolicyOutput, error)
+	CreateAppCookieStickinessPolicy(*elb.CreateAppCookieStickinessPolicyInput) (*elb.CreateAppCookieStickinessPolicyOutput, error)
 
 	SetLoadBalancerPoliciesForBackendServer(*elb.SetLoadBalancerPoliciesForBackendServerInput) (*elb.SetLoadBalancerPoliciesForBackendServerOutput, error)
 	SetLoadBalancerPoliciesOfListener(input *elb.SetLoadBalancerPoliciesOfListenerInput) (*elb.SetLoadBalancerPoliciesOfListenerOutput, error)
 	DescribeLoadBalancerPolicies(input *elb.DescribeLoadBalancerPoliciesInput) (*elb.DescribeLoadBalancerPoliciesOutput, error)
+	DeleteLoadBalancerPolicy(input *elb.DeleteLoadBalancerPolicyInput) (*elb.DeleteLoadBalancerPolicyOutput, error)
 
 	DetachLoadBalancerFromSubnets(*elb.DetachLoadBalancerFromSubnetsInput) (*elb.DetachLoadBalancerFromSubnetsOutput, error)
 	AttachLoadBalancerToSubnets(*elb.AttachLoadBalancerToSubnetsInput) (*elb.AttachLoadBalancerToSubnetsOutput, error)
@@ -74,6 +101,8 @@ type LoadBalancer interface {
 
 	DescribeLoadBalancerAttributes(*elb.DescribeLoadBalancerAttributesInput) (*elb.DescribeLoadBalancerAttributesOutput, error)
 	ModifyLoadBalancerAttributes(*elb.ModifyLoadBalancerAttributesInput) (*elb.ModifyLoadBalancerAttributesOutput, error)
+
+	DescribeInstanceHealth(*elb.DescribeInstanceHealthInput) (*elb.DescribeInstanceHealthOutput, error)
 }
 
 // EC2Metadata is an abstraction over the AWS metadata service.
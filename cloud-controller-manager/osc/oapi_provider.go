@@ -18,6 +18,7 @@ package osc
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"sync"
 
@@ -28,6 +29,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
 
 	"github.com/outscale-dev/cloud-provider-osc/cloud-controller-manager/utils"
 
@@ -42,10 +45,17 @@ import (
 
 type awsSDKProvider struct {
 	creds *credentials.Credentials
-	cfg   awsCloudConfigProvider
+	// Whether creds are refreshed, in which case the oAPI requests are signed with them
+	refreshedCreds bool
+	cfg            awsCloudConfigProvider
 
 	mutex          sync.Mutex
 	regionDelayers map[string]*CrossRequestRetryDelay
+
+	throttling *apiThrottling
+
+	// Credentials file overriding the oAPI and LBU endpoints, if any
+	credentialsFile *fileCredentialsProvider
 }
 
 func addOscUserAgent(h *request.Handlers) {
@@ -66,6 +76,8 @@ func (p *awsSDKProvider) addHandlers(regionName string, h *request.Handlers) {
 		Fn:   awsHandlerLogger,
 	})
 
+	p.throttling.addLbuHandlers(h)
+
 	delayer := p.getCrossRequestRetryDelay(regionName)
 	if delayer != nil {
 		h.Sign.PushFrontNamed(request.NamedHandler{
@@ -79,11 +91,15 @@ func (p *awsSDKProvider) addHandlers(regionName string, h *request.Handlers) {
 		})
 	}
 
+	h.CompleteAttempt.PushBackNamed(request.NamedHandler{
+		Name: "k8s/api-metrics",
+		Fn:   awsHandlerMetrics,
+	})
+
 	p.addAPILoggingHandlers(h)
 }
 
 func (p *awsSDKProvider) addAPILoggingHandlers(h *request.Handlers) {
-	debugPrintCallerFunctionName()
 	h.Send.PushBackNamed(request.NamedHandler{
 		Name: "k8s/api-request",
 		Fn:   awsSendHandlerLogger,
@@ -105,7 +121,6 @@ func (p *awsSDKProvider) addAPILoggingHandlers(h *request.Handlers) {
 // this throttling, we need to address the root cause (e.g. add a delay to a
 // controller retry loop)
 func (p *awsSDKProvider) getCrossRequestRetryDelay(regionName string) *CrossRequestRetryDelay {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("getCrossRequestRetryDelay(%v)", regionName)
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
@@ -118,28 +133,65 @@ func (p *awsSDKProvider) getCrossRequestRetryDelay(regionName string) *CrossRequ
 	return delayer
 }
 
-func NewOscClient(regionName string) (context.Context, *osc.APIClient, error) {
+// NewOscClient returns an oAPI client for the region. Unless signed is set, the requests are
+// signed with the credentials of the environment; otherwise httpClient must sign them.
+func NewOscClient(regionName string, httpClient *http.Client, signed bool) (context.Context, *osc.APIClient, error) {
 	configEnv := osc.NewConfigEnv()
+	if endpoint := apiClients.endpoint(oapiServiceName, regionName); configEnv.OutscaleApiEndpoint == nil && endpoint != "" {
+		configEnv.OutscaleApiEndpoint = &endpoint
+	}
+	if signed {
+		// Do not fall back to the osc profile when the environment has no credentials
+		empty := ""
+		if configEnv.AccessKey == nil {
+			configEnv.AccessKey = &empty
+		}
+		if configEnv.SecretKey == nil {
+			configEnv.SecretKey = &empty
+		}
+	}
 	config, err := configEnv.Configuration()
 	if err != nil {
 		return nil, nil, err
 	}
 	config.Debug = true
 	config.UserAgent = fmt.Sprintf("osc-cloud-controller-manager/%v", utils.GetVersion())
+	if httpClient == nil {
+		httpClient = apiClients.httpClient()
+	}
+	if httpClient != nil {
+		config.HTTPClient = httpClient
+	}
 	client := osc.NewAPIClient(config)
-	ctx := context.WithValue(context.Background(), osc.ContextAWSv4, osc.AWSv4{
-		AccessKey: os.Getenv("OSC_ACCESS_KEY"),
-		SecretKey: os.Getenv("OSC_SECRET_KEY"),
-	})
+	ctx := context.Background()
+	if !signed {
+		ctx = context.WithValue(ctx, osc.ContextAWSv4, osc.AWSv4{
+			AccessKey: os.Getenv("OSC_ACCESS_KEY"),
+			SecretKey: os.Getenv("OSC_SECRET_KEY"),
+		})
+	}
 	ctx = context.WithValue(ctx, osc.ContextServerIndex, 0)
 	ctx = context.WithValue(ctx, osc.ContextServerVariables, map[string]string{"region": regionName})
 	return ctx, client, err
 }
+
+// oapiHTTPClient returns the HTTP client of the oAPI clients, signing the requests with
+// the refreshed credentials when configured
+func (p *awsSDKProvider) oapiHTTPClient() *http.Client {
+	transport := apiClients.transport
+	if p.refreshedCreds {
+		transport = newOapiSigningTransport(p.creds, http.DefaultTransport)
+	}
+	if p.credentialsFile != nil {
+		transport = newOapiEndpointTransport(p.credentialsFile, transport)
+	}
+	return p.throttling.oapiHTTPClient(transport)
+}
+
 func (p *awsSDKProvider) Compute(regionName string) (Compute, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("Compute(%v)", regionName)
 	// osc config
-	ctx, client, err := NewOscClient(regionName)
+	ctx, client, err := NewOscClient(regionName, p.oapiHTTPClient(), p.refreshedCreds)
 	if err != nil {
 		return nil, err
 	}
@@ -153,23 +205,72 @@ func (p *awsSDKProvider) Compute(regionName string) (Compute, error) {
 }
 
 func (p *awsSDKProvider) LoadBalancing(regionName string) (LoadBalancer, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("LoadBalancing(%v)", regionName)
 	sess, err := NewSession(nil)
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialize AWS session: %v", err)
 	}
-	elbClient := elb.New(sess)
+	elbConfig := aws.NewConfig()
+	if p.refreshedCreds {
+		elbConfig = elbConfig.WithCredentials(p.creds)
+	}
+	elbClient := elb.New(sess, request.WithRetryer(elbConfig, p.throttling.lbuRetryer()))
 	p.addHandlers(regionName, &elbClient.Handlers)
+	addLbuEndpointHandler(p.credentialsFile, &elbClient.Handlers)
+
+	return newPagedLoadBalancer(elbClient), nil
+}
+
+func (p *awsSDKProvider) ObjectStorage(regionName string) (ObjectStorage, error) {
+	klog.V(5).Infof("ObjectStorage(%v)", regionName)
+	sess, err := NewSession(nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize AWS session: %v", err)
+	}
+	oosConfig := aws.NewConfig().WithS3ForcePathStyle(true)
+	if p.refreshedCreds {
+		oosConfig = oosConfig.WithCredentials(p.creds)
+	}
+	oosClient := s3.New(sess, oosConfig)
+	addOscUserAgent(&oosClient.Handlers)
+	oosClient.Handlers.CompleteAttempt.PushBackNamed(request.NamedHandler{
+		Name: "k8s/api-metrics",
+		Fn:   awsHandlerMetrics,
+	})
+	p.addAPILoggingHandlers(&oosClient.Handlers)
+
+	return oosClient, nil
+}
+
+func (p *awsSDKProvider) DNS(regionName string) (DNS, error) {
+	klog.V(5).Infof("DNS(%v)", regionName)
+	sess, err := NewSession(nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize AWS session: %v", err)
+	}
+	dnsConfig := aws.NewConfig()
+	if endpoint := apiClients.endpoint(dnsServiceName, regionName); endpoint != "" {
+		dnsConfig = dnsConfig.WithEndpoint(endpoint)
+	}
+	if p.refreshedCreds {
+		dnsConfig = dnsConfig.WithCredentials(p.creds)
+	}
+	dnsClient := route53.New(sess, dnsConfig)
+	addOscUserAgent(&dnsClient.Handlers)
+	dnsClient.Handlers.CompleteAttempt.PushBackNamed(request.NamedHandler{
+		Name: "k8s/api-metrics",
+		Fn:   awsHandlerMetrics,
+	})
+	p.addAPILoggingHandlers(&dnsClient.Handlers)
 
-	return elbClient, nil
+	return dnsClient, nil
 }
 
 func (p *awsSDKProvider) Metadata() (EC2Metadata, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("Metadata()")
 	awsConfig := &aws.Config{
 		EndpointResolver: endpoints.ResolverFunc(SetupMetadataResolver()),
+		HTTPClient:       apiClients.metadataHTTPClient(),
 	}
 	awsConfig.WithLogLevel(aws.LogDebugWithSigning | aws.LogDebugWithHTTPBody | aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors)
 	sess := session.Must(session.NewSession(awsConfig))
@@ -35,10 +35,11 @@ type oscSdkCompute struct {
 
 // Implementation of ReadVms
 func (s *oscSdkCompute) ReadVms(request *osc.ReadVmsRequest) ([]osc.Vm, error) {
-	// Instances are paged
+	// Instances are not paged by this version of the oAPI SDK
 	var results []osc.Vm
 	requestTime := time.Now()
 	response, httpRes, err := s.client.VmApi.ReadVms(s.ctx).ReadVmsRequest(*request).Execute()
+	recordOapiMetric("ReadVms", requestTime, httpRes, err)
 	if err != nil {
 		recordAWSMetric("describe_instance", 0, err)
 		if httpRes != nil {
@@ -61,6 +62,7 @@ func (s *oscSdkCompute) ReadVms(request *osc.ReadVmsRequest) ([]osc.Vm, error) {
 func (s *oscSdkCompute) ReadSecurityGroups(request *osc.ReadSecurityGroupsRequest) ([]osc.SecurityGroup, error) {
 	requestTime := time.Now()
 	response, httpRes, err := s.client.SecurityGroupApi.ReadSecurityGroups(s.ctx).ReadSecurityGroupsRequest(*request).Execute()
+	recordOapiMetric("ReadSecurityGroups", requestTime, httpRes, err)
 	if err != nil {
 		recordAWSMetric("describe_security_groups", 0, err)
 		if httpRes != nil {
@@ -80,7 +82,9 @@ func (s *oscSdkCompute) ReadSecurityGroups(request *osc.ReadSecurityGroupsReques
 
 func (s *oscSdkCompute) DescribeSubnets(request *osc.ReadSubnetsRequest) ([]osc.Subnet, error) {
 	// Subnets are not paged
-	response, _, err := s.client.SubnetApi.ReadSubnets(s.ctx).ReadSubnetsRequest(*request).Execute()
+	requestTime := time.Now()
+	response, httpRes, err := s.client.SubnetApi.ReadSubnets(s.ctx).ReadSubnetsRequest(*request).Execute()
+	recordOapiMetric("ReadSubnets", requestTime, httpRes, err)
 	if err != nil {
 		return nil, fmt.Errorf("error listing subnets: %q", err)
 	}
@@ -93,37 +97,53 @@ func (s *oscSdkCompute) DescribeSubnets(request *osc.ReadSubnetsRequest) ([]osc.
 }
 
 func (s *oscSdkCompute) CreateSecurityGroup(request *osc.CreateSecurityGroupRequest) (*osc.CreateSecurityGroupResponse, error) {
-	response, _, err := s.client.SecurityGroupApi.CreateSecurityGroup(s.ctx).CreateSecurityGroupRequest(*request).Execute()
+	requestTime := time.Now()
+	response, httpRes, err := s.client.SecurityGroupApi.CreateSecurityGroup(s.ctx).CreateSecurityGroupRequest(*request).Execute()
+	recordOapiMetric("CreateSecurityGroup", requestTime, httpRes, err)
 	return &response, err
 }
 
 func (s *oscSdkCompute) DeleteSecurityGroup(request *osc.DeleteSecurityGroupRequest) (*osc.DeleteSecurityGroupResponse, error) {
-	response, _, err := s.client.SecurityGroupApi.DeleteSecurityGroup(s.ctx).DeleteSecurityGroupRequest(*request).Execute()
+	requestTime := time.Now()
+	response, httpRes, err := s.client.SecurityGroupApi.DeleteSecurityGroup(s.ctx).DeleteSecurityGroupRequest(*request).Execute()
+	recordOapiMetric("DeleteSecurityGroup", requestTime, httpRes, err)
 	return &response, err
 }
 
 func (s *oscSdkCompute) CreateSecurityGroupRule(request *osc.CreateSecurityGroupRuleRequest) (*osc.CreateSecurityGroupRuleResponse, error) {
-	response, _, err := s.client.SecurityGroupRuleApi.CreateSecurityGroupRule(s.ctx).CreateSecurityGroupRuleRequest(*request).Execute()
+	requestTime := time.Now()
+	response, httpRes, err := s.client.SecurityGroupRuleApi.CreateSecurityGroupRule(s.ctx).CreateSecurityGroupRuleRequest(*request).Execute()
+	recordOapiMetric("CreateSecurityGroupRule", requestTime, httpRes, err)
 	return &response, err
 }
 
 func (s *oscSdkCompute) DeleteSecurityGroupRule(request *osc.DeleteSecurityGroupRuleRequest) (*osc.DeleteSecurityGroupRuleResponse, error) {
-	response, _, err := s.client.SecurityGroupRuleApi.DeleteSecurityGroupRule(s.ctx).DeleteSecurityGroupRuleRequest(*request).Execute()
+	requestTime := time.Now()
+	response, httpRes, err := s.client.SecurityGroupRuleApi.DeleteSecurityGroupRule(s.ctx).DeleteSecurityGroupRuleRequest(*request).Execute()
+	recordOapiMetric("DeleteSecurityGroupRule", requestTime, httpRes, err)
 	return &response, err
 }
 
 func (s *oscSdkCompute) CreateTags(request *osc.CreateTagsRequest) (*osc.CreateTagsResponse, error) {
-	debugPrintCallerFunctionName()
 	requestTime := time.Now()
-	resp, _, err := s.client.TagApi.CreateTags(s.ctx).CreateTagsRequest(*request).Execute()
+	resp, httpRes, err := s.client.TagApi.CreateTags(s.ctx).CreateTagsRequest(*request).Execute()
+	recordOapiMetric("CreateTags", requestTime, httpRes, err)
 	timeTaken := time.Since(requestTime).Seconds()
 	recordAWSMetric("create_tags", timeTaken, err)
 	return &resp, err
 }
 
+func (s *oscSdkCompute) DeleteTags(request *osc.DeleteTagsRequest) (*osc.DeleteTagsResponse, error) {
+	requestTime := time.Now()
+	resp, httpRes, err := s.client.TagApi.DeleteTags(s.ctx).DeleteTagsRequest(*request).Execute()
+	recordOapiMetric("DeleteTags", requestTime, httpRes, err)
+	return &resp, err
+}
+
 func (s *oscSdkCompute) ReadRouteTables(request *osc.ReadRouteTablesRequest) ([]osc.RouteTable, error) {
 	requestTime := time.Now()
-	response, _, err := s.client.RouteTableApi.ReadRouteTables(s.ctx).ReadRouteTablesRequest(*request).Execute()
+	response, httpRes, err := s.client.RouteTableApi.ReadRouteTables(s.ctx).ReadRouteTablesRequest(*request).Execute()
+	recordOapiMetric("ReadRouteTables", requestTime, httpRes, err)
 	if err != nil {
 		recordAWSMetric("describe_route_tables", 0, err)
 		return nil, fmt.Errorf("error listing route tables: %q", err)
@@ -139,16 +159,63 @@ func (s *oscSdkCompute) ReadRouteTables(request *osc.ReadRouteTablesRequest) ([]
 }
 
 func (s *oscSdkCompute) CreateRoute(request *osc.CreateRouteRequest) (*osc.CreateRouteResponse, error) {
-	response, _, err := s.client.RouteApi.CreateRoute(s.ctx).CreateRouteRequest(*request).Execute()
+	requestTime := time.Now()
+	response, httpRes, err := s.client.RouteApi.CreateRoute(s.ctx).CreateRouteRequest(*request).Execute()
+	recordOapiMetric("CreateRoute", requestTime, httpRes, err)
 	return &response, err
 }
 
 func (s *oscSdkCompute) DeleteRoute(request *osc.DeleteRouteRequest) (*osc.DeleteRouteResponse, error) {
-	response, _, err := s.client.RouteApi.DeleteRoute(s.ctx).DeleteRouteRequest(*request).Execute()
+	requestTime := time.Now()
+	response, httpRes, err := s.client.RouteApi.DeleteRoute(s.ctx).DeleteRouteRequest(*request).Execute()
+	recordOapiMetric("DeleteRoute", requestTime, httpRes, err)
 	return &response, err
 }
 
 func (s *oscSdkCompute) UpdateVM(request *osc.UpdateVmRequest) (*osc.UpdateVmResponse, error) {
-	response, _, err := s.client.VmApi.UpdateVm(s.ctx).UpdateVmRequest(*request).Execute()
+	requestTime := time.Now()
+	response, httpRes, err := s.client.VmApi.UpdateVm(s.ctx).UpdateVmRequest(*request).Execute()
+	recordOapiMetric("UpdateVm", requestTime, httpRes, err)
+	return &response, err
+}
+
+func (s *oscSdkCompute) ReadPublicIps(request *osc.ReadPublicIpsRequest) ([]osc.PublicIp, error) {
+	requestTime := time.Now()
+	response, httpRes, err := s.client.PublicIpApi.ReadPublicIps(s.ctx).ReadPublicIpsRequest(*request).Execute()
+	recordOapiMetric("ReadPublicIps", requestTime, httpRes, err)
+	if err != nil {
+		return nil, fmt.Errorf("error listing public IPs: %q", err)
+	}
+	return response.GetPublicIps(), nil
+}
+
+func (s *oscSdkCompute) CreatePublicIp(request *osc.CreatePublicIpRequest) (*osc.CreatePublicIpResponse, error) {
+	requestTime := time.Now()
+	response, httpRes, err := s.client.PublicIpApi.CreatePublicIp(s.ctx).CreatePublicIpRequest(*request).Execute()
+	recordOapiMetric("CreatePublicIp", requestTime, httpRes, err)
+	return &response, err
+}
+
+func (s *oscSdkCompute) DeletePublicIp(request *osc.DeletePublicIpRequest) (*osc.DeletePublicIpResponse, error) {
+	requestTime := time.Now()
+	response, httpRes, err := s.client.PublicIpApi.DeletePublicIp(s.ctx).DeletePublicIpRequest(*request).Execute()
+	recordOapiMetric("DeletePublicIp", requestTime, httpRes, err)
+	return &response, err
+}
+
+func (s *oscSdkCompute) ReadLoadBalancers(request *osc.ReadLoadBalancersRequest) ([]osc.LoadBalancer, error) {
+	requestTime := time.Now()
+	response, httpRes, err := s.client.LoadBalancerApi.ReadLoadBalancers(s.ctx).ReadLoadBalancersRequest(*request).Execute()
+	recordOapiMetric("ReadLoadBalancers", requestTime, httpRes, err)
+	if err != nil {
+		return nil, fmt.Errorf("error listing load balancers: %q", err)
+	}
+	return response.GetLoadBalancers(), nil
+}
+
+func (s *oscSdkCompute) UpdateLoadBalancer(request *osc.UpdateLoadBalancerRequest) (*osc.UpdateLoadBalancerResponse, error) {
+	requestTime := time.Now()
+	response, httpRes, err := s.client.LoadBalancerApi.UpdateLoadBalancer(s.ctx).UpdateLoadBalancerRequest(*request).Execute()
+	recordOapiMetric("UpdateLoadBalancer", requestTime, httpRes, err)
 	return &response, err
 }
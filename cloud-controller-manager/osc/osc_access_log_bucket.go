@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Access Log Bucket *********************
+
+// accessLogBuckets checks that the OOS buckets receiving the access logs of the load
+// balancers exist, and creates them when enabled. LBU accepts a missing bucket and then
+// silently drops the logs.
+type accessLogBuckets struct {
+	storage ObjectStorage
+	create  bool
+
+	mutex sync.Mutex
+	// Buckets known to exist
+	found sets.String
+}
+
+func newAccessLogBuckets(storage ObjectStorage, create bool) *accessLogBuckets {
+	return &accessLogBuckets{
+		storage: storage,
+		create:  create,
+		found:   sets.NewString(),
+	}
+}
+
+// ensure returns an error when the bucket does not exist and can't be created. The mutex
+// only guards the buckets known to exist, not the calls to OOS, a bucket concurrently
+// created being accepted.
+func (b *accessLogBuckets) ensure(bucket string) error {
+	b.mutex.Lock()
+	found := b.found.Has(bucket)
+	b.mutex.Unlock()
+	if found {
+		return nil
+	}
+
+	_, err := b.storage.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err == nil {
+		b.setFound(bucket)
+		return nil
+	}
+	if !isBucketNotFound(err) {
+		return fmt.Errorf("error checking access log bucket %s: %q", bucket, err)
+	}
+	if !b.create {
+		return fmt.Errorf("access log bucket %s does not exist", bucket)
+	}
+
+	klog.Infof("Creating access log bucket %s", bucket)
+	// The bucket is private to the account of the cloud provider, which LBU writes with
+	_, err = b.storage.CreateBucket(&s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+		ACL:    aws.String(s3.BucketCannedACLPrivate),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("error creating access log bucket %s: %q", bucket, err)
+	}
+	b.setFound(bucket)
+	return nil
+}
+
+func (b *accessLogBuckets) setFound(bucket string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.found.Insert(bucket)
+}
+
+func isBucketNotFound(err error) bool {
+	if requestErr, ok := err.(awserr.RequestFailure); ok && requestErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == "NotFound" || awsErr.Code() == s3.ErrCodeNoSuchBucket
+	}
+	return false
+}
+
+// ensureAccessLogBucket checks the bucket of the access logs enabled by the attributes,
+// reporting an InvalidAccessLogBucket event on the service when it is missing. The error
+// only fails the reconciliation when the buckets are created, the bucket may otherwise be
+// managed, or only be readable, by other means.
+func (c *Cloud) ensureAccessLogBucket(service *v1.Service, attributes *elb.LoadBalancerAttributes) error {
+	klog.V(5).Infof("ensureAccessLogBucket(%v)", attributes.AccessLog)
+	if c.accessLogBuckets == nil || attributes.AccessLog == nil || !aws.BoolValue(attributes.AccessLog.Enabled) {
+		return nil
+	}
+	bucket := aws.StringValue(attributes.AccessLog.S3BucketName)
+	err := c.accessLogBuckets.ensure(bucket)
+	if err == nil {
+		return nil
+	}
+	if c.eventRecorder != nil {
+		c.eventRecorder.Eventf(service, v1.EventTypeWarning, "InvalidAccessLogBucket",
+			"Access logs of the load balancer can't be written: %v", err)
+	}
+	if !c.accessLogBuckets.create {
+		klog.Warningf("Ignoring the access log bucket of service %s/%s: %v", service.Namespace, service.Name, err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEnsureAccessLogBucket(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+	storage := awsServices.objectStorage.(*FakeObjectStorage)
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	attributes, err := getLoadBalancerAttributes(map[string]string{
+		ServiceAnnotationLoadBalancerAccessLogEnabled:        "true",
+		ServiceAnnotationLoadBalancerAccessLogS3BucketName:   "logs",
+		ServiceAnnotationLoadBalancerAccessLogS3BucketPrefix: "web",
+	})
+	assert.NoError(t, err)
+
+	// A missing bucket is reported without failing the load balancer
+	assert.NoError(t, c.ensureAccessLogBucket(service, attributes))
+	assert.Contains(t, <-recorder.Events, "InvalidAccessLogBucket")
+
+	storage.Buckets.Insert("logs")
+	assert.NoError(t, c.ensureAccessLogBucket(service, attributes))
+
+	// Disabled access logs are not checked
+	attributes, err = getLoadBalancerAttributes(map[string]string{
+		ServiceAnnotationLoadBalancerAccessLogEnabled:        "false",
+		ServiceAnnotationLoadBalancerAccessLogS3BucketName:   "missing",
+		ServiceAnnotationLoadBalancerAccessLogS3BucketPrefix: "web",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, c.ensureAccessLogBucket(service, attributes))
+}
+
+func TestCreateAccessLogBucket(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.accessLogBuckets.create = true
+
+	assert.NoError(t, c.accessLogBuckets.ensure("logs"))
+	assert.True(t, awsServices.objectStorage.(*FakeObjectStorage).Buckets.Has("logs"))
+}
+
+func TestCreateAccessLogBucketError(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+	c.accessLogBuckets.create = true
+	awsServices.objectStorage.(*FakeObjectStorage).CreateBucketError = awserr.New("AccessDenied", "access denied", nil)
+
+	// The load balancer fails when the bucket can't be created
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	attributes, err := getLoadBalancerAttributes(map[string]string{
+		ServiceAnnotationLoadBalancerAccessLogEnabled:        "true",
+		ServiceAnnotationLoadBalancerAccessLogS3BucketName:   "logs",
+		ServiceAnnotationLoadBalancerAccessLogS3BucketPrefix: "web",
+	})
+	assert.NoError(t, err)
+	assert.Error(t, c.ensureAccessLogBucket(service, attributes))
+	assert.Contains(t, <-recorder.Events, "InvalidAccessLogBucket")
+}
@@ -0,0 +1,385 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Annotation Validation *********************
+
+var (
+	securityGroupIDRegexp  = regexp.MustCompile(`^sg-[0-9a-f]{8}$`)
+	subnetIDRegexp         = regexp.MustCompile(`^subnet-[0-9a-f]{8}$`)
+	netIDRegexp            = regexp.MustCompile(`^vpc-[0-9a-f]{8}$`)
+	subregionRegexp        = regexp.MustCompile(`^[a-z]+(-[a-z]+)+-[0-9]+[a-z]$`)
+	loadBalancerNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+)
+
+// annotationValidators checks the value of the service annotations which are not free
+// text, using the same parsing as the load balancer reconciliation
+var annotationValidators = map[string]func(value string) error{
+	ServiceAnnotationLoadBalancerProxyProtocol: func(value string) error {
+		_, err := getProxyProtocol(map[string]string{ServiceAnnotationLoadBalancerProxyProtocol: value})
+		return err
+	},
+	ServiceAnnotationLoadBalancerProxyProtocolVersion: func(value string) error {
+		_, err := getProxyProtocolVersion(map[string]string{ServiceAnnotationLoadBalancerProxyProtocolVersion: value})
+		return err
+	},
+	ServiceAnnotationLoadBalancerAccessLogEnabled:              loadBalancerAttributeValidator(ServiceAnnotationLoadBalancerAccessLogEnabled),
+	ServiceAnnotationLoadBalancerAccessLogEmitInterval:         loadBalancerAttributeValidator(ServiceAnnotationLoadBalancerAccessLogEmitInterval),
+	ServiceAnnotationLoadBalancerConnectionDrainingEnabled:     loadBalancerAttributeValidator(ServiceAnnotationLoadBalancerConnectionDrainingEnabled),
+	ServiceAnnotationLoadBalancerConnectionDrainingTimeout:     loadBalancerAttributeValidator(ServiceAnnotationLoadBalancerConnectionDrainingTimeout),
+	ServiceAnnotationLoadBalancerConnectionIdleTimeout:         loadBalancerAttributeValidator(ServiceAnnotationLoadBalancerConnectionIdleTimeout),
+	ServiceAnnotationLoadBalancerCrossZoneLoadBalancingEnabled: loadBalancerAttributeValidator(ServiceAnnotationLoadBalancerCrossZoneLoadBalancingEnabled),
+	ServiceAnnotationLoadBalancerCrossZoneEnabled:              loadBalancerAttributeValidator(ServiceAnnotationLoadBalancerCrossZoneEnabled),
+	ServiceAnnotationLoadBalancerHCHealthyThreshold:            healthCheckValidator(ServiceAnnotationLoadBalancerHCHealthyThreshold),
+	ServiceAnnotationLoadBalancerHCUnhealthyThreshold:          healthCheckValidator(ServiceAnnotationLoadBalancerHCUnhealthyThreshold),
+	ServiceAnnotationLoadBalancerHCTimeout:                     healthCheckValidator(ServiceAnnotationLoadBalancerHCTimeout),
+	ServiceAnnotationLoadBalancerHCInterval:                    healthCheckValidator(ServiceAnnotationLoadBalancerHCInterval),
+	ServiceAnnotationLoadBalancerSecurityGroups:                validateSecurityGroupIDs,
+	ServiceAnnotationLoadBalancerExtraSecurityGroups:           validateSecurityGroupIDs,
+	ServiceAnnotationLoadBalancerSubnetID:                      validateSubnetIDs,
+	ServiceAnnotationLoadBalancerNetID: func(value string) error {
+		return validateIDs(value, netIDRegexp, "Net")
+	},
+	ServiceAnnotationLoadBalancerSubnetIDs: func(value string) error {
+		subnetIDs := strings.Split(value, ",")
+		for i := range subnetIDs {
+			subnetIDs[i] = strings.TrimSpace(subnetIDs[i])
+		}
+		if _, err := parseLoadBalancerSubnetIDs(value, subnetIDs); err != nil {
+			return err
+		}
+		return validateSubnetIDs(value)
+	},
+	ServiceAnnotationLoadBalancerSubnetAZ: func(value string) error {
+		if !subregionRegexp.MatchString(value) {
+			return fmt.Errorf("%q is not a valid subregion name", value)
+		}
+		return nil
+	},
+	ServiceAnnotationLoadBalancerBEProtocol: func(value string) error {
+		if _, found := backendProtocolMapping[value]; !found {
+			return fmt.Errorf("unknown backend protocol, expected one of %v", backendProtocols())
+		}
+		return nil
+	},
+	ServiceAnnotationLoadBalancerBEProtocolMap: func(value string) error {
+		_, err := parseBackendProtocolMap(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerName: func(value string) error {
+		if !loadBalancerNameRegexp.MatchString(value) {
+			return fmt.Errorf("must only contain alphanumeric characters and hyphens")
+		}
+		return nil
+	},
+	ServiceAnnotationLoadBalancerNameLength: func(value string) error {
+		length, err := strconv.ParseInt(value, 10, 0)
+		if err != nil || length < 1 || length > LbNameMaxLength {
+			return fmt.Errorf("expected a length between 1 and %d", LbNameMaxLength)
+		}
+		return nil
+	},
+	ServiceAnnotationLoadBalancerExtraListeners: func(value string) error {
+		_, err := parseExtraListeners(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerBackendPorts: func(value string) error {
+		_, err := parseBackendPorts(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerHealthCheckPortName: func(value string) error {
+		if value == "" {
+			return fmt.Errorf("expected the name of a port of the service")
+		}
+		return nil
+	},
+	ServiceAnnotationLoadBalancerTargetVMTags: func(value string) error {
+		_, err := parseTargetVMTags(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerExternalIPsIngress: func(value string) error {
+		_, err := getExternalIPsIngress(map[string]string{ServiceAnnotationLoadBalancerExternalIPsIngress: value})
+		return err
+	},
+	ServiceAnnotationLoadBalancerSSLPolicy: func(value string) error {
+		_, err := parseSSLPolicy(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerSourceRangesRef: func(value string) error {
+		_, err := parseSourceRangesRef(value, metav1.NamespaceDefault)
+		return err
+	},
+	ServiceAnnotationLoadBalancerStickinessPolicy: func(value string) error {
+		_, err := getStickinessPolicy(&v1.Service{}, map[string]string{
+			ServiceAnnotationLoadBalancerStickinessPolicy:     value,
+			ServiceAnnotationLoadBalancerStickinessCookieName: "cookie",
+		})
+		return err
+	},
+	ServiceAnnotationLoadBalancerStickinessCookieName: func(value string) error {
+		if value == "" {
+			return fmt.Errorf("expected the name of the cookie of the application")
+		}
+		return nil
+	},
+	ServiceAnnotationLoadBalancerStickinessCookieExpiration: func(value string) error {
+		_, err := parseStickinessCookieExpiration(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerSecurityGroupMode: func(value string) error {
+		_, err := parseSecurityGroupMode(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerBackendSecurityGroupRules: func(value string) error {
+		_, err := parseBackendRuleGranularity(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerReadyTimeout: func(value string) error {
+		_, err := parseLoadBalancerReadyTimeout(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerProfile: func(value string) error {
+		_, err := parseLoadBalancerProfile(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerIPPool: func(value string) error {
+		if value == "" {
+			return fmt.Errorf("expected the name of a pool of public IPs")
+		}
+		return nil
+	},
+	ServiceAnnotationLoadBalancerDryRun: func(value string) error {
+		_, err := parseLoadBalancerDryRun(value)
+		return err
+	},
+	ServiceAnnotationLoadBalancerDeletionProtection: func(value string) error {
+		_, err := getDeletionProtection(map[string]string{ServiceAnnotationLoadBalancerDeletionProtection: value})
+		return err
+	},
+	ServiceAnnotationLoadBalancerSchemeSwitch: func(value string) error {
+		_, err := getSchemeSwitch(map[string]string{ServiceAnnotationLoadBalancerSchemeSwitch: value})
+		return err
+	},
+	ServiceAnnotationLoadBalancerDNSName: func(value string) error {
+		_, err := getLoadBalancerDNSName(map[string]string{ServiceAnnotationLoadBalancerDNSName: value})
+		return err
+	},
+	ServiceAnnotationLoadBalancerPrivateIP: func(value string) error {
+		return errLoadBalancerPrivateIP
+	},
+	ServiceAnnotationLoadBalancerDrainOnDelete: func(value string) error {
+		_, err := parseDrainOnDeletePeriod(value)
+		return err
+	},
+}
+
+// ValidateServiceAnnotations returns the errors of the load balancer annotations of a
+// service. They are the errors the CCM configured with cfg would report when reconciling the
+// load balancer. On an update, old is the previous service and only the annotations which
+// changed are checked, so that services admitted before the webhook can still be updated.
+func ValidateServiceAnnotations(cfg *CloudConfig, service, old *v1.Service) field.ErrorList {
+	annotationsPath := field.NewPath("metadata", "annotations")
+	annotations := service.Annotations
+	allErrs := field.ErrorList{}
+	changed := func(keys ...string) bool {
+		if old == nil {
+			return true
+		}
+		for _, key := range keys {
+			value, found := annotations[key]
+			oldValue, oldFound := old.Annotations[key]
+			if found != oldFound || value != oldValue {
+				return true
+			}
+		}
+		return false
+	}
+
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		validate, found := annotationValidators[key]
+		if !found || !changed(key) {
+			continue
+		}
+		if err := validate(annotations[key]); err != nil {
+			allErrs = append(allErrs, field.Invalid(annotationsPath.Key(key), annotations[key], err.Error()))
+		}
+	}
+
+	if annotations[ServiceAnnotationLoadBalancerSubnetID] != "" && annotations[ServiceAnnotationLoadBalancerSubnetIDs] != "" &&
+		changed(ServiceAnnotationLoadBalancerSubnetID, ServiceAnnotationLoadBalancerSubnetIDs) {
+		allErrs = append(allErrs, field.Forbidden(annotationsPath.Key(ServiceAnnotationLoadBalancerSubnetIDs),
+			fmt.Sprintf("mutually exclusive with %s", ServiceAnnotationLoadBalancerSubnetID)))
+	}
+	if annotations[ServiceAnnotationLoadBalancerSubnetAZ] != "" &&
+		(annotations[ServiceAnnotationLoadBalancerSubnetID] != "" || annotations[ServiceAnnotationLoadBalancerSubnetIDs] != "") &&
+		changed(ServiceAnnotationLoadBalancerSubnetAZ, ServiceAnnotationLoadBalancerSubnetID, ServiceAnnotationLoadBalancerSubnetIDs) {
+		allErrs = append(allErrs, field.Forbidden(annotationsPath.Key(ServiceAnnotationLoadBalancerSubnetAZ),
+			fmt.Sprintf("mutually exclusive with %s and %s", ServiceAnnotationLoadBalancerSubnetID, ServiceAnnotationLoadBalancerSubnetIDs)))
+	}
+
+	// The ranges of the health check parameters are only checked once they are numbers, with
+	// the cluster-wide defaults of the parameters which are not set
+	if len(allErrs) == 0 && changed(ServiceAnnotationLoadBalancerHCHealthyThreshold, ServiceAnnotationLoadBalancerHCUnhealthyThreshold,
+		ServiceAnnotationLoadBalancerHCTimeout, ServiceAnnotationLoadBalancerHCInterval) {
+		if cfg == nil {
+			cfg = &CloudConfig{}
+		}
+		cloud := &Cloud{cfg: cfg}
+		if _, err := cloud.getExpectedHealthCheck("TCP:80", annotations); err != nil {
+			allErrs = append(allErrs, field.Invalid(annotationsPath, "", err.Error()))
+		}
+	}
+
+	if service.Spec.Type == v1.ServiceTypeLoadBalancer &&
+		(old == nil || old.Spec.Type != service.Spec.Type || !equality.Semantic.DeepEqual(old.Spec.Ports, service.Spec.Ports) ||
+			changed(ServiceAnnotationLoadBalancerSSLPorts, ServiceAnnotationLoadBalancerCertificate,
+				ServiceAnnotationLoadBalancerBEProtocol, ServiceAnnotationLoadBalancerBEProtocolMap)) {
+		sslPorts := getPortSets(annotations[ServiceAnnotationLoadBalancerSSLPorts])
+		for i, port := range service.Spec.Ports {
+			if _, err := buildListener(port, annotations, sslPorts); err != nil {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "ports").Index(i), port.Port, err.Error()))
+			}
+		}
+	}
+	return allErrs
+}
+
+// loadBalancerAttributeValidator checks an annotation of the attributes of the load balancer
+func loadBalancerAttributeValidator(key string) func(value string) error {
+	return func(value string) error {
+		_, err := getLoadBalancerAttributes(map[string]string{
+			// The access log annotations are only parsed along with the bucket
+			ServiceAnnotationLoadBalancerAccessLogS3BucketName:   "bucket",
+			ServiceAnnotationLoadBalancerAccessLogS3BucketPrefix: "prefix",
+			key: value,
+		})
+		return err
+	}
+}
+
+// healthCheckValidator checks that an annotation of the health check is a number, its range
+// being checked with the other parameters of the health check
+func healthCheckValidator(key string) func(value string) error {
+	return func(value string) error {
+		_, err := getHealthCheckParameter(map[string]string{key: value}, key, 0)
+		return err
+	}
+}
+
+// validateSecurityGroupIDs checks a comma separated list of security group IDs
+func validateSecurityGroupIDs(value string) error {
+	return validateIDs(value, securityGroupIDRegexp, "security group")
+}
+
+// validateSubnetIDs checks a comma separated list of subnet IDs
+func validateSubnetIDs(value string) error {
+	return validateIDs(value, subnetIDRegexp, "subnet")
+}
+
+func validateIDs(value string, re *regexp.Regexp, kind string) error {
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !re.MatchString(id) {
+			return fmt.Errorf("%q is not a valid %s ID", id, kind)
+		}
+	}
+	return nil
+}
+
+func backendProtocols() []string {
+	protocols := make([]string, 0, len(backendProtocolMapping))
+	for protocol := range backendProtocolMapping {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+	return protocols
+}
+
+// AnnotationValidationHandler serves the admission reviews of a validating webhook for
+// services, rejecting the services whose load balancer annotations are invalid for a CCM
+// configured with cfg. The services being deleted are not checked.
+func AnnotationValidationHandler(cfg *CloudConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		review := admissionv1.AdmissionReview{}
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+			http.Error(w, fmt.Sprintf("invalid admission review: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		response := &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+		service := &v1.Service{}
+		var old *v1.Service
+		err := json.Unmarshal(review.Request.Object.Raw, service)
+		if err == nil && review.Request.Operation == admissionv1.Update && len(review.Request.OldObject.Raw) > 0 {
+			old = &v1.Service{}
+			err = json.Unmarshal(review.Request.OldObject.Raw, old)
+		}
+		if err != nil {
+			response.Allowed = false
+			response.Result = &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: fmt.Sprintf("unable to decode service: %v", err),
+				Reason:  metav1.StatusReasonBadRequest,
+				Code:    http.StatusBadRequest,
+			}
+		} else if service.DeletionTimestamp != nil {
+			// The finalizers of a service being deleted must be removable whatever its annotations
+			klog.V(4).Infof("Admitting service %s/%s being deleted", review.Request.Namespace, review.Request.Name)
+		} else if allErrs := ValidateServiceAnnotations(cfg, service, old); len(allErrs) > 0 {
+			klog.V(2).Infof("Rejecting service %s/%s: %v", review.Request.Namespace, review.Request.Name, allErrs)
+			response.Allowed = false
+			response.Result = &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: allErrs.ToAggregate().Error(),
+				Reason:  metav1.StatusReasonInvalid,
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+
+		review.Response = response
+		review.Request = nil
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&review); err != nil {
+			klog.Errorf("Unable to write admission review: %v", err)
+		}
+	})
+}
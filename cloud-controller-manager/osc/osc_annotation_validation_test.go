@@ -0,0 +1,242 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func annotatedService(annotations map[string]string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: annotations},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Port: 443, Protocol: v1.ProtocolTCP}},
+		},
+	}
+}
+
+func TestValidateServiceAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		fields      []string
+	}{
+		{
+			name: "valid",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerProxyProtocol:             "*",
+				ServiceAnnotationLoadBalancerConnectionIdleTimeout:     "120",
+				ServiceAnnotationLoadBalancerHCInterval:                "10",
+				ServiceAnnotationLoadBalancerSubnetIDs:                 "subnet-a0000001, subnet-b0000001",
+				ServiceAnnotationLoadBalancerExtraSecurityGroups:       "sg-0000000a",
+				ServiceAnnotationLoadBalancerBEProtocol:                "http",
+				ServiceAnnotationLoadBalancerDrainOnDelete:             "30",
+				ServiceAnnotationLoadBalancerSecurityGroupSelector:     "role=lb",
+				ServiceAnnotationLoadBalancerConnectionDrainingEnabled: "true",
+			},
+		},
+		{
+			name: "malformed values",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerProxyProtocol:         "tcp",
+				ServiceAnnotationLoadBalancerConnectionIdleTimeout: "2m",
+				ServiceAnnotationLoadBalancerAccessLogEnabled:      "yes",
+				ServiceAnnotationLoadBalancerSecurityGroups:        "default",
+				ServiceAnnotationLoadBalancerBEProtocol:            "grpc",
+			},
+			fields: []string{
+				"metadata.annotations[" + ServiceAnnotationLoadBalancerConnectionIdleTimeout + "]",
+				"metadata.annotations[" + ServiceAnnotationLoadBalancerProxyProtocol + "]",
+				"metadata.annotations[" + ServiceAnnotationLoadBalancerAccessLogEnabled + "]",
+				"metadata.annotations[" + ServiceAnnotationLoadBalancerBEProtocol + "]",
+				"metadata.annotations[" + ServiceAnnotationLoadBalancerSecurityGroups + "]",
+			},
+		},
+		{
+			name: "unsupported private IP",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerInternal:  "true",
+				ServiceAnnotationLoadBalancerPrivateIP: "10.0.1.10",
+			},
+			fields: []string{"metadata.annotations[" + ServiceAnnotationLoadBalancerPrivateIP + "]"},
+		},
+		{
+			name: "unknown profile",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerProfile: "quic",
+			},
+			fields: []string{"metadata.annotations[" + ServiceAnnotationLoadBalancerProfile + "]"},
+		},
+		{
+			name: "mutually exclusive subnets",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerSubnetID:  "subnet-a0000001",
+				ServiceAnnotationLoadBalancerSubnetIDs: "subnet-a0000001",
+			},
+			fields: []string{"metadata.annotations[" + ServiceAnnotationLoadBalancerSubnetIDs + "]"},
+		},
+		{
+			name: "subregion and subnet",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerSubnetID: "subnet-a0000001",
+				ServiceAnnotationLoadBalancerSubnetAZ: "eu-west-2b",
+			},
+			fields: []string{"metadata.annotations[" + ServiceAnnotationLoadBalancerSubnetAZ + "]"},
+		},
+		{
+			name: "malformed subregion",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerSubnetAZ: "eu-west-2",
+			},
+			fields: []string{"metadata.annotations[" + ServiceAnnotationLoadBalancerSubnetAZ + "]"},
+		},
+		{
+			name: "subregion",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerSubnetAZ: "cloudgouv-eu-west-1a",
+			},
+		},
+		{
+			name: "health check out of range",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHCHealthyThreshold: "1",
+			},
+			fields: []string{"metadata.annotations"},
+		},
+		{
+			name: "invalid backend protocol of a TLS listener",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerCertificate: "arn:aws:iam::123456789012:server-certificate/web",
+				ServiceAnnotationLoadBalancerBEProtocol:  "udp",
+			},
+			fields: []string{
+				"metadata.annotations[" + ServiceAnnotationLoadBalancerBEProtocol + "]",
+				"spec.ports[0]",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allErrs := ValidateServiceAnnotations(&CloudConfig{}, annotatedService(test.annotations), nil)
+			fields := []string{}
+			for _, err := range allErrs {
+				fields = append(fields, err.Field)
+			}
+			assert.ElementsMatch(t, test.fields, fields, allErrs.ToAggregate())
+		})
+	}
+}
+
+func TestValidateServiceAnnotationsUpdate(t *testing.T) {
+	old := annotatedService(map[string]string{
+		ServiceAnnotationLoadBalancerHCTimeout:  "five",
+		ServiceAnnotationLoadBalancerSubnetID:   "subnet-a0000001",
+		ServiceAnnotationLoadBalancerSubnetIDs:  "subnet-a0000001",
+		ServiceAnnotationLoadBalancerBEProtocol: "http",
+	})
+
+	// The invalid annotations admitted before are left alone
+	service := old.DeepCopy()
+	service.Annotations[ServiceAnnotationLoadBalancerConnectionIdleTimeout] = "120"
+	assert.Empty(t, ValidateServiceAnnotations(&CloudConfig{}, service, old))
+
+	service.Annotations[ServiceAnnotationLoadBalancerHCTimeout] = "six"
+	service.Annotations[ServiceAnnotationLoadBalancerSubnetIDs] = "subnet-b0000001"
+	fields := []string{}
+	for _, err := range ValidateServiceAnnotations(&CloudConfig{}, service, old) {
+		fields = append(fields, err.Field)
+	}
+	assert.ElementsMatch(t, []string{
+		"metadata.annotations[" + ServiceAnnotationLoadBalancerHCTimeout + "]",
+		"metadata.annotations[" + ServiceAnnotationLoadBalancerSubnetIDs + "]",
+	}, fields)
+
+	// The listeners are checked again when their annotations change
+	service = old.DeepCopy()
+	service.Annotations[ServiceAnnotationLoadBalancerBEProtocol] = "udp"
+	service.Annotations[ServiceAnnotationLoadBalancerCertificate] = "arn:aws:iam::123456789012:server-certificate/web"
+	assert.NotEmpty(t, ValidateServiceAnnotations(&CloudConfig{}, service, old))
+}
+
+func TestAnnotationValidationHandler(t *testing.T) {
+	review := func(service *v1.Service, old ...*v1.Service) *admissionv1.AdmissionResponse {
+		raw, err := json.Marshal(service)
+		assert.NoError(t, err)
+		request := &admissionv1.AdmissionRequest{
+			UID:       types.UID("review-1"),
+			Name:      service.Name,
+			Namespace: service.Namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}
+		if len(old) > 0 {
+			request.Operation = admissionv1.Update
+			request.OldObject.Raw, err = json.Marshal(old[0])
+			assert.NoError(t, err)
+		}
+		body, err := json.Marshal(&admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request:  request,
+		})
+		assert.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+		AnnotationValidationHandler(&CloudConfig{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		result := admissionv1.AdmissionReview{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		assert.Equal(t, "AdmissionReview", result.Kind)
+		assert.Equal(t, types.UID("review-1"), result.Response.UID)
+		return result.Response
+	}
+
+	response := review(annotatedService(map[string]string{ServiceAnnotationLoadBalancerHCTimeout: "5"}))
+	assert.True(t, response.Allowed)
+
+	invalid := annotatedService(map[string]string{ServiceAnnotationLoadBalancerHCTimeout: "five"})
+	response = review(invalid)
+	assert.False(t, response.Allowed)
+	assert.Contains(t, response.Result.Message, ServiceAnnotationLoadBalancerHCTimeout)
+
+	// The annotations which did not change are not checked on update
+	updated := invalid.DeepCopy()
+	updated.Labels = map[string]string{"app": "web"}
+	assert.True(t, review(updated, invalid).Allowed)
+
+	// A service being deleted is admitted, so that its finalizers can be removed
+	deleted := invalid.DeepCopy()
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+	assert.True(t, review(deleted).Allowed)
+
+	recorder := httptest.NewRecorder()
+	AnnotationValidationHandler(&CloudConfig{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader([]byte("{"))))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM API Call Budget *********************
+
+const (
+	// defaultAPICallBudgetWindow is the window of the API call budget when
+	// LoadBalancerAPICallBudgetWindowSeconds is not set
+	defaultAPICallBudgetWindow = 10 * time.Minute
+	// apiCallBudgetBaseDelay and apiCallBudgetMaxDelay bound the delay of the
+	// reconciliations of a load balancer over budget, doubled every time it is exceeded
+	apiCallBudgetBaseDelay = time.Minute
+	apiCallBudgetMaxDelay  = 30 * time.Minute
+
+	// EventAPICallBudgetExceeded is recorded when the load balancer of a service exceeds its
+	// API call budget
+	EventAPICallBudgetExceeded = "APICallBudgetExceeded"
+)
+
+// apiCallBudget limits the mutating LBU calls made for each load balancer within a window, so
+// that a single Service whose reconciliation keeps changing its load balancer (e.g. flapping
+// annotations) can't monopolize the API quota of the account. The reads are not counted,
+// since the background controllers read the load balancers periodically.
+type apiCallBudget struct {
+	budget     int
+	window     time.Duration
+	mutex      sync.Mutex
+	states     map[string]*apiCallBudgetState
+	timeSource func() time.Time
+}
+
+// apiCallBudgetState holds the API calls of a single load balancer
+type apiCallBudgetState struct {
+	windowStart time.Time
+	calls       int
+	// Number of consecutive windows over budget
+	exceeded     int
+	blockedUntil time.Time
+}
+
+func newAPICallBudget(budget int, window time.Duration) *apiCallBudget {
+	if window <= 0 {
+		window = defaultAPICallBudgetWindow
+	}
+	return &apiCallBudget{
+		budget:     budget,
+		window:     window,
+		states:     make(map[string]*apiCallBudgetState),
+		timeSource: time.Now,
+	}
+}
+
+func (b *apiCallBudget) enabled() bool {
+	return b != nil && b.budget > 0
+}
+
+// apiCallBudgetDelay returns the delay of the reconciliations of a load balancer over budget
+// exceeded times in a row
+func apiCallBudgetDelay(exceeded int) time.Duration {
+	delay := apiCallBudgetBaseDelay
+	for i := 1; i < exceeded && delay < apiCallBudgetMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > apiCallBudgetMaxDelay {
+		delay = apiCallBudgetMaxDelay
+	}
+	return delay
+}
+
+// state returns the state of the load balancer, starting a new window when the current one
+// is over. Must be called with the mutex held.
+func (b *apiCallBudget) state(loadBalancerName string, now time.Time) *apiCallBudgetState {
+	state, found := b.states[loadBalancerName]
+	if !found {
+		state = &apiCallBudgetState{windowStart: now}
+		b.states[loadBalancerName] = state
+	}
+	if now.Sub(state.windowStart) >= b.window {
+		if state.calls < b.budget {
+			state.exceeded = 0
+		}
+		state.windowStart = now
+		state.calls = 0
+	}
+	return state
+}
+
+// charge counts an API call of the load balancer
+func (b *apiCallBudget) charge(loadBalancerName string) {
+	if !b.enabled() || loadBalancerName == "" {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.state(loadBalancerName, b.timeSource()).calls++
+}
+
+// admit returns an error while the reconciliations of the load balancer are delayed, and
+// whether the load balancer just exceeded its budget
+func (b *apiCallBudget) admit(loadBalancerName string) (bool, error) {
+	if !b.enabled() {
+		return false, nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.timeSource()
+	state := b.state(loadBalancerName, now)
+	if now.Before(state.blockedUntil) {
+		return false, fmt.Errorf("load balancer %s exceeded its budget of %d API calls per %v, next reconciliation in %v",
+			loadBalancerName, b.budget, b.window, state.blockedUntil.Sub(now).Round(time.Second))
+	}
+	if state.calls < b.budget {
+		return false, nil
+	}
+
+	calls := state.calls
+	state.exceeded++
+	delay := apiCallBudgetDelay(state.exceeded)
+	state.blockedUntil = now.Add(delay)
+	// A new budget is granted once the delay is over
+	state.windowStart = state.blockedUntil
+	state.calls = 0
+	return true, fmt.Errorf("load balancer %s made %d API calls, over its budget of %d per %v, next reconciliation in %v",
+		loadBalancerName, calls, b.budget, b.window, delay)
+}
+
+// forget drops the API calls of the load balancer
+func (b *apiCallBudget) forget(loadBalancerName string) {
+	if !b.enabled() {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.states, loadBalancerName)
+}
+
+// admitLoadBalancerReconciliation returns an error while the load balancer of the service is
+// over its API call budget, and reports an APICallBudgetExceeded event when it exceeds it.
+func (c *Cloud) admitLoadBalancerReconciliation(service *v1.Service, loadBalancerName string) error {
+	exceeded, err := c.apiBudget.admit(loadBalancerName)
+	if exceeded {
+		klog.Warningf("Delaying the reconciliations of load balancer %s: %v", loadBalancerName, err)
+		if c.eventRecorder != nil {
+			c.eventRecorder.Eventf(service, v1.EventTypeWarning, EventAPICallBudgetExceeded,
+				"Delaying the reconciliations: %v", err)
+		}
+	}
+	return err
+}
+
+// budgetedLoadBalancer charges the mutating LBU calls to the budget of their load balancer
+type budgetedLoadBalancer struct {
+	LoadBalancer
+	budget *apiCallBudget
+}
+
+func newBudgetedLoadBalancer(loadBalancer LoadBalancer, budget *apiCallBudget) LoadBalancer {
+	if !budget.enabled() {
+		return loadBalancer
+	}
+	return &budgetedLoadBalancer{LoadBalancer: loadBalancer, budget: budget}
+}
+
+func (b *budgetedLoadBalancer) chargeAll(loadBalancerNames []*string) {
+	for _, name := range loadBalancerNames {
+		b.budget.charge(aws.StringValue(name))
+	}
+}
+
+func (b *budgetedLoadBalancer) CreateLoadBalancer(input *elb.CreateLoadBalancerInput) (*elb.CreateLoadBalancerOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.CreateLoadBalancer(input)
+}
+
+func (b *budgetedLoadBalancer) DeleteLoadBalancer(input *elb.DeleteLoadBalancerInput) (*elb.DeleteLoadBalancerOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.DeleteLoadBalancer(input)
+}
+
+func (b *budgetedLoadBalancer) AddTags(input *elb.AddTagsInput) (*elb.AddTagsOutput, error) {
+	b.chargeAll(input.LoadBalancerNames)
+	return b.LoadBalancer.AddTags(input)
+}
+
+func (b *budgetedLoadBalancer) RemoveTags(input *elb.RemoveTagsInput) (*elb.RemoveTagsOutput, error) {
+	b.chargeAll(input.LoadBalancerNames)
+	return b.LoadBalancer.RemoveTags(input)
+}
+
+func (b *budgetedLoadBalancer) RegisterInstancesWithLoadBalancer(input *elb.RegisterInstancesWithLoadBalancerInput) (*elb.RegisterInstancesWithLoadBalancerOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.RegisterInstancesWithLoadBalancer(input)
+}
+
+func (b *budgetedLoadBalancer) DeregisterInstancesFromLoadBalancer(input *elb.DeregisterInstancesFromLoadBalancerInput) (*elb.DeregisterInstancesFromLoadBalancerOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.DeregisterInstancesFromLoadBalancer(input)
+}
+
+func (b *budgetedLoadBalancer) CreateLoadBalancerPolicy(input *elb.CreateLoadBalancerPolicyInput) (*elb.CreateLoadBalancerPolicyOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.CreateLoadBalancerPolicy(input)
+}
+
+func (b *budgetedLoadBalancer) CreateLBCookieStickinessPolicy(input *elb.CreateLBCookieStickinessPolicyInput) (*elb.CreateLBCookieStickinessPolicyOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.CreateLBCookieStickinessPolicy(input)
+}
+
+func (b *budgetedLoadBalancer) CreateAppCookieStickinessPolicy(input *elb.CreateAppCookieStickinessPolicyInput) (*elb.CreateAppCookieStickinessPolicyOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.CreateAppCookieStickinessPolicy(input)
+}
+
+func (b *budgetedLoadBalancer) SetLoadBalancerPoliciesForBackendServer(input *elb.SetLoadBalancerPoliciesForBackendServerInput) (*elb.SetLoadBalancerPoliciesForBackendServerOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.SetLoadBalancerPoliciesForBackendServer(input)
+}
+
+func (b *budgetedLoadBalancer) SetLoadBalancerPoliciesOfListener(input *elb.SetLoadBalancerPoliciesOfListenerInput) (*elb.SetLoadBalancerPoliciesOfListenerOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.SetLoadBalancerPoliciesOfListener(input)
+}
+
+func (b *budgetedLoadBalancer) DeleteLoadBalancerPolicy(input *elb.DeleteLoadBalancerPolicyInput) (*elb.DeleteLoadBalancerPolicyOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.DeleteLoadBalancerPolicy(input)
+}
+
+func (b *budgetedLoadBalancer) DetachLoadBalancerFromSubnets(input *elb.DetachLoadBalancerFromSubnetsInput) (*elb.DetachLoadBalancerFromSubnetsOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.DetachLoadBalancerFromSubnets(input)
+}
+
+func (b *budgetedLoadBalancer) AttachLoadBalancerToSubnets(input *elb.AttachLoadBalancerToSubnetsInput) (*elb.AttachLoadBalancerToSubnetsOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.AttachLoadBalancerToSubnets(input)
+}
+
+func (b *budgetedLoadBalancer) CreateLoadBalancerListeners(input *elb.CreateLoadBalancerListenersInput) (*elb.CreateLoadBalancerListenersOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.CreateLoadBalancerListeners(input)
+}
+
+func (b *budgetedLoadBalancer) DeleteLoadBalancerListeners(input *elb.DeleteLoadBalancerListenersInput) (*elb.DeleteLoadBalancerListenersOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.DeleteLoadBalancerListeners(input)
+}
+
+func (b *budgetedLoadBalancer) ApplySecurityGroupsToLoadBalancer(input *elb.ApplySecurityGroupsToLoadBalancerInput) (*elb.ApplySecurityGroupsToLoadBalancerOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.ApplySecurityGroupsToLoadBalancer(input)
+}
+
+func (b *budgetedLoadBalancer) ConfigureHealthCheck(input *elb.ConfigureHealthCheckInput) (*elb.ConfigureHealthCheckOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.ConfigureHealthCheck(input)
+}
+
+func (b *budgetedLoadBalancer) ModifyLoadBalancerAttributes(input *elb.ModifyLoadBalancerAttributesInput) (*elb.ModifyLoadBalancerAttributesOutput, error) {
+	b.budget.charge(aws.StringValue(input.LoadBalancerName))
+	return b.LoadBalancer.ModifyLoadBalancerAttributes(input)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestAPICallBudget(t *testing.T) {
+	now := time.Now()
+	budget := newAPICallBudget(3, time.Minute)
+	budget.timeSource = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		exceeded, err := budget.admit("lb")
+		assert.False(t, exceeded)
+		assert.NoError(t, err)
+		budget.charge("lb")
+	}
+	// Other load balancers have their own budget
+	_, err := budget.admit("other")
+	assert.NoError(t, err)
+
+	exceeded, err := budget.admit("lb")
+	assert.True(t, exceeded)
+	assert.Error(t, err)
+	exceeded, err = budget.admit("lb")
+	assert.False(t, exceeded)
+	assert.Error(t, err)
+
+	// A new budget is granted after the delay, which doubles when exceeded again
+	now = now.Add(apiCallBudgetBaseDelay)
+	_, err = budget.admit("lb")
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		budget.charge("lb")
+	}
+	exceeded, err = budget.admit("lb")
+	assert.True(t, exceeded)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "next reconciliation in 2m0s")
+	}
+
+	// The delay is reset after a window under budget
+	now = now.Add(2*apiCallBudgetBaseDelay + time.Minute)
+	_, err = budget.admit("lb")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, budget.states["lb"].exceeded)
+
+	budget.forget("lb")
+	assert.NotContains(t, budget.states, "lb")
+
+	assert.Equal(t, apiCallBudgetMaxDelay, apiCallBudgetDelay(10))
+	var disabled *apiCallBudget
+	disabled.charge("lb")
+	_, err = disabled.admit("lb")
+	assert.NoError(t, err)
+}
+
+func TestEnsureLoadBalancerAPICallBudget(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	cfg := CloudConfig{}
+	cfg.Global.LoadBalancerAPICallBudget = 2
+	c, err := newCloud(cfg, awsServices)
+	assert.NoError(t, err)
+	c.vpcID = "vpc-123456"
+	recorder := record.NewFakeRecorder(20)
+	c.eventRecorder = recorder
+
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+	}) {
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "flapping", UID: "anuid"},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports:           []v1.ServicePort{{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP}},
+		},
+	}
+
+	// The creation makes more calls than the budget, the next reconciliations are delayed
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.NoError(t, err)
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.Error(t, err)
+	err = c.UpdateLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.Error(t, err)
+
+	events := []string{}
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	assert.Equal(t, 1, strings.Count(strings.Join(events, "\n"), EventAPICallBudgetExceeded))
+
+	// The deletion is not delayed (the fake load balancer has no security group to delete)
+	err = c.EnsureLoadBalancerDeleted(context.TODO(), TestClusterName, service)
+	if err != nil {
+		assert.NotContains(t, err.Error(), "budget")
+	}
+	assert.NotContains(t, c.apiBudget.states, c.GetLoadBalancerName(context.TODO(), TestClusterName, service))
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"golang.org/x/net/http/httpproxy"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM API Clients *********************
+
+const (
+	// Name of the oAPI, metadata and DNS services in the endpoints of the API clients, the
+	// other services being named as in the Outscale endpoints (lbu, eim, oos)
+	oapiServiceName     = "api"
+	metadataServiceName = "metadata"
+	dnsServiceName      = "dns"
+	// regionPlaceholder is replaced with the region of the client in the endpoints
+	regionPlaceholder = "{region}"
+	// metadataTimeout is the timeout of the metadata calls, as the default client of the SDK
+	metadataTimeout = 5 * time.Second
+)
+
+// apiClientSettings holds the endpoints and the TLS and proxy settings of the API clients,
+// for the installations of Outscale-compatible APIs, e.g. air-gapped or on-premises
+type apiClientSettings struct {
+	// Endpoints by service name, possibly containing the region placeholder
+	endpoints map[string]string
+	// Endpoints of a service in a region, as the [ServiceOverride] sections
+	overrides []*serviceOverride
+	// Transports of the API and metadata clients, nil when using the default transport
+	transport         http.RoundTripper
+	metadataTransport http.RoundTripper
+}
+
+// apiClients are the settings of the API clients built by the cloud provider, set from the
+// cloud config when it is registered
+var apiClients = &apiClientSettings{}
+
+// newAPIClientSettings returns the settings of the API clients from the cloud config
+func newAPIClientSettings(cfg *CloudConfig) (*apiClientSettings, error) {
+	settings := &apiClientSettings{endpoints: make(map[string]string)}
+	for service, endpoint := range map[string]string{
+		oapiServiceName:     cfg.Global.EndpointAPI,
+		"lbu":               cfg.Global.EndpointLBU,
+		"eim":               cfg.Global.EndpointEIM,
+		"oos":               cfg.Global.EndpointOOS,
+		metadataServiceName: cfg.Global.EndpointMetadata,
+		dnsServiceName:      cfg.Global.EndpointDNS,
+	} {
+		if endpoint == "" {
+			continue
+		}
+		u, err := url.Parse(strings.ReplaceAll(endpoint, regionPlaceholder, "region"))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q of service %s, expected an absolute URL", endpoint, service)
+		}
+		settings.endpoints[service] = endpoint
+	}
+	for _, override := range cfg.ServiceOverride {
+		settings.overrides = append(settings.overrides, override)
+	}
+
+	if cfg.Global.CABundle == "" && !cfg.Global.InsecureSkipVerify && cfg.Global.Proxy == "" && cfg.Global.NoProxy == "" {
+		return settings, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.Global.CABundle != "" {
+		pem, err := os.ReadFile(cfg.Global.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			klog.Warningf("Unable to load the system certificate authorities, only trusting the CA bundle: %v", err)
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the CA bundle %s", cfg.Global.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.Global.InsecureSkipVerify {
+		klog.Warningf("The certificates of the API endpoints are not verified")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	proxy := httpproxy.FromEnvironment()
+	if cfg.Global.Proxy != "" {
+		if u, err := url.Parse(cfg.Global.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q, expected an absolute URL", cfg.Global.Proxy)
+		}
+		proxy.HTTPProxy = cfg.Global.Proxy
+		proxy.HTTPSProxy = cfg.Global.Proxy
+	}
+	if cfg.Global.NoProxy != "" {
+		proxy.NoProxy = cfg.Global.NoProxy
+	}
+	proxyFunc := proxy.ProxyFunc()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	settings.transport = transport
+
+	// The metadata service is link-local, it is never reached through the proxy
+	metadataTransport := transport.Clone()
+	metadataTransport.Proxy = nil
+	settings.metadataTransport = metadataTransport
+	return settings, nil
+}
+
+// endpoint returns the configured endpoint of the service in the region, if any
+func (s *apiClientSettings) endpoint(service string, region string) string {
+	return strings.ReplaceAll(s.endpoints[service], regionPlaceholder, region)
+}
+
+// resolve returns the endpoint of the AWS compatible service in the region from the service
+// overrides, or else from the endpoint of the Outscale service
+func (s *apiClientSettings) resolve(service, oscService, region string) (endpoints.ResolvedEndpoint, bool) {
+	for _, override := range s.overrides {
+		if override.Service == service && override.Region == region {
+			return endpoints.ResolvedEndpoint{
+				URL:           override.URL,
+				SigningRegion: override.SigningRegion,
+				SigningMethod: override.SigningMethod,
+				SigningName:   override.SigningName,
+			}, true
+		}
+	}
+	if url := s.endpoint(oscService, region); url != "" {
+		return endpoints.ResolvedEndpoint{
+			URL:           url,
+			SigningRegion: region,
+			SigningName:   service,
+		}, true
+	}
+	return endpoints.ResolvedEndpoint{}, false
+}
+
+// httpClient returns the HTTP client of the AWS SDK clients, nil for the default one
+func (s *apiClientSettings) httpClient() *http.Client {
+	if s.transport == nil {
+		return nil
+	}
+	return &http.Client{Transport: s.transport}
+}
+
+// metadataHTTPClient returns the HTTP client of the metadata clients, nil for the default one
+func (s *apiClientSettings) metadataHTTPClient() *http.Client {
+	if s.metadataTransport == nil {
+		return nil
+	}
+	return &http.Client{Transport: s.metadataTransport, Timeout: metadataTimeout}
+}
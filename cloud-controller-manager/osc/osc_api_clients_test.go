@@ -0,0 +1,141 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIClientEndpoints(t *testing.T) {
+	t.Setenv("OSC_ENDPOINT_LBU", "")
+	t.Setenv("OSC_ENDPOINT_EIM", "")
+	cfg := &CloudConfig{}
+	cfg.Global.EndpointAPI = "https://api.{region}.example.com/api/v1"
+	cfg.Global.EndpointLBU = "https://lbu.{region}.example.com"
+	cfg.Global.EndpointMetadata = "http://metadata.example.com/latest"
+	cfg.ServiceOverride = map[string]*serviceOverride{
+		"1": {Service: endpoints.ElasticloadbalancingServiceID, Region: "eu-west-2", URL: "https://lbu.example.net", SigningRegion: "eu-west-2"},
+	}
+	settings, err := newAPIClientSettings(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, settings.httpClient())
+
+	previous := apiClients
+	apiClients = settings
+	defer func() { apiClients = previous }()
+
+	assert.Equal(t, "https://api.cloudgouv-eu-west-1.example.com/api/v1", apiClients.endpoint(oapiServiceName, "cloudgouv-eu-west-1"))
+	resolve := SetupServiceResolver("us-east-2")
+	resolved, err := resolve(endpoints.ElasticloadbalancingServiceID, "us-east-2")
+	require.NoError(t, err)
+	assert.Equal(t, "https://lbu.us-east-2.example.com", resolved.URL)
+	// The service overrides take precedence
+	resolved, err = resolve(endpoints.ElasticloadbalancingServiceID, "eu-west-2")
+	require.NoError(t, err)
+	assert.Equal(t, "https://lbu.example.net", resolved.URL)
+	resolved, err = resolve(endpoints.IamServiceID, "us-east-2")
+	require.NoError(t, err)
+	assert.Equal(t, "https://eim.us-east-2.outscale.com", resolved.URL)
+	// The environment takes precedence
+	t.Setenv("OSC_ENDPOINT_LBU", "https://lbu.example.org")
+	resolved, err = resolve(endpoints.ElasticloadbalancingServiceID, "us-east-2")
+	require.NoError(t, err)
+	assert.Equal(t, "https://lbu.example.org", resolved.URL)
+
+	resolved, err = SetupMetadataResolver()("ec2metadata", "")
+	require.NoError(t, err)
+	assert.Equal(t, "http://metadata.example.com/latest", resolved.URL)
+
+	cfg.Global.EndpointOOS = "oos.example.com"
+	_, err = newAPIClientSettings(cfg)
+	assert.EqualError(t, err, `invalid endpoint "oos.example.com" of service oos, expected an absolute URL`)
+}
+
+func TestAPIClientCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	cfg := &CloudConfig{}
+	cfg.Global.CABundle = filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(cfg.Global.CABundle,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	settings, err := newAPIClientSettings(cfg)
+	require.NoError(t, err)
+	resp, err := settings.httpClient().Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// The certificate is not trusted without the CA bundle
+	cfg.Global.CABundle = ""
+	cfg.Global.NoProxy = "example.com"
+	settings, err = newAPIClientSettings(cfg)
+	require.NoError(t, err)
+	_, err = settings.httpClient().Get(server.URL)
+	assert.ErrorContains(t, err, "certificate")
+
+	cfg.Global.InsecureSkipVerify = true
+	settings, err = newAPIClientSettings(cfg)
+	require.NoError(t, err)
+	resp, err = settings.httpClient().Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	cfg.Global.CABundle = filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(cfg.Global.CABundle, []byte("no certificate"), 0600))
+	_, err = newAPIClientSettings(cfg)
+	assert.ErrorContains(t, err, "no certificate found in the CA bundle")
+}
+
+func TestAPIClientProxy(t *testing.T) {
+	hosts := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.URL.Host)
+	}))
+	defer proxy.Close()
+
+	cfg := &CloudConfig{}
+	cfg.Global.Proxy = proxy.URL
+	cfg.Global.NoProxy = "internal.example.com"
+	settings, err := newAPIClientSettings(cfg)
+	require.NoError(t, err)
+
+	resp, err := settings.httpClient().Get("http://api.example.com/api/v1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{"api.example.com"}, hosts)
+
+	// The hosts of NoProxy and the metadata service are not reached through the proxy
+	request, err := http.NewRequest(http.MethodGet, "http://internal.example.com", nil)
+	require.NoError(t, err)
+	proxyURL, err := settings.transport.(*http.Transport).Proxy(request)
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL)
+	assert.Nil(t, settings.metadataTransport.(*http.Transport).Proxy)
+
+	cfg.Global.Proxy = "proxy:3128"
+	_, err = newAPIClientSettings(cfg)
+	assert.EqualError(t, err, `invalid proxy "proxy:3128", expected an absolute URL`)
+}
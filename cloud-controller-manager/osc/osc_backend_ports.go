@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ********************* CCM Backend Ports *********************
+
+// backendPorts maps the Service ports, by name or by number, to the instance ports of their
+// listeners, which default to the NodePorts
+type backendPorts map[string]int64
+
+// parseBackendPorts parses the comma separated list of "<port name or number>=<instance
+// port>" entries of the ServiceAnnotationLoadBalancerBackendPorts annotation
+func parseBackendPorts(value string) (backendPorts, error) {
+	ports := make(backendPorts)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		port, instancePort, found := strings.Cut(entry, "=")
+		port = strings.ToLower(strings.TrimSpace(port))
+		if !found || port == "" {
+			return nil, fmt.Errorf("backend port %q: expected <port name or number>=<instance port>", entry)
+		}
+		if _, duplicate := ports[port]; duplicate {
+			return nil, fmt.Errorf("backend port %q: port %s is mapped twice", entry, port)
+		}
+		number, err := strconv.ParseInt(strings.TrimSpace(instancePort), 10, 64)
+		if err != nil || number < 1 || number > 65535 {
+			return nil, fmt.Errorf("backend port %q: invalid instance port %q", entry, instancePort)
+		}
+		ports[port] = number
+	}
+	return ports, nil
+}
+
+// getBackendPorts returns the instance ports requested on the service
+func getBackendPorts(annotations map[string]string) (backendPorts, error) {
+	value, found := annotations[ServiceAnnotationLoadBalancerBackendPorts]
+	if !found {
+		return backendPorts{}, nil
+	}
+	ports, err := parseBackendPorts(value)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing service annotation %s=%s: %v", ServiceAnnotationLoadBalancerBackendPorts, value, err)
+	}
+	return ports, nil
+}
+
+// instancePort returns the instance port of the listener of the service port: the port
+// mapped by its name or number, or its NodePort, 0 when it has none
+func (p backendPorts) instancePort(port v1.ServicePort) int64 {
+	if instancePort, found := p[strings.ToLower(port.Name)]; found && port.Name != "" {
+		return instancePort
+	}
+	if instancePort, found := p[strconv.Itoa(int(port.Port))]; found {
+		return instancePort
+	}
+	return int64(port.NodePort)
+}
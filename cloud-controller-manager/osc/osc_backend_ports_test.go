@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseBackendPorts(t *testing.T) {
+	ports, err := parseBackendPorts("http=80, HTTPS = 443,8443=9443")
+	assert.NoError(t, err)
+	assert.Equal(t, backendPorts{"http": 80, "https": 443, "8443": 9443}, ports)
+
+	for _, value := range []string{"http", "=80", "http=0", "http=65536", "http=eighty", "http=80,http=81"} {
+		_, err := parseBackendPorts(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestBackendPortsInstancePort(t *testing.T) {
+	ports := backendPorts{"https": 443, "8080": 8081}
+	assert.Equal(t, int64(443), ports.instancePort(v1.ServicePort{Name: "HTTPS", Port: 443, NodePort: 30443}))
+	assert.Equal(t, int64(8081), ports.instancePort(v1.ServicePort{Name: "web", Port: 8080, NodePort: 30080}))
+	assert.Equal(t, int64(30022), ports.instancePort(v1.ServicePort{Name: "ssh", Port: 22, NodePort: 30022}))
+	assert.Equal(t, int64(0), backendPorts{}.instancePort(v1.ServicePort{Port: 22}))
+}
+
+func TestEnsureLoadBalancerBackendPorts(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.vpcID = "vpc-123456"
+	recorder := record.NewFakeRecorder(20)
+	c.eventRecorder = recorder
+
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+	}) {
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+
+	// Without NodePorts, the listeners forward to the host ports of the ingress controller
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ingress",
+			UID:         "anuid",
+			Annotations: map[string]string{ServiceAnnotationLoadBalancerBackendPorts: "http=80,https=443"},
+		},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports: []v1.ServicePort{
+				{Name: "http", Port: 80, Protocol: v1.ProtocolTCP},
+				{Name: "https", Port: 443, Protocol: v1.ProtocolTCP},
+			},
+		},
+	}
+
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.NoError(t, err)
+	events := []string{}
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	assert.Contains(t, strings.Join(events, "\n"), "with listeners TCP:80->TCP:80, TCP:443->TCP:443")
+}
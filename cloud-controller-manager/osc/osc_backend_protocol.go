@@ -0,0 +1,135 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Backend Protocol *********************
+
+// parseBackendProtocolMap parses the ServiceAnnotationLoadBalancerBEProtocolMap annotation, a
+// comma separated list of "<port number or name>=<protocol>" entries
+func parseBackendProtocolMap(value string) (map[string]string, error) {
+	protocols := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		port, protocol, found := strings.Cut(entry, "=")
+		port = strings.TrimSpace(port)
+		protocol = strings.ToLower(strings.TrimSpace(protocol))
+		if !found || port == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected <port>=<protocol>", entry)
+		}
+		if _, found := backendProtocolMapping[protocol]; !found {
+			return nil, fmt.Errorf("unknown backend protocol %q of port %s, expected one of %v", protocol, port, backendProtocols())
+		}
+		if _, found := protocols[port]; found {
+			return nil, fmt.Errorf("duplicate backend protocol of port %s", port)
+		}
+		protocols[port] = protocol
+	}
+	return protocols, nil
+}
+
+// EventAppProtocolConflict is recorded on a service when the backend protocol annotations of
+// a port conflict with its appProtocol
+const EventAppProtocolConflict = "AppProtocolConflict"
+
+// appProtocolBackendProtocols maps the appProtocol of the service ports to the backend
+// protocols. LBU listeners don't proxy HTTP/2 nor upgrade HTTP connections, so gRPC, h2c and
+// WebSocket are passed through.
+var appProtocolBackendProtocols = map[string]string{
+	"http":              "http",
+	"https":             "https",
+	"grpc":              "tcp",
+	"kubernetes.io/h2c": "tcp",
+	"kubernetes.io/ws":  "tcp",
+	"kubernetes.io/wss": "ssl",
+}
+
+// getAnnotatedBackendProtocol returns the backend protocol of the service port in the
+// ServiceAnnotationLoadBalancerBEProtocolMap annotation, or else the
+// ServiceAnnotationLoadBalancerBEProtocol annotation, and whether one is set
+func getAnnotatedBackendProtocol(port v1.ServicePort, annotations map[string]string) (string, bool, error) {
+	if value, found := annotations[ServiceAnnotationLoadBalancerBEProtocolMap]; found {
+		protocols, err := parseBackendProtocolMap(value)
+		if err != nil {
+			return "", false, fmt.Errorf("error parsing service annotation %s=%s: %v", ServiceAnnotationLoadBalancerBEProtocolMap, value, err)
+		}
+		if protocol, found := protocols[strconv.Itoa(int(port.Port))]; found {
+			return protocol, true, nil
+		}
+		if protocol, found := protocols[port.Name]; found && port.Name != "" {
+			return protocol, true, nil
+		}
+	}
+	protocol := annotations[ServiceAnnotationLoadBalancerBEProtocol]
+	return protocol, protocol != "", nil
+}
+
+// getAppProtocolBackendProtocol returns the backend protocol of the appProtocol of the TCP
+// service port, and whether it is known, when the AppProtocolBackendProtocol feature is enabled
+func getAppProtocolBackendProtocol(port v1.ServicePort) (string, bool) {
+	if !featureEnabled(AppProtocolBackendProtocol) || port.AppProtocol == nil || (port.Protocol != "" && port.Protocol != v1.ProtocolTCP) {
+		return "", false
+	}
+	protocol, found := appProtocolBackendProtocols[strings.ToLower(strings.TrimSpace(*port.AppProtocol))]
+	return protocol, found
+}
+
+// getBackendProtocol returns the backend protocol of the service port: the protocol of its
+// number or name in the ServiceAnnotationLoadBalancerBEProtocolMap annotation, or else the
+// ServiceAnnotationLoadBalancerBEProtocol annotation, or else the protocol of its appProtocol
+func getBackendProtocol(port v1.ServicePort, annotations map[string]string) (string, error) {
+	protocol, annotated, err := getAnnotatedBackendProtocol(port, annotations)
+	if err != nil || annotated {
+		return protocol, err
+	}
+	protocol, _ = getAppProtocolBackendProtocol(port)
+	return protocol, nil
+}
+
+// recordAppProtocolConflicts records an EventAppProtocolConflict warning on the service for
+// each port whose backend protocol annotations override a different protocol of its
+// appProtocol
+func (c *Cloud) recordAppProtocolConflicts(service *v1.Service, annotations map[string]string) {
+	for _, port := range service.Spec.Ports {
+		appProtocol, found := getAppProtocolBackendProtocol(port)
+		if !found {
+			continue
+		}
+		protocol, annotated, err := getAnnotatedBackendProtocol(port, annotations)
+		if err != nil || !annotated || protocol == appProtocol {
+			continue
+		}
+		klog.Warningf("Backend protocol %s of port %d of service %s/%s overrides %s of its appProtocol %s",
+			protocol, port.Port, service.Namespace, service.Name, appProtocol, *port.AppProtocol)
+		if c.eventRecorder != nil {
+			c.eventRecorder.Eventf(service, v1.EventTypeWarning, EventAppProtocolConflict,
+				"Backend protocol %s of port %d from the annotations overrides %s of its appProtocol %s",
+				protocol, port.Port, appProtocol, *port.AppProtocol)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/tools/record"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
+)
+
+func TestParseBackendProtocolMap(t *testing.T) {
+	protocols, err := parseBackendProtocolMap("443=https, 80=HTTP,metrics=tcp")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"443": "https", "80": "http", "metrics": "tcp"}, protocols)
+
+	for _, value := range []string{"443", "=tcp", "443=quic", "443=https,443=tcp"} {
+		_, err := parseBackendProtocolMap(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestBuildListenerWithBackendProtocolMap(t *testing.T) {
+	annotations := map[string]string{
+		ServiceAnnotationLoadBalancerCertificate:   "arn:cert",
+		ServiceAnnotationLoadBalancerSSLPorts:      "443,6443",
+		ServiceAnnotationLoadBalancerBEProtocol:    "tcp",
+		ServiceAnnotationLoadBalancerBEProtocolMap: "443=https,80=http",
+	}
+	sslPorts := getPortSets(annotations[ServiceAnnotationLoadBalancerSSLPorts])
+
+	for _, test := range []struct {
+		port             v1.ServicePort
+		protocol         string
+		instanceProtocol string
+	}{
+		{v1.ServicePort{Port: 443, NodePort: 30443, Protocol: v1.ProtocolTCP}, "HTTPS", "HTTPS"},
+		{v1.ServicePort{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP}, "HTTP", "HTTP"},
+		{v1.ServicePort{Port: 6443, NodePort: 30643, Protocol: v1.ProtocolTCP}, "SSL", "TCP"},
+		{v1.ServicePort{Port: 8080, NodePort: 30880, Protocol: v1.ProtocolTCP}, "TCP", "TCP"},
+	} {
+		listener, err := buildListener(test.port, annotations, sslPorts)
+		assert.NoError(t, err)
+		assert.Equal(t, test.protocol, aws.StringValue(listener.Protocol), test.port.Port)
+		assert.Equal(t, test.instanceProtocol, aws.StringValue(listener.InstanceProtocol), test.port.Port)
+	}
+
+	annotations[ServiceAnnotationLoadBalancerBEProtocolMap] = "443"
+	_, err := buildListener(v1.ServicePort{Port: 443, NodePort: 30443, Protocol: v1.ProtocolTCP}, annotations, sslPorts)
+	assert.Error(t, err)
+}
+
+func TestBuildListenerWithAppProtocol(t *testing.T) {
+	// The appProtocol is ignored unless the feature is enabled
+	listener, err := buildListener(v1.ServicePort{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP, AppProtocol: aws.String("http")},
+		map[string]string{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "TCP", aws.StringValue(listener.Protocol))
+
+	defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, AppProtocolBackendProtocol, true)()
+	annotations := map[string]string{
+		ServiceAnnotationLoadBalancerCertificate: "arn:cert",
+		ServiceAnnotationLoadBalancerSSLPorts:    "443,8443,9443",
+	}
+	sslPorts := getPortSets(annotations[ServiceAnnotationLoadBalancerSSLPorts])
+
+	for _, test := range []struct {
+		port             v1.ServicePort
+		protocol         string
+		instanceProtocol string
+	}{
+		{v1.ServicePort{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP, AppProtocol: aws.String("http")}, "HTTP", "HTTP"},
+		{v1.ServicePort{Port: 443, NodePort: 30443, Protocol: v1.ProtocolTCP, AppProtocol: aws.String("HTTPS")}, "HTTPS", "HTTPS"},
+		{v1.ServicePort{Port: 8443, NodePort: 30843, Protocol: v1.ProtocolTCP, AppProtocol: aws.String("grpc")}, "SSL", "TCP"},
+		{v1.ServicePort{Port: 9443, NodePort: 30943, Protocol: v1.ProtocolTCP, AppProtocol: aws.String("kubernetes.io/wss")}, "SSL", "SSL"},
+		{v1.ServicePort{Port: 8080, NodePort: 30880, Protocol: v1.ProtocolTCP, AppProtocol: aws.String("example.com/custom")}, "TCP", "TCP"},
+		{v1.ServicePort{Port: 9000, NodePort: 30900, Protocol: v1.ProtocolSCTP, AppProtocol: aws.String("http")}, "SCTP", "SCTP"},
+	} {
+		listener, err := buildListener(test.port, annotations, sslPorts)
+		require.NoError(t, err)
+		assert.Equal(t, test.protocol, aws.StringValue(listener.Protocol), test.port.Port)
+		assert.Equal(t, test.instanceProtocol, aws.StringValue(listener.InstanceProtocol), test.port.Port)
+	}
+
+	// The annotations override the appProtocol
+	annotations[ServiceAnnotationLoadBalancerBEProtocolMap] = "443=tcp"
+	listener, err = buildListener(v1.ServicePort{Port: 443, NodePort: 30443, Protocol: v1.ProtocolTCP, AppProtocol: aws.String("https")},
+		annotations, sslPorts)
+	require.NoError(t, err)
+	assert.Equal(t, "SSL", aws.StringValue(listener.Protocol))
+	assert.Equal(t, "TCP", aws.StringValue(listener.InstanceProtocol))
+}
+
+func TestRecordAppProtocolConflicts(t *testing.T) {
+	defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, AppProtocolBackendProtocol, true)()
+	recorder := record.NewFakeRecorder(10)
+	c := &Cloud{eventRecorder: recorder}
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: v1.ServiceSpec{Ports: []v1.ServicePort{
+			{Name: "http", Port: 80, Protocol: v1.ProtocolTCP, AppProtocol: aws.String("http")},
+			{Name: "https", Port: 443, Protocol: v1.ProtocolTCP, AppProtocol: aws.String("https")},
+			{Name: "metrics", Port: 9090, Protocol: v1.ProtocolTCP},
+		}},
+	}
+
+	c.recordAppProtocolConflicts(service, map[string]string{})
+	c.recordAppProtocolConflicts(service, map[string]string{ServiceAnnotationLoadBalancerBEProtocolMap: "http=http,metrics=tcp"})
+	assert.Empty(t, recorder.Events)
+
+	c.recordAppProtocolConflicts(service, map[string]string{
+		ServiceAnnotationLoadBalancerBEProtocol:    "tcp",
+		ServiceAnnotationLoadBalancerBEProtocolMap: "http=http",
+	})
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Equal(t, "Warning "+EventAppProtocolConflict+" Backend protocol tcp of port 443 from the annotations overrides https of its appProtocol https",
+			<-recorder.Events)
+	}
+}
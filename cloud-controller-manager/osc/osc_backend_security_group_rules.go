@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Backend Security Group Rules *********************
+
+// backendRuleGranularity tells which rules of the node security groups let the load
+// balancer reach the nodes
+type backendRuleGranularity string
+
+const (
+	// backendRulesAll opens all the protocols and ports to the load balancer
+	backendRulesAll backendRuleGranularity = "all"
+	// backendRulesPorts opens only the node ports of the listeners and the health check
+	// port, and removes the rules of the ports no longer used
+	backendRulesPorts backendRuleGranularity = "ports"
+)
+
+// parseBackendRuleGranularity parses the granularity of the backend rules, defaulting to all
+func parseBackendRuleGranularity(value string) (backendRuleGranularity, error) {
+	switch granularity := backendRuleGranularity(strings.ToLower(strings.TrimSpace(value))); granularity {
+	case "":
+		return backendRulesAll, nil
+	case backendRulesAll, backendRulesPorts:
+		return granularity, nil
+	default:
+		return "", fmt.Errorf("invalid backend security group rules %q, expected all or ports", value)
+	}
+}
+
+// backendRuleGranularity returns the granularity of the backend rules of the service,
+// defaulting to the BackendSecurityGroupRules of the cloud config. The per port rules are
+// not supported with a shared security group, whose rules would open the ports of every
+// load balancer sharing it.
+func (c *Cloud) backendRuleGranularity(annotations map[string]string, sgMode securityGroupMode) (backendRuleGranularity, error) {
+	value, found := annotations[ServiceAnnotationLoadBalancerBackendSecurityGroupRules]
+	if !found {
+		value = c.cfg.Global.BackendSecurityGroupRules
+	}
+	granularity, err := parseBackendRuleGranularity(value)
+	if err != nil {
+		if found {
+			return "", fmt.Errorf("error parsing service annotation %s=%s: %v", ServiceAnnotationLoadBalancerBackendSecurityGroupRules, value, err)
+		}
+		return "", err
+	}
+	if granularity == backendRulesPorts && sgMode == securityGroupModeShared {
+		return "", fmt.Errorf("the ports backend security group rules are not supported with the %s security group mode", sgMode)
+	}
+	return granularity, nil
+}
+
+// allProtocolsRule returns the rule opening all the protocols and ports to the load balancer
+func allProtocolsRule(loadBalancerSecurityGroupID string) osc.SecurityGroupRule {
+	return backendRule(loadBalancerSecurityGroupID, "-1", -1)
+}
+
+// backendRule returns the rule opening the port to the load balancer
+func backendRule(loadBalancerSecurityGroupID string, protocol string, port int32) osc.SecurityGroupRule {
+	return osc.SecurityGroupRule{
+		IpProtocol:            aws.String(protocol),
+		FromPortRange:         &port,
+		ToPortRange:           &port,
+		SecurityGroupsMembers: &[]osc.SecurityGroupsMember{{SecurityGroupId: aws.String(loadBalancerSecurityGroupID)}},
+	}
+}
+
+// healthCheckTargetPort returns the port of the health check target, 0 when unknown
+func healthCheckTargetPort(healthCheck *elb.HealthCheck) int32 {
+	if healthCheck == nil {
+		return 0
+	}
+	_, target, _ := strings.Cut(aws.StringValue(healthCheck.Target), ":")
+	port, _, _ := strings.Cut(target, "/")
+	value, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(value)
+}
+
+// backendPortRules returns the rules opening the instance ports of the listeners and the
+// health check port to the load balancer
+func backendPortRules(lb *elb.LoadBalancerDescription, loadBalancerSecurityGroupID string) IPRulesSet {
+	rules := NewIPRulesSet()
+	for _, listenerDescription := range lb.ListenerDescriptions {
+		listener := listenerDescription.Listener
+		if listener == nil || listener.InstancePort == nil {
+			continue
+		}
+		protocol := "tcp"
+		if isSCTPListener(listener.InstanceProtocol) {
+			protocol = ipProtocolSCTP
+		}
+		rules.Insert(backendRule(loadBalancerSecurityGroupID, protocol, int32(aws.Int64Value(listener.InstancePort))))
+	}
+	if port := healthCheckTargetPort(lb.HealthCheck); port != 0 {
+		rules.Insert(backendRule(loadBalancerSecurityGroupID, "tcp", port))
+	}
+	return rules
+}
+
+// loadBalancerSourcedRules returns the ungrouped inbound rules of the security group whose
+// source is the load balancer security group, in the form built by backendRule
+func loadBalancerSourcedRules(group osc.SecurityGroup, loadBalancerSecurityGroupID string) IPRulesSet {
+	rules := NewIPRulesSet()
+	for _, rule := range NewIPRulesSet(group.GetInboundRules()...).Ungroup() {
+		for _, member := range rule.GetSecurityGroupsMembers() {
+			if member.GetSecurityGroupId() == loadBalancerSecurityGroupID {
+				fromPort, toPort := rule.GetFromPortRange(), rule.GetToPortRange()
+				rules.Insert(osc.SecurityGroupRule{
+					IpProtocol:            aws.String(rule.GetIpProtocol()),
+					FromPortRange:         &fromPort,
+					ToPortRange:           &toPort,
+					SecurityGroupsMembers: &[]osc.SecurityGroupsMember{{SecurityGroupId: aws.String(loadBalancerSecurityGroupID)}},
+				})
+			}
+		}
+	}
+	return rules
+}
+
+// updateBackendPortRules opens the node security groups of the instances to the load
+// balancer with per port rules. The other rules from the load balancer are removed from
+// these groups, such as the all protocols rule or the rules of ports no longer used, and
+// all the rules from the load balancer are removed from the groups of no instance.
+func (c *Cloud) updateBackendPortRules(lb *elb.LoadBalancerDescription, loadBalancerSecurityGroupID string,
+	instanceSecurityGroupIDs map[string]bool, actualGroups []osc.SecurityGroup) error {
+	klog.V(5).Infof("updateBackendPortRules(%v, %v, %v, %v)", lb, loadBalancerSecurityGroupID, instanceSecurityGroupIDs, actualGroups)
+
+	desired := backendPortRules(lb, loadBalancerSecurityGroupID)
+	actual := make(map[string]IPRulesSet)
+	for _, group := range actualGroups {
+		if group.GetSecurityGroupId() != "" {
+			actual[group.GetSecurityGroupId()] = loadBalancerSourcedRules(group, loadBalancerSecurityGroupID)
+		}
+	}
+	for securityGroupID := range instanceSecurityGroupIDs {
+		if _, found := actual[securityGroupID]; !found {
+			actual[securityGroupID] = NewIPRulesSet()
+		}
+	}
+
+	for securityGroupID, rules := range actual {
+		expected := NewIPRulesSet()
+		if instanceSecurityGroupIDs[securityGroupID] {
+			expected = desired
+		}
+
+		if removed := rules.Difference(expected).List(); len(removed) > 0 {
+			klog.V(2).Infof("Removing %d rules for traffic from the load balancer (%s) to instances (%s)", len(removed), loadBalancerSecurityGroupID, securityGroupID)
+			if _, err := c.securityGroupService.removeSecurityGroupRules(securityGroupID, &removed, false); err != nil {
+				return err
+			}
+		}
+		if added := expected.Difference(rules).List(); len(added) > 0 {
+			klog.V(2).Infof("Adding %d rules for traffic from the load balancer (%s) to instances (%s)", len(added), loadBalancerSecurityGroupID, securityGroupID)
+			if _, err := c.securityGroupService.addSecurityGroupRules(securityGroupID, &added, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendRuleGranularity(t *testing.T) {
+	c, err := newCloud(CloudConfig{}, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+
+	granularity, err := c.backendRuleGranularity(nil, securityGroupModeManaged)
+	assert.NoError(t, err)
+	assert.Equal(t, backendRulesAll, granularity)
+
+	c.cfg.Global.BackendSecurityGroupRules = "ports"
+	granularity, err = c.backendRuleGranularity(nil, securityGroupModeManaged)
+	assert.NoError(t, err)
+	assert.Equal(t, backendRulesPorts, granularity)
+
+	annotations := map[string]string{ServiceAnnotationLoadBalancerBackendSecurityGroupRules: "All"}
+	granularity, err = c.backendRuleGranularity(annotations, securityGroupModeManaged)
+	assert.NoError(t, err)
+	assert.Equal(t, backendRulesAll, granularity)
+
+	_, err = c.backendRuleGranularity(nil, securityGroupModeShared)
+	assert.Error(t, err, "the per port rules are not supported with a shared security group")
+
+	annotations[ServiceAnnotationLoadBalancerBackendSecurityGroupRules] = "nodeports"
+	_, err = c.backendRuleGranularity(annotations, securityGroupModeManaged)
+	assert.Error(t, err)
+}
+
+func TestHealthCheckTargetPort(t *testing.T) {
+	assert.Equal(t, int32(0), healthCheckTargetPort(nil))
+	assert.Equal(t, int32(30080), healthCheckTargetPort(&elb.HealthCheck{Target: aws.String("TCP:30080")}))
+	assert.Equal(t, int32(10256), healthCheckTargetPort(&elb.HealthCheck{Target: aws.String("HTTP:10256/healthz")}))
+	assert.Equal(t, int32(0), healthCheckTargetPort(&elb.HealthCheck{Target: aws.String("TCP")}))
+}
+
+func TestBackendPortRules(t *testing.T) {
+	lb := &elb.LoadBalancerDescription{
+		ListenerDescriptions: []*elb.ListenerDescription{
+			{Listener: &elb.Listener{InstancePort: aws.Int64(30080), InstanceProtocol: aws.String("HTTP")}},
+			{Listener: &elb.Listener{InstancePort: aws.Int64(30443), InstanceProtocol: aws.String("TCP")}},
+			{Listener: &elb.Listener{InstancePort: aws.Int64(30132), InstanceProtocol: aws.String("SCTP")}},
+		},
+		HealthCheck: &elb.HealthCheck{Target: aws.String("HTTP:31000/healthz")},
+	}
+	assert.Equal(t, NewIPRulesSet(
+		backendRule("sg-lb", "tcp", 30080),
+		backendRule("sg-lb", "tcp", 30443),
+		backendRule("sg-lb", ipProtocolSCTP, 30132),
+		backendRule("sg-lb", "tcp", 31000),
+	), backendPortRules(lb, "sg-lb"))
+}
+
+func TestLoadBalancerSourcedRules(t *testing.T) {
+	port := int32(30080)
+	group := osc.SecurityGroup{InboundRules: &[]osc.SecurityGroupRule{
+		{
+			IpProtocol:    aws.String("tcp"),
+			FromPortRange: &port,
+			ToPortRange:   &port,
+			SecurityGroupsMembers: &[]osc.SecurityGroupsMember{
+				{SecurityGroupId: aws.String("sg-lb"), AccountId: aws.String("123456789012")},
+				{SecurityGroupId: aws.String("sg-other")},
+			},
+		},
+		tcpIngressRule(22, "10.0.0.0/8"),
+	}}
+	assert.Equal(t, NewIPRulesSet(backendRule("sg-lb", "tcp", 30080)), loadBalancerSourcedRules(group, "sg-lb"))
+}
+
+func TestUpdateBackendPortRules(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	group := awsServices.compute.(*FakeComputeImpl).MainSecurityGroup
+	ssh := tcpIngressRule(22, "10.0.0.0/8")
+	group.SetInboundRules([]osc.SecurityGroupRule{ssh, allProtocolsRule("sg-lb")})
+
+	lb := &elb.LoadBalancerDescription{
+		ListenerDescriptions: []*elb.ListenerDescription{
+			{Listener: &elb.Listener{InstancePort: aws.Int64(30080), InstanceProtocol: aws.String("TCP")}},
+		},
+		HealthCheck: &elb.HealthCheck{Target: aws.String("TCP:30080")},
+	}
+	wanted := map[string]bool{"sg-1234": true}
+
+	// The all protocols rule is replaced by the rules of the ports
+	assert.NoError(t, c.updateBackendPortRules(lb, "sg-lb", wanted, []osc.SecurityGroup{*group}))
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, backendRule("sg-lb", "tcp", 30080)}, group.GetInboundRules())
+
+	// The rules follow the node ports
+	lb.ListenerDescriptions[0].Listener.InstancePort = aws.Int64(30081)
+	lb.HealthCheck.Target = aws.String("TCP:30081")
+	assert.NoError(t, c.updateBackendPortRules(lb, "sg-lb", wanted, []osc.SecurityGroup{*group}))
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, backendRule("sg-lb", "tcp", 30081)}, group.GetInboundRules())
+
+	// All the rules from the load balancer are removed from the groups of no instance
+	assert.NoError(t, c.updateBackendPortRules(lb, "sg-lb", map[string]bool{}, []osc.SecurityGroup{*group}))
+	assert.Equal(t, []osc.SecurityGroupRule{ssh}, group.GetInboundRules())
+}
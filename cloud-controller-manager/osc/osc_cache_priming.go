@@ -0,0 +1,199 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Cache Priming *********************
+
+// elbDescribeTagsMaxNames is the maximum number of load balancers of a DescribeTags call
+const elbDescribeTagsMaxNames = 20
+
+// primedLoadBalancersTTL is how long the load balancers read when priming the caches may
+// answer the first lookup of each load balancer
+const primedLoadBalancersTTL = 2 * time.Minute
+
+// primedLoadBalancers holds the load balancers read when priming the caches. Each one
+// answers a single lookup, the first reconciliation of its service after the leadership
+// was acquired, and the following lookups read the load balancer again.
+type primedLoadBalancers struct {
+	mutex         sync.Mutex
+	loadBalancers map[string]*elb.LoadBalancerDescription
+	expiresAt     time.Time
+}
+
+// seed replaces the primed load balancers
+func (p *primedLoadBalancers) seed(loadBalancers []*elb.LoadBalancerDescription, ttl time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.loadBalancers = make(map[string]*elb.LoadBalancerDescription, len(loadBalancers))
+	for _, loadBalancer := range loadBalancers {
+		p.loadBalancers[aws.StringValue(loadBalancer.LoadBalancerName)] = loadBalancer
+	}
+	p.expiresAt = time.Now().Add(ttl)
+}
+
+// take returns and forgets the primed load balancer, nil when it was not primed
+func (p *primedLoadBalancers) take(name string) *elb.LoadBalancerDescription {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.loadBalancers == nil {
+		return nil
+	}
+	if time.Now().After(p.expiresAt) {
+		p.loadBalancers = nil
+		return nil
+	}
+	loadBalancer := p.loadBalancers[name]
+	delete(p.loadBalancers, name)
+	return loadBalancer
+}
+
+// primeCaches reads in bulk the VMs, the security groups and the load balancers of the
+// cluster and the route tables of the Net, and seeds the caches with them, so that the
+// reconciliations following the acquisition of the leadership don't issue a read per
+// service and node. It is called by Initialize, which the cloud provider framework runs
+// once the leadership is acquired.
+func (c *Cloud) primeCaches() {
+	start := time.Now()
+
+	if c.tagging.clusterID() != "" {
+		filters := &osc.FiltersVm{TagKeys: c.tagging.clusterTagKeysFilter()}
+		vms, err := c.instanceService.describeInstances(filters)
+		if err != nil {
+			klog.Warningf("Unable to prime the VM caches: %q", err)
+		} else {
+			c.seedInstanceCaches(vms, start)
+		}
+	}
+
+	if c.vpcID != "" && c.routeTables != nil && c.routeTables.ttl > 0 {
+		readRequest := osc.ReadRouteTablesRequest{
+			Filters: &osc.FiltersRouteTable{NetIds: &[]string{c.vpcID}},
+		}
+		_, err := c.routeTables.get(func() ([]osc.RouteTable, error) {
+			return c.compute.ReadRouteTables(&readRequest)
+		})
+		if err != nil {
+			klog.Warningf("Unable to prime the route table cache: %q", err)
+		}
+	}
+
+	if c.securityGroups.enabled() {
+		if err := c.securityGroups.refresh(c.securityGroupService.readTaggedSecurityGroups); err != nil {
+			klog.Warningf("Unable to prime the security group cache: %q", err)
+		}
+	}
+
+	loadBalancers, err := c.loadBalancerService.describeClusterLoadBalancers(&c.tagging)
+	if err != nil {
+		klog.Warningf("Unable to prime the load balancers: %q", err)
+	} else {
+		c.loadBalancerService.primeLoadBalancers(loadBalancers, primedLoadBalancersTTL)
+	}
+
+	klog.Infof("Primed the caches in %v (%d load balancers)", time.Since(start), len(loadBalancers))
+}
+
+// seedInstanceCaches seeds the snapshot of the instances and the VM cache of InstancesV2
+func (c *Cloud) seedInstanceCaches(vms []*osc.Vm, fetchedAt time.Time) {
+	instances := make(map[InstanceID]*osc.Vm, len(vms))
+	for _, vm := range vms {
+		instances[InstanceID(vm.GetVmId())] = vm
+	}
+	c.instanceCache.mutex.Lock()
+	if c.instanceCache.snapshot == nil || c.instanceCache.snapshot.timestamp.Before(fetchedAt) {
+		c.instanceCache.snapshot = &allInstancesSnapshot{fetchedAt, instances}
+	}
+	c.instanceCache.mutex.Unlock()
+
+	if instances, ok := c.instances.(*instancesV2); ok && instances.cache != nil {
+		instances.cache.seed(vms, fetchedAt)
+	}
+}
+
+// seed caches the VMs read at fetchedAt
+func (c *vmCache) seed(vms []*osc.Vm, fetchedAt time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, vm := range vms {
+		if entry, found := c.entries[vm.GetVmId()]; found && entry.fetchedAt.After(fetchedAt) {
+			continue
+		}
+		c.entries[vm.GetVmId()] = vmCacheEntry{vm: vm, fetchedAt: fetchedAt}
+	}
+}
+
+// primeLoadBalancers seeds the load balancers answering the first lookup of each of them
+func (s *loadBalancerService) primeLoadBalancers(loadBalancers []*elb.LoadBalancerDescription, ttl time.Duration) {
+	s.primed.seed(loadBalancers, ttl)
+}
+
+// describeClusterLoadBalancers reads the load balancers tagged for the cluster or managed by
+// it, reading their tags by batches of elbDescribeTagsMaxNames
+func (s *loadBalancerService) describeClusterLoadBalancers(tagging *resourceTagging) ([]*elb.LoadBalancerDescription, error) {
+	response, err := s.loadBalancer.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{})
+	if err != nil {
+		return nil, err
+	}
+	if tagging.clusterID() == "" {
+		return response.LoadBalancerDescriptions, nil
+	}
+
+	loadBalancers := []*elb.LoadBalancerDescription{}
+	all := response.LoadBalancerDescriptions
+	for start := 0; start < len(all); start += elbDescribeTagsMaxNames {
+		end := start + elbDescribeTagsMaxNames
+		if end > len(all) {
+			end = len(all)
+		}
+		batch := all[start:end]
+		names := make([]*string, 0, len(batch))
+		for _, loadBalancer := range batch {
+			names = append(names, loadBalancer.LoadBalancerName)
+		}
+		tagsResponse, err := s.loadBalancer.DescribeTags(&elb.DescribeTagsInput{LoadBalancerNames: names})
+		if err != nil {
+			return nil, fmt.Errorf("error describing tags of load balancers: %q", err)
+		}
+		cluster := map[string]bool{}
+		for _, description := range tagsResponse.TagDescriptions {
+			tags := []osc.ResourceTag{}
+			for _, tag := range description.Tags {
+				tags = append(tags, osc.ResourceTag{Key: aws.StringValue(tag.Key), Value: aws.StringValue(tag.Value)})
+			}
+			if tagging.hasClusterTag(&tags) || tagging.isManagedBy(&tags) {
+				cluster[aws.StringValue(description.LoadBalancerName)] = true
+			}
+		}
+		for _, loadBalancer := range batch {
+			if cluster[aws.StringValue(loadBalancer.LoadBalancerName)] {
+				loadBalancers = append(loadBalancers, loadBalancer)
+			}
+		}
+	}
+	return loadBalancers, nil
+}
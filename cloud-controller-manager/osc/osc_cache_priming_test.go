@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrimedLoadBalancers(t *testing.T) {
+	var primed primedLoadBalancers
+	assert.Nil(t, primed.take("lb-1"))
+
+	primed.seed([]*elb.LoadBalancerDescription{{LoadBalancerName: aws.String("lb-1")}}, time.Minute)
+	loadBalancer := primed.take("lb-1")
+	if assert.NotNil(t, loadBalancer) {
+		assert.Equal(t, "lb-1", aws.StringValue(loadBalancer.LoadBalancerName))
+	}
+	assert.Nil(t, primed.take("lb-1"), "a primed load balancer answers a single lookup")
+	assert.Nil(t, primed.take("lb-2"))
+
+	primed.seed([]*elb.LoadBalancerDescription{{LoadBalancerName: aws.String("lb-1")}}, -time.Second)
+	assert.Nil(t, primed.take("lb-1"), "the primed load balancers expire")
+}
+
+func TestVMCacheSeed(t *testing.T) {
+	cache := newVMCache(time.Minute, func(ids []string) ([]osc.Vm, error) {
+		return nil, errors.New("unexpected ReadVms")
+	})
+	cache.seed([]*osc.Vm{{VmId: osc.PtrString("i-00000001")}}, time.Now())
+
+	vm, err := cache.get("i-00000001")
+	assert.NoError(t, err)
+	if assert.NotNil(t, vm) {
+		assert.Equal(t, "i-00000001", vm.GetVmId())
+	}
+
+	// An older read does not replace a cached VM
+	newer := &osc.Vm{VmId: osc.PtrString("i-00000001"), State: osc.PtrString("running")}
+	cache.seed([]*osc.Vm{newer}, time.Now())
+	cache.seed([]*osc.Vm{{VmId: osc.PtrString("i-00000001")}}, time.Now().Add(-time.Minute))
+	vm, err = cache.get("i-00000001")
+	assert.NoError(t, err)
+	assert.Equal(t, newer, vm)
+}
+
+func TestPrimeCaches(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	_, err = c.loadBalancer.CreateLoadBalancer(&elb.CreateLoadBalancerInput{
+		LoadBalancerName: aws.String("lb-1"),
+		Tags:             []*elb.Tag{{Key: aws.String(c.tagging.clusterTagKey()), Value: aws.String(ResourceLifecycleOwned)}},
+	})
+	assert.NoError(t, err)
+	_, err = c.loadBalancer.CreateLoadBalancer(&elb.CreateLoadBalancerInput{LoadBalancerName: aws.String("lb-other")})
+	assert.NoError(t, err)
+	c.securityGroups = newSecurityGroupCache(time.Minute)
+	c.securityGroupService.(*securityGroupService).cache = c.securityGroups
+
+	c.primeCaches()
+
+	c.securityGroups.mutex.Lock()
+	assert.True(t, c.securityGroups.valid, "the security groups of the cluster are read")
+	c.securityGroups.mutex.Unlock()
+	assert.Nil(t, c.loadBalancerService.(*loadBalancerService).primed.take("lb-other"),
+		"the load balancers not tagged for the cluster are not primed")
+
+	c.instanceCache.mutex.Lock()
+	assert.NotNil(t, c.instanceCache.snapshot, "the VMs of the cluster are read")
+	c.instanceCache.mutex.Unlock()
+
+	loadBalancer, err := c.loadBalancerService.describeLoadBalancer("lb-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, loadBalancer)
+
+	// The primed load balancer is not returned once deleted
+	delete(awsServices.elb.(*FakeELB).LoadBalancers, "lb-1")
+	loadBalancer, err = c.loadBalancerService.describeLoadBalancer("lb-1")
+	assert.NoError(t, err)
+	assert.Nil(t, loadBalancer)
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/wait"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Cloud Health *********************
+
+const (
+	// cloudHealthCheckInterval is the interval between two runs of the cloud health checks
+	cloudHealthCheckInterval = 30 * time.Second
+	// cloudHealthStaleChecks is the number of intervals without result after which the
+	// checks are considered stuck, failing the liveness
+	cloudHealthStaleChecks = 4
+)
+
+// Names of the cloud health checks
+const (
+	cloudHealthCheckOapi        = "oapi"
+	cloudHealthCheckCredentials = "credentials"
+	cloudHealthCheckMetadata    = "metadata"
+)
+
+var errCloudHealthNotChecked = errors.New("not checked yet")
+
+// cloudHealth checks periodically that the CCM can talk to the cloud: the oAPI is
+// reachable, the credentials are accepted and the metadata service answers. The results
+// are served as the readiness of the replica, so that a replica which cannot reconcile
+// is reported before it silently stops doing so.
+type cloudHealth struct {
+	cloud    *Cloud
+	interval time.Duration
+
+	mutex     sync.Mutex
+	results   map[string]error
+	checkedAt time.Time
+}
+
+func newCloudHealth(cloud *Cloud, interval time.Duration) *cloudHealth {
+	results := map[string]error{
+		cloudHealthCheckOapi:        errCloudHealthNotChecked,
+		cloudHealthCheckCredentials: errCloudHealthNotChecked,
+	}
+	if cloud.metadata != nil {
+		results[cloudHealthCheckMetadata] = errCloudHealthNotChecked
+	}
+	return &cloudHealth{cloud: cloud, interval: interval, results: results}
+}
+
+// isAuthError checks whether the oAPI call failed because the credentials were rejected
+func isAuthError(err error) bool {
+	return strings.Contains(err.Error(), "Status:401") || strings.Contains(err.Error(), "Status:403")
+}
+
+// check runs the checks and records their results
+func (h *cloudHealth) check() {
+	c := h.cloud
+	results := make(map[string]error)
+
+	request := &osc.ReadVmsRequest{Filters: &osc.FiltersVm{TagKeys: c.tagging.clusterTagKeysFilter()}}
+	if c.selfAWSInstance != nil {
+		request.Filters = &osc.FiltersVm{VmIds: &[]string{c.selfAWSInstance.vmID}}
+	}
+	_, err := c.compute.ReadVms(request)
+	switch {
+	case err == nil:
+		results[cloudHealthCheckOapi] = nil
+		results[cloudHealthCheckCredentials] = nil
+	case isAuthError(err):
+		results[cloudHealthCheckOapi] = nil
+		results[cloudHealthCheckCredentials] = fmt.Errorf("the credentials are rejected: %v", err)
+	default:
+		results[cloudHealthCheckOapi] = fmt.Errorf("the oAPI is unreachable: %v", err)
+		results[cloudHealthCheckCredentials] = errors.New("unknown while the oAPI is unreachable")
+	}
+
+	if c.metadata != nil {
+		if _, err := c.metadata.GetMetadata("instance-id"); err != nil {
+			results[cloudHealthCheckMetadata] = fmt.Errorf("the metadata service is unreachable: %v", err)
+		} else {
+			results[cloudHealthCheckMetadata] = nil
+		}
+	}
+
+	for name, err := range results {
+		recordCloudHealthMetric(name, err)
+		if err != nil {
+			klog.Warningf("Cloud health check %s failed: %v", name, err)
+		}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.results = results
+	h.checkedAt = time.Now()
+}
+
+// run checks the cloud health until stop is closed
+func (h *cloudHealth) run(stop <-chan struct{}) {
+	wait.Until(h.check, h.interval, stop)
+}
+
+// ready returns the failed checks
+func (h *cloudHealth) ready() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	failures := []string{}
+	for name, err := range h.results {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	sort.Strings(failures)
+	return failures
+}
+
+// alive checks that the checks are not stuck
+func (h *cloudHealth) alive() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.checkedAt.IsZero() {
+		return nil
+	}
+	if since := time.Since(h.checkedAt); since > cloudHealthStaleChecks*h.interval {
+		return fmt.Errorf("the cloud health checks did not complete for %v", since.Round(time.Second))
+	}
+	return nil
+}
+
+// handler serves /healthz, the liveness, and /readyz, the result of the checks
+func (h *cloudHealth) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.alive(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if failures := h.ready(); len(failures) > 0 {
+			http.Error(w, strings.Join(failures, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// ServeCloudHealth checks periodically the connectivity of the cloud provider to the cloud,
+// and serves the results on bindAddress: /healthz fails when the checks are stuck and
+// /readyz when one of them fails.
+func ServeCloudHealth(cloud cloudprovider.Interface, bindAddress string) error {
+	c, ok := cloud.(*Cloud)
+	if !ok {
+		return fmt.Errorf("unexpected cloud provider %T", cloud)
+	}
+	health := newCloudHealth(c, cloudHealthCheckInterval)
+	go health.run(wait.NeverStop)
+
+	server := &http.Server{
+		Addr:              bindAddress,
+		Handler:           health.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		klog.Infof("Serving the cloud health on %s", bindAddress)
+		if err := server.ListenAndServe(); err != nil {
+			klog.Fatalf("Unable to serve the cloud health: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// unreachableCompute fails the ReadVms calls with err
+type unreachableCompute struct {
+	Compute
+	err error
+}
+
+func (u *unreachableCompute) ReadVms(request *osc.ReadVmsRequest) ([]osc.Vm, error) {
+	return nil, u.err
+}
+
+func cloudHealthStatus(t *testing.T, health *cloudHealth, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	health.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestCloudHealth(t *testing.T) {
+	c, err := newCloud(CloudConfig{}, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+	health := newCloudHealth(c, time.Minute)
+
+	// Not ready until checked
+	code, _ := cloudHealthStatus(t, health, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = cloudHealthStatus(t, health, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	health.check()
+	code, _ = cloudHealthStatus(t, health, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+
+	compute := c.compute
+	c.compute = &unreachableCompute{Compute: compute, err: errors.New(`error listing instances: "401 Unauthorized" (Status:401 Unauthorized)`)}
+	health.check()
+	code, body := cloudHealthStatus(t, health, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "credentials: the credentials are rejected")
+	assert.NotContains(t, body, "oapi:")
+
+	c.compute = &unreachableCompute{Compute: compute, err: errors.New("error listing instances: dial tcp: i/o timeout")}
+	health.check()
+	_, body = cloudHealthStatus(t, health, "/readyz")
+	assert.Contains(t, body, "oapi: the oAPI is unreachable")
+
+	// The liveness fails when the checks are stuck
+	health.checkedAt = time.Now().Add(-cloudHealthStaleChecks * 2 * time.Minute)
+	code, _ = cloudHealthStatus(t, health, "/healthz")
+	assert.Equal(t, http.StatusInternalServerError, code)
+}
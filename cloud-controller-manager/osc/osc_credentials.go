@@ -0,0 +1,414 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/fsnotify/fsnotify"
+
+	"k8s.io/klog/v2"
+)
+
+// CredentialsFile is set by the --osc-credentials-file flag and takes precedence over
+// the CredentialsFile of the cloud config
+var CredentialsFile string
+
+// ********************* CCM Credentials *********************
+
+const (
+	// fileCredentialsProviderName is the name of the provider reading CredentialsFile
+	fileCredentialsProviderName = "OscCredentialsFile"
+	// defaultCredentialsRefreshInterval is the reload interval of CredentialsFile when
+	// CredentialsRefreshSeconds is not set
+	defaultCredentialsRefreshInterval = 5 * time.Minute
+	// oapiSigningRegion is the region used to sign the oAPI requests, as done by osc-sdk-go
+	oapiSigningRegion = "eu-west-2"
+)
+
+// credentialsFileContent is the content of CredentialsFile
+type credentialsFileContent struct {
+	AccessKey    string `json:"access_key"`
+	SecretKey    string `json:"secret_key"`
+	SessionToken string `json:"session_token,omitempty"`
+	// Region of the EIM endpoint, and endpoints of the oAPI and LBU overriding those of the region
+	Region      string `json:"region,omitempty"`
+	EndpointAPI string `json:"endpoint_api,omitempty"`
+	EndpointLBU string `json:"endpoint_lbu,omitempty"`
+}
+
+// set sets the value of a key of the credentials, ignoring the unknown keys. The keys of
+// the environment variables (OSC_ACCESS_KEY, ...) are accepted too.
+func (c *credentialsFileContent) set(key, value string) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(key)), "osc_") {
+	case "access_key", "aws_access_key_id":
+		c.AccessKey = value
+	case "secret_key", "aws_secret_access_key":
+		c.SecretKey = value
+	case "session_token", "aws_session_token":
+		c.SessionToken = value
+	case "region":
+		c.Region = value
+	case "endpoint_api":
+		c.EndpointAPI = value
+	case "endpoint_lbu":
+		c.EndpointLBU = value
+	}
+}
+
+// parseCredentialsFile parses a JSON credentials file, or an INI one such as:
+//
+//	[default]
+//	access_key = ...
+//	secret_key = ...
+//	session_token = ...
+//
+// The aws_access_key_id, aws_secret_access_key and aws_session_token keys of the
+// shared credentials files are accepted too, as well as the region, endpoint_api and
+// endpoint_lbu keys. Only the default section is read.
+func parseCredentialsFile(data []byte) (credentialsFileContent, error) {
+	content := credentialsFileContent{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err := json.Unmarshal(trimmed, &content)
+		return content, err
+	}
+
+	section := "default"
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";"):
+			continue
+		case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+		key, value, found := strings.Cut(text, "=")
+		if !found {
+			return content, fmt.Errorf("line %d: expected key = value", line)
+		}
+		if section != "default" {
+			continue
+		}
+		content.set(key, strings.Trim(strings.TrimSpace(value), `"`))
+	}
+	return content, scanner.Err()
+}
+
+// fileCredentialsProvider reads the credentials from a file, or from the directory of a
+// mounted Secret, and reads it again once the refresh interval is over or when it changes,
+// so that rotated credentials are picked up
+type fileCredentialsProvider struct {
+	path    string
+	refresh time.Duration
+
+	// Content last read, for the endpoints, and its expiration, expired by the watch
+	mutex      sync.Mutex
+	content    credentialsFileContent
+	expiration time.Time
+}
+
+func newFileCredentialsProvider(path string, refresh time.Duration) *fileCredentialsProvider {
+	if refresh <= 0 {
+		refresh = defaultCredentialsRefreshInterval
+	}
+	return &fileCredentialsProvider{path: path, refresh: refresh}
+}
+
+// isDir returns whether the credentials are read from a directory
+func (p *fileCredentialsProvider) isDir() bool {
+	info, err := os.Stat(p.path)
+	return err == nil && info.IsDir()
+}
+
+// read reads the credentials file or directory, and records its content
+func (p *fileCredentialsProvider) read() (credentialsFileContent, error) {
+	var content credentialsFileContent
+	if p.isDir() {
+		var err error
+		if content, err = readCredentialsSecret(p.path); err != nil {
+			return content, fmt.Errorf("unable to read credentials secret %s: %v", p.path, err)
+		}
+	} else {
+		data, err := os.ReadFile(p.path)
+		if err != nil {
+			return content, fmt.Errorf("unable to read credentials file: %v", err)
+		}
+		if content, err = parseCredentialsFile(data); err != nil {
+			return content, fmt.Errorf("unable to parse credentials file %s: %v", p.path, err)
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.content.Region != "" && content.Region != p.content.Region {
+		klog.Warningf("Region of the credentials %s changed from %s to %s, restart the CCM to use it",
+			p.path, p.content.Region, content.Region)
+		content.Region = p.content.Region
+	}
+	if content.EndpointAPI != p.content.EndpointAPI || content.EndpointLBU != p.content.EndpointLBU {
+		klog.Infof("Using the oAPI endpoint %q and the LBU endpoint %q of the credentials %s",
+			content.EndpointAPI, content.EndpointLBU, p.path)
+	}
+	p.content = content
+	return content, nil
+}
+
+// current returns the content last read
+func (p *fileCredentialsProvider) current() credentialsFileContent {
+	if p == nil {
+		return credentialsFileContent{}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.content
+}
+
+// Retrieve implements credentials.Provider
+func (p *fileCredentialsProvider) Retrieve() (credentials.Value, error) {
+	content, err := p.read()
+	if err != nil {
+		return credentials.Value{ProviderName: fileCredentialsProviderName}, err
+	}
+	if content.AccessKey == "" || content.SecretKey == "" {
+		return credentials.Value{ProviderName: fileCredentialsProviderName}, fmt.Errorf("credentials file %s must set access_key and secret_key", p.path)
+	}
+
+	klog.V(4).Infof("Loaded credentials %s from %s", content.AccessKey, p.path)
+	p.setExpiration(time.Now().Add(p.refresh))
+	return credentials.Value{
+		AccessKeyID:     content.AccessKey,
+		SecretAccessKey: content.SecretKey,
+		SessionToken:    content.SessionToken,
+		ProviderName:    fileCredentialsProviderName,
+	}, nil
+}
+
+// IsExpired implements credentials.Provider
+func (p *fileCredentialsProvider) IsExpired() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return !time.Now().Before(p.expiration)
+}
+
+// setExpiration sets when the credentials must be read again
+func (p *fileCredentialsProvider) setExpiration(expiration time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.expiration = expiration
+}
+
+// watch expires the credentials, and reads the endpoints again, each time the file is
+// written or replaced, until stop is closed. The directory is watched rather than the
+// file, as secret injectors (Vault agent, projected volumes) usually replace the file or
+// swap a symlink.
+func (p *fileCredentialsProvider) watch(stop <-chan struct{}) {
+	if p == nil {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		klog.Warningf("Unable to watch credentials file %s, it will be read every %v: %v", p.path, p.refresh, err)
+		return
+	}
+	dir := p.path
+	if !p.isDir() {
+		dir = filepath.Dir(p.path)
+	}
+	if err := watcher.Add(dir); err != nil {
+		klog.Warningf("Unable to watch credentials file %s, it will be read every %v: %v", p.path, p.refresh, err)
+		watcher.Close()
+		return
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !p.isWrittenBy(event) {
+					continue
+				}
+				klog.V(2).Infof("Credentials file %s changed (%v), reloading it", p.path, event.Op)
+				p.setExpiration(time.Time{})
+				if _, err := p.read(); err != nil {
+					klog.Warningf("Unable to reload credentials file %s: %v", p.path, err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				klog.Warningf("Error while watching credentials file %s: %v", p.path, err)
+			}
+		}
+	}()
+}
+
+// isWrittenBy returns whether the event may have changed the content of the file
+func (p *fileCredentialsProvider) isWrittenBy(event fsnotify.Event) bool {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	if filepath.Dir(name) == filepath.Clean(p.path) {
+		// A key of the Secret directory
+		return true
+	}
+	// Kubernetes atomically updates projected volumes by swapping the ..data symlink
+	return name == filepath.Clean(p.path) || filepath.Base(name) == "..data"
+}
+
+// cloudCredentials are the credentials of the oAPI and LBU clients
+type cloudCredentials struct {
+	*credentials.Credentials
+	// refreshed is set when the credentials may change while the CCM runs
+	refreshed bool
+	// file is the provider reading CredentialsFile, if any
+	file *fileCredentialsProvider
+}
+
+// newCloudCredentials returns the credentials of the oAPI and LBU clients: read from
+// the --osc-credentials-file flag or CredentialsFile, or temporary credentials of the
+// RoleARN role assumed through EIM. Otherwise the static credentials of the
+// environment are used.
+func newCloudCredentials(cfg *CloudConfig) (*cloudCredentials, error) {
+	path := cfg.Global.CredentialsFile
+	if CredentialsFile != "" {
+		path = CredentialsFile
+	}
+
+	creds := &cloudCredentials{}
+	var base *credentials.Credentials
+	if path != "" {
+		klog.Infof("Reading credentials from %s", path)
+		creds.file = newFileCredentialsProvider(path, time.Duration(cfg.Global.CredentialsRefreshSeconds)*time.Second)
+		creds.refreshed = true
+		// Read the region and the endpoints before the first call, the credentials being
+		// read again when they are retrieved
+		if _, err := creds.file.read(); err != nil {
+			klog.Warningf("Unable to read the credentials yet: %v", err)
+		}
+		base = credentials.NewCredentials(creds.file)
+	} else {
+		base = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvProvider{},
+			&credentials.SharedCredentialsProvider{},
+		})
+	}
+
+	if cfg.Global.RoleARN == "" {
+		creds.Credentials = base
+		return creds, nil
+	}
+
+	region, err := credentialsRegion(cfg, creds.file)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String(region),
+		Credentials:      base,
+		EndpointResolver: endpoints.ResolverFunc(SetupServiceResolver(region)),
+		HTTPClient:       apiClients.httpClient(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize EIM session: %v", err)
+	}
+	addOscUserAgent(&sess.Handlers)
+	klog.Infof("Using temporary credentials of role %s", cfg.Global.RoleARN)
+	creds.Credentials = stscreds.NewCredentials(sess, cfg.Global.RoleARN)
+	creds.refreshed = true
+	return creds, nil
+}
+
+// credentialsRegion returns the region of the EIM endpoint, from OSC_REGION, the region of
+// the credentials file, the configured zone or else the metadata
+func credentialsRegion(cfg *CloudConfig, file *fileCredentialsProvider) (string, error) {
+	if region := os.Getenv("OSC_REGION"); region != "" {
+		return region, nil
+	}
+	if region := file.current().Region; region != "" {
+		return region, nil
+	}
+	if cfg.Global.Zone != "" {
+		return azToRegion(cfg.Global.Zone)
+	}
+	metadata, err := NewMetadata()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine the region of the EIM endpoint: %v", err)
+	}
+	return metadata.GetRegion(), nil
+}
+
+// oapiSigningTransport signs the oAPI requests with the current credentials, so that
+// refreshed credentials are used without recreating the client
+type oapiSigningTransport struct {
+	signer *v4.Signer
+	next   http.RoundTripper
+}
+
+func newOapiSigningTransport(creds *credentials.Credentials, next http.RoundTripper) *oapiSigningTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &oapiSigningTransport{signer: v4.NewSigner(creds), next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *oapiSigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed := req.Clone(req.Context())
+	var body io.ReadSeeker = strings.NewReader("")
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	// Drop the signature of a previous attempt
+	signed.Header.Del("Authorization")
+	signed.Header.Del("X-Amz-Date")
+	signed.Header.Del("X-Amz-Security-Token")
+	if _, err := t.signer.Sign(signed, body, "oapi", oapiSigningRegion, time.Now()); err != nil {
+		return nil, fmt.Errorf("unable to sign oAPI request: %v", err)
+	}
+	return t.next.RoundTrip(signed)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Credentials Secret *********************
+
+// credentialsSecretKeys are the keys of the osc-secret of the Helm chart, which differ from
+// those of the credentials files: its access_key is the secret key
+var credentialsSecretKeys = map[string]string{
+	"key_id":             "access_key",
+	"access_key":         "secret_key",
+	"aws_default_region": "region",
+}
+
+// readCredentialsSecret reads the credentials from the directory of a mounted Secret, whose
+// keys are files: the keys of the osc-secret of the Helm chart (key_id, access_key,
+// aws_default_region), or OSC_ACCESS_KEY, OSC_SECRET_KEY, OSC_SESSION_TOKEN, OSC_REGION,
+// OSC_ENDPOINT_API and OSC_ENDPOINT_LBU. The other keys are ignored.
+func readCredentialsSecret(dir string) (credentialsFileContent, error) {
+	content := credentialsFileContent{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return content, err
+	}
+	for _, entry := range entries {
+		// Skip the ..data and timestamped directories of the atomic updates of the volume
+		if strings.HasPrefix(entry.Name(), "..") {
+			continue
+		}
+		name := filepath.Join(dir, entry.Name())
+		// The keys are symlinks to the current ..data directory
+		if info, err := os.Stat(name); err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return content, err
+		}
+		key := entry.Name()
+		if alias, found := credentialsSecretKeys[key]; found {
+			key = alias
+		}
+		content.set(key, strings.TrimSpace(string(data)))
+	}
+	return content, nil
+}
+
+// parseEndpoint parses an endpoint of the credentials, e.g. https://api.eu-west-2.outscale.com/api/v1
+func parseEndpoint(endpoint string) (*url.URL, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("expected an URL such as https://host/path")
+	}
+	return parsed, nil
+}
+
+// overrideEndpoint sends the request to endpoint, keeping the last element of the path for
+// the oAPI requests (the name of the call)
+func overrideEndpoint(u *url.URL, endpoint string, keepCall bool) error {
+	parsed, err := parseEndpoint(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+	}
+	call := path.Base(u.Path)
+	u.Scheme = parsed.Scheme
+	u.Host = parsed.Host
+	u.Path = parsed.Path
+	if keepCall {
+		u.Path = strings.TrimSuffix(parsed.Path, "/") + "/" + call
+	} else if u.Path == "" {
+		u.Path = "/"
+	}
+	return nil
+}
+
+// oapiEndpointTransport sends the oAPI requests to the endpoint of the credentials, when
+// set, so that a new endpoint is used without recreating the clients. It must be placed
+// before the signing of the requests.
+type oapiEndpointTransport struct {
+	file *fileCredentialsProvider
+	next http.RoundTripper
+}
+
+func newOapiEndpointTransport(file *fileCredentialsProvider, next http.RoundTripper) *oapiEndpointTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &oapiEndpointTransport{file: file, next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *oapiEndpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := t.file.current().EndpointAPI
+	if endpoint == "" {
+		return t.next.RoundTrip(req)
+	}
+	overridden := req.Clone(req.Context())
+	if err := overrideEndpoint(overridden.URL, endpoint, true); err != nil {
+		return nil, err
+	}
+	overridden.Host = ""
+	return t.next.RoundTrip(overridden)
+}
+
+// addLbuEndpointHandler sends the LBU requests to the endpoint of the credentials, when set
+func addLbuEndpointHandler(file *fileCredentialsProvider, h *request.Handlers) {
+	if file == nil {
+		return
+	}
+	h.Build.PushBackNamed(request.NamedHandler{
+		Name: "k8s/credentials-endpoint",
+		Fn: func(r *request.Request) {
+			endpoint := file.current().EndpointLBU
+			if endpoint == "" {
+				return
+			}
+			if err := overrideEndpoint(r.HTTPRequest.URL, endpoint, false); err != nil {
+				klog.Warningf("Unable to send the LBU request %s to the endpoint of the credentials: %v", r.Operation.Name, err)
+				r.Error = err
+				return
+			}
+			r.HTTPRequest.Host = ""
+		},
+	})
+}
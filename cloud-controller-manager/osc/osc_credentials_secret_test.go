@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSecretVolume writes the keys like the kubelet updates a Secret volume: in a new
+// timestamped directory, then swapping the ..data symlink the keys link to
+func writeSecretVolume(t *testing.T, dir, version string, keys map[string]string) {
+	data := filepath.Join(dir, "..2023_"+version)
+	assert.NoError(t, os.Mkdir(data, 0700))
+	for key, value := range keys {
+		assert.NoError(t, os.WriteFile(filepath.Join(data, key), []byte(value), 0600))
+		if _, err := os.Lstat(filepath.Join(dir, key)); os.IsNotExist(err) {
+			assert.NoError(t, os.Symlink(filepath.Join("..data", key), filepath.Join(dir, key)))
+		}
+	}
+	assert.NoError(t, os.Symlink(filepath.Base(data), filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+}
+
+func TestCredentialsSecret(t *testing.T) {
+	dir := t.TempDir()
+	// The keys of the osc-secret of the Helm chart
+	writeSecretVolume(t, dir, "1", map[string]string{
+		"key_id":             "AK1",
+		"access_key":         "SK1\n",
+		"aws_default_region": "eu-west-2",
+		"OSC_ENDPOINT_API":   "https://api.example.com/api/v1",
+		"osc_account_id":     "123456789012",
+	})
+
+	provider := newFileCredentialsProvider(dir, time.Hour)
+	creds := credentials.NewCredentials(provider)
+	value, err := creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AK1", value.AccessKeyID)
+	assert.Equal(t, "SK1", value.SecretAccessKey)
+	assert.Equal(t, "eu-west-2", provider.current().Region)
+	assert.Equal(t, "https://api.example.com/api/v1", provider.current().EndpointAPI)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	provider.watch(stop)
+
+	// The region can't change while the CCM runs
+	writeSecretVolume(t, dir, "2", map[string]string{
+		"OSC_ACCESS_KEY":   "AK2",
+		"OSC_SECRET_KEY":   "SK2",
+		"OSC_REGION":       "us-east-2",
+		"OSC_ENDPOINT_API": "https://api2.example.com/api/v1",
+	})
+	assert.Eventually(t, func() bool {
+		value, err := creds.Get()
+		return err == nil && value.AccessKeyID == "AK2"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "https://api2.example.com/api/v1", provider.current().EndpointAPI)
+	assert.Equal(t, "eu-west-2", provider.current().Region)
+}
+
+func TestCredentialsEndpoints(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/lbu" {
+			w.Write([]byte(`<DescribeLoadBalancersResponse><DescribeLoadBalancersResult><LoadBalancerDescriptions/></DescribeLoadBalancersResult></DescribeLoadBalancersResponse>`))
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"access_key": "AK", "secret_key": "SK", "endpoint_api": "`+
+		server.URL+`/api/v1", "endpoint_lbu": "`+server.URL+`/lbu"}`), 0600))
+	provider := newFileCredentialsProvider(path, time.Hour)
+	_, err := provider.read()
+	assert.NoError(t, err)
+
+	client := &http.Client{Transport: newOapiEndpointTransport(provider, nil)}
+	response, err := client.Post("https://api.eu-west-2.outscale.com/api/v1/ReadVms", "application/json", nil)
+	if assert.NoError(t, err) {
+		response.Body.Close()
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-2"),
+		Endpoint:    aws.String("https://lbu.eu-west-2.outscale.com"),
+		Credentials: credentials.NewStaticCredentials("AK", "SK", ""),
+	})
+	assert.NoError(t, err)
+	elbClient := elb.New(sess)
+	addLbuEndpointHandler(provider, &elbClient.Handlers)
+	_, err = elbClient.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"/api/v1/ReadVms", "/lbu"}, paths)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCredentialsProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"access_key": "AK1", "secret_key": "SK1"}`), 0600))
+
+	provider := newFileCredentialsProvider(path, time.Hour)
+	creds := credentials.NewCredentials(provider)
+	value, err := creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AK1", value.AccessKeyID)
+	assert.Equal(t, "SK1", value.SecretAccessKey)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"access_key": "AK2", "secret_key": "SK2", "session_token": "TK2"}`), 0600))
+	value, err = creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AK1", value.AccessKeyID, "credentials are cached until the refresh interval is over")
+
+	provider.setExpiration(time.Now().Add(-time.Second))
+	value, err = creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AK2", value.AccessKeyID)
+	assert.Equal(t, "TK2", value.SessionToken)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"access_key": "AK3"}`), 0600))
+	_, err = newFileCredentialsProvider(path, 0).Retrieve()
+	assert.Error(t, err)
+}
+
+func TestParseCredentialsFile(t *testing.T) {
+	content, err := parseCredentialsFile([]byte(`
+# injected by Vault agent
+[default]
+access_key = AK1
+secret_key = "SK1"
+
+[other]
+access_key = AK2
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, credentialsFileContent{AccessKey: "AK1", SecretKey: "SK1"}, content)
+
+	content, err = parseCredentialsFile([]byte("aws_access_key_id=AK3\naws_secret_access_key=SK3\naws_session_token=TK3\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, credentialsFileContent{AccessKey: "AK3", SecretKey: "SK3", SessionToken: "TK3"}, content)
+
+	_, err = parseCredentialsFile([]byte("[default]\naccess_key\n"))
+	assert.Error(t, err)
+}
+
+func TestFileCredentialsProviderWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	assert.NoError(t, os.WriteFile(path, []byte("access_key = AK1\nsecret_key = SK1\n"), 0600))
+
+	provider := newFileCredentialsProvider(path, time.Hour)
+	creds := credentials.NewCredentials(provider)
+	value, err := creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AK1", value.AccessKeyID)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	provider.watch(stop)
+
+	assert.NoError(t, os.WriteFile(path+".tmp", []byte("access_key = AK2\nsecret_key = SK2\n"), 0600))
+	assert.NoError(t, os.Rename(path+".tmp", path))
+	assert.Eventually(t, func() bool {
+		value, err := creds.Get()
+		return err == nil && value.AccessKeyID == "AK2"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestOapiSigningTransport(t *testing.T) {
+	var authorization, token, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		token = r.Header.Get("X-Amz-Security-Token")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	creds := credentials.NewStaticCredentials("AKTEST", "SKTEST", "TKTEST")
+	client := &http.Client{Transport: newOapiSigningTransport(creds, nil)}
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/ReadVms", strings.NewReader(`{"Filters":{}}`))
+	assert.NoError(t, err)
+	response, err := client.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+
+	assert.True(t, strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKTEST/"), authorization)
+	assert.Contains(t, authorization, "/oapi/aws4_request")
+	assert.Equal(t, "TKTEST", token)
+	assert.Equal(t, `{"Filters":{}}`, body)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Deletion Protection *********************
+
+// EventDeletionProtected is recorded when the deletion of a protected load balancer is refused
+const EventDeletionProtected = "DeletionProtected"
+
+// getDeletionProtection returns whether the ServiceAnnotationLoadBalancerDeletionProtection
+// annotation protects the load balancer from deletion
+func getDeletionProtection(annotations map[string]string) (bool, error) {
+	value, found := annotations[ServiceAnnotationLoadBalancerDeletionProtection]
+	if !found {
+		return false, nil
+	}
+	protected, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("error parsing service annotation: %s=%s, expected true or false",
+			ServiceAnnotationLoadBalancerDeletionProtection, value)
+	}
+	return protected, nil
+}
+
+// checkDeletionProtection returns an error, and reports a DeletionProtected event, when the
+// load balancer of the service exists and is protected from deletion. An invalid annotation
+// protects the load balancer as well, so that a typo can't get it deleted.
+func (c *Cloud) checkDeletionProtection(service *v1.Service, loadBalancerName string) error {
+	klog.V(5).Infof("checkDeletionProtection(%v, %v)", service, loadBalancerName)
+	protected, err := getDeletionProtection(service.Annotations)
+	if !protected && err == nil {
+		return nil
+	}
+
+	lb, describeErr := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
+	if describeErr != nil {
+		return describeErr
+	}
+	if lb == nil {
+		return nil
+	}
+
+	if err == nil {
+		err = fmt.Errorf("load balancer %s is protected from deletion, remove the %s annotation of service %s/%s to delete it",
+			loadBalancerName, ServiceAnnotationLoadBalancerDeletionProtection, service.Namespace, service.Name)
+	} else {
+		err = fmt.Errorf("load balancer %s is protected from deletion: %v", loadBalancerName, err)
+	}
+	klog.Warning(err)
+	if c.eventRecorder != nil {
+		c.eventRecorder.Event(service, v1.EventTypeWarning, EventDeletionProtected, err.Error())
+	}
+	return err
+}
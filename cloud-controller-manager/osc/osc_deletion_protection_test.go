@@ -0,0 +1,70 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestCheckDeletionProtection(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:        "entrypoint",
+		Namespace:   "prod",
+		UID:         "anuid",
+		Annotations: map[string]string{ServiceAnnotationLoadBalancerDeletionProtection: "true"},
+	}}
+	loadBalancerName := c.GetLoadBalancerName(context.TODO(), TestClusterName, service)
+
+	// Nothing to protect before the load balancer is created
+	assert.NoError(t, c.checkDeletionProtection(service, loadBalancerName))
+
+	_, err = awsServices.elb.CreateLoadBalancer(&elb.CreateLoadBalancerInput{LoadBalancerName: aws.String(loadBalancerName)})
+	assert.NoError(t, err)
+
+	err = c.EnsureLoadBalancerDeleted(context.TODO(), TestClusterName, service)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), ServiceAnnotationLoadBalancerDeletionProtection)
+	}
+	assert.Contains(t, awsServices.elb.(*FakeELB).LoadBalancers, loadBalancerName)
+	if assert.Len(t, recorder.Events, 1) {
+		assert.True(t, strings.HasPrefix(<-recorder.Events, "Warning "+EventDeletionProtected))
+	}
+
+	// An invalid value protects the load balancer too
+	service.Annotations[ServiceAnnotationLoadBalancerDeletionProtection] = "yes please"
+	assert.Error(t, c.checkDeletionProtection(service, loadBalancerName))
+
+	service.Annotations[ServiceAnnotationLoadBalancerDeletionProtection] = "false"
+	assert.NoError(t, c.checkDeletionProtection(service, loadBalancerName))
+	delete(service.Annotations, ServiceAnnotationLoadBalancerDeletionProtection)
+	assert.NoError(t, c.checkDeletionProtection(service, loadBalancerName))
+}
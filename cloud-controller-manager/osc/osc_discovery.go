@@ -0,0 +1,77 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"golang.org/x/sync/errgroup"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Concurrent Discovery *********************
+
+// maxConcurrentDiscoveryReads bounds the number of independent reads issued
+// concurrently while building a load balancer
+const maxConcurrentDiscoveryReads = 4
+
+// newDiscoveryGroup returns an errgroup running at most maxConcurrentDiscoveryReads reads
+func newDiscoveryGroup() *errgroup.Group {
+	group := &errgroup.Group{}
+	group.SetLimit(maxConcurrentDiscoveryReads)
+	return group
+}
+
+// loadBalancerDiscovery holds the cloud resources read before building a load balancer
+type loadBalancerDiscovery struct {
+	instances map[InstanceID]*osc.Vm
+	subnetIDs []string
+	// Subnet IDs by AZ, one per AZ
+	subnetsByAZ map[string]string
+}
+
+// discoverLoadBalancerResources reads the backend instances and the candidate subnets
+// of a load balancer concurrently
+func (c *Cloud) discoverLoadBalancerResources(annotations map[string]string, nodes []*v1.Node,
+	internalELB bool) (*loadBalancerDiscovery, error) {
+	klog.V(5).Infof("discoverLoadBalancerResources(%v, %v, %v)", annotations, nodes, internalELB)
+
+	discovery := &loadBalancerDiscovery{}
+	group := newDiscoveryGroup()
+	group.Go(func() error {
+		instances, err := c.findBackendInstances(annotations, nodes)
+		klog.V(5).Infof("Found backend instances %v", instances)
+		discovery.instances = instances
+		return err
+	})
+	group.Go(func() error {
+		subnetsByAZ, err := c.loadBalancerSubnetService(annotations).findELBSubnetsByAZ(internalELB)
+		if err != nil {
+			klog.Errorf("Error listing subnets in VPC: %q", err)
+			return err
+		}
+		klog.V(2).Infof("Found load balancer subnets by AZ %v", subnetsByAZ)
+		discovery.subnetsByAZ = subnetsByAZ
+		discovery.subnetIDs = sortedSubnetIDs(subnetsByAZ)
+		return nil
+	})
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return discovery, nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiscoverLoadBalancerResources(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.vpcID = "vpc-123456"
+
+	awsServices.instances = append(awsServices.instances, &osc.Vm{
+		VmId:  aws.String("i-aaaaaaaa"),
+		State: aws.String("running"),
+		Tags:  awsServices.selfInstance.Tags,
+	})
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+		1: {"id": "subnet-b0000001", "az": "af-south-1b"},
+	}) {
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true, "subnet-b0000001": false}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-aaaaaaaa"},
+	}}
+
+	discovery, err := c.discoverLoadBalancerResources(nil, nodes, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"subnet-a0000001"}, discovery.subnetIDs)
+	assert.Equal(t, map[string]string{"af-south-1a": "subnet-a0000001"}, discovery.subnetsByAZ)
+	assert.Contains(t, discovery.instances, InstanceID("i-aaaaaaaa"))
+
+	awsServices.compute.RemoveRouteTables()
+	_, err = c.discoverLoadBalancerResources(nil, nodes, false)
+	assert.Error(t, err, "subnets without route table cannot be classified")
+}
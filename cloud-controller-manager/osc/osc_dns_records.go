@@ -0,0 +1,267 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/route53"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM DNS Records *********************
+
+const (
+	// defaultDNSRecordTTL is the TTL of the DNS records when DNSRecordTTL is not set
+	defaultDNSRecordTTL = 60
+
+	// EventUpdatedDNSRecord is recorded when the DNS record of the load balancer is created,
+	// updated or deleted
+	EventUpdatedDNSRecord = "UpdatedDNSRecord"
+)
+
+// dnsRecords registers the DNS names of the load balancers as CNAME records in a hosted zone
+// of a Route 53 compatible DNS service
+type dnsRecords struct {
+	client DNS
+	zoneID string
+	ttl    int64
+}
+
+func newDNSRecords(client DNS, zoneID string, ttl int) *dnsRecords {
+	if ttl <= 0 {
+		ttl = defaultDNSRecordTTL
+	}
+	return &dnsRecords{client: client, zoneID: zoneID, ttl: int64(ttl)}
+}
+
+// getLoadBalancerDNSName returns the normalized name of the ServiceAnnotationLoadBalancerDNSName
+// annotation, or an empty string when it is not set
+func getLoadBalancerDNSName(annotations map[string]string) (string, error) {
+	value, found := annotations[ServiceAnnotationLoadBalancerDNSName]
+	if !found {
+		return "", nil
+	}
+	name := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), ".")
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid DNS name %q in annotation %s: %s", value, ServiceAnnotationLoadBalancerDNSName,
+			strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
+// fqdn returns the name as returned by the DNS service, with the trailing dot
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+// find returns the CNAME record of the name, or nil when it does not exist
+func (r *dnsRecords) find(name string) (*route53.ResourceRecordSet, error) {
+	output, err := r.client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(r.zoneID),
+		StartRecordName: aws.String(fqdn(name)),
+		StartRecordType: aws.String(route53.RRTypeCname),
+		MaxItems:        aws.String("1"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the DNS records of %s: %q", name, err)
+	}
+	for _, record := range output.ResourceRecordSets {
+		if strings.EqualFold(aws.StringValue(record.Name), fqdn(name)) && aws.StringValue(record.Type) == route53.RRTypeCname {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+// recordTarget returns the target of a CNAME record
+func recordTarget(record *route53.ResourceRecordSet) string {
+	if len(record.ResourceRecords) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(aws.StringValue(record.ResourceRecords[0].Value), ".")
+}
+
+// upsert points the name to the target and returns whether the record changed. A record
+// pointing elsewhere is only overwritten when owned, i.e. created for the same load balancer,
+// or when it points to replaced, the load balancer replaced by a scheme switch.
+func (r *dnsRecords) upsert(name, target string, owned bool, replaced string) (bool, error) {
+	record, err := r.find(name)
+	if err != nil {
+		return false, err
+	}
+	if record != nil {
+		if strings.EqualFold(recordTarget(record), target) && aws.Int64Value(record.TTL) == r.ttl {
+			return false, nil
+		}
+		owned = owned || (replaced != "" && strings.EqualFold(recordTarget(record), replaced))
+		if !owned && !strings.EqualFold(recordTarget(record), target) {
+			return false, fmt.Errorf("DNS record %s already points to %s", name, recordTarget(record))
+		}
+	}
+
+	klog.V(2).Infof("Pointing DNS record %s to %s", name, target)
+	err = r.change(route53.ChangeActionUpsert, &route53.ResourceRecordSet{
+		Name:            aws.String(fqdn(name)),
+		Type:            aws.String(route53.RRTypeCname),
+		TTL:             aws.Int64(r.ttl),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(target)}},
+	})
+	return err == nil, err
+}
+
+// delete deletes the record of the name when it points to the target, and returns whether
+// it was deleted. The records pointing elsewhere were not created for the load balancer.
+func (r *dnsRecords) delete(name, target string) (bool, error) {
+	record, err := r.find(name)
+	if err != nil || record == nil {
+		return false, err
+	}
+	if !strings.EqualFold(recordTarget(record), target) {
+		klog.Warningf("Keeping DNS record %s, pointing to %s instead of %s", name, recordTarget(record), target)
+		return false, nil
+	}
+
+	klog.V(2).Infof("Deleting DNS record %s", name)
+	err = r.change(route53.ChangeActionDelete, record)
+	return err == nil, err
+}
+
+func (r *dnsRecords) change(action string, record *route53.ResourceRecordSet) error {
+	_, err := r.client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(r.zoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{{Action: aws.String(action), ResourceRecordSet: record}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error changing DNS record %s: %q", aws.StringValue(record.Name), err)
+	}
+	return nil
+}
+
+// ensureLoadBalancerDNSRecord points the name of the ServiceAnnotationLoadBalancerDNSName
+// annotation to the DNS name of the load balancer. The name is recorded in the
+// TagNameDNSName tag of the load balancer, so that the record is deleted when the annotation
+// changes or the load balancer is deleted.
+func (c *Cloud) ensureLoadBalancerDNSRecord(service *v1.Service, loadBalancer *elb.LoadBalancerDescription,
+	annotations map[string]string) error {
+	klog.V(5).Infof("ensureLoadBalancerDNSRecord(%v, %v)", aws.StringValue(loadBalancer.LoadBalancerName), annotations)
+	name, err := getLoadBalancerDNSName(annotations)
+	if err != nil {
+		return err
+	}
+	loadBalancerName := aws.StringValue(loadBalancer.LoadBalancerName)
+	target := aws.StringValue(loadBalancer.DNSName)
+	if name != "" && c.dnsRecords == nil {
+		return fmt.Errorf("annotation %s requires DNSHostedZoneID in the cloud config", ServiceAnnotationLoadBalancerDNSName)
+	}
+	if c.dnsRecords == nil || target == "" {
+		// The record is set once the load balancer has a DNS name
+		return nil
+	}
+
+	tags, err := c.loadBalancerService.describeLoadBalancerTags(loadBalancerName)
+	if err != nil {
+		return err
+	}
+	previous, tagged := tags[TagNameDNSName]
+	replaced := ""
+	if !tagged {
+		if replaced, previous, err = c.switchedLoadBalancerDNSRecord(service, loadBalancerName); err != nil {
+			return err
+		}
+	}
+	if name != "" {
+		changed, err := c.dnsRecords.upsert(name, target, previous == name, replaced)
+		if err != nil {
+			return err
+		}
+		if changed {
+			c.recordLoadBalancerEvent(service, EventUpdatedDNSRecord, "Pointed DNS record %s to %s", name, target)
+		}
+	}
+	if previous == name {
+		if tagged || name == "" {
+			return nil
+		}
+		// The record of the load balancer replaced by a scheme switch now belongs to this one
+		return c.loadBalancerService.addLoadBalancerTags(loadBalancerName, map[string]string{TagNameDNSName: name})
+	}
+
+	// The previous record is only deleted once the new one is set
+	if previous != "" {
+		deleted, err := c.dnsRecords.delete(previous, target)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			c.recordLoadBalancerEvent(service, EventUpdatedDNSRecord, "Deleted DNS record %s", previous)
+		}
+	}
+	if name == "" {
+		return c.loadBalancerService.removeLoadBalancerTags(loadBalancerName, []string{TagNameDNSName})
+	}
+	return c.loadBalancerService.addLoadBalancerTags(loadBalancerName, map[string]string{TagNameDNSName: name})
+}
+
+// switchedLoadBalancerDNSRecord returns the DNS name of the load balancer replaced by a scheme
+// switch, see deletePreviousLoadBalancer, and the DNS record it is tagged with, if any
+func (c *Cloud) switchedLoadBalancerDNSRecord(service *v1.Service, loadBalancerName string) (string, string, error) {
+	previous := service.Annotations[ServiceAnnotationLoadBalancerPreviousName]
+	if previous == "" || previous == loadBalancerName {
+		return "", "", nil
+	}
+	loadBalancer, err := c.loadBalancerService.describeLoadBalancer(previous)
+	if err != nil || loadBalancer == nil {
+		return "", "", err
+	}
+	tags, err := c.loadBalancerService.describeLoadBalancerTags(previous)
+	if err != nil {
+		return "", "", err
+	}
+	return aws.StringValue(loadBalancer.DNSName), tags[TagNameDNSName], nil
+}
+
+// deleteLoadBalancerDNSRecord deletes the DNS record set for the load balancer, if any
+func (c *Cloud) deleteLoadBalancerDNSRecord(service *v1.Service, loadBalancer *elb.LoadBalancerDescription) error {
+	klog.V(5).Infof("deleteLoadBalancerDNSRecord(%v)", aws.StringValue(loadBalancer.LoadBalancerName))
+	if c.dnsRecords == nil {
+		return nil
+	}
+	tags, err := c.loadBalancerService.describeLoadBalancerTags(aws.StringValue(loadBalancer.LoadBalancerName))
+	if err != nil {
+		return err
+	}
+	name := tags[TagNameDNSName]
+	if name == "" {
+		return nil
+	}
+	deleted, err := c.dnsRecords.delete(name, aws.StringValue(loadBalancer.DNSName))
+	if err != nil {
+		return err
+	}
+	if deleted {
+		c.recordLoadBalancerEvent(service, EventUpdatedDNSRecord, "Deleted DNS record %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetLoadBalancerDNSName(t *testing.T) {
+	name, err := getLoadBalancerDNSName(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+
+	name, err = getLoadBalancerDNSName(map[string]string{ServiceAnnotationLoadBalancerDNSName: " API.example.internal. "})
+	assert.NoError(t, err)
+	assert.Equal(t, "api.example.internal", name)
+
+	_, err = getLoadBalancerDNSName(map[string]string{ServiceAnnotationLoadBalancerDNSName: "api_example"})
+	assert.Error(t, err)
+}
+
+func TestLoadBalancerDNSRecord(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	cfg := CloudConfig{}
+	cfg.Global.DNSHostedZoneID = "Z123"
+	c, err := newCloud(cfg, awsServices)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+	records := awsServices.dns.(*FakeDNS).Records
+
+	_, err = awsServices.elb.CreateLoadBalancer(&elb.CreateLoadBalancerInput{LoadBalancerName: aws.String("lb-dns")})
+	require.NoError(t, err)
+	loadBalancer, err := c.loadBalancerService.describeLoadBalancer("lb-dns")
+	require.NoError(t, err)
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:        "api",
+		Namespace:   "prod",
+		Annotations: map[string]string{ServiceAnnotationLoadBalancerDNSName: "api.example.internal"},
+	}}
+
+	require.NoError(t, c.ensureLoadBalancerDNSRecord(service, loadBalancer, service.Annotations))
+	if assert.Contains(t, records, "api.example.internal./CNAME") {
+		record := records["api.example.internal./CNAME"]
+		assert.Equal(t, "lb-dns", recordTarget(record))
+		assert.Equal(t, int64(defaultDNSRecordTTL), aws.Int64Value(record.TTL))
+	}
+	tags, err := c.loadBalancerService.describeLoadBalancerTags("lb-dns")
+	require.NoError(t, err)
+	assert.Equal(t, "api.example.internal", tags[TagNameDNSName])
+	assert.Len(t, recorder.Events, 1)
+
+	// Nothing changes on the next reconciliation
+	require.NoError(t, c.ensureLoadBalancerDNSRecord(service, loadBalancer, service.Annotations))
+	assert.Len(t, recorder.Events, 1)
+
+	// A record of another load balancer is not overwritten
+	records["db.example.internal./CNAME"] = &route53.ResourceRecordSet{
+		Name:            aws.String("db.example.internal."),
+		Type:            aws.String(route53.RRTypeCname),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("lb-db")}},
+	}
+	service.Annotations[ServiceAnnotationLoadBalancerDNSName] = "db.example.internal"
+	err = c.ensureLoadBalancerDNSRecord(service, loadBalancer, service.Annotations)
+	assert.EqualError(t, err, "DNS record db.example.internal already points to lb-db")
+	assert.Contains(t, records, "api.example.internal./CNAME")
+
+	// Renaming deletes the previous record
+	service.Annotations[ServiceAnnotationLoadBalancerDNSName] = "api2.example.internal"
+	require.NoError(t, c.ensureLoadBalancerDNSRecord(service, loadBalancer, service.Annotations))
+	assert.NotContains(t, records, "api.example.internal./CNAME")
+	assert.Contains(t, records, "api2.example.internal./CNAME")
+	assert.Contains(t, records, "db.example.internal./CNAME")
+
+	require.NoError(t, c.deleteLoadBalancerDNSRecord(service, loadBalancer))
+	assert.NotContains(t, records, "api2.example.internal./CNAME")
+	assert.Contains(t, records, "db.example.internal./CNAME")
+
+	// The record of the load balancer replaced by a scheme switch is taken over
+	require.NoError(t, c.ensureLoadBalancerDNSRecord(service, loadBalancer, service.Annotations))
+	_, err = awsServices.elb.CreateLoadBalancer(&elb.CreateLoadBalancerInput{LoadBalancerName: aws.String("lb-switched")})
+	require.NoError(t, err)
+	switched, err := c.loadBalancerService.describeLoadBalancer("lb-switched")
+	require.NoError(t, err)
+	service.Annotations[ServiceAnnotationLoadBalancerPreviousName] = "lb-dns"
+	require.NoError(t, c.ensureLoadBalancerDNSRecord(service, switched, service.Annotations))
+	assert.Equal(t, "lb-switched", recordTarget(records["api2.example.internal./CNAME"]))
+	tags, err = c.loadBalancerService.describeLoadBalancerTags("lb-switched")
+	require.NoError(t, err)
+	assert.Equal(t, "api2.example.internal", tags[TagNameDNSName])
+	require.NoError(t, c.deleteLoadBalancerDNSRecord(service, loadBalancer))
+	assert.Contains(t, records, "api2.example.internal./CNAME", "the record of the replaced load balancer was taken over")
+
+	// The annotation requires a hosted zone
+	c.dnsRecords = nil
+	err = c.ensureLoadBalancerDNSRecord(service, loadBalancer, service.Annotations)
+	assert.ErrorContains(t, err, "requires DNSHostedZoneID")
+}
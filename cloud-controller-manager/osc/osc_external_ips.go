@@ -0,0 +1,216 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM External IPs Ingress *********************
+
+// The rules opening the node security groups to the spec.externalIPs of a Service are
+// marked in tags of their security group, see ruleMarkers: the keys are
+// TagNameExternalIPRulesPrefix followed by the namespaced name of the Service and an index.
+// The legacy tags marking a single rule, with the key TagNameExternalIPRulePrefix followed
+// by the hash of the rule and the namespaced name of the Service as value, are replaced.
+
+// serviceRuleMarkers returns the rules of the service marked in the tags with keys starting
+// with prefix followed by the namespaced name of the service, and in the legacy tags with
+// keys starting with legacyPrefix and the namespaced name of the service as value
+func serviceRuleMarkers(tags []osc.ResourceTag, prefix string, legacyPrefix string, serviceName string) ruleMarkers {
+	return readRuleMarkers(tags, prefix+serviceName+"/", func(tag osc.ResourceTag) (string, bool) {
+		if !strings.HasPrefix(tag.GetKey(), legacyPrefix) || tag.GetValue() != serviceName {
+			return "", false
+		}
+		return strings.TrimPrefix(tag.GetKey(), legacyPrefix), true
+	})
+}
+
+// getExternalIPsIngress returns whether the ServiceAnnotationLoadBalancerExternalIPsIngress
+// annotation is true
+func getExternalIPsIngress(annotations map[string]string) (bool, error) {
+	value, found := annotations[ServiceAnnotationLoadBalancerExternalIPsIngress]
+	if !found {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("error parsing service annotation %s=%s: %v", ServiceAnnotationLoadBalancerExternalIPsIngress, value, err)
+	}
+	return enabled, nil
+}
+
+// externalIPRule returns the rule opening the port to the IP range
+func externalIPRule(protocol string, port int32, ipRange string) osc.SecurityGroupRule {
+	return osc.SecurityGroupRule{
+		IpProtocol:    aws.String(protocol),
+		FromPortRange: &port,
+		ToPortRange:   &port,
+		IpRanges:      &[]string{ipRange},
+	}
+}
+
+// externalIPRules returns the rules opening the node ports of the service to its external
+// IPs, of either family
+func externalIPRules(service *v1.Service) (IPRulesSet, error) {
+	rules := NewIPRulesSet()
+	for _, externalIP := range service.Spec.ExternalIPs {
+		ip := net.ParseIP(strings.TrimSpace(externalIP))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid external IP %q", externalIP)
+		}
+		ipRange := ip.String() + "/128"
+		if ip.To4() != nil {
+			ipRange = ip.String() + "/32"
+		}
+		for _, port := range service.Spec.Ports {
+			if port.NodePort == 0 {
+				continue
+			}
+			protocol := strings.ToLower(string(port.Protocol))
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			rules.Insert(externalIPRule(protocol, port.NodePort, ipRange))
+		}
+	}
+	return rules, nil
+}
+
+// ipRangeSourcedRules returns the ungrouped inbound rules of the security group opened
+// to IP ranges, in the form built by externalIPRule
+func ipRangeSourcedRules(group osc.SecurityGroup) IPRulesSet {
+	rules := NewIPRulesSet()
+	for _, rule := range NewIPRulesSet(group.GetInboundRules()...).Ungroup() {
+		if len(rule.GetIpRanges()) != 1 || len(rule.GetSecurityGroupsMembers()) > 0 || rule.GetFromPortRange() != rule.GetToPortRange() {
+			continue
+		}
+		rules.Insert(externalIPRule(rule.GetIpProtocol(), rule.GetFromPortRange(), rule.GetIpRanges()[0]))
+	}
+	return rules
+}
+
+// ensureExternalIPsIngress opens the node security groups of the instances to the
+// spec.externalIPs of the service on its node ports, when the
+// ServiceAnnotationLoadBalancerExternalIPsIngress annotation is true. The rules previously
+// opened for the service are removed when no longer expected, e.g. when the annotation is
+// false or removed, the external IPs changed or the service is deleted (nil instances).
+func (c *Cloud) ensureExternalIPsIngress(service *v1.Service, instances map[InstanceID]*osc.Vm) error {
+	klog.V(5).Infof("ensureExternalIPsIngress(%v, %v)", service.Name, instances)
+
+	enabled, err := getExternalIPsIngress(service.Annotations)
+	if err != nil {
+		return err
+	}
+	if c.cfg.Global.DisableSecurityGroupIngress {
+		return nil
+	}
+	desired := NewIPRulesSet()
+	if enabled && instances != nil {
+		if desired, err = externalIPRules(service); err != nil {
+			return err
+		}
+	}
+
+	taggedSecurityGroups, err := c.securityGroupService.getTaggedSecurityGroups()
+	if err != nil {
+		return fmt.Errorf("error querying for tagged security groups: %q", err)
+	}
+	instanceSecurityGroupIDs := make(map[string]bool)
+	if len(desired) == 0 {
+		// Only the rules marked for the service are removed
+		instances = nil
+	}
+	for _, instance := range instances {
+		securityGroup, err := findSecurityGroupForInstance(instance, taggedSecurityGroups, c.nodePortNic)
+		if err != nil {
+			return err
+		}
+		if securityGroup != nil && securityGroup.GetSecurityGroupId() != "" {
+			instanceSecurityGroupIDs[securityGroup.GetSecurityGroupId()] = true
+		}
+	}
+
+	serviceName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}.String()
+	for securityGroupID, group := range taggedSecurityGroups {
+		markers := serviceRuleMarkers(group.GetTags(), TagNameExternalIPRulesPrefix, TagNameExternalIPRulePrefix, serviceName)
+		if len(markers.tags) == 0 && !instanceSecurityGroupIDs[securityGroupID] {
+			continue
+		}
+		expected := NewIPRulesSet()
+		if instanceSecurityGroupIDs[securityGroupID] {
+			expected = desired
+		}
+		if err := c.updateServiceRules(securityGroupID, serviceName, ipRangeSourcedRules(group), expected, &markers,
+			"the external IPs"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateServiceRules makes the rules of the security group marked for the service match the
+// expected rules, opened from source. The existing rules not marked for the service are
+// never removed.
+func (c *Cloud) updateServiceRules(securityGroupID string, serviceName string, actual IPRulesSet, expected IPRulesSet,
+	markers *ruleMarkers, source string) error {
+	removed := []osc.SecurityGroupRule{}
+	for _, rule := range actual.Difference(expected) {
+		if markers.has(rule) {
+			removed = append(removed, rule)
+		}
+	}
+	added := expected.Difference(actual).List()
+
+	// The rules are marked before being created, so that a rule is never created without
+	// its marker, and unmarked once removed
+	marked := rulesHashes(NewIPRulesSet(added...))
+	for hash := range markers.hashes {
+		marked[hash] = true
+	}
+	kept := make(map[string]bool)
+	for hash := range rulesHashes(expected) {
+		if marked[hash] {
+			kept[hash] = true
+		}
+	}
+	if err := markers.write(c.compute, securityGroupID, marked); err != nil {
+		return err
+	}
+	if len(added) > 0 {
+		klog.V(2).Infof("Adding %d rules for traffic from %s of service %s to instances (%s)", len(added), source, serviceName, securityGroupID)
+		if _, err := c.securityGroupService.addSecurityGroupRules(securityGroupID, &added, false); err != nil {
+			return err
+		}
+	}
+	if len(removed) > 0 {
+		klog.V(2).Infof("Removing %d rules for traffic from %s of service %s to instances (%s)", len(removed), source, serviceName, securityGroupID)
+		if _, err := c.securityGroupService.removeSecurityGroupRules(securityGroupID, &removed, false); err != nil {
+			return err
+		}
+	}
+	return markers.write(c.compute, securityGroupID, kept)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func externalIPMarkers(group *osc.SecurityGroup) map[string]string {
+	markers := make(map[string]string)
+	for _, tag := range group.GetTags() {
+		if strings.HasPrefix(tag.GetKey(), TagNameExternalIPRulesPrefix) || strings.HasPrefix(tag.GetKey(), TagNameExternalIPRulePrefix) {
+			markers[tag.GetKey()] = tag.GetValue()
+		}
+	}
+	return markers
+}
+
+func TestExternalIPRules(t *testing.T) {
+	service := &v1.Service{Spec: v1.ServiceSpec{
+		ExternalIPs: []string{"203.0.113.10", "2001:db8::10"},
+		Ports: []v1.ServicePort{
+			{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP},
+			{Port: 53, NodePort: 30053, Protocol: v1.ProtocolUDP},
+			{Port: 8080},
+		},
+	}}
+	rules, err := externalIPRules(service)
+	require.NoError(t, err)
+	assert.Equal(t, NewIPRulesSet(
+		externalIPRule("tcp", 30080, "203.0.113.10/32"),
+		externalIPRule("udp", 30053, "203.0.113.10/32"),
+		externalIPRule("tcp", 30080, "2001:db8::10/128"),
+		externalIPRule("udp", 30053, "2001:db8::10/128"),
+	), rules)
+
+	service.Spec.ExternalIPs = []string{"203.0.113"}
+	_, err = externalIPRules(service)
+	assert.EqualError(t, err, `invalid external IP "203.0.113"`)
+}
+
+func TestEnsureExternalIPsIngress(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	group := awsServices.compute.(*FakeComputeImpl).MainSecurityGroup
+	ssh := tcpIngressRule(22, "10.0.0.0/8")
+	foreign := tcpIngressRule(30081, "203.0.113.11/32")
+	group.SetInboundRules([]osc.SecurityGroupRule{ssh, foreign})
+
+	instances := map[InstanceID]*osc.Vm{
+		"i-self": {
+			VmId:           aws.String("i-self"),
+			SecurityGroups: &[]osc.SecurityGroupLight{{SecurityGroupId: aws.String("sg-1234")}},
+		},
+	}
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "prod",
+			Annotations: map[string]string{ServiceAnnotationLoadBalancerExternalIPsIngress: "true"},
+		},
+		Spec: v1.ServiceSpec{
+			ExternalIPs: []string{"203.0.113.10", "203.0.113.11"},
+			Ports:       []v1.ServicePort{{Port: 80, NodePort: 30081, Protocol: v1.ProtocolTCP}},
+		},
+	}
+
+	// The existing rule of another tool is neither marked nor duplicated
+	require.NoError(t, c.ensureExternalIPsIngress(service, instances))
+	opened := tcpIngressRule(30081, "203.0.113.10/32")
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, foreign, opened}, group.GetInboundRules())
+	assert.Equal(t, map[string]string{TagNameExternalIPRulesPrefix + "prod/web/0": ruleHash(opened)}, externalIPMarkers(group))
+
+	// The rules follow the external IPs, the rule of another tool is kept
+	service.Spec.ExternalIPs = []string{"2001:db8::10"}
+	require.NoError(t, c.ensureExternalIPsIngress(service, instances))
+	opened = tcpIngressRule(30081, "2001:db8::10/128")
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, foreign, opened}, group.GetInboundRules())
+	assert.Equal(t, map[string]string{TagNameExternalIPRulesPrefix + "prod/web/0": ruleHash(opened)}, externalIPMarkers(group))
+
+	// All the rules of the service are removed once deleted
+	require.NoError(t, c.ensureExternalIPsIngress(service, nil))
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, foreign}, group.GetInboundRules())
+	assert.Empty(t, externalIPMarkers(group))
+
+	// The rules of the service are removed with the annotation
+	require.NoError(t, c.ensureExternalIPsIngress(service, instances))
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, foreign, opened}, group.GetInboundRules())
+	delete(service.Annotations, ServiceAnnotationLoadBalancerExternalIPsIngress)
+	require.NoError(t, c.ensureExternalIPsIngress(service, instances))
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, foreign}, group.GetInboundRules())
+	assert.Empty(t, externalIPMarkers(group))
+
+	// The legacy marker of a rule is replaced, the rule being removed once no longer expected
+	group.SetInboundRules([]osc.SecurityGroupRule{ssh, foreign, opened})
+	group.SetTags(append(group.GetTags(), osc.ResourceTag{Key: TagNameExternalIPRulePrefix + ruleHash(opened), Value: "prod/web"}))
+	service.Annotations[ServiceAnnotationLoadBalancerExternalIPsIngress] = "true"
+	service.Spec.ExternalIPs = []string{"203.0.113.10"}
+	require.NoError(t, c.ensureExternalIPsIngress(service, instances))
+	legacy := opened
+	opened = tcpIngressRule(30081, "203.0.113.10/32")
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, foreign, opened}, group.GetInboundRules())
+	assert.Equal(t, map[string]string{TagNameExternalIPRulesPrefix + "prod/web/0": ruleHash(opened)}, externalIPMarkers(group))
+	assert.NotContains(t, group.GetInboundRules(), legacy)
+}
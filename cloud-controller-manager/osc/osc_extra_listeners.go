@@ -0,0 +1,167 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+)
+
+// ********************* CCM Extra Listeners *********************
+
+// maxLoadBalancerListeners is the maximum number of listeners of a load balancer
+const maxLoadBalancerListeners = 100
+
+// extraListenerRange is an entry of the ServiceAnnotationLoadBalancerExtraListeners
+// annotation: the load balancer ports from..to are forwarded to the instance ports
+// instancePort..instancePort+to-from
+type extraListenerRange struct {
+	from         int64
+	to           int64
+	instancePort int64
+	protocol     string
+}
+
+// parseExtraListeners parses the comma separated list of the
+// ServiceAnnotationLoadBalancerExtraListeners annotation, whose entries are
+// "<port>[-<end port>][:<instance port>][/<protocol>]". The instance port defaults to
+// the load balancer port and the protocol to tcp.
+func parseExtraListeners(value string) ([]extraListenerRange, error) {
+	ranges := []extraListenerRange{}
+	count := int64(0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		r := extraListenerRange{protocol: "tcp"}
+		ports := entry
+		if i := strings.Index(ports, "/"); i >= 0 {
+			r.protocol = strings.ToLower(ports[i+1:])
+			ports = ports[:i]
+		}
+		if r.protocol != "tcp" && r.protocol != "http" {
+			return nil, fmt.Errorf("listener %q: unsupported protocol %q, expected tcp or http", entry, r.protocol)
+		}
+
+		instancePort := ""
+		if i := strings.Index(ports, ":"); i >= 0 {
+			instancePort = ports[i+1:]
+			ports = ports[:i]
+		}
+		from, to, found := strings.Cut(ports, "-")
+		var err error
+		if r.from, err = parseListenerPort(from); err != nil {
+			return nil, fmt.Errorf("listener %q: %v", entry, err)
+		}
+		r.to = r.from
+		if found {
+			if r.to, err = parseListenerPort(to); err != nil {
+				return nil, fmt.Errorf("listener %q: %v", entry, err)
+			}
+			if r.to < r.from {
+				return nil, fmt.Errorf("listener %q: empty port range", entry)
+			}
+		}
+		r.instancePort = r.from
+		if instancePort != "" {
+			if r.instancePort, err = parseListenerPort(instancePort); err != nil {
+				return nil, fmt.Errorf("listener %q: %v", entry, err)
+			}
+			if r.instancePort+r.to-r.from > 65535 {
+				return nil, fmt.Errorf("listener %q: instance ports exceed 65535", entry)
+			}
+		}
+
+		count += r.to - r.from + 1
+		if count > maxLoadBalancerListeners {
+			return nil, fmt.Errorf("more than %d extra listeners", maxLoadBalancerListeners)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func parseListenerPort(value string) (int64, error) {
+	port, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", value)
+	}
+	return port, nil
+}
+
+// listeners returns the load balancer listeners of the range
+func (r extraListenerRange) listeners() []*elb.Listener {
+	protocol := strings.ToUpper(r.protocol)
+	listeners := []*elb.Listener{}
+	for port := r.from; port <= r.to; port++ {
+		listeners = append(listeners, &elb.Listener{
+			LoadBalancerPort: aws.Int64(port),
+			InstancePort:     aws.Int64(r.instancePort + port - r.from),
+			Protocol:         aws.String(protocol),
+			InstanceProtocol: aws.String(protocol),
+		})
+	}
+	return listeners
+}
+
+// ingressRule returns the rule of the load balancer security group opening the range
+// to the source ranges
+func (r extraListenerRange) ingressRule(sourceRanges []string) osc.SecurityGroupRule {
+	permission := osc.SecurityGroupRule{}
+	permission.SetFromPortRange(int32(r.from))
+	permission.SetToPortRange(int32(r.to))
+	permission.SetIpRanges(sourceRanges)
+	permission.SetIpProtocol("tcp")
+	return permission
+}
+
+// getExtraListeners returns the extra listener ranges requested on the service, checking
+// that they do not overlap the listeners of the service ports
+func getExtraListeners(annotations map[string]string, listeners []*elb.Listener) ([]extraListenerRange, error) {
+	value, found := annotations[ServiceAnnotationLoadBalancerExtraListeners]
+	if !found {
+		return nil, nil
+	}
+	ranges, err := parseExtraListeners(value)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing service annotation %s=%s: %v", ServiceAnnotationLoadBalancerExtraListeners, value, err)
+	}
+
+	used := make(map[int64]bool)
+	for _, listener := range listeners {
+		used[aws.Int64Value(listener.LoadBalancerPort)] = true
+	}
+	for _, r := range ranges {
+		for port := r.from; port <= r.to; port++ {
+			if used[port] {
+				return nil, fmt.Errorf("extra listener port %d of annotation %s is already used", port, ServiceAnnotationLoadBalancerExtraListeners)
+			}
+			used[port] = true
+		}
+	}
+	if len(used) > maxLoadBalancerListeners {
+		return nil, fmt.Errorf("load balancer would have more than %d listeners", maxLoadBalancerListeners)
+	}
+	return ranges, nil
+}
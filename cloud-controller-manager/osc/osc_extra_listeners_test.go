@@ -0,0 +1,66 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExtraListeners(t *testing.T) {
+	ranges, err := parseExtraListeners("9000:30900, 9100-9102, 9200-9201:31200/http,")
+	assert.NoError(t, err)
+	assert.Equal(t, []extraListenerRange{
+		{from: 9000, to: 9000, instancePort: 30900, protocol: "tcp"},
+		{from: 9100, to: 9102, instancePort: 9100, protocol: "tcp"},
+		{from: 9200, to: 9201, instancePort: 31200, protocol: "http"},
+	}, ranges)
+
+	assert.Equal(t, []*elb.Listener{
+		{LoadBalancerPort: aws.Int64(9200), InstancePort: aws.Int64(31200), Protocol: aws.String("HTTP"), InstanceProtocol: aws.String("HTTP")},
+		{LoadBalancerPort: aws.Int64(9201), InstancePort: aws.Int64(31201), Protocol: aws.String("HTTP"), InstanceProtocol: aws.String("HTTP")},
+	}, ranges[2].listeners())
+
+	rule := ranges[1].ingressRule([]string{"0.0.0.0/0"})
+	assert.Equal(t, int32(9100), rule.GetFromPortRange())
+	assert.Equal(t, int32(9102), rule.GetToPortRange())
+
+	for _, value := range []string{"abc", "0", "70000", "9010-9000", "9000/udp", "9000:65535-65536", "1-200", "65535-65535:65535x"} {
+		_, err := parseExtraListeners(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestGetExtraListeners(t *testing.T) {
+	listeners := []*elb.Listener{{LoadBalancerPort: aws.Int64(80), InstancePort: aws.Int64(30080)}}
+
+	ranges, err := getExtraListeners(map[string]string{}, listeners)
+	assert.NoError(t, err)
+	assert.Empty(t, ranges)
+
+	ranges, err = getExtraListeners(map[string]string{ServiceAnnotationLoadBalancerExtraListeners: "8080-8081"}, listeners)
+	assert.NoError(t, err)
+	assert.Len(t, ranges, 1)
+
+	_, err = getExtraListeners(map[string]string{ServiceAnnotationLoadBalancerExtraListeners: "79-81"}, listeners)
+	assert.Error(t, err)
+	_, err = getExtraListeners(map[string]string{ServiceAnnotationLoadBalancerExtraListeners: "1000-1099"}, listeners)
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	fakeapi "github.com/outscale-dev/cloud-provider-osc/cloud-controller-manager/testutil"
+)
+
+// newFakeAPICloud returns a cloud provider using the real API clients against a fake API
+// server, with a public subnet of the cluster and a node
+func newFakeAPICloud(t *testing.T) (*Cloud, *fakeapi.FakeAPIServer, *v1.Node) {
+	s := fakeapi.NewFakeAPIServer()
+	t.Cleanup(s.Close)
+	previous := apiClients
+	apiClients = &apiClientSettings{endpoints: map[string]string{
+		oapiServiceName:     s.OapiEndpoint(),
+		"lbu":               s.LbuEndpoint(),
+		metadataServiceName: s.MetadataEndpoint(),
+	}}
+	t.Cleanup(func() { apiClients = previous })
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("OSC_ENDPOINT_LBU", "")
+
+	clusterTag := osc.ResourceTag{Key: TagNameKubernetesClusterPrefix + TestClusterID, Value: ResourceLifecycleOwned}
+	s.SetMetadata("i-master", "tinav5.c2r4p2", "eu-west-2a")
+	subnet := s.AddSubnet(osc.Subnet{
+		NetId:         osc.PtrString("vpc-1"),
+		SubregionName: osc.PtrString("eu-west-2a"),
+		Tags:          &[]osc.ResourceTag{clusterTag, {Key: TagNameSubnetPublicELB, Value: "1"}},
+	})
+	s.AddRouteTable(osc.RouteTable{
+		NetId:           osc.PtrString("vpc-1"),
+		LinkRouteTables: &[]osc.LinkRouteTable{{SubnetId: osc.PtrString(subnet)}},
+		Routes:          &[]osc.Route{{DestinationIpRange: osc.PtrString("0.0.0.0/0"), GatewayId: osc.PtrString("igw-1")}},
+	})
+	vm := s.AddVm(osc.Vm{
+		NetId:     osc.PtrString("vpc-1"),
+		SubnetId:  osc.PtrString(subnet),
+		PrivateIp: osc.PtrString("10.0.0.10"),
+		Placement: &osc.Placement{SubregionName: osc.PtrString("eu-west-2a")},
+		Tags:      &[]osc.ResourceTag{clusterTag},
+	})
+
+	cfg := CloudConfig{}
+	cfg.Global.Zone = "eu-west-2a"
+	cfg.Global.VPC = "vpc-1"
+	cfg.Global.SubnetID = subnet
+	cfg.Global.KubernetesClusterID = TestClusterID
+	c, err := newCloud(cfg, newAWSSDKProvider(nil, false, &cfg))
+	require.NoError(t, err)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/" + vm},
+	}
+	return c, s, node
+}
+
+func newFakeAPIService(name string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("uid-" + name)},
+		Spec: v1.ServiceSpec{
+			Type:            v1.ServiceTypeLoadBalancer,
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports:           []v1.ServicePort{{Name: "http", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}},
+		},
+	}
+}
+
+func TestFakeAPIServerEnsureLoadBalancer(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	service := newFakeAPIService("web")
+	name := c.GetLoadBalancerName(context.TODO(), TestClusterName, service)
+
+	status, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	require.Len(t, status.Ingress, 1)
+	lb, found := s.LoadBalancer(name)
+	require.True(t, found)
+	assert.Equal(t, aws.StringValue(lb.DNSName), status.Ingress[0].Hostname)
+	require.Len(t, lb.ListenerDescriptions, 1)
+	assert.Equal(t, int64(30080), aws.Int64Value(lb.ListenerDescriptions[0].Listener.InstancePort))
+	require.Len(t, lb.Instances, 1)
+	assert.Equal(t, node.Spec.ProviderID, "aws:///eu-west-2a/"+aws.StringValue(lb.Instances[0].InstanceId))
+	require.Len(t, lb.SecurityGroups, 1)
+	group, found := s.SecurityGroup(aws.StringValue(lb.SecurityGroups[0]))
+	require.True(t, found)
+	assert.True(t, isPortOpen(group.GetInboundRules(), 80))
+
+	// A listener deleted out of band is restored by the next reconciliation
+	s.UpdateLoadBalancer(name, func(lb *elb.LoadBalancerDescription) {
+		lb.ListenerDescriptions = nil
+	})
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	lb, _ = s.LoadBalancer(name)
+	assert.Len(t, lb.ListenerDescriptions, 1)
+
+	require.NoError(t, c.EnsureLoadBalancerDeleted(context.TODO(), TestClusterName, service))
+	_, found = s.LoadBalancer(name)
+	assert.False(t, found)
+	_, found = s.SecurityGroup(aws.StringValue(lb.SecurityGroups[0]))
+	assert.False(t, found)
+}
+
+func TestFakeAPIServerEventualConsistency(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	s.SetConsistencyDelay(1)
+	service := newFakeAPIService("web")
+
+	// The created security group and load balancer are not read back yet, the next syncs
+	// complete the reconciliation
+	_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	assert.ErrorContains(t, err, "security group not found")
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	assert.ErrorContains(t, err, "not found after creation/update")
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	assert.Len(t, s.SecurityGroups(), 1)
+	lb, found := s.LoadBalancer(c.GetLoadBalancerName(context.TODO(), TestClusterName, service))
+	require.True(t, found)
+	groupID := aws.StringValue(lb.SecurityGroups[0])
+
+	// The security group is still used while the load balancer is deleted in the background,
+	// it is deleted by the garbage collector once released
+	require.NoError(t, c.EnsureLoadBalancerDeleted(context.TODO(), TestClusterName, service))
+	assert.Empty(t, s.LoadBalancerNames())
+	group, found := s.SecurityGroup(groupID)
+	require.True(t, found)
+	_, marked := findTag(group.Tags, TagNameSecurityGroupDeletion)
+	assert.True(t, marked)
+	c.securityGroupGC.sync()
+	_, found = s.SecurityGroup(groupID)
+	assert.False(t, found)
+}
+
+func TestFakeAPIServerThrottlingAndPagination(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	s.SetPageSize(2)
+	for i := 0; i < 5; i++ {
+		_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, newFakeAPIService(fmt.Sprintf("web-%d", i)), []*v1.Node{node})
+		require.NoError(t, err)
+	}
+	require.Len(t, s.LoadBalancerNames(), 5)
+
+	// The throttled calls are retried, and the pages are merged
+	calls := s.Calls("DescribeLoadBalancers")
+	s.Throttle("DescribeLoadBalancers", 2)
+	loadBalancers, err := c.loadBalancer.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{})
+	require.NoError(t, err)
+	assert.Len(t, loadBalancers.LoadBalancerDescriptions, 5)
+	assert.Equal(t, 2+3, s.Calls("DescribeLoadBalancers")-calls)
+
+	s.Throttle("ReadVms", 1)
+	_, err = c.compute.ReadVms(&osc.ReadVmsRequest{})
+	require.NoError(t, err)
+}
@@ -21,13 +21,19 @@ package osc
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 )
 
@@ -38,11 +44,15 @@ type FakeOscServices struct {
 	selfInstance                *osc.Vm
 	networkInterfacesMacs       []string
 	networkInterfacesPrivateIPs [][]string
+	networkInterfacesIPv6s      [][]string
 	networkInterfacesVpcIDs     []string
+	networkInterfacesSubnetIDs  []string
 
-	compute  FakeCompute
-	elb      LoadBalancer
-	metadata EC2Metadata
+	compute       FakeCompute
+	elb           LoadBalancer
+	objectStorage ObjectStorage
+	dns           DNS
+	metadata      EC2Metadata
 }
 
 // NewFakeAWSServices creates a new FakeAWSServices
@@ -51,6 +61,8 @@ func NewFakeAWSServices(clusterID string) *FakeOscServices {
 	s.region = "us-east-1"
 	s.compute = &FakeComputeImpl{osc: s}
 	s.elb = &FakeELB{aws: s}
+	s.objectStorage = &FakeObjectStorage{Buckets: sets.NewString()}
+	s.dns = &FakeDNS{Records: make(map[string]*route53.ResourceRecordSet)}
 	s.metadata = &FakeMetadata{aws: s}
 
 	s.networkInterfacesMacs = []string{"aa:bb:cc:dd:ee:00", "aa:bb:cc:dd:ee:01"}
@@ -111,11 +123,87 @@ func (s *FakeOscServices) LoadBalancing(region string) (LoadBalancer, error) {
 	return s.elb, nil
 }
 
+// ObjectStorage returns a fake OOS client
+func (s *FakeOscServices) ObjectStorage(region string) (ObjectStorage, error) {
+	return s.objectStorage, nil
+}
+
+// DNS returns a fake Route 53 client
+func (s *FakeOscServices) DNS(region string) (DNS, error) {
+	return s.dns, nil
+}
+
 // Metadata returns a fake EC2Metadata client
 func (s *FakeOscServices) Metadata() (EC2Metadata, error) {
 	return s.metadata, nil
 }
 
+// FakeObjectStorage is a fake OOS client used for testing
+type FakeObjectStorage struct {
+	// Names of the existing buckets
+	Buckets sets.String
+	// Error returned by CreateBucket when set
+	CreateBucketError error
+}
+
+// HeadBucket returns a NotFound error when the fake bucket does not exist
+func (s *FakeObjectStorage) HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+	if !s.Buckets.Has(aws.StringValue(input.Bucket)) {
+		return nil, awserr.New("NotFound", "Not Found", nil)
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+// CreateBucket creates the fake bucket
+func (s *FakeObjectStorage) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	if s.CreateBucketError != nil {
+		return nil, s.CreateBucketError
+	}
+	s.Buckets.Insert(aws.StringValue(input.Bucket))
+	return &s3.CreateBucketOutput{}, nil
+}
+
+// FakeDNS is a fake Route 53 client used for testing, with a single hosted zone
+type FakeDNS struct {
+	// Record sets of the zone, by name and type, e.g. "api.example.internal./CNAME"
+	Records map[string]*route53.ResourceRecordSet
+}
+
+// ListResourceRecordSets returns the fake record sets from the requested name and type
+func (s *FakeDNS) ListResourceRecordSets(input *route53.ListResourceRecordSetsInput) (*route53.ListResourceRecordSetsOutput, error) {
+	keys := make([]string, 0, len(s.Records))
+	for key := range s.Records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	start := aws.StringValue(input.StartRecordName) + "/" + aws.StringValue(input.StartRecordType)
+	maxItems, _ := strconv.Atoi(aws.StringValue(input.MaxItems))
+	output := &route53.ListResourceRecordSetsOutput{}
+	for _, key := range keys {
+		if key >= start && len(output.ResourceRecordSets) < maxItems {
+			output.ResourceRecordSets = append(output.ResourceRecordSets, s.Records[key])
+		}
+	}
+	return output, nil
+}
+
+// ChangeResourceRecordSets applies the changes to the fake record sets
+func (s *FakeDNS) ChangeResourceRecordSets(input *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error) {
+	for _, change := range input.ChangeBatch.Changes {
+		key := aws.StringValue(change.ResourceRecordSet.Name) + "/" + aws.StringValue(change.ResourceRecordSet.Type)
+		switch aws.StringValue(change.Action) {
+		case route53.ChangeActionUpsert:
+			s.Records[key] = change.ResourceRecordSet
+		case route53.ChangeActionDelete:
+			if _, found := s.Records[key]; !found {
+				return nil, awserr.New(route53.ErrCodeInvalidChangeBatch, "record not found", nil)
+			}
+			delete(s.Records, key)
+		}
+	}
+	return &route53.ChangeResourceRecordSetsOutput{}, nil
+}
+
 // FakeCompute is a fake Compute client used for testing
 type FakeCompute interface {
 	Compute
@@ -133,6 +221,16 @@ type FakeComputeImpl struct {
 	RouteTables              []osc.RouteTable
 	DescribeRouteTablesInput *osc.ReadRouteTablesRequest
 	MainSecurityGroup        *osc.SecurityGroup
+	DeletedSecurityGroups    []string
+	// Security groups besides the main one, read when set
+	SecurityGroups []osc.SecurityGroup
+	// Errors returned when deleting the security groups, by ID
+	DeleteSecurityGroupErrors map[string]error
+	PublicIps                 []osc.PublicIp
+	// Public IPs of the load balancers, by name
+	LoadBalancerPublicIps map[string]string
+	// Whether the public IPs set by UpdateLoadBalancer are not associated yet
+	LoadBalancerPublicIpsPending bool
 }
 
 // ReadVms returns fake instance descriptions
@@ -212,27 +310,66 @@ func (ec2i *FakeComputeImpl) ReadVms(request *osc.ReadVmsRequest) ([]osc.Vm, err
 	return matches, nil
 }
 
-// ReadSecurityGroups is not implemented but is required for interface
-// conformance
+// ReadSecurityGroups returns the main security group, or the security groups matching the
+// IDs and tag keys of the filters when SecurityGroups is set
 func (ec2i *FakeComputeImpl) ReadSecurityGroups(request *osc.ReadSecurityGroupsRequest) ([]osc.SecurityGroup, error) {
-	return []osc.SecurityGroup{*ec2i.MainSecurityGroup}, nil
+	if len(ec2i.SecurityGroups) == 0 {
+		return []osc.SecurityGroup{*ec2i.MainSecurityGroup}, nil
+	}
+	filters := request.GetFilters()
+	matches := []osc.SecurityGroup{}
+	for _, group := range append([]osc.SecurityGroup{*ec2i.MainSecurityGroup}, ec2i.SecurityGroups...) {
+		if filters.SecurityGroupIds != nil && !Contains(filters.GetSecurityGroupIds(), group.GetSecurityGroupId()) {
+			continue
+		}
+		allMatch := true
+		for _, tagKey := range filters.GetTagKeys() {
+			found := false
+			for _, tag := range group.GetTags() {
+				found = found || tag.GetKey() == tagKey
+			}
+			allMatch = allMatch && found
+		}
+		if allMatch {
+			matches = append(matches, group)
+		}
+	}
+	return matches, nil
 }
 
-// CreateSecurityGroup is not implemented but is required for interface
-// conformance
+// CreateSecurityGroup is only implemented in dry run
 func (ec2i *FakeComputeImpl) CreateSecurityGroup(request *osc.CreateSecurityGroupRequest) (*osc.CreateSecurityGroupResponse, error) {
+	if request.GetDryRun() {
+		return &osc.CreateSecurityGroupResponse{}, nil
+	}
 	panic("Not implemented")
 }
 
-// DeleteSecurityGroup is not implemented but is required for interface
-// conformance
+// DeleteSecurityGroup records the deleted security group, or returns its error of
+// DeleteSecurityGroupErrors
 func (ec2i *FakeComputeImpl) DeleteSecurityGroup(request *osc.DeleteSecurityGroupRequest) (*osc.DeleteSecurityGroupResponse, error) {
-	panic("Not implemented")
+	if err, found := ec2i.DeleteSecurityGroupErrors[request.GetSecurityGroupId()]; found {
+		return nil, err
+	}
+	ec2i.DeletedSecurityGroups = append(ec2i.DeletedSecurityGroups, request.GetSecurityGroupId())
+	for i := range ec2i.SecurityGroups {
+		if ec2i.SecurityGroups[i].GetSecurityGroupId() == request.GetSecurityGroupId() {
+			ec2i.SecurityGroups = append(ec2i.SecurityGroups[:i], ec2i.SecurityGroups[i+1:]...)
+			break
+		}
+	}
+	return &osc.DeleteSecurityGroupResponse{}, nil
 }
 
 // CreateSecurityGroupRule is not implemented but is required for
 // interface conformance
 func (ec2i *FakeComputeImpl) CreateSecurityGroupRule(request *osc.CreateSecurityGroupRuleRequest) (*osc.CreateSecurityGroupRuleResponse, error) {
+	if request.GetDryRun() {
+		if !ec2i.hasResource(request.GetSecurityGroupId()) {
+			return nil, fmt.Errorf("InvalidResource: security group %s not found", request.GetSecurityGroupId())
+		}
+		return &osc.CreateSecurityGroupRuleResponse{}, nil
+	}
 	securityGroupID := request.GetSecurityGroupId()
 
 	if ec2i.MainSecurityGroup.GetSecurityGroupId() != securityGroupID {
@@ -241,22 +378,25 @@ func (ec2i *FakeComputeImpl) CreateSecurityGroupRule(request *osc.CreateSecurity
 
 	flow := request.GetFlow()
 
-	rule := osc.SecurityGroupRule{
-		FromPortRange: request.FromPortRange,
-		IpProtocol:    request.IpProtocol,
-		IpRanges:      &[]string{request.GetIpRange()},
-		ToPortRange:   request.ToPortRange,
+	newRules := request.GetRules()
+	if !request.HasRules() {
+		newRules = []osc.SecurityGroupRule{{
+			FromPortRange: request.FromPortRange,
+			IpProtocol:    request.IpProtocol,
+			IpRanges:      &[]string{request.GetIpRange()},
+			ToPortRange:   request.ToPortRange,
+		}}
 	}
 
 	if flow == "Inbound" {
 		rules := ec2i.MainSecurityGroup.GetInboundRules()
 
-		rules = append(rules, rule)
+		rules = append(rules, newRules...)
 		ec2i.MainSecurityGroup.SetInboundRules(rules)
 	} else {
 		rules := ec2i.MainSecurityGroup.GetOutboundRules()
 
-		rules = append(rules, rule)
+		rules = append(rules, newRules...)
 		ec2i.MainSecurityGroup.SetOutboundRules(rules)
 	}
 
@@ -265,10 +405,29 @@ func (ec2i *FakeComputeImpl) CreateSecurityGroupRule(request *osc.CreateSecurity
 	}, nil
 }
 
-// DeleteSecurityGroupRule is not implemented but is required for interface
-// conformance
+// DeleteSecurityGroupRule removes the ungrouped inbound rules of the request from the
+// main security group
 func (ec2i *FakeComputeImpl) DeleteSecurityGroupRule(request *osc.DeleteSecurityGroupRuleRequest) (*osc.DeleteSecurityGroupRuleResponse, error) {
-	panic("Not implemented")
+	if ec2i.MainSecurityGroup.GetSecurityGroupId() != request.GetSecurityGroupId() {
+		return nil, fmt.Errorf("OSC Fake: Wrong security Group Id")
+	}
+	if request.GetFlow() != "Inbound" {
+		panic("Not implemented")
+	}
+
+	rules := NewIPRulesSet(ec2i.MainSecurityGroup.GetInboundRules()...).Ungroup()
+	for _, rule := range NewIPRulesSet(request.GetRules()...).Ungroup() {
+		key := keyForIPRules(&rule)
+		if _, found := rules[key]; !found {
+			return nil, fmt.Errorf("OSC Fake: rule not found %v", key)
+		}
+		delete(rules, key)
+	}
+	ec2i.MainSecurityGroup.SetInboundRules(rules.List())
+
+	return &osc.DeleteSecurityGroupRuleResponse{
+		SecurityGroup: ec2i.MainSecurityGroup,
+	}, nil
 }
 
 // CreateSubnet creates fake subnets
@@ -319,11 +478,105 @@ func (ec2i *FakeComputeImpl) RemoveSubnets() {
 	ec2i.Subnets = ec2i.Subnets[:0]
 }
 
-// CreateTags is not implemented but is required for interface conformance
-func (ec2i *FakeComputeImpl) CreateTags(request *osc.CreateTagsRequest) (*osc.CreateTagsResponse, error) {
+// resourceTags returns the tags of a security group or of a public IP, the other resources
+// are not implemented
+func (ec2i *FakeComputeImpl) resourceTags(id string) *[]osc.ResourceTag {
+	if ec2i.MainSecurityGroup != nil && id == ec2i.MainSecurityGroup.GetSecurityGroupId() {
+		if ec2i.MainSecurityGroup.Tags == nil {
+			ec2i.MainSecurityGroup.SetTags([]osc.ResourceTag{})
+		}
+		return ec2i.MainSecurityGroup.Tags
+	}
+	for i := range ec2i.SecurityGroups {
+		if ec2i.SecurityGroups[i].GetSecurityGroupId() == id {
+			if ec2i.SecurityGroups[i].Tags == nil {
+				ec2i.SecurityGroups[i].SetTags([]osc.ResourceTag{})
+			}
+			return ec2i.SecurityGroups[i].Tags
+		}
+	}
+	for i := range ec2i.PublicIps {
+		if ec2i.PublicIps[i].GetPublicIpId() == id {
+			if ec2i.PublicIps[i].Tags == nil {
+				ec2i.PublicIps[i].SetTags([]osc.ResourceTag{})
+			}
+			return ec2i.PublicIps[i].Tags
+		}
+	}
 	panic("Not implemented")
 }
 
+// hasResource returns whether the VM, the security group or the public IP exists
+func (ec2i *FakeComputeImpl) hasResource(id string) bool {
+	for _, vm := range ec2i.osc.instances {
+		if vm.GetVmId() == id {
+			return true
+		}
+	}
+	if ec2i.MainSecurityGroup != nil && id == ec2i.MainSecurityGroup.GetSecurityGroupId() {
+		return true
+	}
+	for _, securityGroup := range ec2i.SecurityGroups {
+		if securityGroup.GetSecurityGroupId() == id {
+			return true
+		}
+	}
+	for _, publicIP := range ec2i.PublicIps {
+		if publicIP.GetPublicIpId() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTags tags the security groups and the public IPs, the other resources are not
+// implemented
+func (ec2i *FakeComputeImpl) CreateTags(request *osc.CreateTagsRequest) (*osc.CreateTagsResponse, error) {
+	if request.GetDryRun() {
+		for _, id := range request.ResourceIds {
+			if !ec2i.hasResource(id) {
+				return nil, fmt.Errorf("InvalidResource: resource %s not found", id)
+			}
+		}
+		return &osc.CreateTagsResponse{}, nil
+	}
+	for _, id := range request.ResourceIds {
+		resourceTags := ec2i.resourceTags(id)
+		tags := []osc.ResourceTag{}
+		for _, tag := range *resourceTags {
+			replaced := false
+			for _, newTag := range request.Tags {
+				replaced = replaced || newTag.Key == tag.Key
+			}
+			if !replaced {
+				tags = append(tags, tag)
+			}
+		}
+		*resourceTags = append(tags, request.Tags...)
+	}
+	return &osc.CreateTagsResponse{}, nil
+}
+
+// DeleteTags removes tags from the security groups and the public IPs, the other resources
+// are not implemented
+func (ec2i *FakeComputeImpl) DeleteTags(request *osc.DeleteTagsRequest) (*osc.DeleteTagsResponse, error) {
+	for _, id := range request.ResourceIds {
+		resourceTags := ec2i.resourceTags(id)
+		tags := []osc.ResourceTag{}
+		for _, tag := range *resourceTags {
+			deleted := false
+			for _, oldTag := range request.Tags {
+				deleted = deleted || oldTag.Key == tag.Key
+			}
+			if !deleted {
+				tags = append(tags, tag)
+			}
+		}
+		*resourceTags = tags
+	}
+	return &osc.DeleteTagsResponse{}, nil
+}
+
 // ReadRouteTables returns fake route table descriptions
 func (ec2i *FakeComputeImpl) ReadRouteTables(request *osc.ReadRouteTablesRequest) ([]osc.RouteTable, error) {
 	ec2i.DescribeRouteTablesInput = request
@@ -406,6 +659,91 @@ func (ec2i *FakeComputeImpl) UpdateVM(request *osc.UpdateVmRequest) (*osc.Update
 	panic("Not implemented")
 }
 
+// ReadPublicIps returns the fake public IPs matching the ids and tags of the filters
+func (ec2i *FakeComputeImpl) ReadPublicIps(request *osc.ReadPublicIpsRequest) ([]osc.PublicIp, error) {
+	filters := request.GetFilters()
+	matches := []osc.PublicIp{}
+	for _, publicIP := range ec2i.PublicIps {
+		if filters.PublicIpIds != nil && !sets.NewString(filters.GetPublicIpIds()...).Has(publicIP.GetPublicIpId()) {
+			continue
+		}
+		tags := map[string]string{}
+		for _, tag := range publicIP.GetTags() {
+			tags[tag.GetKey()] = tag.GetValue()
+		}
+		allMatch := true
+		for _, tagKey := range filters.GetTagKeys() {
+			_, found := tags[tagKey]
+			allMatch = allMatch && found
+		}
+		for _, tag := range filters.GetTags() {
+			tagKey, tagValue, _ := strings.Cut(tag, "=")
+			value, found := tags[tagKey]
+			allMatch = allMatch && found && value == tagValue
+		}
+		if allMatch {
+			matches = append(matches, publicIP)
+		}
+	}
+	return matches, nil
+}
+
+// CreatePublicIp allocates a fake public IP
+func (ec2i *FakeComputeImpl) CreatePublicIp(request *osc.CreatePublicIpRequest) (*osc.CreatePublicIpResponse, error) {
+	if request.GetDryRun() {
+		return &osc.CreatePublicIpResponse{}, nil
+	}
+	n := len(ec2i.PublicIps) + 1
+	publicIP := osc.PublicIp{
+		PublicIpId: aws.String(fmt.Sprintf("eipalloc-%d", n)),
+		PublicIp:   aws.String(fmt.Sprintf("192.0.2.%d", n)),
+		Tags:       &[]osc.ResourceTag{},
+	}
+	ec2i.PublicIps = append(ec2i.PublicIps, publicIP)
+	return &osc.CreatePublicIpResponse{PublicIp: &publicIP}, nil
+}
+
+// DeletePublicIp releases the fake public IP
+func (ec2i *FakeComputeImpl) DeletePublicIp(request *osc.DeletePublicIpRequest) (*osc.DeletePublicIpResponse, error) {
+	for i, publicIP := range ec2i.PublicIps {
+		if publicIP.GetPublicIpId() == request.GetPublicIpId() {
+			ec2i.PublicIps = append(ec2i.PublicIps[:i], ec2i.PublicIps[i+1:]...)
+			return &osc.DeletePublicIpResponse{}, nil
+		}
+	}
+	return nil, fmt.Errorf("OSC Fake: public IP not found %v", request.GetPublicIpId())
+}
+
+// ReadLoadBalancers returns the fake load balancers with their public IP
+func (ec2i *FakeComputeImpl) ReadLoadBalancers(request *osc.ReadLoadBalancersRequest) ([]osc.LoadBalancer, error) {
+	filters := request.GetFilters()
+	loadBalancers := []osc.LoadBalancer{}
+	for _, name := range filters.GetLoadBalancerNames() {
+		loadBalancer := osc.LoadBalancer{LoadBalancerName: aws.String(name)}
+		if publicIP, found := ec2i.LoadBalancerPublicIps[name]; found {
+			loadBalancer.SetPublicIp(publicIP)
+		}
+		loadBalancers = append(loadBalancers, loadBalancer)
+	}
+	return loadBalancers, nil
+}
+
+// UpdateLoadBalancer records the public IP of the fake load balancer, the other updates
+// are not implemented
+func (ec2i *FakeComputeImpl) UpdateLoadBalancer(request *osc.UpdateLoadBalancerRequest) (*osc.UpdateLoadBalancerResponse, error) {
+	if !request.HasPublicIp() {
+		panic("Not implemented")
+	}
+	if ec2i.LoadBalancerPublicIpsPending {
+		return &osc.UpdateLoadBalancerResponse{}, nil
+	}
+	if ec2i.LoadBalancerPublicIps == nil {
+		ec2i.LoadBalancerPublicIps = map[string]string{}
+	}
+	ec2i.LoadBalancerPublicIps[request.GetLoadBalancerName()] = request.GetPublicIp()
+	return &osc.UpdateLoadBalancerResponse{}, nil
+}
+
 // FakeMetadata is a fake EC2 metadata service client used for testing
 type FakeMetadata struct {
 	aws *FakeOscServices
@@ -482,6 +820,27 @@ func (m *FakeMetadata) GetMetadata(key string) (string, error) {
 				}
 			}
 		}
+		if len(keySplit) == 5 && keySplit[4] == "device-number" {
+			for i, macElem := range m.aws.networkInterfacesMacs {
+				if macParam == macElem {
+					return strconv.Itoa(i), nil
+				}
+			}
+		}
+		if len(keySplit) == 5 && keySplit[4] == "subnet-id" {
+			for i, macElem := range m.aws.networkInterfacesMacs {
+				if macParam == macElem && i < len(m.aws.networkInterfacesSubnetIDs) {
+					return m.aws.networkInterfacesSubnetIDs[i], nil
+				}
+			}
+		}
+		if len(keySplit) == 5 && keySplit[4] == "ipv6s" {
+			for i, macElem := range m.aws.networkInterfacesMacs {
+				if macParam == macElem && i < len(m.aws.networkInterfacesIPv6s) {
+					return strings.Join(m.aws.networkInterfacesIPv6s[i], "\n"), nil
+				}
+			}
+		}
 
 		return "", nil
 	}
@@ -493,33 +852,71 @@ func (m *FakeMetadata) GetMetadata(key string) (string, error) {
 type FakeELB struct {
 	aws           *FakeOscServices
 	LoadBalancers map[string]*elb.LoadBalancerDescription
+	// Health state reported by DescribeInstanceHealth, indexed by instance id
+	InstanceHealth map[string]string
+	// Maximum number of subnets accepted by CreateLoadBalancer, unlimited when 0
+	MaxSubnets int
+	// Error returned by CreateLoadBalancer when set
+	CreateLoadBalancerError error
+	// Number of load balancers listed by a DescribeLoadBalancers page, unpaged when 0
+	PageSize int
+	// Attributes set by the last ModifyLoadBalancerAttributes, indexed by load balancer name
+	ModifiedAttributes map[string]*elb.LoadBalancerAttributes
+	// Attributes of the load balancers, indexed by load balancer name, the defaults of LBU
+	// when not modified
+	Attributes map[string]*elb.LoadBalancerAttributes
+	// Tags set by CreateLoadBalancer and AddTags, indexed by load balancer name
+	Tags map[string][]*elb.Tag
+	// Policies created by CreateLoadBalancerPolicy, indexed by load balancer and policy name
+	Policies map[string]map[string]*elb.CreateLoadBalancerPolicyInput
+	// Policy attributes rejected by CreateLoadBalancerPolicy
+	RejectedPolicyAttributes []string
 }
 
 // CreateLoadBalancer is not implemented but is required for interface
 // conformance
 func (fakeElb *FakeELB) CreateLoadBalancer(input *elb.CreateLoadBalancerInput) (*elb.CreateLoadBalancerOutput, error) {
+	if fakeElb.MaxSubnets > 0 && len(input.Subnets) > fakeElb.MaxSubnets {
+		return nil, awserr.New(elbErrCodeMultipleSubnetsUnsupported, fmt.Sprintf("at most %d subnets are supported", fakeElb.MaxSubnets), nil)
+	}
+	if fakeElb.CreateLoadBalancerError != nil {
+		return nil, fakeElb.CreateLoadBalancerError
+	}
 	lb := elb.LoadBalancerDescription{
 		Subnets:           input.Subnets,
 		AvailabilityZones: input.AvailabilityZones,
 		DNSName:           aws.String(fmt.Sprintf("%v", *input.LoadBalancerName)),
 		HealthCheck:       &elb.HealthCheck{},
 		LoadBalancerName:  input.LoadBalancerName,
+		Scheme:            aws.String(loadBalancerSchemeInternetFacing),
+		SecurityGroups:    input.SecurityGroups,
+	}
+	if input.Scheme != nil {
+		lb.Scheme = input.Scheme
+	}
+	for _, listener := range input.Listeners {
+		lb.ListenerDescriptions = append(lb.ListenerDescriptions, &elb.ListenerDescription{Listener: listener})
 	}
 
 	if fakeElb.LoadBalancers == nil {
 		fakeElb.LoadBalancers = make(map[string]*elb.LoadBalancerDescription)
 	}
 	fakeElb.LoadBalancers[*input.LoadBalancerName] = &lb
+	if fakeElb.Tags == nil {
+		fakeElb.Tags = make(map[string][]*elb.Tag)
+	}
+	fakeElb.Tags[*input.LoadBalancerName] = input.Tags
 
 	return &elb.CreateLoadBalancerOutput{
 		DNSName: lb.DNSName,
 	}, nil
 }
 
-// DeleteLoadBalancer is not implemented but is required for interface
-// conformance
+// DeleteLoadBalancer removes the fake load balancer
 func (fakeElb *FakeELB) DeleteLoadBalancer(input *elb.DeleteLoadBalancerInput) (*elb.DeleteLoadBalancerOutput, error) {
-	panic("Not implemented")
+	delete(fakeElb.LoadBalancers, aws.StringValue(input.LoadBalancerName))
+	delete(fakeElb.Tags, aws.StringValue(input.LoadBalancerName))
+	return &elb.DeleteLoadBalancerOutput{}, nil
 }
 
 // DescribeLoadBalancers is not implemented but is required for interface
@@ -531,15 +928,83 @@ func (fakeElb *FakeELB) DescribeLoadBalancers(input *elb.DescribeLoadBalancersIn
 		desc := fakeElb.LoadBalancers[*lb]
 		lbs = append(lbs, desc)
 	}
+	var nextMarker *string
+	if input.LoadBalancerNames == nil {
+		names := []string{}
+		for name := range fakeElb.LoadBalancers {
+			if name > aws.StringValue(input.Marker) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		if fakeElb.PageSize > 0 && len(names) > fakeElb.PageSize {
+			names = names[:fakeElb.PageSize]
+			nextMarker = aws.String(names[len(names)-1])
+		}
+		for _, name := range names {
+			lbs = append(lbs, fakeElb.LoadBalancers[name])
+		}
+	}
 
 	return &elb.DescribeLoadBalancersOutput{
 		LoadBalancerDescriptions: lbs,
+		NextMarker:               nextMarker,
 	}, nil
 }
 
-// AddTags is not implemented but is required for interface conformance
+// AddTags adds or updates the tags of the fake load balancers
 func (fakeElb *FakeELB) AddTags(input *elb.AddTagsInput) (*elb.AddTagsOutput, error) {
-	panic("Not implemented")
+	if fakeElb.Tags == nil {
+		fakeElb.Tags = make(map[string][]*elb.Tag)
+	}
+	for _, name := range input.LoadBalancerNames {
+		tags := []*elb.Tag{}
+		for _, tag := range fakeElb.Tags[aws.StringValue(name)] {
+			updated := false
+			for _, added := range input.Tags {
+				updated = updated || aws.StringValue(added.Key) == aws.StringValue(tag.Key)
+			}
+			if !updated {
+				tags = append(tags, tag)
+			}
+		}
+		fakeElb.Tags[aws.StringValue(name)] = append(tags, input.Tags...)
+	}
+	return &elb.AddTagsOutput{}, nil
+}
+
+// RemoveTags removes tags from the fake load balancers
+func (fakeElb *FakeELB) RemoveTags(input *elb.RemoveTagsInput) (*elb.RemoveTagsOutput, error) {
+	for _, name := range input.LoadBalancerNames {
+		tags := []*elb.Tag{}
+		for _, tag := range fakeElb.Tags[aws.StringValue(name)] {
+			removed := false
+			for _, key := range input.Tags {
+				removed = removed || aws.StringValue(key.Key) == aws.StringValue(tag.Key)
+			}
+			if !removed {
+				tags = append(tags, tag)
+			}
+		}
+		fakeElb.Tags[aws.StringValue(name)] = tags
+	}
+	return &elb.RemoveTagsOutput{}, nil
+}
+
+// DescribeTags returns the tags the fake load balancers were created with, or a
+// LoadBalancerNotFound error like LBU when one of them does not exist
+func (fakeElb *FakeELB) DescribeTags(input *elb.DescribeTagsInput) (*elb.DescribeTagsOutput, error) {
+	output := &elb.DescribeTagsOutput{}
+	for _, name := range input.LoadBalancerNames {
+		if _, found := fakeElb.LoadBalancers[aws.StringValue(name)]; !found {
+			return nil, awserr.New("LoadBalancerNotFound", fmt.Sprintf("There is no ACTIVE Load Balancer named '%s'", aws.StringValue(name)), nil)
+		}
+		output.TagDescriptions = append(output.TagDescriptions, &elb.TagDescription{
+			LoadBalancerName: name,
+			Tags:             fakeElb.Tags[aws.StringValue(name)],
+		})
+	}
+	return output, nil
 }
 
 // RegisterInstancesWithLoadBalancer is not implemented but is required for
@@ -548,10 +1013,47 @@ func (fakeElb *FakeELB) RegisterInstancesWithLoadBalancer(*elb.RegisterInstances
 	panic("Not implemented")
 }
 
-// DeregisterInstancesFromLoadBalancer is not implemented but is required for
-// interface conformance
-func (fakeElb *FakeELB) DeregisterInstancesFromLoadBalancer(*elb.DeregisterInstancesFromLoadBalancerInput) (*elb.DeregisterInstancesFromLoadBalancerOutput, error) {
-	panic("Not implemented")
+// DeregisterInstancesFromLoadBalancer removes the instances from the fake load balancer
+func (fakeElb *FakeELB) DeregisterInstancesFromLoadBalancer(input *elb.DeregisterInstancesFromLoadBalancerInput) (*elb.DeregisterInstancesFromLoadBalancerOutput, error) {
+	lb := fakeElb.LoadBalancers[aws.StringValue(input.LoadBalancerName)]
+	if lb == nil {
+		return nil, fmt.Errorf("LoadBalancer not found")
+	}
+	removed := make(map[string]bool)
+	for _, instance := range input.Instances {
+		removed[aws.StringValue(instance.InstanceId)] = true
+	}
+	instances := []*elb.Instance{}
+	for _, instance := range lb.Instances {
+		if !removed[aws.StringValue(instance.InstanceId)] {
+			instances = append(instances, instance)
+		}
+	}
+	lb.Instances = instances
+	return &elb.DeregisterInstancesFromLoadBalancerOutput{Instances: instances}, nil
+}
+
+// DescribeInstanceHealth returns the InstanceHealth state (Unknown by default) of the requested instances,
+// or for all the instances of the load balancer when none is requested
+func (fakeElb *FakeELB) DescribeInstanceHealth(input *elb.DescribeInstanceHealthInput) (*elb.DescribeInstanceHealthOutput, error) {
+	instances := input.Instances
+	if len(instances) == 0 {
+		if lb, found := fakeElb.LoadBalancers[aws.StringValue(input.LoadBalancerName)]; found {
+			instances = lb.Instances
+		}
+	}
+	states := []*elb.InstanceState{}
+	for _, instance := range instances {
+		state, found := fakeElb.InstanceHealth[aws.StringValue(instance.InstanceId)]
+		if !found {
+			state = "Unknown"
+		}
+		states = append(states, &elb.InstanceState{
+			InstanceId: instance.InstanceId,
+			State:      aws.String(state),
+		})
+	}
+	return &elb.DescribeInstanceHealthOutput{InstanceStates: states}, nil
 }
 
 // DetachLoadBalancerFromSubnets is not implemented but is required for
@@ -566,16 +1068,36 @@ func (fakeElb *FakeELB) AttachLoadBalancerToSubnets(*elb.AttachLoadBalancerToSub
 	panic("Not implemented")
 }
 
-// CreateLoadBalancerListeners is not implemented but is required for interface
-// conformance
-func (fakeElb *FakeELB) CreateLoadBalancerListeners(*elb.CreateLoadBalancerListenersInput) (*elb.CreateLoadBalancerListenersOutput, error) {
-	panic("Not implemented")
+// CreateLoadBalancerListeners adds listeners to the fake load balancer
+func (fakeElb *FakeELB) CreateLoadBalancerListeners(input *elb.CreateLoadBalancerListenersInput) (*elb.CreateLoadBalancerListenersOutput, error) {
+	lb := fakeElb.LoadBalancers[aws.StringValue(input.LoadBalancerName)]
+	if lb == nil {
+		return nil, fmt.Errorf("LoadBalancer not found")
+	}
+	for _, listener := range input.Listeners {
+		lb.ListenerDescriptions = append(lb.ListenerDescriptions, &elb.ListenerDescription{Listener: listener})
+	}
+	return &elb.CreateLoadBalancerListenersOutput{}, nil
 }
 
-// DeleteLoadBalancerListeners is not implemented but is required for interface
-// conformance
-func (fakeElb *FakeELB) DeleteLoadBalancerListeners(*elb.DeleteLoadBalancerListenersInput) (*elb.DeleteLoadBalancerListenersOutput, error) {
-	panic("Not implemented")
+// DeleteLoadBalancerListeners removes the listeners of ports from the fake load balancer
+func (fakeElb *FakeELB) DeleteLoadBalancerListeners(input *elb.DeleteLoadBalancerListenersInput) (*elb.DeleteLoadBalancerListenersOutput, error) {
+	lb := fakeElb.LoadBalancers[aws.StringValue(input.LoadBalancerName)]
+	if lb == nil {
+		return nil, fmt.Errorf("LoadBalancer not found")
+	}
+	removed := make(map[int64]bool)
+	for _, port := range input.LoadBalancerPorts {
+		removed[aws.Int64Value(port)] = true
+	}
+	kept := []*elb.ListenerDescription{}
+	for _, description := range lb.ListenerDescriptions {
+		if !removed[aws.Int64Value(description.Listener.LoadBalancerPort)] {
+			kept = append(kept, description)
+		}
+	}
+	lb.ListenerDescriptions = kept
+	return &elb.DeleteLoadBalancerListenersOutput{}, nil
 }
 
 // ApplySecurityGroupsToLoadBalancer is not implemented but is required for
@@ -601,33 +1123,124 @@ func (fakeElb *FakeELB) ConfigureHealthCheck(input *elb.ConfigureHealthCheckInpu
 
 }
 
-// CreateLoadBalancerPolicy is not implemented but is required for interface
-// conformance
-func (fakeElb *FakeELB) CreateLoadBalancerPolicy(*elb.CreateLoadBalancerPolicyInput) (*elb.CreateLoadBalancerPolicyOutput, error) {
-	panic("Not implemented")
+// CreateLoadBalancerPolicy records the policy of the fake load balancer
+func (fakeElb *FakeELB) CreateLoadBalancerPolicy(input *elb.CreateLoadBalancerPolicyInput) (*elb.CreateLoadBalancerPolicyOutput, error) {
+	for _, attribute := range input.PolicyAttributes {
+		for _, rejected := range fakeElb.RejectedPolicyAttributes {
+			if aws.StringValue(attribute.AttributeName) == rejected {
+				return nil, awserr.New("InvalidConfigurationRequest", fmt.Sprintf("unknown attribute %s", rejected), nil)
+			}
+		}
+	}
+	if fakeElb.Policies == nil {
+		fakeElb.Policies = make(map[string]map[string]*elb.CreateLoadBalancerPolicyInput)
+	}
+	lbName := aws.StringValue(input.LoadBalancerName)
+	if fakeElb.Policies[lbName] == nil {
+		fakeElb.Policies[lbName] = make(map[string]*elb.CreateLoadBalancerPolicyInput)
+	}
+	if _, found := fakeElb.Policies[lbName][aws.StringValue(input.PolicyName)]; found {
+		return nil, awserr.New(elb.ErrCodeDuplicatePolicyNameException, "duplicate policy name", nil)
+	}
+	fakeElb.Policies[lbName][aws.StringValue(input.PolicyName)] = input
+	return &elb.CreateLoadBalancerPolicyOutput{}, nil
 }
 
-// SetLoadBalancerPoliciesForBackendServer is not implemented but is required
-// for interface conformance
-func (fakeElb *FakeELB) SetLoadBalancerPoliciesForBackendServer(*elb.SetLoadBalancerPoliciesForBackendServerInput) (*elb.SetLoadBalancerPoliciesForBackendServerOutput, error) {
-	panic("Not implemented")
+// CreateLBCookieStickinessPolicy records the policy of the fake load balancer, as a policy
+// of type LBCookieStickinessPolicyType
+func (fakeElb *FakeELB) CreateLBCookieStickinessPolicy(input *elb.CreateLBCookieStickinessPolicyInput) (*elb.CreateLBCookieStickinessPolicyOutput, error) {
+	attributes := []*elb.PolicyAttribute{}
+	if input.CookieExpirationPeriod != nil {
+		attributes = append(attributes, &elb.PolicyAttribute{
+			AttributeName:  aws.String("CookieExpirationPeriod"),
+			AttributeValue: aws.String(fmt.Sprint(aws.Int64Value(input.CookieExpirationPeriod))),
+		})
+	}
+	_, err := fakeElb.CreateLoadBalancerPolicy(&elb.CreateLoadBalancerPolicyInput{
+		LoadBalancerName: input.LoadBalancerName,
+		PolicyName:       input.PolicyName,
+		PolicyTypeName:   aws.String("LBCookieStickinessPolicyType"),
+		PolicyAttributes: attributes,
+	})
+	return &elb.CreateLBCookieStickinessPolicyOutput{}, err
 }
 
-// SetLoadBalancerPoliciesOfListener is not implemented but is required for
-// interface conformance
+// CreateAppCookieStickinessPolicy records the policy of the fake load balancer, as a policy
+// of type AppCookieStickinessPolicyType
+func (fakeElb *FakeELB) CreateAppCookieStickinessPolicy(input *elb.CreateAppCookieStickinessPolicyInput) (*elb.CreateAppCookieStickinessPolicyOutput, error) {
+	_, err := fakeElb.CreateLoadBalancerPolicy(&elb.CreateLoadBalancerPolicyInput{
+		LoadBalancerName: input.LoadBalancerName,
+		PolicyName:       input.PolicyName,
+		PolicyTypeName:   aws.String("AppCookieStickinessPolicyType"),
+		PolicyAttributes: []*elb.PolicyAttribute{{AttributeName: aws.String("CookieName"), AttributeValue: input.CookieName}},
+	})
+	return &elb.CreateAppCookieStickinessPolicyOutput{}, err
+}
+
+// SetLoadBalancerPoliciesForBackendServer sets the policies of a backend of the fake load
+// balancer
+func (fakeElb *FakeELB) SetLoadBalancerPoliciesForBackendServer(input *elb.SetLoadBalancerPoliciesForBackendServerInput) (*elb.SetLoadBalancerPoliciesForBackendServerOutput, error) {
+	lb := fakeElb.LoadBalancers[aws.StringValue(input.LoadBalancerName)]
+	if lb == nil {
+		return nil, fmt.Errorf("LoadBalancer not found")
+	}
+	for _, backend := range lb.BackendServerDescriptions {
+		if aws.Int64Value(backend.InstancePort) == aws.Int64Value(input.InstancePort) {
+			backend.PolicyNames = input.PolicyNames
+			return &elb.SetLoadBalancerPoliciesForBackendServerOutput{}, nil
+		}
+	}
+	lb.BackendServerDescriptions = append(lb.BackendServerDescriptions, &elb.BackendServerDescription{
+		InstancePort: input.InstancePort,
+		PolicyNames:  input.PolicyNames,
+	})
+	return &elb.SetLoadBalancerPoliciesForBackendServerOutput{}, nil
+}
+
+// SetLoadBalancerPoliciesOfListener sets the policies of a listener of the fake load balancer
 func (fakeElb *FakeELB) SetLoadBalancerPoliciesOfListener(input *elb.SetLoadBalancerPoliciesOfListenerInput) (*elb.SetLoadBalancerPoliciesOfListenerOutput, error) {
-	panic("Not implemented")
+	lb := fakeElb.LoadBalancers[aws.StringValue(input.LoadBalancerName)]
+	if lb == nil {
+		return nil, fmt.Errorf("LoadBalancer not found")
+	}
+	for _, listener := range lb.ListenerDescriptions {
+		if aws.Int64Value(listener.Listener.LoadBalancerPort) == aws.Int64Value(input.LoadBalancerPort) {
+			listener.PolicyNames = input.PolicyNames
+			return &elb.SetLoadBalancerPoliciesOfListenerOutput{}, nil
+		}
+	}
+	return nil, awserr.New(elb.ErrCodeListenerNotFoundException, "listener not found", nil)
 }
 
-// DescribeLoadBalancerPolicies is not implemented but is required for
-// interface conformance
+// DeleteLoadBalancerPolicy deletes a policy of the fake load balancer
+func (fakeElb *FakeELB) DeleteLoadBalancerPolicy(input *elb.DeleteLoadBalancerPolicyInput) (*elb.DeleteLoadBalancerPolicyOutput, error) {
+	delete(fakeElb.Policies[aws.StringValue(input.LoadBalancerName)], aws.StringValue(input.PolicyName))
+	return &elb.DeleteLoadBalancerPolicyOutput{}, nil
+}
+
+// DescribeLoadBalancerPolicies returns the policies created on the fake load balancer
 func (fakeElb *FakeELB) DescribeLoadBalancerPolicies(input *elb.DescribeLoadBalancerPoliciesInput) (*elb.DescribeLoadBalancerPoliciesOutput, error) {
-	panic("Not implemented")
+	output := &elb.DescribeLoadBalancerPoliciesOutput{}
+	policies := fakeElb.Policies[aws.StringValue(input.LoadBalancerName)]
+	for _, name := range input.PolicyNames {
+		policy, found := policies[aws.StringValue(name)]
+		if !found {
+			return nil, awserr.New(elb.ErrCodePolicyNotFoundException, "policy not found", nil)
+		}
+		output.PolicyDescriptions = append(output.PolicyDescriptions, &elb.PolicyDescription{
+			PolicyName:     policy.PolicyName,
+			PolicyTypeName: policy.PolicyTypeName,
+		})
+	}
+	return output, nil
 }
 
-// DescribeLoadBalancerAttributes is not implemented but is required for
-// interface conformance
+// DescribeLoadBalancerAttributes returns the attributes of the fake load balancer, the
+// defaults of LBU updated by ModifyLoadBalancerAttributes
 func (fakeElb *FakeELB) DescribeLoadBalancerAttributes(input *elb.DescribeLoadBalancerAttributesInput) (*elb.DescribeLoadBalancerAttributesOutput, error) {
+	if attributes, found := fakeElb.Attributes[aws.StringValue(input.LoadBalancerName)]; found {
+		return &elb.DescribeLoadBalancerAttributesOutput{LoadBalancerAttributes: attributes}, nil
+	}
 	return &elb.DescribeLoadBalancerAttributesOutput{
 		LoadBalancerAttributes: &elb.LoadBalancerAttributes{
 			ConnectionDraining: &elb.ConnectionDraining{Enabled: aws.Bool(false)},
@@ -636,10 +1249,37 @@ func (fakeElb *FakeELB) DescribeLoadBalancerAttributes(input *elb.DescribeLoadBa
 	}, nil
 }
 
-// ModifyLoadBalancerAttributes is not implemented but is required for
-// interface conformance
-func (fakeElb *FakeELB) ModifyLoadBalancerAttributes(*elb.ModifyLoadBalancerAttributesInput) (*elb.ModifyLoadBalancerAttributesOutput, error) {
-	panic("Not implemented")
+// ModifyLoadBalancerAttributes records the attributes set on the fake load balancer
+func (fakeElb *FakeELB) ModifyLoadBalancerAttributes(input *elb.ModifyLoadBalancerAttributesInput) (*elb.ModifyLoadBalancerAttributesOutput, error) {
+	if fakeElb.ModifiedAttributes == nil {
+		fakeElb.ModifiedAttributes = make(map[string]*elb.LoadBalancerAttributes)
+	}
+	fakeElb.ModifiedAttributes[aws.StringValue(input.LoadBalancerName)] = input.LoadBalancerAttributes
+	if fakeElb.Attributes == nil {
+		fakeElb.Attributes = make(map[string]*elb.LoadBalancerAttributes)
+	}
+	current, err := fakeElb.DescribeLoadBalancerAttributes(&elb.DescribeLoadBalancerAttributesInput{LoadBalancerName: input.LoadBalancerName})
+	if err != nil {
+		return nil, err
+	}
+	attributes := *current.LoadBalancerAttributes
+	if input.LoadBalancerAttributes.AccessLog != nil {
+		attributes.AccessLog = input.LoadBalancerAttributes.AccessLog
+	}
+	if input.LoadBalancerAttributes.ConnectionDraining != nil {
+		attributes.ConnectionDraining = input.LoadBalancerAttributes.ConnectionDraining
+	}
+	if input.LoadBalancerAttributes.ConnectionSettings != nil {
+		attributes.ConnectionSettings = input.LoadBalancerAttributes.ConnectionSettings
+	}
+	if input.LoadBalancerAttributes.CrossZoneLoadBalancing != nil {
+		attributes.CrossZoneLoadBalancing = input.LoadBalancerAttributes.CrossZoneLoadBalancing
+	}
+	fakeElb.Attributes[aws.StringValue(input.LoadBalancerName)] = &attributes
+	return &elb.ModifyLoadBalancerAttributesOutput{
+		LoadBalancerName:       input.LoadBalancerName,
+		LoadBalancerAttributes: input.LoadBalancerAttributes,
+	}, nil
 }
 
 // expectDescribeLoadBalancers is not implemented but is required for interface
@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/component-base/featuregate"
+)
+
+// ********************* CCM Feature Gates *********************
+
+const (
+	// SecurityGroupRuleCompaction writes the ingress rules of the load balancer security
+	// groups regrouped by protocol and ports, one rule listing several IP ranges. When
+	// disabled, a rule is written per IP range.
+	SecurityGroupRuleCompaction featuregate.Feature = "OSCSecurityGroupRuleCompaction"
+
+	// ProviderIDMigration recreates the drained nodes having a legacy provider ID with the
+	// osc:// scheme, every ProviderIDMigrationIntervalSeconds of the cloud config
+	ProviderIDMigration featuregate.Feature = "OSCProviderIDMigration"
+
+	// AppProtocolBackendProtocol derives the backend protocol of the service ports without
+	// backend protocol annotation from their appProtocol. Enabling it changes the listeners of
+	// the existing load balancers whose ports set an appProtocol.
+	AppProtocolBackendProtocol featuregate.Feature = "OSCAppProtocolBackendProtocol"
+)
+
+// defaultFeatureGates are the features of the cloud provider, set with the --feature-gates
+// flag of the CCM along with the features of Kubernetes
+var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	SecurityGroupRuleCompaction: {Default: true, PreRelease: featuregate.Beta},
+	ProviderIDMigration:         {Default: false, PreRelease: featuregate.Alpha},
+	AppProtocolBackendProtocol:  {Default: false, PreRelease: featuregate.Alpha},
+}
+
+func init() {
+	utilruntime.Must(AddFeatureGates(utilfeature.DefaultMutableFeatureGate))
+}
+
+// AddFeatureGates registers the features of the cloud provider in the feature gate, which
+// is the one of the --feature-gates flag of the CCM options by default
+func AddFeatureGates(featureGate featuregate.MutableFeatureGate) error {
+	return featureGate.Add(defaultFeatureGates)
+}
+
+// featureEnabled returns whether the feature of the cloud provider is enabled
+func featureEnabled(feature featuregate.Feature) bool {
+	return utilfeature.DefaultFeatureGate.Enabled(feature)
+}
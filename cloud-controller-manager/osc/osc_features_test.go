@@ -0,0 +1,58 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/component-base/featuregate"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
+)
+
+func TestFeatureGates(t *testing.T) {
+	assert.True(t, featureEnabled(SecurityGroupRuleCompaction))
+	assert.False(t, featureEnabled(ProviderIDMigration))
+	assert.False(t, featureEnabled(AppProtocolBackendProtocol))
+
+	// The features are set along with the features of Kubernetes
+	featureGate := featuregate.NewFeatureGate()
+	assert.NoError(t, AddFeatureGates(featureGate))
+	assert.NoError(t, featureGate.Set("OSCProviderIDMigration=true,OSCSecurityGroupRuleCompaction=false"))
+	assert.True(t, featureGate.Enabled(ProviderIDMigration))
+	assert.False(t, featureGate.Enabled(SecurityGroupRuleCompaction))
+	assert.Error(t, featureGate.Set("OSCUnknown=true"))
+}
+
+func TestSetSecurityGroupIngressWithoutCompaction(t *testing.T) {
+	defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, SecurityGroupRuleCompaction, false)()
+	service, group := newTestSecurityGroupService(t, "shared")
+
+	// A rule is written per port and IP range
+	permissions := NewIPRulesSet()
+	for _, port := range []int32{80, 443} {
+		for _, ipRange := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"} {
+			permissions.Insert(tcpIngressRule(port, ipRange))
+		}
+	}
+	changed, err := service.setSecurityGroupIngress("sg-1234", permissions)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, group.GetInboundRules(), 6)
+	assert.Equal(t, permissions, NewIPRulesSet(group.GetInboundRules()...).Ungroup())
+}
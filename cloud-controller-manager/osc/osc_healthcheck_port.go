@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/elb"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ********************* CCM Health Check Port *********************
+
+// findHealthCheckServicePort returns the service port named by the
+// ServiceAnnotationLoadBalancerHealthCheckPortName annotation: the port of that name, or the
+// port whose named targetPort is that name
+func findHealthCheckServicePort(service *v1.Service, name string) (*v1.ServicePort, error) {
+	for i := range service.Spec.Ports {
+		if service.Spec.Ports[i].Name == name {
+			return &service.Spec.Ports[i], nil
+		}
+	}
+	for i := range service.Spec.Ports {
+		targetPort := service.Spec.Ports[i].TargetPort
+		if targetPort.Type == intstr.String && targetPort.StrVal == name {
+			return &service.Spec.Ports[i], nil
+		}
+	}
+	return nil, fmt.Errorf("error parsing service annotation %s=%s: service %s/%s has no port named %q",
+		ServiceAnnotationLoadBalancerHealthCheckPortName, name, service.Namespace, service.Name, name)
+}
+
+// healthCheckPort returns the instance port checked by the TCP health check of the load
+// balancer, with the backend protocol of its service port. It is the NodePort of the port
+// named by the ServiceAnnotationLoadBalancerHealthCheckPortName annotation, resolved at each
+// reconciliation, or else the port of the first listener. It returns 0 when only SCTP
+// listeners remain, whose node ports don't answer TCP health checks.
+func healthCheckPort(service *v1.Service, annotations map[string]string, listeners []*elb.Listener,
+	instancePorts backendPorts) (int32, string, error) {
+	if name, found := annotations[ServiceAnnotationLoadBalancerHealthCheckPortName]; found {
+		port, err := findHealthCheckServicePort(service, name)
+		if err != nil {
+			return 0, "", err
+		}
+		if port.Protocol == v1.ProtocolSCTP {
+			return 0, "", fmt.Errorf("service port %q of service %s/%s is SCTP and can't be health checked",
+				name, service.Namespace, service.Name)
+		}
+		instancePort := instancePorts.instancePort(*port)
+		if instancePort == 0 {
+			return 0, "", fmt.Errorf("service port %q of service %s/%s has no NodePort to health check",
+				name, service.Namespace, service.Name)
+		}
+		// The backend protocols were parsed by buildListener
+		protocol, _ := getBackendProtocol(*port, annotations)
+		return int32(instancePort), protocol, nil
+	}
+
+	for _, listener := range listeners {
+		// SCTP node ports don't answer TCP health checks
+		if listener.InstancePort == nil || isSCTPListener(listener.Protocol) {
+			continue
+		}
+		for _, port := range service.Spec.Ports {
+			if instancePorts.instancePort(port) == *listener.InstancePort {
+				protocol, _ := getBackendProtocol(port, annotations)
+				return int32(*listener.InstancePort), protocol, nil
+			}
+		}
+		return int32(*listener.InstancePort), "", nil
+	}
+	return 0, "", nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestHealthCheckPort(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: v1.ServiceSpec{Ports: []v1.ServicePort{
+			{Name: "metrics", Port: 9100, TargetPort: intstr.FromString("metrics"), Protocol: v1.ProtocolTCP, NodePort: 30100},
+			{Name: "https", Port: 443, TargetPort: intstr.FromString("web"), Protocol: v1.ProtocolTCP, NodePort: 30443},
+			{Name: "sctp", Port: 5000, Protocol: v1.ProtocolSCTP, NodePort: 30500},
+			{Name: "nonode", Port: 8080, Protocol: v1.ProtocolTCP},
+		}},
+	}
+	listeners := []*elb.Listener{
+		{InstancePort: aws.Int64(30100), Protocol: aws.String("TCP")},
+		{InstancePort: aws.Int64(30443), Protocol: aws.String("TCP")},
+	}
+
+	// The first listener by default
+	port, protocol, err := healthCheckPort(service, map[string]string{}, listeners, backendPorts{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(30100), port)
+	assert.Equal(t, "", protocol)
+
+	annotations := map[string]string{
+		ServiceAnnotationLoadBalancerHealthCheckPortName: "https",
+		ServiceAnnotationLoadBalancerBEProtocolMap:       "https=https",
+	}
+	port, protocol, err = healthCheckPort(service, annotations, listeners, backendPorts{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(30443), port)
+	assert.Equal(t, "https", protocol)
+
+	// Named target ports and mapped backend ports
+	annotations = map[string]string{ServiceAnnotationLoadBalancerHealthCheckPortName: "web"}
+	port, _, err = healthCheckPort(service, annotations, listeners, backendPorts{"https": 443})
+	require.NoError(t, err)
+	assert.Equal(t, int32(443), port)
+
+	for _, name := range []string{"missing", "sctp", "nonode"} {
+		annotations[ServiceAnnotationLoadBalancerHealthCheckPortName] = name
+		_, _, err = healthCheckPort(service, annotations, listeners, backendPorts{})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestEnsureLoadBalancerHealthCheckPortName(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			UID:         "anuid",
+			Annotations: map[string]string{ServiceAnnotationLoadBalancerHealthCheckPortName: "https"},
+		},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports: []v1.ServicePort{
+				{Name: "metrics", Port: 9100, TargetPort: intstr.FromString("metrics"), Protocol: v1.ProtocolTCP, NodePort: 30100},
+				{Name: "https", Port: 443, TargetPort: intstr.FromString("web"), Protocol: v1.ProtocolTCP, NodePort: 30443},
+			},
+		},
+	}
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	require.NoError(t, err)
+	loadBalancer := awsServices.elb.(*FakeELB).LoadBalancers[c.GetLoadBalancerName(context.TODO(), TestClusterName, service)]
+	require.NotNil(t, loadBalancer)
+	assert.Equal(t, "TCP:30443", aws.StringValue(loadBalancer.HealthCheck.Target))
+
+	// The NodePort is resolved at each reconciliation
+	service.Spec.Ports[1].NodePort = 31443
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	require.NoError(t, err)
+	assert.Equal(t, "TCP:31443", aws.StringValue(loadBalancer.HealthCheck.Target))
+}
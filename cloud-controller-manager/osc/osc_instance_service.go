@@ -0,0 +1,231 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sort"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Instance Service *********************
+
+// InstanceService looks up the VMs of the cluster
+type InstanceService interface {
+	getInstanceByID(instanceID string) (*osc.Vm, error)
+	getInstancesByIDs(instanceIDs *[]string) (map[string]*osc.Vm, error)
+	getInstancesByNodeNames(nodeNames []string, states ...string) ([]*osc.Vm, error)
+	describeInstances(filters *osc.FiltersVm) ([]*osc.Vm, error)
+	findInstanceByNodeName(nodeName types.NodeName) (*osc.Vm, error)
+	getInstancesByTags(netID string, tags map[string]string) (map[InstanceID]*osc.Vm, error)
+}
+
+// instanceService implements InstanceService with the oAPI
+type instanceService struct {
+	compute   Compute
+	tagging   *resourceTagging
+	nodeNames *nodeNameStrategy
+}
+
+func newInstanceService(compute Compute, tagging *resourceTagging, nodeNames *nodeNameStrategy) *instanceService {
+	return &instanceService{
+		compute:   compute,
+		tagging:   tagging,
+		nodeNames: nodeNames,
+	}
+}
+
+// Returns the instance with the specified ID
+func (s *instanceService) getInstanceByID(instanceID string) (*osc.Vm, error) {
+	klog.V(5).Infof("getInstanceByID(%v)", instanceID)
+	instances, err := s.getInstancesByIDs(&[]string{instanceID})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instances) == 0 {
+		return nil, cloudprovider.InstanceNotFound
+	}
+	if len(instances) > 1 {
+		return nil, fmt.Errorf("multiple instances found for instance: %s", instanceID)
+	}
+
+	return instances[instanceID], nil
+}
+
+func (s *instanceService) getInstancesByIDs(instanceIDs *[]string) (map[string]*osc.Vm, error) {
+	klog.V(5).Infof("getInstancesByIDs(%v)", instanceIDs)
+
+	instancesByID := make(map[string]*osc.Vm)
+	if instanceIDs == nil || len(*instanceIDs) == 0 {
+		return instancesByID, nil
+	}
+
+	request := &osc.ReadVmsRequest{
+		Filters: &osc.FiltersVm{
+			VmIds: instanceIDs,
+		},
+	}
+
+	instances, err := s.compute.ReadVms(request)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instance := range instances {
+		instanceRef := instance
+		instanceID := instance.GetVmId()
+		if instanceID == "" {
+			continue
+		}
+
+		instancesByID[instanceID] = &instanceRef
+	}
+
+	return instancesByID, nil
+}
+
+func (s *instanceService) getInstancesByNodeNames(nodeNames []string, states ...string) ([]*osc.Vm, error) {
+	klog.V(5).Infof("getInstancesByNodeNames(%v, %v)", nodeNames, states)
+
+	names := nodeNames
+	oscInstances := []*osc.Vm{}
+
+	filters := osc.FiltersVm{}
+
+	instances, err := s.describeInstances(&filters)
+	if err != nil {
+		klog.V(2).Infof("Failed to describe instances %v", nodeNames)
+		return nil, err
+	}
+
+	for _, instance := range instances {
+		if Contains(names, string(s.nodeNames.nodeName(instance))) &&
+			(len(states) == 0 || Contains(states, instance.GetState())) {
+			oscInstances = append(oscInstances, instance)
+		}
+	}
+
+	if len(oscInstances) == 0 {
+		klog.V(3).Infof("Failed to find any instances %v", nodeNames)
+		return nil, nil
+	}
+	return oscInstances, nil
+}
+
+// TODO: Move to instanceCache
+func (s *instanceService) describeInstances(filters *osc.FiltersVm) ([]*osc.Vm, error) {
+	klog.V(5).Infof("describeInstances(%v)", filters)
+
+	request := &osc.ReadVmsRequest{
+		Filters: filters,
+	}
+
+	response, err := s.compute.ReadVms(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*osc.Vm
+	for _, instance := range response {
+		if s.tagging.hasClusterTag(instance.Tags) {
+			instanceRef := instance
+			matches = append(matches, &instanceRef)
+		}
+	}
+	return matches, nil
+}
+
+// Returns the instance with the specified node name
+// Returns nil if it does not exist
+func (s *instanceService) findInstanceByNodeName(nodeName types.NodeName) (*osc.Vm, error) {
+	klog.V(5).Infof("findInstanceByNodeName(%v)", nodeName)
+
+	filters := s.nodeNames.filters(nodeName)
+	filters.TagKeys = s.tagging.clusterTagKeysFilter()
+
+	described, err := s.describeInstances(&filters)
+
+	if err != nil {
+		return nil, err
+	}
+	instances := []*osc.Vm{}
+	for _, instance := range described {
+		if s.nodeNames.matches(instance, nodeName) {
+			instances = append(instances, instance)
+		}
+	}
+
+	if len(instances) == 0 {
+		return nil, nil
+	}
+	if len(instances) > 1 {
+		return nil, fmt.Errorf("multiple instances found for name: %s", nodeName)
+	}
+
+	if *instances[0].State == "terminated" {
+		// We only want alive instances but oAPI does not have a filter for that
+		return nil, nil
+	}
+
+	return instances[0], nil
+}
+
+// Returns the running instances of the net having all the tags, whether they are nodes of
+// the cluster or not
+func (s *instanceService) getInstancesByTags(netID string, tags map[string]string) (map[InstanceID]*osc.Vm, error) {
+	klog.V(5).Infof("getInstancesByTags(%v, %v)", netID, tags)
+	tagFilters := make([]string, 0, len(tags))
+	for key, value := range tags {
+		tagFilters = append(tagFilters, key+"="+value)
+	}
+	sort.Strings(tagFilters)
+
+	response, err := s.compute.ReadVms(&osc.ReadVmsRequest{Filters: &osc.FiltersVm{Tags: &tagFilters}})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the instances tagged %v: %q", tagFilters, err)
+	}
+
+	// The values of a filter are alternatives, the instances must have all the tags, and the
+	// net and the state of the instances can't be filtered
+	instances := make(map[InstanceID]*osc.Vm)
+	for i := range response {
+		instance := &response[i]
+		if (netID != "" && instance.GetNetId() != netID) || instance.GetState() != "running" {
+			continue
+		}
+		vmTags := make(map[string]string)
+		for _, tag := range instance.GetTags() {
+			vmTags[tag.GetKey()] = tag.GetValue()
+		}
+		matches := true
+		for key, value := range tags {
+			if tagValue, found := vmTags[key]; !found || tagValue != value {
+				matches = false
+			}
+		}
+		if matches {
+			instances[InstanceID(instance.GetVmId())] = instance
+		}
+	}
+	return instances, nil
+}
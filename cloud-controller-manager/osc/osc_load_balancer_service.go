@@ -0,0 +1,168 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elb"
+
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Service *********************
+
+// LoadBalancerService reads and tags the load balancers
+type LoadBalancerService interface {
+	describeLoadBalancer(name string) (*elb.LoadBalancerDescription, error)
+	addLoadBalancerTags(loadBalancerName string, requested map[string]string) error
+	removeLoadBalancerTags(loadBalancerName string, keys []string) error
+	describeLoadBalancerTags(loadBalancerName string) (map[string]string, error)
+	describeLoadBalancerInstancesHealth(loadBalancerName string) (map[string]string, error)
+	describeClusterLoadBalancers(tagging *resourceTagging) ([]*elb.LoadBalancerDescription, error)
+	primeLoadBalancers(loadBalancers []*elb.LoadBalancerDescription, ttl time.Duration)
+}
+
+// loadBalancerService implements LoadBalancerService with the LBU API
+type loadBalancerService struct {
+	loadBalancer LoadBalancer
+
+	// Load balancers read when the caches were primed
+	primed primedLoadBalancers
+}
+
+func newLoadBalancerService(loadBalancer LoadBalancer) *loadBalancerService {
+	return &loadBalancerService{
+		loadBalancer: loadBalancer,
+	}
+}
+
+// Gets the current load balancer state
+func (s *loadBalancerService) describeLoadBalancer(name string) (*elb.LoadBalancerDescription, error) {
+	klog.V(5).Infof("describeLoadBalancer(%v)", name)
+	if loadBalancer := s.primed.take(name); loadBalancer != nil {
+		klog.V(5).Infof("Using the primed load balancer %s", name)
+		return loadBalancer, nil
+	}
+	request := &elb.DescribeLoadBalancersInput{}
+	request.LoadBalancerNames = []*string{&name}
+
+	response, err := s.loadBalancer.DescribeLoadBalancers(request)
+	if err != nil {
+		if awsError, ok := err.(awserr.Error); ok {
+			if awsError.Code() == "LoadBalancerNotFound" {
+				return nil, nil
+			}
+		}
+		return nil, err
+	}
+
+	var ret *elb.LoadBalancerDescription
+	for _, loadBalancer := range response.LoadBalancerDescriptions {
+		if ret != nil {
+			klog.Errorf("Found multiple load balancers with name: %s", name)
+		}
+		ret = loadBalancer
+	}
+	return ret, nil
+}
+
+func (s *loadBalancerService) addLoadBalancerTags(loadBalancerName string, requested map[string]string) error {
+	klog.V(5).Infof("addLoadBalancerTags(%v,%v)", loadBalancerName, requested)
+	var tags []*elb.Tag
+	for k, v := range requested {
+		tag := &elb.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		}
+		tags = append(tags, tag)
+	}
+
+	request := &elb.AddTagsInput{}
+	request.LoadBalancerNames = []*string{&loadBalancerName}
+	request.Tags = tags
+
+	_, err := s.loadBalancer.AddTags(request)
+	if err != nil {
+		return fmt.Errorf("error adding tags to load balancer: %v", err)
+	}
+	return nil
+}
+
+// removeLoadBalancerTags removes the tags of the load balancer with the given keys
+func (s *loadBalancerService) removeLoadBalancerTags(loadBalancerName string, keys []string) error {
+	klog.V(5).Infof("removeLoadBalancerTags(%v,%v)", loadBalancerName, keys)
+	request := &elb.RemoveTagsInput{}
+	request.LoadBalancerNames = []*string{&loadBalancerName}
+	for _, key := range keys {
+		request.Tags = append(request.Tags, &elb.TagKeyOnly{Key: aws.String(key)})
+	}
+
+	_, err := s.loadBalancer.RemoveTags(request)
+	if err != nil {
+		return fmt.Errorf("error removing tags from load balancer: %v", err)
+	}
+	return nil
+}
+
+// describeLoadBalancerTags returns the tags of the load balancer, none when it does not exist
+func (s *loadBalancerService) describeLoadBalancerTags(loadBalancerName string) (map[string]string, error) {
+	klog.V(5).Infof("describeLoadBalancerTags(%v)", loadBalancerName)
+	response, err := s.loadBalancer.DescribeTags(&elb.DescribeTagsInput{
+		LoadBalancerNames: []*string{aws.String(loadBalancerName)},
+	})
+	if err != nil {
+		if awsError, ok := err.(awserr.Error); ok && awsError.Code() == "LoadBalancerNotFound" {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("error describing tags of load balancer %s: %q", loadBalancerName, err)
+	}
+
+	tags := make(map[string]string)
+	for _, description := range response.TagDescriptions {
+		for _, tag := range description.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+	return tags, nil
+}
+
+// describeLoadBalancerInstancesHealth returns the health state of the backends of
+// the load balancer, indexed by instance id
+func (s *loadBalancerService) describeLoadBalancerInstancesHealth(loadBalancerName string) (map[string]string, error) {
+	klog.V(5).Infof("describeLoadBalancerInstancesHealth(%v)", loadBalancerName)
+	response, err := s.loadBalancer.DescribeInstanceHealth(&elb.DescribeInstanceHealthInput{
+		LoadBalancerName: aws.String(loadBalancerName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing instance health of load balancer %s: %q", loadBalancerName, err)
+	}
+
+	health := make(map[string]string)
+	for _, state := range response.InstanceStates {
+		if state == nil || state.InstanceId == nil {
+			continue
+		}
+		if aws.StringValue(state.State) != "" {
+			health[aws.StringValue(state.InstanceId)] = aws.StringValue(state.State)
+		}
+	}
+	return health, nil
+}
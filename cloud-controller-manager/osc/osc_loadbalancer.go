@@ -21,7 +21,6 @@ package osc
 
 import (
 	"fmt"
-	"reflect"
 	"strconv"
 	"strings"
 
@@ -36,6 +35,11 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
+// errLoadBalancerPrivateIP is returned for the Services requesting the private IP of their
+// load balancer, which LBU does not support
+var errLoadBalancerPrivateIP = fmt.Errorf("the private IP of a load balancer cannot be specified for LBU, remove the %s annotation",
+	ServiceAnnotationLoadBalancerPrivateIP)
+
 const (
 	// ProxyProtocolPolicyName is the tag named used for the proxy protocol
 	// policy
@@ -49,6 +53,10 @@ const (
 	lbAttrAccessLogsS3Enabled           = "access_logs.s3.enabled"
 	lbAttrAccessLogsS3Bucket            = "access_logs.s3.bucket"
 	lbAttrAccessLogsS3Prefix            = "access_logs.s3.prefix"
+
+	// elbErrCodeMultipleSubnetsUnsupported is the error code of CreateLoadBalancer in the
+	// regions not supporting a load balancer in multiple subnets
+	elbErrCodeMultipleSubnetsUnsupported = "InvalidParameterValue"
 )
 
 var (
@@ -63,43 +71,207 @@ var (
 // pairs in the ServiceAnnotationLoadBalancerAdditionalTags annotation and returns
 // it as a map.
 func getLoadBalancerAdditionalTags(annotations map[string]string) map[string]string {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("getLoadBalancerAdditionalTags(%v)", annotations)
-	additionalTags := make(map[string]string)
 	if additionalTagsList, ok := annotations[ServiceAnnotationLoadBalancerAdditionalTags]; ok {
-		additionalTagsList = strings.TrimSpace(additionalTagsList)
-
-		// Break up list of "Key1=Val,Key2=Val2"
-		tagList := strings.Split(additionalTagsList, ",")
-
-		// Break up "Key=Val"
-		for _, tagSet := range tagList {
-			tag := strings.Split(strings.TrimSpace(tagSet), "=")
-
-			// Accept "Key=val" or "Key=" or just "Key"
-			if len(tag) >= 2 && len(tag[0]) != 0 {
-				// There is a key and a value, so save it
-				additionalTags[tag[0]] = tag[1]
-			} else if len(tag) == 1 && len(tag[0]) != 0 {
-				// Just "Key"
-				additionalTags[tag[0]] = ""
+		return parseKeyValueList(additionalTagsList)
+	}
+	return make(map[string]string)
+}
+
+// getProxyProtocol returns whether the ServiceAnnotationLoadBalancerProxyProtocol annotation
+// requests the proxy protocol on the backends
+func getProxyProtocol(annotations map[string]string) (bool, error) {
+	proxyProtocolAnnotation := annotations[ServiceAnnotationLoadBalancerProxyProtocol]
+	if proxyProtocolAnnotation == "" {
+		return false, nil
+	}
+	if proxyProtocolAnnotation != "*" {
+		return false, fmt.Errorf("annotation %q=%q detected, but the only value supported currently is '*'", ServiceAnnotationLoadBalancerProxyProtocol, proxyProtocolAnnotation)
+	}
+	return true, nil
+}
+
+// getLoadBalancerAttributes returns the load balancer attributes requested by the access log
+// and connection annotations
+func getLoadBalancerAttributes(annotations map[string]string) (*elb.LoadBalancerAttributes, error) {
+	// Some load balancer attributes are required, so defaults are set. These can be overridden by annotations.
+	loadBalancerAttributes := &elb.LoadBalancerAttributes{
+		ConnectionDraining: &elb.ConnectionDraining{Enabled: aws.Bool(false)},
+		ConnectionSettings: &elb.ConnectionSettings{IdleTimeout: aws.Int64(60)},
+	}
+
+	if annotations[ServiceAnnotationLoadBalancerAccessLogS3BucketName] != "" &&
+		annotations[ServiceAnnotationLoadBalancerAccessLogS3BucketPrefix] != "" {
+
+		loadBalancerAttributes.AccessLog = &elb.AccessLog{Enabled: aws.Bool(false)}
+
+		// Determine if access log enabled/disabled has been specified
+		accessLogEnabledAnnotation := annotations[ServiceAnnotationLoadBalancerAccessLogEnabled]
+		if accessLogEnabledAnnotation != "" {
+			accessLogEnabled, err := strconv.ParseBool(accessLogEnabledAnnotation)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing service annotation: %s=%s",
+					ServiceAnnotationLoadBalancerAccessLogEnabled,
+					accessLogEnabledAnnotation,
+				)
 			}
+			loadBalancerAttributes.AccessLog.Enabled = &accessLogEnabled
 		}
+		// Determine if an access log emit interval has been specified
+		accessLogEmitIntervalAnnotation := annotations[ServiceAnnotationLoadBalancerAccessLogEmitInterval]
+		if accessLogEmitIntervalAnnotation != "" {
+			accessLogEmitInterval, err := strconv.ParseInt(accessLogEmitIntervalAnnotation, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing service annotation: %s=%s",
+					ServiceAnnotationLoadBalancerAccessLogEmitInterval,
+					accessLogEmitIntervalAnnotation,
+				)
+			}
+			loadBalancerAttributes.AccessLog.EmitInterval = &accessLogEmitInterval
+		}
+
+		// Determine if access log s3 bucket name has been specified
+		accessLogS3BucketNameAnnotation := annotations[ServiceAnnotationLoadBalancerAccessLogS3BucketName]
+		if accessLogS3BucketNameAnnotation != "" {
+			loadBalancerAttributes.AccessLog.S3BucketName = &accessLogS3BucketNameAnnotation
+		}
+
+		// Determine if access log s3 bucket prefix has been specified
+		accessLogS3BucketPrefixAnnotation := annotations[ServiceAnnotationLoadBalancerAccessLogS3BucketPrefix]
+		if accessLogS3BucketPrefixAnnotation != "" {
+			loadBalancerAttributes.AccessLog.S3BucketPrefix = &accessLogS3BucketPrefixAnnotation
+		}
+		klog.V(5).Infof("Debug OSC:  loadBalancerAttributes.AccessLog : %v", loadBalancerAttributes.AccessLog)
 	}
-	return additionalTags
+
+	// Determine if connection draining enabled/disabled has been specified
+	connectionDrainingEnabledAnnotation := annotations[ServiceAnnotationLoadBalancerConnectionDrainingEnabled]
+	if connectionDrainingEnabledAnnotation != "" {
+		connectionDrainingEnabled, err := strconv.ParseBool(connectionDrainingEnabledAnnotation)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing service annotation: %s=%s",
+				ServiceAnnotationLoadBalancerConnectionDrainingEnabled,
+				connectionDrainingEnabledAnnotation,
+			)
+		}
+		loadBalancerAttributes.ConnectionDraining.Enabled = &connectionDrainingEnabled
+	}
+
+	// Determine if connection draining timeout has been specified
+	connectionDrainingTimeoutAnnotation := annotations[ServiceAnnotationLoadBalancerConnectionDrainingTimeout]
+	if connectionDrainingTimeoutAnnotation != "" {
+		connectionDrainingTimeout, err := strconv.ParseInt(connectionDrainingTimeoutAnnotation, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing service annotation: %s=%s",
+				ServiceAnnotationLoadBalancerConnectionDrainingTimeout,
+				connectionDrainingTimeoutAnnotation,
+			)
+		}
+		loadBalancerAttributes.ConnectionDraining.Timeout = &connectionDrainingTimeout
+	}
+
+	// Determine if cross-zone load balancing enabled/disabled has been specified
+	for _, annotation := range []string{ServiceAnnotationLoadBalancerCrossZoneEnabled, ServiceAnnotationLoadBalancerCrossZoneLoadBalancingEnabled} {
+		crossZoneEnabledAnnotation, found := annotations[annotation]
+		if !found {
+			continue
+		}
+		crossZoneEnabled, err := strconv.ParseBool(crossZoneEnabledAnnotation)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing service annotation: %s=%s",
+				annotation,
+				crossZoneEnabledAnnotation,
+			)
+		}
+		loadBalancerAttributes.CrossZoneLoadBalancing = &elb.CrossZoneLoadBalancing{Enabled: &crossZoneEnabled}
+		break
+	}
+
+	// Determine if connection idle timeout has been specified
+	connectionIdleTimeoutAnnotation := annotations[ServiceAnnotationLoadBalancerConnectionIdleTimeout]
+	if connectionIdleTimeoutAnnotation != "" {
+		connectionIdleTimeout, err := strconv.ParseInt(connectionIdleTimeoutAnnotation, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing service annotation: %s=%s",
+				ServiceAnnotationLoadBalancerConnectionIdleTimeout,
+				connectionIdleTimeoutAnnotation,
+			)
+		}
+		loadBalancerAttributes.ConnectionSettings.IdleTimeout = &connectionIdleTimeout
+	}
+	return loadBalancerAttributes, nil
+}
+
+// parseKeyValueList converts a comma separated list of key-value pairs
+// ("Key1=Val,Key2=Val2") into a map.
+func parseKeyValueList(list string) map[string]string {
+	values := make(map[string]string)
+	list = strings.TrimSpace(list)
+
+	// Break up list of "Key1=Val,Key2=Val2"
+	tagList := strings.Split(list, ",")
+
+	// Break up "Key=Val"
+	for _, tagSet := range tagList {
+		tag := strings.Split(strings.TrimSpace(tagSet), "=")
+
+		// Accept "Key=val" or "Key=" or just "Key"
+		if len(tag) >= 2 && len(tag[0]) != 0 {
+			// There is a key and a value, so save it
+			values[tag[0]] = tag[1]
+		} else if len(tag) == 1 && len(tag[0]) != 0 {
+			// Just "Key"
+			values[tag[0]] = ""
+		}
+	}
+	return values
+}
+
+// parseLoadBalancerSubnetIDs parses the value of the ServiceAnnotationLoadBalancerSubnetIDs
+// annotation. Every subnet must be one of the candidate subnets of the load balancer.
+// The subnets are sorted so that the first one is used when multiple subnets are not supported.
+func parseLoadBalancerSubnetIDs(value string, candidates []string) ([]string, error) {
+	subnetIDs := sets.NewString()
+	for _, subnetID := range strings.Split(value, ",") {
+		subnetID = strings.TrimSpace(subnetID)
+		if subnetID == "" {
+			continue
+		}
+		if !Contains(candidates, subnetID) {
+			return nil, fmt.Errorf("user subnet specified in the annotation %v=%v was not found (%v)",
+				ServiceAnnotationLoadBalancerSubnetIDs, subnetID, candidates)
+		}
+		subnetIDs.Insert(subnetID)
+	}
+	if subnetIDs.Len() == 0 {
+		return nil, fmt.Errorf("annotation %v does not list any subnet", ServiceAnnotationLoadBalancerSubnetIDs)
+	}
+	return subnetIDs.List(), nil
 }
 
-func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBalancerName string,
-	listeners []*elb.Listener, subnetIDs []string, securityGroupIDs []string, internalELB,
-	proxyProtocol bool, loadBalancerAttributes *elb.LoadBalancerAttributes,
+// securityGroupMatchesSelector checks that the security group carries all the tags of the selector.
+// An empty value in the selector only requires the tag key to be present.
+func securityGroupMatchesSelector(group osc.SecurityGroup, selector map[string]string) bool {
+	for key, value := range selector {
+		tagValue, found := findTag(group.Tags, key)
+		if !found || (value != "" && tagValue != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cloud) ensureLoadBalancer(service *v1.Service, loadBalancerName string,
+	listeners []*elb.Listener, subnetIDs []string, securityGroupIDs []string, internalELB bool,
+	proxyProtocolPolicy string, loadBalancerAttributes *elb.LoadBalancerAttributes,
 	annotations map[string]string) (*elb.LoadBalancerDescription, error) {
 
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("ensureLoadBalancer(%v,%v,%v,%v,%v,%v,%v,%v,%v,)",
-		namespacedName, loadBalancerName, listeners, subnetIDs, securityGroupIDs,
-		internalELB, proxyProtocol, loadBalancerAttributes, annotations)
+		service, loadBalancerName, listeners, subnetIDs, securityGroupIDs,
+		internalELB, proxyProtocolPolicy, loadBalancerAttributes, annotations)
+	namespacedName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
 
-	loadBalancer, err := c.describeLoadBalancer(loadBalancerName)
+	loadBalancer, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
 	if err != nil {
 		return nil, err
 	}
@@ -133,11 +305,18 @@ func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBala
 		}
 
 		// Get additional tags set by the user
-		tags := getLoadBalancerAdditionalTags(annotations)
+		tags := loadBalancerAdditionalTags(annotations)
+		if len(tags) > 0 {
+			tags[TagNameAdditionalTags] = additionalTagKeys(tags)
+		}
 
 		// Add default tags
+		tagging, err := c.serviceTagging(annotations)
+		if err != nil {
+			return nil, err
+		}
 		tags[TagNameKubernetesService] = namespacedName.String()
-		tags = c.tagging.buildTags(ResourceLifecycleOwned, tags)
+		tags = tagging.buildTags(ResourceLifecycleOwned, tags)
 
 		for k, v := range tags {
 			createRequest.Tags = append(createRequest.Tags, &elb.Tag{
@@ -148,20 +327,29 @@ func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBala
 		klog.Infof("Creating load balancer for %v with name: %s", namespacedName, loadBalancerName)
 		klog.Infof("c.elb.CreateLoadBalancer(createRequest): %v", createRequest)
 
-		_, err := c.loadBalancer.CreateLoadBalancer(createRequest)
+		_, err = c.loadBalancer.CreateLoadBalancer(createRequest)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == elbErrCodeMultipleSubnetsUnsupported && len(subnetIDs) > 1 {
+			// Multiple subnets are not supported by every region, fall back to the first one
+			klog.Warningf("Unable to create load balancer %s in subnets %v, falling back to subnet %s: %q",
+				loadBalancerName, subnetIDs, subnetIDs[0], err)
+			createRequest.Subnets = aws.StringSlice(subnetIDs[:1])
+			_, err = c.loadBalancer.CreateLoadBalancer(createRequest)
+		}
 		if err != nil {
 			return nil, err
 		}
+		c.recordLoadBalancerEvent(service, EventCreatedLoadBalancer, "Created load balancer %s in subnets %v with listeners %s",
+			loadBalancerName, aws.StringValueSlice(createRequest.Subnets), listenersString(createRequest.Listeners))
 
-		if proxyProtocol {
-			err = c.createProxyProtocolPolicy(loadBalancerName, false)
+		if proxyProtocolPolicy != "" {
+			err = c.createProxyProtocolPolicy(loadBalancerName, proxyProtocolPolicy, false)
 			if err != nil {
 				return nil, err
 			}
 
 			for _, listener := range listeners {
-				klog.V(2).Infof("Adjusting AWS loadbalancer proxy protocol on node port %d. Setting to true", *listener.InstancePort)
-				err := c.setBackendPolicies(loadBalancerName, *listener.InstancePort, []*string{aws.String(ProxyProtocolPolicyName)})
+				klog.V(2).Infof("Adjusting AWS loadbalancer proxy protocol on node port %d. Setting to %s", *listener.InstancePort, proxyProtocolPolicy)
+				err := c.setBackendPolicies(loadBalancerName, *listener.InstancePort, []*string{aws.String(proxyProtocolPolicy)})
 				if err != nil {
 					return nil, err
 				}
@@ -213,7 +401,7 @@ func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBala
 				request.LoadBalancerName = aws.String(loadBalancerName)
 				request.LoadBalancerPorts = removals
 
-				if proxyProtocol {
+				if proxyProtocolPolicy != "" {
 					for _, backendListener := range loadBalancer.BackendServerDescriptions {
 						for _, instancePort := range removalsInstancePorts {
 							if aws.Int64Value(backendListener.InstancePort) == aws.Int64Value(instancePort) {
@@ -231,6 +419,8 @@ func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBala
 				if _, err := c.loadBalancer.DeleteLoadBalancerListeners(request); err != nil {
 					return nil, fmt.Errorf("error deleting OSC loadbalancer listeners: %q", err)
 				}
+				c.recordLoadBalancerEvent(service, EventUpdatedListeners, "Removed the listeners of ports %v from load balancer %s",
+					aws.Int64ValueSlice(removals), loadBalancerName)
 				dirty = true
 			}
 
@@ -242,6 +432,8 @@ func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBala
 				if _, err := c.loadBalancer.CreateLoadBalancerListeners(request); err != nil {
 					return nil, fmt.Errorf("error creating OSC loadbalancer listeners: %q", err)
 				}
+				c.recordLoadBalancerEvent(service, EventUpdatedListeners, "Added the listeners %s to load balancer %s",
+					listenersString(additions), loadBalancerName)
 				dirty = true
 			}
 		}
@@ -249,20 +441,20 @@ func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBala
 		{
 			// Sync proxy protocol state for new and existing listeners
 			proxyPolicies := make([]*string, 0)
-			if proxyProtocol {
+			if proxyProtocolPolicy != "" {
 				// Ensure the backend policy exists
-				err := c.createProxyProtocolPolicy(loadBalancerName, true)
+				err := c.createProxyProtocolPolicy(loadBalancerName, proxyProtocolPolicy, true)
 				if err != nil {
 					return nil, err
 				}
-				proxyPolicies = append(proxyPolicies, aws.String(ProxyProtocolPolicyName))
+				proxyPolicies = append(proxyPolicies, aws.String(proxyProtocolPolicy))
 			}
 
 			foundBackends := make(map[int64]bool)
-			proxyProtocolBackends := make(map[int64]bool)
+			proxyProtocolBackends := make(map[int64]string)
 			for _, backendListener := range loadBalancer.BackendServerDescriptions {
 				foundBackends[*backendListener.InstancePort] = false
-				proxyProtocolBackends[*backendListener.InstancePort] = proxyProtocolEnabled(backendListener)
+				proxyProtocolBackends[*backendListener.InstancePort] = backendProxyProtocolPolicy(backendListener)
 			}
 
 			for _, listener := range listeners {
@@ -273,16 +465,16 @@ func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBala
 					// This is a new ELB backend so we only need to worry about
 					// potentially adding a policy and not removing an
 					// existing one
-					setPolicy = proxyProtocol
+					setPolicy = proxyProtocolPolicy != ""
 				} else {
 					foundBackends[instancePort] = true
 					// This is an existing ELB backend so we need to determine
-					// if the state changed
-					setPolicy = (currentState != proxyProtocol)
+					// if the state changed, including the version of the proxy protocol
+					setPolicy = (currentState != proxyProtocolPolicy)
 				}
 
 				if setPolicy {
-					klog.V(2).Infof("Adjusting AWS loadbalancer proxy protocol on node port %d. Setting to %t", instancePort, proxyProtocol)
+					klog.V(2).Infof("Adjusting AWS loadbalancer proxy protocol on node port %d. Setting to %q", instancePort, proxyProtocolPolicy)
 					err := c.setBackendPolicies(loadBalancerName, instancePort, proxyPolicies)
 					if err != nil {
 						return nil, err
@@ -292,54 +484,31 @@ func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBala
 			}
 		}
 
-		{
-			// Add additional tags
-			klog.V(2).Infof("Creating additional load balancer tags for %s", loadBalancerName)
-			tags := getLoadBalancerAdditionalTags(annotations)
-			if len(tags) > 0 {
-				err := c.addLoadBalancerTags(loadBalancerName, tags)
-				if err != nil {
-					return nil, fmt.Errorf("unable to create additional load balancer tags: %v", err)
-				}
-			}
+		// Sync the additional tags
+		if err := c.reconcileLoadBalancerTags(loadBalancerName, annotations); err != nil {
+			return nil, err
 		}
 	}
 
 	// Whether the ELB was new or existing, sync attributes regardless. This accounts for things
 	// that cannot be specified at the time of creation and can only be modified after the fact,
 	// e.g. idle connection timeout.
-	{
-		describeAttributesRequest := &elb.DescribeLoadBalancerAttributesInput{}
-		describeAttributesRequest.LoadBalancerName = aws.String(loadBalancerName)
-		describeAttributesOutput, err := c.loadBalancer.DescribeLoadBalancerAttributes(describeAttributesRequest)
-		if err != nil {
-			klog.Warning("Unable to retrieve load balancer attributes during attribute sync")
-			return nil, err
-		}
-
-		foundAttributes := describeAttributesOutput.LoadBalancerAttributes
-
-		// Update attributes if they're dirty
-		if !reflect.DeepEqual(loadBalancerAttributes, foundAttributes) {
-			modifyAttributesRequest := &elb.ModifyLoadBalancerAttributesInput{}
-			modifyAttributesRequest.LoadBalancerName = aws.String(loadBalancerName)
-			modifyAttributesRequest.LoadBalancerAttributes = loadBalancerAttributes
-			klog.V(2).Infof("Updating load-balancer attributes for %q with attributes (%v)",
-				loadBalancerName, loadBalancerAttributes)
-			_, err = c.loadBalancer.ModifyLoadBalancerAttributes(modifyAttributesRequest)
-			if err != nil {
-				return nil, fmt.Errorf("Unable to update load balancer attributes during attribute sync: %q", err)
-			}
-			dirty = true
-		}
+	changed, err := c.ensureLoadBalancerAttributes(service, loadBalancerName, loadBalancerAttributes)
+	if err != nil {
+		return nil, err
 	}
+	dirty = dirty || changed
 
 	if dirty {
-		loadBalancer, err = c.describeLoadBalancer(loadBalancerName)
+		loadBalancer, err = c.loadBalancerService.describeLoadBalancer(loadBalancerName)
 		if err != nil {
 			klog.Warning("Unable to retrieve load balancer after creation/update")
 			return nil, err
 		}
+		if loadBalancer == nil {
+			// LBU is eventually consistent, the next sync completes the reconciliation
+			return nil, fmt.Errorf("load balancer %s not found after creation/update", loadBalancerName)
+		}
 	}
 
 	return loadBalancer, nil
@@ -349,7 +518,6 @@ func (c *Cloud) ensureLoadBalancer(namespacedName types.NamespacedName, loadBala
 // NOTE: there exists an O(nlgn) implementation for this function. However, as the default limit of
 // listeners per elb is 100, this implementation is reduced from O(m*n) => O(n).
 func syncElbListeners(loadBalancerName string, listeners []*elb.Listener, listenerDescriptions []*elb.ListenerDescription) ([]*elb.Listener, []*int64, []*int64) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("syncElbListeners(%v,%v,%v)", loadBalancerName, listeners, listenerDescriptions)
 	foundSet := make(map[int]bool)
 	removals := []*int64{}
@@ -393,7 +561,6 @@ func syncElbListeners(loadBalancerName string, listeners []*elb.Listener, listen
 }
 
 func elbListenersAreEqual(actual, expected *elb.Listener) bool {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("elbListenersAreEqual(%v,%v)", actual, expected)
 	if !elbProtocolsAreEqual(actual.Protocol, expected.Protocol) {
 		return false
@@ -416,7 +583,6 @@ func elbListenersAreEqual(actual, expected *elb.Listener) bool {
 // elbProtocolsAreEqual checks if two ELB protocol strings are considered the same
 // Comparison is case insensitive
 func elbProtocolsAreEqual(l, r *string) bool {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("elbProtocolsAreEqual(%v,%v)", l, r)
 	if l == nil || r == nil {
 		return l == r
@@ -427,7 +593,6 @@ func elbProtocolsAreEqual(l, r *string) bool {
 // awsArnEquals checks if two ARN strings are considered the same
 // Comparison is case insensitive
 func awsArnEquals(l, r *string) bool {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("awsArnEquals(%v,%v)", l, r)
 	if l == nil || r == nil {
 		return l == r
@@ -435,37 +600,53 @@ func awsArnEquals(l, r *string) bool {
 	return strings.EqualFold(aws.StringValue(l), aws.StringValue(r))
 }
 
+// getHealthCheckParameter returns the health check parameter set by the annotation, or else
+// defaultValue
+func getHealthCheckParameter(annotations map[string]string, annotation string, defaultValue int64) (*int64, error) {
+	i64 := defaultValue
+	var err error
+	if s, ok := annotations[annotation]; ok {
+		i64, err = strconv.ParseInt(s, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing health check annotation value: %v", err)
+		}
+	}
+	return &i64, nil
+}
+
 // getExpectedHealthCheck returns an elb.Healthcheck for the provided target
 // and using either sensible defaults or overrides via Service annotations
 func (c *Cloud) getExpectedHealthCheck(target string, annotations map[string]string) (*elb.HealthCheck, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("getExpectedHealthCheck(%v,%v)", target, annotations)
 	healthcheck := &elb.HealthCheck{Target: &target}
 	getOrDefault := func(annotation string, defaultValue int64) (*int64, error) {
-		i64 := defaultValue
-		var err error
-		if s, ok := annotations[annotation]; ok {
-			i64, err = strconv.ParseInt(s, 10, 0)
-			if err != nil {
-				return nil, fmt.Errorf("failed parsing health check annotation value: %v", err)
-			}
+		return getHealthCheckParameter(annotations, annotation, defaultValue)
+	}
+	// Cluster-wide defaults from the cloud config take precedence over the built-in ones
+	clusterDefault := func(configured int64, builtin int64) int64 {
+		if configured > 0 {
+			return configured
 		}
-		return &i64, nil
+		return builtin
 	}
 	var err error
-	healthcheck.HealthyThreshold, err = getOrDefault(ServiceAnnotationLoadBalancerHCHealthyThreshold, defaultHCHealthyThreshold)
+	healthcheck.HealthyThreshold, err = getOrDefault(ServiceAnnotationLoadBalancerHCHealthyThreshold,
+		clusterDefault(c.cfg.Global.HealthCheckHealthyThreshold, defaultHCHealthyThreshold))
 	if err != nil {
 		return nil, err
 	}
-	healthcheck.UnhealthyThreshold, err = getOrDefault(ServiceAnnotationLoadBalancerHCUnhealthyThreshold, defaultHCUnhealthyThreshold)
+	healthcheck.UnhealthyThreshold, err = getOrDefault(ServiceAnnotationLoadBalancerHCUnhealthyThreshold,
+		clusterDefault(c.cfg.Global.HealthCheckUnhealthyThreshold, defaultHCUnhealthyThreshold))
 	if err != nil {
 		return nil, err
 	}
-	healthcheck.Timeout, err = getOrDefault(ServiceAnnotationLoadBalancerHCTimeout, defaultHCTimeout)
+	healthcheck.Timeout, err = getOrDefault(ServiceAnnotationLoadBalancerHCTimeout,
+		clusterDefault(c.cfg.Global.HealthCheckTimeout, defaultHCTimeout))
 	if err != nil {
 		return nil, err
 	}
-	healthcheck.Interval, err = getOrDefault(ServiceAnnotationLoadBalancerHCInterval, defaultHCInterval)
+	healthcheck.Interval, err = getOrDefault(ServiceAnnotationLoadBalancerHCInterval,
+		clusterDefault(c.cfg.Global.HealthCheckInterval, defaultHCInterval))
 	if err != nil {
 		return nil, err
 	}
@@ -478,7 +659,6 @@ func (c *Cloud) getExpectedHealthCheck(target string, annotations map[string]str
 // Makes sure that the health check for an ELB matches the configured health check node port
 func (c *Cloud) ensureLoadBalancerHealthCheck(loadBalancer *elb.LoadBalancerDescription,
 	protocol string, port int32, path string, annotations map[string]string) error {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("ensureLoadBalancerHealthCheck(%v,%v, %v, %v, %v)",
 		loadBalancer, protocol, port, path, annotations)
 	name := aws.StringValue(loadBalancer.LoadBalancerName)
@@ -508,16 +688,16 @@ func (c *Cloud) ensureLoadBalancerHealthCheck(loadBalancer *elb.LoadBalancerDesc
 	if err != nil {
 		return fmt.Errorf("error configuring load balancer health check for %q: %q", name, err)
 	}
+	loadBalancer.HealthCheck = expected
 
 	return nil
 }
 
 // Makes sure that exactly the specified hosts are registered as instances with the load balancer
-func (c *Cloud) ensureLoadBalancerInstances(loadBalancerName string,
+func (c *Cloud) ensureLoadBalancerInstances(service *v1.Service, loadBalancerName string,
 	lbInstances []*elb.Instance,
 	instanceIDs map[InstanceID]*osc.Vm) error {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("ensureLoadBalancerInstances(%v,%v, %v)", loadBalancerName, lbInstances, instanceIDs)
+	klog.V(5).Infof("ensureLoadBalancerInstances(%v,%v,%v, %v)", service, loadBalancerName, lbInstances, instanceIDs)
 	expected := sets.NewString()
 	for id := range instanceIDs {
 		expected.Insert(string(id))
@@ -530,138 +710,46 @@ func (c *Cloud) ensureLoadBalancerInstances(loadBalancerName string,
 
 	additions := expected.Difference(actual)
 	removals := actual.Difference(expected)
-
-	addInstances := []*elb.Instance{}
-	for _, instanceID := range additions.List() {
-		addInstance := &elb.Instance{}
-		addInstance.InstanceId = aws.String(instanceID)
-		addInstances = append(addInstances, addInstance)
-	}
-
-	removeInstances := []*elb.Instance{}
-	for _, instanceID := range removals.List() {
-		removeInstance := &elb.Instance{}
-		removeInstance.InstanceId = aws.String(instanceID)
-		removeInstances = append(removeInstances, removeInstance)
-	}
-	klog.V(5).Infof("ensureLoadBalancerInstances register/Deregister addInstances(%v) , removeInstances(%v)", addInstances, removeInstances)
-
-	if len(addInstances) > 0 {
-		registerRequest := &elb.RegisterInstancesWithLoadBalancerInput{}
-		registerRequest.Instances = addInstances
-		registerRequest.LoadBalancerName = aws.String(loadBalancerName)
-		_, err := c.loadBalancer.RegisterInstancesWithLoadBalancer(registerRequest)
-		if err != nil {
-			return err
+	klog.V(5).Infof("ensureLoadBalancerInstances register/Deregister additions(%v) , removals(%v)", additions.List(), removals.List())
+
+	// The new VMs are registered before the others are deregistered, so that the load
+	// balancer keeps serving during a rolling replacement of the nodes
+	if additions.Len() > 0 {
+		added, err := c.registerBackends(loadBalancerName, additions.List())
+		if len(added) > 0 {
+			klog.V(1).Infof("Instances added to load-balancer %s", loadBalancerName)
+			c.recordLoadBalancerEvent(service, EventRegisteredBackends, "Registered the VMs %v with load balancer %s",
+				added, loadBalancerName)
 		}
-		klog.V(1).Infof("Instances added to load-balancer %s", loadBalancerName)
-	}
-
-	if len(removeInstances) > 0 {
-		deregisterRequest := &elb.DeregisterInstancesFromLoadBalancerInput{}
-		deregisterRequest.Instances = removeInstances
-		deregisterRequest.LoadBalancerName = aws.String(loadBalancerName)
-		_, err := c.loadBalancer.DeregisterInstancesFromLoadBalancer(deregisterRequest)
 		if err != nil {
 			return err
 		}
-		klog.V(1).Infof("Instances removed from load-balancer %s", loadBalancerName)
 	}
 
-	return nil
-}
-
-func (c *Cloud) getLoadBalancerTLSPorts(loadBalancer *elb.LoadBalancerDescription) []int64 {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("getLoadBalancerTLSPorts(%v)", loadBalancer)
-	ports := []int64{}
-
-	for _, listenerDescription := range loadBalancer.ListenerDescriptions {
-		protocol := aws.StringValue(listenerDescription.Listener.Protocol)
-		if protocol == "SSL" || protocol == "HTTPS" {
-			ports = append(ports, aws.Int64Value(listenerDescription.Listener.LoadBalancerPort))
+	if removals.Len() > 0 {
+		removed, err := c.deregisterBackends(loadBalancerName, removals.List())
+		if len(removed) > 0 {
+			klog.V(1).Infof("Instances removed from load-balancer %s", loadBalancerName)
+			c.recordLoadBalancerEvent(service, EventDeregisteredBackends, "Deregistered the VMs %v from load balancer %s",
+				removed, loadBalancerName)
 		}
-	}
-	return ports
-}
-
-func (c *Cloud) ensureSSLNegotiationPolicy(loadBalancer *elb.LoadBalancerDescription, policyName string) error {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("ensureSSLNegotiationPolicy(%v,%v)", loadBalancer, policyName)
-	klog.V(2).Info("Describing load balancer policies on load balancer")
-	result, err := c.loadBalancer.DescribeLoadBalancerPolicies(&elb.DescribeLoadBalancerPoliciesInput{
-		LoadBalancerName: loadBalancer.LoadBalancerName,
-		PolicyNames: []*string{
-			aws.String(fmt.Sprintf(SSLNegotiationPolicyNameFormat, policyName)),
-		},
-	})
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case elb.ErrCodePolicyNotFoundException:
-			default:
-				return fmt.Errorf("error describing security policies on load balancer: %q", err)
-			}
+		if err != nil {
+			return err
 		}
 	}
 
-	if len(result.PolicyDescriptions) > 0 {
-		return nil
-	}
-
-	klog.V(2).Infof("Creating SSL negotiation policy '%s' on load balancer", fmt.Sprintf(SSLNegotiationPolicyNameFormat, policyName))
-	// there is an upper limit of 98 policies on an ELB, we're pretty safe from
-	// running into it
-	_, err = c.loadBalancer.CreateLoadBalancerPolicy(&elb.CreateLoadBalancerPolicyInput{
-		LoadBalancerName: loadBalancer.LoadBalancerName,
-		PolicyName:       aws.String(fmt.Sprintf(SSLNegotiationPolicyNameFormat, policyName)),
-		PolicyTypeName:   aws.String("SSLNegotiationPolicyType"),
-		PolicyAttributes: []*elb.PolicyAttribute{
-			{
-				AttributeName:  aws.String("Reference-Security-Policy"),
-				AttributeValue: aws.String(policyName),
-			},
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("error creating security policy on load balancer: %q", err)
-	}
+	c.updateNodeLoadBalancerMembership(loadBalancerName, expected)
 	return nil
 }
 
-func (c *Cloud) setSSLNegotiationPolicy(loadBalancerName, sslPolicyName string, port int64) error {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("setSSLNegotiationPolicy(%v,%v,%v)", loadBalancerName, sslPolicyName, port)
-	policyName := fmt.Sprintf(SSLNegotiationPolicyNameFormat, sslPolicyName)
-	request := &elb.SetLoadBalancerPoliciesOfListenerInput{
-		LoadBalancerName: aws.String(loadBalancerName),
-		LoadBalancerPort: aws.Int64(port),
-		PolicyNames: []*string{
-			aws.String(policyName),
-		},
-	}
-	klog.V(2).Infof("Setting SSL negotiation policy '%s' on load balancer", policyName)
-	_, err := c.loadBalancer.SetLoadBalancerPoliciesOfListener(request)
-	if err != nil {
-		return fmt.Errorf("error setting SSL negotiation policy '%s' on load balancer: %q", policyName, err)
-	}
-	return nil
-}
-
-func (c *Cloud) createProxyProtocolPolicy(loadBalancerName string, update bool) error {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("createProxyProtocolPolicy(%v) updating(%v)",
-		loadBalancerName, update)
+func (c *Cloud) createProxyProtocolPolicy(loadBalancerName string, policyName string, update bool) error {
+	klog.V(5).Infof("createProxyProtocolPolicy(%v,%v) updating(%v)",
+		loadBalancerName, policyName, update)
 	request := &elb.CreateLoadBalancerPolicyInput{
 		LoadBalancerName: aws.String(loadBalancerName),
-		PolicyName:       aws.String(ProxyProtocolPolicyName),
+		PolicyName:       aws.String(policyName),
 		PolicyTypeName:   aws.String("ProxyProtocolPolicyType"),
-		PolicyAttributes: []*elb.PolicyAttribute{
-			{
-				AttributeName:  aws.String("ProxyProtocol"),
-				AttributeValue: aws.String("true"),
-			},
-		},
+		PolicyAttributes: proxyProtocolPolicyAttributes(policyName),
 	}
 	klog.V(2).Info("Creating proxy protocol policy on load balancer")
 	_, err := c.loadBalancer.CreateLoadBalancerPolicy(request)
@@ -674,6 +762,10 @@ func (c *Cloud) createProxyProtocolPolicy(loadBalancerName string, update bool)
 				}
 			}
 		}
+		if policyName == ProxyProtocolV2PolicyName {
+			return fmt.Errorf("error creating proxy protocol v2 policy on load balancer, the LBU API of region %s may not support it"+
+				" (unset LoadBalancerProxyProtocolV2 in the cloud config if it doesn't): %q", c.region, err)
+		}
 		return fmt.Errorf("error creating proxy protocol policy on load balancer: %q", err)
 	}
 
@@ -681,7 +773,6 @@ func (c *Cloud) createProxyProtocolPolicy(loadBalancerName string, update bool)
 }
 
 func (c *Cloud) setBackendPolicies(loadBalancerName string, instancePort int64, policies []*string) error {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("setBackendPolicies(%v,%v,%v)", loadBalancerName, instancePort, policies)
 	request := &elb.SetLoadBalancerPoliciesForBackendServerInput{
 		InstancePort:     aws.Int64(instancePort),
@@ -702,28 +793,20 @@ func (c *Cloud) setBackendPolicies(loadBalancerName string, instancePort int64,
 }
 
 func proxyProtocolEnabled(backend *elb.BackendServerDescription) bool {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("proxyProtocolEnabled(%v)", backend)
-	for _, policy := range backend.PolicyNames {
-		if aws.StringValue(policy) == ProxyProtocolPolicyName {
-			return true
-		}
-	}
-
-	return false
+	return backendProxyProtocolPolicy(backend) != ""
 }
 
 // findInstancesForELB gets the EC2 instances corresponding to the Nodes, for setting up an ELB
 // We ignore Nodes (with a log message) where the instanceid cannot be determined from the provider,
 // and we ignore instances which are not found
 func (c *Cloud) findInstancesForELB(nodes []*v1.Node) (map[InstanceID]*osc.Vm, error) {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("findInstancesForELB(%v)", nodes)
 
 	for _, node := range nodes {
 		if node.Spec.ProviderID == "" {
 			// TODO  Need to be optimize by setting providerID which is not possible actualy
-			instance, _ := c.findInstanceByNodeName(types.NodeName(node.Name))
+			instance, _ := c.instanceService.findInstanceByNodeName(types.NodeName(node.Name))
 			node.Spec.ProviderID = instance.GetVmId()
 		}
 	}
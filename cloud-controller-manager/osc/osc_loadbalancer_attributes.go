@@ -0,0 +1,141 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Attributes *********************
+
+// int64Differs returns whether the desired value is set and differs from the actual one
+func int64Differs(desired, actual *int64) bool {
+	return desired != nil && (actual == nil || *desired != *actual)
+}
+
+// stringDiffers returns whether the desired value is set and differs from the actual one
+func stringDiffers(desired, actual *string) bool {
+	return desired != nil && aws.StringValue(desired) != aws.StringValue(actual)
+}
+
+// boolDiffers returns whether the desired value is set and differs from the actual one
+func boolDiffers(desired, actual *bool) bool {
+	return desired != nil && (actual == nil || *desired != *actual)
+}
+
+// diffLoadBalancerAttributes returns the sections of the desired attributes which differ
+// from the actual attributes, and their names, or nil when the attributes are up to date. The
+// sections and the fields which are not set in the desired attributes are left as they are,
+// e.g. the access log when no bucket is requested.
+func diffLoadBalancerAttributes(desired, actual *elb.LoadBalancerAttributes) (*elb.LoadBalancerAttributes, []string) {
+	if actual == nil {
+		actual = &elb.LoadBalancerAttributes{}
+	}
+	changes := &elb.LoadBalancerAttributes{}
+	names := []string{}
+
+	if settings := desired.ConnectionSettings; settings != nil {
+		current := actual.ConnectionSettings
+		if current == nil {
+			current = &elb.ConnectionSettings{}
+		}
+		if int64Differs(settings.IdleTimeout, current.IdleTimeout) {
+			changes.ConnectionSettings = settings
+			names = append(names, fmt.Sprintf("idle timeout %ds", aws.Int64Value(settings.IdleTimeout)))
+		}
+	}
+
+	if draining := desired.ConnectionDraining; draining != nil {
+		current := actual.ConnectionDraining
+		if current == nil {
+			current = &elb.ConnectionDraining{}
+		}
+		if boolDiffers(draining.Enabled, current.Enabled) ||
+			(aws.BoolValue(draining.Enabled) && int64Differs(draining.Timeout, current.Timeout)) {
+			changes.ConnectionDraining = draining
+			names = append(names, "connection draining")
+		}
+	}
+
+	if crossZone := desired.CrossZoneLoadBalancing; crossZone != nil {
+		current := actual.CrossZoneLoadBalancing
+		if current == nil {
+			current = &elb.CrossZoneLoadBalancing{}
+		}
+		if boolDiffers(crossZone.Enabled, current.Enabled) {
+			changes.CrossZoneLoadBalancing = crossZone
+			names = append(names, "cross-zone load balancing")
+		}
+	}
+
+	if accessLog := desired.AccessLog; accessLog != nil {
+		current := actual.AccessLog
+		if current == nil {
+			current = &elb.AccessLog{}
+		}
+		if boolDiffers(accessLog.Enabled, current.Enabled) ||
+			(aws.BoolValue(accessLog.Enabled) && (int64Differs(accessLog.EmitInterval, current.EmitInterval) ||
+				stringDiffers(accessLog.S3BucketName, current.S3BucketName) ||
+				stringDiffers(accessLog.S3BucketPrefix, current.S3BucketPrefix))) {
+			changes.AccessLog = accessLog
+			names = append(names, "access log")
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return changes, names
+}
+
+// ensureLoadBalancerAttributes applies the sections of the desired attributes which differ
+// from the attributes of the load balancer, and returns whether they changed. Nothing is
+// modified when the attributes are up to date, so that every reconciliation, on creation,
+// update of the service or update of the nodes, can apply them.
+func (c *Cloud) ensureLoadBalancerAttributes(service *v1.Service, loadBalancerName string,
+	desired *elb.LoadBalancerAttributes) (bool, error) {
+	klog.V(5).Infof("ensureLoadBalancerAttributes(%v, %v)", loadBalancerName, desired)
+	output, err := c.loadBalancer.DescribeLoadBalancerAttributes(&elb.DescribeLoadBalancerAttributesInput{
+		LoadBalancerName: aws.String(loadBalancerName),
+	})
+	if err != nil {
+		klog.Warning("Unable to retrieve load balancer attributes during attribute sync")
+		return false, err
+	}
+
+	changes, names := diffLoadBalancerAttributes(desired, output.LoadBalancerAttributes)
+	if changes == nil {
+		return false, nil
+	}
+	klog.V(2).Infof("Updating load-balancer attributes for %q with attributes (%v)", loadBalancerName, changes)
+	_, err = c.loadBalancer.ModifyLoadBalancerAttributes(&elb.ModifyLoadBalancerAttributesInput{
+		LoadBalancerName:       aws.String(loadBalancerName),
+		LoadBalancerAttributes: changes,
+	})
+	if err != nil {
+		return false, fmt.Errorf("Unable to update load balancer attributes during attribute sync: %q", err)
+	}
+	c.recordLoadBalancerEvent(service, EventUpdatedAttributes, "Updated the attributes of load balancer %s: %s",
+		loadBalancerName, strings.Join(names, ", "))
+	return true, nil
+}
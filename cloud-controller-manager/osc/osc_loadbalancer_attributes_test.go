@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDiffLoadBalancerAttributes(t *testing.T) {
+	actual := &elb.LoadBalancerAttributes{
+		AccessLog:          &elb.AccessLog{Enabled: aws.Bool(false), EmitInterval: aws.Int64(60)},
+		ConnectionDraining: &elb.ConnectionDraining{Enabled: aws.Bool(false), Timeout: aws.Int64(300)},
+		ConnectionSettings: &elb.ConnectionSettings{IdleTimeout: aws.Int64(60)},
+	}
+
+	// The defaults match the attributes of a new load balancer
+	desired, err := getLoadBalancerAttributes(map[string]string{})
+	require.NoError(t, err)
+	changes, names := diffLoadBalancerAttributes(desired, actual)
+	assert.Nil(t, changes)
+	assert.Empty(t, names)
+
+	// Only the changed sections are modified
+	desired, err = getLoadBalancerAttributes(map[string]string{
+		ServiceAnnotationLoadBalancerConnectionIdleTimeout:     "120",
+		ServiceAnnotationLoadBalancerCrossZoneEnabled:          "false",
+		ServiceAnnotationLoadBalancerAccessLogS3BucketName:     "logs",
+		ServiceAnnotationLoadBalancerAccessLogS3BucketPrefix:   "lb",
+		ServiceAnnotationLoadBalancerConnectionDrainingTimeout: "30",
+	})
+	require.NoError(t, err)
+	changes, names = diffLoadBalancerAttributes(desired, actual)
+	assert.Equal(t, &elb.LoadBalancerAttributes{
+		ConnectionSettings:     &elb.ConnectionSettings{IdleTimeout: aws.Int64(120)},
+		CrossZoneLoadBalancing: &elb.CrossZoneLoadBalancing{Enabled: aws.Bool(false)},
+	}, changes)
+	assert.Equal(t, []string{"idle timeout 120s", "cross-zone load balancing"}, names)
+
+	// The access log settings are only compared when enabled
+	desired.AccessLog.Enabled = aws.Bool(true)
+	desired.ConnectionDraining.Enabled = aws.Bool(true)
+	changes, names = diffLoadBalancerAttributes(desired, actual)
+	assert.Equal(t, desired.AccessLog, changes.AccessLog)
+	assert.Equal(t, desired.ConnectionDraining, changes.ConnectionDraining)
+	assert.Contains(t, names, "access log")
+	assert.Contains(t, names, "connection draining")
+
+	changes, _ = diffLoadBalancerAttributes(desired, nil)
+	assert.NotNil(t, changes)
+}
+
+func TestEnsureLoadBalancerAttributes(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+	fakeELB := awsServices.elb.(*FakeELB)
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:        "web",
+		Namespace:   "shop",
+		Annotations: map[string]string{ServiceAnnotationLoadBalancerConnectionIdleTimeout: "300"},
+	}}
+
+	attributes, err := getLoadBalancerAttributes(service.Annotations)
+	require.NoError(t, err)
+	changed, err := c.ensureLoadBalancerAttributes(service, "lb-web", attributes)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, &elb.LoadBalancerAttributes{ConnectionSettings: &elb.ConnectionSettings{IdleTimeout: aws.Int64(300)}},
+		fakeELB.ModifiedAttributes["lb-web"])
+	assert.Equal(t, int64(300), aws.Int64Value(fakeELB.Attributes["lb-web"].ConnectionSettings.IdleTimeout))
+	assert.Len(t, recorder.Events, 1)
+
+	// The attributes are applied once
+	delete(fakeELB.ModifiedAttributes, "lb-web")
+	changed, err = c.ensureLoadBalancerAttributes(service, "lb-web", attributes)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.NotContains(t, fakeELB.ModifiedAttributes, "lb-web")
+	assert.Len(t, recorder.Events, 1)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Backends *********************
+
+const (
+	// defaultBackendBatchSize is the default number of VMs registered or deregistered by a
+	// single LBU call
+	defaultBackendBatchSize = 100
+	// defaultBackendWorkers is the default number of concurrent LBU calls registering or
+	// deregistering the VMs of a load balancer
+	defaultBackendWorkers = 4
+)
+
+// backendBatchSize returns the number of VMs registered or deregistered by a single LBU call
+func (c *Cloud) backendBatchSize() int {
+	if c.cfg.Global.LoadBalancerBackendBatchSize > 0 {
+		return c.cfg.Global.LoadBalancerBackendBatchSize
+	}
+	return defaultBackendBatchSize
+}
+
+// backendWorkers returns the number of concurrent backend updates
+func (c *Cloud) backendWorkers() int {
+	if c.cfg.Global.LoadBalancerBackendWorkers > 0 {
+		return c.cfg.Global.LoadBalancerBackendWorkers
+	}
+	return defaultBackendWorkers
+}
+
+// batchInstanceIDs splits the VM IDs into batches of at most size VMs
+func batchInstanceIDs(instanceIDs []string, size int) [][]*elb.Instance {
+	batches := [][]*elb.Instance{}
+	for start := 0; start < len(instanceIDs); start += size {
+		end := start + size
+		if end > len(instanceIDs) {
+			end = len(instanceIDs)
+		}
+		batch := make([]*elb.Instance, 0, end-start)
+		for _, instanceID := range instanceIDs[start:end] {
+			batch = append(batch, &elb.Instance{InstanceId: aws.String(instanceID)})
+		}
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// updateBackends applies update to the batches of VMs with bounded concurrency. It returns
+// the sorted IDs of the VMs of the successful batches, and the errors of the others.
+func (c *Cloud) updateBackends(instanceIDs []string, update func(batch []*elb.Instance) error) ([]string, error) {
+	batches := batchInstanceIDs(instanceIDs, c.backendBatchSize())
+
+	var mutex sync.Mutex
+	updated := []string{}
+	errs := []error{}
+	workqueue.ParallelizeUntil(context.TODO(), c.backendWorkers(), len(batches), func(i int) {
+		err := update(batches[i])
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		for _, instance := range batches[i] {
+			updated = append(updated, aws.StringValue(instance.InstanceId))
+		}
+	})
+	sort.Strings(updated)
+	return updated, utilerrors.NewAggregate(errs)
+}
+
+// registerBackends registers the VMs with the load balancer, by batches
+func (c *Cloud) registerBackends(loadBalancerName string, instanceIDs []string) ([]string, error) {
+	klog.V(5).Infof("registerBackends(%v, %v)", loadBalancerName, instanceIDs)
+	return c.updateBackends(instanceIDs, func(batch []*elb.Instance) error {
+		_, err := c.loadBalancer.RegisterInstancesWithLoadBalancer(&elb.RegisterInstancesWithLoadBalancerInput{
+			Instances:        batch,
+			LoadBalancerName: aws.String(loadBalancerName),
+		})
+		return err
+	})
+}
+
+// deregisterBackends deregisters the VMs from the load balancer, by batches
+func (c *Cloud) deregisterBackends(loadBalancerName string, instanceIDs []string) ([]string, error) {
+	klog.V(5).Infof("deregisterBackends(%v, %v)", loadBalancerName, instanceIDs)
+	return c.updateBackends(instanceIDs, func(batch []*elb.Instance) error {
+		_, err := c.loadBalancer.DeregisterInstancesFromLoadBalancer(&elb.DeregisterInstancesFromLoadBalancerInput{
+			Instances:        batch,
+			LoadBalancerName: aws.String(loadBalancerName),
+		})
+		return err
+	})
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchInstanceIDs(t *testing.T) {
+	assert.Empty(t, batchInstanceIDs(nil, 2))
+
+	batches := batchInstanceIDs([]string{"i-1", "i-2", "i-3", "i-4", "i-5"}, 2)
+	if assert.Len(t, batches, 3) {
+		assert.Len(t, batches[0], 2)
+		assert.Len(t, batches[2], 1)
+		assert.Equal(t, "i-5", aws.StringValue(batches[2][0].InstanceId))
+	}
+}
+
+func TestUpdateBackends(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.cfg.Global.LoadBalancerBackendBatchSize = 2
+	c.cfg.Global.LoadBalancerBackendWorkers = 3
+
+	var mutex sync.Mutex
+	calls := 0
+	updated, err := c.updateBackends([]string{"i-5", "i-4", "i-3", "i-2", "i-1"}, func(batch []*elb.Instance) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls++
+		for _, instance := range batch {
+			if aws.StringValue(instance.InstanceId) == "i-3" {
+				return errors.New("Throttling")
+			}
+		}
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []string{"i-1", "i-4", "i-5"}, updated, "the VMs of the other batches are updated")
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Class *********************
+
+// loadBalancerClass returns the load balancer class of the cloud provider
+func (c *Cloud) loadBalancerClass() string {
+	if c.cfg.Global.LoadBalancerClass != "" {
+		return c.cfg.Global.LoadBalancerClass
+	}
+	return DefaultLoadBalancerClass
+}
+
+// managesLoadBalancerClass checks whether the load balancer of the service is reconciled by
+// the cloud provider: the service has no load balancer class, or the class of the cloud provider
+func (c *Cloud) managesLoadBalancerClass(service *v1.Service) bool {
+	return service.Spec.LoadBalancerClass == nil || *service.Spec.LoadBalancerClass == c.loadBalancerClass()
+}
+
+// hasLoadBalancerClass checks whether the service sets the load balancer class of the cloud provider
+func (c *Cloud) hasLoadBalancerClass(service *v1.Service) bool {
+	return service.Spec.LoadBalancerClass != nil && *service.Spec.LoadBalancerClass == c.loadBalancerClass()
+}
+
+// loadBalancerClassController reconciles the Services of the load balancer class of the
+// cloud provider. The service controller of the cloud provider framework only reconciles
+// the Services without class, the Services of a class are left to the controller of the
+// class. The Services are queued when they change, and all of them when the nodes to
+// register with the load balancers change.
+type loadBalancerClassController struct {
+	cloud *Cloud
+	queue *serviceQueue
+}
+
+func newLoadBalancerClassController(cloud *Cloud) *loadBalancerClassController {
+	l := &loadBalancerClassController{cloud: cloud}
+	l.queue = newServiceQueue(cloud, "load-balancer-class", l.sync)
+	return l
+}
+
+// watch queues the Services of the class when they or the nodes change, to be called before
+// the informers are started
+func (l *loadBalancerClassController) watch() {
+	if l == nil {
+		return
+	}
+	c := l.cloud
+	_, err := c.serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { l.serviceChanged(nil, obj) },
+		UpdateFunc: func(old, obj interface{}) { l.serviceChanged(old, obj) },
+	})
+	if err != nil {
+		klog.Warningf("Error watching the services of load balancer class %s: %v", c.loadBalancerClass(), err)
+	}
+	_, err = c.nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { l.enqueueAll() },
+		UpdateFunc: l.nodeChanged,
+		DeleteFunc: func(interface{}) { l.enqueueAll() },
+	})
+	if err != nil {
+		klog.Warningf("Error watching the nodes for load balancer class %s: %v", c.loadBalancerClass(), err)
+	}
+}
+
+// run reconciles the queued Services of the class until stop is closed
+func (l *loadBalancerClassController) run(stop <-chan struct{}) {
+	if l == nil {
+		return
+	}
+
+	klog.Infof("Starting load balancer class controller for class %s", l.cloud.loadBalancerClass())
+	l.queue.run(stop)
+}
+
+// serviceChanged queues the Service of the class when it is added, or when its spec, its
+// annotations or its deletion timestamp changed, the updates of its status being ignored
+func (l *loadBalancerClassController) serviceChanged(old interface{}, obj interface{}) {
+	service, ok := obj.(*v1.Service)
+	if !ok || !l.cloud.hasLoadBalancerClass(service) {
+		return
+	}
+	if oldService, ok := old.(*v1.Service); ok &&
+		equality.Semantic.DeepEqual(oldService.Spec, service.Spec) &&
+		equality.Semantic.DeepEqual(oldService.Annotations, service.Annotations) &&
+		equality.Semantic.DeepEqual(oldService.DeletionTimestamp, service.DeletionTimestamp) {
+		return
+	}
+	l.queue.enqueue(service)
+}
+
+// nodeChanged queues all the Services of the class when the node became, or is no longer,
+// a node to register with the load balancers
+func (l *loadBalancerClassController) nodeChanged(old interface{}, obj interface{}) {
+	oldNode, ok := old.(*v1.Node)
+	if !ok {
+		return
+	}
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		return
+	}
+	if len(loadBalancerClassNodes([]*v1.Node{oldNode})) != len(loadBalancerClassNodes([]*v1.Node{node})) {
+		l.enqueueAll()
+	}
+}
+
+// enqueueAll queues all the Services of the class
+func (l *loadBalancerClassController) enqueueAll() {
+	services, err := l.cloud.serviceInformer.Lister().List(labels.Everything())
+	if err != nil {
+		klog.Warningf("Unable to list services for load balancer class %s: %q", l.cloud.loadBalancerClass(), err)
+		return
+	}
+	for _, service := range services {
+		if l.cloud.hasLoadBalancerClass(service) {
+			l.queue.enqueue(service)
+		}
+	}
+}
+
+// loadBalancerClassNodes returns the nodes to register with the load balancers: the Ready
+// nodes not excluded from the external load balancers, as selected by the service controller
+func loadBalancerClassNodes(nodes []*v1.Node) []*v1.Node {
+	selected := []*v1.Node{}
+	for _, node := range nodes {
+		if _, excluded := node.Labels[v1.LabelNodeExcludeBalancers]; excluded {
+			continue
+		}
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+				selected = append(selected, node)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// sync reconciles the load balancer of a queued Service of the class, reporting the errors
+// with an event
+func (l *loadBalancerClassController) sync(service *v1.Service, nodes []*v1.Node) error {
+	c := l.cloud
+	if !c.hasLoadBalancerClass(service) {
+		return nil
+	}
+	err := l.syncService(service, nodes)
+	if err != nil && c.eventRecorder != nil {
+		c.eventRecorder.Eventf(service, v1.EventTypeWarning, "SyncLoadBalancerFailed",
+			"Error syncing load balancer: %v", err)
+	}
+	return err
+}
+
+// syncService ensures the load balancer of the service, or deletes it once the service is
+// deleted or no longer of type LoadBalancer, and updates the status of the service
+func (l *loadBalancerClassController) syncService(service *v1.Service, nodes []*v1.Node) error {
+	c := l.cloud
+	ctx := context.TODO()
+	status := &v1.LoadBalancerStatus{}
+	if service.DeletionTimestamp != nil || service.Spec.Type != v1.ServiceTypeLoadBalancer {
+		if !hasLoadBalancerFinalizer(service) {
+			return nil
+		}
+		if err := c.EnsureLoadBalancerDeleted(ctx, "", service); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		status, err = c.EnsureLoadBalancer(ctx, "", service, nodes)
+		if err != nil {
+			return err
+		}
+	}
+
+	if service.DeletionTimestamp != nil || equality.Semantic.DeepEqual(*status, service.Status.LoadBalancer) {
+		return nil
+	}
+	// The finalizer added by EnsureLoadBalancer changed the resource version of the service,
+	// the status is patched. A nil ingress removes the ingress of the deleted load balancer.
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"loadBalancer": map[string]interface{}{"ingress": status.Ingress},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.kubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name,
+		types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		return fmt.Errorf("error updating the status of service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+	return nil
+}
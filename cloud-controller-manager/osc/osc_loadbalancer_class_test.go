@@ -0,0 +1,163 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestManagesLoadBalancerClass(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	service := &v1.Service{}
+	assert.True(t, c.managesLoadBalancerClass(service))
+	assert.False(t, c.hasLoadBalancerClass(service))
+
+	service.Spec.LoadBalancerClass = aws.String(DefaultLoadBalancerClass)
+	assert.True(t, c.managesLoadBalancerClass(service))
+	assert.True(t, c.hasLoadBalancerClass(service))
+
+	service.Spec.LoadBalancerClass = aws.String("metallb.io/bgp")
+	assert.False(t, c.managesLoadBalancerClass(service))
+
+	c.cfg.Global.LoadBalancerClass = "metallb.io/bgp"
+	assert.True(t, c.hasLoadBalancerClass(service))
+
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, &v1.Service{Spec: v1.ServiceSpec{
+		LoadBalancerClass: aws.String("example.com/other"),
+	}}, []*v1.Node{})
+	assert.Error(t, err, "the services of other classes are not reconciled")
+}
+
+func TestLoadBalancerClassNodes(t *testing.T) {
+	ready := []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "ready"}, Status: v1.NodeStatus{Conditions: ready}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "not-ready"}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "excluded", Labels: map[string]string{v1.LabelNodeExcludeBalancers: ""}},
+			Status:     v1.NodeStatus{Conditions: ready},
+		},
+	}
+	selected := loadBalancerClassNodes(nodes)
+	if assert.Len(t, selected, 1) {
+		assert.Equal(t, "ready", selected[0].Name)
+	}
+}
+
+func TestLoadBalancerClassSyncService(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.vpcID = "vpc-123456"
+
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+	}) {
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "myservice", UID: "anuid"},
+		Spec: v1.ServiceSpec{
+			Type:              v1.ServiceTypeLoadBalancer,
+			LoadBalancerClass: aws.String(DefaultLoadBalancerClass),
+			SessionAffinity:   v1.ServiceAffinityNone,
+			Ports:             []v1.ServicePort{{Port: 8383, TargetPort: intstr.FromInt(80), Protocol: "TCP", NodePort: 4040}},
+		},
+	}
+	c.kubeClient = fake.NewSimpleClientset(service)
+	controller := newLoadBalancerClassController(c)
+
+	err = controller.syncService(service, []*v1.Node{})
+	assert.NoError(t, err)
+	assert.Len(t, awsServices.elb.(*FakeELB).LoadBalancers, 1)
+
+	updated, err := c.kubeClient.CoreV1().Services("default").Get(context.TODO(), "myservice", metav1.GetOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, updated.Status.LoadBalancer.Ingress, 1) {
+		assert.Equal(t, "anuid", updated.Status.LoadBalancer.Ingress[0].Hostname)
+	}
+	assert.True(t, hasLoadBalancerFinalizer(updated))
+}
+
+func TestLoadBalancerClassQueue(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "myservice"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, LoadBalancerClass: aws.String(DefaultLoadBalancerClass)},
+	}
+	other := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "other"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+	client := fake.NewSimpleClientset(service, other)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	c.serviceInformer = factory.Core().V1().Services()
+	assert.NoError(t, c.serviceInformer.Informer().GetStore().Add(service))
+	assert.NoError(t, c.serviceInformer.Informer().GetStore().Add(other))
+	controller := newLoadBalancerClassController(c)
+	queued := func() int {
+		length := controller.queue.queue.Len()
+		for controller.queue.queue.Len() > 0 {
+			item, _ := controller.queue.queue.Get()
+			controller.queue.queue.Done(item)
+		}
+		return length
+	}
+
+	// Only the Services of the class are queued, and not on the updates of their status
+	controller.serviceChanged(nil, other)
+	assert.Equal(t, 0, queued())
+	controller.serviceChanged(nil, service)
+	assert.Equal(t, 1, queued())
+	updated := service.DeepCopy()
+	updated.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: "lb"}}
+	controller.serviceChanged(service, updated)
+	assert.Equal(t, 0, queued())
+	updated.Annotations = map[string]string{ServiceAnnotationLoadBalancerInternal: "true"}
+	controller.serviceChanged(service, updated)
+	assert.Equal(t, 1, queued())
+
+	// All the Services of the class are queued when a node becomes ready
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}
+	ready := node.DeepCopy()
+	ready.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+	controller.nodeChanged(node, node.DeepCopy())
+	assert.Equal(t, 0, queued())
+	controller.nodeChanged(node, ready)
+	assert.Equal(t, 1, queued())
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Cleanup *********************
+
+// hasLoadBalancerFinalizer returns whether the service carries LoadBalancerCleanupFinalizer
+func hasLoadBalancerFinalizer(service *v1.Service) bool {
+	for _, finalizer := range service.Finalizers {
+		if finalizer == LoadBalancerCleanupFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// addLoadBalancerFinalizer adds LoadBalancerCleanupFinalizer to the service before its
+// load balancer is created, so that the service is only removed once the load balancer
+// and its security groups are deleted
+func (c *Cloud) addLoadBalancerFinalizer(service *v1.Service) error {
+	if c.kubeClient == nil || hasLoadBalancerFinalizer(service) || service.DeletionTimestamp != nil {
+		return nil
+	}
+	klog.V(2).Infof("Adding finalizer %s to service %s/%s", LoadBalancerCleanupFinalizer, service.Namespace, service.Name)
+	return c.patchLoadBalancerFinalizer(service, map[string]interface{}{
+		"finalizers": []string{LoadBalancerCleanupFinalizer},
+	})
+}
+
+// removeLoadBalancerFinalizer removes LoadBalancerCleanupFinalizer from the service once its
+// load balancer is deleted
+func (c *Cloud) removeLoadBalancerFinalizer(service *v1.Service) error {
+	if c.kubeClient == nil || !hasLoadBalancerFinalizer(service) {
+		return nil
+	}
+	klog.V(2).Infof("Removing finalizer %s from service %s/%s", LoadBalancerCleanupFinalizer, service.Namespace, service.Name)
+	return c.patchLoadBalancerFinalizer(service, map[string]interface{}{
+		"$deleteFromPrimitiveList/finalizers": []string{LoadBalancerCleanupFinalizer},
+	})
+}
+
+// patchLoadBalancerFinalizer applies a strategic merge patch to the metadata of the service,
+// which leaves the finalizers of the other controllers untouched
+func (c *Cloud) patchLoadBalancerFinalizer(service *v1.Service, metadata map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+	_, err = c.kubeClient.CoreV1().Services(service.Namespace).Patch(context.TODO(), service.Name,
+		types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error updating the finalizers of service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+	return nil
+}
+
+// orphanSweeper periodically deletes the load balancers and security groups of the cluster
+// whose service no longer exists, e.g. when the CCM was stopped while deleting them
+type orphanSweeper struct {
+	cloud    *Cloud
+	interval time.Duration
+	// Security groups without load balancer on the previous sweep. A security group is
+	// created before its load balancer, so it is only deleted on the next sweep.
+	orphanSecurityGroups sets.String
+}
+
+func newOrphanSweeper(cloud *Cloud, interval time.Duration) *orphanSweeper {
+	return &orphanSweeper{
+		cloud:                cloud,
+		interval:             interval,
+		orphanSecurityGroups: sets.NewString(),
+	}
+}
+
+// run sweeps the orphan resources every interval until stop is closed
+func (s *orphanSweeper) run(stop <-chan struct{}) {
+	if s == nil || s.interval <= 0 {
+		return
+	}
+	if s.cloud.tagging.clusterID() == "" {
+		klog.Warningf("Orphan sweeper disabled: the cluster ID is not configured")
+		return
+	}
+
+	klog.Infof("Starting orphan load balancer sweeper (interval %v)", s.interval)
+	go wait.Until(s.sync, s.interval, stop)
+}
+
+// sync cleans up the services stuck on their finalizer, deletes the orphan load balancers,
+// then the orphan security groups
+func (s *orphanSweeper) sync() {
+	c := s.cloud
+	if c.kubeClient == nil {
+		return
+	}
+
+	if err := s.sweepDeletingServices(); err != nil {
+		klog.Warningf("Unable to sweep the services being deleted: %v", err)
+	}
+
+	response, err := c.loadBalancer.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{})
+	if err != nil {
+		klog.Warningf("Unable to list the load balancers for the orphan sweep: %q", err)
+		return
+	}
+	loadBalancerNames := sets.NewString()
+	for _, lb := range response.LoadBalancerDescriptions {
+		loadBalancerNames.Insert(aws.StringValue(lb.LoadBalancerName))
+	}
+
+	for _, loadBalancerName := range loadBalancerNames.List() {
+		if err := s.sweepLoadBalancer(loadBalancerName); err != nil {
+			klog.Warningf("Unable to sweep load balancer %s: %v", loadBalancerName, err)
+		}
+	}
+
+	if err := s.sweepSecurityGroups(loadBalancerNames); err != nil {
+		klog.Warningf("Unable to sweep the security groups: %v", err)
+	}
+}
+
+// sweepLoadBalancer deletes the load balancer when it is owned by the cluster, not managed by
+// another cluster, and its service no longer exists
+func (s *orphanSweeper) sweepLoadBalancer(loadBalancerName string) error {
+	c := s.cloud
+	tags, err := c.loadBalancerService.describeLoadBalancerTags(loadBalancerName)
+	if err != nil {
+		return err
+	}
+	resourceTags := []osc.ResourceTag{}
+	for key, value := range tags {
+		resourceTags = append(resourceTags, osc.ResourceTag{Key: key, Value: value})
+	}
+	if !c.tagging.hasClusterTag(&resourceTags) && !c.tagging.isManagedBy(&resourceTags) {
+		return nil
+	}
+	if c.tagging.isManagedByOtherCluster(&resourceTags) {
+		// The service of the load balancer lives in the cluster reconciling it
+		return nil
+	}
+	namespace, name, found := strings.Cut(tags[TagNameKubernetesService], "/")
+	if !found {
+		return nil
+	}
+
+	_, err = c.kubeClient.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+	klog.Infof("Deleting load balancer %s of deleted service %s/%s", loadBalancerName, namespace, name)
+	orphan := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	return c.deleteLoadBalancer(orphan, loadBalancerName, true)
+}
+
+// sweepDeletingServices cleans up the services being deleted which only wait for
+// LoadBalancerCleanupFinalizer: the service controller only cleans up the services carrying
+// its own finalizer
+func (s *orphanSweeper) sweepDeletingServices() error {
+	c := s.cloud
+	services, err := c.kubeClient.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing services: %v", err)
+	}
+	for i := range services.Items {
+		service := &services.Items[i]
+		if service.DeletionTimestamp == nil || !hasLoadBalancerFinalizer(service) || servicehelpers.HasLBFinalizer(service) {
+			continue
+		}
+		klog.Infof("Deleting load balancer of service %s/%s being deleted", service.Namespace, service.Name)
+		if err := c.EnsureLoadBalancerDeleted(context.TODO(), "", service); err != nil {
+			klog.Warningf("Unable to delete the load balancer of service %s/%s: %v", service.Namespace, service.Name, err)
+		}
+	}
+	return nil
+}
+
+// sweepSecurityGroups deletes the load balancer security groups of the cluster, not managed by
+// another cluster, whose load balancer does not exist anymore on two consecutive sweeps
+func (s *orphanSweeper) sweepSecurityGroups(loadBalancerNames sets.String) error {
+	c := s.cloud
+	groups, err := c.compute.ReadSecurityGroups(&osc.ReadSecurityGroupsRequest{
+		Filters: &osc.FiltersSecurityGroup{
+			TagKeys: c.tagging.clusterTagKeysFilter(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error querying security groups: %q", err)
+	}
+
+	prefix := c.tagging.prefixedName("k8s-elb-")
+	orphans := sets.NewString()
+	for _, group := range groups {
+		groupID := group.GetSecurityGroupId()
+		name := loadBalancerSecurityGroupName(&group)
+		if groupID == "" || groupID == c.cfg.Global.ElbSecurityGroup || !strings.HasPrefix(name, prefix) ||
+			isSelectedSecurityGroup(group.Tags) || !c.tagging.hasClusterTag(group.Tags) || c.tagging.isManagedByOtherCluster(group.Tags) ||
+			loadBalancerNames.Has(strings.TrimPrefix(name, prefix)) {
+			continue
+		}
+		if !s.orphanSecurityGroups.Has(groupID) {
+			orphans.Insert(groupID)
+			continue
+		}
+
+		klog.Infof("Deleting security group %s of deleted load balancer %s", groupID, strings.TrimPrefix(name, prefix))
+		_, err := c.compute.DeleteSecurityGroup(&osc.DeleteSecurityGroupRequest{SecurityGroupId: &groupID})
+		if err != nil {
+			// The security group may still be used, e.g. by a load balancer being deleted
+			klog.Warningf("Unable to delete security group %s: %q", groupID, err)
+			orphans.Insert(groupID)
+		}
+	}
+	s.orphanSecurityGroups = orphans
+	return nil
+}
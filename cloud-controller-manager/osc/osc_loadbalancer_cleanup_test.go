@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+)
+
+func TestLoadBalancerFinalizer(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:       "web",
+		Namespace:  "default",
+		Finalizers: []string{servicehelpers.LoadBalancerCleanupFinalizer},
+	}}
+	client := fake.NewSimpleClientset(service)
+	c.kubeClient = client
+
+	current := func() *v1.Service {
+		current, err := client.CoreV1().Services("default").Get(context.TODO(), "web", metav1.GetOptions{})
+		assert.NoError(t, err)
+		return current
+	}
+
+	assert.NoError(t, c.addLoadBalancerFinalizer(service))
+	assert.ElementsMatch(t, []string{servicehelpers.LoadBalancerCleanupFinalizer, LoadBalancerCleanupFinalizer}, current().Finalizers)
+
+	assert.NoError(t, c.removeLoadBalancerFinalizer(current()))
+	assert.Equal(t, []string{servicehelpers.LoadBalancerCleanupFinalizer}, current().Finalizers)
+
+	// Services that no longer exist are ignored
+	assert.NoError(t, c.addLoadBalancerFinalizer(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "gone", Namespace: "default"}}))
+}
+
+func TestOrphanSweeperLoadBalancers(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.kubeClient = fake.NewSimpleClientset(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}})
+
+	fakeELB := awsServices.elb.(*FakeELB)
+	clusterTag := fmt.Sprintf("%s%s", TagNameKubernetesClusterPrefix, TestClusterID)
+	for name, tags := range map[string]map[string]string{
+		"lb-web":     {clusterTag: ResourceLifecycleOwned, TagNameKubernetesService: "default/web"},
+		"lb-deleted": {clusterTag: ResourceLifecycleOwned, TagNameKubernetesService: "default/deleted"},
+		"lb-other":   {TagNameKubernetesClusterPrefix + "other": ResourceLifecycleOwned, TagNameKubernetesService: "default/deleted"},
+		"lb-managed": {clusterTag: ResourceLifecycleOwned, TagNameManagedBy: "other", TagNameKubernetesService: "default/deleted"},
+	} {
+		request := &elb.CreateLoadBalancerInput{LoadBalancerName: aws.String(name)}
+		for key, value := range tags {
+			request.Tags = append(request.Tags, &elb.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+		_, err := fakeELB.CreateLoadBalancer(request)
+		assert.NoError(t, err)
+	}
+
+	sweeper := newOrphanSweeper(c, time.Minute)
+	for _, name := range []string{"lb-web", "lb-deleted", "lb-other", "lb-managed"} {
+		assert.NoError(t, sweeper.sweepLoadBalancer(name))
+	}
+	assert.Contains(t, fakeELB.LoadBalancers, "lb-web")
+	assert.NotContains(t, fakeELB.LoadBalancers, "lb-deleted")
+	assert.Contains(t, fakeELB.LoadBalancers, "lb-other", "load balancers of other clusters are left untouched")
+	assert.Contains(t, fakeELB.LoadBalancers, "lb-managed", "load balancers managed by other clusters are left untouched")
+}
+
+func TestOrphanSweeperSecurityGroups(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	compute := awsServices.compute.(*FakeComputeImpl)
+	compute.MainSecurityGroup.SetSecurityGroupName("k8s-elb-lb-deleted")
+
+	sweeper := newOrphanSweeper(c, time.Minute)
+	assert.NoError(t, sweeper.sweepSecurityGroups(sets.NewString("lb-web")))
+	assert.Empty(t, compute.DeletedSecurityGroups, "the load balancer may not be created yet")
+
+	assert.NoError(t, sweeper.sweepSecurityGroups(sets.NewString("lb-web")))
+	assert.Equal(t, []string{"sg-1234"}, compute.DeletedSecurityGroups)
+
+	// The security groups managed by another cluster are left untouched
+	compute.DeletedSecurityGroups = nil
+	tags := append(compute.MainSecurityGroup.GetTags(), osc.ResourceTag{Key: TagNameManagedBy, Value: "other"})
+	compute.MainSecurityGroup.SetTags(tags)
+	assert.NoError(t, sweeper.sweepSecurityGroups(sets.NewString("lb-web")))
+	assert.NoError(t, sweeper.sweepSecurityGroups(sets.NewString("lb-web")))
+	assert.Empty(t, compute.DeletedSecurityGroups)
+
+	compute.MainSecurityGroup.SetTags(tags[:len(tags)-1])
+	compute.MainSecurityGroup.SetSecurityGroupName("k8s-elb-lb-web")
+	assert.NoError(t, sweeper.sweepSecurityGroups(sets.NewString("lb-web")))
+	assert.NoError(t, sweeper.sweepSecurityGroups(sets.NewString("lb-web")))
+	assert.Empty(t, compute.DeletedSecurityGroups)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ********************* CCM Load Balancer Defaults *********************
+
+// loadBalancerAnnotationPrefix is the prefix of the annotations read by the cloud provider
+const loadBalancerAnnotationPrefix = "service.beta.kubernetes.io/"
+
+// parseLoadBalancerDefaults parses the Annotation values of the LoadBalancerDefaults section
+// of the cloud config, as key=value. The values are validated as the service annotations.
+func parseLoadBalancerDefaults(values []string) (map[string]string, error) {
+	defaults := make(map[string]string, len(values))
+	for _, value := range values {
+		key, annotation, found := strings.Cut(value, "=")
+		key = strings.TrimSpace(key)
+		annotation = strings.TrimSpace(annotation)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid default annotation %q, expected key=value", value)
+		}
+		if !strings.HasPrefix(key, loadBalancerAnnotationPrefix) {
+			return nil, fmt.Errorf("invalid default annotation %q, not a load balancer annotation", key)
+		}
+		if key == ServiceAnnotationLoadBalancerName {
+			return nil, fmt.Errorf("invalid default annotation %q, the load balancer names must be unique", key)
+		}
+		if validate, found := annotationValidators[key]; found {
+			if err := validate(annotation); err != nil {
+				return nil, fmt.Errorf("invalid default annotation %s=%s: %v", key, annotation, err)
+			}
+		}
+		defaults[key] = annotation
+	}
+	return defaults, nil
+}
+
+// loadBalancerAnnotations returns the annotations of the service completed with the defaults
+// of the cloud config. The annotations set on the service take precedence over the profile
+// they select, which takes precedence over the defaults.
+func (c *Cloud) loadBalancerAnnotations(service *v1.Service) map[string]string {
+	if _, found := service.Annotations[ServiceAnnotationLoadBalancerProfile]; !found && len(c.loadBalancerDefaults) == 0 {
+		return service.Annotations
+	}
+
+	annotations := make(map[string]string, len(service.Annotations)+len(c.loadBalancerDefaults))
+	for key, value := range service.Annotations {
+		annotations[key] = value
+	}
+	if profile, found := c.loadBalancerDefaults[ServiceAnnotationLoadBalancerProfile]; found {
+		if _, set := annotations[ServiceAnnotationLoadBalancerProfile]; !set {
+			annotations[ServiceAnnotationLoadBalancerProfile] = profile
+		}
+	}
+	// An invalid profile is reported by the reconciliation of the load balancer
+	if expanded, err := expandLoadBalancerProfile(annotations); err == nil {
+		annotations = expanded
+	}
+	for key, value := range c.loadBalancerDefaults {
+		if _, set := annotations[key]; !set {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+// withLoadBalancerDefaults returns a copy of the service carrying the annotations completed
+// with the defaults of the cloud config, or the service itself when there is no default
+func (c *Cloud) withLoadBalancerDefaults(service *v1.Service) *v1.Service {
+	if len(c.loadBalancerDefaults) == 0 || service == nil {
+		return service
+	}
+	defaulted := *service
+	defaulted.Annotations = c.loadBalancerAnnotations(service)
+	return &defaulted
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseLoadBalancerDefaults(t *testing.T) {
+	defaults, err := parseLoadBalancerDefaults([]string{
+		ServiceAnnotationLoadBalancerInternal + "=true",
+		ServiceAnnotationLoadBalancerAdditionalTags + " = team=platform,env=prod",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		ServiceAnnotationLoadBalancerInternal:       "true",
+		ServiceAnnotationLoadBalancerAdditionalTags: "team=platform,env=prod",
+	}, defaults)
+
+	for _, invalid := range [][]string{
+		{ServiceAnnotationLoadBalancerInternal},
+		{"example.com/internal=true"},
+		{ServiceAnnotationLoadBalancerName + "=shared"},
+		{ServiceAnnotationLoadBalancerConnectionIdleTimeout + "=forever"},
+	} {
+		_, err = parseLoadBalancerDefaults(invalid)
+		assert.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestLoadBalancerAnnotationsDefaults(t *testing.T) {
+	cfg := CloudConfig{}
+	cfg.LoadBalancerDefaults.Annotation = []string{
+		ServiceAnnotationLoadBalancerInternal + "=true",
+		ServiceAnnotationLoadBalancerProfile + "=websocket",
+		ServiceAnnotationLoadBalancerConnectionIdleTimeout + "=120",
+		ServiceAnnotationLoadBalancerBEProtocol + "=http",
+	}
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(cfg, awsServices)
+	assert.NoError(t, err)
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:        "web",
+		Annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "false"},
+	}}
+	annotations := c.loadBalancerAnnotations(service)
+	assert.Equal(t, "false", annotations[ServiceAnnotationLoadBalancerInternal], "the service takes precedence")
+	assert.Equal(t, "3600", annotations[ServiceAnnotationLoadBalancerConnectionIdleTimeout], "the profile takes precedence")
+	assert.Equal(t, "tcp", annotations[ServiceAnnotationLoadBalancerBEProtocol])
+
+	defaulted := c.withLoadBalancerDefaults(service)
+	assert.Equal(t, annotations, defaulted.Annotations)
+	assert.Len(t, service.Annotations, 1, "the service is left unchanged")
+
+	c.loadBalancerDefaults = nil
+	assert.Same(t, service, c.withLoadBalancerDefaults(service))
+}
+
+func TestLoadBalancerAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaults    []string
+		annotations map[string]string
+		expected    map[string]string
+	}{
+		{
+			name:        "no profile, no defaults",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "true"},
+			expected:    map[string]string{ServiceAnnotationLoadBalancerInternal: "true"},
+		},
+		{
+			name:        "profile, no defaults",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerProfile: "websocket"},
+			expected: map[string]string{
+				ServiceAnnotationLoadBalancerProfile:               "websocket",
+				ServiceAnnotationLoadBalancerBEProtocol:            "tcp",
+				ServiceAnnotationLoadBalancerConnectionIdleTimeout: "3600",
+			},
+		},
+		{
+			name:        "no profile, defaults",
+			defaults:    []string{ServiceAnnotationLoadBalancerConnectionIdleTimeout + "=120"},
+			annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "true"},
+			expected: map[string]string{
+				ServiceAnnotationLoadBalancerInternal:              "true",
+				ServiceAnnotationLoadBalancerConnectionIdleTimeout: "120",
+			},
+		},
+		{
+			name:     "profile, defaults",
+			defaults: []string{ServiceAnnotationLoadBalancerConnectionIdleTimeout + "=120"},
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerProfile:    "websocket",
+				ServiceAnnotationLoadBalancerBEProtocol: "http",
+			},
+			expected: map[string]string{
+				ServiceAnnotationLoadBalancerProfile:               "websocket",
+				ServiceAnnotationLoadBalancerBEProtocol:            "http",
+				ServiceAnnotationLoadBalancerConnectionIdleTimeout: "3600",
+			},
+		},
+		{
+			name:        "invalid profile",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerProfile: "unknown"},
+			expected:    map[string]string{ServiceAnnotationLoadBalancerProfile: "unknown"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := CloudConfig{}
+			cfg.LoadBalancerDefaults.Annotation = test.defaults
+			c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+			assert.NoError(t, err)
+
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Annotations: test.annotations}}
+			assert.Equal(t, test.expected, c.loadBalancerAnnotations(service))
+		})
+	}
+}
+
+func TestReadLoadBalancerDefaults(t *testing.T) {
+	cfg, err := readCloudConfig(strings.NewReader(`
+[LoadBalancerDefaults]
+Annotation = service.beta.kubernetes.io/aws-load-balancer-internal=true
+Annotation = "service.beta.kubernetes.io/aws-load-balancer-additional-resource-tags=team=platform"
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		ServiceAnnotationLoadBalancerInternal + "=true",
+		ServiceAnnotationLoadBalancerAdditionalTags + "=team=platform",
+	}, cfg.LoadBalancerDefaults.Annotation)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Draining On Delete *********************
+
+// maxDrainOnDeleteSeconds is the maximum connection draining timeout supported by LBU
+const maxDrainOnDeleteSeconds = 3600
+
+// loadBalancerDraining tracks the load balancers draining their connections before
+// deletion. EnsureLoadBalancerDeleted returns an error while the draining period is
+// not over, so that the deletion is retried instead of blocking a worker.
+type loadBalancerDraining struct {
+	mutex      sync.Mutex
+	started    map[string]time.Time
+	timeSource func() time.Time
+}
+
+func newLoadBalancerDraining() *loadBalancerDraining {
+	return &loadBalancerDraining{
+		started:    make(map[string]time.Time),
+		timeSource: time.Now,
+	}
+}
+
+// start records the beginning of the draining period, and returns false when it was
+// already started
+func (d *loadBalancerDraining) start(loadBalancerName string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, found := d.started[loadBalancerName]; found {
+		return false
+	}
+	d.started[loadBalancerName] = d.timeSource()
+	return true
+}
+
+// remaining returns the remaining draining time of the load balancer, and forgets
+// the load balancer once the period is over
+func (d *loadBalancerDraining) remaining(loadBalancerName string, period time.Duration) time.Duration {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	started, found := d.started[loadBalancerName]
+	if !found {
+		return period
+	}
+	left := started.Add(period).Sub(d.timeSource())
+	if left <= 0 {
+		delete(d.started, loadBalancerName)
+		return 0
+	}
+	return left
+}
+
+// forget drops the draining state of the load balancer
+func (d *loadBalancerDraining) forget(loadBalancerName string) {
+	if d == nil {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.started, loadBalancerName)
+}
+
+// parseDrainOnDeletePeriod parses the value of the ServiceAnnotationLoadBalancerDrainOnDelete
+// annotation
+func parseDrainOnDeletePeriod(value string) (time.Duration, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 1 || seconds > maxDrainOnDeleteSeconds {
+		return 0, fmt.Errorf("error parsing service annotation: %s=%s, expected seconds between 1 and %d",
+			ServiceAnnotationLoadBalancerDrainOnDelete, value, maxDrainOnDeleteSeconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// getDrainOnDeletePeriod returns the draining period requested on the service, or 0. An
+// invalid annotation does not block the deletion of the load balancer: it is logged and
+// the load balancer is deleted without draining.
+func getDrainOnDeletePeriod(service *v1.Service) time.Duration {
+	value, found := service.Annotations[ServiceAnnotationLoadBalancerDrainOnDelete]
+	if !found {
+		return 0
+	}
+	period, err := parseDrainOnDeletePeriod(value)
+	if err != nil {
+		klog.Warningf("Deleting the load balancer of service %s/%s without draining: %v", service.Namespace, service.Name, err)
+		return 0
+	}
+	return period
+}
+
+// drainLoadBalancer deregisters the backends of the load balancer with connection draining
+// enabled, and returns an error until the draining period requested on the service is over
+func (c *Cloud) drainLoadBalancer(service *v1.Service, lb *elb.LoadBalancerDescription) error {
+	klog.V(5).Infof("drainLoadBalancer(%v, %v)", service, lb)
+	if c.draining == nil {
+		return nil
+	}
+	period := getDrainOnDeletePeriod(service)
+	if period == 0 {
+		return nil
+	}
+	loadBalancerName := aws.StringValue(lb.LoadBalancerName)
+
+	// Connection draining must be enabled before the deregistration for LBU to keep
+	// serving the in-flight requests
+	describeAttributesOutput, err := c.loadBalancer.DescribeLoadBalancerAttributes(&elb.DescribeLoadBalancerAttributesInput{
+		LoadBalancerName: lb.LoadBalancerName,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve attributes of load balancer %s: %q", loadBalancerName, err)
+	}
+	timeout := int64(period / time.Second)
+	draining := describeAttributesOutput.LoadBalancerAttributes.ConnectionDraining
+	if draining == nil || !aws.BoolValue(draining.Enabled) || aws.Int64Value(draining.Timeout) < timeout {
+		klog.V(2).Infof("Enabling connection draining of %ds on load balancer %s", timeout, loadBalancerName)
+		_, err = c.loadBalancer.ModifyLoadBalancerAttributes(&elb.ModifyLoadBalancerAttributesInput{
+			LoadBalancerName: lb.LoadBalancerName,
+			LoadBalancerAttributes: &elb.LoadBalancerAttributes{
+				ConnectionDraining: &elb.ConnectionDraining{Enabled: aws.Bool(true), Timeout: aws.Int64(timeout)},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to enable connection draining on load balancer %s: %q", loadBalancerName, err)
+		}
+	}
+
+	if len(lb.Instances) > 0 {
+		err = c.ensureLoadBalancerInstances(service, loadBalancerName, lb.Instances, map[InstanceID]*osc.Vm{})
+		if err != nil {
+			return fmt.Errorf("unable to deregister the backends of load balancer %s: %q", loadBalancerName, err)
+		}
+	}
+
+	if c.draining.start(loadBalancerName) {
+		klog.Infof("Draining the connections of load balancer %s for %v before deletion", loadBalancerName, period)
+		if c.eventRecorder != nil {
+			c.eventRecorder.Eventf(service, v1.EventTypeNormal, "DrainingLoadBalancer",
+				"Draining the connections of load balancer %s for %v before deletion", loadBalancerName, period)
+		}
+	}
+	if left := c.draining.remaining(loadBalancerName, period); left > 0 {
+		return fmt.Errorf("connections of load balancer %s are draining, deletion in %v", loadBalancerName, left.Round(time.Second))
+	}
+	return nil
+}
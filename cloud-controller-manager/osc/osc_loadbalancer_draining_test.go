@@ -0,0 +1,83 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetDrainOnDeletePeriod(t *testing.T) {
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	assert.Equal(t, time.Duration(0), getDrainOnDeletePeriod(service))
+
+	service.Annotations[ServiceAnnotationLoadBalancerDrainOnDelete] = "30"
+	assert.Equal(t, 30*time.Second, getDrainOnDeletePeriod(service))
+
+	// An invalid annotation falls back to no draining, the error being reported by the parsing
+	for _, value := range []string{"0", "3601", "abc"} {
+		service.Annotations[ServiceAnnotationLoadBalancerDrainOnDelete] = value
+		assert.Equal(t, time.Duration(0), getDrainOnDeletePeriod(service), value)
+		_, err := parseDrainOnDeletePeriod(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestDrainLoadBalancer(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	fakeELB := awsServices.elb.(*FakeELB)
+
+	now := time.Now()
+	c.draining.timeSource = func() time.Time { return now }
+
+	lb := &elb.LoadBalancerDescription{
+		LoadBalancerName: aws.String("lb-drain"),
+		Instances:        []*elb.Instance{{InstanceId: aws.String("i-a")}, {InstanceId: aws.String("i-b")}},
+	}
+	fakeELB.LoadBalancers = map[string]*elb.LoadBalancerDescription{"lb-drain": lb}
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:        "myservice",
+		Annotations: map[string]string{ServiceAnnotationLoadBalancerDrainOnDelete: "60"},
+	}}
+
+	err = c.drainLoadBalancer(service, lb)
+	assert.ErrorContains(t, err, "are draining")
+	assert.Empty(t, lb.Instances)
+	attributes := fakeELB.ModifiedAttributes["lb-drain"]
+	if assert.NotNil(t, attributes) {
+		assert.True(t, aws.BoolValue(attributes.ConnectionDraining.Enabled))
+		assert.Equal(t, int64(60), aws.Int64Value(attributes.ConnectionDraining.Timeout))
+	}
+
+	now = now.Add(30 * time.Second)
+	assert.ErrorContains(t, c.drainLoadBalancer(service, lb), "deletion in 30s")
+
+	now = now.Add(31 * time.Second)
+	assert.NoError(t, c.drainLoadBalancer(service, lb))
+
+	delete(service.Annotations, ServiceAnnotationLoadBalancerDrainOnDelete)
+	assert.NoError(t, c.drainLoadBalancer(service, lb))
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Drift *********************
+
+// EventLoadBalancerDriftDetected is recorded on a service when its load balancer was modified
+// out of band, e.g. from the console or by Terraform
+const EventLoadBalancerDriftDetected = "LoadBalancerDriftDetected"
+
+// loadBalancerDriftDetector periodically compares the load balancers and security groups of
+// the services with the state derived from the services, and triggers the reconciliation of
+// the services whose resources were modified out of band. The service controller only
+// reconciles a service when it changes, so the reconciliation is triggered by setting the
+// ServiceAnnotationLoadBalancerDriftDetected annotation to the time of the detection.
+type loadBalancerDriftDetector struct {
+	cloud    *Cloud
+	interval time.Duration
+
+	mutex sync.Mutex
+	// Last drift reported by service, to record an event only when the drift changes
+	reported map[types.NamespacedName]string
+}
+
+func newLoadBalancerDriftDetector(cloud *Cloud, interval time.Duration) *loadBalancerDriftDetector {
+	return &loadBalancerDriftDetector{
+		cloud:    cloud,
+		interval: interval,
+		reported: make(map[types.NamespacedName]string),
+	}
+}
+
+// run detects the drift of the load balancers every interval until stop is closed
+func (d *loadBalancerDriftDetector) run(stop <-chan struct{}) {
+	if d == nil || d.interval <= 0 {
+		return
+	}
+
+	klog.Infof("Starting load balancer drift detection (interval %v)", d.interval)
+	go wait.Until(d.sync, d.interval, stop)
+}
+
+// sync detects the drift of the load balancers of the services and triggers their reconciliation
+func (d *loadBalancerDriftDetector) sync() {
+	c := d.cloud
+	if c.kubeClient == nil {
+		return
+	}
+
+	services, err := c.kubeClient.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		klog.Warningf("Unable to list services for the drift detection: %q", err)
+		return
+	}
+
+	current := map[types.NamespacedName]string{}
+	for i := range services.Items {
+		service := &services.Items[i]
+		if !d.isChecked(service) {
+			continue
+		}
+		serviceName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+		drift, err := d.detect(service)
+		if err != nil {
+			klog.Warningf("Unable to detect the drift of the load balancer of service %v: %v", serviceName, err)
+			continue
+		}
+		if len(drift) == 0 {
+			continue
+		}
+		message := strings.Join(drift, ", ")
+		current[serviceName] = message
+		if err := d.trigger(service, message); err != nil {
+			klog.Warningf("Unable to trigger the reconciliation of service %v: %v", serviceName, err)
+		}
+	}
+
+	d.mutex.Lock()
+	d.reported = current
+	d.mutex.Unlock()
+}
+
+// isChecked returns whether the load balancer of the service is checked: the services of
+// type LoadBalancer reconciled by the cloud provider, whose load balancer was provisioned
+func (d *loadBalancerDriftDetector) isChecked(service *v1.Service) bool {
+	c := d.cloud
+	if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil ||
+		!c.managesLoadBalancerClass(service) || len(service.Status.LoadBalancer.Ingress) == 0 {
+		return false
+	}
+	// The load balancers in dry run are not reconciled
+	dryRun, err := c.isLoadBalancerDryRun(c.loadBalancerAnnotations(service))
+	return err == nil && !dryRun
+}
+
+// detect returns the differences between the load balancer of the service and the state
+// derived from the service, empty when they match
+func (d *loadBalancerDriftDetector) detect(service *v1.Service) ([]string, error) {
+	c := d.cloud
+	loadBalancerName := c.GetLoadBalancerName(context.TODO(), "", service)
+	loadBalancer, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	if loadBalancer == nil {
+		return []string{fmt.Sprintf("load balancer %s is missing", loadBalancerName)}, nil
+	}
+	return d.compare(service, loadBalancer)
+}
+
+// compare returns the differences between the described load balancer of the service and
+// the state derived from the service, empty when they match
+func (d *loadBalancerDriftDetector) compare(service *v1.Service, loadBalancer *elb.LoadBalancerDescription) ([]string, error) {
+	c := d.cloud
+	annotations := c.loadBalancerAnnotations(service)
+	extraListeners, err := parseExtraListeners(annotations[ServiceAnnotationLoadBalancerExtraListeners])
+	if err != nil {
+		return nil, err
+	}
+	desired := sets.NewInt64()
+	for _, port := range service.Spec.Ports {
+		desired.Insert(int64(port.Port))
+	}
+	for _, extraListener := range extraListeners {
+		for _, listener := range extraListener.listeners() {
+			desired.Insert(aws.Int64Value(listener.LoadBalancerPort))
+		}
+	}
+	actual := sets.NewInt64()
+	for _, listenerDescription := range loadBalancer.ListenerDescriptions {
+		if listenerDescription.Listener != nil {
+			actual.Insert(aws.Int64Value(listenerDescription.Listener.LoadBalancerPort))
+		}
+	}
+
+	drift := []string{}
+	for _, port := range desired.Difference(actual).List() {
+		drift = append(drift, fmt.Sprintf("listener %d is missing", port))
+	}
+	for _, port := range actual.Difference(desired).List() {
+		drift = append(drift, fmt.Sprintf("unexpected listener %d", port))
+	}
+
+	mode, err := c.securityGroupMode(annotations)
+	if err != nil {
+		return nil, err
+	}
+	if mode == securityGroupModeNone || c.cfg.Global.DisableSecurityGroupIngress {
+		return drift, nil
+	}
+	closed, err := d.closedPorts(loadBalancer, desired.Intersection(actual))
+	if err != nil {
+		return nil, err
+	}
+	return append(drift, closed...), nil
+}
+
+// closedPorts returns the ports of the listeners which are not open in the security groups
+// of the load balancer owned by the cluster
+func (d *loadBalancerDriftDetector) closedPorts(loadBalancer *elb.LoadBalancerDescription, ports sets.Int64) ([]string, error) {
+	c := d.cloud
+	if len(loadBalancer.SecurityGroups) == 0 || ports.Len() == 0 {
+		return nil, nil
+	}
+	groupIDs := aws.StringValueSlice(loadBalancer.SecurityGroups)
+	groups, err := c.compute.ReadSecurityGroups(&osc.ReadSecurityGroupsRequest{
+		Filters: &osc.FiltersSecurityGroup{SecurityGroupIds: &groupIDs},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying the security groups of load balancer %s: %q",
+			aws.StringValue(loadBalancer.LoadBalancerName), err)
+	}
+
+	closed := []string{}
+	for _, group := range groups {
+		if !c.tagging.hasClusterTag(group.Tags) {
+			continue
+		}
+		for _, port := range ports.List() {
+			if !isPortOpen(group.GetInboundRules(), port) {
+				closed = append(closed, fmt.Sprintf("port %d is not open in security group %s", port, group.GetSecurityGroupId()))
+			}
+		}
+	}
+	sort.Strings(closed)
+	return closed, nil
+}
+
+// isPortOpen returns whether one of the inbound rules opens the TCP port
+func isPortOpen(rules []osc.SecurityGroupRule, port int64) bool {
+	for _, rule := range rules {
+		if rule.GetIpProtocol() == "-1" {
+			return true
+		}
+		if rule.GetIpProtocol() == "tcp" && int64(rule.GetFromPortRange()) <= port && port <= int64(rule.GetToPortRange()) {
+			return true
+		}
+	}
+	return false
+}
+
+// trigger records the drift on the service, when it changed since the last detection, and
+// triggers the reconciliation of the service
+func (d *loadBalancerDriftDetector) trigger(service *v1.Service, message string) error {
+	c := d.cloud
+	serviceName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	d.mutex.Lock()
+	reported := d.reported[serviceName] == message
+	d.mutex.Unlock()
+	if !reported {
+		klog.Infof("Load balancer of service %v modified out of band: %s", serviceName, message)
+		if c.eventRecorder != nil {
+			c.eventRecorder.Eventf(service, v1.EventTypeWarning, EventLoadBalancerDriftDetected,
+				"Load balancer modified out of band, reconciling it: %s", message)
+		}
+	} else {
+		klog.V(2).Infof("Load balancer of service %v still modified out of band: %s", serviceName, message)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				ServiceAnnotationLoadBalancerDriftDetected: time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.kubeClient.CoreV1().Services(service.Namespace).Patch(context.TODO(), service.Name,
+		types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestLoadBalancerDriftDetector(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Annotations: map[string]string{ServiceAnnotationLoadBalancerName: "lb-web"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Port: 80, NodePort: 30080}, {Port: 443, NodePort: 30443}},
+		},
+		Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{
+			Ingress: []v1.LoadBalancerIngress{{Hostname: "lb-web.example.com"}},
+		}},
+	}
+	pending := service.DeepCopy()
+	pending.Name = "pending"
+	pending.Status = v1.ServiceStatus{}
+	client := fake.NewSimpleClientset(service, pending)
+	c.kubeClient = client
+
+	listener := func(port int64) *elb.ListenerDescription {
+		return &elb.ListenerDescription{Listener: &elb.Listener{LoadBalancerPort: aws.Int64(port), Protocol: aws.String("TCP")}}
+	}
+	loadBalancer := &elb.LoadBalancerDescription{
+		LoadBalancerName:     aws.String("lb-web"),
+		ListenerDescriptions: []*elb.ListenerDescription{listener(80), listener(443)},
+		SecurityGroups:       aws.StringSlice([]string{"sg-web"}),
+	}
+	awsServices.elb.(*FakeELB).LoadBalancers = map[string]*elb.LoadBalancerDescription{"lb-web": loadBalancer}
+	compute := awsServices.compute.(*FakeComputeImpl)
+	compute.SecurityGroups = []osc.SecurityGroup{{
+		SecurityGroupId: aws.String("sg-web"),
+		Tags:            &[]osc.ResourceTag{{Key: fmt.Sprintf("%s%s", TagNameKubernetesClusterPrefix, TestClusterID), Value: ResourceLifecycleOwned}},
+		InboundRules: &[]osc.SecurityGroupRule{
+			{IpProtocol: aws.String("tcp"), FromPortRange: aws.Int32(80), ToPortRange: aws.Int32(80)},
+			{IpProtocol: aws.String("tcp"), FromPortRange: aws.Int32(443), ToPortRange: aws.Int32(443)},
+		},
+	}}
+	detector := newLoadBalancerDriftDetector(c, time.Minute)
+	driftDetected := func() string {
+		current, err := client.CoreV1().Services("default").Get(context.TODO(), "web", metav1.GetOptions{})
+		require.NoError(t, err)
+		return current.Annotations[ServiceAnnotationLoadBalancerDriftDetected]
+	}
+
+	// The load balancer matches the service
+	drift, err := detector.detect(service)
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+	detector.sync()
+	assert.Equal(t, "", driftDetected())
+	assert.Len(t, recorder.Events, 0)
+
+	// Out of band changes
+	loadBalancer.ListenerDescriptions = []*elb.ListenerDescription{listener(80), listener(8080)}
+	(*compute.SecurityGroups[0].InboundRules)[0].FromPortRange = aws.Int32(81)
+	drift, err = detector.detect(service)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"listener 443 is missing", "unexpected listener 8080", "port 80 is not open in security group sg-web"}, drift)
+
+	// The reconciliation is triggered, the event is only recorded when the drift changes
+	detector.sync()
+	assert.NotEqual(t, "", driftDetected())
+	assert.Len(t, recorder.Events, 1)
+	detector.sync()
+	assert.Len(t, recorder.Events, 1)
+
+	delete(awsServices.elb.(*FakeELB).LoadBalancers, "lb-web")
+	drift, err = detector.detect(service)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"load balancer lb-web is missing"}, drift)
+}
+
+func TestIsPortOpen(t *testing.T) {
+	rules := []osc.SecurityGroupRule{
+		{IpProtocol: aws.String("tcp"), FromPortRange: aws.Int32(8000), ToPortRange: aws.Int32(8100)},
+		{IpProtocol: aws.String("udp"), FromPortRange: aws.Int32(53), ToPortRange: aws.Int32(53)},
+	}
+	assert.True(t, isPortOpen(rules, 8080))
+	assert.False(t, isPortOpen(rules, 53))
+	assert.False(t, isPortOpen(rules, 80))
+	assert.True(t, isPortOpen([]osc.SecurityGroupRule{{IpProtocol: aws.String("-1")}}, 80))
+}
@@ -0,0 +1,528 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Dry Run *********************
+
+// In dry run, the load balancer is reconciled by a planning copy of the cloud whose clients
+// record the mutations instead of executing them. The reads still reach the APIs, except for
+// the resources that would have been created, which are answered from the plan.
+
+// isLoadBalancerDryRun returns whether the load balancer of the service is only planned: the
+// ServiceAnnotationLoadBalancerDryRun annotation, or else LoadBalancerDryRun of the cloud config
+func (c *Cloud) isLoadBalancerDryRun(annotations map[string]string) (bool, error) {
+	if c.plan != nil {
+		return false, nil
+	}
+	if value, found := annotations[ServiceAnnotationLoadBalancerDryRun]; found {
+		return parseLoadBalancerDryRun(value)
+	}
+	return c.cfg.Global.LoadBalancerDryRun, nil
+}
+
+// parseLoadBalancerDryRun parses the ServiceAnnotationLoadBalancerDryRun annotation
+func parseLoadBalancerDryRun(value string) (bool, error) {
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("error parsing service annotation: %s=%s, expected true or false",
+			ServiceAnnotationLoadBalancerDryRun, value)
+	}
+	return dryRun, nil
+}
+
+// loadBalancerPlan records the API mutations of a dry run
+type loadBalancerPlan struct {
+	mutex sync.Mutex
+	steps []string
+
+	// Resources that would have been created
+	loadBalancers  map[string]*elb.LoadBalancerDescription
+	securityGroups map[string]osc.SecurityGroup
+	publicIPs      int
+}
+
+func newLoadBalancerPlan() *loadBalancerPlan {
+	return &loadBalancerPlan{
+		loadBalancers:  map[string]*elb.LoadBalancerDescription{},
+		securityGroups: map[string]osc.SecurityGroup{},
+	}
+}
+
+// record adds the call to the plan
+func (p *loadBalancerPlan) record(action string, input interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	step := action
+	if encoded, err := json.Marshal(input); err == nil {
+		step += " " + string(encoded)
+	}
+	p.steps = append(p.steps, step)
+}
+
+// actions returns the names of the API calls of the plan, in order
+func (p *loadBalancerPlan) actions() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	actions := make([]string, 0, len(p.steps))
+	for _, step := range p.steps {
+		action, _, _ := strings.Cut(step, " ")
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// plannedLoadBalancer returns the load balancer that would have been created
+func (p *loadBalancerPlan) plannedLoadBalancer(name string) *elb.LoadBalancerDescription {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.loadBalancers[name]
+}
+
+// report logs the steps of the plan and summarizes them in a DryRun event of the service
+func (p *loadBalancerPlan) report(c *Cloud, service *v1.Service, loadBalancerName string) {
+	p.mutex.Lock()
+	steps := append([]string{}, p.steps...)
+	p.mutex.Unlock()
+
+	for i, step := range steps {
+		klog.Infof("Dry run of load balancer %s (%s/%s), step %d/%d: %s", loadBalancerName,
+			service.Namespace, service.Name, i+1, len(steps), step)
+	}
+	message := fmt.Sprintf("Dry run of load balancer %s: no change", loadBalancerName)
+	if len(steps) > 0 {
+		message = fmt.Sprintf("Dry run of load balancer %s: %d changes (%s), see the logs of the cloud controller manager",
+			loadBalancerName, len(steps), strings.Join(p.actions(), ", "))
+	}
+	klog.Info(message)
+	if c.eventRecorder != nil {
+		c.eventRecorder.Event(service, v1.EventTypeNormal, "DryRun", message)
+	}
+}
+
+// newPlanningCloud returns a copy of the cloud recording its mutations in the plan. The
+// controllers and the caches tracking the load balancers are left out of the copy.
+func (c *Cloud) newPlanningCloud(plan *loadBalancerPlan) *Cloud {
+	planner := &Cloud{
+		compute:      &planCompute{Compute: c.compute, plan: plan},
+		loadBalancer: &planLoadBalancer{LoadBalancer: c.loadBalancer, plan: plan},
+		metadata:     c.metadata,
+		cfg:          c.cfg,
+		region:       c.region,
+		cloudNetwork: c.cloudNetwork,
+		instances:    c.instances,
+		tagging:      c.tagging,
+
+		selfAWSInstance:     c.selfAWSInstance,
+		nodeIPFamilies:      c.nodeIPFamilies,
+		nodeAddressPriority: c.nodeAddressPriority,
+		nodePortNic:         c.nodePortNic,
+		routeTables:         c.routeTables,
+		backendGate:         c.backendGate,
+
+		allowedOwnerClusterIDs:   c.allowedOwnerClusterIDs,
+		loadBalancerNameTemplate: c.loadBalancerNameTemplate,
+		kubeClient:               c.kubeClient,
+		plan:                     plan,
+	}
+	if c.accessLogBuckets != nil {
+		planner.accessLogBuckets = newAccessLogBuckets(
+			&planObjectStorage{ObjectStorage: c.accessLogBuckets.storage, plan: plan}, c.accessLogBuckets.create)
+	}
+	planner.instanceCache.cloud = planner
+	planner.initServices()
+	return planner
+}
+
+// planEnsureLoadBalancer reports the changes EnsureLoadBalancer would make to the load
+// balancer of the service, and returns its current status
+func (c *Cloud) planEnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service,
+	nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	klog.V(5).Infof("planEnsureLoadBalancer(%v, %v, %v)", clusterName, service, nodes)
+	plan := newLoadBalancerPlan()
+	loadBalancerName := c.GetLoadBalancerName(ctx, clusterName, service)
+	if _, err := c.newPlanningCloud(plan).EnsureLoadBalancer(ctx, clusterName, service, nodes); err != nil {
+		return nil, fmt.Errorf("dry run of load balancer %s failed: %v", loadBalancerName, err)
+	}
+	plan.report(c, service, loadBalancerName)
+
+	status, _, err := c.GetLoadBalancer(ctx, clusterName, service)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		status = &v1.LoadBalancerStatus{}
+	}
+	return status, nil
+}
+
+// planUpdateLoadBalancerHosts reports the changes updateLoadBalancerHosts would make to the
+// load balancer of the service
+func (c *Cloud) planUpdateLoadBalancerHosts(loadBalancerName string, service *v1.Service, annotations map[string]string,
+	nodes []*v1.Node) error {
+	klog.V(5).Infof("planUpdateLoadBalancerHosts(%v, %v, %v)", loadBalancerName, service, nodes)
+	lb, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
+	if err != nil {
+		return err
+	}
+	if lb == nil {
+		klog.V(2).Infof("Dry run of load balancer %s: not created, no backends to update", loadBalancerName)
+		return nil
+	}
+
+	plan := newLoadBalancerPlan()
+	if err := c.newPlanningCloud(plan).updateLoadBalancerHosts(loadBalancerName, service, annotations, nodes); err != nil {
+		return fmt.Errorf("dry run of load balancer %s failed: %v", loadBalancerName, err)
+	}
+	plan.report(c, service, loadBalancerName)
+	return nil
+}
+
+// planCompute records the oAPI mutations in the plan
+type planCompute struct {
+	Compute
+	plan *loadBalancerPlan
+}
+
+func (p *planCompute) ReadSecurityGroups(request *osc.ReadSecurityGroupsRequest) ([]osc.SecurityGroup, error) {
+	filters := request.GetFilters()
+	if filters.SecurityGroupIds == nil {
+		return p.Compute.ReadSecurityGroups(request)
+	}
+
+	p.plan.mutex.Lock()
+	planned := []osc.SecurityGroup{}
+	existing := []string{}
+	for _, id := range filters.GetSecurityGroupIds() {
+		if group, found := p.plan.securityGroups[id]; found {
+			planned = append(planned, group)
+		} else {
+			existing = append(existing, id)
+		}
+	}
+	p.plan.mutex.Unlock()
+	if len(existing) == 0 {
+		return planned, nil
+	}
+
+	filters.SetSecurityGroupIds(existing)
+	groups, err := p.Compute.ReadSecurityGroups(&osc.ReadSecurityGroupsRequest{Filters: &filters})
+	if err != nil {
+		return nil, err
+	}
+	return append(groups, planned...), nil
+}
+
+func (p *planCompute) CreateSecurityGroup(request *osc.CreateSecurityGroupRequest) (*osc.CreateSecurityGroupResponse, error) {
+	p.plan.record("CreateSecurityGroup", request)
+	p.plan.mutex.Lock()
+	defer p.plan.mutex.Unlock()
+	group := osc.SecurityGroup{
+		SecurityGroupId:   aws.String(fmt.Sprintf("sg-dry-run-%d", len(p.plan.securityGroups)+1)),
+		SecurityGroupName: aws.String(request.GetSecurityGroupName()),
+		Description:       aws.String(request.GetDescription()),
+		NetId:             request.NetId,
+		InboundRules:      &[]osc.SecurityGroupRule{},
+		OutboundRules:     &[]osc.SecurityGroupRule{},
+		Tags:              &[]osc.ResourceTag{},
+	}
+	p.plan.securityGroups[group.GetSecurityGroupId()] = group
+	return &osc.CreateSecurityGroupResponse{SecurityGroup: &group}, nil
+}
+
+func (p *planCompute) DeleteSecurityGroup(request *osc.DeleteSecurityGroupRequest) (*osc.DeleteSecurityGroupResponse, error) {
+	p.plan.record("DeleteSecurityGroup", request)
+	return &osc.DeleteSecurityGroupResponse{}, nil
+}
+
+func (p *planCompute) CreateSecurityGroupRule(request *osc.CreateSecurityGroupRuleRequest) (*osc.CreateSecurityGroupRuleResponse, error) {
+	p.plan.record("CreateSecurityGroupRule", request)
+	return &osc.CreateSecurityGroupRuleResponse{}, nil
+}
+
+func (p *planCompute) DeleteSecurityGroupRule(request *osc.DeleteSecurityGroupRuleRequest) (*osc.DeleteSecurityGroupRuleResponse, error) {
+	p.plan.record("DeleteSecurityGroupRule", request)
+	return &osc.DeleteSecurityGroupRuleResponse{}, nil
+}
+
+func (p *planCompute) CreateTags(request *osc.CreateTagsRequest) (*osc.CreateTagsResponse, error) {
+	p.plan.record("CreateTags", request)
+	return &osc.CreateTagsResponse{}, nil
+}
+
+func (p *planCompute) DeleteTags(request *osc.DeleteTagsRequest) (*osc.DeleteTagsResponse, error) {
+	p.plan.record("DeleteTags", request)
+	return &osc.DeleteTagsResponse{}, nil
+}
+
+func (p *planCompute) CreateRoute(request *osc.CreateRouteRequest) (*osc.CreateRouteResponse, error) {
+	p.plan.record("CreateRoute", request)
+	return &osc.CreateRouteResponse{}, nil
+}
+
+func (p *planCompute) DeleteRoute(request *osc.DeleteRouteRequest) (*osc.DeleteRouteResponse, error) {
+	p.plan.record("DeleteRoute", request)
+	return &osc.DeleteRouteResponse{}, nil
+}
+
+func (p *planCompute) UpdateVM(request *osc.UpdateVmRequest) (*osc.UpdateVmResponse, error) {
+	p.plan.record("UpdateVm", request)
+	return &osc.UpdateVmResponse{}, nil
+}
+
+func (p *planCompute) CreatePublicIp(request *osc.CreatePublicIpRequest) (*osc.CreatePublicIpResponse, error) {
+	p.plan.record("CreatePublicIp", request)
+	p.plan.mutex.Lock()
+	defer p.plan.mutex.Unlock()
+	p.plan.publicIPs++
+	return &osc.CreatePublicIpResponse{PublicIp: &osc.PublicIp{
+		PublicIpId: aws.String(fmt.Sprintf("eipalloc-dry-run-%d", p.plan.publicIPs)),
+		Tags:       &[]osc.ResourceTag{},
+	}}, nil
+}
+
+func (p *planCompute) DeletePublicIp(request *osc.DeletePublicIpRequest) (*osc.DeletePublicIpResponse, error) {
+	p.plan.record("DeletePublicIp", request)
+	return &osc.DeletePublicIpResponse{}, nil
+}
+
+func (p *planCompute) ReadLoadBalancers(request *osc.ReadLoadBalancersRequest) ([]osc.LoadBalancer, error) {
+	filters := request.GetFilters()
+	planned := []osc.LoadBalancer{}
+	existing := []string{}
+	for _, name := range filters.GetLoadBalancerNames() {
+		if p.plan.plannedLoadBalancer(name) != nil {
+			planned = append(planned, osc.LoadBalancer{LoadBalancerName: aws.String(name)})
+		} else {
+			existing = append(existing, name)
+		}
+	}
+	if len(planned) == 0 {
+		return p.Compute.ReadLoadBalancers(request)
+	}
+	if len(existing) == 0 {
+		return planned, nil
+	}
+
+	filters.SetLoadBalancerNames(existing)
+	loadBalancers, err := p.Compute.ReadLoadBalancers(&osc.ReadLoadBalancersRequest{Filters: &filters})
+	if err != nil {
+		return nil, err
+	}
+	return append(loadBalancers, planned...), nil
+}
+
+func (p *planCompute) UpdateLoadBalancer(request *osc.UpdateLoadBalancerRequest) (*osc.UpdateLoadBalancerResponse, error) {
+	p.plan.record("UpdateLoadBalancer", request)
+	return &osc.UpdateLoadBalancerResponse{}, nil
+}
+
+// planLoadBalancer records the LBU mutations in the plan
+type planLoadBalancer struct {
+	LoadBalancer
+	plan *loadBalancerPlan
+}
+
+func (p *planLoadBalancer) CreateLoadBalancer(input *elb.CreateLoadBalancerInput) (*elb.CreateLoadBalancerOutput, error) {
+	p.plan.record("CreateLoadBalancer", input)
+	lb := &elb.LoadBalancerDescription{
+		LoadBalancerName:  input.LoadBalancerName,
+		AvailabilityZones: input.AvailabilityZones,
+		Subnets:           input.Subnets,
+		SecurityGroups:    input.SecurityGroups,
+		Scheme:            input.Scheme,
+		HealthCheck:       &elb.HealthCheck{},
+	}
+	for _, listener := range input.Listeners {
+		lb.ListenerDescriptions = append(lb.ListenerDescriptions, &elb.ListenerDescription{Listener: listener})
+	}
+	p.plan.mutex.Lock()
+	defer p.plan.mutex.Unlock()
+	p.plan.loadBalancers[aws.StringValue(input.LoadBalancerName)] = lb
+	return &elb.CreateLoadBalancerOutput{}, nil
+}
+
+func (p *planLoadBalancer) DeleteLoadBalancer(input *elb.DeleteLoadBalancerInput) (*elb.DeleteLoadBalancerOutput, error) {
+	p.plan.record("DeleteLoadBalancer", input)
+	return &elb.DeleteLoadBalancerOutput{}, nil
+}
+
+func (p *planLoadBalancer) DescribeLoadBalancers(input *elb.DescribeLoadBalancersInput) (*elb.DescribeLoadBalancersOutput, error) {
+	output := &elb.DescribeLoadBalancersOutput{}
+	existing := []*string{}
+	for _, name := range input.LoadBalancerNames {
+		if lb := p.plan.plannedLoadBalancer(aws.StringValue(name)); lb != nil {
+			output.LoadBalancerDescriptions = append(output.LoadBalancerDescriptions, lb)
+		} else {
+			existing = append(existing, name)
+		}
+	}
+	if len(output.LoadBalancerDescriptions) == 0 {
+		return p.LoadBalancer.DescribeLoadBalancers(input)
+	}
+	if len(existing) == 0 {
+		return output, nil
+	}
+
+	response, err := p.LoadBalancer.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{LoadBalancerNames: existing})
+	if err != nil {
+		return nil, err
+	}
+	response.LoadBalancerDescriptions = append(response.LoadBalancerDescriptions, output.LoadBalancerDescriptions...)
+	return response, nil
+}
+
+func (p *planLoadBalancer) AddTags(input *elb.AddTagsInput) (*elb.AddTagsOutput, error) {
+	p.plan.record("AddTags", input)
+	return &elb.AddTagsOutput{}, nil
+}
+
+func (p *planLoadBalancer) RemoveTags(input *elb.RemoveTagsInput) (*elb.RemoveTagsOutput, error) {
+	p.plan.record("RemoveTags", input)
+	return &elb.RemoveTagsOutput{}, nil
+}
+
+func (p *planLoadBalancer) DescribeTags(input *elb.DescribeTagsInput) (*elb.DescribeTagsOutput, error) {
+	for _, name := range input.LoadBalancerNames {
+		if p.plan.plannedLoadBalancer(aws.StringValue(name)) != nil {
+			return &elb.DescribeTagsOutput{}, nil
+		}
+	}
+	return p.LoadBalancer.DescribeTags(input)
+}
+
+func (p *planLoadBalancer) RegisterInstancesWithLoadBalancer(input *elb.RegisterInstancesWithLoadBalancerInput) (*elb.RegisterInstancesWithLoadBalancerOutput, error) {
+	p.plan.record("RegisterInstancesWithLoadBalancer", input)
+	return &elb.RegisterInstancesWithLoadBalancerOutput{}, nil
+}
+
+func (p *planLoadBalancer) DeregisterInstancesFromLoadBalancer(input *elb.DeregisterInstancesFromLoadBalancerInput) (*elb.DeregisterInstancesFromLoadBalancerOutput, error) {
+	p.plan.record("DeregisterInstancesFromLoadBalancer", input)
+	return &elb.DeregisterInstancesFromLoadBalancerOutput{}, nil
+}
+
+func (p *planLoadBalancer) CreateLoadBalancerPolicy(input *elb.CreateLoadBalancerPolicyInput) (*elb.CreateLoadBalancerPolicyOutput, error) {
+	p.plan.record("CreateLoadBalancerPolicy", input)
+	return &elb.CreateLoadBalancerPolicyOutput{}, nil
+}
+
+func (p *planLoadBalancer) CreateLBCookieStickinessPolicy(input *elb.CreateLBCookieStickinessPolicyInput) (*elb.CreateLBCookieStickinessPolicyOutput, error) {
+	p.plan.record("CreateLBCookieStickinessPolicy", input)
+	return &elb.CreateLBCookieStickinessPolicyOutput{}, nil
+}
+
+func (p *planLoadBalancer) CreateAppCookieStickinessPolicy(input *elb.CreateAppCookieStickinessPolicyInput) (*elb.CreateAppCookieStickinessPolicyOutput, error) {
+	p.plan.record("CreateAppCookieStickinessPolicy", input)
+	return &elb.CreateAppCookieStickinessPolicyOutput{}, nil
+}
+
+func (p *planLoadBalancer) SetLoadBalancerPoliciesForBackendServer(input *elb.SetLoadBalancerPoliciesForBackendServerInput) (*elb.SetLoadBalancerPoliciesForBackendServerOutput, error) {
+	p.plan.record("SetLoadBalancerPoliciesForBackendServer", input)
+	return &elb.SetLoadBalancerPoliciesForBackendServerOutput{}, nil
+}
+
+func (p *planLoadBalancer) SetLoadBalancerPoliciesOfListener(input *elb.SetLoadBalancerPoliciesOfListenerInput) (*elb.SetLoadBalancerPoliciesOfListenerOutput, error) {
+	p.plan.record("SetLoadBalancerPoliciesOfListener", input)
+	return &elb.SetLoadBalancerPoliciesOfListenerOutput{}, nil
+}
+
+func (p *planLoadBalancer) DescribeLoadBalancerPolicies(input *elb.DescribeLoadBalancerPoliciesInput) (*elb.DescribeLoadBalancerPoliciesOutput, error) {
+	if p.plan.plannedLoadBalancer(aws.StringValue(input.LoadBalancerName)) != nil {
+		return &elb.DescribeLoadBalancerPoliciesOutput{}, nil
+	}
+	return p.LoadBalancer.DescribeLoadBalancerPolicies(input)
+}
+
+func (p *planLoadBalancer) DeleteLoadBalancerPolicy(input *elb.DeleteLoadBalancerPolicyInput) (*elb.DeleteLoadBalancerPolicyOutput, error) {
+	p.plan.record("DeleteLoadBalancerPolicy", input)
+	return &elb.DeleteLoadBalancerPolicyOutput{}, nil
+}
+
+func (p *planLoadBalancer) DetachLoadBalancerFromSubnets(input *elb.DetachLoadBalancerFromSubnetsInput) (*elb.DetachLoadBalancerFromSubnetsOutput, error) {
+	p.plan.record("DetachLoadBalancerFromSubnets", input)
+	return &elb.DetachLoadBalancerFromSubnetsOutput{}, nil
+}
+
+func (p *planLoadBalancer) AttachLoadBalancerToSubnets(input *elb.AttachLoadBalancerToSubnetsInput) (*elb.AttachLoadBalancerToSubnetsOutput, error) {
+	p.plan.record("AttachLoadBalancerToSubnets", input)
+	return &elb.AttachLoadBalancerToSubnetsOutput{}, nil
+}
+
+func (p *planLoadBalancer) CreateLoadBalancerListeners(input *elb.CreateLoadBalancerListenersInput) (*elb.CreateLoadBalancerListenersOutput, error) {
+	p.plan.record("CreateLoadBalancerListeners", input)
+	return &elb.CreateLoadBalancerListenersOutput{}, nil
+}
+
+func (p *planLoadBalancer) DeleteLoadBalancerListeners(input *elb.DeleteLoadBalancerListenersInput) (*elb.DeleteLoadBalancerListenersOutput, error) {
+	p.plan.record("DeleteLoadBalancerListeners", input)
+	return &elb.DeleteLoadBalancerListenersOutput{}, nil
+}
+
+func (p *planLoadBalancer) ApplySecurityGroupsToLoadBalancer(input *elb.ApplySecurityGroupsToLoadBalancerInput) (*elb.ApplySecurityGroupsToLoadBalancerOutput, error) {
+	p.plan.record("ApplySecurityGroupsToLoadBalancer", input)
+	return &elb.ApplySecurityGroupsToLoadBalancerOutput{}, nil
+}
+
+func (p *planLoadBalancer) ConfigureHealthCheck(input *elb.ConfigureHealthCheckInput) (*elb.ConfigureHealthCheckOutput, error) {
+	p.plan.record("ConfigureHealthCheck", input)
+	return &elb.ConfigureHealthCheckOutput{HealthCheck: input.HealthCheck}, nil
+}
+
+func (p *planLoadBalancer) DescribeLoadBalancerAttributes(input *elb.DescribeLoadBalancerAttributesInput) (*elb.DescribeLoadBalancerAttributesOutput, error) {
+	if p.plan.plannedLoadBalancer(aws.StringValue(input.LoadBalancerName)) != nil {
+		return &elb.DescribeLoadBalancerAttributesOutput{LoadBalancerAttributes: &elb.LoadBalancerAttributes{}}, nil
+	}
+	return p.LoadBalancer.DescribeLoadBalancerAttributes(input)
+}
+
+func (p *planLoadBalancer) ModifyLoadBalancerAttributes(input *elb.ModifyLoadBalancerAttributesInput) (*elb.ModifyLoadBalancerAttributesOutput, error) {
+	p.plan.record("ModifyLoadBalancerAttributes", input)
+	return &elb.ModifyLoadBalancerAttributesOutput{}, nil
+}
+
+func (p *planLoadBalancer) DescribeInstanceHealth(input *elb.DescribeInstanceHealthInput) (*elb.DescribeInstanceHealthOutput, error) {
+	if p.plan.plannedLoadBalancer(aws.StringValue(input.LoadBalancerName)) != nil {
+		return &elb.DescribeInstanceHealthOutput{}, nil
+	}
+	return p.LoadBalancer.DescribeInstanceHealth(input)
+}
+
+// planObjectStorage records the OOS mutations in the plan
+type planObjectStorage struct {
+	ObjectStorage
+	plan *loadBalancerPlan
+}
+
+func (p *planObjectStorage) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	p.plan.record("CreateBucket", input)
+	return &s3.CreateBucketOutput{}, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestIsLoadBalancerDryRun(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	dryRun, err := c.isLoadBalancerDryRun(nil)
+	assert.NoError(t, err)
+	assert.False(t, dryRun)
+
+	c.cfg.Global.LoadBalancerDryRun = true
+	dryRun, err = c.isLoadBalancerDryRun(nil)
+	assert.NoError(t, err)
+	assert.True(t, dryRun)
+
+	dryRun, err = c.isLoadBalancerDryRun(map[string]string{ServiceAnnotationLoadBalancerDryRun: "false"})
+	assert.NoError(t, err)
+	assert.False(t, dryRun, "the annotation overrides the cloud config")
+
+	_, err = c.isLoadBalancerDryRun(map[string]string{ServiceAnnotationLoadBalancerDryRun: "maybe"})
+	assert.Error(t, err)
+
+	dryRun, err = c.newPlanningCloud(newLoadBalancerPlan()).isLoadBalancerDryRun(nil)
+	assert.NoError(t, err)
+	assert.False(t, dryRun, "the planning cloud runs the reconciliation")
+}
+
+func TestEnsureLoadBalancerDryRun(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.vpcID = "vpc-123456"
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+	}) {
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "myservice",
+			UID:         "anuid",
+			Annotations: map[string]string{ServiceAnnotationLoadBalancerDryRun: "true"},
+		},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports:           []v1.ServicePort{{Port: 8383, TargetPort: intstr.FromInt(80), Protocol: "TCP", NodePort: 4040}},
+		},
+	}
+	fakeELB := awsServices.elb.(*FakeELB)
+
+	status, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.NoError(t, err)
+	assert.Equal(t, &v1.LoadBalancerStatus{}, status)
+	assert.Empty(t, fakeELB.LoadBalancers, "the load balancer is only planned")
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, "DryRun")
+		assert.Contains(t, event, "CreateLoadBalancer")
+	}
+
+	service.Annotations[ServiceAnnotationLoadBalancerDryRun] = "false"
+	status, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.NoError(t, err)
+	loadBalancerName := status.Ingress[0].Hostname
+	assert.Len(t, fakeELB.LoadBalancers, 1)
+	listeners := fakeELB.LoadBalancers[loadBalancerName].ListenerDescriptions
+
+	// The change of port is planned, the load balancer keeps its listeners
+	service.Annotations[ServiceAnnotationLoadBalancerDryRun] = "true"
+	service.Spec.Ports[0].Port = 8484
+	plannedStatus, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.NoError(t, err)
+	assert.Equal(t, status, plannedStatus)
+	assert.Equal(t, listeners, fakeELB.LoadBalancers[loadBalancerName].ListenerDescriptions)
+	for len(recorder.Events) > 1 {
+		<-recorder.Events
+	}
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, "CreateLoadBalancerListeners")
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Events *********************
+
+// Reasons of the events recorded on a service for the changes made to its load balancer
+const (
+	// EventCreatedLoadBalancer is recorded when the load balancer is created
+	EventCreatedLoadBalancer = "CreatedLoadBalancer"
+	// EventCreatedSecurityGroup is recorded when the security group of the load balancer is created
+	EventCreatedSecurityGroup = "CreatedSecurityGroup"
+	// EventUpdatedSecurityGroupRules is recorded when the ingress rules of the security group
+	// of the load balancer are changed
+	EventUpdatedSecurityGroupRules = "UpdatedSecurityGroupRules"
+	// EventUpdatedListeners is recorded when listeners are added to or removed from the load balancer
+	EventUpdatedListeners = "UpdatedListeners"
+	// EventUpdatedAttributes is recorded when the attributes of the load balancer are changed
+	EventUpdatedAttributes = "UpdatedLoadBalancerAttributes"
+	// EventRegisteredBackends is recorded when VMs are registered with the load balancer
+	EventRegisteredBackends = "RegisteredBackends"
+	// EventDeregisteredBackends is recorded when VMs are deregistered from the load balancer
+	EventDeregisteredBackends = "DeregisteredBackends"
+	// EventAPIError is recorded when an oAPI or LBU call fails with an error code
+	EventAPIError = "LoadBalancerAPIError"
+)
+
+// apiErrorHints are the actions suggested to the users for the error codes of the oAPI and LBU calls
+var apiErrorHints = map[string]string{
+	"Throttling":                  "the API rate limit of the account is reached, the reconciliation is retried",
+	"RequestLimitExceeded":        "the API rate limit of the account is reached, the reconciliation is retried",
+	"AccessDenied":                "check the EIM policy of the credentials of the cloud controller manager",
+	"UnauthorizedOperation":       "check the EIM policy of the credentials of the cloud controller manager",
+	"TooManyLoadBalancers":        "the load balancer quota of the account is reached",
+	"TooManyPolicies":             "the policy quota of the load balancer is reached",
+	"CertificateNotFound":         "check the certificate of the " + ServiceAnnotationLoadBalancerCertificate + " annotation",
+	"InvalidConfigurationRequest": "check the annotations of the service",
+	"ValidationError":             "check the annotations of the service",
+	"InvalidSecurityGroup":        "check the security groups of the service annotations",
+	"InvalidSubnet":               "check the subnets of the cluster and of the service annotations",
+	"SubnetNotFound":              "check the subnets of the cluster and of the service annotations",
+}
+
+// apiErrorCode returns the error code of a failed oAPI or LBU call, or an empty string
+func apiErrorCode(err error) string {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code()
+	}
+	var apiErr osc.GenericOpenAPIError
+	if errors.As(err, &apiErr) {
+		if model, ok := apiErr.Model().(osc.ErrorResponse); ok {
+			for _, e := range model.GetErrors() {
+				if e.GetType() != "" {
+					return e.GetType()
+				}
+				if e.GetCode() != "" {
+					return e.GetCode()
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// recordLoadBalancerEvent records a Normal event on the service
+func (c *Cloud) recordLoadBalancerEvent(service *v1.Service, reason string, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if service == nil {
+		klog.V(2).Infof("%s: %s", reason, message)
+		return
+	}
+	klog.V(2).Infof("%s/%s %s: %s", service.Namespace, service.Name, reason, message)
+	if c.eventRecorder != nil {
+		c.eventRecorder.Event(service, v1.EventTypeNormal, reason, message)
+	}
+}
+
+// recordLoadBalancerError records a Warning event on the service when err is the error of
+// an oAPI or LBU call, with its error code and the action it calls for. The other errors
+// are reported by the service controller.
+func (c *Cloud) recordLoadBalancerError(service *v1.Service, err error) {
+	if err == nil || service == nil || c.eventRecorder == nil || errors.Is(err, ErrLoadBalancerIsNotReady) {
+		return
+	}
+	code := apiErrorCode(err)
+	if code == "" {
+		return
+	}
+	hint, found := apiErrorHints[code]
+	if !found {
+		hint = "see the error of the API"
+	}
+	c.eventRecorder.Eventf(service, v1.EventTypeWarning, EventAPIError, "Error code %s: %s: %v", code, hint, err)
+}
+
+// listenersString formats the listeners for the events, as PROTOCOL:port->PROTOCOL:port
+func listenersString(listeners []*elb.Listener) string {
+	formatted := make([]string, 0, len(listeners))
+	for _, listener := range listeners {
+		formatted = append(formatted, fmt.Sprintf("%s:%d->%s:%d",
+			aws.StringValue(listener.Protocol), aws.Int64Value(listener.LoadBalancerPort),
+			aws.StringValue(listener.InstanceProtocol), aws.Int64Value(listener.InstancePort)))
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestAPIErrorCode(t *testing.T) {
+	assert.Equal(t, "Throttling", apiErrorCode(awserr.New("Throttling", "Rate exceeded", nil)))
+	assert.Equal(t, "Throttling", apiErrorCode(fmt.Errorf("error creating load balancer: %w",
+		awserr.New("Throttling", "Rate exceeded", nil))))
+	assert.Equal(t, "", apiErrorCode(errors.New("no subnet")))
+	assert.Equal(t, "", apiErrorCode(nil))
+}
+
+func TestRecordLoadBalancerError(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+	c.recordLoadBalancerError(service, nil)
+	c.recordLoadBalancerError(service, errors.New("no subnet"))
+	c.recordLoadBalancerError(service, ErrLoadBalancerIsNotReady)
+	assert.Empty(t, recorder.Events, "only the errors of the API are recorded")
+
+	c.recordLoadBalancerError(service, awserr.New("AccessDenied", "Access denied", nil))
+	if assert.Len(t, recorder.Events, 1) {
+		event := <-recorder.Events
+		assert.Contains(t, event, "Warning "+EventAPIError+" Error code AccessDenied")
+		assert.Contains(t, event, "EIM policy")
+	}
+}
+
+func TestEnsureLoadBalancerEvents(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.vpcID = "vpc-123456"
+	recorder := record.NewFakeRecorder(20)
+	c.eventRecorder = recorder
+
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+	}) {
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "myservice",
+			UID:  "anuid",
+		},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports:           []v1.ServicePort{{Port: 8383, TargetPort: intstr.FromInt(80), Protocol: "TCP", NodePort: 4040}},
+		},
+	}
+
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.NoError(t, err)
+	events := []string{}
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	assert.Contains(t, strings.Join(events, "\n"), "Normal "+EventCreatedLoadBalancer)
+	assert.Contains(t, strings.Join(events, "\n"), "with listeners TCP:8383->TCP:4040")
+	assert.Contains(t, strings.Join(events, "\n"), "Normal "+EventUpdatedSecurityGroupRules)
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Metrics *********************
+
+// loadBalancerBackendStates are the backend states reported by the LBU API
+var loadBalancerBackendStates = []string{"InService", "OutOfService", nodeLoadBalancerHealthUnknown}
+
+// EventBackendHealthChanged is recorded when the number of healthy backends of the load
+// balancer of a service changes
+const EventBackendHealthChanged = "BackendHealthChanged"
+
+// loadBalancerBackendHealth is the last scraped backend health of a load balancer
+type loadBalancerBackendHealth struct {
+	healthy int
+	total   int
+}
+
+// loadBalancerMetricsCollector periodically scrapes the backend health of the managed
+// load balancers and republishes it as Prometheus metrics labeled by service, and as
+// events of the services when their number of healthy backends changes.
+// The LBU API does not expose traffic statistics, so only backend counts are reported.
+type loadBalancerMetricsCollector struct {
+	cloud    *Cloud
+	interval time.Duration
+
+	mutex         sync.Mutex
+	loadBalancers map[string]types.NamespacedName
+	// Last scraped backend health, by load balancer name
+	health map[string]loadBalancerBackendHealth
+}
+
+func newLoadBalancerMetricsCollector(cloud *Cloud, interval time.Duration) *loadBalancerMetricsCollector {
+	return &loadBalancerMetricsCollector{
+		cloud:         cloud,
+		interval:      interval,
+		loadBalancers: make(map[string]types.NamespacedName),
+		health:        make(map[string]loadBalancerBackendHealth),
+	}
+}
+
+func (m *loadBalancerMetricsCollector) enabled() bool {
+	return m != nil && m.interval > 0
+}
+
+// track registers a load balancer to scrape
+func (m *loadBalancerMetricsCollector) track(loadBalancerName string, service types.NamespacedName) {
+	if !m.enabled() {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.loadBalancers[loadBalancerName] = service
+}
+
+// forget stops scraping a load balancer and removes its metrics
+func (m *loadBalancerMetricsCollector) forget(loadBalancerName string) {
+	if !m.enabled() {
+		return
+	}
+
+	m.mutex.Lock()
+	service, found := m.loadBalancers[loadBalancerName]
+	delete(m.loadBalancers, loadBalancerName)
+	delete(m.health, loadBalancerName)
+	m.mutex.Unlock()
+
+	if found {
+		for _, state := range loadBalancerBackendStates {
+			loadBalancerBackendsMetric.Delete(loadBalancerBackendsLabels(loadBalancerName, service, state))
+		}
+		loadBalancerHealthyBackendsMetric.Delete(loadBalancerHealthyBackendsLabels(loadBalancerName, service))
+	}
+}
+
+// run scrapes the load balancers every interval until stop is closed
+func (m *loadBalancerMetricsCollector) run(stop <-chan struct{}) {
+	if !m.enabled() {
+		return
+	}
+
+	klog.Infof("Starting load balancer metrics collector (interval %v)", m.interval)
+	go wait.Until(m.collect, m.interval, stop)
+}
+
+// collect scrapes the backend health of every tracked load balancer
+func (m *loadBalancerMetricsCollector) collect() {
+	m.mutex.Lock()
+	loadBalancers := make(map[string]types.NamespacedName, len(m.loadBalancers))
+	for name, service := range m.loadBalancers {
+		loadBalancers[name] = service
+	}
+	m.mutex.Unlock()
+
+	for name, service := range loadBalancers {
+		health, err := m.cloud.loadBalancerService.describeLoadBalancerInstancesHealth(name)
+		if err != nil {
+			klog.V(2).Infof("Unable to collect metrics of load balancer %s (%v): %q", name, service, err)
+			continue
+		}
+
+		counts := make(map[string]int)
+		for _, state := range health {
+			counts[state]++
+		}
+		for _, state := range loadBalancerBackendStates {
+			loadBalancerBackendsMetric.With(loadBalancerBackendsLabels(name, service, state)).Set(float64(counts[state]))
+		}
+		current := loadBalancerBackendHealth{healthy: counts["InService"], total: len(health)}
+		loadBalancerHealthyBackendsMetric.With(loadBalancerHealthyBackendsLabels(name, service)).Set(float64(current.healthy))
+		m.recordHealthChange(name, service, current)
+	}
+}
+
+// recordHealthChange records an event on the service when the number of healthy backends of
+// its load balancer changed since the last scrape. The first scrape only reports degraded
+// load balancers, so that a restart of the CCM does not report every load balancer.
+func (m *loadBalancerMetricsCollector) recordHealthChange(loadBalancerName string, service types.NamespacedName,
+	current loadBalancerBackendHealth) {
+	m.mutex.Lock()
+	previous, scraped := m.health[loadBalancerName]
+	if _, tracked := m.loadBalancers[loadBalancerName]; tracked {
+		m.health[loadBalancerName] = current
+	}
+	m.mutex.Unlock()
+
+	if scraped && previous.healthy == current.healthy {
+		return
+	}
+	if !scraped && current.healthy == current.total {
+		return
+	}
+	eventType := v1.EventTypeNormal
+	if current.healthy < current.total {
+		eventType = v1.EventTypeWarning
+	}
+	klog.V(2).Infof("Load balancer %s (%v) has %d healthy backends out of %d", loadBalancerName, service, current.healthy, current.total)
+	if m.cloud.eventRecorder != nil {
+		reference := &v1.ObjectReference{Kind: "Service", APIVersion: "v1", Namespace: service.Namespace, Name: service.Name}
+		m.cloud.eventRecorder.Eventf(reference, eventType, EventBackendHealthChanged,
+			"%d of %d backends of load balancer %s are healthy", current.healthy, current.total, loadBalancerName)
+	}
+}
+
+func loadBalancerBackendsLabels(loadBalancerName string, service types.NamespacedName, state string) prometheus.Labels {
+	return prometheus.Labels{
+		"namespace":     service.Namespace,
+		"service":       service.Name,
+		"load_balancer": loadBalancerName,
+		"state":         state,
+	}
+}
+
+func loadBalancerHealthyBackendsLabels(loadBalancerName string, service types.NamespacedName) prometheus.Labels {
+	return prometheus.Labels{
+		"namespace":     service.Namespace,
+		"service":       service.Name,
+		"load_balancer": loadBalancerName,
+	}
+}
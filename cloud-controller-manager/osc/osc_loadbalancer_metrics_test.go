@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestLoadBalancerMetricsCollector(t *testing.T) {
+	registerMetrics()
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+
+	awsServices.elb.(*FakeELB).LoadBalancers = map[string]*elb.LoadBalancerDescription{
+		"lb-metrics": {
+			LoadBalancerName: aws.String("lb-metrics"),
+			Instances: []*elb.Instance{
+				{InstanceId: aws.String("i-1")},
+				{InstanceId: aws.String("i-2")},
+			},
+		},
+	}
+
+	collector := newLoadBalancerMetricsCollector(c, time.Minute)
+	collector.track("lb-metrics", types.NamespacedName{Namespace: "default", Name: "web"})
+	collector.collect()
+
+	expected := `
+# HELP cloudprovider_osc_load_balancer_backends [ALPHA] Number of load balancer backends by health state
+# TYPE cloudprovider_osc_load_balancer_backends gauge
+cloudprovider_osc_load_balancer_backends{load_balancer="lb-metrics",namespace="default",service="web",state="InService"} 0
+cloudprovider_osc_load_balancer_backends{load_balancer="lb-metrics",namespace="default",service="web",state="OutOfService"} 0
+cloudprovider_osc_load_balancer_backends{load_balancer="lb-metrics",namespace="default",service="web",state="Unknown"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(expected), "cloudprovider_osc_load_balancer_backends"))
+	// The first scrape reports the degraded load balancers
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Equal(t, "Warning BackendHealthChanged 0 of 2 backends of load balancer lb-metrics are healthy", <-recorder.Events)
+	}
+
+	awsServices.elb.(*FakeELB).InstanceHealth = map[string]string{"i-1": "InService", "i-2": "InService"}
+	collector.collect()
+	expected = `
+# HELP osc_lb_backend_healthy [ALPHA] Number of healthy (InService) load balancer backends
+# TYPE osc_lb_backend_healthy gauge
+osc_lb_backend_healthy{load_balancer="lb-metrics",namespace="default",service="web"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(expected), "osc_lb_backend_healthy"))
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Equal(t, "Normal BackendHealthChanged 2 of 2 backends of load balancer lb-metrics are healthy", <-recorder.Events)
+	}
+	collector.collect()
+	assert.Len(t, recorder.Events, 0)
+
+	collector.forget("lb-metrics")
+	assert.NoError(t, testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(""),
+		"cloudprovider_osc_load_balancer_backends", "osc_lb_backend_healthy"))
+}
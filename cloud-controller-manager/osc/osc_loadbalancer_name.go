@@ -0,0 +1,236 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Name *********************
+
+const (
+	// EventLoadBalancerNameConflict is recorded when the load balancer name of the service
+	// is claimed by another service
+	EventLoadBalancerNameConflict = "LoadBalancerNameConflict"
+
+	// loadBalancerNameIndex indexes the Services of the service informer by the shared name
+	// of their load balancer, see hasSharedLoadBalancerName
+	loadBalancerNameIndex = "loadBalancerName"
+)
+
+// LoadBalancerNameTemplate is set by the --load-balancer-name-template flag and takes
+// precedence over the LoadBalancerNameTemplate of the cloud config
+var LoadBalancerNameTemplate string
+
+// loadBalancerNameData are the variables of the load balancer name templates
+type loadBalancerNameData struct {
+	// ClusterName is the cluster ID of the cloud config
+	ClusterName string
+	Namespace   string
+	ServiceName string
+	ServiceUID  string
+}
+
+// parseLoadBalancerNameTemplate parses the template and checks that it renders a
+// non empty name
+func parseLoadBalancerNameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("load-balancer-name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	name, err := renderLoadBalancerName(tmpl, loadBalancerNameData{
+		ClusterName: "cluster",
+		Namespace:   "namespace",
+		ServiceName: "service",
+		ServiceUID:  "0123456789abcdef",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, fmt.Errorf("template %q renders an empty name", text)
+	}
+	return tmpl, nil
+}
+
+// renderLoadBalancerName executes the template, replacing the characters which are not
+// allowed in load balancer names by hyphens
+func renderLoadBalancerName(tmpl *template.Template, data loadBalancerNameData) (string, error) {
+	var name bytes.Buffer
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", err
+	}
+	return sanitizeLoadBalancerName(name.String()), nil
+}
+
+// templatedLoadBalancerName returns the name of the load balancer of the service rendered
+// from the LoadBalancerNameTemplate, or an empty string when no template is configured
+func (c *Cloud) templatedLoadBalancerName(service *v1.Service) string {
+	if c.loadBalancerNameTemplate == nil {
+		return ""
+	}
+	name, err := renderLoadBalancerName(c.loadBalancerNameTemplate, loadBalancerNameData{
+		ClusterName: c.tagging.clusterID(),
+		Namespace:   service.Namespace,
+		ServiceName: service.Name,
+		ServiceUID:  string(service.UID),
+	})
+	if err != nil {
+		klog.Warningf("Ignoring LoadBalancerNameTemplate for service %s/%s: %v", service.Namespace, service.Name, err)
+		return ""
+	}
+	return name
+}
+
+// hasLoadBalancer returns whether the load balancer of the service may already exist, in which
+// case its name is not rendered from the LoadBalancerNameTemplate: the load balancers created
+// before the template was configured keep their name
+func hasLoadBalancer(service *v1.Service) bool {
+	return hasLoadBalancerFinalizer(service) || len(service.Status.LoadBalancer.Ingress) > 0
+}
+
+// persistLoadBalancerName records the name of the load balancer rendered from the
+// LoadBalancerNameTemplate in the ServiceAnnotationLoadBalancerActiveName annotation before the
+// load balancer is created, so that changing the template does not rename it
+func (c *Cloud) persistLoadBalancerName(service *v1.Service) error {
+	if c.kubeClient == nil || c.loadBalancerNameTemplate == nil || hasLoadBalancer(service) ||
+		service.Annotations[ServiceAnnotationLoadBalancerActiveName] != "" {
+		return nil
+	}
+	if _, named := service.Annotations[ServiceAnnotationLoadBalancerName]; named {
+		return nil
+	}
+	name := c.GetLoadBalancerName(context.TODO(), "", service)
+	if name == "" {
+		return nil
+	}
+	klog.V(2).Infof("Recording load balancer name %s of service %s/%s", name, service.Namespace, service.Name)
+	if err := c.patchSchemeSwitchAnnotations(service, map[string]interface{}{ServiceAnnotationLoadBalancerActiveName: name}); err != nil {
+		return err
+	}
+	annotations := make(map[string]string, len(service.Annotations)+1)
+	for key, value := range service.Annotations {
+		annotations[key] = value
+	}
+	annotations[ServiceAnnotationLoadBalancerActiveName] = name
+	service.Annotations = annotations
+	return nil
+}
+
+// hasSharedLoadBalancerName returns whether the name of the load balancer is not derived
+// from the service UID, and may thus be requested by several services
+func (c *Cloud) hasSharedLoadBalancerName(annotations map[string]string) bool {
+	_, named := annotations[ServiceAnnotationLoadBalancerName]
+	return named || c.loadBalancerNameTemplate != nil
+}
+
+// checkLoadBalancerNameOwner returns the service the existing load balancer was created for,
+// from its TagNameKubernetesService tag, or an empty string when it does not exist or is not
+// tagged
+func (c *Cloud) checkLoadBalancerNameOwner(loadBalancerName string) (string, error) {
+	klog.V(5).Infof("checkLoadBalancerNameOwner(%v)", loadBalancerName)
+	tags, err := c.loadBalancerService.describeLoadBalancerTags(loadBalancerName)
+	if err != nil {
+		return "", err
+	}
+	return tags[TagNameKubernetesService], nil
+}
+
+// indexServiceByLoadBalancerName is the loadBalancerNameIndex function: the Services of type
+// LoadBalancer reconciled by the cloud provider are indexed by the name of their load balancer,
+// when it may be requested by several services
+func (c *Cloud) indexServiceByLoadBalancerName(obj interface{}) ([]string, error) {
+	service, ok := obj.(*v1.Service)
+	if !ok || service.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return nil, nil
+	}
+	service = c.withLoadBalancerDefaults(service)
+	if !c.managesLoadBalancerClass(service) || !c.hasSharedLoadBalancerName(service.Annotations) {
+		return nil, nil
+	}
+	return []string{c.GetLoadBalancerName(context.TODO(), "", service)}, nil
+}
+
+// firstLoadBalancerNameClaimant returns the service which claimed the load balancer name
+// first among the services of the service informer, the oldest one, or an empty string when
+// the informer is not synced
+func (c *Cloud) firstLoadBalancerNameClaimant(loadBalancerName string) (string, error) {
+	if c.serviceInformerHasSynced == nil || !c.serviceInformerHasSynced() {
+		return "", nil
+	}
+	objs, err := c.serviceInformer.Informer().GetIndexer().ByIndex(loadBalancerNameIndex, loadBalancerName)
+	if err != nil {
+		return "", err
+	}
+	var first *v1.Service
+	for _, obj := range objs {
+		service := obj.(*v1.Service)
+		if first == nil || service.CreationTimestamp.Before(&first.CreationTimestamp) ||
+			(service.CreationTimestamp.Equal(&first.CreationTimestamp) &&
+				types.NamespacedName{Namespace: service.Namespace, Name: service.Name}.String() <
+					types.NamespacedName{Namespace: first.Namespace, Name: first.Name}.String()) {
+			first = service
+		}
+	}
+	if first == nil {
+		return "", nil
+	}
+	return types.NamespacedName{Namespace: first.Namespace, Name: first.Name}.String(), nil
+}
+
+// claimLoadBalancerName returns an error, and reports a LoadBalancerNameConflict event, when
+// the load balancer name of the service is claimed by another service, so that two services
+// never share a load balancer. An existing load balancer belongs to the service it is tagged
+// with, otherwise the name belongs to the oldest service requesting it, so that services
+// reconciled concurrently agree on the owner before the load balancer is created.
+func (c *Cloud) claimLoadBalancerName(service *v1.Service, loadBalancerName string) error {
+	klog.V(5).Infof("claimLoadBalancerName(%v,%v)", service.Name, loadBalancerName)
+	if !c.hasSharedLoadBalancerName(service.Annotations) {
+		return nil
+	}
+	serviceName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}.String()
+	owner, err := c.checkLoadBalancerNameOwner(loadBalancerName)
+	if err != nil {
+		return err
+	}
+	if owner == "" {
+		if owner, err = c.firstLoadBalancerNameClaimant(loadBalancerName); err != nil {
+			return err
+		}
+	}
+	if owner == "" || owner == serviceName {
+		return nil
+	}
+
+	err = fmt.Errorf("load balancer name %q is already used by service %s, set the %s annotation on %s",
+		loadBalancerName, owner, ServiceAnnotationLoadBalancerName, serviceName)
+	klog.Warning(err)
+	if c.eventRecorder != nil {
+		c.eventRecorder.Event(service, v1.EventTypeWarning, EventLoadBalancerNameConflict, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseLoadBalancerNameTemplate(t *testing.T) {
+	tmpl, err := parseLoadBalancerNameTemplate("")
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	for _, text := range []string{"{{.Namespace", "{{.Unknown}}", "{{if false}}x{{end}}", "//"} {
+		_, err = parseLoadBalancerNameTemplate(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestLoadBalancerNameTemplate(t *testing.T) {
+	cfg := CloudConfig{}
+	cfg.Global.LoadBalancerNameTemplate = "{{.ClusterName}}-{{.Namespace}}-{{.ServiceName}}"
+	c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name: "web.front", Namespace: "shop", UID: "a7b3c2f1-0e4d-4a5b-9c8d-7e6f5a4b3c2d",
+	}}
+	assert.Equal(t, "clusterid-test-shop-web-front", c.GetLoadBalancerName(context.TODO(), "", service))
+
+	service.Name = "a-service-with-a-very-long-name"
+	assert.Equal(t, "clusterid-test-shop-a-service-wi", c.GetLoadBalancerName(context.TODO(), "", service))
+
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerName: "custom"}
+	assert.Equal(t, "custom", c.GetLoadBalancerName(context.TODO(), "", service))
+
+	LoadBalancerNameTemplate = "{{.ServiceUID}}"
+	defer func() { LoadBalancerNameTemplate = "" }()
+	_, err = newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+	LoadBalancerNameTemplate = "{{.Cluster}}"
+	_, err = newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.Error(t, err)
+}
+
+func TestPersistLoadBalancerName(t *testing.T) {
+	cfg := CloudConfig{}
+	cfg.Global.LoadBalancerNameTemplate = "{{.Namespace}}-{{.ServiceName}}"
+	c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	require.NoError(t, err)
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "a7b3c2f1"}}
+	c.kubeClient = fake.NewSimpleClientset(service)
+
+	// The load balancer of a service created before the template keeps its name
+	existing := service.DeepCopy()
+	existing.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: "lb.example.com"}}
+	assert.Equal(t, "a7b3c2f1", c.GetLoadBalancerName(context.TODO(), "", existing))
+	require.NoError(t, c.persistLoadBalancerName(existing))
+	assert.Empty(t, existing.Annotations)
+
+	// The rendered name of a new load balancer is recorded, and kept when the template changes
+	require.NoError(t, c.persistLoadBalancerName(service))
+	assert.Equal(t, "shop-web", service.Annotations[ServiceAnnotationLoadBalancerActiveName])
+	current, err := c.kubeClient.CoreV1().Services("shop").Get(context.TODO(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "shop-web", current.Annotations[ServiceAnnotationLoadBalancerActiveName])
+	current.Finalizers = []string{LoadBalancerCleanupFinalizer}
+	c.loadBalancerNameTemplate, err = parseLoadBalancerNameTemplate("{{.ServiceName}}")
+	require.NoError(t, err)
+	assert.Equal(t, "shop-web", c.GetLoadBalancerName(context.TODO(), "", current))
+}
+
+func TestClaimLoadBalancerName(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+	c.SetInformers(informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0))
+	c.serviceInformerHasSynced = func() bool { return true }
+	indexer := c.serviceInformer.Informer().GetIndexer()
+
+	newService := func(namespace string, created int64) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "web",
+				Namespace:         namespace,
+				CreationTimestamp: metav1.Unix(created, 0),
+				Annotations:       map[string]string{ServiceAnnotationLoadBalancerName: "shared"},
+			},
+			Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		}
+	}
+	shop := newService("shop", 200)
+	blog := newService("blog", 100)
+	unnamed := newService("wiki", 50)
+	delete(unnamed.Annotations, ServiceAnnotationLoadBalancerName)
+	for _, service := range []*v1.Service{shop, blog, unnamed} {
+		require.NoError(t, indexer.Add(service))
+	}
+
+	// Before the load balancer exists, the oldest service requesting the name claims it
+	assert.NoError(t, c.claimLoadBalancerName(blog, "shared"))
+	err = c.claimLoadBalancerName(shop, "shared")
+	assert.EqualError(t, err, `load balancer name "shared" is already used by service blog/web, set the `+
+		ServiceAnnotationLoadBalancerName+` annotation on shop/web`)
+	assert.Len(t, recorder.Events, 1)
+	assert.NoError(t, c.claimLoadBalancerName(unnamed, "shared"))
+
+	// The existing load balancer belongs to the service it is tagged with
+	awsServices.elb.(*FakeELB).LoadBalancers = map[string]*elb.LoadBalancerDescription{
+		"shared": {LoadBalancerName: aws.String("shared")},
+	}
+	awsServices.elb.(*FakeELB).Tags = map[string][]*elb.Tag{
+		"shared": {{Key: aws.String(TagNameKubernetesService), Value: aws.String("shop/web")}},
+	}
+	assert.NoError(t, c.claimLoadBalancerName(shop, "shared"))
+	assert.Error(t, c.claimLoadBalancerName(blog, "shared"))
+
+	// Once the oldest service is deleted, the name goes to the next one
+	awsServices.elb.(*FakeELB).Tags = map[string][]*elb.Tag{}
+	assert.Error(t, c.claimLoadBalancerName(shop, "shared"))
+	require.NoError(t, indexer.Delete(blog))
+	assert.NoError(t, c.claimLoadBalancerName(shop, "shared"))
+
+	assert.False(t, c.hasSharedLoadBalancerName(nil))
+	assert.True(t, c.hasSharedLoadBalancerName(map[string]string{ServiceAnnotationLoadBalancerName: "shared"}))
+}
+
+func TestDeleteNamedLoadBalancerNotFound(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Annotations: map[string]string{ServiceAnnotationLoadBalancerName: "shared"},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+
+	// The tags of a load balancer which does not exist are not found
+	_, err = awsServices.elb.DescribeTags(&elb.DescribeTagsInput{LoadBalancerNames: []*string{aws.String("shared")}})
+	assert.Error(t, err)
+	owner, err := c.checkLoadBalancerNameOwner("shared")
+	assert.NoError(t, err)
+	assert.Empty(t, owner)
+	assert.NoError(t, c.claimLoadBalancerName(service, "shared"))
+	assert.NoError(t, c.EnsureLoadBalancerDeleted(context.TODO(), TestClusterName, service))
+}
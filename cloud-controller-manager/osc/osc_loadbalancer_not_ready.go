@@ -0,0 +1,71 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ********************* CCM Load Balancer Not Ready Errors *********************
+
+// LoadBalancerNotReadyReason is the machine-readable provisioning phase a load balancer
+// is waiting for
+type LoadBalancerNotReadyReason string
+
+const (
+	// NotReadyWaitingForDNS is reported while the load balancer has no DNS name
+	NotReadyWaitingForDNS LoadBalancerNotReadyReason = "waiting-for-dns"
+	// NotReadyWaitingForState is reported while the load balancer or its backends are
+	// not in a serving state
+	NotReadyWaitingForState LoadBalancerNotReadyReason = "waiting-for-state"
+	// NotReadyWaitingForIPAssociation is reported while an IP is not associated with
+	// the load balancer
+	NotReadyWaitingForIPAssociation LoadBalancerNotReadyReason = "waiting-for-ip-association"
+)
+
+// ErrLoadBalancerIsNotReady is matched by errors.Is on every LoadBalancerNotReadyError
+var ErrLoadBalancerIsNotReady = errors.New("load balancer is not ready")
+
+// LoadBalancerNotReadyError is returned while a load balancer is being provisioned. The
+// reason is part of the message, so that it shows in the events of the Service.
+type LoadBalancerNotReadyError struct {
+	LoadBalancerName string
+	Reason           LoadBalancerNotReadyReason
+	Message          string
+}
+
+// newLoadBalancerNotReadyError returns a LoadBalancerNotReadyError and counts it in the
+// not ready metric
+func newLoadBalancerNotReadyError(loadBalancerName string, reason LoadBalancerNotReadyReason,
+	format string, args ...interface{}) *LoadBalancerNotReadyError {
+	recordLoadBalancerNotReadyMetric(reason)
+	return &LoadBalancerNotReadyError{
+		LoadBalancerName: loadBalancerName,
+		Reason:           reason,
+		Message:          fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *LoadBalancerNotReadyError) Error() string {
+	return fmt.Sprintf("load balancer %s is not ready (reason: %s): %s", e.LoadBalancerName, e.Reason, e.Message)
+}
+
+// Is matches ErrLoadBalancerIsNotReady
+func (e *LoadBalancerNotReadyError) Is(target error) bool {
+	return target == ErrLoadBalancerIsNotReady
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestLoadBalancerNotReadyError(t *testing.T) {
+	registerMetrics()
+	before, _ := testutil.GetCounterMetricValue(loadBalancerNotReadyMetric.WithLabelValues(string(NotReadyWaitingForDNS)))
+
+	p := newLoadBalancerProvisioning(time.Minute, time.Minute)
+	_, err := p.check("lb", false)
+	var notReady *LoadBalancerNotReadyError
+	assert.True(t, errors.Is(err, ErrLoadBalancerIsNotReady))
+	if assert.True(t, errors.As(err, &notReady)) {
+		assert.Equal(t, NotReadyWaitingForDNS, notReady.Reason)
+	}
+	assert.Equal(t, "load balancer lb is not ready (reason: waiting-for-dns): no DNS name yet", err.Error())
+
+	wrapped := fmt.Errorf("sync failed: %w", newLoadBalancerNotReadyError("lb", NotReadyWaitingForState, "instances %v are not serving yet", []string{"i-a"}))
+	assert.True(t, errors.Is(wrapped, ErrLoadBalancerIsNotReady))
+	if assert.True(t, errors.As(wrapped, &notReady)) {
+		assert.Equal(t, NotReadyWaitingForState, notReady.Reason)
+	}
+	assert.False(t, errors.Is(errors.New("other"), ErrLoadBalancerIsNotReady))
+
+	after, _ := testutil.GetCounterMetricValue(loadBalancerNotReadyMetric.WithLabelValues(string(NotReadyWaitingForDNS)))
+	assert.Equal(t, before+1, after)
+}
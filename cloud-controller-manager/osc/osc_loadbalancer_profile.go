@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Profiles *********************
+
+// loadBalancerProfiles are the presets of the ServiceAnnotationLoadBalancerProfile annotation,
+// as the values of the annotations they stand for
+var loadBalancerProfiles = map[string]map[string]string{
+	// Long-lived upgraded connections: LBU HTTP listeners don't forward the upgrade, so the
+	// connections are passed through as TCP and kept open for an hour of inactivity
+	"websocket": {
+		ServiceAnnotationLoadBalancerBEProtocol:            "tcp",
+		ServiceAnnotationLoadBalancerConnectionIdleTimeout: "3600",
+	},
+	// HTTP/2 streams: LBU listeners only speak HTTP/1.1, so the connections are passed
+	// through as TCP and kept open for an hour of inactivity
+	"grpc": {
+		ServiceAnnotationLoadBalancerBEProtocol:            "tcp",
+		ServiceAnnotationLoadBalancerConnectionIdleTimeout: "3600",
+	},
+	// HTTP/1.1 requests, terminated by the load balancer
+	"http": {
+		ServiceAnnotationLoadBalancerBEProtocol:            "http",
+		ServiceAnnotationLoadBalancerConnectionIdleTimeout: "60",
+	},
+	// TCP connections carrying the client address to the backends with the proxy protocol
+	"tcp-proxy": {
+		ServiceAnnotationLoadBalancerBEProtocol:            "tcp",
+		ServiceAnnotationLoadBalancerProxyProtocol:         "*",
+		ServiceAnnotationLoadBalancerConnectionIdleTimeout: "60",
+	},
+}
+
+// parseLoadBalancerProfile returns the annotations of the profile
+func parseLoadBalancerProfile(value string) (map[string]string, error) {
+	profile, found := loadBalancerProfiles[strings.ToLower(strings.TrimSpace(value))]
+	if !found {
+		names := make([]string, 0, len(loadBalancerProfiles))
+		for name := range loadBalancerProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown load balancer profile %q, expected one of %s", value, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
+
+// expandLoadBalancerProfile returns the annotations of the service completed with those of
+// the profile set by the ServiceAnnotationLoadBalancerProfile annotation. The annotations
+// set on the service take precedence over the profile.
+func expandLoadBalancerProfile(annotations map[string]string) (map[string]string, error) {
+	klog.V(5).Infof("expandLoadBalancerProfile(%v)", annotations)
+	value, found := annotations[ServiceAnnotationLoadBalancerProfile]
+	if !found {
+		return annotations, nil
+	}
+	profile, err := parseLoadBalancerProfile(value)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing service annotation %s=%s: %v", ServiceAnnotationLoadBalancerProfile, value, err)
+	}
+
+	expanded := make(map[string]string, len(annotations)+len(profile))
+	for key, value := range profile {
+		expanded[key] = value
+	}
+	for key, value := range annotations {
+		expanded[key] = value
+	}
+	return expanded, nil
+}
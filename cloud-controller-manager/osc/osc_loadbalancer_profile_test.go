@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestExpandLoadBalancerProfile(t *testing.T) {
+	annotations := map[string]string{ServiceAnnotationLoadBalancerSSLPorts: "443"}
+	expanded, err := expandLoadBalancerProfile(annotations)
+	assert.NoError(t, err)
+	assert.Equal(t, annotations, expanded)
+
+	expanded, err = expandLoadBalancerProfile(map[string]string{
+		ServiceAnnotationLoadBalancerProfile:               "WebSocket",
+		ServiceAnnotationLoadBalancerConnectionIdleTimeout: "600",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		ServiceAnnotationLoadBalancerProfile:               "WebSocket",
+		ServiceAnnotationLoadBalancerBEProtocol:            "tcp",
+		ServiceAnnotationLoadBalancerConnectionIdleTimeout: "600",
+	}, expanded, "the annotations of the service take precedence")
+
+	expanded, err = expandLoadBalancerProfile(map[string]string{ServiceAnnotationLoadBalancerProfile: "tcp-proxy"})
+	assert.NoError(t, err)
+	proxyProtocol, err := getProxyProtocol(expanded)
+	assert.NoError(t, err)
+	assert.True(t, proxyProtocol)
+
+	_, err = expandLoadBalancerProfile(map[string]string{ServiceAnnotationLoadBalancerProfile: "quic"})
+	assert.Error(t, err)
+}
+
+func TestUpdateLoadBalancerProfile(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	service := newFakeAPIService("web")
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerProfile: "websocket"}
+	name := c.GetLoadBalancerName(context.TODO(), TestClusterName, service)
+	idleTimeout := func() int64 {
+		output, err := c.loadBalancer.DescribeLoadBalancerAttributes(&elb.DescribeLoadBalancerAttributesInput{
+			LoadBalancerName: aws.String(name),
+		})
+		require.NoError(t, err)
+		return aws.Int64Value(output.LoadBalancerAttributes.ConnectionSettings.IdleTimeout)
+	}
+
+	_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3600), idleTimeout())
+
+	// The updates of the backends keep the attributes of the profile
+	modified := s.Calls("ModifyLoadBalancerAttributes")
+	require.NoError(t, c.UpdateLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node}))
+	assert.Equal(t, int64(3600), idleTimeout())
+	assert.Equal(t, modified, s.Calls("ModifyLoadBalancerAttributes"))
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Provisioning Deadline *********************
+
+// defaultStalledRetryInterval is the retry interval of stalled load balancers when
+// LoadBalancerStalledRetrySeconds is not set
+const defaultStalledRetryInterval = 5 * time.Minute
+
+// loadBalancerProvisioning tracks the load balancers that are not ready yet (no DNS
+// name). Once a load balancer exceeds the provisioning deadline it is marked as stalled
+// and only checked again every stalled retry interval, so that slow state transitions
+// do not turn into long chains of API calls.
+type loadBalancerProvisioning struct {
+	deadline   time.Duration
+	slowRetry  time.Duration
+	mutex      sync.Mutex
+	states     map[string]*provisioningState
+	timeSource func() time.Time
+}
+
+// provisioningState holds the provisioning progress of a single load balancer
+type provisioningState struct {
+	firstSeen time.Time
+	lastCheck time.Time
+	stalled   bool
+}
+
+func newLoadBalancerProvisioning(deadline, slowRetry time.Duration) *loadBalancerProvisioning {
+	if slowRetry <= 0 {
+		slowRetry = defaultStalledRetryInterval
+	}
+	return &loadBalancerProvisioning{
+		deadline:   deadline,
+		slowRetry:  slowRetry,
+		states:     make(map[string]*provisioningState),
+		timeSource: time.Now,
+	}
+}
+
+func (p *loadBalancerProvisioning) enabled() bool {
+	return p != nil && p.deadline > 0
+}
+
+// throttled returns an error when the load balancer is stalled and its next check is not due yet
+func (p *loadBalancerProvisioning) throttled(loadBalancerName string) error {
+	if !p.enabled() {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	state, found := p.states[loadBalancerName]
+	if !found || !state.stalled {
+		return nil
+	}
+	if next := state.lastCheck.Add(p.slowRetry); p.timeSource().Before(next) {
+		return newLoadBalancerNotReadyError(loadBalancerName, NotReadyWaitingForDNS,
+			"provisioning is stalled, next check in %v", next.Sub(p.timeSource()).Round(time.Second))
+	}
+	return nil
+}
+
+// check records the readiness of the load balancer. It returns an error while the
+// load balancer is not ready, and whether it just exceeded the provisioning deadline.
+func (p *loadBalancerProvisioning) check(loadBalancerName string, ready bool) (bool, error) {
+	if !p.enabled() {
+		return false, nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if ready {
+		delete(p.states, loadBalancerName)
+		return false, nil
+	}
+
+	now := p.timeSource()
+	state, found := p.states[loadBalancerName]
+	if !found {
+		state = &provisioningState{firstSeen: now}
+		p.states[loadBalancerName] = state
+	}
+	state.lastCheck = now
+
+	if state.stalled {
+		return false, newLoadBalancerNotReadyError(loadBalancerName, NotReadyWaitingForDNS,
+			"provisioning is stalled since %v", now.Sub(state.firstSeen).Round(time.Second))
+	}
+	if now.Sub(state.firstSeen) > p.deadline {
+		state.stalled = true
+		return true, newLoadBalancerNotReadyError(loadBalancerName, NotReadyWaitingForDNS,
+			"no DNS name after %v, provisioning is stalled", p.deadline)
+	}
+	return false, newLoadBalancerNotReadyError(loadBalancerName, NotReadyWaitingForDNS, "no DNS name yet")
+}
+
+// forget drops the provisioning state of the load balancer
+func (p *loadBalancerProvisioning) forget(loadBalancerName string) {
+	if !p.enabled() {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.states, loadBalancerName)
+}
+
+// describeLoadBalancerDiagnostics summarizes the state of a load balancer for troubleshooting
+func describeLoadBalancerDiagnostics(lb *elb.LoadBalancerDescription) string {
+	listeners := []string{}
+	for _, listener := range lb.ListenerDescriptions {
+		if listener == nil || listener.Listener == nil {
+			continue
+		}
+		listeners = append(listeners, fmt.Sprintf("%s:%d->%s:%d",
+			aws.StringValue(listener.Listener.Protocol), aws.Int64Value(listener.Listener.LoadBalancerPort),
+			aws.StringValue(listener.Listener.InstanceProtocol), aws.Int64Value(listener.Listener.InstancePort)))
+	}
+	return fmt.Sprintf("dnsName=%q scheme=%q listeners=%v subnets=%v securityGroups=%v instances=%d",
+		aws.StringValue(lb.DNSName), aws.StringValue(lb.Scheme), listeners,
+		aws.StringValueSlice(lb.Subnets), aws.StringValueSlice(lb.SecurityGroups), len(lb.Instances))
+}
+
+// checkLoadBalancerProvisioning returns an error while the load balancer is not ready,
+// and reports a StalledProvisioning event once it exceeds the provisioning deadline.
+func (c *Cloud) checkLoadBalancerProvisioning(service *v1.Service, loadBalancerName string, lb *elb.LoadBalancerDescription) error {
+	klog.V(5).Infof("checkLoadBalancerProvisioning(%v, %v)", loadBalancerName, lb)
+	stalled, err := c.provisioning.check(loadBalancerName, aws.StringValue(lb.DNSName) != "")
+	if stalled {
+		diagnostics := describeLoadBalancerDiagnostics(lb)
+		klog.Warningf("Provisioning of load balancer %s is stalled: %s", loadBalancerName, diagnostics)
+		if c.eventRecorder != nil {
+			c.eventRecorder.Eventf(service, v1.EventTypeWarning, "StalledProvisioning",
+				"Load balancer %s is not ready after %v, retrying every %v: %s",
+				loadBalancerName, c.provisioning.deadline, c.provisioning.slowRetry, diagnostics)
+		}
+	}
+	return err
+}
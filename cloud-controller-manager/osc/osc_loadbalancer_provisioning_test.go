@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBalancerProvisioning(t *testing.T) {
+	now := time.Now()
+	p := newLoadBalancerProvisioning(10*time.Minute, time.Minute)
+	p.timeSource = func() time.Time { return now }
+
+	stalled, err := p.check("lb", false)
+	assert.False(t, stalled)
+	assert.Error(t, err, "a load balancer without DNS name is not ready")
+	assert.NoError(t, p.throttled("lb"), "checks are not throttled before the deadline")
+
+	now = now.Add(11 * time.Minute)
+	stalled, err = p.check("lb", false)
+	assert.True(t, stalled, "the deadline has been exceeded")
+	assert.Error(t, err)
+
+	now = now.Add(30 * time.Second)
+	assert.Error(t, p.throttled("lb"), "stalled load balancers are checked on the slow tier")
+	now = now.Add(time.Minute)
+	assert.NoError(t, p.throttled("lb"))
+
+	stalled, err = p.check("lb", false)
+	assert.False(t, stalled, "the stalled event is only reported once")
+	assert.Error(t, err)
+
+	stalled, err = p.check("lb", true)
+	assert.False(t, stalled)
+	assert.NoError(t, err)
+	assert.NoError(t, p.throttled("lb"))
+}
+
+func TestLoadBalancerProvisioningDisabled(t *testing.T) {
+	p := newLoadBalancerProvisioning(0, 0)
+	stalled, err := p.check("lb", false)
+	assert.False(t, stalled)
+	assert.NoError(t, err)
+	assert.NoError(t, p.throttled("lb"))
+}
+
+func TestDescribeLoadBalancerDiagnostics(t *testing.T) {
+	lb := &elb.LoadBalancerDescription{
+		Scheme: aws.String("internet-facing"),
+		ListenerDescriptions: []*elb.ListenerDescription{{Listener: &elb.Listener{
+			Protocol:         aws.String("TCP"),
+			LoadBalancerPort: aws.Int64(80),
+			InstanceProtocol: aws.String("TCP"),
+			InstancePort:     aws.Int64(30080),
+		}}},
+		Subnets:        aws.StringSlice([]string{"subnet-1"}),
+		SecurityGroups: aws.StringSlice([]string{"sg-1"}),
+	}
+	assert.Equal(t,
+		`dnsName="" scheme="internet-facing" listeners=[TCP:80->TCP:30080] subnets=[subnet-1] securityGroups=[sg-1] instances=0`,
+		describeLoadBalancerDiagnostics(lb))
+}
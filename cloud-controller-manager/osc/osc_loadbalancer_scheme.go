@@ -0,0 +1,196 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Scheme *********************
+
+const (
+	// EventLoadBalancerSchemeSwitch is recorded when the load balancer of the service is
+	// recreated, or can't be recreated, with another scheme
+	EventLoadBalancerSchemeSwitch = "LoadBalancerSchemeSwitch"
+
+	loadBalancerSchemeInternal       = "internal"
+	loadBalancerSchemeInternetFacing = "internet-facing"
+
+	// schemeSwitchNameSuffix is appended to the name of the load balancer recreated by a
+	// scheme switch, LBU names being unique
+	schemeSwitchNameSuffix = "-s"
+)
+
+// loadBalancerScheme returns the LBU scheme of an internal or internet-facing load balancer
+func loadBalancerScheme(internal bool) string {
+	if internal {
+		return loadBalancerSchemeInternal
+	}
+	return loadBalancerSchemeInternetFacing
+}
+
+// getSchemeSwitch returns whether the ServiceAnnotationLoadBalancerSchemeSwitch annotation
+// allows recreating the load balancer when its scheme changes
+func getSchemeSwitch(annotations map[string]string) (bool, error) {
+	value, found := annotations[ServiceAnnotationLoadBalancerSchemeSwitch]
+	if !found {
+		return false, nil
+	}
+	allowed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("error parsing service annotation: %s=%s, expected true or false",
+			ServiceAnnotationLoadBalancerSchemeSwitch, value)
+	}
+	return allowed, nil
+}
+
+// alternateLoadBalancerName returns the name of the load balancer recreated by a scheme
+// switch from the load balancer named after the service
+func alternateLoadBalancerName(name string) string {
+	alternate := name
+	if maxLength := int(LbNameMaxLength) - len(schemeSwitchNameSuffix); len(alternate) > maxLength {
+		alternate = strings.TrimRight(alternate[:maxLength], "-")
+	}
+	alternate += schemeSwitchNameSuffix
+	if alternate == name {
+		alternate = strings.TrimSuffix(alternate, schemeSwitchNameSuffix) + "-r"
+	}
+	return alternate
+}
+
+// switchedLoadBalancerName returns the name of the load balancer replacing the load balancer
+// of the service with another scheme: the name derived from the service, or its alternate
+// name when it is the current load balancer. Two switches in a row thus reuse the names.
+func (c *Cloud) switchedLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service, current string) string {
+	service = service.DeepCopy()
+	delete(service.Annotations, ServiceAnnotationLoadBalancerActiveName)
+	name := c.GetLoadBalancerName(ctx, clusterName, service)
+	if name != current {
+		return name
+	}
+	return alternateLoadBalancerName(name)
+}
+
+// ensureLoadBalancerScheme returns the name of the load balancer of the service with the
+// requested scheme. When the existing load balancer has another scheme, which LBU can't
+// change, a load balancer is created with another name, and the existing one is deleted once
+// the service switched to it, see deletePreviousLoadBalancer. As the address of the service
+// changes, the switch must be acknowledged by the ServiceAnnotationLoadBalancerSchemeSwitch
+// annotation.
+func (c *Cloud) ensureLoadBalancerScheme(ctx context.Context, clusterName string, service *v1.Service,
+	annotations map[string]string, loadBalancerName string, internal bool) (string, error) {
+	klog.V(5).Infof("ensureLoadBalancerScheme(%v, %v, %v)", service.Name, loadBalancerName, internal)
+	lb, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
+	if err != nil || lb == nil {
+		return loadBalancerName, err
+	}
+	scheme := loadBalancerScheme(internal)
+	current := aws.StringValue(lb.Scheme)
+	if current == "" || current == scheme {
+		return loadBalancerName, nil
+	}
+
+	allowed, err := getSchemeSwitch(annotations)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		err = fmt.Errorf("load balancer %s is %s, set the %s annotation of service %s/%s to recreate it as %s, with a new address",
+			loadBalancerName, current, ServiceAnnotationLoadBalancerSchemeSwitch, service.Namespace, service.Name, scheme)
+		klog.Warning(err)
+		if c.eventRecorder != nil {
+			c.eventRecorder.Event(service, v1.EventTypeWarning, EventLoadBalancerSchemeSwitch, err.Error())
+		}
+		return "", err
+	}
+	if err := c.checkDeletionProtection(service, loadBalancerName); err != nil {
+		return "", err
+	}
+
+	switched := c.switchedLoadBalancerName(ctx, clusterName, service, loadBalancerName)
+	c.recordLoadBalancerEvent(service, EventLoadBalancerSchemeSwitch,
+		"Replacing %s load balancer %s by %s load balancer %s, the address of the service changes",
+		current, loadBalancerName, scheme, switched)
+	return switched, nil
+}
+
+// setSchemeSwitchAnnotations records the load balancer replacing the previous one on the
+// service, which triggers its reconciliation once its status is updated
+func (c *Cloud) setSchemeSwitchAnnotations(service *v1.Service, loadBalancerName string, previous string) error {
+	return c.patchSchemeSwitchAnnotations(service, map[string]interface{}{
+		ServiceAnnotationLoadBalancerActiveName:   loadBalancerName,
+		ServiceAnnotationLoadBalancerPreviousName: previous,
+	})
+}
+
+// patchSchemeSwitchAnnotations sets the annotations of the service, a nil value removing
+// the annotation
+func (c *Cloud) patchSchemeSwitchAnnotations(service *v1.Service, annotations map[string]interface{}) error {
+	if c.kubeClient == nil {
+		return fmt.Errorf("no client to annotate service %s/%s", service.Namespace, service.Name)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.kubeClient.CoreV1().Services(service.Namespace).Patch(context.TODO(), service.Name,
+		types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("error annotating service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+	return nil
+}
+
+// deletePreviousLoadBalancer deletes the load balancer replaced by a scheme switch, once the
+// status of the service is the load balancer replacing it, so that the service is never
+// left without address
+func (c *Cloud) deletePreviousLoadBalancer(service *v1.Service, loadBalancer *elb.LoadBalancerDescription) error {
+	previous := service.Annotations[ServiceAnnotationLoadBalancerPreviousName]
+	if previous == "" {
+		return nil
+	}
+	loadBalancerName := aws.StringValue(loadBalancer.LoadBalancerName)
+	if previous != loadBalancerName {
+		switched := false
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			switched = switched || (ingress.Hostname != "" && ingress.Hostname == aws.StringValue(loadBalancer.DNSName))
+		}
+		if !switched {
+			return fmt.Errorf("waiting for the status of service %s/%s to switch to load balancer %s before deleting load balancer %s",
+				service.Namespace, service.Name, loadBalancerName, previous)
+		}
+		if err := c.deleteLoadBalancer(service, previous, false); err != nil {
+			return err
+		}
+		c.recordLoadBalancerEvent(service, EventLoadBalancerSchemeSwitch, "Deleted load balancer %s replaced by load balancer %s",
+			previous, loadBalancerName)
+	}
+	return c.patchSchemeSwitchAnnotations(service, map[string]interface{}{ServiceAnnotationLoadBalancerPreviousName: nil})
+}
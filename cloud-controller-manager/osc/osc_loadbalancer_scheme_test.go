@@ -0,0 +1,136 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAlternateLoadBalancerName(t *testing.T) {
+	assert.Equal(t, "lb-web-s", alternateLoadBalancerName("lb-web"))
+	long := strings.Repeat("a", 29) + "-bc"
+	assert.Equal(t, strings.Repeat("a", 29)+"-s", alternateLoadBalancerName(long))
+	assert.Len(t, alternateLoadBalancerName(strings.Repeat("a", 32)), 32)
+	assert.Equal(t, strings.Repeat("a", 30)+"-r", alternateLoadBalancerName(strings.Repeat("a", 30)+"-s"))
+}
+
+func TestEnsureLoadBalancerSchemeSwitch(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	c.vpcID = "vpc-123456"
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+	}) {
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			UID:         "anuid",
+			Annotations: map[string]string{ServiceAnnotationLoadBalancerName: "lb-web"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:            v1.ServiceTypeLoadBalancer,
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports:           []v1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(80), Protocol: "TCP", NodePort: 30080}},
+		},
+	}
+	client := fake.NewSimpleClientset(service)
+	c.kubeClient = client
+	loadBalancers := awsServices.elb.(*FakeELB).LoadBalancers
+	reconcile := func() (*v1.LoadBalancerStatus, error) {
+		current, err := client.CoreV1().Services("default").Get(context.TODO(), "web", metav1.GetOptions{})
+		require.NoError(t, err)
+		status, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, current, []*v1.Node{})
+		if err != nil {
+			return nil, err
+		}
+		// Like the service controller, the status is updated after the annotations set by the cloud provider
+		current, err = client.CoreV1().Services("default").Get(context.TODO(), "web", metav1.GetOptions{})
+		require.NoError(t, err)
+		current.Status.LoadBalancer = *status
+		_, err = client.CoreV1().Services("default").UpdateStatus(context.TODO(), current, metav1.UpdateOptions{})
+		require.NoError(t, err)
+		return status, nil
+	}
+
+	status, err := reconcile()
+	require.NoError(t, err)
+	assert.Equal(t, "lb-web", status.Ingress[0].Hostname)
+	loadBalancers = awsServices.elb.(*FakeELB).LoadBalancers
+	assert.Equal(t, loadBalancerSchemeInternetFacing, aws.StringValue(loadBalancers["lb-web"].Scheme))
+
+	// The scheme switch must be acknowledged
+	service, err = client.CoreV1().Services("default").Get(context.TODO(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	service.Annotations[ServiceAnnotationLoadBalancerInternal] = "true"
+	_, err = client.CoreV1().Services("default").Update(context.TODO(), service, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	_, err = reconcile()
+	assert.ErrorContains(t, err, ServiceAnnotationLoadBalancerSchemeSwitch)
+	assert.Len(t, loadBalancers, 1)
+
+	// The internal load balancer is created, the previous one is kept until the status switched
+	service.Annotations[ServiceAnnotationLoadBalancerSchemeSwitch] = "true"
+	_, err = client.CoreV1().Services("default").Update(context.TODO(), service, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	status, err = reconcile()
+	require.NoError(t, err)
+	assert.Equal(t, "lb-web-s", status.Ingress[0].Hostname)
+	assert.Equal(t, loadBalancerSchemeInternal, aws.StringValue(loadBalancers["lb-web-s"].Scheme))
+	assert.Contains(t, loadBalancers, "lb-web")
+	service, err = client.CoreV1().Services("default").Get(context.TODO(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "lb-web-s", service.Annotations[ServiceAnnotationLoadBalancerActiveName])
+	assert.Equal(t, "lb-web", service.Annotations[ServiceAnnotationLoadBalancerPreviousName])
+	assert.Equal(t, "lb-web-s", c.GetLoadBalancerName(context.TODO(), TestClusterName, service))
+
+	// The reconciliation triggered by the annotations deletes the previous load balancer
+	_, err = reconcile()
+	require.NoError(t, err)
+	assert.NotContains(t, loadBalancers, "lb-web")
+	service, err = client.CoreV1().Services("default").Get(context.TODO(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, service.Annotations, ServiceAnnotationLoadBalancerPreviousName)
+
+	// Switching back reuses the name of the service
+	service.Annotations[ServiceAnnotationLoadBalancerInternal] = "false"
+	_, err = client.CoreV1().Services("default").Update(context.TODO(), service, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	status, err = reconcile()
+	require.NoError(t, err)
+	assert.Equal(t, "lb-web", status.Ingress[0].Hostname)
+	assert.Equal(t, loadBalancerSchemeInternetFacing, aws.StringValue(loadBalancers["lb-web"].Scheme))
+}
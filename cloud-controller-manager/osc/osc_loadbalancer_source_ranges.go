@@ -0,0 +1,245 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+// ********************* CCM Source Ranges Ref *********************
+
+// sourceRangesRefIndex indexes the Services of the service informer by the ConfigMap of
+// their ServiceAnnotationLoadBalancerSourceRangesRef annotation, as namespace/name
+const sourceRangesRefIndex = "sourceRangesRef"
+
+// sourceRangesRef is the ConfigMap listing the source ranges of a load balancer
+type sourceRangesRef struct {
+	namespace string
+	name      string
+	// key is the named CIDR set of the ConfigMap, all the keys when empty
+	key string
+}
+
+// parseSourceRangesRef parses the ServiceAnnotationLoadBalancerSourceRangesRef annotation:
+// "<namespace>/<configmap>", optionally followed by ":<key>". The namespace defaults to the
+// namespace of the service.
+func parseSourceRangesRef(value string, namespace string) (*sourceRangesRef, error) {
+	ref := &sourceRangesRef{namespace: namespace}
+	name := strings.TrimSpace(value)
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name, ref.key = name[:i], name[i+1:]
+		if ref.key == "" {
+			return nil, fmt.Errorf("empty key in %q", value)
+		}
+	}
+	if i := strings.Index(name, "/"); i >= 0 {
+		ref.namespace, name = name[:i], name[i+1:]
+	}
+	ref.name = name
+	if ref.namespace == "" || ref.name == "" || strings.Contains(ref.name, "/") {
+		return nil, fmt.Errorf("expected <namespace>/<configmap>[:<key>], got %q", value)
+	}
+	return ref, nil
+}
+
+// String returns the namespace/name of the ConfigMap, the key of sourceRangesRefIndex
+func (r *sourceRangesRef) String() string {
+	return r.namespace + "/" + r.name
+}
+
+// sourceRanges returns the source ranges of the ConfigMap: the CIDRs of each key, separated
+// by commas or whitespace, with the lines starting with # ignored
+func (r *sourceRangesRef) sourceRanges(configMap *v1.ConfigMap) ([]string, error) {
+	keys := []string{}
+	if r.key != "" {
+		if _, found := configMap.Data[r.key]; !found {
+			return nil, fmt.Errorf("no key %q in ConfigMap %s", r.key, r)
+		}
+		keys = append(keys, r.key)
+	} else {
+		for key := range configMap.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+
+	ranges := []string{}
+	for _, key := range keys {
+		for _, line := range strings.Split(configMap.Data[key], "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			ranges = append(ranges, strings.FieldsFunc(line, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t' || r == '\r'
+			})...)
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no source range in ConfigMap %s", r)
+	}
+	return ranges, nil
+}
+
+// hasExplicitSourceRanges returns whether the service sets its own source ranges
+func hasExplicitSourceRanges(service *v1.Service) bool {
+	_, found := service.Annotations[v1.AnnotationLoadBalancerSourceRangesKey]
+	return len(service.Spec.LoadBalancerSourceRanges) > 0 || found
+}
+
+// getConfigMap returns the ConfigMap from the informer when it watches it, or from the API
+// server
+func (c *Cloud) getConfigMap(namespace string, name string) (*v1.ConfigMap, error) {
+	if c.configMapInformer != nil && c.configMapInformer.Informer().HasSynced() {
+		configMap, err := c.configMapInformer.Lister().ConfigMaps(namespace).Get(name)
+		if !apierrors.IsNotFound(err) {
+			return configMap, err
+		}
+	}
+	if c.kubeClient == nil {
+		return nil, fmt.Errorf("no client to read ConfigMap %s/%s", namespace, name)
+	}
+	return c.kubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// loadBalancerSourceRanges returns the source ranges allowed by the load balancer of the
+// service: the ranges of the ConfigMap of the ServiceAnnotationLoadBalancerSourceRangesRef
+// annotation, along with the ones of the service. A missing or empty ConfigMap fails the
+// reconciliation, rather than opening the load balancer.
+func (c *Cloud) loadBalancerSourceRanges(service *v1.Service, annotations map[string]string) (utilnet.IPNetSet, error) {
+	value, found := annotations[ServiceAnnotationLoadBalancerSourceRangesRef]
+	if !found {
+		return servicehelpers.GetLoadBalancerSourceRanges(service)
+	}
+	ref, err := parseSourceRangesRef(value, service.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", ServiceAnnotationLoadBalancerSourceRangesRef, err)
+	}
+	configMap, err := c.getConfigMap(ref.namespace, ref.name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the source ranges of ConfigMap %s: %v", ref, err)
+	}
+	ranges, err := ref.sourceRanges(configMap)
+	if err != nil {
+		return nil, err
+	}
+	if hasExplicitSourceRanges(service) {
+		serviceRanges, err := servicehelpers.GetLoadBalancerSourceRanges(service)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, serviceRanges.StringSlice()...)
+	}
+	sourceRanges, err := utilnet.ParseIPNets(ranges...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source ranges in ConfigMap %s: %v", ref, err)
+	}
+	return sourceRanges, nil
+}
+
+// indexServiceBySourceRangesRef is the sourceRangesRefIndex function: the Services of type
+// LoadBalancer reconciled by the cloud provider are indexed by the ConfigMap of their
+// source ranges
+func (c *Cloud) indexServiceBySourceRangesRef(obj interface{}) ([]string, error) {
+	service, ok := obj.(*v1.Service)
+	if !ok || service.Spec.Type != v1.ServiceTypeLoadBalancer || !c.managesLoadBalancerClass(service) {
+		return nil, nil
+	}
+	value, found := c.loadBalancerAnnotations(service)[ServiceAnnotationLoadBalancerSourceRangesRef]
+	if !found {
+		return nil, nil
+	}
+	ref, err := parseSourceRangesRef(value, service.Namespace)
+	if err != nil {
+		return nil, nil
+	}
+	return []string{ref.String()}, nil
+}
+
+// watchSourceRangesRefs resyncs the services referencing a ConfigMap when it changes
+func (c *Cloud) watchSourceRangesRefs() {
+	_, err := c.configMapInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.resyncSourceRangesRef(obj, false) },
+		UpdateFunc: func(_, obj interface{}) { c.resyncSourceRangesRef(obj, false) },
+		DeleteFunc: func(obj interface{}) { c.resyncSourceRangesRef(obj, true) },
+	})
+	if err != nil {
+		klog.Warningf("Error watching the ConfigMaps of the source ranges: %v", err)
+	}
+}
+
+// resyncSourceRangesRef triggers the reconciliation of the services referencing the
+// ConfigMap, which were not reconciled with its current version. The service controller
+// only reconciles a service when it changes, so the ServiceAnnotationLoadBalancerSourceRangesVersion
+// annotation is set to the resource version of the ConfigMap.
+func (c *Cloud) resyncSourceRangesRef(obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	configMap, ok := obj.(*v1.ConfigMap)
+	if !ok || c.serviceInformer == nil || c.kubeClient == nil {
+		return
+	}
+	version := configMap.ResourceVersion
+	if deleted {
+		version = "deleted"
+	}
+
+	key := configMap.Namespace + "/" + configMap.Name
+	services, err := c.serviceInformer.Informer().GetIndexer().ByIndex(sourceRangesRefIndex, key)
+	if err != nil {
+		klog.Warningf("Error listing the services referencing ConfigMap %s: %v", key, err)
+		return
+	}
+	for _, obj := range services {
+		service := obj.(*v1.Service)
+		if service.Annotations[ServiceAnnotationLoadBalancerSourceRangesVersion] == version {
+			continue
+		}
+		klog.Infof("Source ranges of ConfigMap %s changed, reconciling service %s/%s", key, service.Namespace, service.Name)
+		if err := c.setSourceRangesVersion(service, version); err != nil {
+			klog.Warningf("Unable to trigger the reconciliation of service %s/%s: %v", service.Namespace, service.Name, err)
+		}
+	}
+}
+
+// setSourceRangesVersion sets the ServiceAnnotationLoadBalancerSourceRangesVersion annotation
+func (c *Cloud) setSourceRangesVersion(service *v1.Service, version string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{ServiceAnnotationLoadBalancerSourceRangesVersion: version},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.kubeClient.CoreV1().Services(service.Namespace).Patch(context.TODO(), service.Name,
+		types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestParseSourceRangesRef(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected *sourceRangesRef
+	}{
+		{"infra/allowed", &sourceRangesRef{namespace: "infra", name: "allowed"}},
+		{"infra/allowed:office", &sourceRangesRef{namespace: "infra", name: "allowed", key: "office"}},
+		{"allowed", &sourceRangesRef{namespace: "default", name: "allowed"}},
+		{"infra/allowed:", nil},
+		{"infra/", nil},
+		{"a/b/c", nil},
+	}
+	for _, test := range tests {
+		ref, err := parseSourceRangesRef(test.value, "default")
+		if test.expected == nil {
+			assert.Error(t, err, test.value)
+			continue
+		}
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.expected, ref, test.value)
+	}
+}
+
+func TestLoadBalancerSourceRanges(t *testing.T) {
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "allowed", Namespace: "infra", ResourceVersion: "1"},
+		Data: map[string]string{
+			"office":   "# Paris and Nantes\n192.0.2.0/24, 198.51.100.0/24\n",
+			"partners": "203.0.113.0/24",
+			"empty":    "# none yet",
+		},
+	}
+	c := &Cloud{cfg: &CloudConfig{}, kubeClient: fake.NewSimpleClientset(configMap)}
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"}}
+
+	sourceRanges, err := c.loadBalancerSourceRanges(service, map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0.0.0.0/0"}, sourceRanges.StringSlice())
+
+	annotations := map[string]string{ServiceAnnotationLoadBalancerSourceRangesRef: "infra/allowed"}
+	sourceRanges, err = c.loadBalancerSourceRanges(service, annotations)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24"}, sourceRanges.StringSlice())
+
+	annotations[ServiceAnnotationLoadBalancerSourceRangesRef] = "infra/allowed:partners"
+	service.Spec.LoadBalancerSourceRanges = []string{"10.0.0.0/8"}
+	sourceRanges, err = c.loadBalancerSourceRanges(service, annotations)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"10.0.0.0/8", "203.0.113.0/24"}, sourceRanges.StringSlice())
+
+	// The load balancer is not opened when the ConfigMap doesn't list any source range
+	for _, value := range []string{"infra/allowed:empty", "infra/allowed:missing", "infra/missing", "allowed"} {
+		annotations[ServiceAnnotationLoadBalancerSourceRangesRef] = value
+		_, err = c.loadBalancerSourceRanges(service, annotations)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestResyncSourceRangesRef(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "allowed", Namespace: "infra", ResourceVersion: "2"},
+		Data:       map[string]string{"office": "192.0.2.0/24"},
+	}
+	newService := func(name string, ref string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "shop",
+				Annotations: map[string]string{ServiceAnnotationLoadBalancerSourceRangesRef: ref},
+			},
+			Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		}
+	}
+	web := newService("web", "infra/allowed:office")
+	api := newService("api", "infra/other")
+	c.kubeClient = fake.NewSimpleClientset(web, api)
+	c.SetInformers(informers.NewSharedInformerFactory(c.kubeClient, 0))
+	for _, service := range []*v1.Service{web, api} {
+		require.NoError(t, c.serviceInformer.Informer().GetIndexer().Add(service))
+	}
+
+	c.resyncSourceRangesRef(configMap, false)
+	service, err := c.kubeClient.CoreV1().Services("shop").Get(context.TODO(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "2", service.Annotations[ServiceAnnotationLoadBalancerSourceRangesVersion])
+	service, err = c.kubeClient.CoreV1().Services("shop").Get(context.TODO(), "api", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, service.Annotations, ServiceAnnotationLoadBalancerSourceRangesVersion)
+
+	c.resyncSourceRangesRef(configMap, true)
+	service, err = c.kubeClient.CoreV1().Services("shop").Get(context.TODO(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", service.Annotations[ServiceAnnotationLoadBalancerSourceRangesVersion])
+}
+
+func TestGetSourceRangesConfigMap(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	labeled := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "allowed", Namespace: "infra", Labels: map[string]string{LabelSourceRanges: ""}},
+		Data:       map[string]string{"office": "192.0.2.0/24"},
+	}
+	unlabeled := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "infra"},
+		Data:       map[string]string{"office": "198.51.100.0/24"},
+	}
+	c.kubeClient = fake.NewSimpleClientset(labeled, unlabeled)
+	c.SetInformers(informers.NewSharedInformerFactory(c.kubeClient, 0))
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.configMapInformer.Informer().Run(stop)
+	require.True(t, cache.WaitForCacheSync(stop, c.configMapInformer.Informer().HasSynced))
+
+	// Only the labeled ConfigMaps are watched
+	keys := c.configMapInformer.Informer().GetStore().ListKeys()
+	assert.Equal(t, []string{"infra/allowed"}, keys)
+
+	for name, expected := range map[string]string{"allowed": "192.0.2.0/24", "other": "198.51.100.0/24"} {
+		configMap, err := c.getConfigMap("infra", name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, configMap.Data["office"], name)
+	}
+	_, err = c.getConfigMap("infra", "missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer SSL Policy *********************
+
+// sslPolicy is the SSL negotiation policy of the SSL and HTTPS listeners of a load balancer
+type sslPolicy struct {
+	// name is the name of the policy on the load balancer, without SSLNegotiationPolicyNameFormat
+	name string
+	// attributes of the SSLNegotiationPolicyType policy
+	attributes []*elb.PolicyAttribute
+}
+
+// referenceSecurityPolicy returns the attributes of a policy following a predefined
+// security policy of LBU
+func referenceSecurityPolicy(name string) []*elb.PolicyAttribute {
+	return []*elb.PolicyAttribute{{
+		AttributeName:  aws.String("Reference-Security-Policy"),
+		AttributeValue: aws.String(name),
+	}}
+}
+
+// customSecurityPolicy returns the attributes of a policy enabling only the protocols and
+// ciphers, in the order of the server
+func customSecurityPolicy(protocolsAndCiphers ...string) []*elb.PolicyAttribute {
+	attributes := []*elb.PolicyAttribute{{
+		AttributeName:  aws.String("Server-Defined-Cipher-Order"),
+		AttributeValue: aws.String("true"),
+	}}
+	for _, name := range protocolsAndCiphers {
+		attributes = append(attributes, &elb.PolicyAttribute{
+			AttributeName:  aws.String(name),
+			AttributeValue: aws.String("true"),
+		})
+	}
+	return attributes
+}
+
+// sslPolicies are the predefined SSL negotiation policies of the
+// ServiceAnnotationLoadBalancerSSLPolicy annotation
+var sslPolicies = map[string][]*elb.PolicyAttribute{
+	// default follows the default security policy of LBU, TLS 1.0 to 1.2
+	"default": referenceSecurityPolicy("ELBSecurityPolicy-2016-08"),
+	// tls-1-1 disables TLS 1.0
+	"tls-1-1": referenceSecurityPolicy("ELBSecurityPolicy-TLS-1-1-2017-01"),
+	// tls-1-2 only accepts TLS 1.2
+	"tls-1-2": referenceSecurityPolicy("ELBSecurityPolicy-TLS-1-2-2017-01"),
+	// modern only accepts TLS 1.2 with the AEAD ciphers having forward secrecy
+	"modern": customSecurityPolicy("Protocol-TLSv1.2",
+		"ECDHE-ECDSA-AES128-GCM-SHA256", "ECDHE-RSA-AES128-GCM-SHA256",
+		"ECDHE-ECDSA-AES256-GCM-SHA384", "ECDHE-RSA-AES256-GCM-SHA384"),
+}
+
+// sslPolicyNames returns the names of the predefined SSL negotiation policies
+func sslPolicyNames() []string {
+	names := []string{}
+	for name := range sslPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseSSLPolicy parses the ServiceAnnotationLoadBalancerSSLPolicy annotation
+func parseSSLPolicy(value string) (*sslPolicy, error) {
+	attributes, found := sslPolicies[value]
+	if !found {
+		return nil, fmt.Errorf("unknown SSL policy %q, expected one of %v", value, sslPolicyNames())
+	}
+	return &sslPolicy{name: value, attributes: attributes}, nil
+}
+
+// getSSLPolicy returns the SSL negotiation policy of the service: the predefined policy of
+// the ServiceAnnotationLoadBalancerSSLPolicy annotation, which takes precedence over the
+// security policy of LBU named by the ServiceAnnotationLoadBalancerSSLNegotiationPolicy
+// annotation, or nil to use the default policy of LBU
+func getSSLPolicy(annotations map[string]string) (*sslPolicy, error) {
+	if value, found := annotations[ServiceAnnotationLoadBalancerSSLPolicy]; found {
+		policy, err := parseSSLPolicy(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", ServiceAnnotationLoadBalancerSSLPolicy, err)
+		}
+		if _, found := annotations[ServiceAnnotationLoadBalancerSSLNegotiationPolicy]; found {
+			klog.Warningf("Ignoring %s annotation, %s takes precedence",
+				ServiceAnnotationLoadBalancerSSLNegotiationPolicy, ServiceAnnotationLoadBalancerSSLPolicy)
+		}
+		return policy, nil
+	}
+	if value, found := annotations[ServiceAnnotationLoadBalancerSSLNegotiationPolicy]; found {
+		return &sslPolicy{name: value, attributes: referenceSecurityPolicy(value)}, nil
+	}
+	return nil, nil
+}
+
+// policyName returns the name of the policy on the load balancer
+func (p *sslPolicy) policyName() string {
+	return fmt.Sprintf(SSLNegotiationPolicyNameFormat, p.name)
+}
+
+// ensureSSLNegotiationPolicy creates the SSL negotiation policy on the load balancer, unless it exists
+func (c *Cloud) ensureSSLNegotiationPolicy(loadBalancer *elb.LoadBalancerDescription, policy *sslPolicy) error {
+	klog.V(5).Infof("ensureSSLNegotiationPolicy(%v,%v)", loadBalancer, policy.name)
+	klog.V(2).Info("Describing load balancer policies on load balancer")
+	result, err := c.loadBalancer.DescribeLoadBalancerPolicies(&elb.DescribeLoadBalancerPoliciesInput{
+		LoadBalancerName: loadBalancer.LoadBalancerName,
+		PolicyNames:      []*string{aws.String(policy.policyName())},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != elb.ErrCodePolicyNotFoundException {
+			return fmt.Errorf("error describing security policies on load balancer: %q", err)
+		}
+	} else if len(result.PolicyDescriptions) > 0 {
+		return nil
+	}
+
+	klog.V(2).Infof("Creating SSL negotiation policy '%s' on load balancer", policy.policyName())
+	// there is an upper limit of 98 policies on an ELB, we're pretty safe from
+	// running into it
+	_, err = c.loadBalancer.CreateLoadBalancerPolicy(&elb.CreateLoadBalancerPolicyInput{
+		LoadBalancerName: loadBalancer.LoadBalancerName,
+		PolicyName:       aws.String(policy.policyName()),
+		PolicyTypeName:   aws.String("SSLNegotiationPolicyType"),
+		PolicyAttributes: policy.attributes,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating security policy on load balancer: %q", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetSSLPolicy(t *testing.T) {
+	policy, err := getSSLPolicy(map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	policy, err = getSSLPolicy(map[string]string{ServiceAnnotationLoadBalancerSSLNegotiationPolicy: "ELBSecurityPolicy-2015-05"})
+	assert.NoError(t, err)
+	assert.Equal(t, "k8s-SSLNegotiationPolicy-ELBSecurityPolicy-2015-05", policy.policyName())
+	assert.Equal(t, referenceSecurityPolicy("ELBSecurityPolicy-2015-05"), policy.attributes)
+
+	// The predefined policies take precedence
+	policy, err = getSSLPolicy(map[string]string{
+		ServiceAnnotationLoadBalancerSSLNegotiationPolicy: "ELBSecurityPolicy-2015-05",
+		ServiceAnnotationLoadBalancerSSLPolicy:            "tls-1-2",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "k8s-SSLNegotiationPolicy-tls-1-2", policy.policyName())
+	assert.Equal(t, referenceSecurityPolicy("ELBSecurityPolicy-TLS-1-2-2017-01"), policy.attributes)
+
+	_, err = getSSLPolicy(map[string]string{ServiceAnnotationLoadBalancerSSLPolicy: "tls-1-3"})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"default", "modern", "tls-1-1", "tls-1-2"}, sslPolicyNames())
+}
+
+func TestEnsureListenerSSLPolicies(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	fakeELB := awsServices.elb.(*FakeELB)
+
+	loadBalancer := &elb.LoadBalancerDescription{
+		LoadBalancerName: aws.String("lb"),
+		ListenerDescriptions: []*elb.ListenerDescription{
+			{Listener: &elb.Listener{Protocol: aws.String("HTTPS"), LoadBalancerPort: aws.Int64(443)}},
+			{Listener: &elb.Listener{Protocol: aws.String("SSL"), LoadBalancerPort: aws.Int64(8443)}},
+			{Listener: &elb.Listener{Protocol: aws.String("HTTP"), LoadBalancerPort: aws.Int64(80)}},
+		},
+	}
+	fakeELB.LoadBalancers = map[string]*elb.LoadBalancerDescription{"lb": loadBalancer}
+	policies := func() map[int64][]string {
+		result := map[int64][]string{}
+		for _, listener := range loadBalancer.ListenerDescriptions {
+			result[aws.Int64Value(listener.Listener.LoadBalancerPort)] = aws.StringValueSlice(listener.PolicyNames)
+		}
+		return result
+	}
+	service := &v1.Service{}
+
+	require.NoError(t, c.ensureListenerPolicies(service, loadBalancer, map[string]string{ServiceAnnotationLoadBalancerSSLPolicy: "modern"}))
+	require.Contains(t, fakeELB.Policies["lb"], "k8s-SSLNegotiationPolicy-modern")
+	created := fakeELB.Policies["lb"]["k8s-SSLNegotiationPolicy-modern"]
+	assert.Equal(t, "SSLNegotiationPolicyType", aws.StringValue(created.PolicyTypeName))
+	assert.Equal(t, sslPolicies["modern"], created.PolicyAttributes)
+	assert.Equal(t, map[int64][]string{
+		443:  {"k8s-SSLNegotiationPolicy-modern"},
+		8443: {"k8s-SSLNegotiationPolicy-modern"},
+		80:   {},
+	}, policies())
+
+	// Changing the policy replaces it on the listeners
+	require.NoError(t, c.ensureListenerPolicies(service, loadBalancer, map[string]string{ServiceAnnotationLoadBalancerSSLPolicy: "tls-1-2"}))
+	assert.Equal(t, []string{"k8s-SSLNegotiationPolicy-tls-1-2"}, policies()[443])
+	assert.Equal(t, []string{"k8s-SSLNegotiationPolicy-tls-1-2"}, policies()[8443])
+
+	// Removing the annotation restores the default policy of LBU
+	require.NoError(t, c.ensureListenerPolicies(service, loadBalancer, map[string]string{}))
+	assert.Equal(t, map[int64][]string{443: {}, 8443: {}, 80: {}}, policies())
+}
@@ -0,0 +1,422 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Status *********************
+
+// oscLoadBalancerResource is the resource of the OSCLoadBalancer custom resources, see
+// deploy/k8s-osc-ccm/crds
+var oscLoadBalancerResource = schema.GroupVersionResource{
+	Group:    "cloudprovider.outscale.com",
+	Version:  "v1alpha1",
+	Resource: "oscloadbalancers",
+}
+
+// OSCLoadBalancerKind is the kind of the custom resources mirroring the load balancers
+const OSCLoadBalancerKind = "OSCLoadBalancer"
+
+// Conditions of the OSCLoadBalancer custom resources
+const (
+	// LoadBalancerConditionReconciled is whether the last reconciliation of the load balancer succeeded
+	LoadBalancerConditionReconciled = "Reconciled"
+	// LoadBalancerConditionInSync is whether the load balancer matches the state derived from the service
+	LoadBalancerConditionInSync = "InSync"
+)
+
+// oscLoadBalancerSpec is the spec of an OSCLoadBalancer, named after its service
+type oscLoadBalancerSpec struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// oscLoadBalancerStatus is the status of an OSCLoadBalancer, the observed state of the load
+// balancer of its service
+type oscLoadBalancerStatus struct {
+	LoadBalancerName   string                     `json:"loadBalancerName"`
+	DNSName            string                     `json:"dnsName,omitempty"`
+	Scheme             string                     `json:"scheme,omitempty"`
+	Listeners          []oscLoadBalancerListener  `json:"listeners,omitempty"`
+	SecurityGroups     []string                   `json:"securityGroups,omitempty"`
+	Backends           []oscLoadBalancerBackend   `json:"backends,omitempty"`
+	Attributes         *oscLoadBalancerAttributes `json:"attributes,omitempty"`
+	Drift              []string                   `json:"drift,omitempty"`
+	LastReconcileTime  *metav1.Time               `json:"lastReconcileTime,omitempty"`
+	LastReconcileError string                     `json:"lastReconcileError,omitempty"`
+	Conditions         []metav1.Condition         `json:"conditions,omitempty"`
+}
+
+type oscLoadBalancerListener struct {
+	Port             int64  `json:"port"`
+	Protocol         string `json:"protocol"`
+	InstancePort     int64  `json:"instancePort"`
+	InstanceProtocol string `json:"instanceProtocol"`
+	SSLCertificateID string `json:"sslCertificateId,omitempty"`
+}
+
+type oscLoadBalancerBackend struct {
+	VMID  string `json:"vmId"`
+	State string `json:"state"`
+}
+
+type oscLoadBalancerAttributes struct {
+	CrossZone                 bool   `json:"crossZone"`
+	ConnectionDraining        bool   `json:"connectionDraining"`
+	ConnectionDrainingTimeout int64  `json:"connectionDrainingTimeout,omitempty"`
+	IdleTimeout               int64  `json:"idleTimeout,omitempty"`
+	AccessLog                 bool   `json:"accessLog"`
+	AccessLogBucket           string `json:"accessLogBucket,omitempty"`
+}
+
+// loadBalancerReconciliation is the result of the last reconciliation of a load balancer
+type loadBalancerReconciliation struct {
+	time metav1.Time
+	err  error
+}
+
+// loadBalancerStatusController periodically mirrors the load balancers of the services in
+// OSCLoadBalancer custom resources named after the services and owned by them, so that the
+// operators and the GitOps tools can observe and alert on the state of the load balancers
+// without cloud credentials. Only the status of the resources changing is written.
+type loadBalancerStatusController struct {
+	cloud    *Cloud
+	interval time.Duration
+	client   dynamic.Interface
+
+	mutex sync.Mutex
+	// Last reconciliation by service since the start of the CCM
+	reconciliations map[types.NamespacedName]loadBalancerReconciliation
+}
+
+func newLoadBalancerStatusController(cloud *Cloud, interval time.Duration) *loadBalancerStatusController {
+	return &loadBalancerStatusController{
+		cloud:           cloud,
+		interval:        interval,
+		reconciliations: make(map[types.NamespacedName]loadBalancerReconciliation),
+	}
+}
+
+// setClient builds the client of the custom resources when the controller is enabled
+func (s *loadBalancerStatusController) setClient(clientBuilder cloudprovider.ControllerClientBuilder) {
+	if s == nil || s.interval <= 0 {
+		return
+	}
+	config, err := clientBuilder.Config("aws-cloud-provider")
+	if err == nil {
+		s.client, err = dynamic.NewForConfig(config)
+	}
+	if err != nil {
+		klog.Warningf("Unable to build the client of the %s resources: %v", OSCLoadBalancerKind, err)
+	}
+}
+
+// reconciled records the result of a reconciliation of the load balancer of the service
+func (s *loadBalancerStatusController) reconciled(service *v1.Service, err error) {
+	if s == nil || s.interval <= 0 || service == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.reconciliations[types.NamespacedName{Namespace: service.Namespace, Name: service.Name}] = loadBalancerReconciliation{
+		time: metav1.NewTime(time.Now()),
+		err:  err,
+	}
+}
+
+// forget drops the reconciliation of the load balancer of a deleted service, its resource
+// being deleted with it
+func (s *loadBalancerStatusController) forget(service *v1.Service) {
+	if s == nil || service == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.reconciliations, types.NamespacedName{Namespace: service.Namespace, Name: service.Name})
+}
+
+// run mirrors the load balancers every interval until stop is closed
+func (s *loadBalancerStatusController) run(stop <-chan struct{}) {
+	if s == nil || s.interval <= 0 {
+		return
+	}
+
+	klog.Infof("Starting the %s status (interval %v)", OSCLoadBalancerKind, s.interval)
+	go wait.Until(s.sync, s.interval, stop)
+}
+
+// sync mirrors the load balancers of the services, and deletes the resources of the services
+// no longer having a load balancer
+func (s *loadBalancerStatusController) sync() {
+	c := s.cloud
+	if c.kubeClient == nil || s.client == nil {
+		return
+	}
+
+	services, err := c.kubeClient.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		klog.Warningf("Unable to list services for the %s status: %q", OSCLoadBalancerKind, err)
+		return
+	}
+
+	current := map[types.NamespacedName]bool{}
+	for i := range services.Items {
+		service := &services.Items[i]
+		if !s.isMirrored(service) {
+			continue
+		}
+		serviceName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+		current[serviceName] = true
+		status, err := s.observe(service)
+		if err != nil {
+			klog.Warningf("Unable to observe the load balancer of service %v: %v", serviceName, err)
+			continue
+		}
+		if err := s.update(service, status); err != nil {
+			klog.Warningf("Unable to update the %s of service %v: %v", OSCLoadBalancerKind, serviceName, err)
+		}
+	}
+
+	s.mutex.Lock()
+	for serviceName := range s.reconciliations {
+		if !current[serviceName] {
+			delete(s.reconciliations, serviceName)
+		}
+	}
+	s.mutex.Unlock()
+
+	resources, err := s.client.Resource(oscLoadBalancerResource).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		klog.Warningf("Unable to list the %s resources: %v", OSCLoadBalancerKind, err)
+		return
+	}
+	for _, resource := range resources.Items {
+		serviceName := types.NamespacedName{Namespace: resource.GetNamespace(), Name: resource.GetName()}
+		if current[serviceName] {
+			continue
+		}
+		klog.V(2).Infof("Deleting the %s of service %v, which no longer has a load balancer", OSCLoadBalancerKind, serviceName)
+		err := s.client.Resource(oscLoadBalancerResource).Namespace(serviceName.Namespace).Delete(context.TODO(),
+			serviceName.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			klog.Warningf("Unable to delete the %s of service %v: %v", OSCLoadBalancerKind, serviceName, err)
+		}
+	}
+}
+
+// isMirrored returns whether the load balancer of the service is mirrored: the services of
+// type LoadBalancer reconciled by the cloud provider, not in dry run
+func (s *loadBalancerStatusController) isMirrored(service *v1.Service) bool {
+	c := s.cloud
+	if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil ||
+		!c.managesLoadBalancerClass(service) {
+		return false
+	}
+	dryRun, err := c.isLoadBalancerDryRun(c.loadBalancerAnnotations(service))
+	return err == nil && !dryRun
+}
+
+// observe returns the status of the load balancer of the service, the conditions being set
+// by update
+func (s *loadBalancerStatusController) observe(service *v1.Service) (*oscLoadBalancerStatus, error) {
+	c := s.cloud
+	loadBalancerName := c.GetLoadBalancerName(context.TODO(), "", service)
+	status := &oscLoadBalancerStatus{LoadBalancerName: loadBalancerName}
+	loadBalancer, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	if loadBalancer == nil {
+		// The load balancer of a service not provisioned yet is not missing
+		if len(service.Status.LoadBalancer.Ingress) > 0 {
+			status.Drift = []string{fmt.Sprintf("load balancer %s is missing", loadBalancerName)}
+		}
+		return status, nil
+	}
+
+	status.DNSName = aws.StringValue(loadBalancer.DNSName)
+	status.Scheme = aws.StringValue(loadBalancer.Scheme)
+	for _, listenerDescription := range loadBalancer.ListenerDescriptions {
+		listener := listenerDescription.Listener
+		if listener == nil {
+			continue
+		}
+		status.Listeners = append(status.Listeners, oscLoadBalancerListener{
+			Port:             aws.Int64Value(listener.LoadBalancerPort),
+			Protocol:         aws.StringValue(listener.Protocol),
+			InstancePort:     aws.Int64Value(listener.InstancePort),
+			InstanceProtocol: aws.StringValue(listener.InstanceProtocol),
+			SSLCertificateID: aws.StringValue(listener.SSLCertificateId),
+		})
+	}
+	sort.Slice(status.Listeners, func(i, j int) bool { return status.Listeners[i].Port < status.Listeners[j].Port })
+	status.SecurityGroups = aws.StringValueSlice(loadBalancer.SecurityGroups)
+	sort.Strings(status.SecurityGroups)
+
+	health, err := c.loadBalancerService.describeLoadBalancerInstancesHealth(loadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range loadBalancer.Instances {
+		vmID := aws.StringValue(instance.InstanceId)
+		state := health[vmID]
+		if state == "" {
+			state = "Unknown"
+		}
+		status.Backends = append(status.Backends, oscLoadBalancerBackend{VMID: vmID, State: state})
+	}
+	sort.Slice(status.Backends, func(i, j int) bool { return status.Backends[i].VMID < status.Backends[j].VMID })
+
+	output, err := c.loadBalancer.DescribeLoadBalancerAttributes(&elb.DescribeLoadBalancerAttributesInput{
+		LoadBalancerName: aws.String(loadBalancerName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing the attributes of load balancer %s: %q", loadBalancerName, err)
+	}
+	status.Attributes = newOSCLoadBalancerAttributes(output.LoadBalancerAttributes)
+
+	if status.Drift, err = c.driftDetector.compare(service, loadBalancer); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// newOSCLoadBalancerAttributes returns the status of the attributes of a load balancer
+func newOSCLoadBalancerAttributes(attributes *elb.LoadBalancerAttributes) *oscLoadBalancerAttributes {
+	if attributes == nil {
+		return nil
+	}
+	status := &oscLoadBalancerAttributes{}
+	if attributes.CrossZoneLoadBalancing != nil {
+		status.CrossZone = aws.BoolValue(attributes.CrossZoneLoadBalancing.Enabled)
+	}
+	if attributes.ConnectionDraining != nil {
+		status.ConnectionDraining = aws.BoolValue(attributes.ConnectionDraining.Enabled)
+		status.ConnectionDrainingTimeout = aws.Int64Value(attributes.ConnectionDraining.Timeout)
+	}
+	if attributes.ConnectionSettings != nil {
+		status.IdleTimeout = aws.Int64Value(attributes.ConnectionSettings.IdleTimeout)
+	}
+	if attributes.AccessLog != nil {
+		status.AccessLog = aws.BoolValue(attributes.AccessLog.Enabled)
+		status.AccessLogBucket = aws.StringValue(attributes.AccessLog.S3BucketName)
+	}
+	return status
+}
+
+// update creates or updates the OSCLoadBalancer of the service with the status. The result
+// of the last reconciliation is kept from the current status when the service was not
+// reconciled since the start of the CCM.
+func (s *loadBalancerStatusController) update(service *v1.Service, status *oscLoadBalancerStatus) error {
+	resources := s.client.Resource(oscLoadBalancerResource).Namespace(service.Namespace)
+	resource, err := resources.Get(context.TODO(), service.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		resource, err = resources.Create(context.TODO(), newOSCLoadBalancer(service), metav1.CreateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	previous := oscLoadBalancerStatus{}
+	currentStatus, _, err := unstructured.NestedMap(resource.Object, "status")
+	if err != nil {
+		return err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(currentStatus, &previous); err != nil {
+		return err
+	}
+	status.Conditions = previous.Conditions
+
+	s.mutex.Lock()
+	reconciliation, found := s.reconciliations[types.NamespacedName{Namespace: service.Namespace, Name: service.Name}]
+	s.mutex.Unlock()
+	if found {
+		status.LastReconcileTime = &reconciliation.time
+		condition := metav1.Condition{Type: LoadBalancerConditionReconciled, Status: metav1.ConditionTrue, Reason: "Reconciled"}
+		switch {
+		case errors.Is(reconciliation.err, ErrLoadBalancerIsNotReady):
+			condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "NotReady", reconciliation.err.Error()
+		case reconciliation.err != nil:
+			status.LastReconcileError = reconciliation.err.Error()
+			condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "Failed", status.LastReconcileError
+		}
+		meta.SetStatusCondition(&status.Conditions, condition)
+	} else {
+		status.LastReconcileTime = previous.LastReconcileTime
+		status.LastReconcileError = previous.LastReconcileError
+	}
+	condition := metav1.Condition{Type: LoadBalancerConditionInSync, Status: metav1.ConditionTrue, Reason: "InSync"}
+	if len(status.Drift) > 0 {
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "Drifted", strings.Join(status.Drift, ", ")
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	desiredStatus, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+	if err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(currentStatus, desiredStatus) {
+		return nil
+	}
+	if err := unstructured.SetNestedMap(resource.Object, desiredStatus, "status"); err != nil {
+		return err
+	}
+	_, err = resources.UpdateStatus(context.TODO(), resource, metav1.UpdateOptions{})
+	return err
+}
+
+// newOSCLoadBalancer returns the OSCLoadBalancer of the service, owned by it so that it is
+// deleted with it
+func newOSCLoadBalancer(service *v1.Service) *unstructured.Unstructured {
+	resource := &unstructured.Unstructured{}
+	resource.SetAPIVersion(oscLoadBalancerResource.GroupVersion().String())
+	resource.SetKind(OSCLoadBalancerKind)
+	resource.SetNamespace(service.Namespace)
+	resource.SetName(service.Name)
+	resource.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: "v1",
+		Kind:       "Service",
+		Name:       service.Name,
+		UID:        service.UID,
+	}})
+	spec, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(&oscLoadBalancerSpec{ServiceName: service.Name})
+	resource.Object["spec"] = spec
+	return resource
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newFakeLoadBalancerStatusClient() *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{oscLoadBalancerResource: OSCLoadBalancerKind + "List"})
+}
+
+func getOSCLoadBalancerStatus(t *testing.T, client *dynamicfake.FakeDynamicClient, name string) oscLoadBalancerStatus {
+	resource, err := client.Resource(oscLoadBalancerResource).Namespace("default").Get(context.TODO(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	status := oscLoadBalancerStatus{}
+	content, _, _ := unstructured.NestedMap(resource.Object, "status")
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(content, &status))
+	return status
+}
+
+func countStatusUpdates(client *dynamicfake.FakeDynamicClient) int {
+	updates := 0
+	for _, action := range client.Actions() {
+		if action.Matches("update", oscLoadBalancerResource.Resource) && action.(clienttesting.UpdateAction).GetSubresource() == "status" {
+			updates++
+		}
+	}
+	return updates
+}
+
+func TestLoadBalancerStatusController(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	c.loadBalancerStatus = newLoadBalancerStatusController(c, time.Minute)
+	service := newFakeAPIService("web")
+	_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	name := c.GetLoadBalancerName(context.TODO(), TestClusterName, service)
+	lb, _ := s.LoadBalancer(name)
+	service.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: *lb.DNSName}}
+	clusterIP := newFakeAPIService("internal")
+	clusterIP.Spec.Type = v1.ServiceTypeClusterIP
+	c.kubeClient = fake.NewSimpleClientset(service, clusterIP)
+	client := newFakeLoadBalancerStatusClient()
+	c.loadBalancerStatus.client = client
+
+	c.loadBalancerStatus.sync()
+	resource, err := client.Resource(oscLoadBalancerResource).Namespace("default").Get(context.TODO(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, resource.GetOwnerReferences(), 1)
+	assert.Equal(t, service.UID, resource.GetOwnerReferences()[0].UID)
+	_, err = client.Resource(oscLoadBalancerResource).Namespace("default").Get(context.TODO(), "internal", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	status := getOSCLoadBalancerStatus(t, client, "web")
+	assert.Equal(t, name, status.LoadBalancerName)
+	assert.Equal(t, []oscLoadBalancerListener{{Port: 80, Protocol: "TCP", InstancePort: 30080, InstanceProtocol: "TCP"}}, status.Listeners)
+	assert.Len(t, status.SecurityGroups, 1)
+	require.Len(t, status.Backends, 1)
+	assert.Equal(t, "Unknown", status.Backends[0].State)
+	assert.NotNil(t, status.Attributes)
+	assert.Empty(t, status.Drift)
+	assert.NotNil(t, status.LastReconcileTime)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, LoadBalancerConditionReconciled))
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, LoadBalancerConditionInSync))
+
+	// The status is only written when it changes
+	updates := countStatusUpdates(client)
+	c.loadBalancerStatus.sync()
+	assert.Equal(t, updates, countStatusUpdates(client))
+
+	c.loadBalancerStatus.reconciled(service, errors.New("no subnet"))
+	_, err = c.loadBalancer.DeleteLoadBalancer(&elb.DeleteLoadBalancerInput{LoadBalancerName: aws.String(name)})
+	require.NoError(t, err)
+	c.loadBalancerStatus.sync()
+	status = getOSCLoadBalancerStatus(t, client, "web")
+	assert.Equal(t, "no subnet", status.LastReconcileError)
+	assert.Equal(t, []string{"load balancer " + name + " is missing"}, status.Drift)
+	condition := meta.FindStatusCondition(status.Conditions, LoadBalancerConditionReconciled)
+	require.NotNil(t, condition)
+	assert.Equal(t, "Failed", condition.Reason)
+	assert.True(t, meta.IsStatusConditionFalse(status.Conditions, LoadBalancerConditionInSync))
+
+	// The resource of a service no longer having a load balancer is deleted
+	service.Spec.Type = v1.ServiceTypeClusterIP
+	_, err = c.kubeClient.CoreV1().Services("default").Update(context.TODO(), service, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	c.loadBalancerStatus.sync()
+	_, err = client.Resource(oscLoadBalancerResource).Namespace("default").Get(context.TODO(), "web", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestLoadBalancerStatusControllerDisabled(t *testing.T) {
+	var unset *loadBalancerStatusController
+	unset.reconciled(newFakeAPIService("web"), nil)
+	unset.forget(newFakeAPIService("web"))
+	unset.run(make(chan struct{}))
+
+	controller := newLoadBalancerStatusController(nil, 0)
+	controller.reconciled(newFakeAPIService("web"), nil)
+	assert.Empty(t, controller.reconciliations)
+}
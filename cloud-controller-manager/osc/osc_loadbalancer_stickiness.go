@@ -0,0 +1,270 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elb"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Stickiness *********************
+
+const (
+	// StickinessPolicyLBCookie is the stickiness policy following a cookie generated by
+	// the load balancer
+	StickinessPolicyLBCookie = "lb-cookie"
+	// StickinessPolicyAppCookie is the stickiness policy following a cookie of the application
+	StickinessPolicyAppCookie = "app-cookie"
+	// stickinessPolicyNamePrefix is the prefix of the names of the stickiness policies
+	// created by the cloud provider. The policies of LBU can't be modified, a new policy is
+	// created whenever the stickiness of the service changes.
+	stickinessPolicyNamePrefix = "k8s-stickiness-"
+)
+
+// stickinessPolicy is the cookie stickiness of the HTTP and HTTPS listeners of a load balancer
+type stickinessPolicy struct {
+	kind string
+	// cookieName is the cookie of the application of the app-cookie policy
+	cookieName string
+	// expiration is the lifetime in seconds of the cookie of the lb-cookie policy, 0 for
+	// the browser session
+	expiration int64
+}
+
+// parseStickinessCookieExpiration parses the ServiceAnnotationLoadBalancerStickinessCookieExpiration
+// annotation
+func parseStickinessCookieExpiration(value string) (int64, error) {
+	expiration, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || expiration < 1 {
+		return 0, fmt.Errorf("expected a positive number of seconds")
+	}
+	return expiration, nil
+}
+
+// getStickinessPolicy returns the stickiness of the service: the one of the
+// ServiceAnnotationLoadBalancerStickinessPolicy annotation, or a lb-cookie policy lasting
+// the timeout of the session affinity of the service when it is ClientIP, or nil
+func getStickinessPolicy(service *v1.Service, annotations map[string]string) (*stickinessPolicy, error) {
+	kind, found := annotations[ServiceAnnotationLoadBalancerStickinessPolicy]
+	if !found {
+		if service.Spec.SessionAffinity != v1.ServiceAffinityClientIP {
+			return nil, nil
+		}
+		// The client IP is hidden by the load balancer, a cookie is used instead
+		policy := &stickinessPolicy{kind: StickinessPolicyLBCookie, expiration: int64(v1.DefaultClientIPServiceAffinitySeconds)}
+		if config := service.Spec.SessionAffinityConfig; config != nil && config.ClientIP != nil && config.ClientIP.TimeoutSeconds != nil {
+			policy.expiration = int64(*config.ClientIP.TimeoutSeconds)
+		}
+		return policy, nil
+	}
+
+	policy := &stickinessPolicy{kind: kind}
+	switch kind {
+	case StickinessPolicyLBCookie:
+		if value, found := annotations[ServiceAnnotationLoadBalancerStickinessCookieExpiration]; found {
+			expiration, err := parseStickinessCookieExpiration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s annotation: %v", ServiceAnnotationLoadBalancerStickinessCookieExpiration, err)
+			}
+			policy.expiration = expiration
+		}
+	case StickinessPolicyAppCookie:
+		policy.cookieName = annotations[ServiceAnnotationLoadBalancerStickinessCookieName]
+		if policy.cookieName == "" {
+			return nil, fmt.Errorf("the %s stickiness policy requires the %s annotation",
+				StickinessPolicyAppCookie, ServiceAnnotationLoadBalancerStickinessCookieName)
+		}
+	default:
+		return nil, fmt.Errorf("unknown stickiness policy %q of annotation %s, expected %s or %s", kind,
+			ServiceAnnotationLoadBalancerStickinessPolicy, StickinessPolicyLBCookie, StickinessPolicyAppCookie)
+	}
+	return policy, nil
+}
+
+// name returns the name of the policy, derived from its settings so that a changed
+// stickiness gets a new policy
+func (p *stickinessPolicy) name() string {
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%s/%s/%d", p.kind, p.cookieName, p.expiration)
+	return fmt.Sprintf("%s%s-%08x", stickinessPolicyNamePrefix, p.kind, hash.Sum32())
+}
+
+// isHTTPListener returns whether the stickiness policies apply to the listener protocol
+func isHTTPListener(protocol string) bool {
+	protocol = strings.ToUpper(protocol)
+	return protocol == "HTTP" || protocol == "HTTPS"
+}
+
+// hasHTTPListener returns whether one of the listeners is an HTTP or HTTPS listener
+func hasHTTPListener(listeners []*elb.Listener) bool {
+	for _, listener := range listeners {
+		if isHTTPListener(aws.StringValue(listener.Protocol)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureStickinessPolicy creates the stickiness policy on the load balancer, unless it exists
+func (c *Cloud) ensureStickinessPolicy(loadBalancerName string, policy *stickinessPolicy) error {
+	klog.V(5).Infof("ensureStickinessPolicy(%v,%v)", loadBalancerName, policy)
+	result, err := c.loadBalancer.DescribeLoadBalancerPolicies(&elb.DescribeLoadBalancerPoliciesInput{
+		LoadBalancerName: aws.String(loadBalancerName),
+		PolicyNames:      []*string{aws.String(policy.name())},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != elb.ErrCodePolicyNotFoundException {
+			return fmt.Errorf("error describing stickiness policies on load balancer: %q", err)
+		}
+	} else if len(result.PolicyDescriptions) > 0 {
+		return nil
+	}
+
+	klog.V(2).Infof("Creating %s stickiness policy %s on load balancer %s", policy.kind, policy.name(), loadBalancerName)
+	if policy.kind == StickinessPolicyAppCookie {
+		_, err = c.loadBalancer.CreateAppCookieStickinessPolicy(&elb.CreateAppCookieStickinessPolicyInput{
+			LoadBalancerName: aws.String(loadBalancerName),
+			PolicyName:       aws.String(policy.name()),
+			CookieName:       aws.String(policy.cookieName),
+		})
+	} else {
+		input := &elb.CreateLBCookieStickinessPolicyInput{
+			LoadBalancerName: aws.String(loadBalancerName),
+			PolicyName:       aws.String(policy.name()),
+		}
+		if policy.expiration > 0 {
+			input.CookieExpirationPeriod = aws.Int64(policy.expiration)
+		}
+		_, err = c.loadBalancer.CreateLBCookieStickinessPolicy(input)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating stickiness policy on load balancer: %q", err)
+	}
+	return nil
+}
+
+// ensureListenerPolicies sets the policies of the listeners of the load balancer which
+// are managed by the cloud provider: the SSL negotiation policy of the SSL and HTTPS
+// listeners, and the stickiness policy of the HTTP and HTTPS listeners. The policies of a
+// listener are replaced at once, so they are computed together, and only the listeners
+// whose policies changed are updated. The policies removed from the annotations are
+// removed from the listeners, the other policies of the listeners are kept.
+func (c *Cloud) ensureListenerPolicies(service *v1.Service, loadBalancer *elb.LoadBalancerDescription,
+	annotations map[string]string) error {
+	klog.V(5).Infof("ensureListenerPolicies(%v)", aws.StringValue(loadBalancer.LoadBalancerName))
+	loadBalancerName := aws.StringValue(loadBalancer.LoadBalancerName)
+
+	ssl, err := getSSLPolicy(annotations)
+	if err != nil {
+		return err
+	}
+	if ssl != nil {
+		if err := c.ensureSSLNegotiationPolicy(loadBalancer, ssl); err != nil {
+			return err
+		}
+	}
+	stickiness, err := getStickinessPolicy(service, annotations)
+	if err != nil {
+		return err
+	}
+	if stickiness != nil {
+		if err := c.ensureStickinessPolicy(loadBalancerName, stickiness); err != nil {
+			return err
+		}
+	}
+
+	sslPolicyPrefix := strings.TrimSuffix(SSLNegotiationPolicyNameFormat, "%s")
+	referenced := sets.NewString()
+	for _, listenerDescription := range loadBalancer.ListenerDescriptions {
+		listener := listenerDescription.Listener
+		if listener == nil {
+			continue
+		}
+		protocol := strings.ToUpper(aws.StringValue(listener.Protocol))
+		current := aws.StringValueSlice(listenerDescription.PolicyNames)
+		desired := []string{}
+		for _, policyName := range current {
+			if strings.HasPrefix(policyName, stickinessPolicyNamePrefix) ||
+				strings.HasPrefix(policyName, sslPolicyPrefix) {
+				continue
+			}
+			desired = append(desired, policyName)
+		}
+		if ssl != nil && (protocol == "SSL" || protocol == "HTTPS") {
+			desired = append(desired, ssl.policyName())
+		}
+		if stickiness != nil && isHTTPListener(protocol) {
+			desired = append(desired, stickiness.name())
+		}
+		referenced.Insert(desired...)
+		if sets.NewString(current...).Equal(sets.NewString(desired...)) {
+			continue
+		}
+
+		port := aws.Int64Value(listener.LoadBalancerPort)
+		klog.V(2).Infof("Setting the policies %v of listener %d of load balancer %s", desired, port, loadBalancerName)
+		_, err := c.loadBalancer.SetLoadBalancerPoliciesOfListener(&elb.SetLoadBalancerPoliciesOfListenerInput{
+			LoadBalancerName: aws.String(loadBalancerName),
+			LoadBalancerPort: aws.Int64(port),
+			PolicyNames:      aws.StringSlice(desired),
+		})
+		if err != nil {
+			return fmt.Errorf("error setting the policies of listener %d on load balancer: %q", port, err)
+		}
+	}
+	return c.deleteStickinessPolicies(loadBalancer, referenced)
+}
+
+// deleteStickinessPolicies deletes the stickiness policies of the load balancer created by the
+// cloud provider which are no longer referenced by its listeners, superseded by a changed
+// stickiness or removed with it
+func (c *Cloud) deleteStickinessPolicies(loadBalancer *elb.LoadBalancerDescription, referenced sets.String) error {
+	if loadBalancer.Policies == nil {
+		return nil
+	}
+	loadBalancerName := aws.StringValue(loadBalancer.LoadBalancerName)
+	names := []string{}
+	for _, policy := range loadBalancer.Policies.LBCookieStickinessPolicies {
+		names = append(names, aws.StringValue(policy.PolicyName))
+	}
+	for _, policy := range loadBalancer.Policies.AppCookieStickinessPolicies {
+		names = append(names, aws.StringValue(policy.PolicyName))
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, stickinessPolicyNamePrefix) || referenced.Has(name) {
+			continue
+		}
+		klog.V(2).Infof("Deleting stickiness policy %s of load balancer %s", name, loadBalancerName)
+		_, err := c.loadBalancer.DeleteLoadBalancerPolicy(&elb.DeleteLoadBalancerPolicyInput{
+			LoadBalancerName: aws.String(loadBalancerName),
+			PolicyName:       aws.String(name),
+		})
+		if err != nil {
+			return fmt.Errorf("error deleting stickiness policy %s of load balancer: %q", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetStickinessPolicy(t *testing.T) {
+	service := &v1.Service{}
+	policy, err := getStickinessPolicy(service, map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	// The ClientIP affinity is followed with a cookie of the load balancer
+	service.Spec.SessionAffinity = v1.ServiceAffinityClientIP
+	policy, err = getStickinessPolicy(service, map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, &stickinessPolicy{kind: StickinessPolicyLBCookie, expiration: 10800}, policy)
+	timeout := int32(60)
+	service.Spec.SessionAffinityConfig = &v1.SessionAffinityConfig{ClientIP: &v1.ClientIPConfig{TimeoutSeconds: &timeout}}
+	policy, err = getStickinessPolicy(service, map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(60), policy.expiration)
+
+	// The annotations take precedence over the affinity
+	policy, err = getStickinessPolicy(service, map[string]string{
+		ServiceAnnotationLoadBalancerStickinessPolicy:     StickinessPolicyAppCookie,
+		ServiceAnnotationLoadBalancerStickinessCookieName: "SESSIONID",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &stickinessPolicy{kind: StickinessPolicyAppCookie, cookieName: "SESSIONID"}, policy)
+	policy, err = getStickinessPolicy(service, map[string]string{
+		ServiceAnnotationLoadBalancerStickinessPolicy: StickinessPolicyLBCookie,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &stickinessPolicy{kind: StickinessPolicyLBCookie}, policy)
+
+	for _, annotations := range []map[string]string{
+		{ServiceAnnotationLoadBalancerStickinessPolicy: "source-ip"},
+		{ServiceAnnotationLoadBalancerStickinessPolicy: StickinessPolicyAppCookie},
+		{
+			ServiceAnnotationLoadBalancerStickinessPolicy:           StickinessPolicyLBCookie,
+			ServiceAnnotationLoadBalancerStickinessCookieExpiration: "0",
+		},
+	} {
+		_, err := getStickinessPolicy(service, annotations)
+		assert.Error(t, err, annotations)
+	}
+
+	// The name changes with the settings of the policy
+	a := &stickinessPolicy{kind: StickinessPolicyLBCookie, expiration: 60}
+	b := &stickinessPolicy{kind: StickinessPolicyLBCookie, expiration: 120}
+	assert.Equal(t, a.name(), (&stickinessPolicy{kind: StickinessPolicyLBCookie, expiration: 60}).name())
+	assert.NotEqual(t, a.name(), b.name())
+	assert.Regexp(t, "^k8s-stickiness-lb-cookie-", a.name())
+}
+
+func TestEnsureListenerPolicies(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	fakeELB := awsServices.elb.(*FakeELB)
+
+	loadBalancer := &elb.LoadBalancerDescription{
+		LoadBalancerName: aws.String("lb"),
+		ListenerDescriptions: []*elb.ListenerDescription{
+			{Listener: &elb.Listener{Protocol: aws.String("HTTP"), LoadBalancerPort: aws.Int64(80)}},
+			{Listener: &elb.Listener{Protocol: aws.String("TCP"), LoadBalancerPort: aws.Int64(5432)},
+				PolicyNames: aws.StringSlice([]string{"custom"})},
+		},
+	}
+	fakeELB.LoadBalancers = map[string]*elb.LoadBalancerDescription{"lb": loadBalancer}
+	policies := func(port int) []string {
+		for _, listener := range loadBalancer.ListenerDescriptions {
+			if aws.Int64Value(listener.Listener.LoadBalancerPort) == int64(port) {
+				return aws.StringValueSlice(listener.PolicyNames)
+			}
+		}
+		return nil
+	}
+
+	service := &v1.Service{}
+	annotations := map[string]string{
+		ServiceAnnotationLoadBalancerStickinessPolicy:     StickinessPolicyAppCookie,
+		ServiceAnnotationLoadBalancerStickinessCookieName: "SESSIONID",
+	}
+	policy, err := getStickinessPolicy(service, annotations)
+	require.NoError(t, err)
+	require.NoError(t, c.ensureListenerPolicies(service, loadBalancer, annotations))
+	require.Contains(t, fakeELB.Policies["lb"], policy.name())
+	assert.Equal(t, "AppCookieStickinessPolicyType", aws.StringValue(fakeELB.Policies["lb"][policy.name()].PolicyTypeName))
+	assert.Equal(t, []string{policy.name()}, policies(80))
+	assert.Equal(t, []string{"custom"}, policies(5432))
+
+	// Up to date listeners are left untouched
+	loadBalancer.ListenerDescriptions[0].PolicyNames = aws.StringSlice([]string{policy.name()})
+	delete(fakeELB.LoadBalancers, "lb")
+	require.NoError(t, c.ensureListenerPolicies(service, loadBalancer, annotations))
+	fakeELB.LoadBalancers = map[string]*elb.LoadBalancerDescription{"lb": loadBalancer}
+
+	// The stickiness is removed with its annotations, the other policies are kept
+	loadBalancer.ListenerDescriptions[0].PolicyNames = aws.StringSlice([]string{"custom", policy.name()})
+	loadBalancer.Policies = &elb.Policies{
+		AppCookieStickinessPolicies: []*elb.AppCookieStickinessPolicy{{PolicyName: aws.String(policy.name())}},
+		LBCookieStickinessPolicies:  []*elb.LBCookieStickinessPolicy{{PolicyName: aws.String("custom-cookie")}},
+	}
+	fakeELB.Policies["lb"]["custom-cookie"] = &elb.CreateLoadBalancerPolicyInput{PolicyName: aws.String("custom-cookie")}
+	require.NoError(t, c.ensureListenerPolicies(service, loadBalancer, map[string]string{}))
+	assert.Equal(t, []string{"custom"}, policies(80))
+	assert.Equal(t, []string{"custom"}, policies(5432))
+
+	// The stickiness policy no longer referenced is deleted, not the policies of other tools
+	assert.NotContains(t, fakeELB.Policies["lb"], policy.name())
+	assert.Contains(t, fakeELB.Policies["lb"], "custom-cookie")
+}
+
+func TestStickinessPolicyReplaced(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	service := newFakeAPIService("web")
+	service.Annotations = map[string]string{
+		ServiceAnnotationLoadBalancerBEProtocol:                 "http",
+		ServiceAnnotationLoadBalancerStickinessPolicy:           StickinessPolicyLBCookie,
+		ServiceAnnotationLoadBalancerStickinessCookieExpiration: "60",
+	}
+	name := c.GetLoadBalancerName(context.TODO(), TestClusterName, service)
+	stickinessPolicies := func() []string {
+		lb, found := s.LoadBalancer(name)
+		require.True(t, found)
+		names := []string{}
+		for _, policy := range lb.Policies.LBCookieStickinessPolicies {
+			names = append(names, aws.StringValue(policy.PolicyName))
+		}
+		return names
+	}
+
+	_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	first := stickinessPolicies()
+	require.Len(t, first, 1)
+
+	// The superseded policy is deleted once the listener uses the new one
+	service.Annotations[ServiceAnnotationLoadBalancerStickinessCookieExpiration] = "120"
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	second := stickinessPolicies()
+	require.Len(t, second, 1)
+	assert.NotEqual(t, first, second)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Tags *********************
+
+// isReservedLoadBalancerTag returns whether the tag is set by the cloud provider itself, and
+// can't be set or removed with the ServiceAnnotationLoadBalancerAdditionalTags annotation
+func isReservedLoadBalancerTag(key string) bool {
+	return key == TagNameKubernetesService || key == TagNameKubernetesClusterLegacy ||
+		strings.HasPrefix(key, "OscK8s")
+}
+
+// loadBalancerAdditionalTags returns the tags of the ServiceAnnotationLoadBalancerAdditionalTags
+// annotation, without the reserved tags
+func loadBalancerAdditionalTags(annotations map[string]string) map[string]string {
+	tags := getLoadBalancerAdditionalTags(annotations)
+	for key := range tags {
+		if isReservedLoadBalancerTag(key) {
+			klog.Warningf("Ignoring reserved tag %q of annotation %s", key, ServiceAnnotationLoadBalancerAdditionalTags)
+			delete(tags, key)
+		}
+	}
+	return tags
+}
+
+// additionalTagKeys returns the TagNameAdditionalTags value recording the keys of the tags
+func additionalTagKeys(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// reconcileLoadBalancerTags makes the additional tags of the load balancer match the
+// ServiceAnnotationLoadBalancerAdditionalTags annotation: the tags of the annotation are added
+// or updated, and the tags previously set from the annotation and since removed from it are
+// removed. The other tags, e.g. set by users on the load balancer, are left untouched.
+func (c *Cloud) reconcileLoadBalancerTags(loadBalancerName string, annotations map[string]string) error {
+	klog.V(5).Infof("reconcileLoadBalancerTags(%v,%v)", loadBalancerName, annotations)
+	current, err := c.loadBalancerService.describeLoadBalancerTags(loadBalancerName)
+	if err != nil {
+		return err
+	}
+	if phase, found := current[TagNameResumeHint]; found {
+		c.shutdown.resumeHint(loadBalancerName, phase)
+	}
+
+	desired := loadBalancerAdditionalTags(annotations)
+	added := make(map[string]string)
+	for key, value := range desired {
+		if currentValue, found := current[key]; !found || currentValue != value {
+			added[key] = value
+		}
+	}
+	managed := additionalTagKeys(desired)
+	previous, recorded := current[TagNameAdditionalTags]
+	if previous != managed {
+		added[TagNameAdditionalTags] = managed
+	}
+
+	removed := []string{}
+	for _, key := range strings.Split(previous, ",") {
+		if _, found := desired[key]; !found && key != "" && !isReservedLoadBalancerTag(key) {
+			if _, tagged := current[key]; tagged {
+				removed = append(removed, key)
+			}
+		}
+	}
+	if managed == "" && recorded {
+		removed = append(removed, TagNameAdditionalTags)
+		delete(added, TagNameAdditionalTags)
+	}
+
+	if len(added) > 0 {
+		klog.V(2).Infof("Updating the tags %v of load balancer %s", sets.StringKeySet(added).List(), loadBalancerName)
+		if err := c.loadBalancerService.addLoadBalancerTags(loadBalancerName, added); err != nil {
+			return fmt.Errorf("unable to update additional load balancer tags: %v", err)
+		}
+	}
+	if len(removed) > 0 {
+		sort.Strings(removed)
+		klog.V(2).Infof("Removing the tags %v of load balancer %s", removed, loadBalancerName)
+		if err := c.loadBalancerService.removeLoadBalancerTags(loadBalancerName, removed); err != nil {
+			return fmt.Errorf("unable to remove additional load balancer tags: %v", err)
+		}
+	}
+	return nil
+}
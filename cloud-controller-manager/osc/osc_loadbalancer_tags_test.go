@@ -0,0 +1,80 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBalancerAdditionalTags(t *testing.T) {
+	tags := loadBalancerAdditionalTags(map[string]string{
+		ServiceAnnotationLoadBalancerAdditionalTags: "team=web,OscK8sClusterID/other=owned,kubernetes.io/service-name=x,env",
+	})
+	assert.Equal(t, map[string]string{"team": "web", "env": ""}, tags)
+	assert.Equal(t, "env,team", additionalTagKeys(tags))
+}
+
+func TestReconcileLoadBalancerTags(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	fakeELB := awsServices.elb.(*FakeELB)
+	_, err = fakeELB.CreateLoadBalancer(&elb.CreateLoadBalancerInput{
+		LoadBalancerName: aws.String("lb-web"),
+		Tags: []*elb.Tag{
+			{Key: aws.String(TagNameKubernetesService), Value: aws.String("default/web")},
+			{Key: aws.String("owner"), Value: aws.String("user")},
+		},
+	})
+	assert.NoError(t, err)
+
+	reconcile := func(additionalTags string) map[string]string {
+		err := c.reconcileLoadBalancerTags("lb-web", map[string]string{
+			ServiceAnnotationLoadBalancerAdditionalTags: additionalTags,
+		})
+		assert.NoError(t, err)
+		tags, err := c.loadBalancerService.describeLoadBalancerTags("lb-web")
+		assert.NoError(t, err)
+		return tags
+	}
+
+	assert.Equal(t, map[string]string{
+		TagNameKubernetesService: "default/web",
+		"owner":                  "user",
+		"team":                   "web",
+		"env":                    "prod",
+		TagNameAdditionalTags:    "env,team",
+	}, reconcile("team=web,env=prod"))
+
+	// Changed tags are updated, removed tags are removed, user tags are left untouched
+	assert.Equal(t, map[string]string{
+		TagNameKubernetesService: "default/web",
+		"owner":                  "user",
+		"team":                   "api",
+		TagNameAdditionalTags:    "team",
+	}, reconcile("team=api"))
+
+	assert.Equal(t, map[string]string{
+		TagNameKubernetesService: "default/web",
+		"owner":                  "user",
+	}, reconcile(""))
+}
@@ -20,11 +20,20 @@ limitations under the License.
 package osc
 
 import (
+	"context"
+	"fmt"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestElbProtocolsAreEqual(t *testing.T) {
@@ -263,3 +272,180 @@ func TestElbListenersAreEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestFindSecurityGroupBySelector(t *testing.T) {
+	clusterTag := osc.ResourceTag{Key: fmt.Sprintf("%s%s", TagNameKubernetesClusterPrefix, TestClusterID), Value: "owned"}
+	sg := func(id string, tags ...osc.ResourceTag) osc.SecurityGroup {
+		return osc.SecurityGroup{SecurityGroupId: aws.String(id), Tags: &tags}
+	}
+	roleTag := osc.ResourceTag{Key: "role", Value: "lb"}
+	otherRoleTag := osc.ResourceTag{Key: "role", Value: "other"}
+
+	tests := []struct {
+		name        string
+		selector    map[string]string
+		groups      []osc.SecurityGroup
+		expectedID  string
+		errExpected bool
+	}{
+		{
+			name:       "single match",
+			selector:   map[string]string{"role": "lb"},
+			groups:     []osc.SecurityGroup{sg("sg-1", roleTag), sg("sg-2", otherRoleTag)},
+			expectedID: "sg-1",
+		},
+		{
+			name:       "key only selector",
+			selector:   map[string]string{"role": ""},
+			groups:     []osc.SecurityGroup{sg("sg-1", roleTag), sg("sg-2")},
+			expectedID: "sg-1",
+		},
+		{
+			name:        "no match",
+			selector:    map[string]string{"role": "lb"},
+			groups:      []osc.SecurityGroup{sg("sg-2", otherRoleTag)},
+			errExpected: true,
+		},
+		{
+			name:       "cluster tagged group wins",
+			selector:   map[string]string{"role": "lb"},
+			groups:     []osc.SecurityGroup{sg("sg-1", roleTag), sg("sg-2", roleTag, clusterTag)},
+			expectedID: "sg-2",
+		},
+		{
+			name:        "ambiguous match",
+			selector:    map[string]string{"role": "lb"},
+			groups:      []osc.SecurityGroup{sg("sg-1", roleTag), sg("sg-2", roleTag)},
+			errExpected: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			awsServices := newMockedFakeAWSServices(TestClusterID)
+			c, err := newCloud(CloudConfig{}, awsServices)
+			assert.NoError(t, err)
+			compute := awsServices.compute.(*MockedFakeCompute)
+			compute.On("ReadSecurityGroups", mock.Anything).Return(test.groups)
+			compute.SecurityGroups = test.groups
+
+			id, err := c.securityGroupService.findSecurityGroupBySelector(test.selector)
+			if test.errExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedID, id)
+				// The selected security group is protected from deletion by a tag
+				assert.True(t, isSelectedSecurityGroup(compute.resourceTags(id)))
+			}
+		})
+	}
+}
+
+func TestParseLoadBalancerSubnetIDs(t *testing.T) {
+	candidates := []string{"subnet-a", "subnet-b", "subnet-c"}
+
+	ids, err := parseLoadBalancerSubnetIDs(" subnet-c, subnet-a,subnet-c ", candidates)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"subnet-a", "subnet-c"}, ids)
+
+	_, err = parseLoadBalancerSubnetIDs("subnet-a,subnet-d", candidates)
+	assert.Error(t, err)
+
+	_, err = parseLoadBalancerSubnetIDs(" , ", candidates)
+	assert.Error(t, err)
+}
+
+func TestMultipleSubnetIDsAnnotation(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		maxSubnets      int
+		createError     error
+		expectedSubnets []string
+	}{
+		{
+			name:            "the load balancer is created in all the subnets",
+			expectedSubnets: []string{"subnet-a0000001", "subnet-b0000001"},
+		},
+		{
+			name:            "the load balancer falls back to the first subnet",
+			maxSubnets:      1,
+			expectedSubnets: []string{"subnet-a0000001"},
+		},
+		{
+			name:        "the load balancer does not fall back on other errors",
+			createError: awserr.New("Throttling", "rate exceeded", nil),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			awsServices := NewFakeAWSServices(TestClusterID)
+			c, err := newCloud(CloudConfig{}, awsServices)
+			assert.NoError(t, err)
+			c.vpcID = "vpc-123456"
+			awsServices.elb.(*FakeELB).MaxSubnets = test.maxSubnets
+			awsServices.elb.(*FakeELB).CreateLoadBalancerError = test.createError
+
+			awsServices.compute.RemoveSubnets()
+			for _, subnet := range constructSubnets(map[int]map[string]string{
+				0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+				1: {"id": "subnet-b0000001", "az": "af-south-1b"},
+			}) {
+				awsServices.compute.CreateSubnet(subnet)
+			}
+			awsServices.compute.RemoveRouteTables()
+			for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true, "subnet-b0000001": true}) {
+				awsServices.compute.CreateRouteTable(rt)
+			}
+
+			service := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "myservice",
+					UID:  "anuid",
+					Annotations: map[string]string{
+						ServiceAnnotationLoadBalancerSubnetIDs: "subnet-b0000001,subnet-a0000001",
+					},
+				},
+				Spec: v1.ServiceSpec{
+					SessionAffinity: v1.ServiceAffinityNone,
+					Ports:           []v1.ServicePort{{Port: 8383, TargetPort: intstr.FromInt(80), Protocol: "TCP", NodePort: 4040}},
+				},
+			}
+			res, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+			if test.createError != nil {
+				assert.Equal(t, test.createError, err)
+				assert.Empty(t, awsServices.elb.(*FakeELB).LoadBalancers)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			lb := awsServices.elb.(*FakeELB).LoadBalancers[res.Ingress[0].Hostname]
+			assert.Equal(t, test.expectedSubnets, aws.StringValueSlice(lb.Subnets))
+		})
+	}
+}
+
+func TestCrossZoneLoadBalancingAttribute(t *testing.T) {
+	attributes, err := getLoadBalancerAttributes(map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, attributes.CrossZoneLoadBalancing, "left untouched without annotation")
+
+	attributes, err = getLoadBalancerAttributes(map[string]string{
+		ServiceAnnotationLoadBalancerCrossZoneEnabled: "true",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &elb.CrossZoneLoadBalancing{Enabled: aws.Bool(true)}, attributes.CrossZoneLoadBalancing)
+
+	attributes, err = getLoadBalancerAttributes(map[string]string{
+		ServiceAnnotationLoadBalancerCrossZoneEnabled:              "false",
+		ServiceAnnotationLoadBalancerCrossZoneLoadBalancingEnabled: "true",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &elb.CrossZoneLoadBalancing{Enabled: aws.Bool(false)}, attributes.CrossZoneLoadBalancing)
+
+	_, err = getLoadBalancerAttributes(map[string]string{
+		ServiceAnnotationLoadBalancerCrossZoneEnabled: "yes please",
+	})
+	assert.Error(t, err)
+}
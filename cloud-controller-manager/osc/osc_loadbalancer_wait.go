@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Wait For Ready *********************
+
+// maxLoadBalancerReadyTimeoutSeconds bounds the wait, which holds a service controller worker
+const maxLoadBalancerReadyTimeoutSeconds = 600
+
+// loadBalancerReadyPollInterval is the interval between two checks of a load balancer
+// being waited for
+var loadBalancerReadyPollInterval = 5 * time.Second
+
+// getLoadBalancerReadyTimeout returns how long EnsureLoadBalancer waits for the load balancer
+// to be ready: the ServiceAnnotationLoadBalancerReadyTimeout annotation, or else the
+// LoadBalancerReadyTimeoutSeconds of the cloud config
+func (c *Cloud) getLoadBalancerReadyTimeout(annotations map[string]string) (time.Duration, error) {
+	if value, found := annotations[ServiceAnnotationLoadBalancerReadyTimeout]; found {
+		return parseLoadBalancerReadyTimeout(value)
+	}
+	return time.Duration(c.cfg.Global.LoadBalancerReadyTimeoutSeconds) * time.Second, nil
+}
+
+// parseLoadBalancerReadyTimeout parses the ServiceAnnotationLoadBalancerReadyTimeout annotation
+func parseLoadBalancerReadyTimeout(value string) (time.Duration, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 || seconds > maxLoadBalancerReadyTimeoutSeconds {
+		return 0, fmt.Errorf("error parsing service annotation: %s=%s, expected seconds between 0 and %d",
+			ServiceAnnotationLoadBalancerReadyTimeout, value, maxLoadBalancerReadyTimeoutSeconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// waitForLoadBalancerReady polls the load balancer until it has a DNS name and, when backends
+// are registered, one of them is InService, reporting the progress in the events of the
+// service. It returns the last description of the load balancer, and a not ready error on
+// timeout so that the service controller retries.
+func (c *Cloud) waitForLoadBalancerReady(ctx context.Context, service *v1.Service, loadBalancerName string,
+	lb *elb.LoadBalancerDescription, timeout time.Duration) (*elb.LoadBalancerDescription, error) {
+	klog.V(5).Infof("waitForLoadBalancerReady(%v, %v, %v)", loadBalancerName, lb, timeout)
+	if timeout <= 0 {
+		return lb, nil
+	}
+
+	start := time.Now()
+	progress := ""
+	waited := false
+	err := wait.PollImmediateWithContext(ctx, loadBalancerReadyPollInterval, timeout, func(ctx context.Context) (bool, error) {
+		current, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
+		if err != nil {
+			return false, err
+		}
+		if current == nil {
+			return false, fmt.Errorf("load balancer %s not found", loadBalancerName)
+		}
+		lb = current
+
+		status := "no DNS name yet"
+		ready := false
+		if aws.StringValue(lb.DNSName) != "" {
+			inService, registered, err := c.countInServiceInstances(loadBalancerName, lb)
+			if err != nil {
+				return false, err
+			}
+			status = fmt.Sprintf("%d/%d backends in service", inService, registered)
+			ready = registered == 0 || inService > 0
+		}
+		if !ready && status != progress {
+			klog.V(2).Infof("Waiting for load balancer %s: %s", loadBalancerName, status)
+			if c.eventRecorder != nil {
+				c.eventRecorder.Eventf(service, v1.EventTypeNormal, "WaitingForLoadBalancer",
+					"Waiting for load balancer %s: %s", loadBalancerName, status)
+			}
+			waited = true
+		}
+		progress = status
+		return ready, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return lb, newLoadBalancerNotReadyError(loadBalancerName, NotReadyWaitingForState,
+			"%s after %v", progress, timeout)
+	}
+	if err != nil {
+		return lb, err
+	}
+
+	if c.eventRecorder != nil && waited {
+		c.eventRecorder.Eventf(service, v1.EventTypeNormal, "LoadBalancerReady",
+			"Load balancer %s is ready after %v: %s", loadBalancerName, time.Since(start).Round(time.Second), progress)
+	}
+	return lb, nil
+}
+
+// countInServiceInstances returns the number of backends of the load balancer reported
+// InService, and the number of registered backends
+func (c *Cloud) countInServiceInstances(loadBalancerName string, lb *elb.LoadBalancerDescription) (int, int, error) {
+	if len(lb.Instances) == 0 {
+		return 0, 0, nil
+	}
+	health, err := c.loadBalancerService.describeLoadBalancerInstancesHealth(loadBalancerName)
+	if err != nil {
+		return 0, 0, err
+	}
+	inService := 0
+	for _, state := range health {
+		if state == "InService" {
+			inService++
+		}
+	}
+	return inService, len(lb.Instances), nil
+}
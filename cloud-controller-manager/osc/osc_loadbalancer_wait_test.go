@@ -0,0 +1,83 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetLoadBalancerReadyTimeout(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	timeout, err := c.getLoadBalancerReadyTimeout(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), timeout)
+
+	c.cfg.Global.LoadBalancerReadyTimeoutSeconds = 120
+	timeout, err = c.getLoadBalancerReadyTimeout(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, timeout)
+
+	timeout, err = c.getLoadBalancerReadyTimeout(map[string]string{ServiceAnnotationLoadBalancerReadyTimeout: "0"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), timeout)
+
+	for _, value := range []string{"-1", "601", "1m"} {
+		_, err = c.getLoadBalancerReadyTimeout(map[string]string{ServiceAnnotationLoadBalancerReadyTimeout: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestWaitForLoadBalancerReady(t *testing.T) {
+	defer func(interval time.Duration) { loadBalancerReadyPollInterval = interval }(loadBalancerReadyPollInterval)
+	loadBalancerReadyPollInterval = 10 * time.Millisecond
+
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	c.eventRecorder = recorder
+	fakeELB := awsServices.elb.(*FakeELB)
+	_, err = fakeELB.CreateLoadBalancer(&elb.CreateLoadBalancerInput{LoadBalancerName: aws.String("lb-web")})
+	assert.NoError(t, err)
+	fakeELB.LoadBalancers["lb-web"].Instances = []*elb.Instance{{InstanceId: aws.String("i-a")}, {InstanceId: aws.String("i-b")}}
+	fakeELB.InstanceHealth = map[string]string{"i-a": "OutOfService", "i-b": "OutOfService"}
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+
+	_, err = c.waitForLoadBalancerReady(context.TODO(), service, "lb-web", nil, 50*time.Millisecond)
+	assert.True(t, errors.Is(err, ErrLoadBalancerIsNotReady), "%v", err)
+	assert.Contains(t, <-recorder.Events, "0/2 backends in service")
+
+	fakeELB.InstanceHealth["i-b"] = "InService"
+	lb, err := c.waitForLoadBalancerReady(context.TODO(), service, "lb-web", nil, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "lb-web", aws.StringValue(lb.DNSName))
+	assert.Empty(t, recorder.Events, "no event when the load balancer is ready right away")
+}
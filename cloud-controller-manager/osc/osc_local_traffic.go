@@ -0,0 +1,257 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Local Traffic Policy Functions *********************
+
+// healthCheckNodePortFromTarget returns the node port of an HTTP health check
+// configured for a Service with externalTrafficPolicy Local, or 0
+func healthCheckNodePortFromTarget(healthCheck *elb.HealthCheck) int32 {
+	if healthCheck == nil {
+		return 0
+	}
+	target := aws.StringValue(healthCheck.Target)
+	if !strings.HasPrefix(target, "HTTP:") || !strings.HasSuffix(target, "/healthz") {
+		return 0
+	}
+	port, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(target, "HTTP:"), "/healthz"), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(port)
+}
+
+// healthCheckNodePortRule returns the rule allowing the load balancer to reach the
+// health check node port
+func healthCheckNodePortRule(loadBalancerSecurityGroupID string, port int32) osc.SecurityGroupRule {
+	return osc.SecurityGroupRule{
+		IpProtocol:            aws.String("tcp"),
+		FromPortRange:         &port,
+		ToPortRange:           &port,
+		SecurityGroupsMembers: &[]osc.SecurityGroupsMember{{SecurityGroupId: &loadBalancerSecurityGroupID}},
+	}
+}
+
+// ensureHealthCheckNodePortIngress opens the health check node port of the service from the
+// load balancer on the security groups of the instances, and revokes the rule of the
+// previous health check node port when it changed.
+// Setting port to 0 only revokes the previous rule.
+func (c *Cloud) ensureHealthCheckNodePortIngress(lb *elb.LoadBalancerDescription,
+	instances map[InstanceID]*osc.Vm, securityGroupIDs []string, port int32, previous int32) error {
+	klog.V(5).Infof("ensureHealthCheckNodePortIngress(%v, %v, %v, %v, %v)", lb, instances, securityGroupIDs, port, previous)
+
+	if c.cfg.Global.DisableSecurityGroupIngress || (port == 0 && previous == 0) {
+		return nil
+	}
+
+	loadBalancerSecurityGroupID, err := loadBalancerSecurityGroup(lb, securityGroupIDs)
+	if err != nil {
+		return err
+	}
+	if loadBalancerSecurityGroupID == DefaultSrcSgName {
+		// In the public cloud the whole load balancer security group is linked to the instances
+		return nil
+	}
+
+	if previous != 0 && previous != port {
+		describeRequest := osc.ReadSecurityGroupsRequest{
+			Filters: &osc.FiltersSecurityGroup{
+				InboundRuleSecurityGroupIds: &[]string{loadBalancerSecurityGroupID},
+			},
+		}
+		response, err := c.compute.ReadSecurityGroups(&describeRequest)
+		if err != nil {
+			return fmt.Errorf("error querying security groups for ELB: %q", err)
+		}
+		permissions := []osc.SecurityGroupRule{healthCheckNodePortRule(loadBalancerSecurityGroupID, previous)}
+		for _, sg := range response {
+			if !c.tagging.hasClusterTag(sg.Tags) {
+				continue
+			}
+			klog.V(2).Infof("Removing rule for health check node port %d from the load balancer (%s) to instances (%s)",
+				previous, loadBalancerSecurityGroupID, sg.GetSecurityGroupId())
+			_, err := c.securityGroupService.removeSecurityGroupRules(sg.GetSecurityGroupId(), &permissions, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if port == 0 || len(instances) == 0 {
+		return nil
+	}
+
+	taggedSecurityGroups, err := c.securityGroupService.getTaggedSecurityGroups()
+	if err != nil {
+		return fmt.Errorf("error querying for tagged security groups: %q", err)
+	}
+	instanceSecurityGroupIDs := sets.NewString()
+	for _, instance := range instances {
+		securityGroup, err := findSecurityGroupForInstance(instance, taggedSecurityGroups, c.nodePortNic)
+		if err != nil {
+			return err
+		}
+		if securityGroup == nil || securityGroup.GetSecurityGroupId() == "" {
+			continue
+		}
+		instanceSecurityGroupIDs.Insert(securityGroup.GetSecurityGroupId())
+	}
+
+	permissions := []osc.SecurityGroupRule{healthCheckNodePortRule(loadBalancerSecurityGroupID, port)}
+	for _, securityGroupID := range instanceSecurityGroupIDs.List() {
+		changed, err := c.securityGroupService.addSecurityGroupRules(securityGroupID, &permissions, false)
+		if err != nil {
+			return err
+		}
+		if changed {
+			klog.V(2).Infof("Added rule for health check node port %d from the load balancer (%s) to instances (%s)",
+				port, loadBalancerSecurityGroupID, securityGroupID)
+		}
+	}
+	return nil
+}
+
+// filterLocalEndpointInstances drops the instances of the nodes without a ready local
+// endpoint for a Service with externalTrafficPolicy Local, when enabled in the cloud config.
+// The endpoints are read from the EndpointSlice informer, which resyncs the backends when
+// they move, see watchLocalEndpoints. The instances are kept as they are when the endpoints
+// are not synced yet or when no node has a local endpoint.
+func (c *Cloud) filterLocalEndpointInstances(service *v1.Service, nodes []*v1.Node,
+	instances map[InstanceID]*osc.Vm) map[InstanceID]*osc.Vm {
+	klog.V(5).Infof("filterLocalEndpointInstances(%v, %v, %v)", service, nodes, instances)
+
+	if !c.cfg.Global.DeregisterNodesWithoutLocalEndpoints || c.endpointSliceInformer == nil {
+		return instances
+	}
+	if path, _ := servicehelpers.GetServiceHealthCheckPathPort(service); path == "" {
+		return instances
+	}
+	if c.endpointSliceInformerHasSynced != nil && !c.endpointSliceInformerHasSynced() {
+		klog.V(2).Infof("Endpoints not synced yet, keeping all the backends of service %s/%s", service.Namespace, service.Name)
+		return instances
+	}
+
+	slices, err := c.endpointSliceInformer.Lister().EndpointSlices(service.Namespace).List(
+		labels.SelectorFromSet(labels.Set{discovery.LabelServiceName: service.Name}))
+	if err != nil {
+		klog.Warningf("Unable to list the endpoints of service %s/%s: %q", service.Namespace, service.Name, err)
+		return instances
+	}
+
+	nodeNames := sets.NewString()
+	for _, slice := range slices {
+		nodeNames = nodeNames.Union(readyEndpointNodes(slice))
+	}
+
+	localNodes := []*v1.Node{}
+	for _, node := range nodes {
+		if nodeNames.Has(node.Name) {
+			localNodes = append(localNodes, node)
+		}
+	}
+
+	filtered := make(map[InstanceID]*osc.Vm)
+	for _, id := range mapToAWSInstanceIDsTolerant(localNodes) {
+		if vm, ok := instances[id]; ok {
+			filtered[id] = vm
+		}
+	}
+	if len(filtered) == 0 {
+		klog.V(2).Infof("No node has a local endpoint for service %s/%s, keeping all the backends", service.Namespace, service.Name)
+		return instances
+	}
+	klog.V(4).Infof("Nodes with local endpoints for service %s/%s: %v", service.Namespace, service.Name, nodeNames.List())
+	return filtered
+}
+
+// readyEndpointNodes returns the nodes of the ready endpoints of the slice
+func readyEndpointNodes(slice *discovery.EndpointSlice) sets.String {
+	nodeNames := sets.NewString()
+	if slice == nil {
+		return nodeNames
+	}
+	for _, endpoint := range slice.Endpoints {
+		if endpoint.NodeName == nil {
+			continue
+		}
+		if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+			continue
+		}
+		nodeNames.Insert(*endpoint.NodeName)
+	}
+	return nodeNames
+}
+
+// watchLocalEndpoints resyncs the backends of the services with externalTrafficPolicy Local
+// when the nodes of their ready endpoints change, the service controller only updating the
+// backends when the Service or the nodes change
+func (c *Cloud) watchLocalEndpoints() {
+	_, err := c.endpointSliceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.resyncLocalEndpoints(nil, obj) },
+		UpdateFunc: func(old, obj interface{}) { c.resyncLocalEndpoints(old, obj) },
+		DeleteFunc: func(obj interface{}) { c.resyncLocalEndpoints(obj, nil) },
+	})
+	if err != nil {
+		klog.Warningf("Error watching the endpoints of the services: %v", err)
+	}
+}
+
+// resyncLocalEndpoints puts the service owning the changed slice in the backendResync queue
+func (c *Cloud) resyncLocalEndpoints(old interface{}, obj interface{}) {
+	if tombstone, ok := old.(cache.DeletedFinalStateUnknown); ok {
+		old = tombstone.Obj
+	}
+	oldSlice, _ := old.(*discovery.EndpointSlice)
+	slice, _ := obj.(*discovery.EndpointSlice)
+	if readyEndpointNodes(oldSlice).Equal(readyEndpointNodes(slice)) {
+		return
+	}
+	if slice == nil {
+		slice = oldSlice
+	}
+	name := slice.Labels[discovery.LabelServiceName]
+	if name == "" || c.serviceInformer == nil {
+		return
+	}
+	service, err := c.serviceInformer.Lister().Services(slice.Namespace).Get(name)
+	if err != nil {
+		return
+	}
+	if path, _ := servicehelpers.GetServiceHealthCheckPathPort(service); path == "" {
+		return
+	}
+	klog.V(4).Infof("Local endpoints of service %s/%s moved, resyncing its backends", service.Namespace, service.Name)
+	c.backendResync.enqueue(service)
+}
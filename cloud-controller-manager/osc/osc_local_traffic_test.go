@@ -0,0 +1,150 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestHealthCheckNodePortFromTarget(t *testing.T) {
+	assert.Equal(t, int32(0), healthCheckNodePortFromTarget(nil))
+	assert.Equal(t, int32(0), healthCheckNodePortFromTarget(&elb.HealthCheck{Target: aws.String("TCP:30080")}))
+	assert.Equal(t, int32(0), healthCheckNodePortFromTarget(&elb.HealthCheck{Target: aws.String("HTTP:30080/ready")}))
+	assert.Equal(t, int32(32000), healthCheckNodePortFromTarget(&elb.HealthCheck{Target: aws.String("HTTP:32000/healthz")}))
+}
+
+func TestFilterLocalEndpointInstances(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: v1.ServiceSpec{
+			Type:                  v1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal,
+			HealthCheckNodePort:   32000,
+		},
+	}
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}, Spec: v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}, Spec: v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-b"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-c"}, Spec: v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-c"}},
+	}
+	instances := map[InstanceID]*osc.Vm{
+		"i-a": {VmId: aws.String("i-a")},
+		"i-b": {VmId: aws.String("i-b")},
+		"i-c": {VmId: aws.String("i-c")},
+	}
+	slice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{discovery.LabelServiceName: "web"},
+		},
+		Endpoints: []discovery.Endpoint{
+			{NodeName: aws.String("node-a")},
+			{NodeName: aws.String("node-b"), Conditions: discovery.EndpointConditions{Ready: aws.Bool(false)}},
+		},
+	}
+
+	c := &Cloud{cfg: &CloudConfig{}}
+	assert.Len(t, c.filterLocalEndpointInstances(service, nodes, instances), 3)
+
+	c.cfg.Global.DeregisterNodesWithoutLocalEndpoints = true
+	c.SetInformers(informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0))
+	// The backends are kept while the endpoints are not synced
+	c.endpointSliceInformerHasSynced = func() bool { return false }
+	require.NoError(t, c.endpointSliceInformer.Informer().GetStore().Add(slice))
+	assert.Len(t, c.filterLocalEndpointInstances(service, nodes, instances), 3)
+
+	c.endpointSliceInformerHasSynced = func() bool { return true }
+	filtered := c.filterLocalEndpointInstances(service, nodes, instances)
+	assert.Len(t, filtered, 1)
+	assert.Contains(t, filtered, InstanceID("i-a"))
+
+	cluster := service.DeepCopy()
+	cluster.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeCluster
+	assert.Len(t, c.filterLocalEndpointInstances(cluster, nodes, instances), 3)
+
+	require.NoError(t, c.endpointSliceInformer.Informer().GetStore().Delete(slice))
+	assert.Len(t, c.filterLocalEndpointInstances(service, nodes, instances), 3)
+}
+
+func TestResyncLocalEndpoints(t *testing.T) {
+	c, err := newCloud(CloudConfig{}, NewFakeAWSServices(TestClusterID))
+	require.NoError(t, err)
+	c.cfg.Global.DeregisterNodesWithoutLocalEndpoints = true
+	c.SetInformers(informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0))
+	c.backendResync = newServiceQueue(c, "test", nil)
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: v1.ServiceSpec{
+			Type:                  v1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal,
+			HealthCheckNodePort:   32000,
+		},
+	}
+	require.NoError(t, c.serviceInformer.Informer().GetStore().Add(service))
+	slice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{discovery.LabelServiceName: "web"},
+		},
+		Endpoints: []discovery.Endpoint{{NodeName: aws.String("node-a")}},
+	}
+
+	// A new ready endpoint resyncs the backends
+	c.resyncLocalEndpoints(nil, slice)
+	assert.Equal(t, 1, c.backendResync.queue.Len())
+	key, _ := c.backendResync.queue.Get()
+	assert.Equal(t, "default/web", key)
+	c.backendResync.queue.Done(key)
+
+	// The changes of the endpoints on the same nodes are ignored
+	moved := slice.DeepCopy()
+	moved.Endpoints = append(moved.Endpoints, discovery.Endpoint{NodeName: aws.String("node-a")})
+	c.resyncLocalEndpoints(slice, moved)
+	assert.Equal(t, 0, c.backendResync.queue.Len())
+
+	// An endpoint no longer ready resyncs the backends
+	moved.Endpoints[0].Conditions.Ready = aws.Bool(false)
+	moved.Endpoints[1].Conditions.Ready = aws.Bool(false)
+	c.resyncLocalEndpoints(slice, moved)
+	assert.Equal(t, 1, c.backendResync.queue.Len())
+
+	// The services with externalTrafficPolicy Cluster are ignored
+	cluster := service.DeepCopy()
+	cluster.Name = "cluster"
+	cluster.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeCluster
+	require.NoError(t, c.serviceInformer.Informer().GetStore().Add(cluster))
+	clusterSlice := slice.DeepCopy()
+	clusterSlice.Labels[discovery.LabelServiceName] = "cluster"
+	c.resyncLocalEndpoints(nil, clusterSlice)
+	c.resyncLocalEndpoints(cache.DeletedFinalStateUnknown{Obj: clusterSlice}, nil)
+	assert.Equal(t, 1, c.backendResync.queue.Len())
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Logging *********************
+
+// LogVerbosity is set by the --log-verbosity flag and takes precedence over the
+// LogVerbosity of the cloud config
+var LogVerbosity string
+
+// logModules are the source files of the modules whose verbosity can be set with
+// LogVerbosity, as klog vmodule patterns
+var logModules = map[string][]string{
+	"api":            {"oapi*", "log_handler", "osc_api*", "osc_credentials"},
+	"instances":      {"instances*", "osc_instance*", "osc_node*", "osc_provider_id*"},
+	"loadbalancer":   {"ccm_cloud", "osc_loadbalancer*", "osc_load_balancer*"},
+	"securitygroups": {"osc_security_group*"},
+}
+
+// logModuleNames returns the names of the modules whose verbosity can be set
+func logModuleNames() []string {
+	names := []string{}
+	for name := range logModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseLogVerbosity parses a comma-separated list of module=level, e.g.
+// "loadbalancer=4,api=2", into a klog vmodule specification
+func parseLogVerbosity(value string) (string, error) {
+	vmodule := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		module, level, found := strings.Cut(item, "=")
+		if !found {
+			return "", fmt.Errorf("expected module=level, got %q", item)
+		}
+		patterns, found := logModules[strings.TrimSpace(module)]
+		if !found {
+			return "", fmt.Errorf("unknown module %q, expected one of %v", module, logModuleNames())
+		}
+		verbosity, err := strconv.Atoi(strings.TrimSpace(level))
+		if err != nil || verbosity < 0 {
+			return "", fmt.Errorf("invalid level %q of module %q", level, module)
+		}
+		for _, pattern := range patterns {
+			vmodule = append(vmodule, fmt.Sprintf("%s=%d", pattern, verbosity))
+		}
+	}
+	return strings.Join(vmodule, ","), nil
+}
+
+// setLogVerbosity sets the verbosity of the modules, the patterns given with the --vmodule
+// flag of klog take precedence
+func setLogVerbosity(value string) error {
+	vmodule, err := parseLogVerbosity(value)
+	if err != nil || vmodule == "" {
+		return err
+	}
+	flags := flag.NewFlagSet("osc-log-verbosity", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	if current := flags.Lookup("vmodule").Value.String(); current != "" {
+		vmodule = current + "," + vmodule
+	}
+	klog.Infof("Setting the verbosity of the modules: %s", vmodule)
+	return flags.Set("vmodule", vmodule)
+}
+
+// serviceLogger returns the logger of the context with the key of the service, to be
+// propagated with klog.NewContext through the reconciliation of its load balancer
+func serviceLogger(ctx context.Context, service *v1.Service) klog.Logger {
+	return klog.FromContext(ctx).WithName("loadbalancer").WithValues("service", klog.KObj(service))
+}
+
+// nodeLogger returns the logger of the context with the key of the node
+func nodeLogger(ctx context.Context, node *v1.Node) klog.Logger {
+	return klog.FromContext(ctx).WithName("instances").WithValues("node", klog.KObj(node))
+}
+
+// sensitiveLogFields are the fields, lower case, masked in the logged values
+var sensitiveLogFields = []string{
+	"accesskey", "authorization", "password", "privatekey", "secret", "token", "userdata",
+}
+
+// redactedValue is a value logged with its sensitive fields masked
+type redactedValue struct {
+	value interface{}
+}
+
+// redact returns the value to log with its sensitive fields masked, e.g. the secret keys
+// and the user data of the requests
+func redact(value interface{}) redactedValue {
+	return redactedValue{value: value}
+}
+
+// isSensitiveLogField returns whether the field is masked in the logs
+func isSensitiveLogField(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range sensitiveLogFields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactFields masks the sensitive fields of a value decoded from JSON
+func redactFields(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, field := range value {
+			if isSensitiveLogField(name) && field != nil {
+				value[name] = "REDACTED"
+			} else {
+				value[name] = redactFields(field)
+			}
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = redactFields(value[i])
+		}
+	}
+	return value
+}
+
+// MarshalLog implements logr.Marshaler
+func (r redactedValue) MarshalLog() interface{} {
+	data, err := json.Marshal(r.value)
+	if err != nil {
+		return fmt.Sprintf("<unable to log %T: %v>", r.value, err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Sprintf("<unable to log %T: %v>", r.value, err)
+	}
+	return redactFields(decoded)
+}
+
+// String implements fmt.Stringer
+func (r redactedValue) String() string {
+	data, err := json.Marshal(r.MarshalLog())
+	if err != nil {
+		return fmt.Sprintf("<unable to log %T: %v>", r.value, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogVerbosity(t *testing.T) {
+	vmodule, err := parseLogVerbosity("")
+	assert.NoError(t, err)
+	assert.Equal(t, "", vmodule)
+
+	vmodule, err = parseLogVerbosity(" securitygroups=4, api = 2")
+	assert.NoError(t, err)
+	assert.Equal(t, "osc_security_group*=4,oapi*=2,log_handler=2,osc_api*=2,osc_credentials=2", vmodule)
+
+	for _, value := range []string{"loadbalancer", "routes=2", "api=-1", "api=high"} {
+		_, err := parseLogVerbosity(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	request := osc.CreateVmsRequest{
+		ImageId:  "ami-12345678",
+		UserData: aws.String("c2VjcmV0"),
+		Nics: &[]osc.NicForVmCreation{{
+			PrivateIps: &[]osc.PrivateIpLight{{PrivateIp: aws.String("10.0.0.1")}},
+		}},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"ImageId":  "ami-12345678",
+		"UserData": "REDACTED",
+		"Nics": []interface{}{map[string]interface{}{
+			"PrivateIps": []interface{}{map[string]interface{}{"PrivateIp": "10.0.0.1"}},
+		}},
+	}, redact(request).MarshalLog())
+
+	credentials := map[string]string{"AccessKey": "AK", "SecretKey": "SK", "region": "eu-west-2"}
+	assert.Equal(t, `{"AccessKey":"REDACTED","SecretKey":"REDACTED","region":"eu-west-2"}`,
+		redact(credentials).String())
+}
@@ -20,8 +20,15 @@ limitations under the License.
 package osc
 
 import (
+	"errors"
+	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	osc "github.com/outscale/osc-sdk-go/v2"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"k8s.io/component-base/metrics"
@@ -52,6 +59,99 @@ var (
 			StabilityLevel: metrics.ALPHA,
 		},
 		[]string{"operation_name"})
+
+	loadBalancerBackendsMetric = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cloudprovider_osc_load_balancer_backends",
+			Help:           "Number of load balancer backends by health state",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"namespace", "service", "load_balancer", "state"})
+
+	loadBalancerHealthyBackendsMetric = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "osc_lb_backend_healthy",
+			Help:           "Number of healthy (InService) load balancer backends",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"namespace", "service", "load_balancer"})
+
+	instanceCacheMetric = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_osc_instance_cache_requests_total",
+			Help:           "Lookups of the InstancesV2 VM cache by result (hit or miss)",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"})
+
+	oscAPIRequestDurationMetric = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:           "cloudprovider_osc_api_request_duration_seconds",
+			Help:           "Latency of Outscale API calls by API (oapi or lbu) and operation",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"api", "operation"})
+
+	oscAPIRequestErrorsMetric = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_osc_api_request_errors_total",
+			Help:           "Outscale API errors by API (oapi or lbu), operation and error code",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"api", "operation", "code"})
+
+	oscAPIThrottledRequestsMetric = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_osc_api_throttled_requests_total",
+			Help:           "Outscale API throttled requests by API (oapi or lbu) and operation",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"api", "operation"})
+
+	loadBalancerNotReadyMetric = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_osc_load_balancer_not_ready_total",
+			Help:           "Load balancer syncs reporting a not ready load balancer, by reason",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"reason"})
+
+	cloudHealthMetric = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cloudprovider_osc_cloud_health",
+			Help:           "Result of the cloud health checks (1 when passing, 0 when failing) by check",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"check"})
+
+	instanceEndpointHealthMetric = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cloudprovider_osc_instance_endpoint_up",
+			Help:           "Result of the last ReadVms call of InstancesV2 (1 when successful, 0 when failing) by region and fallback order",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"region", "order"})
+
+	instanceFallbackMetric = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_osc_instance_fallback_lookups_total",
+			Help:           "VM lookups of InstancesV2 in a secondary region by region and result (found, not_found or error)",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"region", "result"})
+
+	nodeSyncBatchMetric = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:           "cloudprovider_osc_node_sync_batch_size",
+			Help:           "Number of node-change-driven load balancer updates sharing a snapshot of the VMs",
+			Buckets:        metrics.ExponentialBuckets(1, 2, 8),
+			StabilityLevel: metrics.ALPHA,
+		})
+)
+
+const (
+	oscAPIOapi = "oapi"
+	oscAPILbu  = "lbu"
 )
 
 func recordAWSMetric(actionName string, timeTaken float64, err error) {
@@ -66,6 +166,112 @@ func recordAWSThrottlesMetric(operation string) {
 	awsAPIThrottlesMetric.With(prometheus.Labels{"operation_name": operation}).Inc()
 }
 
+func recordInstanceCacheMetric(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	instanceCacheMetric.With(prometheus.Labels{"result": result}).Inc()
+}
+
+// recordLoadBalancerNotReadyMetric counts a load balancer not ready yet
+func recordLoadBalancerNotReadyMetric(reason LoadBalancerNotReadyReason) {
+	loadBalancerNotReadyMetric.With(prometheus.Labels{"reason": string(reason)}).Inc()
+}
+
+// recordCloudHealthMetric records the result of a cloud health check
+func recordCloudHealthMetric(check string, err error) {
+	value := 1.0
+	if err != nil {
+		value = 0
+	}
+	cloudHealthMetric.With(prometheus.Labels{"check": check}).Set(value)
+}
+
+// recordInstanceEndpointHealthMetric records the result of a ReadVms call in a region
+func recordInstanceEndpointHealthMetric(region string, order int, err error) {
+	value := 1.0
+	if err != nil {
+		value = 0
+	}
+	instanceEndpointHealthMetric.With(prometheus.Labels{"region": region, "order": strconv.Itoa(order)}).Set(value)
+}
+
+// recordInstanceFallbackMetric records a VM lookup in a secondary region
+func recordInstanceFallbackMetric(region string, found bool, err error) {
+	result := "not_found"
+	switch {
+	case err != nil:
+		result = "error"
+	case found:
+		result = "found"
+	}
+	instanceFallbackMetric.With(prometheus.Labels{"region": region, "result": result}).Inc()
+}
+
+// recordNodeSyncBatchMetric records the number of load balancer updates of a node sync batch
+func recordNodeSyncBatchMetric(updates int) {
+	nodeSyncBatchMetric.Observe(float64(updates))
+}
+
+// recordOscAPIMetric records the latency, error code and throttling of an API call
+func recordOscAPIMetric(api, operation string, timeTaken float64, code string, throttled bool) {
+	oscAPIRequestDurationMetric.With(prometheus.Labels{"api": api, "operation": operation}).Observe(timeTaken)
+	if code != "" {
+		oscAPIRequestErrorsMetric.With(prometheus.Labels{"api": api, "operation": operation, "code": code}).Inc()
+	}
+	if throttled {
+		oscAPIThrottledRequestsMetric.With(prometheus.Labels{"api": api, "operation": operation}).Inc()
+	}
+}
+
+// recordOapiMetric records an oAPI call issued at requestTime
+func recordOapiMetric(operation string, requestTime time.Time, httpRes *http.Response, err error) {
+	code, throttled := oapiErrorCode(httpRes, err)
+	recordOscAPIMetric(oscAPIOapi, operation, time.Since(requestTime).Seconds(), code, throttled)
+}
+
+// oapiErrorCode returns the error code of an oAPI call (empty on success) and whether the call was throttled
+func oapiErrorCode(httpRes *http.Response, err error) (string, bool) {
+	throttled := httpRes != nil && (httpRes.StatusCode == http.StatusTooManyRequests || httpRes.StatusCode == http.StatusServiceUnavailable)
+	if err == nil {
+		return "", throttled
+	}
+
+	var apiErr osc.GenericOpenAPIError
+	if errors.As(err, &apiErr) {
+		if model, ok := apiErr.Model().(osc.ErrorResponse); ok {
+			for _, e := range model.GetErrors() {
+				if e.GetCode() != "" {
+					return e.GetCode(), throttled
+				}
+			}
+		}
+	}
+	if httpRes != nil {
+		return strconv.Itoa(httpRes.StatusCode), throttled
+	}
+	return "unknown", throttled
+}
+
+// awsHandlerMetrics is an aws-sdk-go handler recording the metrics of every LBU call attempt
+func awsHandlerMetrics(req *request.Request) {
+	code := ""
+	throttled := false
+	if req.Error != nil {
+		code = "unknown"
+		var awsErr awserr.Error
+		if errors.As(req.Error, &awsErr) {
+			code = awsErr.Code()
+		}
+		throttled = request.IsErrorThrottle(req.Error)
+	}
+	if req.HTTPResponse != nil && req.HTTPResponse.StatusCode == http.StatusTooManyRequests {
+		throttled = true
+	}
+	recordOscAPIMetric(oscAPILbu, operationName(req), time.Since(req.AttemptTime).Seconds(), code, throttled)
+}
+
 var registerOnce sync.Once
 
 func registerMetrics() {
@@ -73,5 +279,16 @@ func registerMetrics() {
 		legacyregistry.MustRegister(awsAPIMetric)
 		legacyregistry.MustRegister(awsAPIErrorMetric)
 		legacyregistry.MustRegister(awsAPIThrottlesMetric)
+		legacyregistry.MustRegister(loadBalancerBackendsMetric)
+		legacyregistry.MustRegister(loadBalancerHealthyBackendsMetric)
+		legacyregistry.MustRegister(instanceCacheMetric)
+		legacyregistry.MustRegister(oscAPIRequestDurationMetric)
+		legacyregistry.MustRegister(oscAPIRequestErrorsMetric)
+		legacyregistry.MustRegister(oscAPIThrottledRequestsMetric)
+		legacyregistry.MustRegister(loadBalancerNotReadyMetric)
+		legacyregistry.MustRegister(cloudHealthMetric)
+		legacyregistry.MustRegister(instanceEndpointHealthMetric)
+		legacyregistry.MustRegister(instanceFallbackMetric)
+		legacyregistry.MustRegister(nodeSyncBatchMetric)
 	})
 }
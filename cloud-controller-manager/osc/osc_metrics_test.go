@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestOapiErrorCode(t *testing.T) {
+	code, throttled := oapiErrorCode(&http.Response{StatusCode: http.StatusOK}, nil)
+	assert.Equal(t, "", code)
+	assert.False(t, throttled)
+
+	code, throttled = oapiErrorCode(&http.Response{StatusCode: http.StatusServiceUnavailable}, errors.New("503 Service Unavailable"))
+	assert.Equal(t, "503", code)
+	assert.True(t, throttled)
+
+	code, throttled = oapiErrorCode(nil, errors.New("connection refused"))
+	assert.Equal(t, "unknown", code)
+	assert.False(t, throttled)
+}
+
+func TestAWSHandlerMetrics(t *testing.T) {
+	registerMetrics()
+	// The API calls of the other tests are not counted
+	oscAPIRequestErrorsMetric.Reset()
+	oscAPIThrottledRequestsMetric.Reset()
+
+	awsHandlerMetrics(&request.Request{
+		Operation:   &request.Operation{Name: "CreateLoadBalancer"},
+		Error:       awserr.New("Throttling", "Rate exceeded", nil),
+		AttemptTime: time.Now(),
+	})
+	awsHandlerMetrics(&request.Request{
+		Operation:   &request.Operation{Name: "DescribeLoadBalancers"},
+		AttemptTime: time.Now(),
+	})
+
+	expected := `
+# HELP cloudprovider_osc_api_request_errors_total [ALPHA] Outscale API errors by API (oapi or lbu), operation and error code
+# TYPE cloudprovider_osc_api_request_errors_total counter
+cloudprovider_osc_api_request_errors_total{api="lbu",code="Throttling",operation="CreateLoadBalancer"} 1
+# HELP cloudprovider_osc_api_throttled_requests_total [ALPHA] Outscale API throttled requests by API (oapi or lbu) and operation
+# TYPE cloudprovider_osc_api_throttled_requests_total counter
+cloudprovider_osc_api_throttled_requests_total{api="lbu",operation="CreateLoadBalancer"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(expected),
+		"cloudprovider_osc_api_request_errors_total", "cloudprovider_osc_api_throttled_requests_total"))
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Node Address Priority *********************
+
+// NodeAddressPriority is set by the --node-address-priority flag and takes precedence over
+// the NodeAddressPriority of the cloud config
+var NodeAddressPriority string
+
+// nodeAddressPriority orders and filters the private IPs of the node addresses by NIC, for
+// the CNIs expecting the InternalIP of the node on a given NIC or subnet
+type nodeAddressPriority struct {
+	// nics selects the NICs whose addresses are reported first, in order: subnet IDs or
+	// device numbers
+	nics []string
+	// excluded selects the NICs whose addresses are not reported, e.g. the NICs of a
+	// storage network
+	excluded []string
+	// primaryNicOnly drops the addresses of the secondary NICs
+	primaryNicOnly bool
+}
+
+// nicAddresses are the private IPs of a NIC of a VM
+type nicAddresses struct {
+	deviceNumber int32
+	subnetID     string
+	addresses    []v1.NodeAddress
+}
+
+// parseNicSelectors parses a comma-separated list of subnet IDs or NIC device numbers,
+// e.g. "subnet-12345678,1"
+func parseNicSelectors(value string) ([]string, error) {
+	nics := []string{}
+	for _, nic := range strings.Split(value, ",") {
+		nic = strings.TrimSpace(nic)
+		if nic == "" {
+			continue
+		}
+		if !strings.HasPrefix(nic, "subnet-") {
+			if number, err := strconv.Atoi(nic); err != nil || number < 0 {
+				return nil, fmt.Errorf("expected a subnet ID or a NIC device number, got %q", nic)
+			}
+		}
+		nics = append(nics, nic)
+	}
+	return nics, nil
+}
+
+// nicMatches returns whether the NIC is selected by a subnet ID or device number
+func nicMatches(selector string, subnetID string, deviceNumber int32) bool {
+	return selector == subnetID || selector == strconv.Itoa(int(deviceNumber))
+}
+
+// newNodeAddressPriority returns the priority of the NICs configured in the cloud config,
+// nil when the addresses are reported as discovered
+func newNodeAddressPriority(value string, excluded string, primaryNicOnly bool) (*nodeAddressPriority, error) {
+	nics, err := parseNicSelectors(value)
+	if err != nil {
+		return nil, err
+	}
+	excludedNics, err := parseNicSelectors(excluded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid excluded NICs: %v", err)
+	}
+	if len(nics) == 0 && len(excludedNics) == 0 && !primaryNicOnly {
+		return nil, nil
+	}
+	return &nodeAddressPriority{nics: nics, excluded: excludedNics, primaryNicOnly: primaryNicOnly}, nil
+}
+
+// getMetadataNic returns the device number and the subnet of the NIC of the node from the
+// metadata, for the priority of the NICs
+func (c *Cloud) getMetadataNic(macID string) (nicAddresses, error) {
+	nic := nicAddresses{}
+	macPath := path.Join("network/interfaces/macs/", macID, "device-number")
+	deviceNumber, err := c.metadata.GetMetadata(macPath)
+	if err != nil {
+		return nic, fmt.Errorf("error querying AWS metadata for %q: %q", macPath, err)
+	}
+	number, err := strconv.ParseInt(strings.TrimSpace(deviceNumber), 10, 32)
+	if err != nil {
+		return nic, fmt.Errorf("invalid device number %q in AWS metadata for %q", deviceNumber, macPath)
+	}
+	nic.deviceNumber = int32(number)
+
+	macPath = path.Join("network/interfaces/macs/", macID, "subnet-id")
+	if nic.subnetID, err = c.metadata.GetMetadata(macPath); err != nil {
+		return nic, fmt.Errorf("error querying AWS metadata for %q: %q", macPath, err)
+	}
+	nic.subnetID = strings.TrimSpace(nic.subnetID)
+	return nic, nil
+}
+
+// forInstance returns the priority of the NICs of the VM: the TagNameNodeAddressPriority and
+// TagNameNodeAddressExcludedNics tags of the VM take precedence over the cloud config
+func (p *nodeAddressPriority) forInstance(instance *osc.Vm) *nodeAddressPriority {
+	priority := &nodeAddressPriority{}
+	if p != nil {
+		*priority = *p
+	}
+	tagged := false
+	for _, tag := range instance.GetTags() {
+		var field *[]string
+		switch tag.GetKey() {
+		case TagNameNodeAddressPriority:
+			field = &priority.nics
+		case TagNameNodeAddressExcludedNics:
+			field = &priority.excluded
+		default:
+			continue
+		}
+		nics, err := parseNicSelectors(tag.GetValue())
+		if err != nil {
+			klog.Warningf("Ignoring invalid %s tag of VM %s: %v", tag.GetKey(), instance.GetVmId(), err)
+			continue
+		}
+		*field = nics
+		tagged = true
+	}
+	if !tagged {
+		return p
+	}
+	return priority
+}
+
+// rank returns the position of the NIC in the priority, len(p.nics) when it is not selected
+func (p *nodeAddressPriority) rank(nic nicAddresses) int {
+	for i, selector := range p.nics {
+		if nicMatches(selector, nic.subnetID, nic.deviceNumber) {
+			return i
+		}
+	}
+	return len(p.nics)
+}
+
+// isExcluded returns whether the addresses of the NIC are not reported
+func (p *nodeAddressPriority) isExcluded(nic nicAddresses) bool {
+	if p.primaryNicOnly && nic.deviceNumber != 0 {
+		return true
+	}
+	for _, selector := range p.excluded {
+		if nicMatches(selector, nic.subnetID, nic.deviceNumber) {
+			return true
+		}
+	}
+	return false
+}
+
+// order returns the addresses of the NICs which are not excluded, the addresses of the
+// selected NICs first and the other ones in discovery order. With a nil priority, the addresses are returned as discovered.
+func (p *nodeAddressPriority) order(nics []nicAddresses) []v1.NodeAddress {
+	if p != nil {
+		kept := []nicAddresses{}
+		for _, nic := range nics {
+			if p.isExcluded(nic) {
+				continue
+			}
+			kept = append(kept, nic)
+		}
+		sort.SliceStable(kept, func(i, j int) bool {
+			return p.rank(kept[i]) < p.rank(kept[j])
+		})
+		nics = kept
+	}
+
+	addresses := []v1.NodeAddress{}
+	for _, nic := range nics {
+		addresses = append(addresses, nic.addresses...)
+	}
+	return addresses
+}
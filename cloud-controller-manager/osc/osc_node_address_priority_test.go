@@ -0,0 +1,139 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func testNic(deviceNumber int32, subnetID string, ip string) osc.NicLight {
+	return osc.NicLight{
+		State:      aws.String("in-use"),
+		SubnetId:   aws.String(subnetID),
+		LinkNic:    &osc.LinkNicLight{DeviceNumber: &deviceNumber},
+		PrivateIps: &[]osc.PrivateIpLightForVm{{PrivateIp: aws.String(ip)}},
+	}
+}
+
+func internalIPs(addresses []v1.NodeAddress) []string {
+	ips := []string{}
+	for _, address := range addresses {
+		if address.Type == v1.NodeInternalIP {
+			ips = append(ips, address.Address)
+		}
+	}
+	return ips
+}
+
+func TestParseNodeAddressPriority(t *testing.T) {
+	priority, err := newNodeAddressPriority("", "", false)
+	assert.NoError(t, err)
+	assert.Nil(t, priority)
+	priority, err = newNodeAddressPriority(" subnet-b, 1", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, &nodeAddressPriority{nics: []string{"subnet-b", "1"}, excluded: []string{}}, priority)
+	priority, err = newNodeAddressPriority("", "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, &nodeAddressPriority{nics: []string{}, excluded: []string{}, primaryNicOnly: true}, priority)
+	priority, err = newNodeAddressPriority("", "subnet-storage", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"subnet-storage"}, priority.excluded)
+
+	for _, value := range []string{"eth1", "-1", "vpc-12345678"} {
+		_, err := newNodeAddressPriority(value, "", false)
+		assert.Error(t, err, value)
+		_, err = newNodeAddressPriority("", value, false)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestExtractNodeAddressesPriority(t *testing.T) {
+	instance := &osc.Vm{
+		VmId: aws.String("i-0"),
+		Nics: &[]osc.NicLight{
+			testNic(0, "subnet-a", "10.0.0.1"),
+			testNic(1, "subnet-b", "10.0.1.1"),
+			testNic(2, "subnet-c", "10.0.2.1"),
+		},
+	}
+
+	addresses, err := extractNodeAddresses(instance, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.1.1", "10.0.2.1"}, internalIPs(addresses))
+
+	addresses, err = extractNodeAddresses(instance, &nodeAddressPriority{nics: []string{"subnet-c"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.2.1", "10.0.0.1", "10.0.1.1"}, internalIPs(addresses))
+
+	addresses, err = extractNodeAddresses(instance, &nodeAddressPriority{nics: []string{"2", "1"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.2.1", "10.0.1.1", "10.0.0.1"}, internalIPs(addresses))
+
+	addresses, err = extractNodeAddresses(instance, &nodeAddressPriority{primaryNicOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, internalIPs(addresses))
+
+	addresses, err = extractNodeAddresses(instance, &nodeAddressPriority{excluded: []string{"subnet-b"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.2.1"}, internalIPs(addresses))
+
+	// The tags of the VM take precedence over the cloud config, an invalid tag is ignored
+	instance.Tags = &[]osc.ResourceTag{{Key: TagNameNodeAddressPriority, Value: "subnet-b"}}
+	addresses, err = extractNodeAddresses(instance, &nodeAddressPriority{nics: []string{"subnet-c"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.1.1", "10.0.0.1", "10.0.2.1"}, internalIPs(addresses))
+	instance.Tags = &[]osc.ResourceTag{{Key: TagNameNodeAddressPriority, Value: "eth1"}}
+	addresses, err = extractNodeAddresses(instance, &nodeAddressPriority{nics: []string{"subnet-c"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.2.1", "10.0.0.1", "10.0.1.1"}, internalIPs(addresses))
+	instance.Tags = &[]osc.ResourceTag{{Key: TagNameNodeAddressExcludedNics, Value: "2"}}
+	addresses, err = extractNodeAddresses(instance, &nodeAddressPriority{nics: []string{"subnet-c"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.1.1"}, internalIPs(addresses))
+}
+
+func TestNodeAddressesFromMetadataPriority(t *testing.T) {
+	instance := osc.Vm{
+		VmId:           aws.String("i-0"),
+		PrivateDnsName: aws.String("instance.ec2.internal"),
+		Placement:      &osc.Placement{SubregionName: aws.String("us-east-1a")},
+		Tags:           &[]osc.ResourceTag{{Key: TagNameKubernetesClusterLegacy, Value: TestClusterID}},
+		State:          aws.String("running"),
+	}
+	awsCloud, awsServices := mockInstancesResp(&instance, []*osc.Vm{&instance})
+	awsServices.networkInterfacesMacs = []string{"0a:26:89:f3:9c:f6", "0a:26:89:f3:9c:f7"}
+	awsServices.networkInterfacesPrivateIPs = [][]string{{"10.0.0.1"}, {"10.0.1.1"}}
+	awsServices.networkInterfacesSubnetIDs = []string{"subnet-a", "subnet-b"}
+
+	awsCloud.nodeAddressPriority = &nodeAddressPriority{nics: []string{"subnet-b"}}
+	addresses, err := awsCloud.NodeAddresses(context.TODO(), "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.1.1", "10.0.0.1"}, internalIPs(addresses))
+
+	awsCloud.nodeAddressPriority = &nodeAddressPriority{primaryNicOnly: true}
+	addresses, err = awsCloud.NodeAddresses(context.TODO(), "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, internalIPs(addresses))
+}
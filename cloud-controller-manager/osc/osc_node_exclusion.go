@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Node Exclusion *********************
+
+// ExcludedNodesSelector is set by the --excluded-nodes-selector flag and takes precedence
+// over the ExcludedNodesSelector of the cloud config
+var ExcludedNodesSelector string
+
+// parseExcludedNodesSelector parses the label selector of the nodes never registered with
+// the load balancers, selecting no node when empty
+func parseExcludedNodesSelector(value string) (labels.Selector, error) {
+	if strings.TrimSpace(value) == "" {
+		return labels.Nothing(), nil
+	}
+	return labels.Parse(value)
+}
+
+// isExcludedFromLoadBalancers checks whether the node is labeled with
+// LabelNodeExcludeFromLoadBalancers or selected by the ExcludedNodesSelector
+func (c *Cloud) isExcludedFromLoadBalancers(node *v1.Node) bool {
+	if _, excluded := node.Labels[LabelNodeExcludeFromLoadBalancers]; excluded {
+		return true
+	}
+	return c.excludedNodes != nil && c.excludedNodes.Matches(labels.Set(node.Labels))
+}
+
+// filterExcludedNodes drops the nodes excluded from the load balancers, besides those
+// labeled with the upstream node.kubernetes.io/exclude-from-external-load-balancers which
+// the service controller already drops
+func (c *Cloud) filterExcludedNodes(nodes []*v1.Node) []*v1.Node {
+	selected := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if c.isExcludedFromLoadBalancers(node) {
+			klog.V(4).Infof("Node %s is excluded from the load balancers", node.Name)
+			continue
+		}
+		selected = append(selected, node)
+	}
+	return selected
+}
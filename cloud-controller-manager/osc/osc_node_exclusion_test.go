@@ -0,0 +1,65 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func labeledNode(name string, labels map[string]string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestFilterExcludedNodes(t *testing.T) {
+	nodes := []*v1.Node{
+		labeledNode("worker", map[string]string{"node-role.kubernetes.io/worker": ""}),
+		labeledNode("gpu", map[string]string{"node-role.kubernetes.io/gpu": ""}),
+		labeledNode("storage", map[string]string{LabelNodeExcludeFromLoadBalancers: "true"}),
+	}
+	names := func(nodes []*v1.Node) []string {
+		result := []string{}
+		for _, node := range nodes {
+			result = append(result, node.Name)
+		}
+		return result
+	}
+
+	cfg := CloudConfig{}
+	c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"worker", "gpu"}, names(c.filterExcludedNodes(nodes)))
+
+	cfg.Global.ExcludedNodesSelector = "node-role.kubernetes.io/gpu"
+	c, err = newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"worker"}, names(c.filterExcludedNodes(nodes)))
+
+	// The flag takes precedence over the cloud config
+	ExcludedNodesSelector = "node-role.kubernetes.io/worker"
+	defer func() { ExcludedNodesSelector = "" }()
+	c, err = newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gpu"}, names(c.filterExcludedNodes(nodes)))
+
+	ExcludedNodesSelector = "node-role.kubernetes.io/worker in ("
+	_, err = newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+
+	v1 "k8s.io/api/core/v1"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Backend Registration Gating *********************
+
+const (
+	// defaultKubeProxyHealthzPort is the default port of the kube-proxy healthz server
+	defaultKubeProxyHealthzPort = 10256
+	// nodeHealthzTimeout bounds the duration of a single node probe
+	nodeHealthzTimeout = 2 * time.Second
+)
+
+// nodeHealthzGate probes the nodes from the CCM before they are registered as load
+// balancer backends, so that a node which just joined is only registered once it
+// serves traffic. It requires the CCM to reach the node private IPs.
+type nodeHealthzGate struct {
+	kubeProxyPort int
+	client        *http.Client
+}
+
+// kubeProxyHealthzPort returns the port of the kube-proxy healthz server of the nodes
+func (c *Cloud) kubeProxyHealthzPort() int32 {
+	if c.cfg.Global.KubeProxyHealthzPort == 0 {
+		return defaultKubeProxyHealthzPort
+	}
+	return int32(c.cfg.Global.KubeProxyHealthzPort)
+}
+
+func newNodeHealthzGate(enabled bool, kubeProxyPort int) *nodeHealthzGate {
+	if !enabled {
+		return nil
+	}
+	if kubeProxyPort == 0 {
+		kubeProxyPort = defaultKubeProxyHealthzPort
+	}
+	return &nodeHealthzGate{
+		kubeProxyPort: kubeProxyPort,
+		client:        &http.Client{Timeout: nodeHealthzTimeout},
+	}
+}
+
+// probeURL returns the URL probed on the node for the service, and whether any HTTP
+// answer means that the node is serving. The healthCheckNodePort answers 503 when the
+// node has no local endpoint, which is left to the load balancer health check.
+func (g *nodeHealthzGate) probeURL(service *v1.Service, ip string) (string, bool) {
+	if path, port := servicehelpers.GetServiceHealthCheckPathPort(service); path != "" {
+		return fmt.Sprintf("http://%s%s", net.JoinHostPort(ip, strconv.Itoa(int(port))), path), true
+	}
+	return fmt.Sprintf("http://%s/healthz", net.JoinHostPort(ip, strconv.Itoa(g.kubeProxyPort))), false
+}
+
+// serving probes the node and reports whether it serves traffic
+func (g *nodeHealthzGate) serving(service *v1.Service, vm *osc.Vm) bool {
+	ip := vm.GetPrivateIp()
+	if ip == "" {
+		return false
+	}
+	url, anyAnswer := g.probeURL(service, ip)
+	response, err := g.client.Get(url)
+	if err != nil {
+		klog.V(4).Infof("Probe of %s on VM %s failed: %q", url, vm.GetVmId(), err)
+		return false
+	}
+	defer response.Body.Close()
+	if anyAnswer {
+		return true
+	}
+	return response.StatusCode == http.StatusOK
+}
+
+// filter returns the instances to register to the load balancer, along with the ids
+// of the instances skipped because they are not serving yet. Instances already
+// registered are kept so that a transient probe failure does not remove them.
+func (g *nodeHealthzGate) filter(service *v1.Service, lbInstances []*elb.Instance,
+	instances map[InstanceID]*osc.Vm) (map[InstanceID]*osc.Vm, []string) {
+	if g == nil {
+		return instances, nil
+	}
+
+	registered := make(map[string]bool)
+	for _, lbInstance := range lbInstances {
+		registered[aws.StringValue(lbInstance.InstanceId)] = true
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	filtered := make(map[InstanceID]*osc.Vm)
+	skipped := []string{}
+	for id, vm := range instances {
+		if registered[string(id)] {
+			// The probes started earlier write filtered concurrently
+			mutex.Lock()
+			filtered[id] = vm
+			mutex.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(id InstanceID, vm *osc.Vm) {
+			defer wg.Done()
+			serving := g.serving(service, vm)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if serving {
+				filtered[id] = vm
+			} else {
+				skipped = append(skipped, string(id))
+			}
+		}(id, vm)
+	}
+	wg.Wait()
+	return filtered, skipped
+}
+
+// filterServingInstances drops the instances that are not serving yet when backend
+// gating is enabled, and reports them on the service
+func (c *Cloud) filterServingInstances(service *v1.Service, lbInstances []*elb.Instance,
+	instances map[InstanceID]*osc.Vm) (map[InstanceID]*osc.Vm, []string) {
+	klog.V(5).Infof("filterServingInstances(%v, %v, %v)", service, lbInstances, instances)
+	filtered, skipped := c.backendGate.filter(service, lbInstances, instances)
+	if len(skipped) > 0 {
+		klog.Infof("Not registering instances %v to the load balancer of service %s/%s: not serving yet",
+			skipped, service.Namespace, service.Name)
+		if c.eventRecorder != nil {
+			c.eventRecorder.Eventf(service, v1.EventTypeNormal, "BackendsNotServing",
+				"Instances %v are not serving yet and are not registered to the load balancer", skipped)
+		}
+	}
+	return filtered, skipped
+}
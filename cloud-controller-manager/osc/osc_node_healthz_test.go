@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestNodeHealthzGateFilter(t *testing.T) {
+	assert.Nil(t, newNodeHealthzGate(false, 0))
+
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	_, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	assert.NoError(t, err)
+
+	gate := newNodeHealthzGate(true, port)
+	service := &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer}}
+	instances := map[InstanceID]*osc.Vm{
+		"i-registered": {VmId: aws.String("i-registered"), PrivateIp: aws.String("127.0.0.1")},
+		"i-new":        {VmId: aws.String("i-new"), PrivateIp: aws.String("127.0.0.1")},
+		"i-no-ip":      {VmId: aws.String("i-no-ip")},
+	}
+	lbInstances := []*elb.Instance{{InstanceId: aws.String("i-registered")}}
+
+	filtered, skipped := gate.filter(service, lbInstances, instances)
+	assert.Len(t, filtered, 1)
+	assert.Contains(t, filtered, InstanceID("i-registered"))
+	assert.ElementsMatch(t, []string{"i-new", "i-no-ip"}, skipped)
+
+	status = http.StatusOK
+	filtered, skipped = gate.filter(service, lbInstances, instances)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, []string{"i-no-ip"}, skipped)
+
+	// The healthCheckNodePort answers 503 without local endpoints, the node still serves
+	status = http.StatusServiceUnavailable
+	local := &v1.Service{Spec: v1.ServiceSpec{
+		Type:                  v1.ServiceTypeLoadBalancer,
+		ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal,
+		HealthCheckNodePort:   int32(port),
+	}}
+	filtered, skipped = gate.filter(local, lbInstances, instances)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, []string{"i-no-ip"}, skipped)
+}
@@ -0,0 +1,432 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Node IPAM *********************
+
+// EventPodCIDRPoolExhausted is recorded on a node when no pod CIDR is left in the PodCIDRPool
+const EventPodCIDRPoolExhausted = "PodCIDRPoolExhausted"
+
+// Stores of the pod CIDR allocations, see PodCIDRAllocationStore
+const (
+	// PodCIDRAllocationStoreTags records the pod CIDR of each VM in its TagNamePodCIDR tag
+	PodCIDRAllocationStoreTags = "tags"
+	// PodCIDRAllocationStoreConfigMap records the pod CIDRs of the VMs in the
+	// podCIDRConfigMapName ConfigMap
+	PodCIDRAllocationStoreConfigMap = "configmap"
+)
+
+// podCIDRConfigMapName is the ConfigMap of kube-system recording the pod CIDRs by VM id with
+// the configmap PodCIDRAllocationStore
+const podCIDRConfigMapName = "osc-pod-cidrs"
+
+// nodeIPAMSyncInterval is the interval of the allocation of the pod CIDRs of the new nodes
+const nodeIPAMSyncInterval = 10 * time.Second
+
+var (
+	// errPodCIDRPoolExhausted is returned when no pod CIDR is left in the pool
+	errPodCIDRPoolExhausted = errors.New("no pod CIDR left in the pool")
+	// errPodCIDRAllocated is returned when the pod CIDR overlaps the pod CIDR of another VM
+	errPodCIDRAllocated = errors.New("pod CIDR already allocated to another VM")
+)
+
+// podCIDRStore records the pod CIDRs allocated to the VMs
+type podCIDRStore interface {
+	// allocations returns the allocated pod CIDRs by VM id
+	allocations() (map[string]string, error)
+	// allocate records the pod CIDR of the VM, failing with errPodCIDRAllocated when it
+	// overlaps the pod CIDR of another VM
+	allocate(vmID string, cidr string) error
+	release(vmID string) error
+	// retainsDeletedVMs returns whether the allocations of the VMs which no longer exist
+	// must be released
+	retainsDeletedVMs() bool
+}
+
+// podCIDRTagStore records the pod CIDR of each VM in its TagNamePodCIDR tag, released with
+// the VMs. Tags can't be written conditionally, so the allocations are only serialized within
+// the cluster: the clusters of a Net must be given disjoint pools. The allocations of the VMs
+// of the other clusters are honored nonetheless, and reported when they are in the pool.
+type podCIDRTagStore struct {
+	cloud *Cloud
+	pool  *net.IPNet
+}
+
+func (s *podCIDRTagStore) allocations() (map[string]string, error) {
+	vms, err := s.cloud.compute.ReadVms(&osc.ReadVmsRequest{Filters: &osc.FiltersVm{TagKeys: &[]string{TagNamePodCIDR}}})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the VMs tagged %s: %q", TagNamePodCIDR, err)
+	}
+	allocations := make(map[string]string)
+	for _, vm := range vms {
+		if (s.cloud.vpcID != "" && vm.GetNetId() != s.cloud.vpcID) || vm.GetState() == "terminated" {
+			continue
+		}
+		cidr, found := findTag(vm.Tags, TagNamePodCIDR)
+		if !found {
+			continue
+		}
+		if !s.cloud.tagging.hasClusterTag(vm.Tags) && overlapsPool(s.pool, cidr) {
+			klog.Warningf("Pod CIDR %s of VM %s of another cluster is in pool %s, the clusters of a Net must be given disjoint pools",
+				cidr, vm.GetVmId(), s.pool)
+		}
+		allocations[vm.GetVmId()] = cidr
+	}
+	return allocations, nil
+}
+
+func (s *podCIDRTagStore) allocate(vmID string, cidr string) error {
+	_, err := s.cloud.compute.CreateTags(&osc.CreateTagsRequest{
+		ResourceIds: []string{vmID},
+		Tags:        []osc.ResourceTag{{Key: TagNamePodCIDR, Value: cidr}},
+	})
+	if err != nil {
+		return fmt.Errorf("error tagging VM %s with pod CIDR %s: %q", vmID, cidr, err)
+	}
+	return nil
+}
+
+func (s *podCIDRTagStore) release(vmID string) error {
+	_, err := s.cloud.compute.DeleteTags(&osc.DeleteTagsRequest{
+		ResourceIds: []string{vmID},
+		Tags:        []osc.ResourceTag{{Key: TagNamePodCIDR}},
+	})
+	if err != nil {
+		return fmt.Errorf("error removing the pod CIDR of VM %s: %q", vmID, err)
+	}
+	return nil
+}
+
+func (s *podCIDRTagStore) retainsDeletedVMs() bool {
+	return false
+}
+
+// podCIDRConfigMapStore records the pod CIDRs by VM id in the podCIDRConfigMapName ConfigMap
+// of kube-system
+type podCIDRConfigMapStore struct {
+	cloud *Cloud
+}
+
+func (s *podCIDRConfigMapStore) get() (*v1.ConfigMap, error) {
+	configMaps := s.cloud.kubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem)
+	configMap, err := configMaps.Get(context.TODO(), podCIDRConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap, err = configMaps.Create(context.TODO(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: podCIDRConfigMapName, Namespace: metav1.NamespaceSystem},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading ConfigMap %s/%s: %v", metav1.NamespaceSystem, podCIDRConfigMapName, err)
+	}
+	return configMap, nil
+}
+
+func (s *podCIDRConfigMapStore) allocations() (map[string]string, error) {
+	configMap, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	allocations := make(map[string]string, len(configMap.Data))
+	for vmID, cidr := range configMap.Data {
+		allocations[vmID] = cidr
+	}
+	return allocations, nil
+}
+
+// update applies the change to the ConfigMap. The update is conditioned on the
+// resourceVersion read, so that it fails on a concurrent change.
+func (s *podCIDRConfigMapStore) update(change func(data map[string]string) error) error {
+	configMap, err := s.get()
+	if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	if err := change(configMap.Data); err != nil {
+		return err
+	}
+	_, err = s.cloud.kubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("error updating ConfigMap %s/%s: %v", metav1.NamespaceSystem, podCIDRConfigMapName, err)
+	}
+	return nil
+}
+
+func (s *podCIDRConfigMapStore) allocate(vmID string, cidr string) error {
+	return s.update(func(data map[string]string) error {
+		for other, allocated := range data {
+			if other != vmID && overlaps(allocated, cidr) {
+				return fmt.Errorf("pod CIDR %s of VM %s overlaps %s of VM %s: %w", cidr, vmID, allocated, other, errPodCIDRAllocated)
+			}
+		}
+		data[vmID] = cidr
+		return nil
+	})
+}
+
+func (s *podCIDRConfigMapStore) release(vmID string) error {
+	return s.update(func(data map[string]string) error {
+		delete(data, vmID)
+		return nil
+	})
+}
+
+func (s *podCIDRConfigMapStore) retainsDeletedVMs() bool {
+	return true
+}
+
+// nodeIPAM allocates the pod CIDRs of the nodes from the PodCIDRPool of the Net, instead of
+// the range allocator of kube-controller-manager. The pod CIDR allocated to a VM is recorded
+// in the store, so that a node registered again keeps it, and is written into the spec of
+// the nodes without pod CIDR. The pod CIDRs of the nodes set by other means in the pool are
+// recorded as allocated.
+type nodeIPAM struct {
+	cloud    *Cloud
+	pool     *net.IPNet
+	maskSize int
+	store    podCIDRStore
+
+	// Serializes the allocations
+	mutex sync.Mutex
+}
+
+// parsePodCIDRPool parses the PodCIDRPool and PodCIDRMaskSize of the cloud config, the mask
+// size defaulting to 24 for IPv4 and 64 for IPv6. It returns a nil pool when the IPAM is
+// disabled.
+func parsePodCIDRPool(value string, maskSize int) (*net.IPNet, int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, 0, nil
+	}
+	_, pool, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid pod CIDR pool %q: %v", value, err)
+	}
+	ones, bits := pool.Mask.Size()
+	if maskSize == 0 {
+		maskSize = 24
+		if bits == 128 {
+			maskSize = 64
+		}
+	}
+	if maskSize < ones || maskSize > bits {
+		return nil, 0, fmt.Errorf("invalid pod CIDR mask size %d for pool %s, expected between %d and %d", maskSize, pool, ones, bits)
+	}
+	return pool, maskSize, nil
+}
+
+// newNodeIPAM returns the IPAM of the pool, nil when the pool is nil
+func newNodeIPAM(cloud *Cloud, pool *net.IPNet, maskSize int, store string) (*nodeIPAM, error) {
+	if pool == nil {
+		return nil, nil
+	}
+	ipam := &nodeIPAM{cloud: cloud, pool: pool, maskSize: maskSize}
+	switch strings.TrimSpace(store) {
+	case "", PodCIDRAllocationStoreTags:
+		ipam.store = &podCIDRTagStore{cloud: cloud, pool: pool}
+	case PodCIDRAllocationStoreConfigMap:
+		ipam.store = &podCIDRConfigMapStore{cloud: cloud}
+	default:
+		return nil, fmt.Errorf("unknown pod CIDR allocation store %q, expected %s or %s", store,
+			PodCIDRAllocationStoreTags, PodCIDRAllocationStoreConfigMap)
+	}
+	return ipam, nil
+}
+
+// run allocates the pod CIDRs of the new nodes every nodeIPAMSyncInterval until stop is closed
+func (m *nodeIPAM) run(stop <-chan struct{}) {
+	if m == nil {
+		return
+	}
+
+	klog.Infof("Starting the allocation of the pod CIDRs from %s (/%d)", m.pool, m.maskSize)
+	go wait.Until(m.sync, nodeIPAMSyncInterval, stop)
+}
+
+// sync allocates the pod CIDRs of the nodes of the informer without pod CIDR
+func (m *nodeIPAM) sync() {
+	c := m.cloud
+	if c.kubeClient == nil || c.nodeInformer == nil || c.nodeInformerHasSynced == nil || !c.nodeInformerHasSynced() {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	nodes, err := c.nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		klog.Warningf("Unable to list the nodes for the pod CIDR allocation: %q", err)
+		return
+	}
+	allocations, err := m.store.allocations()
+	if err != nil {
+		klog.Warningf("Unable to read the pod CIDR allocations: %v", err)
+		return
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	nodeVMs := make(map[string]bool)
+	for _, node := range nodes {
+		vmID, err := KubernetesInstanceID(node.Spec.ProviderID).MapToAWSInstanceID()
+		if node.Spec.ProviderID == "" || err != nil {
+			// The VM of the node is not known yet
+			klog.V(4).Infof("Skipping the pod CIDR allocation of node %s without provider ID", node.Name)
+			continue
+		}
+		nodeVMs[string(vmID)] = true
+		if err := m.allocate(node, string(vmID), allocations); err != nil {
+			klog.Warningf("Unable to allocate the pod CIDR of node %s: %v", node.Name, err)
+			if errors.Is(err, errPodCIDRPoolExhausted) {
+				if c.eventRecorder != nil {
+					c.eventRecorder.Eventf(node, v1.EventTypeWarning, EventPodCIDRPoolExhausted,
+						"No pod CIDR left in pool %s (/%d)", m.pool, m.maskSize)
+				}
+			}
+		}
+	}
+
+	if !m.store.retainsDeletedVMs() {
+		return
+	}
+	for vmID := range allocations {
+		if nodeVMs[vmID] {
+			continue
+		}
+		klog.V(2).Infof("Releasing the pod CIDR %s of VM %s, which is no longer a node", allocations[vmID], vmID)
+		if err := m.store.release(vmID); err != nil {
+			klog.Warningf("Unable to release the pod CIDR of VM %s: %v", vmID, err)
+		}
+	}
+}
+
+// allocate records and writes the pod CIDR of the node, the allocations being updated
+func (m *nodeIPAM) allocate(node *v1.Node, vmID string, allocations map[string]string) error {
+	if node.Spec.PodCIDR != "" {
+		// Adopt the pod CIDR of the node set by other means, once
+		if _, found := allocations[vmID]; !found && m.contains(node.Spec.PodCIDR) {
+			if err := m.store.allocate(vmID, node.Spec.PodCIDR); err != nil {
+				return err
+			}
+			allocations[vmID] = node.Spec.PodCIDR
+		}
+		return nil
+	}
+
+	cidr, found := allocations[vmID]
+	if !found {
+		var err error
+		if cidr, err = m.next(allocations); err != nil {
+			return err
+		}
+		// A concurrent allocation fails the store, the node being allocated another CIDR by
+		// the next sync
+		if err := m.store.allocate(vmID, cidr); err != nil {
+			return err
+		}
+		allocations[vmID] = cidr
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{"podCIDR": cidr, "podCIDRs": []string{cidr}},
+	})
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("Allocating pod CIDR %s to node %s (VM %s)", cidr, node.Name, vmID)
+	_, err = m.cloud.kubeClient.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.MergePatchType, patch,
+		metav1.PatchOptions{})
+	return err
+}
+
+// contains returns whether the CIDR is in the pool
+func (m *nodeIPAM) contains(cidr string) bool {
+	ip, _, err := net.ParseCIDR(cidr)
+	return err == nil && m.pool.Contains(ip)
+}
+
+// overlaps returns whether the CIDRs overlap
+func overlaps(a string, b string) bool {
+	_, aNet, err := net.ParseCIDR(a)
+	if err != nil {
+		return false
+	}
+	_, bNet, err := net.ParseCIDR(b)
+	return err == nil && (aNet.Contains(bNet.IP) || bNet.Contains(aNet.IP))
+}
+
+// overlapsPool returns whether the CIDR overlaps the pool
+func overlapsPool(pool *net.IPNet, cidr string) bool {
+	return pool != nil && overlaps(pool.String(), cidr)
+}
+
+// next returns the first CIDR of the pool overlapping none of the allocations
+func (m *nodeIPAM) next(allocations map[string]string) (string, error) {
+	used := make([]*net.IPNet, 0, len(allocations))
+	for _, cidr := range allocations {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+			used = append(used, ipNet)
+		}
+	}
+
+	ones, bits := m.pool.Mask.Size()
+	base := new(big.Int).SetBytes(m.pool.IP.To16())
+	if bits == 32 {
+		base.SetBytes(m.pool.IP.To4())
+	}
+	step := new(big.Int).Lsh(big.NewInt(1), uint(bits-m.maskSize))
+	count := new(big.Int).Lsh(big.NewInt(1), uint(m.maskSize-ones))
+	mask := net.CIDRMask(m.maskSize, bits)
+	for i := new(big.Int); i.Cmp(count) < 0; i.Add(i, big.NewInt(1)) {
+		address := new(big.Int).Add(base, new(big.Int).Mul(i, step)).Bytes()
+		ip := make(net.IP, bits/8)
+		copy(ip[len(ip)-len(address):], address)
+		candidate := &net.IPNet{IP: ip, Mask: mask}
+		overlaps := false
+		for _, ipNet := range used {
+			if ipNet.Contains(candidate.IP) || candidate.Contains(ipNet.IP) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			return candidate.String(), nil
+		}
+	}
+	return "", errPodCIDRPoolExhausted
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParsePodCIDRPool(t *testing.T) {
+	pool, maskSize, err := parsePodCIDRPool("", 0)
+	assert.NoError(t, err)
+	assert.Nil(t, pool)
+
+	pool, maskSize, err = parsePodCIDRPool("10.244.0.0/16", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "10.244.0.0/16", pool.String())
+	assert.Equal(t, 24, maskSize)
+
+	_, maskSize, err = parsePodCIDRPool("fd00::/48", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 64, maskSize)
+
+	_, maskSize, err = parsePodCIDRPool("10.244.0.0/16", 26)
+	require.NoError(t, err)
+	assert.Equal(t, 26, maskSize)
+
+	for _, invalid := range []struct {
+		pool     string
+		maskSize int
+	}{{"10.244.0.0", 0}, {"10.244.0.0/16", 8}, {"10.244.0.0/16", 33}} {
+		_, _, err = parsePodCIDRPool(invalid.pool, invalid.maskSize)
+		assert.Error(t, err, invalid.pool)
+	}
+}
+
+func TestNodeIPAMNext(t *testing.T) {
+	pool, _, _ := parsePodCIDRPool("10.244.0.0/23", 0)
+	m := &nodeIPAM{pool: pool, maskSize: 25}
+	cidr, err := m.next(map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, "10.244.0.0/25", cidr)
+
+	// The CIDRs overlapping an allocation are skipped
+	cidr, err = m.next(map[string]string{"i-1": "10.244.0.0/24", "i-2": "10.244.1.0/25"})
+	require.NoError(t, err)
+	assert.Equal(t, "10.244.1.128/25", cidr)
+
+	_, err = m.next(map[string]string{"i-1": "10.244.0.0/23"})
+	assert.ErrorIs(t, err, errPodCIDRPoolExhausted)
+
+	pool, _, _ = parsePodCIDRPool("fd00::/48", 0)
+	m = &nodeIPAM{pool: pool, maskSize: 64}
+	cidr, err = m.next(map[string]string{"i-1": "fd00::/64"})
+	require.NoError(t, err)
+	assert.Equal(t, "fd00:0:0:1::/64", cidr)
+}
+
+func TestNewNodeIPAM(t *testing.T) {
+	m, err := newNodeIPAM(nil, nil, 0, "")
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+	m.run(make(chan struct{}))
+
+	pool, maskSize, _ := parsePodCIDRPool("10.244.0.0/16", 0)
+	_, err = newNodeIPAM(&Cloud{}, pool, maskSize, "etcd")
+	assert.Error(t, err)
+}
+
+// syncPodCIDRNodes fills the node informer with the nodes of the client
+func syncPodCIDRNodes(t *testing.T, c *Cloud) {
+	if c.nodeInformer == nil {
+		c.nodeInformer = informers.NewSharedInformerFactory(c.kubeClient, 0).Core().V1().Nodes()
+		c.nodeInformerHasSynced = func() bool { return true }
+	}
+	nodes, err := c.kubeClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	objects := make([]interface{}, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		objects = append(objects, &nodes.Items[i])
+	}
+	require.NoError(t, c.nodeInformer.Informer().GetStore().Replace(objects, ""))
+}
+
+func podCIDRNode(t *testing.T, c *Cloud, name string) *v1.Node {
+	node, err := c.kubeClient.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	return node
+}
+
+func TestNodeIPAMTags(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	vm := s.AddVm(osc.Vm{
+		NetId:     osc.PtrString("vpc-1"),
+		PrivateIp: osc.PtrString("10.0.0.11"),
+		Placement: &osc.Placement{SubregionName: osc.PtrString("eu-west-2a")},
+	})
+	// A VM of the Net which is not a node of the cluster keeps its pod CIDR
+	s.AddVm(osc.Vm{
+		NetId:     osc.PtrString("vpc-1"),
+		PrivateIp: osc.PtrString("10.0.0.12"),
+		Tags:      &[]osc.ResourceTag{{Key: TagNamePodCIDR, Value: "10.244.0.0/24"}},
+	})
+	adopted := providerIDNodes(vm)[0]
+	adopted.Spec.PodCIDR = "10.244.1.0/24"
+	c.kubeClient = fake.NewSimpleClientset(node, adopted)
+	pool, maskSize, _ := parsePodCIDRPool("10.244.0.0/16", 0)
+	m, err := newNodeIPAM(c, pool, maskSize, PodCIDRAllocationStoreTags)
+	require.NoError(t, err)
+
+	syncPodCIDRNodes(t, c)
+	m.sync()
+	allocated := podCIDRNode(t, c, node.Name)
+	assert.Equal(t, "10.244.2.0/24", allocated.Spec.PodCIDR)
+	assert.Equal(t, []string{"10.244.2.0/24"}, allocated.Spec.PodCIDRs)
+	allocations, err := m.store.allocations()
+	require.NoError(t, err)
+	assert.Equal(t, "10.244.1.0/24", allocations[vm])
+	assert.Len(t, allocations, 3)
+
+	// A node registered again gets the pod CIDR of its VM
+	require.NoError(t, c.kubeClient.CoreV1().Nodes().Delete(context.TODO(), node.Name, metav1.DeleteOptions{}))
+	node.Spec.PodCIDR = ""
+	_, err = c.kubeClient.CoreV1().Nodes().Create(context.TODO(), node, metav1.CreateOptions{})
+	require.NoError(t, err)
+	syncPodCIDRNodes(t, c)
+	m.sync()
+	assert.Equal(t, "10.244.2.0/24", podCIDRNode(t, c, node.Name).Spec.PodCIDR)
+}
+
+func TestNodeIPAMConfigMap(t *testing.T) {
+	c, _, node := newFakeAPICloud(t)
+	c.kubeClient = fake.NewSimpleClientset(node, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: podCIDRConfigMapName, Namespace: metav1.NamespaceSystem},
+		Data:       map[string]string{"i-deleted": "10.244.0.0/24"},
+	})
+	pool, maskSize, _ := parsePodCIDRPool("10.244.0.0/16", 0)
+	m, err := newNodeIPAM(c, pool, maskSize, PodCIDRAllocationStoreConfigMap)
+	require.NoError(t, err)
+
+	syncPodCIDRNodes(t, c)
+	m.sync()
+	assert.Equal(t, "10.244.1.0/24", podCIDRNode(t, c, node.Name).Spec.PodCIDR)
+	configMap, err := c.kubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(context.TODO(), podCIDRConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	vmID, err := KubernetesInstanceID(node.Spec.ProviderID).MapToAWSInstanceID()
+	require.NoError(t, err)
+	// The pod CIDR of the VM which is no longer a node is released
+	assert.Equal(t, map[string]string{string(vmID): "10.244.1.0/24"}, configMap.Data)
+
+	// An allocation overlapping the pod CIDR of another VM fails
+	assert.ErrorIs(t, m.store.allocate("i-other", "10.244.1.0/25"), errPodCIDRAllocated)
+	require.NoError(t, m.store.allocate(string(vmID), "10.244.1.0/24"))
+}
+
+func TestNodeIPAMExhausted(t *testing.T) {
+	c, _, node := newFakeAPICloud(t)
+	c.kubeClient = fake.NewSimpleClientset(node)
+	pool, maskSize, _ := parsePodCIDRPool("10.244.0.0/24", 24)
+	m, err := newNodeIPAM(c, pool, maskSize, PodCIDRAllocationStoreConfigMap)
+	require.NoError(t, err)
+	require.NoError(t, m.store.allocate("i-other", "10.244.0.0/24"))
+
+	// The nodes are not allocated until the informer is synced
+	m.sync()
+	syncPodCIDRNodes(t, c)
+	c.nodeInformerHasSynced = func() bool { return false }
+	m.sync()
+	assert.Empty(t, podCIDRNode(t, c, node.Name).Spec.PodCIDR)
+
+	c.nodeInformerHasSynced = func() bool { return true }
+	m.sync()
+	assert.Empty(t, podCIDRNode(t, c, node.Name).Spec.PodCIDR)
+}
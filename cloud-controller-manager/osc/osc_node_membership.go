@@ -0,0 +1,148 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Node Load Balancer Membership *********************
+
+// nodeLoadBalancerHealthUnknown is used when the health of a backend cannot be retrieved
+const nodeLoadBalancerHealthUnknown = "Unknown"
+
+// parseNodeLoadBalancers parses the value of the NodeAnnotationLoadBalancers annotation
+func parseNodeLoadBalancers(value string) map[string]string {
+	members := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		health := nodeLoadBalancerHealthUnknown
+		if len(kv) == 2 && kv[1] != "" {
+			health = kv[1]
+		}
+		members[kv[0]] = health
+	}
+	return members
+}
+
+// formatNodeLoadBalancers builds the value of the NodeAnnotationLoadBalancers annotation,
+// sorted by load balancer name so that the value is stable across updates
+func formatNodeLoadBalancers(members map[string]string) string {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]string, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, name+"="+members[name])
+	}
+	return strings.Join(entries, ",")
+}
+
+// updateNodeLoadBalancerMembership records on every node whether it is registered to
+// the load balancer. Failures are only logged: the annotation is informative and must
+// not block the reconciliation of the load balancer.
+func (c *Cloud) updateNodeLoadBalancerMembership(loadBalancerName string, instanceIDs sets.String) {
+	klog.V(5).Infof("updateNodeLoadBalancerMembership(%v, %v)", loadBalancerName, instanceIDs)
+
+	if c.kubeClient == nil || c.nodeInformerHasSynced == nil || !c.nodeInformerHasSynced() {
+		klog.V(4).Infof("Node informer not ready, skipping membership annotations of load balancer %s", loadBalancerName)
+		return
+	}
+
+	nodes, err := c.nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		klog.Warningf("Unable to list nodes to update membership of load balancer %s: %q", loadBalancerName, err)
+		return
+	}
+
+	health := map[string]string{}
+	if instanceIDs.Len() > 0 {
+		health, err = c.loadBalancerService.describeLoadBalancerInstancesHealth(loadBalancerName)
+		if err != nil {
+			klog.V(2).Infof("Unable to retrieve backend health, reporting it as unknown: %q", err)
+			health = map[string]string{}
+		}
+	}
+
+	for _, node := range nodes {
+		instanceID, err := KubernetesInstanceID(node.Spec.ProviderID).MapToAWSInstanceID()
+		if err != nil {
+			continue
+		}
+
+		current := node.Annotations[NodeAnnotationLoadBalancers]
+		members := parseNodeLoadBalancers(current)
+		if instanceIDs.Has(string(instanceID)) {
+			state, found := health[string(instanceID)]
+			if !found {
+				state = nodeLoadBalancerHealthUnknown
+			}
+			members[loadBalancerName] = state
+		} else {
+			delete(members, loadBalancerName)
+		}
+
+		expected := formatNodeLoadBalancers(members)
+		if _, legacy := node.Annotations[NodeAnnotationLoadBalancersLegacy]; expected == current && !legacy {
+			continue
+		}
+		if err := c.patchNodeLoadBalancers(node, expected); err != nil {
+			klog.Warningf("Unable to update load balancer membership of node %s: %q", node.Name, err)
+		}
+	}
+}
+
+// patchNodeLoadBalancers sets the NodeAnnotationLoadBalancers annotation of the node,
+// removing it when the node is not registered to any load balancer, and removes the legacy
+// annotation
+func (c *Cloud) patchNodeLoadBalancers(node *v1.Node, value string) error {
+	var annotation interface{}
+	if value != "" {
+		annotation = value
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				NodeAnnotationLoadBalancers:       annotation,
+				NodeAnnotationLoadBalancersLegacy: nil,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.kubeClient.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
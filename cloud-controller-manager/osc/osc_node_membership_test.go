@@ -0,0 +1,115 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeLoadBalancersAnnotation(t *testing.T) {
+	members := parseNodeLoadBalancers("lb-b=OutOfService, lb-a=InService,lb-c")
+	assert.Equal(t, map[string]string{
+		"lb-a": "InService",
+		"lb-b": "OutOfService",
+		"lb-c": nodeLoadBalancerHealthUnknown,
+	}, members)
+	assert.Equal(t, "lb-a=InService,lb-b=OutOfService,lb-c=Unknown", formatNodeLoadBalancers(members))
+	assert.Empty(t, parseNodeLoadBalancers(""))
+	assert.Equal(t, "", formatNodeLoadBalancers(map[string]string{}))
+}
+
+func TestUpdateNodeLoadBalancerMembership(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+			Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-aaaaaaaa"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node-b",
+				Annotations: map[string]string{
+					NodeAnnotationLoadBalancers:       "lb-1=InService,lb-2=InService",
+					NodeAnnotationLoadBalancersLegacy: "lb-1=InService,lb-2=InService",
+				},
+			},
+			Spec: v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-bbbbbbbb"},
+		},
+	}
+	client := fake.NewSimpleClientset(nodes[0], nodes[1])
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	c.kubeClient = client
+	c.nodeInformer = informerFactory.Core().V1().Nodes()
+	c.nodeInformerHasSynced = func() bool { return true }
+	for _, node := range nodes {
+		assert.NoError(t, c.nodeInformer.Informer().GetStore().Add(node))
+	}
+
+	c.updateNodeLoadBalancerMembership("lb-1", sets.NewString("i-aaaaaaaa"))
+
+	nodeA, err := client.CoreV1().Nodes().Get(context.TODO(), "node-a", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "lb-1=Unknown", nodeA.Annotations[NodeAnnotationLoadBalancers])
+
+	nodeB, err := client.CoreV1().Nodes().Get(context.TODO(), "node-b", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "lb-2=InService", nodeB.Annotations[NodeAnnotationLoadBalancers])
+	assert.NotContains(t, nodeB.Annotations, NodeAnnotationLoadBalancersLegacy)
+}
+
+func TestEnsureLoadBalancerDeletedRemovesNodeMembership(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "uid-web"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+	loadBalancerName := c.GetLoadBalancerName(context.TODO(), TestClusterName, service)
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "node-a",
+			Annotations: map[string]string{NodeAnnotationLoadBalancers: loadBalancerName + "=InService,lb-2=InService"},
+		},
+		Spec: v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-aaaaaaaa"},
+	}
+	client := fake.NewSimpleClientset(node)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	c.kubeClient = client
+	c.nodeInformer = informerFactory.Core().V1().Nodes()
+	c.nodeInformerHasSynced = func() bool { return true }
+	assert.NoError(t, c.nodeInformer.Informer().GetStore().Add(node))
+
+	assert.NoError(t, c.EnsureLoadBalancerDeleted(context.TODO(), TestClusterName, service))
+
+	nodeA, err := client.CoreV1().Nodes().Get(context.TODO(), "node-a", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "lb-2=InService", nodeA.Annotations[NodeAnnotationLoadBalancers])
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strings"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ********************* CCM Node Names *********************
+
+// Sources of the node names of the VMs, see NodeNameStrategy
+const (
+	// NodeNameStrategyPrivateDNSName names the nodes after the private DNS name of their VM
+	NodeNameStrategyPrivateDNSName = "privateDnsName"
+	// NodeNameStrategyPrivateIP names the nodes after the private IP of their VM
+	NodeNameStrategyPrivateIP = "privateIp"
+	// NodeNameStrategyVMID names the nodes after the ID of their VM
+	NodeNameStrategyVMID = "vmId"
+	// NodeNameStrategyTagPrefix prefixes the key of the VM tag whose value names the nodes
+	NodeNameStrategyTagPrefix = "tag:"
+)
+
+// nodeNameStrategy derives the name of the node of a VM. The zero value uses the private
+// DNS name of the VM.
+type nodeNameStrategy struct {
+	source string
+	// Key of the VM tag naming the node, with the NodeNameStrategyTagPrefix source
+	tagKey string
+}
+
+// parseNodeNameStrategy parses the NodeNameStrategy of the cloud config, privateDnsName by default
+func parseNodeNameStrategy(value string) (nodeNameStrategy, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "" || value == NodeNameStrategyPrivateDNSName:
+		return nodeNameStrategy{source: NodeNameStrategyPrivateDNSName}, nil
+	case value == NodeNameStrategyPrivateIP || value == NodeNameStrategyVMID:
+		return nodeNameStrategy{source: value}, nil
+	case strings.HasPrefix(value, NodeNameStrategyTagPrefix):
+		key := strings.TrimSpace(strings.TrimPrefix(value, NodeNameStrategyTagPrefix))
+		if key == "" {
+			return nodeNameStrategy{}, fmt.Errorf("missing tag key in node name strategy %q", value)
+		}
+		return nodeNameStrategy{source: NodeNameStrategyTagPrefix, tagKey: key}, nil
+	}
+	return nodeNameStrategy{}, fmt.Errorf("unknown node name strategy %q, expected %s, %s, %s or %s<tag key>", value,
+		NodeNameStrategyPrivateDNSName, NodeNameStrategyPrivateIP, NodeNameStrategyVMID, NodeNameStrategyTagPrefix)
+}
+
+// nodeName returns the name of the node of the VM, empty when the VM has no such name
+func (s *nodeNameStrategy) nodeName(vm *osc.Vm) types.NodeName {
+	if s == nil {
+		return types.NodeName(vm.GetPrivateDnsName())
+	}
+	switch s.source {
+	case NodeNameStrategyPrivateIP:
+		return types.NodeName(vm.GetPrivateIp())
+	case NodeNameStrategyVMID:
+		return types.NodeName(vm.GetVmId())
+	case NodeNameStrategyTagPrefix:
+		value, _ := findTag(vm.Tags, s.tagKey)
+		return types.NodeName(value)
+	}
+	return types.NodeName(vm.GetPrivateDnsName())
+}
+
+// matches returns whether the VM is the one of the node: its node name or its
+// TagNameClusterNode tag is the name of the node
+func (s *nodeNameStrategy) matches(vm *osc.Vm, nodeName types.NodeName) bool {
+	if nodeName == "" {
+		return false
+	}
+	if s.nodeName(vm) == nodeName {
+		return true
+	}
+	value, found := findTag(vm.Tags, TagNameClusterNode)
+	return found && types.NodeName(value) == nodeName
+}
+
+// filters returns the filters of the VMs which may be the one of the node, see matches. The
+// VMs are filtered on their TagNameClusterNode tag with the private DNS name strategy.
+func (s *nodeNameStrategy) filters(nodeName types.NodeName) osc.FiltersVm {
+	filters := osc.FiltersVm{}
+	if s == nil {
+		filters.Tags = &[]string{fmt.Sprintf("%s=%s", TagNameClusterNode, nodeName)}
+		return filters
+	}
+	switch s.source {
+	case NodeNameStrategyVMID:
+		filters.VmIds = &[]string{string(nodeName)}
+	case NodeNameStrategyTagPrefix:
+		filters.Tags = &[]string{fmt.Sprintf("%s=%s", s.tagKey, nodeName)}
+	case NodeNameStrategyPrivateIP:
+		// oAPI has no filter on the private IP of the VMs
+	default:
+		filters.Tags = &[]string{fmt.Sprintf("%s=%s", TagNameClusterNode, nodeName)}
+	}
+	return filters
+}
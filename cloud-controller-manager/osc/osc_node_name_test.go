@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestParseNodeNameStrategy(t *testing.T) {
+	for _, value := range []string{"", "privateDnsName"} {
+		strategy, err := parseNodeNameStrategy(value)
+		require.NoError(t, err)
+		assert.Equal(t, NodeNameStrategyPrivateDNSName, strategy.source)
+	}
+	strategy, err := parseNodeNameStrategy(" tag:Hostname ")
+	require.NoError(t, err)
+	assert.Equal(t, nodeNameStrategy{source: NodeNameStrategyTagPrefix, tagKey: "Hostname"}, strategy)
+
+	for _, value := range []string{"tag:", "hostname", "PrivateIP"} {
+		_, err := parseNodeNameStrategy(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestNodeNameStrategy(t *testing.T) {
+	vm := &osc.Vm{
+		VmId:           osc.PtrString("i-12345678"),
+		PrivateDnsName: osc.PtrString("ip-10-0-0-10.eu-west-2.compute.internal"),
+		PrivateIp:      osc.PtrString("10.0.0.10"),
+		Tags:           &[]osc.ResourceTag{{Key: "Hostname", Value: "worker-1"}},
+	}
+	for value, expected := range map[string]types.NodeName{
+		"privateDnsName": "ip-10-0-0-10.eu-west-2.compute.internal",
+		"privateIp":      "10.0.0.10",
+		"vmId":           "i-12345678",
+		"tag:Hostname":   "worker-1",
+		"tag:Missing":    "",
+	} {
+		strategy, err := parseNodeNameStrategy(value)
+		require.NoError(t, err)
+		assert.Equal(t, expected, strategy.nodeName(vm), value)
+	}
+	var unset *nodeNameStrategy
+	assert.Equal(t, types.NodeName("ip-10-0-0-10.eu-west-2.compute.internal"), unset.nodeName(vm))
+
+	// The VMs tagged with the node name are found whatever the strategy
+	strategy, _ := parseNodeNameStrategy("tag:Missing")
+	assert.False(t, strategy.matches(vm, ""))
+	assert.False(t, strategy.matches(vm, "worker-1"))
+	*vm.Tags = append(*vm.Tags, osc.ResourceTag{Key: TagNameClusterNode, Value: "worker-1"})
+	assert.True(t, strategy.matches(vm, "worker-1"))
+}
+
+func TestFindInstanceByNodeNameStrategy(t *testing.T) {
+	c, s, _ := newFakeAPICloud(t)
+	clusterTag := osc.ResourceTag{Key: TagNameKubernetesClusterPrefix + TestClusterID, Value: ResourceLifecycleOwned}
+	vm := s.AddVm(osc.Vm{
+		NetId:     osc.PtrString("vpc-1"),
+		PrivateIp: osc.PtrString("10.0.0.20"),
+		Placement: &osc.Placement{SubregionName: osc.PtrString("eu-west-2a")},
+		Tags:      &[]osc.ResourceTag{clusterTag, {Key: "Hostname", Value: "worker-2"}},
+	})
+
+	for value, nodeName := range map[string]types.NodeName{
+		"privateIp":    "10.0.0.20",
+		"vmId":         types.NodeName(vm),
+		"tag:Hostname": "worker-2",
+	} {
+		strategy, err := parseNodeNameStrategy(value)
+		require.NoError(t, err)
+		c.nodeNames = strategy
+		instance, err := c.instanceService.findInstanceByNodeName(nodeName)
+		require.NoError(t, err, value)
+		require.NotNil(t, instance, value)
+		assert.Equal(t, vm, instance.GetVmId(), value)
+
+		instances, err := c.instanceService.getInstancesByNodeNames([]string{string(nodeName)})
+		require.NoError(t, err, value)
+		require.Len(t, instances, 1, value)
+		assert.Equal(t, vm, instances[0].GetVmId(), value)
+	}
+
+	// The VM is not named after its private IP with the default strategy
+	c.nodeNames = nodeNameStrategy{}
+	instance, err := c.instanceService.findInstanceByNodeName("10.0.0.20")
+	require.NoError(t, err)
+	assert.Nil(t, instance)
+}
+
+func TestInstanceExistsByNodeNameTag(t *testing.T) {
+	c, s, _ := newFakeAPICloud(t)
+	clusterTag := osc.ResourceTag{Key: TagNameKubernetesClusterPrefix + TestClusterID, Value: ResourceLifecycleOwned}
+	s.AddVm(osc.Vm{
+		NetId:     osc.PtrString("vpc-1"),
+		PrivateIp: osc.PtrString("10.0.0.30"),
+		Placement: &osc.Placement{SubregionName: osc.PtrString("eu-west-2a")},
+		Tags:      &[]osc.ResourceTag{clusterTag, {Key: TagNameClusterNode, Value: "worker-3"}},
+	})
+	strategy, err := parseNodeNameStrategy("tag:Hostname")
+	require.NoError(t, err)
+	c.nodeNames = strategy
+
+	// The VM of a node without provider ID is found by its TagNameClusterNode tag
+	exists, err := c.instances.InstanceExists(context.TODO(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-3"}})
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = c.instances.InstanceExists(context.TODO(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-4"}})
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM NodePort NIC *********************
+
+// parseNodePortNic parses the NodePortNic of the cloud config, a subnet ID or a NIC device
+// number, or "" for the security groups of the VM
+func parseNodePortNic(value string) (string, error) {
+	nics, err := parseNicSelectors(value)
+	if err != nil {
+		return "", err
+	}
+	if len(nics) > 1 {
+		return "", fmt.Errorf("expected a single NIC, got %q", value)
+	}
+	if len(nics) == 0 {
+		return "", nil
+	}
+	return nics[0], nil
+}
+
+// nodePortSecurityGroups returns the security groups of the NIC of the VM carrying the
+// NodePort traffic, which are opened to the load balancers: the NIC selected by the
+// TagNameNodePortNic tag of the VM, or else by the NodePortNic of the cloud config. Without
+// selector, or when no NIC of the VM matches it, the security groups of the VM are returned.
+func nodePortSecurityGroups(instance *osc.Vm, nodePortNic string) []osc.SecurityGroupLight {
+	selector := nodePortNic
+	for _, tag := range instance.GetTags() {
+		if tag.GetKey() != TagNameNodePortNic {
+			continue
+		}
+		if nic, err := parseNodePortNic(tag.GetValue()); err != nil {
+			klog.Warningf("Ignoring invalid %s tag of VM %s: %v", TagNameNodePortNic, instance.GetVmId(), err)
+		} else {
+			selector = nic
+		}
+	}
+	if selector == "" {
+		return instance.GetSecurityGroups()
+	}
+
+	for _, nic := range instance.GetNics() {
+		if nic.GetState() != "in-use" || nic.LinkNic == nil {
+			continue
+		}
+		if nicMatches(selector, nic.GetSubnetId(), nic.LinkNic.GetDeviceNumber()) {
+			return nic.GetSecurityGroups()
+		}
+	}
+	klog.Warningf("No NIC %s found on VM %s, using the security groups of the VM", selector, instance.GetVmId())
+	return instance.GetSecurityGroups()
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNodePortNic(t *testing.T) {
+	nic, err := parseNodePortNic("")
+	assert.NoError(t, err)
+	assert.Equal(t, "", nic)
+	nic, err = parseNodePortNic("subnet-nodeport")
+	assert.NoError(t, err)
+	assert.Equal(t, "subnet-nodeport", nic)
+	_, err = parseNodePortNic("0,1")
+	assert.Error(t, err)
+	_, err = parseNodePortNic("eth0")
+	assert.Error(t, err)
+}
+
+func TestFindSecurityGroupForInstanceNodePortNic(t *testing.T) {
+	storage := testNic(1, "subnet-storage", "10.0.1.1")
+	storage.SecurityGroups = &[]osc.SecurityGroupLight{{SecurityGroupId: aws.String("sg-storage")}}
+	instance := &osc.Vm{
+		VmId:           aws.String("i-0"),
+		SecurityGroups: &[]osc.SecurityGroupLight{{SecurityGroupId: aws.String("sg-node")}},
+		Nics:           &[]osc.NicLight{testNic(0, "subnet-node", "10.0.0.1"), storage},
+	}
+	groups := map[string]osc.SecurityGroup{}
+
+	// The security groups of the VM are opened by default
+	securityGroup, err := findSecurityGroupForInstance(instance, groups, "")
+	require.NoError(t, err)
+	assert.Equal(t, "sg-node", securityGroup.GetSecurityGroupId())
+
+	securityGroup, err = findSecurityGroupForInstance(instance, groups, "subnet-storage")
+	require.NoError(t, err)
+	assert.Equal(t, "sg-storage", securityGroup.GetSecurityGroupId())
+
+	// The tag of the VM takes precedence, the VM groups are used when no NIC matches
+	instance.Tags = &[]osc.ResourceTag{{Key: TagNameNodePortNic, Value: "1"}}
+	securityGroup, err = findSecurityGroupForInstance(instance, groups, "")
+	require.NoError(t, err)
+	assert.Equal(t, "sg-storage", securityGroup.GetSecurityGroupId())
+	instance.Tags = &[]osc.ResourceTag{{Key: TagNameNodePortNic, Value: "subnet-unknown"}}
+	securityGroup, err = findSecurityGroupForInstance(instance, groups, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "sg-node", securityGroup.GetSecurityGroupId())
+}
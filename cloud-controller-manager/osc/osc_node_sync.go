@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Node Sync Batching *********************
+
+// nodeSyncSnapshotFunc returns a snapshot of the VMs containing the instances
+type nodeSyncSnapshotFunc func(instanceIDs []InstanceID) (*allInstancesSnapshot, error)
+
+// nodeSyncBatcher batches the node-change-driven updates of the load balancers of all the
+// services. When many nodes join at once, the service controller updates every load
+// balancer for each node event: the updates received within the window wait for a single
+// snapshot of the VMs of all their nodes, which is then reused from the instance cache by
+// each update, instead of each update reading the VMs missing from the cache.
+type nodeSyncBatcher struct {
+	window   time.Duration
+	snapshot nodeSyncSnapshotFunc
+
+	mutex   sync.Mutex
+	pending *nodeSyncBatch
+}
+
+// nodeSyncBatch holds the updates received within a window
+type nodeSyncBatch struct {
+	instanceIDs map[InstanceID]bool
+	updates     int
+	// Closed once the snapshot of the batch is read
+	ready chan struct{}
+	err   error
+}
+
+func newNodeSyncBatcher(window time.Duration, snapshot nodeSyncSnapshotFunc) *nodeSyncBatcher {
+	return &nodeSyncBatcher{
+		window:   window,
+		snapshot: snapshot,
+	}
+}
+
+// wait adds the nodes of a load balancer update to the current batch and waits for the
+// snapshot of its VMs. It returns immediately when the batching is disabled.
+func (b *nodeSyncBatcher) wait(ctx context.Context, nodes []*v1.Node) error {
+	if b == nil || b.window <= 0 {
+		return nil
+	}
+
+	b.mutex.Lock()
+	batch := b.pending
+	if batch == nil {
+		batch = &nodeSyncBatch{instanceIDs: make(map[InstanceID]bool), ready: make(chan struct{})}
+		b.pending = batch
+		time.AfterFunc(b.window, func() { b.flush(batch) })
+	}
+	for _, instanceID := range mapToAWSInstanceIDsTolerant(nodes) {
+		batch.instanceIDs[instanceID] = true
+	}
+	batch.updates++
+	b.mutex.Unlock()
+
+	select {
+	case <-batch.ready:
+		return batch.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush reads the snapshot of the VMs of the batch and releases its updates
+func (b *nodeSyncBatcher) flush(batch *nodeSyncBatch) {
+	b.mutex.Lock()
+	if b.pending == batch {
+		b.pending = nil
+	}
+	instanceIDs := make([]InstanceID, 0, len(batch.instanceIDs))
+	for instanceID := range batch.instanceIDs {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	updates := batch.updates
+	b.mutex.Unlock()
+
+	klog.V(2).Infof("Synchronizing the nodes of %d load balancer updates with a single snapshot of %d VMs",
+		updates, len(instanceIDs))
+	recordNodeSyncBatchMetric(updates)
+	_, batch.err = b.snapshot(instanceIDs)
+	if batch.err != nil {
+		klog.Warningf("Unable to read the VMs of the batched node updates: %v", batch.err)
+	}
+	close(batch.ready)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type recordedNodeSyncSnapshots struct {
+	mutex sync.Mutex
+	calls [][]InstanceID
+	err   error
+}
+
+func (r *recordedNodeSyncSnapshots) snapshot(instanceIDs []InstanceID) (*allInstancesSnapshot, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	sort.Slice(instanceIDs, func(i, j int) bool { return instanceIDs[i] < instanceIDs[j] })
+	r.calls = append(r.calls, instanceIDs)
+	return &allInstancesSnapshot{}, r.err
+}
+
+func providerIDNodes(vmIDs ...string) []*v1.Node {
+	nodes := []*v1.Node{}
+	for _, vmID := range vmIDs {
+		nodes = append(nodes, &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: vmID},
+			Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/" + vmID},
+		})
+	}
+	return nodes
+}
+
+func TestNodeSyncBatcherDisabled(t *testing.T) {
+	recorder := &recordedNodeSyncSnapshots{}
+	assert.NoError(t, newNodeSyncBatcher(0, recorder.snapshot).wait(context.TODO(), providerIDNodes("i-1")))
+	var unset *nodeSyncBatcher
+	assert.NoError(t, unset.wait(context.TODO(), providerIDNodes("i-1")))
+	assert.Empty(t, recorder.calls)
+}
+
+func TestNodeSyncBatcherSharesSnapshot(t *testing.T) {
+	recorder := &recordedNodeSyncSnapshots{}
+	b := newNodeSyncBatcher(50*time.Millisecond, recorder.snapshot)
+
+	var wg sync.WaitGroup
+	for _, nodes := range [][]*v1.Node{providerIDNodes("i-1", "i-2"), providerIDNodes("i-2", "i-3"), providerIDNodes("i-1")} {
+		wg.Add(1)
+		go func(nodes []*v1.Node) {
+			defer wg.Done()
+			assert.NoError(t, b.wait(context.TODO(), nodes))
+		}(nodes)
+	}
+	wg.Wait()
+	require.Len(t, recorder.calls, 1)
+	assert.Equal(t, []InstanceID{"i-1", "i-2", "i-3"}, recorder.calls[0])
+
+	// The next updates start a new batch
+	require.NoError(t, b.wait(context.TODO(), providerIDNodes("i-4")))
+	require.Len(t, recorder.calls, 2)
+	assert.Equal(t, []InstanceID{"i-4"}, recorder.calls[1])
+}
+
+func TestNodeSyncBatcherErrors(t *testing.T) {
+	recorder := &recordedNodeSyncSnapshots{err: errors.New("throttled")}
+	b := newNodeSyncBatcher(10*time.Millisecond, recorder.snapshot)
+	assert.EqualError(t, b.wait(context.TODO(), providerIDNodes("i-1")), "throttled")
+
+	b = newNodeSyncBatcher(time.Minute, recorder.snapshot)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	assert.ErrorIs(t, b.wait(ctx, providerIDNodes("i-1")), context.Canceled)
+}
+
+func TestUpdateLoadBalancerNodeSyncBatch(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	services := []*v1.Service{newFakeAPIService("web"), newFakeAPIService("api")}
+	for _, service := range services {
+		_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+		require.NoError(t, err)
+	}
+	c.nodeSync = newNodeSyncBatcher(50*time.Millisecond, func(instanceIDs []InstanceID) (*allInstancesSnapshot, error) {
+		return c.instanceCache.describeAllInstancesCached(cacheCriteria{HasInstances: instanceIDs})
+	})
+
+	// A node joins: the updates of both load balancers read the VMs once
+	clusterTag := osc.ResourceTag{Key: TagNameKubernetesClusterPrefix + TestClusterID, Value: ResourceLifecycleOwned}
+	vm := s.AddVm(osc.Vm{
+		NetId:     osc.PtrString("vpc-1"),
+		PrivateIp: osc.PtrString("10.0.0.11"),
+		Placement: &osc.Placement{SubregionName: osc.PtrString("eu-west-2a")},
+		Tags:      &[]osc.ResourceTag{clusterTag},
+	})
+	nodes := append([]*v1.Node{node}, providerIDNodes(vm)...)
+	readVms := s.Calls("ReadVms")
+	var wg sync.WaitGroup
+	for _, service := range services {
+		wg.Add(1)
+		go func(service *v1.Service) {
+			defer wg.Done()
+			assert.NoError(t, c.UpdateLoadBalancer(context.TODO(), TestClusterName, service, nodes))
+		}(service)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, s.Calls("ReadVms")-readVms)
+	for _, service := range services {
+		lb, found := s.LoadBalancer(c.GetLoadBalancerName(context.TODO(), TestClusterName, service))
+		require.True(t, found)
+		assert.Len(t, lb.Instances, 2)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Node Update Coalescing *********************
+
+// nodeUpdateFunc applies a backend node set to a load balancer
+type nodeUpdateFunc func(nodes []*v1.Node) error
+
+// nodeUpdateCoalescer throttles the node-change-driven updates of each load balancer.
+// The first update of a window is applied immediately; the following ones only
+// record the latest node set, which is applied once when the window expires.
+// The callers of a deferred update return before it is applied, so a failed deferred
+// update calls the retry of its latest caller, which requeues its service.
+type nodeUpdateCoalescer struct {
+	window time.Duration
+
+	mutex  sync.Mutex
+	states map[string]*nodeUpdateState
+}
+
+// nodeUpdateState holds the coalescing state of a single load balancer
+type nodeUpdateState struct {
+	lastApplied time.Time
+	running     bool
+	timer       *time.Timer
+
+	// Latest deferred update, applied when the timer fires, and retried on failure
+	nodes []*v1.Node
+	apply nodeUpdateFunc
+	retry func()
+}
+
+func newNodeUpdateCoalescer(window time.Duration) *nodeUpdateCoalescer {
+	return &nodeUpdateCoalescer{
+		window: window,
+		states: make(map[string]*nodeUpdateState),
+	}
+}
+
+// run applies the node set to the load balancer identified by key, either
+// immediately, returning its error, or at the end of the current window, calling retry
+// when it fails.
+func (c *nodeUpdateCoalescer) run(key string, nodes []*v1.Node, apply nodeUpdateFunc, retry func()) error {
+	if c == nil || c.window <= 0 {
+		return apply(nodes)
+	}
+
+	c.mutex.Lock()
+	state, found := c.states[key]
+	if !found {
+		state = &nodeUpdateState{}
+		c.states[key] = state
+	}
+
+	if !state.running && state.timer == nil && time.Since(state.lastApplied) >= c.window {
+		state.running = true
+		state.lastApplied = time.Now()
+		c.mutex.Unlock()
+
+		err := apply(nodes)
+
+		c.mutex.Lock()
+		state.running = false
+		c.mutex.Unlock()
+		return err
+	}
+
+	state.nodes = nodes
+	state.apply = apply
+	state.retry = retry
+	if state.timer == nil {
+		delay := c.window - time.Since(state.lastApplied)
+		if delay <= 0 {
+			delay = c.window
+		}
+		state.timer = time.AfterFunc(delay, func() { c.flush(key) })
+	}
+	c.mutex.Unlock()
+
+	klog.V(4).Infof("Coalescing node update of load balancer %s (%d nodes)", key, len(nodes))
+	return nil
+}
+
+// flush applies the latest deferred update of the load balancer identified by key
+func (c *nodeUpdateCoalescer) flush(key string) {
+	c.mutex.Lock()
+	state, found := c.states[key]
+	if !found || state.apply == nil {
+		if found {
+			state.timer = nil
+		}
+		c.mutex.Unlock()
+		return
+	}
+	if state.running {
+		// An immediate update is still in progress, try again later
+		state.timer = time.AfterFunc(c.window, func() { c.flush(key) })
+		c.mutex.Unlock()
+		return
+	}
+
+	nodes := state.nodes
+	apply := state.apply
+	retry := state.retry
+	state.nodes = nil
+	state.apply = nil
+	state.retry = nil
+	state.timer = nil
+	state.running = true
+	state.lastApplied = time.Now()
+	c.mutex.Unlock()
+
+	klog.V(2).Infof("Applying coalesced node update of load balancer %s (%d nodes)", key, len(nodes))
+	err := apply(nodes)
+
+	c.mutex.Lock()
+	state.running = false
+	c.mutex.Unlock()
+
+	if err != nil {
+		klog.Warningf("Coalesced node update of load balancer %s failed, retrying: %q", key, err)
+		if retry != nil {
+			retry()
+		}
+	}
+}
+
+// forget drops any pending update of the load balancer identified by key
+func (c *nodeUpdateCoalescer) forget(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if state, found := c.states[key]; found {
+		if state.timer != nil {
+			state.timer.Stop()
+		}
+		delete(c.states, key)
+	}
+}
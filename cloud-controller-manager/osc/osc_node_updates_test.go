@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type recordedNodeUpdates struct {
+	mutex sync.Mutex
+	calls [][]*v1.Node
+	err   error
+}
+
+func (r *recordedNodeUpdates) apply(nodes []*v1.Node) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, nodes)
+	return r.err
+}
+
+func (r *recordedNodeUpdates) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.calls)
+}
+
+func testNodes(names ...string) []*v1.Node {
+	nodes := []*v1.Node{}
+	for _, name := range names {
+		nodes = append(nodes, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	return nodes
+}
+
+func TestNodeUpdateCoalescerDisabled(t *testing.T) {
+	recorder := &recordedNodeUpdates{}
+	c := newNodeUpdateCoalescer(0)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.run("lb", testNodes("a"), recorder.apply, nil))
+	}
+	assert.Equal(t, 3, recorder.count())
+}
+
+func TestNodeUpdateCoalescerAppliesLatestNodes(t *testing.T) {
+	recorder := &recordedNodeUpdates{}
+	c := newNodeUpdateCoalescer(50 * time.Millisecond)
+
+	assert.NoError(t, c.run("lb", testNodes("a"), recorder.apply, nil))
+	assert.NoError(t, c.run("lb", testNodes("a", "b"), recorder.apply, nil))
+	assert.NoError(t, c.run("lb", testNodes("a", "b", "c"), recorder.apply, nil))
+	assert.Equal(t, 1, recorder.count(), "only the leading update should be applied immediately")
+
+	assert.Eventually(t, func() bool { return recorder.count() == 2 }, time.Second, 10*time.Millisecond)
+	recorder.mutex.Lock()
+	assert.Len(t, recorder.calls[1], 3, "the deferred update should use the latest node set")
+	recorder.mutex.Unlock()
+}
+
+func TestNodeUpdateCoalescerRetriesDeferredError(t *testing.T) {
+	recorder := &recordedNodeUpdates{}
+	c := newNodeUpdateCoalescer(50 * time.Millisecond)
+	var retries int32
+	retry := func() { atomic.AddInt32(&retries, 1) }
+
+	assert.NoError(t, c.run("lb", testNodes("a"), recorder.apply, retry))
+	recorder.err = errors.New("boom")
+	assert.NoError(t, c.run("lb", testNodes("b"), recorder.apply, retry))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&retries) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, recorder.count())
+
+	// The error is not reported to the next caller, an immediate update returning its own
+	recorder.err = nil
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, c.run("lb", testNodes("c"), recorder.apply, retry))
+	assert.Equal(t, 3, recorder.count())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&retries))
+}
+
+func TestNodeUpdateCoalescerForget(t *testing.T) {
+	recorder := &recordedNodeUpdates{}
+	c := newNodeUpdateCoalescer(50 * time.Millisecond)
+
+	assert.NoError(t, c.run("lb", testNodes("a"), recorder.apply, nil))
+	assert.NoError(t, c.run("lb", testNodes("b"), recorder.apply, nil))
+	c.forget("lb")
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, recorder.count(), "pending update should have been dropped")
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM NodePort Reachability Check *********************
+
+const (
+	// nodePortDialTimeout bounds the duration of a single NodePort connection attempt
+	nodePortDialTimeout = 2 * time.Second
+	// nodePortCheckMaxBackends is the number of backends tried per listener before
+	// the NodePort is reported as unreachable
+	nodePortCheckMaxBackends = 3
+)
+
+// nodePortReachabilityCheck opens a TCP connection from the CCM to the NodePort of
+// every listener on a registered backend, to catch security group or routing
+// misconfigurations before the Service reports a usable ingress.
+type nodePortReachabilityCheck struct {
+	dial func(network, address string, timeout time.Duration) (net.Conn, error)
+}
+
+func newNodePortReachabilityCheck(enabled bool) *nodePortReachabilityCheck {
+	if !enabled {
+		return nil
+	}
+	return &nodePortReachabilityCheck{dial: net.DialTimeout}
+}
+
+// check returns an error listing the NodePorts that no backend accepts connections on
+func (n *nodePortReachabilityCheck) check(listeners []*elb.Listener, instances map[InstanceID]*osc.Vm) error {
+	if n == nil || len(instances) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(instances))
+	for id, vm := range instances {
+		if vm.GetPrivateIp() != "" {
+			ids = append(ids, string(id))
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > nodePortCheckMaxBackends {
+		ids = ids[:nodePortCheckMaxBackends]
+	}
+
+	unreachable := []string{}
+	checked := make(map[int64]bool)
+	for _, listener := range listeners {
+		port := aws.Int64Value(listener.InstancePort)
+		// The SCTP node ports can't be checked with a TCP connection
+		if port == 0 || checked[port] || isSCTPListener(listener.InstanceProtocol) {
+			continue
+		}
+		checked[port] = true
+
+		reachable := false
+		for _, id := range ids {
+			address := net.JoinHostPort(instances[InstanceID(id)].GetPrivateIp(), strconv.FormatInt(port, 10))
+			conn, err := n.dial("tcp", address, nodePortDialTimeout)
+			if err != nil {
+				klog.V(4).Infof("NodePort %d of instance %s is not reachable: %q", port, id, err)
+				continue
+			}
+			conn.Close()
+			reachable = true
+			break
+		}
+		if !reachable {
+			unreachable = append(unreachable, strconv.FormatInt(port, 10))
+		}
+	}
+
+	if len(unreachable) > 0 {
+		return fmt.Errorf("NodePorts %s are not reachable on backends %v", strings.Join(unreachable, ","), ids)
+	}
+	return nil
+}
+
+// checkNodePortReachability reports the NodePorts of the load balancer that are not
+// reachable on its backends when the reachability check is enabled
+func (c *Cloud) checkNodePortReachability(service *v1.Service, loadBalancerName string,
+	listeners []*elb.Listener, instances map[InstanceID]*osc.Vm) error {
+	klog.V(5).Infof("checkNodePortReachability(%v, %v, %v, %v)", service, loadBalancerName, listeners, instances)
+	err := c.nodePortCheck.check(listeners, instances)
+	if err == nil {
+		return nil
+	}
+	klog.Warningf("Load balancer %s is not ready: %q", loadBalancerName, err)
+	if c.eventRecorder != nil {
+		c.eventRecorder.Eventf(service, v1.EventTypeWarning, "NodePortUnreachable",
+			"Load balancer %s is not ready: %v", loadBalancerName, err)
+	}
+	return newLoadBalancerNotReadyError(loadBalancerName, NotReadyWaitingForState, "%v", err)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodePortReachabilityCheck(t *testing.T) {
+	assert.Nil(t, newNodePortReachabilityCheck(false))
+	var disabled *nodePortReachabilityCheck
+	assert.NoError(t, disabled.check(nil, nil))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	openPort, _ := strconv.ParseInt(portStr, 10, 64)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	_, portStr, _ = net.SplitHostPort(closed.Addr().String())
+	closedPort, _ := strconv.ParseInt(portStr, 10, 64)
+	closed.Close()
+
+	instances := map[InstanceID]*osc.Vm{
+		"i-unreachable": {PrivateIp: osc.PtrString("127.0.0.2")},
+		"i-reachable":   {PrivateIp: osc.PtrString("127.0.0.1")},
+	}
+	check := newNodePortReachabilityCheck(true)
+
+	err = check.check([]*elb.Listener{{InstancePort: aws.Int64(openPort)}}, instances)
+	assert.NoError(t, err)
+
+	err = check.check([]*elb.Listener{
+		{InstancePort: aws.Int64(openPort)},
+		{InstancePort: aws.Int64(closedPort)},
+	}, instances)
+	assert.ErrorContains(t, err, "NodePorts "+strconv.FormatInt(closedPort, 10)+" are not reachable")
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ********************* CCM Owner Cluster *********************
+
+// AllowedOwnerClusterIDs is set by the --allowed-owner-cluster-ids flag and takes
+// precedence over the AllowedOwnerClusterIDs of the cloud config
+var AllowedOwnerClusterIDs string
+
+// parseAllowedOwnerClusterIDs parses the comma separated list of the cluster IDs which
+// services may set in the ServiceAnnotationLoadBalancerOwnerClusterID annotation
+func parseAllowedOwnerClusterIDs(value string) sets.String {
+	allowed := sets.NewString()
+	for _, clusterID := range strings.Split(value, ",") {
+		if clusterID = strings.TrimSpace(clusterID); clusterID != "" {
+			allowed.Insert(clusterID)
+		}
+	}
+	return allowed
+}
+
+// serviceTagging returns the tagging of the resources created for the service: the
+// tagging of the cluster, or of the owner cluster requested by the
+// ServiceAnnotationLoadBalancerOwnerClusterID annotation when it is allowed
+func (c *Cloud) serviceTagging(annotations map[string]string) (*resourceTagging, error) {
+	owner, found := annotations[ServiceAnnotationLoadBalancerOwnerClusterID]
+	if !found || owner == "" || owner == c.tagging.clusterID() {
+		return &c.tagging, nil
+	}
+	if !c.allowedOwnerClusterIDs.Has(owner) {
+		return nil, fmt.Errorf("cluster %q of annotation %s is not in AllowedOwnerClusterIDs",
+			owner, ServiceAnnotationLoadBalancerOwnerClusterID)
+	}
+	return c.tagging.withOwner(owner), nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceTagging(t *testing.T) {
+	cfg := CloudConfig{}
+	cfg.Global.AllowedOwnerClusterIDs = "gateway, tenant-a"
+	c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+
+	tagging, err := c.serviceTagging(map[string]string{})
+	assert.NoError(t, err)
+	assert.Same(t, &c.tagging, tagging)
+
+	tagging, err = c.serviceTagging(map[string]string{ServiceAnnotationLoadBalancerOwnerClusterID: TestClusterID})
+	assert.NoError(t, err)
+	assert.Same(t, &c.tagging, tagging)
+
+	_, err = c.serviceTagging(map[string]string{ServiceAnnotationLoadBalancerOwnerClusterID: "tenant-b"})
+	assert.Error(t, err)
+
+	tagging, err = c.serviceTagging(map[string]string{ServiceAnnotationLoadBalancerOwnerClusterID: "gateway"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		TagNameKubernetesClusterPrefix + "gateway": string(ResourceLifecycleOwned),
+		TagNameManagedBy: TestClusterID,
+	}, tagging.buildTags(ResourceLifecycleOwned, nil))
+
+	// The extra tags are set on the resources of the owner cluster too
+	c.tagging.extraTags = map[string]string{"team": "platform"}
+	tagging, err = c.serviceTagging(map[string]string{ServiceAnnotationLoadBalancerOwnerClusterID: "gateway"})
+	assert.NoError(t, err)
+	assert.Equal(t, "platform", tagging.buildTags(ResourceLifecycleOwned, nil)["team"])
+
+	owned := []osc.ResourceTag{
+		{Key: TagNameKubernetesClusterPrefix + "gateway", Value: string(ResourceLifecycleOwned)},
+		{Key: TagNameManagedBy, Value: TestClusterID},
+	}
+	assert.False(t, c.tagging.hasClusterTag(&owned))
+	assert.True(t, c.tagging.isManagedBy(&owned))
+	assert.False(t, c.tagging.withOwner("tenant-a").isManagedBy(&owned))
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Pagination *********************
+
+// The oAPI reads of the Compute interface (ReadVms, ReadSecurityGroups, ReadSubnets, ...)
+// are not paged by the osc-sdk-go version in use: their requests have no ResultsPerPage
+// and their responses no NextPageToken, and the whole result is returned at once.
+// The LBU DescribeLoadBalancers call is paged with Marker and NextMarker.
+
+// pagedLoadBalancer reads all the pages of the LBU list calls
+type pagedLoadBalancer struct {
+	LoadBalancer
+}
+
+func newPagedLoadBalancer(loadBalancer LoadBalancer) LoadBalancer {
+	return &pagedLoadBalancer{LoadBalancer: loadBalancer}
+}
+
+// DescribeLoadBalancers returns the load balancers of all the pages. A request with a
+// Marker reads a single page, the caller handling the pagination.
+func (p *pagedLoadBalancer) DescribeLoadBalancers(input *elb.DescribeLoadBalancersInput) (*elb.DescribeLoadBalancersOutput, error) {
+	if aws.StringValue(input.Marker) != "" {
+		return p.LoadBalancer.DescribeLoadBalancers(input)
+	}
+
+	request := *input
+	output := &elb.DescribeLoadBalancersOutput{LoadBalancerDescriptions: []*elb.LoadBalancerDescription{}}
+	for pages := 1; ; pages++ {
+		response, err := p.LoadBalancer.DescribeLoadBalancers(&request)
+		if err != nil {
+			return nil, err
+		}
+		output.LoadBalancerDescriptions = append(output.LoadBalancerDescriptions, response.LoadBalancerDescriptions...)
+		if aws.StringValue(response.NextMarker) == "" {
+			klog.V(5).Infof("Read %d load balancers in %d pages", len(output.LoadBalancerDescriptions), pages)
+			return output, nil
+		}
+		request.Marker = response.NextMarker
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingELB counts the DescribeLoadBalancers calls
+type countingELB struct {
+	*FakeELB
+	calls int
+	err   error
+}
+
+func (c *countingELB) DescribeLoadBalancers(input *elb.DescribeLoadBalancersInput) (*elb.DescribeLoadBalancersOutput, error) {
+	c.calls++
+	if c.err != nil && c.calls > 1 {
+		return nil, c.err
+	}
+	return c.FakeELB.DescribeLoadBalancers(input)
+}
+
+func TestPagedLoadBalancerDescribeLoadBalancers(t *testing.T) {
+	for _, count := range []int{0, 1, 2, 3, 4, 5} {
+		t.Run(fmt.Sprintf("%d load balancers", count), func(t *testing.T) {
+			fake := &countingELB{FakeELB: &FakeELB{PageSize: 2, LoadBalancers: map[string]*elb.LoadBalancerDescription{}}}
+			expected := []string{}
+			for i := 0; i < count; i++ {
+				name := fmt.Sprintf("lb-%d", i)
+				fake.LoadBalancers[name] = &elb.LoadBalancerDescription{LoadBalancerName: aws.String(name)}
+				expected = append(expected, name)
+			}
+
+			response, err := newPagedLoadBalancer(fake).DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{})
+			assert.NoError(t, err)
+			names := []string{}
+			for _, lb := range response.LoadBalancerDescriptions {
+				names = append(names, aws.StringValue(lb.LoadBalancerName))
+			}
+			assert.Equal(t, expected, names)
+			assert.Nil(t, response.NextMarker)
+			pages := (count + 1) / 2
+			if pages == 0 {
+				pages = 1
+			}
+			assert.Equal(t, pages, fake.calls)
+		})
+	}
+}
+
+func TestPagedLoadBalancerMarker(t *testing.T) {
+	fake := &countingELB{FakeELB: &FakeELB{PageSize: 2, LoadBalancers: map[string]*elb.LoadBalancerDescription{
+		"lb-0": {LoadBalancerName: aws.String("lb-0")},
+		"lb-1": {LoadBalancerName: aws.String("lb-1")},
+		"lb-2": {LoadBalancerName: aws.String("lb-2")},
+		"lb-3": {LoadBalancerName: aws.String("lb-3")},
+	}}}
+
+	// A request with a marker reads a single page
+	response, err := newPagedLoadBalancer(fake).DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{Marker: aws.String("lb-0")})
+	assert.NoError(t, err)
+	assert.Len(t, response.LoadBalancerDescriptions, 2)
+	assert.Equal(t, "lb-2", aws.StringValue(response.NextMarker))
+	assert.Equal(t, 1, fake.calls)
+
+	// The error of a page fails the whole read
+	fake.calls = 0
+	fake.err = errors.New("Throttling")
+	_, err = newPagedLoadBalancer(fake).DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{})
+	assert.Error(t, err)
+	assert.Equal(t, 2, fake.calls)
+}
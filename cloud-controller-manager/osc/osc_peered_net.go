@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Peered Net *********************
+
+// The load balancers may be created in another Net than the nodes, peered with it (e.g. a
+// shared "edge" Net terminating the traffic), see ServiceAnnotationLoadBalancerNetID. The
+// security group rules can't reference security groups across a peering, so the node
+// security groups are opened to the IP ranges of the subnets of the load balancer, on the
+// instance ports of its listeners and on its health check port. These rules are marked as
+// the rules opened to the external IPs (see ensureExternalIPsIngress), with
+// TagNamePeeredRulesPrefix and the legacy TagNamePeeredRulePrefix.
+
+// loadBalancerNetID returns the Net of the load balancer of a service: the Net of the
+// ServiceAnnotationLoadBalancerNetID annotation or of LoadBalancerNetID in the cloud config,
+// and otherwise the Net of the nodes
+func (c *Cloud) loadBalancerNetID(annotations map[string]string) string {
+	if netID := strings.TrimSpace(annotations[ServiceAnnotationLoadBalancerNetID]); netID != "" {
+		return netID
+	}
+	if c.cfg != nil && c.cfg.Global.LoadBalancerNetID != "" {
+		return c.cfg.Global.LoadBalancerNetID
+	}
+	return c.vpcID
+}
+
+// isPeeredLoadBalancer returns whether the load balancer of a service is in another Net
+// than the nodes
+func (c *Cloud) isPeeredLoadBalancer(annotations map[string]string) bool {
+	return c.vpcID != "" && c.loadBalancerNetID(annotations) != c.vpcID
+}
+
+// isPeeredNet returns whether an existing load balancer is in another Net than the nodes,
+// from its Net when known. The Net of a load balancer can't be changed.
+func (c *Cloud) isPeeredNet(lb *elb.LoadBalancerDescription, annotations map[string]string) bool {
+	if netID := aws.StringValue(lb.VPCId); netID != "" {
+		return c.vpcID != "" && netID != c.vpcID
+	}
+	return c.isPeeredLoadBalancer(annotations)
+}
+
+// loadBalancerSubnetService returns the subnet service selecting the subnets of the load
+// balancer of a service, in its Net
+func (c *Cloud) loadBalancerSubnetService(annotations map[string]string) SubnetService {
+	if !c.isPeeredLoadBalancer(annotations) {
+		return c.subnetService
+	}
+	// The route tables of the Net of the nodes are the ones cached
+	return newSubnetService(c.compute, &c.tagging, &cloudNetwork{vpcID: c.loadBalancerNetID(annotations)}, nil)
+}
+
+// loadBalancerSecurityGroupService returns the security group service creating the
+// security group of the load balancer of a service, in its Net
+func (c *Cloud) loadBalancerSecurityGroupService(annotations map[string]string) SecurityGroupService {
+	if !c.isPeeredLoadBalancer(annotations) {
+		return c.securityGroupService
+	}
+	return newSecurityGroupService(c.compute, &c.tagging, &cloudNetwork{vpcID: c.loadBalancerNetID(annotations)},
+		c.cfg.Global.ElbSecurityGroup, c.cfg.Global.SecurityGroupRuleLimit, nil)
+}
+
+// peeredBackendRules returns the rules opening the instance ports of the listeners and the
+// health check port of the load balancer to the IP ranges, as backendPortRules
+func peeredBackendRules(lb *elb.LoadBalancerDescription, ipRanges []string) IPRulesSet {
+	rules := NewIPRulesSet()
+	for _, ipRange := range ipRanges {
+		for _, listenerDescription := range lb.ListenerDescriptions {
+			listener := listenerDescription.Listener
+			if listener == nil || listener.InstancePort == nil {
+				continue
+			}
+			protocol := "tcp"
+			if isSCTPListener(listener.InstanceProtocol) {
+				protocol = ipProtocolSCTP
+			}
+			rules.Insert(externalIPRule(protocol, int32(aws.Int64Value(listener.InstancePort)), ipRange))
+		}
+		if port := healthCheckTargetPort(lb.HealthCheck); port != 0 {
+			rules.Insert(externalIPRule("tcp", port, ipRange))
+		}
+	}
+	return rules
+}
+
+// loadBalancerSubnetRanges returns the IP ranges of the subnets of the load balancer
+func (c *Cloud) loadBalancerSubnetRanges(lb *elb.LoadBalancerDescription) ([]string, error) {
+	subnetIDs := aws.StringValueSlice(lb.Subnets)
+	if len(subnetIDs) == 0 {
+		return nil, fmt.Errorf("load balancer %s has no subnet", aws.StringValue(lb.LoadBalancerName))
+	}
+	subnets, err := c.compute.DescribeSubnets(&osc.ReadSubnetsRequest{Filters: &osc.FiltersSubnet{SubnetIds: &subnetIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("error describing the subnets of load balancer %s: %q", aws.StringValue(lb.LoadBalancerName), err)
+	}
+	ipRanges := []string{}
+	for _, subnet := range subnets {
+		if subnet.GetIpRange() != "" {
+			ipRanges = append(ipRanges, subnet.GetIpRange())
+		}
+	}
+	return ipRanges, nil
+}
+
+// ensurePeeredBackendIngress opens the node security groups of the instances to the
+// subnets of the load balancer of a service in a peered Net. The rules previously opened
+// for the service are removed when no longer expected, e.g. when the ports changed or the
+// service is deleted (nil instances).
+func (c *Cloud) ensurePeeredBackendIngress(service *v1.Service, lb *elb.LoadBalancerDescription,
+	instances map[InstanceID]*osc.Vm) error {
+	klog.V(5).Infof("ensurePeeredBackendIngress(%v, %v, %v)", service.Name, aws.StringValue(lb.LoadBalancerName), instances)
+
+	if c.cfg.Global.DisableSecurityGroupIngress {
+		return nil
+	}
+	desired := NewIPRulesSet()
+	if instances != nil {
+		ipRanges, err := c.loadBalancerSubnetRanges(lb)
+		if err != nil {
+			return err
+		}
+		desired = peeredBackendRules(lb, ipRanges)
+	}
+
+	taggedSecurityGroups, err := c.securityGroupService.getTaggedSecurityGroups()
+	if err != nil {
+		return fmt.Errorf("error querying for tagged security groups: %q", err)
+	}
+	instanceSecurityGroupIDs := make(map[string]bool)
+	for _, instance := range instances {
+		securityGroup, err := findSecurityGroupForInstance(instance, taggedSecurityGroups, c.nodePortNic)
+		if err != nil {
+			return err
+		}
+		if securityGroup != nil && securityGroup.GetSecurityGroupId() != "" {
+			instanceSecurityGroupIDs[securityGroup.GetSecurityGroupId()] = true
+		}
+	}
+
+	serviceName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}.String()
+	for securityGroupID, group := range taggedSecurityGroups {
+		markers := serviceRuleMarkers(group.GetTags(), TagNamePeeredRulesPrefix, TagNamePeeredRulePrefix, serviceName)
+		if len(markers.tags) == 0 && (!instanceSecurityGroupIDs[securityGroupID] || desired.Len() == 0) {
+			continue
+		}
+		expected := NewIPRulesSet()
+		if instanceSecurityGroupIDs[securityGroupID] {
+			expected = desired
+		}
+		if err := c.updateServiceRules(securityGroupID, serviceName, ipRangeSourcedRules(group), expected, &markers,
+			"the peered load balancer"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fakeapi "github.com/outscale-dev/cloud-provider-osc/cloud-controller-manager/testutil"
+)
+
+// peeredRuleMarkers returns the hashes of the peered rules marked in the tags of the group
+func peeredRuleMarkers(group osc.SecurityGroup) []string {
+	markers := []string{}
+	for _, tag := range group.GetTags() {
+		if strings.HasPrefix(tag.GetKey(), TagNamePeeredRulesPrefix) {
+			markers = append(markers, strings.Fields(tag.GetValue())...)
+		} else if strings.HasPrefix(tag.GetKey(), TagNamePeeredRulePrefix) {
+			markers = append(markers, strings.TrimPrefix(tag.GetKey(), TagNamePeeredRulePrefix))
+		}
+	}
+	return markers
+}
+
+func TestLoadBalancerNetID(t *testing.T) {
+	c, _, _ := newFakeAPICloud(t)
+	assert.Equal(t, "vpc-1", c.loadBalancerNetID(nil))
+	assert.False(t, c.isPeeredLoadBalancer(nil))
+
+	c.cfg.Global.LoadBalancerNetID = "vpc-edge"
+	assert.Equal(t, "vpc-edge", c.loadBalancerNetID(nil))
+	assert.True(t, c.isPeeredLoadBalancer(nil))
+
+	annotations := map[string]string{ServiceAnnotationLoadBalancerNetID: "vpc-1"}
+	assert.Equal(t, "vpc-1", c.loadBalancerNetID(annotations))
+	assert.False(t, c.isPeeredLoadBalancer(annotations))
+
+	// The Net of an existing load balancer takes precedence
+	assert.False(t, c.isPeeredNet(&elb.LoadBalancerDescription{VPCId: aws.String("vpc-1")}, nil))
+	assert.True(t, c.isPeeredNet(&elb.LoadBalancerDescription{VPCId: aws.String("vpc-edge")}, annotations))
+}
+
+func TestPeeredBackendRules(t *testing.T) {
+	lb := &elb.LoadBalancerDescription{
+		ListenerDescriptions: []*elb.ListenerDescription{
+			{Listener: &elb.Listener{InstancePort: aws.Int64(30080), InstanceProtocol: aws.String("HTTP")}},
+			{Listener: &elb.Listener{InstancePort: aws.Int64(30443), InstanceProtocol: aws.String("TCP")}},
+		},
+		HealthCheck: &elb.HealthCheck{Target: aws.String("HTTP:32000/healthz")},
+	}
+	rules := peeredBackendRules(lb, []string{"10.1.0.0/24", "10.1.1.0/24"})
+	assert.Equal(t, 6, rules.Len())
+	rule := externalIPRule("tcp", 32000, "10.1.1.0/24")
+	assert.Contains(t, rules, keyForIPRules(&rule))
+}
+
+// addEdgeNet adds the public subnet 10.1.0.0/24 of the Net vpc-2, tagged for the cluster
+func addEdgeNet(s *fakeapi.FakeAPIServer) string {
+	clusterTag := osc.ResourceTag{Key: TagNameKubernetesClusterPrefix + TestClusterID, Value: ResourceLifecycleOwned}
+	subnet := s.AddSubnet(osc.Subnet{
+		NetId:         osc.PtrString("vpc-2"),
+		IpRange:       osc.PtrString("10.1.0.0/24"),
+		SubregionName: osc.PtrString("eu-west-2a"),
+		Tags:          &[]osc.ResourceTag{clusterTag, {Key: TagNameSubnetPublicELB, Value: "1"}},
+	})
+	s.AddRouteTable(osc.RouteTable{
+		NetId:           osc.PtrString("vpc-2"),
+		LinkRouteTables: &[]osc.LinkRouteTable{{SubnetId: osc.PtrString(subnet)}},
+		Routes:          &[]osc.Route{{DestinationIpRange: osc.PtrString("0.0.0.0/0"), GatewayId: osc.PtrString("igw-2")}},
+	})
+	return subnet
+}
+
+func TestEnsureLoadBalancerPeeredNet(t *testing.T) {
+	c, s, _ := newFakeAPICloud(t)
+	clusterTag := osc.ResourceTag{Key: TagNameKubernetesClusterPrefix + TestClusterID, Value: ResourceLifecycleOwned}
+	edgeSubnet := addEdgeNet(s)
+	nodeGroup := s.AddSecurityGroup(osc.SecurityGroup{
+		SecurityGroupName: osc.PtrString("k8s-nodes"),
+		NetId:             osc.PtrString("vpc-1"),
+		Tags:              &[]osc.ResourceTag{clusterTag, {Key: TagNameMainSG + TestClusterID, Value: "True"}},
+	})
+	vm := s.AddVm(osc.Vm{
+		NetId:          osc.PtrString("vpc-1"),
+		PrivateIp:      osc.PtrString("10.0.0.11"),
+		Placement:      &osc.Placement{SubregionName: osc.PtrString("eu-west-2a")},
+		SecurityGroups: &[]osc.SecurityGroupLight{{SecurityGroupId: osc.PtrString(nodeGroup)}},
+		Tags:           &[]osc.ResourceTag{clusterTag},
+	})
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+		Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/" + vm},
+	}
+	service := newFakeAPIService("web")
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerNetID: "vpc-2"}
+	name := c.GetLoadBalancerName(context.TODO(), TestClusterName, service)
+
+	_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	lb, found := s.LoadBalancer(name)
+	require.True(t, found)
+	assert.Equal(t, []string{edgeSubnet}, aws.StringValueSlice(lb.Subnets))
+	require.Len(t, lb.SecurityGroups, 1)
+	lbGroup, found := s.SecurityGroup(aws.StringValue(lb.SecurityGroups[0]))
+	require.True(t, found)
+	assert.Equal(t, "vpc-2", lbGroup.GetNetId())
+
+	// The node security group is opened to the subnet of the load balancer, not to its
+	// security group
+	group, _ := s.SecurityGroup(nodeGroup)
+	rules := ipRangeSourcedRules(group)
+	rule := externalIPRule("tcp", 30080, "10.1.0.0/24")
+	assert.Contains(t, rules, keyForIPRules(&rule))
+	assert.Len(t, peeredRuleMarkers(group), rules.Len())
+	assert.Contains(t, group.GetTags(), osc.ResourceTag{Key: TagNamePeeredRulesPrefix + "default/web/0", Value: strings.Join(peeredRuleMarkers(group), " ")})
+	assert.Empty(t, loadBalancerSourcedRules(group, lbGroup.GetSecurityGroupId()))
+
+	require.NoError(t, c.EnsureLoadBalancerDeleted(context.TODO(), TestClusterName, service))
+	group, _ = s.SecurityGroup(nodeGroup)
+	assert.Empty(t, ipRangeSourcedRules(group))
+	assert.Empty(t, peeredRuleMarkers(group))
+}
+
+func TestEnsureLoadBalancerPeeredNetErrors(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	service := newFakeAPIService("web")
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerNetID: "vpc-2"}
+	_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	assert.ErrorContains(t, err, "could not find any suitable subnet tagged for the cluster in Net vpc-2")
+
+	addEdgeNet(s)
+	service.Annotations[ServiceAnnotationLoadBalancerSecurityGroupMode] = string(securityGroupModeShared)
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	assert.ErrorContains(t, err, "is not supported for the load balancers in Net vpc-2")
+	assert.Empty(t, s.LoadBalancerNames())
+}
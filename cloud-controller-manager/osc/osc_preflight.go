@@ -0,0 +1,366 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+)
+
+// ********************* CCM Preflight *********************
+
+// preflightStatus is the outcome of a preflight check
+type preflightStatus string
+
+const (
+	preflightPass preflightStatus = "PASS"
+	preflightWarn preflightStatus = "WARN"
+	preflightFail preflightStatus = "FAIL"
+)
+
+// preflightResult is the result of a preflight check
+type preflightResult struct {
+	check   string
+	status  preflightStatus
+	message string
+}
+
+// preflightPermission is a call representative of the permissions required by the cloud
+// provider, the calls creating resources are dry run. The calls of a permission with
+// target are dry run on an existing security group of the Net, the API validating the
+// resources before the permissions.
+type preflightPermission struct {
+	name   string
+	target bool
+	call   func(c *Cloud, securityGroupID string) error
+}
+
+// preflightPermissions are the calls checking the permissions of the credentials
+var preflightPermissions = []preflightPermission{
+	{"ReadVms", false, func(c *Cloud, _ string) error {
+		_, err := c.compute.ReadVms(&osc.ReadVmsRequest{Filters: &osc.FiltersVm{TagKeys: c.tagging.clusterTagKeysFilter()}})
+		return err
+	}},
+	{"ReadSubnets", false, func(c *Cloud, _ string) error {
+		_, err := c.compute.DescribeSubnets(&osc.ReadSubnetsRequest{})
+		return err
+	}},
+	{"ReadSecurityGroups", false, func(c *Cloud, _ string) error {
+		_, err := c.compute.ReadSecurityGroups(&osc.ReadSecurityGroupsRequest{})
+		return err
+	}},
+	{"ReadPublicIps", false, func(c *Cloud, _ string) error {
+		_, err := c.compute.ReadPublicIps(&osc.ReadPublicIpsRequest{})
+		return err
+	}},
+	{"CreateSecurityGroup", false, func(c *Cloud, _ string) error {
+		_, err := c.compute.CreateSecurityGroup(&osc.CreateSecurityGroupRequest{
+			DryRun:            aws.Bool(true),
+			SecurityGroupName: "preflight",
+			Description:       "preflight",
+			NetId:             &c.vpcID,
+		})
+		return err
+	}},
+	{"CreateSecurityGroupRule", true, func(c *Cloud, securityGroupID string) error {
+		_, err := c.compute.CreateSecurityGroupRule(&osc.CreateSecurityGroupRuleRequest{
+			DryRun:          aws.Bool(true),
+			Flow:            "Inbound",
+			SecurityGroupId: securityGroupID,
+		})
+		return err
+	}},
+	{"CreateTags", true, func(c *Cloud, securityGroupID string) error {
+		_, err := c.compute.CreateTags(&osc.CreateTagsRequest{
+			DryRun:      aws.Bool(true),
+			ResourceIds: []string{securityGroupID},
+			Tags:        []osc.ResourceTag{{Key: "preflight", Value: "preflight"}},
+		})
+		return err
+	}},
+	{"CreatePublicIp", false, func(c *Cloud, _ string) error {
+		_, err := c.compute.CreatePublicIp(&osc.CreatePublicIpRequest{DryRun: aws.Bool(true)})
+		return err
+	}},
+	{"DescribeLoadBalancers", false, func(c *Cloud, _ string) error {
+		_, err := c.loadBalancer.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{PageSize: aws.Int64(1)})
+		return err
+	}},
+}
+
+// newPreflightCloud returns the minimal cloud of the preflight checks, built from the cloud
+// config alone. Unlike newCloud, neither the metadata service nor the cluster tags of the VM
+// of the cloud provider are required: the checks of the metadata service and of the cluster
+// ID are returned with it. The cloud is nil when the region is unknown.
+func newPreflightCloud(cfg CloudConfig, awsServices Services) (*Cloud, []preflightResult) {
+	c := &Cloud{cfg: &cfg}
+	c.vpcID = cfg.Global.VPC
+	var results []preflightResult
+	metadata, err := awsServices.Metadata()
+	if err != nil {
+		// The metadata service is only required for the zone which is not configured
+		status := preflightFail
+		if cfg.Global.Zone != "" {
+			status = preflightWarn
+		}
+		results = append(results, preflightResult{"metadata", status, fmt.Sprintf("the metadata service is unreachable: %v", err)})
+	} else {
+		c.metadata = metadata
+		results = append(results, c.preflightMetadata())
+	}
+
+	if err := updateConfigZone(&cfg, c.metadata); err != nil {
+		return nil, append(results, preflightResult{"configuration", preflightFail, fmt.Sprintf("unable to determine the zone: %v", err)})
+	}
+	region, err := azToRegion(cfg.Global.Zone)
+	if err != nil {
+		return nil, append(results, preflightResult{"configuration", preflightFail, err.Error()})
+	}
+	c.region = region
+	if c.compute, err = awsServices.Compute(region); err != nil {
+		return nil, append(results, preflightResult{"configuration", preflightFail, fmt.Sprintf("error creating OSC EC2 client: %v", err)})
+	}
+	if c.loadBalancer, err = awsServices.LoadBalancing(region); err != nil {
+		return nil, append(results, preflightResult{"configuration", preflightFail, fmt.Sprintf("error creating OSC ELB client: %v", err)})
+	}
+	if c.tagging.prefix, c.tagging.legacyPrefixes, err = parseClusterTagPrefixes(cfg.Global.KubernetesClusterTagPrefix,
+		cfg.Global.LegacyKubernetesClusterTagPrefixes); err != nil {
+		return nil, append(results, preflightResult{"configuration", preflightFail, fmt.Sprintf("invalid KubernetesClusterTagPrefix: %v", err)})
+	}
+
+	// The VM of the cloud provider gives the Net and the cluster ID which are not configured
+	var self *osc.Vm
+	if c.metadata != nil {
+		if vmID, err := c.metadata.GetMetadata("instance-id"); err == nil {
+			vms, err := c.compute.ReadVms(&osc.ReadVmsRequest{Filters: &osc.FiltersVm{VmIds: &[]string{vmID}}})
+			if err == nil && len(vms) > 0 {
+				self = &vms[0]
+				c.selfAWSInstance = &VM{compute: c.compute, vmID: vmID, vpcID: self.GetNetId(), subnetID: self.GetSubnetId()}
+				if c.vpcID == "" {
+					c.vpcID = self.GetNetId()
+				}
+			}
+		}
+	}
+	switch {
+	case cfg.Global.KubernetesClusterTag != "" || cfg.Global.KubernetesClusterID != "":
+		err = c.tagging.init(cfg.Global.KubernetesClusterTag, cfg.Global.KubernetesClusterID)
+	case self != nil:
+		err = c.tagging.initFromTags(self.Tags)
+	default:
+		err = fmt.Errorf("the cluster ID is neither configured nor read from the VM of the cloud provider")
+	}
+	if err != nil {
+		results = append(results, preflightResult{"cluster-id", preflightFail, err.Error()})
+	} else {
+		results = append(results, preflightResult{"cluster-id", preflightPass, fmt.Sprintf("cluster %s", c.tagging.ClusterID)})
+	}
+	return c, results
+}
+
+// preflight validates the environment of the cloud provider: the credentials, the cluster
+// tags of the VMs and subnets, and the permissions
+func (c *Cloud) preflight() []preflightResult {
+	var results []preflightResult
+
+	vms, err := c.compute.ReadVms(&osc.ReadVmsRequest{Filters: &osc.FiltersVm{TagKeys: c.tagging.clusterTagKeysFilter()}})
+	switch {
+	case err == nil:
+		results = append(results, preflightResult{"credentials", preflightPass, "the credentials are accepted"})
+	case isAuthError(err):
+		results = append(results, preflightResult{"credentials", preflightFail, fmt.Sprintf("the credentials are rejected: %v", err)})
+	default:
+		results = append(results, preflightResult{"credentials", preflightFail, fmt.Sprintf("the oAPI is unreachable: %v", err)})
+	}
+	if err == nil {
+		results = append(results, c.preflightVMTags(vms), c.preflightSubnetTags())
+	}
+
+	securityGroupID := c.preflightSecurityGroup()
+	for _, permission := range preflightPermissions {
+		results = append(results, c.preflightPermission(permission, securityGroupID))
+	}
+	return results
+}
+
+// preflightSecurityGroup returns a security group of the Net, preferably of the cluster, on
+// which the calls are dry run, or "" when none is found
+func (c *Cloud) preflightSecurityGroup() string {
+	request := &osc.ReadSecurityGroupsRequest{}
+	if c.vpcID != "" {
+		request.Filters = &osc.FiltersSecurityGroup{NetIds: &[]string{c.vpcID}}
+	}
+	securityGroups, err := c.compute.ReadSecurityGroups(request)
+	if err != nil || len(securityGroups) == 0 {
+		return ""
+	}
+	for _, securityGroup := range securityGroups {
+		if c.tagging.ClusterID != "" && c.tagging.hasClusterTag(securityGroup.Tags) {
+			return securityGroup.GetSecurityGroupId()
+		}
+	}
+	return securityGroups[0].GetSecurityGroupId()
+}
+
+// preflightMetadata checks that the metadata service answers, when running on a VM
+func (c *Cloud) preflightMetadata() preflightResult {
+	if c.metadata == nil {
+		return preflightResult{"metadata", preflightWarn, "not checked, the metadata service is disabled"}
+	}
+	vmID, err := c.metadata.GetMetadata("instance-id")
+	if err != nil {
+		return preflightResult{"metadata", preflightFail, fmt.Sprintf("the metadata service is unreachable: %v", err)}
+	}
+	return preflightResult{"metadata", preflightPass, fmt.Sprintf("running on VM %s", vmID)}
+}
+
+// preflightVMTags checks that the VMs of the cluster, including the VM of the cloud provider,
+// carry the cluster tag
+func (c *Cloud) preflightVMTags(vms []osc.Vm) preflightResult {
+	tagged := 0
+	self := c.selfAWSInstance == nil
+	for _, vm := range vms {
+		if !c.tagging.hasClusterTag(vm.Tags) {
+			continue
+		}
+		tagged++
+		self = self || vm.GetVmId() == c.selfAWSInstance.vmID
+	}
+	switch {
+	case tagged == 0:
+		return preflightResult{"vm-tags", preflightFail, fmt.Sprintf("no VM is tagged with %s", c.tagging.clusterTagKey())}
+	case !self:
+		return preflightResult{"vm-tags", preflightFail, fmt.Sprintf("the VM %s is not tagged with %s", c.selfAWSInstance.vmID, c.tagging.clusterTagKey())}
+	}
+	return preflightResult{"vm-tags", preflightPass, fmt.Sprintf("%d VMs are tagged with %s", tagged, c.tagging.clusterTagKey())}
+}
+
+// preflightSubnetTags checks that subnets of the Net carry the cluster tag, for the load
+// balancers
+func (c *Cloud) preflightSubnetTags() preflightResult {
+	if c.vpcID == "" {
+		return preflightResult{"subnet-tags", preflightWarn, "not checked, the Net of the cluster is unknown"}
+	}
+	subnets, err := c.compute.DescribeSubnets(&osc.ReadSubnetsRequest{Filters: &osc.FiltersSubnet{NetIds: &[]string{c.vpcID}}})
+	if err != nil {
+		return preflightResult{"subnet-tags", preflightFail, fmt.Sprintf("error describing subnets: %v", err)}
+	}
+	tagged := 0
+	for _, subnet := range subnets {
+		if c.tagging.hasClusterTag(subnet.Tags) {
+			tagged++
+		}
+	}
+	if tagged == 0 {
+		return preflightResult{"subnet-tags", preflightFail, fmt.Sprintf("no subnet of Net %s is tagged with %s", c.vpcID, c.tagging.clusterTagKey())}
+	}
+	return preflightResult{"subnet-tags", preflightPass, fmt.Sprintf("%d subnets of Net %s are tagged with %s", tagged, c.vpcID, c.tagging.clusterTagKey())}
+}
+
+// preflightPermission checks the permission of the credentials for a call
+func (c *Cloud) preflightPermission(permission preflightPermission, securityGroupID string) preflightResult {
+	check := "permission " + permission.name
+	if permission.target && securityGroupID == "" {
+		return preflightResult{check, preflightWarn, "not checked, no security group found in the Net"}
+	}
+	err := permission.call(c, securityGroupID)
+	switch {
+	case err == nil:
+		return preflightResult{check, preflightPass, "allowed"}
+	case isPermissionDenied(err):
+		return preflightResult{check, preflightFail, fmt.Sprintf("denied: %v", err)}
+	}
+	return preflightResult{check, preflightWarn, fmt.Sprintf("unable to check: %v", err)}
+}
+
+// isPermissionDenied checks whether an oAPI or LBU call was denied to the credentials
+func isPermissionDenied(err error) bool {
+	if requestErr, ok := err.(awserr.RequestFailure); ok {
+		return requestErr.StatusCode() == http.StatusUnauthorized || requestErr.StatusCode() == http.StatusForbidden
+	}
+	return isAuthError(err)
+}
+
+// writePreflightReport writes the results and returns the number of failed checks
+func writePreflightReport(out io.Writer, results []preflightResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.status == preflightFail {
+			failed++
+		}
+		fmt.Fprintf(out, "[%s] %-32s %s\n", result.status, result.check, result.message)
+	}
+	if failed > 0 {
+		fmt.Fprintf(out, "\n%d of %d checks failed\n", failed, len(results))
+	} else {
+		fmt.Fprintf(out, "\nAll the %d checks passed\n", len(results))
+	}
+	return failed
+}
+
+// Preflight validates the environment of the cloud provider configured by the cloud config
+// file, and writes a report of the checks to out. It fails when one of them fails.
+func Preflight(cloudConfigFile string, out io.Writer) error {
+	results := preflightFromConfig(cloudConfigFile)
+	if failed := writePreflightReport(out, results); failed > 0 {
+		return fmt.Errorf("%d preflight checks failed", failed)
+	}
+	return nil
+}
+
+// preflightFromConfig runs the preflight checks of the cloud config file, the checks
+// stopping at the first error of the configuration or the credentials
+func preflightFromConfig(cloudConfigFile string) []preflightResult {
+	var config io.Reader
+	if cloudConfigFile != "" {
+		file, err := os.Open(cloudConfigFile)
+		if err != nil {
+			return []preflightResult{{"configuration", preflightFail, fmt.Sprintf("unable to open the cloud config file: %v", err)}}
+		}
+		defer file.Close()
+		config = file
+	}
+	cfg, err := readCloudConfig(config)
+	if err == nil {
+		err = cfg.validateOverrides()
+	}
+	if err == nil {
+		apiClients, err = newAPIClientSettings(cfg)
+	}
+	if err != nil {
+		return []preflightResult{{"configuration", preflightFail, err.Error()}}
+	}
+	creds, err := newCloudCredentials(cfg)
+	if err != nil {
+		return []preflightResult{{"credentials", preflightFail, fmt.Sprintf("unable to initialize the credentials: %v", err)}}
+	}
+	provider := newAWSSDKProvider(creds.Credentials, creds.refreshed, cfg)
+	provider.credentialsFile = creds.file
+
+	c, results := newPreflightCloud(*cfg, provider)
+	if c == nil {
+		return results
+	}
+	return append(results, c.preflight()...)
+}
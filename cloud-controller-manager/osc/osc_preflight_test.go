@@ -0,0 +1,139 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func preflightStatuses(results []preflightResult) map[string]preflightStatus {
+	statuses := map[string]preflightStatus{}
+	for _, result := range results {
+		statuses[result.check] = result.status
+	}
+	return statuses
+}
+
+func TestPreflight(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	cfg := CloudConfig{}
+	cfg.Global.VPC = "vpc-a"
+	cfg.Global.KubernetesClusterID = TestClusterID
+	c, results := newPreflightCloud(cfg, awsServices)
+	require.NotNil(t, c)
+	statuses := preflightStatuses(results)
+	assert.Equal(t, preflightPass, statuses["metadata"])
+	assert.Equal(t, preflightPass, statuses["cluster-id"])
+	clusterTag := *awsServices.selfInstance.Tags
+	awsServices.selfInstance.Tags = &[]osc.ResourceTag{}
+
+	// Nothing is tagged for the cluster
+	results = c.preflight()
+	statuses = preflightStatuses(results)
+	assert.Equal(t, preflightPass, statuses["credentials"])
+	assert.Equal(t, preflightFail, statuses["vm-tags"])
+	assert.Equal(t, preflightFail, statuses["subnet-tags"])
+	for _, permission := range preflightPermissions {
+		assert.Equal(t, preflightPass, statuses["permission "+permission.name], permission.name)
+	}
+
+	awsServices.selfInstance.Tags = &clusterTag
+	awsServices.compute.(*FakeComputeImpl).Subnets = []osc.Subnet{{SubnetId: aws.String("subnet-a"), Tags: &clusterTag}}
+	results = c.preflight()
+	statuses = preflightStatuses(results)
+	assert.Equal(t, preflightPass, statuses["vm-tags"])
+	assert.Equal(t, preflightPass, statuses["subnet-tags"])
+	out := &bytes.Buffer{}
+	assert.Equal(t, 0, writePreflightReport(out, results))
+	assert.Contains(t, out.String(), "[PASS] vm-tags")
+	assert.Contains(t, out.String(), "All the ")
+
+	// The rejected credentials fail the checks
+	c.compute = &unreachableCompute{Compute: c.compute, err: errors.New(`error listing instances: "401 Unauthorized" (Status:401 Unauthorized)`)}
+	results = c.preflight()
+	statuses = preflightStatuses(results)
+	assert.Equal(t, preflightFail, statuses["credentials"])
+	assert.Equal(t, preflightFail, statuses["permission ReadVms"])
+	assert.NotContains(t, statuses, "vm-tags")
+	out.Reset()
+	assert.Equal(t, 2, writePreflightReport(out, results))
+	assert.Contains(t, out.String(), "2 of ")
+}
+
+type unreachableMetadataServices struct {
+	*FakeOscServices
+}
+
+func (s *unreachableMetadataServices) Metadata() (EC2Metadata, error) {
+	return nil, errors.New("dial tcp 169.254.169.254:80: i/o timeout")
+}
+
+func TestNewPreflightCloud(t *testing.T) {
+	// The cluster ID is read from the tags of the VM of the cloud provider
+	c, results := newPreflightCloud(CloudConfig{}, NewFakeAWSServices(TestClusterID))
+	require.NotNil(t, c)
+	assert.Equal(t, preflightPass, preflightStatuses(results)["cluster-id"])
+	assert.Equal(t, TestClusterID, c.tagging.ClusterID)
+	assert.Equal(t, "i-self", c.selfAWSInstance.vmID)
+
+	// The metadata service is not required when the zone and the cluster ID are configured
+	services := &unreachableMetadataServices{NewFakeAWSServices(TestClusterID)}
+	cfg := CloudConfig{}
+	cfg.Global.Zone = "eu-west-2a"
+	cfg.Global.KubernetesClusterID = TestClusterID
+	c, results = newPreflightCloud(cfg, services)
+	require.NotNil(t, c)
+	statuses := preflightStatuses(results)
+	assert.Equal(t, preflightWarn, statuses["metadata"])
+	assert.Equal(t, preflightPass, statuses["cluster-id"])
+	assert.Equal(t, "eu-west-2", c.region)
+
+	cfg.Global.KubernetesClusterID = ""
+	c, results = newPreflightCloud(cfg, services)
+	require.NotNil(t, c)
+	assert.Equal(t, preflightFail, preflightStatuses(results)["cluster-id"])
+
+	// Otherwise the region is unknown
+	c, results = newPreflightCloud(CloudConfig{}, services)
+	assert.Nil(t, c)
+	statuses = preflightStatuses(results)
+	assert.Equal(t, preflightFail, statuses["metadata"])
+	assert.Equal(t, preflightFail, statuses["configuration"])
+}
+
+func TestPreflightPermissionTarget(t *testing.T) {
+	c, _ := newPreflightCloud(CloudConfig{}, NewFakeAWSServices(TestClusterID))
+	require.NotNil(t, c)
+	var createTags preflightPermission
+	for _, permission := range preflightPermissions {
+		if permission.name == "CreateTags" {
+			createTags = permission
+		}
+	}
+	// The calls are dry run on an existing security group of the cluster
+	assert.Equal(t, "sg-1234", c.preflightSecurityGroup())
+	assert.Equal(t, preflightPass, c.preflightPermission(createTags, "sg-1234").status)
+	assert.Equal(t, preflightWarn, c.preflightPermission(createTags, "sg-unknown").status)
+	assert.Equal(t, preflightWarn, c.preflightPermission(createTags, "").status)
+}
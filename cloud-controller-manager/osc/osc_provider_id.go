@@ -0,0 +1,257 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Provider IDs *********************
+
+const (
+	// ProviderIDSchemeOsc is the scheme of the provider IDs osc://<subregion>/<vm id>
+	ProviderIDSchemeOsc = "osc"
+	// ProviderIDSchemeAWS is the legacy scheme of the provider IDs aws:///<subregion>/<vm id>,
+	// still understood by the tools expecting the providerIDs of the AWS cloud provider
+	ProviderIDSchemeAWS = "aws"
+)
+
+// EventProviderIDMigrated is the reason of the event recorded on a node whose provider ID
+// was migrated to the osc:// scheme
+const EventProviderIDMigrated = "ProviderIDMigrated"
+
+// parseProviderIDScheme parses the ProviderIDScheme of the cloud config, aws by default
+func parseProviderIDScheme(value string) (string, error) {
+	switch value {
+	case "", ProviderIDSchemeAWS:
+		return ProviderIDSchemeAWS, nil
+	case ProviderIDSchemeOsc:
+		return ProviderIDSchemeOsc, nil
+	}
+	return "", fmt.Errorf("unknown provider ID scheme %q, expected %s or %s", value, ProviderIDSchemeAWS, ProviderIDSchemeOsc)
+}
+
+// buildProviderID returns the provider ID of the VM in the subregion with the given scheme
+func buildProviderID(scheme string, zone string, vmID string) string {
+	if scheme == ProviderIDSchemeOsc {
+		return "osc://" + zone + "/" + vmID
+	}
+	return "aws:///" + zone + "/" + vmID
+}
+
+// isProviderID returns whether the value has one of the schemes of the provider IDs
+func isProviderID(value string) bool {
+	return strings.HasPrefix(value, ProviderIDSchemeAWS+"://") || strings.HasPrefix(value, ProviderIDSchemeOsc+"://")
+}
+
+// providerIDZone returns the subregion of the provider ID, or "" when it has none, e.g. aws:////i-1234
+func providerIDZone(providerID string) string {
+	parsed, err := url.Parse(providerID)
+	if err != nil {
+		return ""
+	}
+	if parsed.Host != "" {
+		return parsed.Host
+	}
+	tokens := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(tokens) == 2 {
+		return tokens[0]
+	}
+	return ""
+}
+
+// providerIDMigrator recreates the nodes having a provider ID with the legacy aws:// scheme
+// with the osc:// scheme. The provider ID of a node can't be changed once set, so the node
+// has to be recreated, which is only done for the nodes cordoned and drained by the
+// operator: only the DaemonSet and mirror pods may be left on them, and they are kept as
+// the node is recreated at once. The node stays cordoned.
+type providerIDMigrator struct {
+	cloud    *Cloud
+	interval time.Duration
+}
+
+func newProviderIDMigrator(cloud *Cloud, interval time.Duration) *providerIDMigrator {
+	return &providerIDMigrator{
+		cloud:    cloud,
+		interval: interval,
+	}
+}
+
+// run migrates the drained nodes every interval until stop is closed
+func (m *providerIDMigrator) run(stop <-chan struct{}) {
+	if m == nil || m.interval <= 0 {
+		return
+	}
+	if !featureEnabled(ProviderIDMigration) {
+		klog.Warningf("Provider ID migration requires the %s feature gate, not starting it", ProviderIDMigration)
+		return
+	}
+	if m.cloud.providerIDScheme != ProviderIDSchemeOsc {
+		klog.Warningf("Provider ID migration requires the %s ProviderIDScheme, not starting it", ProviderIDSchemeOsc)
+		return
+	}
+
+	klog.Infof("Starting provider ID migration (interval %v)", m.interval)
+	go wait.Until(m.sync, m.interval, stop)
+}
+
+// sync migrates the provider ID of the drained nodes
+func (m *providerIDMigrator) sync() {
+	c := m.cloud
+	if c.kubeClient == nil || c.nodeInformerHasSynced == nil || !c.nodeInformerHasSynced() {
+		klog.V(4).Infof("Node informer not ready, skipping provider ID migration")
+		return
+	}
+
+	nodes, err := c.nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		klog.Warningf("Unable to list nodes for provider ID migration: %q", err)
+		return
+	}
+
+	legacy := 0
+	for _, node := range nodes {
+		if !strings.HasPrefix(node.Spec.ProviderID, ProviderIDSchemeAWS+"://") {
+			continue
+		}
+		legacy++
+		if !node.Spec.Unschedulable {
+			klog.V(4).Infof("Node %s has the legacy provider ID %s, cordon and drain it to migrate it", node.Name, node.Spec.ProviderID)
+			continue
+		}
+		if err := m.migrate(node); err != nil {
+			klog.Warningf("Unable to migrate the provider ID of node %s: %v", node.Name, err)
+			continue
+		}
+		legacy--
+	}
+	if legacy > 0 {
+		klog.V(2).Infof("%d nodes still have a provider ID with the legacy %s scheme", legacy, ProviderIDSchemeAWS)
+	}
+}
+
+// providerIDMigrationBackoff is the backoff of the creation of a migrated node
+var providerIDMigrationBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Steps: 5}
+
+// recreate creates the node deleted by the migration, retrying on transient errors
+func (m *providerIDMigrator) recreate(node *v1.Node) (*v1.Node, error) {
+	var created *v1.Node
+	var lastErr error
+	err := wait.ExponentialBackoff(providerIDMigrationBackoff, func() (bool, error) {
+		created, lastErr = m.cloud.kubeClient.CoreV1().Nodes().Create(context.TODO(), node, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(lastErr) {
+			return false, lastErr
+		}
+		return lastErr == nil, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		err = lastErr
+	}
+	return created, err
+}
+
+// restoreStatus restores the status of the deleted node on the node created again
+func (m *providerIDMigrator) restoreStatus(created *v1.Node, node *v1.Node) {
+	created.Status = node.Status
+	if _, err := m.cloud.kubeClient.CoreV1().Nodes().UpdateStatus(context.TODO(), created, metav1.UpdateOptions{}); err != nil {
+		klog.Warningf("Unable to restore the status of node %s, left to the kubelet: %v", node.Name, err)
+	}
+}
+
+// migrate recreates the drained node with the osc:// scheme. When the node can't be created
+// again, it is restored with its legacy provider ID.
+func (m *providerIDMigrator) migrate(node *v1.Node) error {
+	ctx := context.TODO()
+	client := m.cloud.kubeClient.CoreV1()
+	instanceID, err := KubernetesInstanceID(node.Spec.ProviderID).MapToAWSInstanceID()
+	if err != nil {
+		return err
+	}
+	zone := providerIDZone(node.Spec.ProviderID)
+	if zone == "" {
+		zone = node.Labels[v1.LabelTopologyZone]
+	}
+	if zone == "" {
+		return fmt.Errorf("no subregion in provider ID %s", node.Spec.ProviderID)
+	}
+
+	pods, err := client.Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+	})
+	if err != nil {
+		return err
+	}
+	for i := range pods.Items {
+		if evictablePod(&pods.Items[i]) {
+			klog.V(4).Infof("Node %s is not drained, not migrating its provider ID", node.Name)
+			return nil
+		}
+	}
+
+	migrated := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            node.Name,
+			Labels:          node.Labels,
+			Annotations:     node.Annotations,
+			OwnerReferences: node.OwnerReferences,
+		},
+		Spec: *node.Spec.DeepCopy(),
+	}
+	migrated.Spec.ProviderID = buildProviderID(ProviderIDSchemeOsc, zone, string(instanceID))
+
+	uid := node.UID
+	err = client.Nodes().Delete(ctx, node.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+	if err != nil {
+		return err
+	}
+	created, err := m.recreate(migrated)
+	if apierrors.IsAlreadyExists(err) {
+		klog.Infof("Node %s was registered again by its kubelet while being migrated", node.Name)
+		return nil
+	}
+	if err != nil {
+		// Rather than leaving the node deleted, it is restored with its legacy provider ID
+		restored := migrated.DeepCopy()
+		restored.Spec.ProviderID = node.Spec.ProviderID
+		if created, restoreErr := m.recreate(restored); restoreErr == nil {
+			m.restoreStatus(created, node)
+			return fmt.Errorf("unable to recreate node with provider ID %s, restored it: %v", migrated.Spec.ProviderID, err)
+		}
+		return fmt.Errorf("unable to recreate the deleted node, its kubelet must register it again: %v", err)
+	}
+	m.restoreStatus(created, node)
+
+	klog.Infof("Migrated the provider ID of node %s from %s to %s", node.Name, node.Spec.ProviderID, migrated.Spec.ProviderID)
+	m.cloud.instanceMetadata.forget(node.Spec.ProviderID)
+	if m.cloud.eventRecorder != nil {
+		m.cloud.eventRecorder.Eventf(created, v1.EventTypeNormal, EventProviderIDMigrated,
+			"Migrated the provider ID from %s to %s", node.Spec.ProviderID, migrated.Spec.ProviderID)
+	}
+	return nil
+}
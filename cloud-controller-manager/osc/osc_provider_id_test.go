@@ -0,0 +1,239 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+func TestProviderIDScheme(t *testing.T) {
+	scheme, err := parseProviderIDScheme("")
+	assert.NoError(t, err)
+	assert.Equal(t, ProviderIDSchemeAWS, scheme)
+	_, err = parseProviderIDScheme("gce")
+	assert.Error(t, err)
+
+	vm := &osc.Vm{VmId: aws.String("i-aaaaaaaa"), Placement: &osc.Placement{SubregionName: aws.String("eu-west-2a")}}
+	providerID, err := getInstanceProviderIDV2(vm, ProviderIDSchemeAWS)
+	assert.NoError(t, err)
+	assert.Equal(t, "aws:///eu-west-2a/i-aaaaaaaa", providerID)
+	providerID, err = getInstanceProviderIDV2(vm, ProviderIDSchemeOsc)
+	assert.NoError(t, err)
+	assert.Equal(t, "osc://eu-west-2a/i-aaaaaaaa", providerID)
+
+	// Both schemes are parsed
+	for _, providerID := range []string{"osc://eu-west-2a/i-aaaaaaaa", "osc:///eu-west-2a/i-aaaaaaaa", "aws:///eu-west-2a/i-aaaaaaaa"} {
+		instanceID, err := KubernetesInstanceID(providerID).MapToAWSInstanceID()
+		assert.NoError(t, err, providerID)
+		assert.Equal(t, InstanceID("i-aaaaaaaa"), instanceID, providerID)
+		parsed, err := parseInstanceIDFromProviderIDV2(providerID)
+		assert.NoError(t, err, providerID)
+		assert.Equal(t, "i-aaaaaaaa", parsed, providerID)
+		assert.Equal(t, "eu-west-2a", providerIDZone(providerID), providerID)
+	}
+	_, err = KubernetesInstanceID("osc://eu-west-2a/extra/i-aaaaaaaa").MapToAWSInstanceID()
+	assert.Error(t, err)
+	assert.Equal(t, "", providerIDZone("aws:////i-aaaaaaaa"))
+}
+
+func TestProviderIDMigration(t *testing.T) {
+	cfg := CloudConfig{}
+	cfg.Global.ProviderIDScheme = ProviderIDSchemeOsc
+	c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	require.NoError(t, err)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "node-a",
+			Labels:          map[string]string{"role": "worker"},
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "cluster.x-k8s.io/v1beta1", Kind: "Machine", Name: "machine-a"}},
+		},
+		Spec:   v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-aaaaaaaa"},
+		Status: v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}}},
+	}
+	appPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: "node-a"},
+	}
+	client := fake.NewSimpleClientset(node, appPod)
+	c.kubeClient = client
+	c.nodeInformer = informers.NewSharedInformerFactory(client, 0).Core().V1().Nodes()
+	c.nodeInformerHasSynced = func() bool { return true }
+	require.NoError(t, c.nodeInformer.Informer().GetStore().Add(node))
+
+	migrator := newProviderIDMigrator(c, time.Minute)
+	getProviderID := func() string {
+		current, err := client.CoreV1().Nodes().Get(context.TODO(), "node-a", metav1.GetOptions{})
+		require.NoError(t, err)
+		return current.Spec.ProviderID
+	}
+
+	// The nodes which are not cordoned, or not drained, are left untouched
+	migrator.sync()
+	assert.Equal(t, "aws:///eu-west-2a/i-aaaaaaaa", getProviderID())
+	node.Spec.Unschedulable = true
+	migrator.sync()
+	assert.Equal(t, "aws:///eu-west-2a/i-aaaaaaaa", getProviderID())
+
+	require.NoError(t, client.CoreV1().Pods("default").Delete(context.TODO(), "app", metav1.DeleteOptions{}))
+	migrator.sync()
+	assert.Equal(t, "osc://eu-west-2a/i-aaaaaaaa", getProviderID())
+	current, err := client.CoreV1().Nodes().Get(context.TODO(), "node-a", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.True(t, current.Spec.Unschedulable)
+	assert.Equal(t, "worker", current.Labels["role"])
+	assert.Equal(t, node.Status.Addresses, current.Status.Addresses)
+	assert.Equal(t, node.OwnerReferences, current.OwnerReferences)
+}
+
+func TestProviderIDMigrationRestore(t *testing.T) {
+	defer func(backoff wait.Backoff) { providerIDMigrationBackoff = backoff }(providerIDMigrationBackoff)
+	providerIDMigrationBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 2}
+	cfg := CloudConfig{}
+	cfg.Global.ProviderIDScheme = ProviderIDSchemeOsc
+	c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	require.NoError(t, err)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-aaaaaaaa", Unschedulable: true},
+	}
+	client := fake.NewSimpleClientset(node)
+	c.kubeClient = client
+	// The nodes with the new provider ID are refused
+	client.PrependReactor("create", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		created := action.(k8stesting.CreateAction).GetObject().(*v1.Node)
+		if created.Spec.ProviderID == "osc://eu-west-2a/i-aaaaaaaa" {
+			return true, nil, fmt.Errorf("webhook unavailable")
+		}
+		return false, nil, nil
+	})
+
+	err = newProviderIDMigrator(c, time.Minute).migrate(node)
+	assert.ErrorContains(t, err, "restored it")
+	current, err := client.CoreV1().Nodes().Get(context.TODO(), "node-a", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "aws:///eu-west-2a/i-aaaaaaaa", current.Spec.ProviderID)
+	assert.True(t, current.Spec.Unschedulable)
+}
+
+// chartClusterRole renders the ClusterRole of the Helm chart with the given values
+func chartClusterRole(t *testing.T, values map[string]interface{}) *rbacv1.ClusterRole {
+	chart, err := os.ReadFile("../../deploy/k8s-osc-ccm/templates/osc-ccm.yaml")
+	require.NoError(t, err)
+	for _, document := range strings.Split(string(chart), "\n---\n") {
+		if !strings.Contains(document, "\nkind: ClusterRole\n") {
+			continue
+		}
+		tmpl, err := template.New("ClusterRole").Parse(document)
+		require.NoError(t, err)
+		var rendered bytes.Buffer
+		require.NoError(t, tmpl.Execute(&rendered, map[string]interface{}{"Values": values}))
+		role := &rbacv1.ClusterRole{}
+		require.NoError(t, yaml.Unmarshal(rendered.Bytes(), role))
+		return role
+	}
+	require.FailNow(t, "no ClusterRole in the chart")
+	return nil
+}
+
+// allowedBy returns whether one of the rules grants the action
+func allowedBy(rules []rbacv1.PolicyRule, action k8stesting.Action) bool {
+	resource := action.GetResource().Resource
+	if action.GetSubresource() != "" {
+		resource += "/" + action.GetSubresource()
+	}
+	contains := func(values []string, value string) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rule := range rules {
+		if contains(rule.APIGroups, action.GetResource().Group) && contains(rule.Resources, resource) &&
+			contains(rule.Verbs, action.GetVerb()) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProviderIDMigrationRBAC(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("providerIDMigration=%v", enabled), func(t *testing.T) {
+			cfg := CloudConfig{}
+			cfg.Global.ProviderIDScheme = ProviderIDSchemeOsc
+			c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+			require.NoError(t, err)
+
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+				Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-aaaaaaaa", Unschedulable: true},
+				Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}}},
+			}
+			client := fake.NewSimpleClientset(node)
+			c.kubeClient = client
+			// The calls not granted by the ClusterRole of the chart are forbidden
+			role := chartClusterRole(t, map[string]interface{}{"providerIDMigration": enabled})
+			forbidden := []string{}
+			client.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if allowedBy(role.Rules, action) {
+					return false, nil, nil
+				}
+				forbidden = append(forbidden, action.GetVerb()+" "+action.GetResource().Resource)
+				return true, nil, apierrors.NewForbidden(action.GetResource().GroupResource(), "", fmt.Errorf("RBAC"))
+			})
+
+			err = newProviderIDMigrator(c, time.Minute).migrate(node)
+			if !enabled {
+				assert.True(t, apierrors.IsForbidden(err), "%v", err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, forbidden)
+			current, err := client.CoreV1().Nodes().Get(context.TODO(), "node-a", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "osc://eu-west-2a/i-aaaaaaaa", current.Spec.ProviderID)
+			assert.Equal(t, node.Status.Addresses, current.Status.Addresses)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+)
+
+// ********************* CCM Proxy Protocol *********************
+
+const (
+	// ProxyProtocolV2PolicyName is the name of the backend policy enabling the proxy
+	// protocol v2, ProxyProtocolPolicyName enabling the v1
+	ProxyProtocolV2PolicyName = "k8s-proxyprotocol-v2-enabled"
+
+	proxyProtocolV1 = "1"
+	proxyProtocolV2 = "2"
+)
+
+// getProxyProtocolVersion returns the version of the proxy protocol requested by the
+// ServiceAnnotationLoadBalancerProxyProtocolVersion annotation, "1" by default
+func getProxyProtocolVersion(annotations map[string]string) (string, error) {
+	version, found := annotations[ServiceAnnotationLoadBalancerProxyProtocolVersion]
+	if !found {
+		return proxyProtocolV1, nil
+	}
+	if version != proxyProtocolV1 && version != proxyProtocolV2 {
+		return "", fmt.Errorf("annotation %q=%q detected, but the only values supported are %q and %q",
+			ServiceAnnotationLoadBalancerProxyProtocolVersion, version, proxyProtocolV1, proxyProtocolV2)
+	}
+	return version, nil
+}
+
+// proxyProtocolPolicy returns the name of the backend policy of the proxy protocol requested
+// on the service, empty when the proxy protocol is disabled. The v2 requires
+// LoadBalancerProxyProtocolV2 in the cloud config.
+func (c *Cloud) proxyProtocolPolicy(annotations map[string]string) (string, error) {
+	proxyProtocol, err := getProxyProtocol(annotations)
+	if err != nil {
+		return "", err
+	}
+	version, err := getProxyProtocolVersion(annotations)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case !proxyProtocol:
+		return "", nil
+	case version == proxyProtocolV1:
+		return ProxyProtocolPolicyName, nil
+	case c.cfg.Global.LoadBalancerProxyProtocolV2:
+		return ProxyProtocolV2PolicyName, nil
+	default:
+		return "", fmt.Errorf("unsupported proxy protocol v2: the LBU API of region %s does not accept proxy protocol v2 policies"+
+			" (set LoadBalancerProxyProtocolV2 in the cloud config when it does)", c.region)
+	}
+}
+
+// proxyProtocolPolicyAttributes returns the attributes of the proxy protocol policy
+func proxyProtocolPolicyAttributes(policyName string) []*elb.PolicyAttribute {
+	attributes := []*elb.PolicyAttribute{
+		{
+			AttributeName:  aws.String("ProxyProtocol"),
+			AttributeValue: aws.String("true"),
+		},
+	}
+	if policyName == ProxyProtocolV2PolicyName {
+		attributes = append(attributes, &elb.PolicyAttribute{
+			AttributeName:  aws.String("ProxyProtocolVersion"),
+			AttributeValue: aws.String(proxyProtocolV2),
+		})
+	}
+	return attributes
+}
+
+// backendProxyProtocolPolicy returns the proxy protocol policy set on the backend, empty
+// when it has none
+func backendProxyProtocolPolicy(backend *elb.BackendServerDescription) string {
+	for _, policy := range backend.PolicyNames {
+		switch name := aws.StringValue(policy); name {
+		case ProxyProtocolPolicyName, ProxyProtocolV2PolicyName:
+			return name
+		}
+	}
+	return ""
+}
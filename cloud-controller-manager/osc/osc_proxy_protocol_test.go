@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProxyProtocolPolicy(t *testing.T) {
+	c, err := newCloud(CloudConfig{}, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+
+	policy, err := c.proxyProtocolPolicy(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", policy)
+
+	policy, err = c.proxyProtocolPolicy(map[string]string{ServiceAnnotationLoadBalancerProxyProtocol: "*"})
+	assert.NoError(t, err)
+	assert.Equal(t, ProxyProtocolPolicyName, policy)
+
+	// The version alone doesn't enable the proxy protocol
+	policy, err = c.proxyProtocolPolicy(map[string]string{ServiceAnnotationLoadBalancerProxyProtocolVersion: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "", policy)
+
+	_, err = c.proxyProtocolPolicy(map[string]string{ServiceAnnotationLoadBalancerProxyProtocolVersion: "3"})
+	assert.Error(t, err)
+
+	v2 := map[string]string{
+		ServiceAnnotationLoadBalancerProxyProtocol:        "*",
+		ServiceAnnotationLoadBalancerProxyProtocolVersion: "2",
+	}
+	_, err = c.proxyProtocolPolicy(v2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "LoadBalancerProxyProtocolV2")
+	}
+
+	c.cfg.Global.LoadBalancerProxyProtocolV2 = true
+	policy, err = c.proxyProtocolPolicy(v2)
+	assert.NoError(t, err)
+	assert.Equal(t, ProxyProtocolV2PolicyName, policy)
+}
+
+func TestEnsureLoadBalancerProxyProtocolVersion(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.vpcID = "vpc-123456"
+	fakeELB := awsServices.elb.(*FakeELB)
+
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+	}) {
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "proxied",
+			UID:         "anuid",
+			Annotations: map[string]string{ServiceAnnotationLoadBalancerProxyProtocol: "*"},
+		},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports:           []v1.ServicePort{{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP}},
+		},
+	}
+	backendPolicies := func() []string {
+		lb := fakeELB.LoadBalancers[c.GetLoadBalancerName(context.TODO(), TestClusterName, service)]
+		if !assert.NotNil(t, lb) || !assert.Len(t, lb.BackendServerDescriptions, 1) {
+			return nil
+		}
+		return aws.StringValueSlice(lb.BackendServerDescriptions[0].PolicyNames)
+	}
+
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ProxyProtocolPolicyName}, backendPolicies())
+
+	// The v2 is refused until enabled in the cloud config
+	service.Annotations[ServiceAnnotationLoadBalancerProxyProtocolVersion] = "2"
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.Error(t, err)
+	assert.Equal(t, []string{ProxyProtocolPolicyName}, backendPolicies())
+
+	// The backend policy is switched to the v2 one
+	c.cfg.Global.LoadBalancerProxyProtocolV2 = true
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ProxyProtocolV2PolicyName}, backendPolicies())
+
+	// And back to no proxy protocol
+	delete(service.Annotations, ServiceAnnotationLoadBalancerProxyProtocol)
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.NoError(t, err)
+	assert.Empty(t, backendPolicies())
+}
+
+func TestCreateProxyProtocolV2PolicyRejected(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	awsServices.elb.(*FakeELB).RejectedPolicyAttributes = []string{"ProxyProtocolVersion"}
+
+	assert.NoError(t, c.createProxyProtocolPolicy("lb", ProxyProtocolPolicyName, false))
+	err = c.createProxyProtocolPolicy("lb", ProxyProtocolV2PolicyName, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "LoadBalancerProxyProtocolV2")
+	}
+
+	// The existing policy is kept when updating
+	assert.NoError(t, c.createProxyProtocolPolicy("lb", ProxyProtocolPolicyName, true))
+}
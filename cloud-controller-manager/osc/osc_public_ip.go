@@ -0,0 +1,227 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Public IPs *********************
+
+// The public IP of a load balancer is tagged with its service and the cluster. The cluster
+// tag is "owned" when the public IP was allocated by the cloud provider, which releases it
+// with the load balancer, and "shared" when it was claimed from a pool, to which it returns.
+// The public IPs without the cluster tag are never released.
+
+// publicIPTags returns the tags of the public IP
+func publicIPTags(publicIP *osc.PublicIp) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range publicIP.GetTags() {
+		tags[tag.GetKey()] = tag.GetValue()
+	}
+	return tags
+}
+
+// ensureLoadBalancerPublicIP gives the load balancer a public IP of the pool set by the
+// ServiceAnnotationLoadBalancerIPPool annotation: the public IP already tagged with the
+// service, else a free public IP of the pool, else, when AllocateLoadBalancerPublicIps is
+// set in the cloud config, a new public IP
+func (c *Cloud) ensureLoadBalancerPublicIP(serviceName types.NamespacedName, loadBalancerName string,
+	internalELB bool, annotations map[string]string) error {
+	klog.V(5).Infof("ensureLoadBalancerPublicIP(%v, %v, %v, %v)", serviceName, loadBalancerName, internalELB, annotations)
+	pool, found := annotations[ServiceAnnotationLoadBalancerIPPool]
+	if !found {
+		return nil
+	}
+	if pool == "" {
+		return fmt.Errorf("error parsing service annotation: %s is empty", ServiceAnnotationLoadBalancerIPPool)
+	}
+	if internalELB {
+		return fmt.Errorf("service annotation %s is not supported by internal load balancers", ServiceAnnotationLoadBalancerIPPool)
+	}
+	if c.tagging.ClusterID == "" {
+		return fmt.Errorf("service annotation %s requires a cluster ID", ServiceAnnotationLoadBalancerIPPool)
+	}
+
+	publicIP, err := c.findServicePublicIP(serviceName, pool)
+	if err != nil {
+		return err
+	}
+	if publicIP == nil {
+		publicIP, err = c.claimPoolPublicIP(serviceName, pool)
+		if err != nil {
+			return err
+		}
+	}
+	if publicIP == nil {
+		if !c.cfg.Global.AllocateLoadBalancerPublicIps {
+			return fmt.Errorf("no free public IP in the pool %q of load balancer %s", pool, loadBalancerName)
+		}
+		publicIP, err = c.allocatePublicIP(serviceName, pool)
+		if err != nil {
+			return err
+		}
+	}
+
+	filters := osc.FiltersLoadBalancer{LoadBalancerNames: &[]string{loadBalancerName}}
+	loadBalancers, err := c.compute.ReadLoadBalancers(&osc.ReadLoadBalancersRequest{Filters: &filters})
+	if err != nil {
+		return err
+	}
+	if len(loadBalancers) == 0 {
+		return fmt.Errorf("load balancer %s not found", loadBalancerName)
+	}
+	if loadBalancers[0].GetPublicIp() != publicIP.GetPublicIp() {
+		klog.Infof("Setting the public IP %s of load balancer %s", publicIP.GetPublicIp(), loadBalancerName)
+		_, err := c.compute.UpdateLoadBalancer(&osc.UpdateLoadBalancerRequest{
+			LoadBalancerName: loadBalancerName,
+			PublicIp:         publicIP.PublicIp,
+		})
+		if err != nil {
+			return fmt.Errorf("error setting the public IP %s of load balancer %s: %q", publicIP.GetPublicIp(), loadBalancerName, err)
+		}
+		loadBalancers, err = c.compute.ReadLoadBalancers(&osc.ReadLoadBalancersRequest{Filters: &filters})
+		if err != nil {
+			return err
+		}
+		if len(loadBalancers) == 0 || loadBalancers[0].GetPublicIp() != publicIP.GetPublicIp() {
+			return newLoadBalancerNotReadyError(loadBalancerName, NotReadyWaitingForIPAssociation,
+				"public IP %s not associated yet", publicIP.GetPublicIp())
+		}
+	}
+
+	// The public IP of a previous pool is no longer used
+	return c.releaseLoadBalancerPublicIPs(serviceName, publicIP.GetPublicIpId())
+}
+
+// findServicePublicIP returns the public IP of the pool tagged with the service, if any
+func (c *Cloud) findServicePublicIP(serviceName types.NamespacedName, pool string) (*osc.PublicIp, error) {
+	filters := osc.FiltersPublicIp{
+		TagKeys: c.tagging.clusterTagKeysFilter(),
+		Tags: &[]string{
+			TagNameKubernetesService + "=" + serviceName.String(),
+			TagNameIPPool + "=" + pool,
+		},
+	}
+	publicIPs, err := c.compute.ReadPublicIps(&osc.ReadPublicIpsRequest{Filters: &filters})
+	if err != nil || len(publicIPs) == 0 {
+		return nil, err
+	}
+	return &publicIPs[0], nil
+}
+
+// claimPoolPublicIP tags a free public IP of the pool with the service, and returns it.
+// It returns nil when the pool has no free public IP.
+func (c *Cloud) claimPoolPublicIP(serviceName types.NamespacedName, pool string) (*osc.PublicIp, error) {
+	filters := osc.FiltersPublicIp{Tags: &[]string{TagNameIPPool + "=" + pool}}
+	publicIPs, err := c.compute.ReadPublicIps(&osc.ReadPublicIpsRequest{Filters: &filters})
+	if err != nil {
+		return nil, err
+	}
+	for i := range publicIPs {
+		publicIP := &publicIPs[i]
+		if _, used := publicIPTags(publicIP)[TagNameKubernetesService]; used || publicIP.GetLinkPublicIpId() != "" {
+			continue
+		}
+		klog.Infof("Claiming the public IP %s of pool %q for service %v", publicIP.GetPublicIp(), pool, serviceName)
+		// The public IPs of the pools are not created by the cloud provider: only the tags
+		// removed when the public IP returns to the pool are set
+		err := c.tagging.withoutExtraTags().createTags(c.compute, publicIP.GetPublicIpId(), ResourceLifecycleShared,
+			map[string]string{TagNameKubernetesService: serviceName.String()})
+		if err != nil {
+			return nil, fmt.Errorf("error claiming public IP %s: %q", publicIP.GetPublicIp(), err)
+		}
+		return publicIP, nil
+	}
+	return nil, nil
+}
+
+// allocatePublicIP allocates a public IP of the pool for the service
+func (c *Cloud) allocatePublicIP(serviceName types.NamespacedName, pool string) (*osc.PublicIp, error) {
+	response, err := c.compute.CreatePublicIp(&osc.CreatePublicIpRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error allocating a public IP for service %v: %q", serviceName, err)
+	}
+	publicIP := response.GetPublicIp()
+	klog.Infof("Allocated the public IP %s of pool %q for service %v", publicIP.GetPublicIp(), pool, serviceName)
+
+	err = c.tagging.createTags(c.compute, publicIP.GetPublicIpId(), ResourceLifecycleOwned, map[string]string{
+		TagNameKubernetesService: serviceName.String(),
+		TagNameIPPool:            pool,
+	})
+	if err != nil {
+		// An untagged public IP would never be released
+		if _, deleteErr := c.compute.DeletePublicIp(&osc.DeletePublicIpRequest{PublicIpId: publicIP.PublicIpId}); deleteErr != nil {
+			klog.Errorf("Error releasing untagged public IP %s: %q", publicIP.GetPublicIp(), deleteErr)
+		}
+		return nil, fmt.Errorf("error tagging public IP %s: %q", publicIP.GetPublicIp(), err)
+	}
+	return &publicIP, nil
+}
+
+// releaseLoadBalancerPublicIPs releases the public IPs of the service but keepID: the
+// public IPs allocated by the cloud provider are deleted, the public IPs claimed from a
+// pool return to the pool
+func (c *Cloud) releaseLoadBalancerPublicIPs(serviceName types.NamespacedName, keepID string) error {
+	klog.V(5).Infof("releaseLoadBalancerPublicIPs(%v, %v)", serviceName, keepID)
+	if c.tagging.ClusterID == "" {
+		return nil
+	}
+	filters := osc.FiltersPublicIp{
+		TagKeys: c.tagging.clusterTagKeysFilter(),
+		Tags:    &[]string{TagNameKubernetesService + "=" + serviceName.String()},
+	}
+	publicIPs, err := c.compute.ReadPublicIps(&osc.ReadPublicIpsRequest{Filters: &filters})
+	if err != nil {
+		return err
+	}
+
+	for i := range publicIPs {
+		publicIP := &publicIPs[i]
+		if publicIP.GetPublicIpId() == keepID {
+			continue
+		}
+		switch c.tagging.clusterTagLifecycle(publicIPTags(publicIP)) {
+		case ResourceLifecycleOwned:
+			klog.Infof("Releasing the public IP %s of service %v", publicIP.GetPublicIp(), serviceName)
+			_, err := c.compute.DeletePublicIp(&osc.DeletePublicIpRequest{PublicIpId: publicIP.PublicIpId})
+			if err != nil {
+				return fmt.Errorf("error releasing public IP %s: %q", publicIP.GetPublicIp(), err)
+			}
+		case ResourceLifecycleShared:
+			klog.Infof("Returning the public IP %s of service %v to its pool", publicIP.GetPublicIp(), serviceName)
+			tags := []osc.ResourceTag{}
+			for key := range c.tagging.withoutExtraTags().buildTags(ResourceLifecycleShared, map[string]string{TagNameKubernetesService: ""}) {
+				tags = append(tags, osc.ResourceTag{Key: key})
+			}
+			_, err := c.compute.DeleteTags(&osc.DeleteTagsRequest{
+				ResourceIds: []string{publicIP.GetPublicIpId()},
+				Tags:        tags,
+			})
+			if err != nil {
+				return fmt.Errorf("error returning public IP %s to its pool: %q", publicIP.GetPublicIp(), err)
+			}
+		default:
+			klog.Warningf("Keeping the public IP %s of service %v, not tagged by the cloud provider", publicIP.GetPublicIp(), serviceName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newTestPublicIP(id string, ip string, tags map[string]string) osc.PublicIp {
+	resourceTags := []osc.ResourceTag{}
+	for key, value := range tags {
+		resourceTags = append(resourceTags, osc.ResourceTag{Key: key, Value: value})
+	}
+	return osc.PublicIp{PublicIpId: aws.String(id), PublicIp: aws.String(ip), Tags: &resourceTags}
+}
+
+func TestEnsureLoadBalancerPublicIPFromPool(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	c.tagging.extraTags = map[string]string{"team": "platform"}
+
+	fakeCompute := awsServices.compute.(*FakeComputeImpl)
+	fakeCompute.PublicIps = []osc.PublicIp{
+		newTestPublicIP("eipalloc-used", "198.51.100.1", map[string]string{
+			TagNameIPPool:            "web",
+			TagNameKubernetesService: "default/other",
+		}),
+		newTestPublicIP("eipalloc-free", "198.51.100.2", map[string]string{TagNameIPPool: "web", "team": "network"}),
+	}
+
+	serviceName := types.NamespacedName{Namespace: "default", Name: "web"}
+	annotations := map[string]string{ServiceAnnotationLoadBalancerIPPool: "web"}
+	for i := 0; i < 2; i++ {
+		err = c.ensureLoadBalancerPublicIP(serviceName, "lb-web", false, annotations)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, map[string]string{"lb-web": "198.51.100.2"}, fakeCompute.LoadBalancerPublicIps)
+	assert.Equal(t, map[string]string{
+		TagNameIPPool:             "web",
+		TagNameKubernetesService:  "default/web",
+		c.tagging.clusterTagKey(): ResourceLifecycleShared,
+		"team":                    "network",
+	}, publicIPTags(&fakeCompute.PublicIps[1]))
+
+	// The claimed public IP returns to the pool with its own tags
+	err = c.releaseLoadBalancerPublicIPs(serviceName, "")
+	assert.NoError(t, err)
+	assert.Len(t, fakeCompute.PublicIps, 2)
+	assert.Equal(t, map[string]string{TagNameIPPool: "web", "team": "network"}, publicIPTags(&fakeCompute.PublicIps[1]))
+}
+
+func TestEnsureLoadBalancerPublicIPNotAssociated(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	fakeCompute := awsServices.compute.(*FakeComputeImpl)
+	fakeCompute.PublicIps = []osc.PublicIp{
+		newTestPublicIP("eipalloc-free", "198.51.100.2", map[string]string{TagNameIPPool: "web"}),
+	}
+	fakeCompute.LoadBalancerPublicIpsPending = true
+
+	serviceName := types.NamespacedName{Namespace: "default", Name: "web"}
+	annotations := map[string]string{ServiceAnnotationLoadBalancerIPPool: "web"}
+	err = c.ensureLoadBalancerPublicIP(serviceName, "lb-web", false, annotations)
+	assert.ErrorIs(t, err, ErrLoadBalancerIsNotReady)
+	var notReady *LoadBalancerNotReadyError
+	if assert.ErrorAs(t, err, &notReady) {
+		assert.Equal(t, NotReadyWaitingForIPAssociation, notReady.Reason)
+	}
+
+	fakeCompute.LoadBalancerPublicIpsPending = false
+	assert.NoError(t, c.ensureLoadBalancerPublicIP(serviceName, "lb-web", false, annotations))
+	assert.Equal(t, map[string]string{"lb-web": "198.51.100.2"}, fakeCompute.LoadBalancerPublicIps)
+}
+
+func TestEnsureLoadBalancerPublicIPAllocation(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	fakeCompute := awsServices.compute.(*FakeComputeImpl)
+	serviceName := types.NamespacedName{Namespace: "default", Name: "web"}
+	annotations := map[string]string{ServiceAnnotationLoadBalancerIPPool: "web"}
+
+	err = c.ensureLoadBalancerPublicIP(serviceName, "lb-web", false, annotations)
+	assert.Error(t, err, "no free public IP without allocation")
+	assert.Empty(t, fakeCompute.PublicIps)
+
+	c.cfg.Global.AllocateLoadBalancerPublicIps = true
+	err = c.ensureLoadBalancerPublicIP(serviceName, "lb-web", false, annotations)
+	assert.NoError(t, err)
+	assert.Len(t, fakeCompute.PublicIps, 1)
+	assert.Equal(t, map[string]string{
+		TagNameIPPool:             "web",
+		TagNameKubernetesService:  "default/web",
+		c.tagging.clusterTagKey(): ResourceLifecycleOwned,
+	}, publicIPTags(&fakeCompute.PublicIps[0]))
+	assert.Equal(t, map[string]string{"lb-web": fakeCompute.PublicIps[0].GetPublicIp()}, fakeCompute.LoadBalancerPublicIps)
+
+	err = c.ensureLoadBalancerPublicIP(serviceName, "lb-web", true, annotations)
+	assert.Error(t, err, "internal load balancer")
+
+	// The allocated public IP is released, the public IPs not tagged by the cloud provider are kept
+	fakeCompute.PublicIps = append(fakeCompute.PublicIps, newTestPublicIP("eipalloc-user", "198.51.100.3",
+		map[string]string{TagNameKubernetesService: "default/web"}))
+	err = c.releaseLoadBalancerPublicIPs(serviceName, "")
+	assert.NoError(t, err)
+	assert.Len(t, fakeCompute.PublicIps, 1)
+	assert.Equal(t, "eipalloc-user", fakeCompute.PublicIps[0].GetPublicIpId())
+}
+
+func TestEnsureLoadBalancerPublicIPPoolChange(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	fakeCompute := awsServices.compute.(*FakeComputeImpl)
+	fakeCompute.PublicIps = []osc.PublicIp{
+		newTestPublicIP("eipalloc-blue", "198.51.100.1", map[string]string{TagNameIPPool: "blue"}),
+		newTestPublicIP("eipalloc-green", "198.51.100.2", map[string]string{TagNameIPPool: "green"}),
+	}
+
+	serviceName := types.NamespacedName{Namespace: "default", Name: "web"}
+	err = c.ensureLoadBalancerPublicIP(serviceName, "lb-web", false, map[string]string{ServiceAnnotationLoadBalancerIPPool: "blue"})
+	assert.NoError(t, err)
+	err = c.ensureLoadBalancerPublicIP(serviceName, "lb-web", false, map[string]string{ServiceAnnotationLoadBalancerIPPool: "green"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"lb-web": "198.51.100.2"}, fakeCompute.LoadBalancerPublicIps)
+	assert.Equal(t, map[string]string{TagNameIPPool: "blue"}, publicIPTags(&fakeCompute.PublicIps[0]))
+	assert.Equal(t, "default/web", publicIPTags(&fakeCompute.PublicIps[1])[TagNameKubernetesService])
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM API Rate Limiting *********************
+
+const (
+	// defaultThrottleMaxRetries is the number of retries of a throttled call when
+	// ThrottleMaxRetries is not set
+	defaultThrottleMaxRetries = 5
+	// throttleBaseDelay and throttleMaxDelay bound the exponential backoff of throttled calls
+	throttleBaseDelay = 500 * time.Millisecond
+	throttleMaxDelay  = 30 * time.Second
+)
+
+// apiThrottling holds the client-side rate limiters of the oAPI and LBU API families,
+// shared by all the clients of a family so that a burst of load balancer calls cannot
+// exhaust the quota used by the node controllers.
+type apiThrottling struct {
+	oapi       flowcontrol.RateLimiter
+	lbu        flowcontrol.RateLimiter
+	maxRetries int
+}
+
+func newAPIThrottling(cfg *CloudConfig) *apiThrottling {
+	maxRetries := cfg.Global.ThrottleMaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultThrottleMaxRetries
+	}
+	return &apiThrottling{
+		oapi:       newAPIRateLimiter(cfg.Global.OapiQPS, cfg.Global.OapiBurst),
+		lbu:        newAPIRateLimiter(cfg.Global.LbuQPS, cfg.Global.LbuBurst),
+		maxRetries: maxRetries,
+	}
+}
+
+// newAPIRateLimiter returns a token bucket rate limiter, or nil when qps is not set
+func newAPIRateLimiter(qps float32, burst int) flowcontrol.RateLimiter {
+	if qps <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(float64(qps)))
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+}
+
+// throttleBackoff returns the jittered exponential delay before the retry of a call
+// throttled attempt times
+func throttleBackoff(attempt int) time.Duration {
+	delay := throttleBaseDelay
+	for i := 0; i < attempt && delay < throttleMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > throttleMaxDelay {
+		delay = throttleMaxDelay
+	}
+	return wait.Jitter(delay/2, 1.0)
+}
+
+// oapiHTTPClient returns the HTTP client of the oAPI clients, sending the requests
+// through next (the default transport when nil)
+func (t *apiThrottling) oapiHTTPClient(next http.RoundTripper) *http.Client {
+	if t == nil {
+		if next == nil {
+			return nil
+		}
+		return &http.Client{Transport: next}
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &http.Client{Transport: &throttledTransport{
+		next:       next,
+		limiter:    t.oapi,
+		maxRetries: t.maxRetries,
+		sleep:      sleepWithContext,
+	}}
+}
+
+// addLbuHandlers rate limits the LBU calls and retries the throttled ones
+func (t *apiThrottling) addLbuHandlers(h *request.Handlers) {
+	if t == nil || t.lbu == nil {
+		return
+	}
+	h.Sign.PushFrontNamed(request.NamedHandler{
+		Name: "k8s/rate-limit",
+		Fn: func(r *request.Request) {
+			t.lbu.Accept()
+		},
+	})
+}
+
+// lbuRetryer retries the throttled LBU calls with a jittered exponential backoff
+func (t *apiThrottling) lbuRetryer() request.Retryer {
+	maxRetries := defaultThrottleMaxRetries
+	if t != nil {
+		maxRetries = t.maxRetries
+	}
+	return client.DefaultRetryer{
+		NumMaxRetries:    maxRetries,
+		MinThrottleDelay: throttleBaseDelay,
+		MaxThrottleDelay: throttleMaxDelay,
+	}
+}
+
+// throttledTransport rate limits the oAPI calls and retries them with a jittered
+// exponential backoff when the API answers that they are throttled
+type throttledTransport struct {
+	next       http.RoundTripper
+	limiter    flowcontrol.RateLimiter
+	maxRetries int
+	sleep      func(context.Context, time.Duration) error
+}
+
+// sleepWithContext waits for d, returning early with the error of ctx when it is done
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isThrottledResponse(response *http.Response) bool {
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if t.limiter != nil {
+			if err := t.limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+		response, err := t.next.RoundTrip(req)
+		if err != nil || !isThrottledResponse(response) || attempt >= t.maxRetries || req.GetBody == nil {
+			return response, err
+		}
+
+		body, err := req.GetBody()
+		if err != nil {
+			return response, nil
+		}
+		response.Body.Close()
+
+		delay := throttleBackoff(attempt)
+		klog.Warningf("oAPI call %s throttled (%s), retrying in %v", req.URL.Path, response.Status, delay)
+		if err := t.sleep(req.Context(), delay); err != nil {
+			body.Close()
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+}
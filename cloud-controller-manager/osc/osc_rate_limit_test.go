@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAPIThrottling(t *testing.T) {
+	cfg := &CloudConfig{}
+	throttling := newAPIThrottling(cfg)
+	assert.Nil(t, throttling.oapi)
+	assert.Nil(t, throttling.lbu)
+	assert.Equal(t, defaultThrottleMaxRetries, throttling.maxRetries)
+
+	cfg.Global.OapiQPS = 2.5
+	cfg.Global.LbuQPS = 1
+	cfg.Global.LbuBurst = 10
+	cfg.Global.ThrottleMaxRetries = 2
+	throttling = newAPIThrottling(cfg)
+	assert.Equal(t, float32(2.5), throttling.oapi.QPS())
+	assert.Equal(t, float32(1), throttling.lbu.QPS())
+	assert.Equal(t, 2, throttling.maxRetries)
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := throttleBackoff(attempt)
+		assert.True(t, delay >= throttleBaseDelay/2, "attempt %d: %v", attempt, delay)
+		assert.True(t, delay <= throttleMaxDelay, "attempt %d: %v", attempt, delay)
+	}
+}
+
+func TestThrottledTransport(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"Filters":{}}`, string(body))
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	delays := []time.Duration{}
+	transport := &throttledTransport{
+		next:       http.DefaultTransport,
+		maxRetries: 5,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		},
+	}
+	client := &http.Client{Transport: transport}
+
+	request, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString(`{"Filters":{}}`))
+	assert.NoError(t, err)
+	response, err := client.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, 3, calls)
+	assert.Len(t, delays, 2)
+
+	// Retries are bounded
+	calls = -10
+	transport.maxRetries = 1
+	request, err = http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString(`{"Filters":{}}`))
+	assert.NoError(t, err)
+	response, err = client.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, -8, calls)
+
+	// The backoff is interrupted when the request is canceled
+	calls = 0
+	transport.maxRetries = 5
+	transport.sleep = sleepWithContext
+	ctx, cancel := context.WithCancel(context.Background())
+	request, err = http.NewRequestWithContext(ctx, http.MethodPost, server.URL, bytes.NewBufferString(`{"Filters":{}}`))
+	assert.NoError(t, err)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = client.Do(request)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), throttleBaseDelay/2)
+	assert.Equal(t, 1, calls)
+}
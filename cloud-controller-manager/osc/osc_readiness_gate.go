@@ -0,0 +1,194 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Load Balancer Readiness Gate *********************
+
+// loadBalancerReadinessController sets the PodConditionLoadBalancerReady condition of
+// the pods backing a LoadBalancer Service, once the LBU reports the node hosting the
+// pod as InService. Pods opt in by declaring the condition as a readiness gate, so
+// that rolling updates wait for the load balancer before removing the previous pods.
+type loadBalancerReadinessController struct {
+	cloud    *Cloud
+	interval time.Duration
+}
+
+// podLoadBalancerReadiness accumulates the readiness of a pod across the load balancers
+// of the Services selecting it
+type podLoadBalancerReadiness struct {
+	pod      *v1.Pod
+	ready    bool
+	messages []string
+}
+
+func newLoadBalancerReadinessController(cloud *Cloud, interval time.Duration) *loadBalancerReadinessController {
+	return &loadBalancerReadinessController{
+		cloud:    cloud,
+		interval: interval,
+	}
+}
+
+// run synchronizes the readiness gates every interval until stop is closed
+func (r *loadBalancerReadinessController) run(stop <-chan struct{}) {
+	if r == nil || r.interval <= 0 {
+		return
+	}
+
+	klog.Infof("Starting load balancer readiness gate controller (interval %v)", r.interval)
+	go wait.Until(r.sync, r.interval, stop)
+}
+
+// hasLoadBalancerReadinessGate checks whether the pod declares the load balancer readiness gate
+func hasLoadBalancerReadinessGate(pod *v1.Pod) bool {
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == PodConditionLoadBalancerReady {
+			return true
+		}
+	}
+	return false
+}
+
+// sync computes the readiness of every gated pod and updates its condition
+func (r *loadBalancerReadinessController) sync() {
+	c := r.cloud
+	if c.kubeClient == nil || c.nodeInformerHasSynced == nil || !c.nodeInformerHasSynced() {
+		klog.V(4).Infof("Node informer not ready, skipping load balancer readiness gates")
+		return
+	}
+
+	ctx := context.TODO()
+	services, err := c.kubeClient.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Warningf("Unable to list services for load balancer readiness gates: %q", err)
+		return
+	}
+
+	pods := make(map[types.NamespacedName]*podLoadBalancerReadiness)
+	for i := range services.Items {
+		service := &services.Items[i]
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer || len(service.Spec.Selector) == 0 ||
+			!c.managesLoadBalancerClass(service) {
+			continue
+		}
+
+		loadBalancerName := c.GetLoadBalancerName(ctx, "", service)
+		health, err := c.loadBalancerService.describeLoadBalancerInstancesHealth(loadBalancerName)
+		if err != nil {
+			klog.V(2).Infof("Unable to retrieve backend health of %s for readiness gates: %q", loadBalancerName, err)
+			continue
+		}
+
+		podList, err := c.kubeClient.CoreV1().Pods(service.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String(),
+		})
+		if err != nil {
+			klog.Warningf("Unable to list pods of service %s/%s: %q", service.Namespace, service.Name, err)
+			continue
+		}
+
+		for j := range podList.Items {
+			pod := &podList.Items[j]
+			if !hasLoadBalancerReadinessGate(pod) || pod.Spec.NodeName == "" {
+				continue
+			}
+
+			key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+			readiness, found := pods[key]
+			if !found {
+				readiness = &podLoadBalancerReadiness{pod: pod, ready: true}
+				pods[key] = readiness
+			}
+
+			state := nodeLoadBalancerHealthUnknown
+			instanceID, err := c.nodeNameToProviderID(types.NodeName(pod.Spec.NodeName))
+			if err == nil {
+				if s, ok := health[string(instanceID)]; ok {
+					state = s
+				}
+			}
+			if state != "InService" {
+				readiness.ready = false
+			}
+			readiness.messages = append(readiness.messages, fmt.Sprintf("%s=%s", loadBalancerName, state))
+		}
+	}
+
+	for _, readiness := range pods {
+		if err := r.setPodCondition(readiness); err != nil {
+			klog.Warningf("Unable to update load balancer readiness of pod %s/%s: %q",
+				readiness.pod.Namespace, readiness.pod.Name, err)
+		}
+	}
+}
+
+// setPodCondition patches the PodConditionLoadBalancerReady condition of the pod when it changed
+func (r *loadBalancerReadinessController) setPodCondition(readiness *podLoadBalancerReadiness) error {
+	status := v1.ConditionFalse
+	reason := "LoadBalancerBackendNotInService"
+	if readiness.ready {
+		status = v1.ConditionTrue
+		reason = "LoadBalancerBackendInService"
+	}
+	message := strings.Join(readiness.messages, ",")
+
+	transitionTime := metav1.Now()
+	for _, condition := range readiness.pod.Status.Conditions {
+		if condition.Type != PodConditionLoadBalancerReady || condition.Status != status {
+			continue
+		}
+		if condition.Message == message {
+			return nil
+		}
+		transitionTime = condition.LastTransitionTime
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []v1.PodCondition{{
+				Type:               PodConditionLoadBalancerReady,
+				Status:             status,
+				LastTransitionTime: transitionTime,
+				Reason:             reason,
+				Message:            message,
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	klog.V(2).Infof("Setting load balancer readiness of pod %s/%s to %s (%s)",
+		readiness.pod.Namespace, readiness.pod.Name, status, message)
+	_, err = r.cloud.kubeClient.CoreV1().Pods(readiness.pod.Namespace).Patch(context.TODO(), readiness.pod.Name,
+		types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func getPodCondition(t *testing.T, c *Cloud, name string) *v1.PodCondition {
+	pod, err := c.kubeClient.CoreV1().Pods("default").Get(context.TODO(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == PodConditionLoadBalancerReady {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func TestLoadBalancerReadinessGate(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "web-uid"},
+		Spec: v1.ServiceSpec{
+			Type:     v1.ServiceTypeLoadBalancer,
+			Selector: map[string]string{"app": "web"},
+		},
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-aaaaaaaa"},
+	}
+	gatedPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "gated", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec: v1.PodSpec{
+			NodeName:       "node-a",
+			ReadinessGates: []v1.PodReadinessGate{{ConditionType: PodConditionLoadBalancerReady}},
+		},
+	}
+	plainPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "plain", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec:       v1.PodSpec{NodeName: "node-a"},
+	}
+
+	client := fake.NewSimpleClientset(service, node, gatedPod, plainPod)
+	c.kubeClient = client
+	c.nodeInformer = informers.NewSharedInformerFactory(client, 0).Core().V1().Nodes()
+	c.nodeInformerHasSynced = func() bool { return true }
+	assert.NoError(t, c.nodeInformer.Informer().GetStore().Add(node))
+
+	fakeELB := awsServices.elb.(*FakeELB)
+	fakeELB.LoadBalancers = map[string]*elb.LoadBalancerDescription{
+		"webuid": {
+			LoadBalancerName: aws.String("webuid"),
+			Instances:        []*elb.Instance{{InstanceId: aws.String("i-aaaaaaaa")}},
+		},
+	}
+
+	controller := newLoadBalancerReadinessController(c, time.Minute)
+	controller.sync()
+	condition := getPodCondition(t, c, "gated")
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, v1.ConditionFalse, condition.Status)
+		assert.Equal(t, "webuid=Unknown", condition.Message)
+	}
+	assert.Nil(t, getPodCondition(t, c, "plain"), "pods without the readiness gate are left untouched")
+
+	fakeELB.InstanceHealth = map[string]string{"i-aaaaaaaa": "InService"}
+	controller.sync()
+	condition = getPodCondition(t, c, "gated")
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, v1.ConditionTrue, condition.Status)
+		assert.Equal(t, "webuid=InService", condition.Message)
+	}
+}
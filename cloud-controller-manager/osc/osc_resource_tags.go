@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ********************* CCM Resource Tags *********************
+
+// ResourceTags is set by the --resource-tags flag and takes precedence over the
+// ResourceTags of the cloud config
+var ResourceTags string
+
+// parseResourceTags parses the comma separated key=value tags set on all the resources
+// created by the cloud provider. The tags set by the cloud provider itself are refused.
+func parseResourceTags(value string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, tagValue, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+		if isReservedLoadBalancerTag(key) || key == tagNameKubernetesCluster() {
+			return nil, fmt.Errorf("tag %q is reserved for the cloud provider", key)
+		}
+		if _, duplicate := tags[key]; duplicate {
+			return nil, fmt.Errorf("tag %q is set twice", key)
+		}
+		tags[key] = strings.TrimSpace(tagValue)
+	}
+	return tags, nil
+}
+
+// formatResourceTags returns the tags in the format of parseResourceTags, sorted by key
+func formatResourceTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseResourceTags(t *testing.T) {
+	tags, err := parseResourceTags(" team=platform, cost-center = 1234,empty=,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "platform", "cost-center": "1234", "empty": ""}, tags)
+	assert.Equal(t, "cost-center=1234,empty=,team=platform", formatResourceTags(tags))
+
+	tags, err = parseResourceTags("")
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+
+	for _, value := range []string{"team", "=platform", "team=web,team=db", "OscK8sClusterID/other=owned", TagNameKubernetesService + "=default/web"} {
+		_, err := parseResourceTags(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestResourceTags(t *testing.T) {
+	cfg := CloudConfig{}
+	cfg.Global.ResourceTags = "team=platform,cost-center=1234"
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(cfg, awsServices)
+	require.NoError(t, err)
+	c.vpcID = "vpc-123456"
+	c.eventRecorder = record.NewFakeRecorder(20)
+
+	// The tags of the resource and of the cloud provider take precedence
+	tags := c.tagging.buildTags(ResourceLifecycleOwned, map[string]string{"team": "web"})
+	assert.Equal(t, "web", tags["team"])
+	assert.Equal(t, "1234", tags["cost-center"])
+	assert.Equal(t, ResourceLifecycleOwned, tags[c.tagging.clusterTagKey()])
+
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+	}) {
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{"subnet-a0000001": true}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "anuid"},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports:           []v1.ServicePort{{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP}},
+		},
+	}
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	require.NoError(t, err)
+	loadBalancerTags, err := c.loadBalancerService.describeLoadBalancerTags(c.GetLoadBalancerName(context.TODO(), TestClusterName, service))
+	require.NoError(t, err)
+	assert.Equal(t, "platform", loadBalancerTags["team"])
+	assert.Equal(t, "1234", loadBalancerTags["cost-center"])
+
+	// The flag takes precedence over the cloud config
+	ResourceTags = "team=db"
+	defer func() { ResourceTags = "" }()
+	c, err = newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "db"}, c.tagging.extraTags)
+
+	cfg.Global.ResourceTags = "OscK8sService=web"
+	ResourceTags = ""
+	_, err = newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.ErrorContains(t, err, "invalid ResourceTags")
+}
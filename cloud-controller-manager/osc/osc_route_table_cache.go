@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Route Table Cache *********************
+
+// routeTableCache keeps the route tables of the cluster VPC, used to classify
+// subnets as public or private. Route tables rarely change, so they are only
+// read again once the TTL has expired or the cache has been invalidated.
+type routeTableCache struct {
+	ttl time.Duration
+
+	mutex     sync.Mutex
+	tables    []osc.RouteTable
+	fetchedAt time.Time
+	valid     bool
+}
+
+func newRouteTableCache(ttl time.Duration) *routeTableCache {
+	return &routeTableCache{ttl: ttl}
+}
+
+// get returns the cached route tables, calling fetch when the cache is disabled,
+// empty or expired
+func (c *routeTableCache) get(fetch func() ([]osc.RouteTable, error)) ([]osc.RouteTable, error) {
+	if c == nil || c.ttl <= 0 {
+		return fetch()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.valid && time.Since(c.fetchedAt) < c.ttl {
+		klog.V(5).Infof("Using cached route tables (age %v)", time.Since(c.fetchedAt))
+		return c.tables, nil
+	}
+
+	tables, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.tables = tables
+	c.fetchedAt = time.Now()
+	c.valid = true
+	return tables, nil
+}
+
+// invalidate forces the next get to read the route tables again
+func (c *routeTableCache) invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.valid = false
+	c.tables = nil
+}
+
+// invalidateOnSignal invalidates the cache each time the process receives SIGHUP,
+// so that network administrators can force a refresh after modifying the routing
+func (c *routeTableCache) invalidateOnSignal(stop <-chan struct{}) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				klog.Infof("Received SIGHUP, invalidating the route table cache")
+				c.invalidate()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
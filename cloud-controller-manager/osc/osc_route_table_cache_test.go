@@ -0,0 +1,71 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteTableCache(t *testing.T) {
+	calls := 0
+	var fetchErr error
+	fetch := func() ([]osc.RouteTable, error) {
+		calls++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return []osc.RouteTable{{}}, nil
+	}
+
+	disabled := newRouteTableCache(0)
+	_, _ = disabled.get(fetch)
+	_, _ = disabled.get(fetch)
+	assert.Equal(t, 2, calls, "a disabled cache should always fetch")
+
+	calls = 0
+	cache := newRouteTableCache(time.Hour)
+	tables, err := cache.get(fetch)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 1)
+	_, _ = cache.get(fetch)
+	assert.Equal(t, 1, calls, "route tables should be served from the cache")
+
+	cache.invalidate()
+	_, _ = cache.get(fetch)
+	assert.Equal(t, 2, calls, "an invalidated cache should fetch again")
+
+	cache.invalidate()
+	fetchErr = errors.New("boom")
+	_, err = cache.get(fetch)
+	assert.Error(t, err)
+	fetchErr = nil
+	_, err = cache.get(fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, calls, "errors should not be cached")
+
+	expired := newRouteTableCache(time.Millisecond)
+	calls = 0
+	_, _ = expired.get(fetch)
+	time.Sleep(5 * time.Millisecond)
+	_, _ = expired.get(fetch)
+	assert.Equal(t, 2, calls, "expired route tables should be fetched again")
+}
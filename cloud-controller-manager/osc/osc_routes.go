@@ -94,7 +94,7 @@ func (c *Cloud) ListRoutes(ctx context.Context, clusterName string) ([]*cloudpro
 		instanceIDs = append(instanceIDs, instanceID)
 	}
 
-	instances, err := c.getInstancesByIDs(&instanceIDs)
+	instances, err := c.instanceService.getInstancesByIDs(&instanceIDs)
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +122,7 @@ func (c *Cloud) ListRoutes(ctx context.Context, clusterName string) ([]*cloudpro
 		if instanceID != "" {
 			instance, found := instances[instanceID]
 			if found {
-				route.TargetNode = mapInstanceToNodeName(instance)
+				route.TargetNode = c.nodeNames.nodeName(instance)
 				routes = append(routes, route)
 			} else {
 				klog.Warningf("unable to find instance ID %s in the list of instances being routed to", instanceID)
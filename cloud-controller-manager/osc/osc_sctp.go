@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ********************* CCM SCTP Listeners *********************
+
+// ipProtocolSCTP is the IP protocol number of SCTP, used in the security group rules which
+// only name the tcp, udp and icmp protocols
+const ipProtocolSCTP = "132"
+
+// checkListenerProtocol checks that the load balancer supports listeners of the protocol of
+// a service port: TCP, and SCTP when LoadBalancerSCTPListeners is set in the cloud config
+func (c *Cloud) checkListenerProtocol(port v1.ServicePort) error {
+	switch port.Protocol {
+	case v1.ProtocolTCP:
+		return nil
+	case v1.ProtocolSCTP:
+		if c.cfg.Global.LoadBalancerSCTPListeners {
+			return nil
+		}
+		return fmt.Errorf("unsupported protocol SCTP of port %d: the LBU API of region %s does not accept SCTP listeners"+
+			" (set LoadBalancerSCTPListeners in the cloud config when it does)", port.Port, c.region)
+	default:
+		return fmt.Errorf("unsupported protocol %s of port %d: only TCP and SCTP load balancers are supported", port.Protocol, port.Port)
+	}
+}
+
+// securityGroupRuleProtocol returns the IP protocol of the security group rules of a service port
+func securityGroupRuleProtocol(protocol v1.Protocol) string {
+	if protocol == v1.ProtocolSCTP {
+		return ipProtocolSCTP
+	}
+	return strings.ToLower(string(protocol))
+}
+
+// isSCTPListener checks whether the listener passes SCTP through
+func isSCTPListener(protocol *string) bool {
+	return protocol != nil && strings.EqualFold(*protocol, string(v1.ProtocolSCTP))
+}
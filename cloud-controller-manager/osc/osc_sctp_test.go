@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCheckListenerProtocol(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.checkListenerProtocol(v1.ServicePort{Protocol: v1.ProtocolTCP, Port: 80}))
+	assert.Error(t, c.checkListenerProtocol(v1.ServicePort{Protocol: v1.ProtocolUDP, Port: 53}))
+	err = c.checkListenerProtocol(v1.ServicePort{Protocol: v1.ProtocolSCTP, Port: 3868})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "LoadBalancerSCTPListeners")
+	}
+
+	c.cfg.Global.LoadBalancerSCTPListeners = true
+	assert.NoError(t, c.checkListenerProtocol(v1.ServicePort{Protocol: v1.ProtocolSCTP, Port: 3868}))
+}
+
+func TestBuildSCTPListener(t *testing.T) {
+	port := v1.ServicePort{Name: "diameter", Protocol: v1.ProtocolSCTP, Port: 3868, NodePort: 31868}
+
+	listener, err := buildListener(port, map[string]string{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "SCTP", aws.StringValue(listener.Protocol))
+	assert.Equal(t, "SCTP", aws.StringValue(listener.InstanceProtocol))
+	assert.Equal(t, int64(31868), aws.Int64Value(listener.InstancePort))
+	assert.True(t, isSCTPListener(listener.Protocol))
+
+	// The certificate of all the ports doesn't apply to SCTP
+	listener, err = buildListener(port, map[string]string{ServiceAnnotationLoadBalancerCertificate: "cert"}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, listener.SSLCertificateId)
+
+	annotations := map[string]string{
+		ServiceAnnotationLoadBalancerCertificate: "cert",
+		ServiceAnnotationLoadBalancerSSLPorts:    "diameter",
+	}
+	_, err = buildListener(port, annotations, getPortSets(annotations[ServiceAnnotationLoadBalancerSSLPorts]))
+	assert.Error(t, err)
+
+	_, err = buildListener(port, map[string]string{ServiceAnnotationLoadBalancerBEProtocol: "http"}, nil)
+	assert.Error(t, err)
+}
+
+func TestSCTPIngressRules(t *testing.T) {
+	service := &v1.Service{Spec: v1.ServiceSpec{Ports: []v1.ServicePort{
+		{Protocol: v1.ProtocolTCP, Port: 80},
+		{Protocol: v1.ProtocolSCTP, Port: 3868},
+	}}}
+
+	protocols := map[string]int32{}
+	for _, rule := range loadBalancerIngressRules(service, []string{"0.0.0.0/0"}, nil).List() {
+		protocols[rule.GetIpProtocol()] = rule.GetFromPortRange()
+	}
+	assert.Equal(t, int32(80), protocols["tcp"])
+	assert.Equal(t, int32(3868), protocols[ipProtocolSCTP])
+}
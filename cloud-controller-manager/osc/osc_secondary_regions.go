@@ -0,0 +1,120 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Secondary Regions *********************
+
+// secondaryRegion is a region where the VMs of the nodes are also looked up, see SecondaryRegions
+type secondaryRegion struct {
+	region string
+	// oAPI endpoint of the region, empty for the endpoint derived from the region
+	endpoint string
+}
+
+// parseSecondaryRegions parses the comma-separated SecondaryRegions of the cloud config, each
+// region being optionally followed by =<oAPI endpoint>, in their fallback order
+func parseSecondaryRegions(value string, primary string) ([]secondaryRegion, error) {
+	var regions []secondaryRegion
+	seen := map[string]bool{primary: true}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		region, endpoint, _ := strings.Cut(entry, "=")
+		region = strings.TrimSpace(region)
+		endpoint = strings.TrimSpace(endpoint)
+		if region == "" {
+			return nil, fmt.Errorf("missing region in %q", entry)
+		}
+		if seen[region] {
+			return nil, fmt.Errorf("region %q is the region of the CCM or listed twice", region)
+		}
+		seen[region] = true
+		if endpoint != "" {
+			if u, err := url.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				return nil, fmt.Errorf("invalid endpoint %q of region %q", endpoint, region)
+			}
+		}
+		regions = append(regions, secondaryRegion{region: region, endpoint: endpoint})
+	}
+	return regions, nil
+}
+
+// vmEndpoint is an oAPI endpoint where InstancesV2 reads the VMs, the endpoint of the region
+// of the CCM being the first one
+type vmEndpoint struct {
+	region string
+	// Position in the fallback order, 0 for the region of the CCM
+	order  int
+	client *osc.APIClient
+	ctx    context.Context
+}
+
+// newVMEndpoint returns the oAPI endpoint of the region, at the given position in the
+// fallback order
+func newVMEndpoint(region secondaryRegion, order int, httpClient *http.Client, signed bool) (*vmEndpoint, error) {
+	ctx, client, err := NewOscClient(region.region, httpClient, signed)
+	if err != nil {
+		return nil, fmt.Errorf("error creating oAPI client of region %q: %v", region.region, err)
+	}
+	if region.endpoint != "" {
+		client.GetConfig().Servers = osc.ServerConfigurations{{URL: region.endpoint}}
+	}
+	return &vmEndpoint{
+		region: region.region,
+		order:  order,
+		client: client,
+		ctx:    ctx,
+	}, nil
+}
+
+// readVms calls ReadVms with the given request, recording the health of the endpoint and
+// the API metrics of the call
+func (e *vmEndpoint) readVms(request *osc.ReadVmsRequest) ([]osc.Vm, error) {
+	requestTime := time.Now()
+	response, httpRes, err := e.client.VmApi.ReadVms(e.ctx).ReadVmsRequest(*request).Execute()
+	recordOapiMetric("ReadVms", requestTime, httpRes, err)
+	klog.V(4).InfoS("ReadVms", "region", e.region, "vms", len(response.GetVms()))
+	klog.V(6).InfoS("ReadVms response", "region", e.region, "response", redact(response))
+	recordInstanceEndpointHealthMetric(e.region, e.order, err)
+
+	if err != nil {
+		if httpRes != nil {
+			return nil, fmt.Errorf("error describing ec2 instances: %v (Status:%v)", err, httpRes.Status)
+		}
+		return nil, fmt.Errorf("error describing ec2 instances: %v", err)
+	}
+
+	if !response.HasVms() {
+		// The oAPI omits Vms when none matches the filters
+		return []osc.Vm{}, nil
+	}
+	return response.GetVms(), nil
+}
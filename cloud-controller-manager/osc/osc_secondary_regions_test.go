@@ -0,0 +1,167 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestParseSecondaryRegions(t *testing.T) {
+	regions, err := parseSecondaryRegions(" us-east-2, cloudgouv-eu-west-1=https://api.example.com/api/v1,", "eu-west-2")
+	require.NoError(t, err)
+	assert.Equal(t, []secondaryRegion{
+		{region: "us-east-2"},
+		{region: "cloudgouv-eu-west-1", endpoint: "https://api.example.com/api/v1"},
+	}, regions)
+
+	regions, err = parseSecondaryRegions("", "eu-west-2")
+	require.NoError(t, err)
+	assert.Empty(t, regions)
+
+	for _, value := range []string{"eu-west-2", "us-east-2,us-east-2", "=https://api.example.com", "us-east-2=api.example.com"} {
+		_, err = parseSecondaryRegions(value, "eu-west-2")
+		assert.Error(t, err, value)
+	}
+}
+
+// newReadVmsServer returns an oAPI server answering ReadVms with the given VMs, or failing
+// when vms is nil
+func newReadVmsServer(t *testing.T, vms map[string]osc.Vm) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if vms == nil {
+			http.Error(w, `{"Errors":[{"Code":"2000"}]}`, http.StatusInternalServerError)
+			return
+		}
+		var request osc.ReadVmsRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		var found []osc.Vm
+		for _, id := range request.Filters.GetVmIds() {
+			if vm, ok := vms[id]; ok {
+				found = append(found, vm)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		response := osc.ReadVmsResponse{}
+		// Like the oAPI, Vms is omitted when none matches
+		if len(found) > 0 {
+			response.SetVms(found)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestVM(id string, subregion string) osc.Vm {
+	return osc.Vm{
+		VmId:      osc.PtrString(id),
+		State:     osc.PtrString("running"),
+		Placement: &osc.Placement{SubregionName: osc.PtrString(subregion)},
+	}
+}
+
+func TestInstancesV2SecondaryRegions(t *testing.T) {
+	registerMetrics()
+	// The API calls of the other tests are not counted
+	oscAPIRequestErrorsMetric.Reset()
+	primary := newReadVmsServer(t, map[string]osc.Vm{"i-1": newTestVM("i-1", "eu-west-2a")})
+	secondary := newReadVmsServer(t, map[string]osc.Vm{"i-2": newTestVM("i-2", "cloudgouv-eu-west-1a")})
+	failing := newReadVmsServer(t, nil)
+
+	newInstances := func(servers map[string]*httptest.Server, regions ...string) *instancesV2 {
+		i := &instancesV2{region: "eu-west-2", tags: &resourceTagging{}}
+		for order, region := range regions {
+			endpoint, err := newVMEndpoint(secondaryRegion{region: region, endpoint: servers[region].URL}, order, nil, false)
+			require.NoError(t, err)
+			i.endpoints = append(i.endpoints, endpoint)
+		}
+		return i
+	}
+	node := func(id string) *v1.Node {
+		return &v1.Node{Spec: v1.NodeSpec{ProviderID: "aws:///eu-west-2a/" + id}}
+	}
+
+	i := newInstances(map[string]*httptest.Server{"eu-west-2": primary, "cloudgouv-eu-west-1": secondary},
+		"eu-west-2", "cloudgouv-eu-west-1")
+	vm, err := i.getInstance(context.TODO(), node("i-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "i-1", vm.GetVmId())
+	vm, err = i.getInstance(context.TODO(), node("i-2"))
+	require.NoError(t, err)
+	assert.Equal(t, "cloudgouv-eu-west-1a", vm.Placement.GetSubregionName())
+	_, err = i.getInstance(context.TODO(), node("i-3"))
+	assert.Equal(t, cloudprovider.InstanceNotFound, err)
+
+	vms, err := i.readVmsByID([]string{"i-1", "i-2", "i-3"})
+	require.NoError(t, err)
+	assert.Len(t, vms, 2)
+	vms, err = i.readVmsByID([]string{"i-3", "i-4"})
+	require.NoError(t, err)
+	assert.Empty(t, vms)
+
+	// A VM is not reported as not found while an endpoint fails
+	i = newInstances(map[string]*httptest.Server{"eu-west-2": primary, "us-east-2": failing}, "eu-west-2", "us-east-2")
+	_, err = i.getInstance(context.TODO(), node("i-3"))
+	assert.Error(t, err)
+	assert.NotEqual(t, cloudprovider.InstanceNotFound, err)
+	_, err = i.readVmsByID([]string{"i-1", "i-3"})
+	assert.Error(t, err)
+	vms, err = i.readVmsByID([]string{"i-1"})
+	require.NoError(t, err)
+	assert.Len(t, vms, 1)
+
+	// The primary endpoint failing, the VMs are still found in the secondary region
+	i = newInstances(map[string]*httptest.Server{"us-east-2": failing, "cloudgouv-eu-west-1": secondary},
+		"us-east-2", "cloudgouv-eu-west-1")
+	vm, err = i.getInstance(context.TODO(), node("i-2"))
+	require.NoError(t, err)
+	assert.Equal(t, "i-2", vm.GetVmId())
+
+	expected := `
+# HELP cloudprovider_osc_instance_endpoint_up [ALPHA] Result of the last ReadVms call of InstancesV2 (1 when successful, 0 when failing) by region and fallback order
+# TYPE cloudprovider_osc_instance_endpoint_up gauge
+cloudprovider_osc_instance_endpoint_up{order="0",region="eu-west-2"} 1
+cloudprovider_osc_instance_endpoint_up{order="0",region="us-east-2"} 0
+cloudprovider_osc_instance_endpoint_up{order="1",region="cloudgouv-eu-west-1"} 1
+cloudprovider_osc_instance_endpoint_up{order="1",region="us-east-2"} 0
+# HELP cloudprovider_osc_instance_fallback_lookups_total [ALPHA] VM lookups of InstancesV2 in a secondary region by region and result (found, not_found or error)
+# TYPE cloudprovider_osc_instance_fallback_lookups_total counter
+cloudprovider_osc_instance_fallback_lookups_total{region="cloudgouv-eu-west-1",result="found"} 3
+cloudprovider_osc_instance_fallback_lookups_total{region="cloudgouv-eu-west-1",result="not_found"} 2
+cloudprovider_osc_instance_fallback_lookups_total{region="us-east-2",result="error"} 2
+# HELP cloudprovider_osc_api_request_errors_total [ALPHA] Outscale API errors by API (oapi or lbu), operation and error code
+# TYPE cloudprovider_osc_api_request_errors_total counter
+cloudprovider_osc_api_request_errors_total{api="oapi",code="500",operation="ReadVms"} 3
+`
+	assert.NoError(t, testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(expected),
+		"cloudprovider_osc_instance_endpoint_up", "cloudprovider_osc_instance_fallback_lookups_total",
+		"cloudprovider_osc_api_request_errors_total"))
+}
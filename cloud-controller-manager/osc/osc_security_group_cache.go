@@ -0,0 +1,181 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Security Group Cache *********************
+
+// securityGroupCache keeps the security groups tagged for the cluster, indexed by ID, which
+// are otherwise listed at each reconciliation of a load balancer. Like an informer, the
+// groups are refreshed periodically, and the cache is invalidated by the calls modifying
+// the security groups.
+type securityGroupCache struct {
+	ttl time.Duration
+
+	mutex     sync.Mutex
+	groups    map[string]osc.SecurityGroup
+	fetchedAt time.Time
+	valid     bool
+}
+
+func newSecurityGroupCache(ttl time.Duration) *securityGroupCache {
+	return &securityGroupCache{ttl: ttl}
+}
+
+// enabled returns whether the security groups are cached
+func (c *securityGroupCache) enabled() bool {
+	return c != nil && c.ttl > 0
+}
+
+// copyGroups returns a copy of the index, which the callers may modify
+func copyGroups(groups map[string]osc.SecurityGroup) map[string]osc.SecurityGroup {
+	copied := make(map[string]osc.SecurityGroup, len(groups))
+	for id, group := range groups {
+		copied[id] = group
+	}
+	return copied
+}
+
+// get returns the cached security groups, calling fetch when the cache is disabled, empty
+// or expired. The concurrent calls wait for the same fetch.
+func (c *securityGroupCache) get(fetch func() (map[string]osc.SecurityGroup, error)) (map[string]osc.SecurityGroup, error) {
+	if !c.enabled() {
+		return fetch()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.valid && time.Since(c.fetchedAt) < c.ttl {
+		klog.V(5).Infof("Using cached security groups (age %v)", time.Since(c.fetchedAt))
+		return copyGroups(c.groups), nil
+	}
+	if err := c.fetchLocked(fetch); err != nil {
+		return nil, err
+	}
+	return copyGroups(c.groups), nil
+}
+
+// fetchLocked reads the security groups, the mutex must be held
+func (c *securityGroupCache) fetchLocked(fetch func() (map[string]osc.SecurityGroup, error)) error {
+	groups, err := fetch()
+	if err != nil {
+		return err
+	}
+	c.groups = groups
+	c.fetchedAt = time.Now()
+	c.valid = true
+	return nil
+}
+
+// refresh reads the security groups again
+func (c *securityGroupCache) refresh(fetch func() (map[string]osc.SecurityGroup, error)) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.fetchLocked(fetch)
+}
+
+// invalidate forces the next get to read the security groups again
+func (c *securityGroupCache) invalidate() {
+	if !c.enabled() {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.valid = false
+	c.groups = nil
+}
+
+// run refreshes the security groups twice per TTL until stop is closed, so that the
+// reconciliations find them in the cache
+func (c *securityGroupCache) run(stop <-chan struct{}, fetch func() (map[string]osc.SecurityGroup, error)) {
+	if !c.enabled() {
+		return
+	}
+
+	klog.Infof("Starting security group cache (TTL %v)", c.ttl)
+	go wait.Until(func() {
+		if err := c.refresh(fetch); err != nil {
+			klog.Warningf("Unable to refresh the security group cache: %v", err)
+		}
+	}, c.ttl/2, stop)
+}
+
+// securityGroupInvalidatingCompute invalidates the security group cache after the calls
+// modifying the security groups, their rules or their tags
+type securityGroupInvalidatingCompute struct {
+	Compute
+	cache *securityGroupCache
+}
+
+// newSecurityGroupInvalidatingCompute returns the compute invalidating the cache, or compute
+// when the cache is disabled
+func newSecurityGroupInvalidatingCompute(compute Compute, cache *securityGroupCache) Compute {
+	if !cache.enabled() {
+		return compute
+	}
+	return &securityGroupInvalidatingCompute{Compute: compute, cache: cache}
+}
+
+// invalidateSecurityGroups invalidates the cache when one of the resources is a security group
+func (s *securityGroupInvalidatingCompute) invalidateSecurityGroups(resourceIDs []string) {
+	for _, id := range resourceIDs {
+		if strings.HasPrefix(id, "sg-") {
+			s.cache.invalidate()
+			return
+		}
+	}
+}
+
+func (s *securityGroupInvalidatingCompute) CreateSecurityGroup(request *osc.CreateSecurityGroupRequest) (*osc.CreateSecurityGroupResponse, error) {
+	defer s.cache.invalidate()
+	return s.Compute.CreateSecurityGroup(request)
+}
+
+func (s *securityGroupInvalidatingCompute) DeleteSecurityGroup(request *osc.DeleteSecurityGroupRequest) (*osc.DeleteSecurityGroupResponse, error) {
+	defer s.cache.invalidate()
+	return s.Compute.DeleteSecurityGroup(request)
+}
+
+func (s *securityGroupInvalidatingCompute) CreateSecurityGroupRule(request *osc.CreateSecurityGroupRuleRequest) (*osc.CreateSecurityGroupRuleResponse, error) {
+	defer s.cache.invalidate()
+	return s.Compute.CreateSecurityGroupRule(request)
+}
+
+func (s *securityGroupInvalidatingCompute) DeleteSecurityGroupRule(request *osc.DeleteSecurityGroupRuleRequest) (*osc.DeleteSecurityGroupRuleResponse, error) {
+	defer s.cache.invalidate()
+	return s.Compute.DeleteSecurityGroupRule(request)
+}
+
+func (s *securityGroupInvalidatingCompute) CreateTags(request *osc.CreateTagsRequest) (*osc.CreateTagsResponse, error) {
+	defer s.invalidateSecurityGroups(request.ResourceIds)
+	return s.Compute.CreateTags(request)
+}
+
+func (s *securityGroupInvalidatingCompute) DeleteTags(request *osc.DeleteTagsRequest) (*osc.DeleteTagsResponse, error) {
+	defer s.invalidateSecurityGroups(request.ResourceIds)
+	return s.Compute.DeleteTags(request)
+}
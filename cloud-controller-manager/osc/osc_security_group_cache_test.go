@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSecurityGroupCompute counts the ReadSecurityGroups calls
+type countingSecurityGroupCompute struct {
+	FakeCompute
+	reads int
+}
+
+func (c *countingSecurityGroupCompute) ReadSecurityGroups(request *osc.ReadSecurityGroupsRequest) ([]osc.SecurityGroup, error) {
+	c.reads++
+	return c.FakeCompute.ReadSecurityGroups(request)
+}
+
+func TestSecurityGroupCache(t *testing.T) {
+	calls := 0
+	var fetchErr error
+	fetch := func() (map[string]osc.SecurityGroup, error) {
+		calls++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return map[string]osc.SecurityGroup{"sg-1": {SecurityGroupId: aws.String("sg-1")}}, nil
+	}
+
+	disabled := newSecurityGroupCache(0)
+	_, _ = disabled.get(fetch)
+	_, _ = disabled.get(fetch)
+	assert.Equal(t, 2, calls, "a disabled cache should always fetch")
+
+	calls = 0
+	cache := newSecurityGroupCache(time.Hour)
+	groups, err := cache.get(fetch)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 1)
+	delete(groups, "sg-1")
+	groups, _ = cache.get(fetch)
+	assert.Len(t, groups, 1, "the callers should not modify the cache")
+	assert.Equal(t, 1, calls, "security groups should be served from the cache")
+
+	cache.invalidate()
+	fetchErr = errors.New("boom")
+	_, err = cache.get(fetch)
+	assert.Error(t, err)
+	fetchErr = nil
+	_, err = cache.get(fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls, "errors should not be cached")
+
+	assert.NoError(t, cache.refresh(fetch))
+	_, _ = cache.get(fetch)
+	assert.Equal(t, 4, calls, "a refreshed cache should not fetch again")
+}
+
+func TestSecurityGroupCacheInvalidation(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	compute := &countingSecurityGroupCompute{FakeCompute: awsServices.compute}
+	awsServices.compute = compute
+	cfg := CloudConfig{}
+	cfg.Global.SecurityGroupCacheTTLSeconds = 3600
+	c, err := newCloud(cfg, awsServices)
+	require.NoError(t, err)
+
+	groups, err := c.securityGroupService.getTaggedSecurityGroups()
+	require.NoError(t, err)
+	assert.Contains(t, groups, "sg-1234")
+	_, _ = c.securityGroupService.getTaggedSecurityGroups()
+	assert.Equal(t, 1, compute.reads)
+
+	// Tagging a VM doesn't modify the security groups
+	_, err = c.compute.CreateTags(&osc.CreateTagsRequest{ResourceIds: []string{"i-self"}, DryRun: aws.Bool(true)})
+	require.NoError(t, err)
+	_, _ = c.securityGroupService.getTaggedSecurityGroups()
+	assert.Equal(t, 1, compute.reads)
+
+	_, err = c.compute.CreateTags(&osc.CreateTagsRequest{ResourceIds: []string{"sg-1234"}, DryRun: aws.Bool(true)})
+	require.NoError(t, err)
+	_, _ = c.securityGroupService.getTaggedSecurityGroups()
+	assert.Equal(t, 2, compute.reads)
+
+	_, err = c.compute.CreateSecurityGroupRule(&osc.CreateSecurityGroupRuleRequest{SecurityGroupId: "sg-1234", DryRun: aws.Bool(true)})
+	require.NoError(t, err)
+	_, _ = c.securityGroupService.getTaggedSecurityGroups()
+	assert.Equal(t, 3, compute.reads)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Security Group Garbage Collection *********************
+
+const (
+	// securityGroupGCInterval is how often the deletion of the security groups tagged
+	// TagNameSecurityGroupDeletion is retried
+	securityGroupGCInterval = 30 * time.Second
+	// securityGroupGCWarningDelay is how long a security group may wait for its deletion
+	// before a warning is logged on each attempt
+	securityGroupGCWarningDelay = time.Hour
+)
+
+// isSecurityGroupInUse returns whether the deletion of a security group failed because it
+// is still used, e.g. by a load balancer being deleted in the background
+func isSecurityGroupInUse(err error) bool {
+	return strings.Contains(err.Error(), "Conflict")
+}
+
+// deleteLoadBalancerSecurityGroups deletes the security groups of a deleted load balancer.
+// The load balancer disappears from the API immediately but is still deleting in the
+// background, so its security groups may still be in use: they are tagged
+// TagNameSecurityGroupDeletion and deleted by the securityGroupGC, instead of blocking the
+// deletion of the service.
+func (c *Cloud) deleteLoadBalancerSecurityGroups(serviceName string, securityGroupIDs []string) error {
+	klog.V(5).Infof("deleteLoadBalancerSecurityGroups(%v, %v)", serviceName, securityGroupIDs)
+	for _, securityGroupID := range securityGroupIDs {
+		securityGroupID := securityGroupID
+		_, err := c.compute.DeleteSecurityGroup(&osc.DeleteSecurityGroupRequest{SecurityGroupId: &securityGroupID})
+		if err == nil {
+			continue
+		}
+		if !isSecurityGroupInUse(err) {
+			return fmt.Errorf("error while deleting load balancer security group (%s): %q", securityGroupID, err)
+		}
+
+		klog.V(2).Infof("Load balancer security group %s of %s still in use, deleting it in the background", securityGroupID, serviceName)
+		_, err = c.compute.CreateTags(&osc.CreateTagsRequest{
+			ResourceIds: []string{securityGroupID},
+			Tags: []osc.ResourceTag{{
+				Key:   TagNameSecurityGroupDeletion,
+				Value: time.Now().UTC().Format(time.RFC3339),
+			}},
+		})
+		if err != nil {
+			return fmt.Errorf("error marking load balancer security group (%s) for deletion: %q", securityGroupID, err)
+		}
+	}
+	klog.V(2).Info("Deleted or marked for deletion all security groups for load balancer: ", serviceName)
+	return nil
+}
+
+// cancelSecurityGroupDeletion removes the TagNameSecurityGroupDeletion tag of a security group
+// reused before its deletion, e.g. by a service recreated with the same load balancer name
+func (s *securityGroupService) cancelSecurityGroupDeletion(group *osc.SecurityGroup) error {
+	for _, tag := range group.GetTags() {
+		if tag.GetKey() != TagNameSecurityGroupDeletion {
+			continue
+		}
+		klog.V(2).Infof("Security group %s is reused, cancelling its deletion", group.GetSecurityGroupId())
+		_, err := s.compute.DeleteTags(&osc.DeleteTagsRequest{
+			ResourceIds: []string{group.GetSecurityGroupId()},
+			Tags:        []osc.ResourceTag{tag},
+		})
+		if err != nil {
+			return fmt.Errorf("error cancelling the deletion of security group %s: %q", group.GetSecurityGroupId(), err)
+		}
+	}
+	return nil
+}
+
+// securityGroupGC deletes in the background the security groups of the cluster tagged
+// TagNameSecurityGroupDeletion, until they are no longer in use. The pending deletions are
+// read from the tags, so they survive the restarts of the CCM.
+type securityGroupGC struct {
+	cloud      *Cloud
+	interval   time.Duration
+	timeSource func() time.Time
+}
+
+func newSecurityGroupGC(cloud *Cloud, interval time.Duration) *securityGroupGC {
+	return &securityGroupGC{
+		cloud:      cloud,
+		interval:   interval,
+		timeSource: time.Now,
+	}
+}
+
+// run deletes the security groups waiting for deletion every interval until stop is closed
+func (g *securityGroupGC) run(stop <-chan struct{}) {
+	if g == nil || g.interval <= 0 {
+		return
+	}
+
+	klog.Infof("Starting security group garbage collection (interval %v)", g.interval)
+	go wait.Until(g.sync, g.interval, stop)
+}
+
+// sync deletes the security groups of the cluster waiting for deletion
+func (g *securityGroupGC) sync() {
+	c := g.cloud
+	groups, err := c.compute.ReadSecurityGroups(&osc.ReadSecurityGroupsRequest{
+		Filters: &osc.FiltersSecurityGroup{
+			TagKeys: &[]string{TagNameSecurityGroupDeletion},
+		},
+	})
+	if err != nil {
+		klog.Warningf("Unable to list the security groups waiting for deletion: %q", err)
+		return
+	}
+
+	for _, group := range groups {
+		groupID := group.GetSecurityGroupId()
+		if groupID == "" || groupID == c.cfg.Global.ElbSecurityGroup || isSelectedSecurityGroup(group.Tags) ||
+			(!c.tagging.hasClusterTag(group.Tags) && !c.tagging.isManagedBy(group.Tags)) {
+			continue
+		}
+		requested := ""
+		for _, tag := range group.GetTags() {
+			if tag.GetKey() == TagNameSecurityGroupDeletion {
+				requested = tag.GetValue()
+			}
+		}
+
+		_, err := c.compute.DeleteSecurityGroup(&osc.DeleteSecurityGroupRequest{SecurityGroupId: &groupID})
+		if err == nil {
+			klog.Infof("Deleted security group %s (deletion requested at %s)", groupID, requested)
+			continue
+		}
+		requestedAt, parseErr := time.Parse(time.RFC3339, requested)
+		if isSecurityGroupInUse(err) && (parseErr != nil || g.timeSource().Sub(requestedAt) < securityGroupGCWarningDelay) {
+			klog.V(2).Infof("Security group %s still in use, will retry its deletion", groupID)
+			continue
+		}
+		klog.Warningf("Unable to delete security group %s (deletion requested at %s): %q", groupID, requested, err)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityGroupGC(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	compute := awsServices.compute.(*FakeComputeImpl)
+
+	clusterTag := osc.ResourceTag{Key: fmt.Sprintf("%s%s", TagNameKubernetesClusterPrefix, TestClusterID), Value: ResourceLifecycleOwned}
+	compute.SecurityGroups = []osc.SecurityGroup{
+		{SecurityGroupId: aws.String("sg-free"), Tags: &[]osc.ResourceTag{clusterTag}},
+		{SecurityGroupId: aws.String("sg-used"), Tags: &[]osc.ResourceTag{clusterTag}},
+		{SecurityGroupId: aws.String("sg-other"), Tags: &[]osc.ResourceTag{{Key: TagNameSecurityGroupDeletion, Value: "2023-01-01T00:00:00Z"}}},
+	}
+	compute.DeleteSecurityGroupErrors = map[string]error{"sg-used": errors.New("409 Conflict")}
+
+	// The security groups still in use don't block the deletion
+	require.NoError(t, c.deleteLoadBalancerSecurityGroups("web", []string{"sg-free", "sg-used"}))
+	assert.Equal(t, []string{"sg-free"}, compute.DeletedSecurityGroups)
+	groups, err := compute.ReadSecurityGroups(&osc.ReadSecurityGroupsRequest{Filters: &osc.FiltersSecurityGroup{
+		TagKeys: &[]string{TagNameSecurityGroupDeletion},
+	}})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, "sg-used", groups[0].GetSecurityGroupId())
+
+	compute.DeleteSecurityGroupErrors["sg-free"] = errors.New("500 Internal Error")
+	compute.SecurityGroups = append(compute.SecurityGroups, osc.SecurityGroup{SecurityGroupId: aws.String("sg-free")})
+	assert.Error(t, c.deleteLoadBalancerSecurityGroups("web", []string{"sg-free"}))
+
+	// The garbage collector retries until the security group is no longer in use, and
+	// ignores the security groups of the other clusters
+	gc := newSecurityGroupGC(c, securityGroupGCInterval)
+	gc.sync()
+	assert.Equal(t, []string{"sg-free"}, compute.DeletedSecurityGroups)
+	delete(compute.DeleteSecurityGroupErrors, "sg-used")
+	gc.sync()
+	assert.Equal(t, []string{"sg-free", "sg-used"}, compute.DeletedSecurityGroups)
+	gc.sync()
+	assert.Equal(t, []string{"sg-free", "sg-used"}, compute.DeletedSecurityGroups)
+
+	// The security groups selected by a service are never deleted
+	compute.SecurityGroups = append(compute.SecurityGroups, osc.SecurityGroup{SecurityGroupId: aws.String("sg-selected"), Tags: &[]osc.ResourceTag{
+		clusterTag,
+		{Key: TagNameSecurityGroupDeletion, Value: "2023-01-01T00:00:00Z"},
+		{Key: TagNameSecurityGroupSelected, Value: "true"},
+	}})
+	gc.sync()
+	assert.Equal(t, []string{"sg-free", "sg-used"}, compute.DeletedSecurityGroups)
+}
+
+func TestCancelSecurityGroupDeletion(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	compute := awsServices.compute.(*FakeComputeImpl)
+	compute.SecurityGroups = []osc.SecurityGroup{{
+		SecurityGroupId: aws.String("sg-reused"),
+		Tags:            &[]osc.ResourceTag{{Key: TagNameSecurityGroupDeletion, Value: "2023-01-01T00:00:00Z"}},
+	}}
+
+	require.NoError(t, c.securityGroupService.(*securityGroupService).cancelSecurityGroupDeletion(&compute.SecurityGroups[0]))
+	assert.Empty(t, compute.SecurityGroups[0].GetTags())
+}
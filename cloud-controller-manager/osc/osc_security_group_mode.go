@@ -0,0 +1,187 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Security Group Mode *********************
+
+// securityGroupMode tells how the CCM manages the security groups of a load balancer
+type securityGroupMode string
+
+const (
+	// securityGroupModeManaged creates a security group per load balancer, deleted with it
+	securityGroupModeManaged securityGroupMode = "managed"
+	// securityGroupModeShared uses a security group shared by the load balancers of the
+	// cluster, opening the ports of all of them
+	securityGroupModeShared securityGroupMode = "shared"
+	// securityGroupModeNone never creates, modifies or deletes security groups: they are
+	// set with the ServiceAnnotationLoadBalancerSecurityGroups annotation
+	securityGroupModeNone securityGroupMode = "none"
+)
+
+// parseSecurityGroupMode parses a security group mode, empty meaning managed
+func parseSecurityGroupMode(value string) (securityGroupMode, error) {
+	switch mode := securityGroupMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return securityGroupModeManaged, nil
+	case securityGroupModeManaged, securityGroupModeShared, securityGroupModeNone:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown security group mode %q, expected managed, shared or none", value)
+	}
+}
+
+// securityGroupMode returns the security group mode of the service, defaulting to the
+// SecurityGroupMode of the cloud config
+func (c *Cloud) securityGroupMode(annotations map[string]string) (securityGroupMode, error) {
+	if value, found := annotations[ServiceAnnotationLoadBalancerSecurityGroupMode]; found {
+		mode, err := parseSecurityGroupMode(value)
+		if err != nil {
+			return "", fmt.Errorf("error parsing service annotation %s=%s: %v", ServiceAnnotationLoadBalancerSecurityGroupMode, value, err)
+		}
+		return mode, nil
+	}
+	return parseSecurityGroupMode(c.cfg.Global.SecurityGroupMode)
+}
+
+// sharedSecurityGroupName returns the name of the security group shared by the load
+// balancers of the cluster. It does not start with k8s-elb- like the security groups of
+// the managed mode, which are deleted with their load balancer.
+func (c *Cloud) sharedSecurityGroupName() string {
+	return c.tagging.prefixedName("k8s-shared-elb")
+}
+
+// ensureSharedSecurityGroup returns the id of the security group shared by the load
+// balancers of the cluster, creating it when needed
+func (c *Cloud) ensureSharedSecurityGroup() (string, error) {
+	klog.V(5).Infof("ensureSharedSecurityGroup()")
+	description := fmt.Sprintf("Security group shared by the Kubernetes ELBs of cluster %s", c.tagging.clusterID())
+	securityGroupID, _, err := c.securityGroupService.ensureSecurityGroup(c.sharedSecurityGroupName(), description, nil, nil)
+	return securityGroupID, err
+}
+
+// findSharedSecurityGroup returns the id of the shared security group when it is one of the
+// security groups, or an empty string
+func (c *Cloud) findSharedSecurityGroup(securityGroupIDs []string) (string, error) {
+	klog.V(5).Infof("findSharedSecurityGroup(%v)", securityGroupIDs)
+	if len(securityGroupIDs) == 0 || c.vpcID == "" {
+		return "", nil
+	}
+	groups, err := c.compute.ReadSecurityGroups(&osc.ReadSecurityGroupsRequest{
+		Filters: &osc.FiltersSecurityGroup{
+			SecurityGroupIds:   &securityGroupIDs,
+			SecurityGroupNames: &[]string{c.sharedSecurityGroupName()},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error querying security groups for ELB: %q", err)
+	}
+	for _, group := range groups {
+		if group.GetSecurityGroupName() == c.sharedSecurityGroupName() && Contains(securityGroupIDs, group.GetSecurityGroupId()) {
+			return group.GetSecurityGroupId(), nil
+		}
+	}
+	return "", nil
+}
+
+// loadBalancerIngressRules returns the rules of the load balancer security group opening
+// the ports of the service and its extra listeners to the source ranges
+func loadBalancerIngressRules(service *v1.Service, sourceRanges []string, extraListeners []extraListenerRange) IPRulesSet {
+	permissions := NewIPRulesSet()
+	for _, port := range service.Spec.Ports {
+
+		protocol := securityGroupRuleProtocol(port.Protocol)
+
+		permission := osc.SecurityGroupRule{}
+		permission.SetFromPortRange(port.Port)
+		permission.SetToPortRange(port.Port)
+		permission.SetIpRanges(sourceRanges)
+		permission.SetIpProtocol(protocol)
+
+		permissions.Insert(permission)
+	}
+	for _, extraListener := range extraListeners {
+		permissions.Insert(extraListener.ingressRule(sourceRanges))
+	}
+
+	// Allow ICMP fragmentation packets, important for MTU discovery
+	{
+		fromPort := int32(3)
+		toPort := int32(4)
+		permission := osc.SecurityGroupRule{
+			IpProtocol:    aws.String("icmp"),
+			FromPortRange: &fromPort,
+			ToPortRange:   &toPort,
+			IpRanges:      &sourceRanges,
+		}
+
+		permissions.Insert(permission)
+	}
+	return permissions
+}
+
+// sharedSecurityGroupIngress adds to the rules those of the other services using the shared
+// security group, so that the ingress of the shared group opens the ports of all of them
+func (c *Cloud) sharedSecurityGroupIngress(serviceName types.NamespacedName, rules IPRulesSet) (IPRulesSet, error) {
+	klog.V(5).Infof("sharedSecurityGroupIngress(%v,%v)", serviceName, rules.List())
+	if c.kubeClient == nil {
+		return rules, nil
+	}
+	services, err := c.kubeClient.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the services sharing the load balancer security group: %v", err)
+	}
+
+	for i := range services.Items {
+		service := &services.Items[i]
+		annotations := c.loadBalancerAnnotations(service)
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil ||
+			!c.managesLoadBalancerClass(service) ||
+			(types.NamespacedName{Namespace: service.Namespace, Name: service.Name}) == serviceName ||
+			annotations[ServiceAnnotationLoadBalancerSecurityGroups] != "" ||
+			annotations[ServiceAnnotationLoadBalancerSecurityGroupSelector] != "" {
+			continue
+		}
+		if mode, err := c.securityGroupMode(annotations); err != nil || mode != securityGroupModeShared {
+			continue
+		}
+
+		sourceRanges, err := c.loadBalancerSourceRanges(service, annotations)
+		if err != nil {
+			klog.Warningf("Ignoring the source ranges of service %s/%s: %q", service.Namespace, service.Name, err)
+			continue
+		}
+		extraListeners, err := parseExtraListeners(annotations[ServiceAnnotationLoadBalancerExtraListeners])
+		if err != nil {
+			extraListeners = nil
+		}
+		rules.Insert(loadBalancerIngressRules(service, sourceRanges.StringSlice(), extraListeners).List()...)
+	}
+	return rules, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecurityGroupMode(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	mode, err := c.securityGroupMode(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, securityGroupModeManaged, mode)
+
+	c.cfg.Global.SecurityGroupMode = "shared"
+	mode, err = c.securityGroupMode(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, securityGroupModeShared, mode)
+
+	mode, err = c.securityGroupMode(map[string]string{ServiceAnnotationLoadBalancerSecurityGroupMode: "None"})
+	assert.NoError(t, err)
+	assert.Equal(t, securityGroupModeNone, mode)
+
+	_, err = c.securityGroupMode(map[string]string{ServiceAnnotationLoadBalancerSecurityGroupMode: "terraform"})
+	assert.Error(t, err)
+}
+
+func TestBuildELBSecurityGroupListWithoutManagement(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+	_, err = c.buildELBSecurityGroupList(service, "lb-web", map[string]string{
+		ServiceAnnotationLoadBalancerSecurityGroupMode: "none",
+	})
+	assert.Error(t, err, "the security groups must be provided")
+
+	securityGroupIDs, err := c.buildELBSecurityGroupList(service, "lb-web", map[string]string{
+		ServiceAnnotationLoadBalancerSecurityGroupMode: "none",
+		ServiceAnnotationLoadBalancerSecurityGroups:    "sg-0000000a",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sg-0000000a"}, securityGroupIDs)
+}
+
+func TestSharedSecurityGroupIngress(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	loadBalancerService := func(name string, port int32, annotations map[string]string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations},
+			Spec: v1.ServiceSpec{
+				Type:  v1.ServiceTypeLoadBalancer,
+				Ports: []v1.ServicePort{{Port: port, Protocol: v1.ProtocolTCP}},
+			},
+		}
+	}
+	shared := map[string]string{ServiceAnnotationLoadBalancerSecurityGroupMode: "shared"}
+	web := loadBalancerService("web", 80, shared)
+	c.kubeClient = fake.NewSimpleClientset(
+		web,
+		loadBalancerService("api", 443, shared),
+		loadBalancerService("managed", 8080, nil),
+	)
+
+	rules, err := c.sharedSecurityGroupIngress(types.NamespacedName{Namespace: "default", Name: "web"},
+		loadBalancerIngressRules(web, []string{"10.0.0.0/8"}, nil))
+	assert.NoError(t, err)
+	apiRules := loadBalancerIngressRules(loadBalancerService("api", 443, nil), []string{"0.0.0.0/0"}, nil)
+	expected := loadBalancerIngressRules(web, []string{"10.0.0.0/8"}, nil)
+	expected.Insert(apiRules.List()...)
+	assert.ElementsMatch(t, expected.List(), rules.List())
+
+	// Once the service is deleted, only the rules of the other services are kept
+	rules, err = c.sharedSecurityGroupIngress(types.NamespacedName{Namespace: "default", Name: "web"}, NewIPRulesSet())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, apiRules.List(), rules.List())
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Security Group Pool *********************
+
+// securityGroupPoolInterval is how often the warm pool is refilled
+const securityGroupPoolInterval = 30 * time.Second
+
+// securityGroupPoolQuietPeriod is how long no load balancer must have been reconciled before
+// the warm pool is refilled
+const securityGroupPoolQuietPeriod = 5 * time.Second
+
+// securityGroupPool keeps security groups of the cluster pre-created and tagged in the Net of
+// the nodes, refilled once no load balancer has been reconciled for a quiet period. The
+// security group of a new load balancer is leased from the pool instead of being created,
+// tagged and waited for. As the names of the security groups can't be changed, a leased
+// security group is tagged TagNameSecurityGroupLease with the name of the load balancer
+// security group it stands for.
+type securityGroupPool struct {
+	cloud *Cloud
+	size  int
+
+	// Serializes the leases and the refills
+	mutex sync.Mutex
+	// When the pool was last refilled, see tick
+	refilledAt time.Time
+}
+
+func newSecurityGroupPool(cloud *Cloud, size int) *securityGroupPool {
+	return &securityGroupPool{cloud: cloud, size: size}
+}
+
+// run refills the pool every securityGroupPoolInterval until stop is closed. A disabled pool
+// is emptied once.
+func (p *securityGroupPool) run(stop <-chan struct{}) {
+	if p == nil {
+		return
+	}
+	if p.size <= 0 {
+		go p.refill()
+		return
+	}
+
+	klog.Infof("Starting the warm pool of %d security groups", p.size)
+	go wait.Until(p.tick, securityGroupPoolQuietPeriod, stop)
+}
+
+// tick refills the pool when securityGroupPoolInterval elapsed since the last refill and no
+// load balancer has been reconciled for securityGroupPoolQuietPeriod, the refill being
+// otherwise postponed to the next tick
+func (p *securityGroupPool) tick() {
+	if time.Since(p.refilledAt) < securityGroupPoolInterval {
+		return
+	}
+	if !p.cloud.shutdown.quiet(securityGroupPoolQuietPeriod) {
+		klog.V(4).Info("Load balancers are being reconciled, postponing the refill of the security group pool")
+		return
+	}
+	if p.refill() {
+		p.refilledAt = time.Now()
+	}
+}
+
+// name returns a new name of a security group of the pool. It does not start with k8s-elb-
+// like the security groups of the load balancers, so that the orphan sweeper ignores the
+// security groups waiting to be leased.
+func (p *securityGroupPool) name() string {
+	return p.cloud.tagging.prefixedName("k8s-sg-pool-" + rand.String(10))
+}
+
+// available returns the security groups of the pool waiting to be leased, the oldest first
+func (p *securityGroupPool) available() ([]osc.SecurityGroup, error) {
+	c := p.cloud
+	request := osc.ReadSecurityGroupsRequest{
+		Filters: &osc.FiltersSecurityGroup{
+			TagKeys: &[]string{TagNameSecurityGroupPool},
+		},
+	}
+	if c.vpcID != "" {
+		request.Filters.NetIds = &[]string{c.vpcID}
+	}
+	groups, err := c.compute.ReadSecurityGroups(&request)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the security groups of the pool: %q", err)
+	}
+
+	available := make([]osc.SecurityGroup, 0, len(groups))
+	for _, group := range groups {
+		// A security group whose lease was interrupted is no longer available
+		if _, leased := findTag(group.Tags, TagNameSecurityGroupLease); !leased && c.tagging.hasClusterTag(group.Tags) {
+			available = append(available, group)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool {
+		created := func(group osc.SecurityGroup) string {
+			value, _ := findTag(group.Tags, TagNameSecurityGroupPool)
+			return value
+		}
+		return created(available[i]) < created(available[j])
+	})
+	return available, nil
+}
+
+// refill creates the missing security groups of the pool, or deletes the newest ones beyond
+// its size. It returns false when it failed or was interrupted by the reconciliation of a
+// load balancer.
+func (p *securityGroupPool) refill() bool {
+	c := p.cloud
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	available, err := p.available()
+	if err != nil {
+		klog.Warningf("Unable to refill the security group pool: %v", err)
+		return false
+	}
+	for i := len(available) - 1; i >= p.size && i >= 0; i-- {
+		groupID := available[i].GetSecurityGroupId()
+		if _, err := c.compute.DeleteSecurityGroup(&osc.DeleteSecurityGroupRequest{SecurityGroupId: &groupID}); err != nil {
+			klog.Warningf("Unable to delete security group %s beyond the size of the pool: %q", groupID, err)
+			return false
+		}
+		klog.V(2).Infof("Deleted security group %s beyond the size of the pool", groupID)
+	}
+	for i := len(available); i < p.size; i++ {
+		if c.shutdown.busy() {
+			return false
+		}
+		if err := p.create(); err != nil {
+			klog.Warningf("Unable to refill the security group pool: %v", err)
+			return false
+		}
+	}
+	return true
+}
+
+// create creates a security group of the pool
+func (p *securityGroupPool) create() error {
+	c := p.cloud
+	name := p.name()
+	request := osc.CreateSecurityGroupRequest{
+		SecurityGroupName: name,
+		Description:       fmt.Sprintf("Security group pool of Kubernetes cluster %s", c.tagging.clusterID()),
+	}
+	if c.vpcID != "" {
+		request.SetNetId(c.vpcID)
+	}
+	response, err := c.compute.CreateSecurityGroup(&request)
+	if err != nil {
+		return fmt.Errorf("error creating security group %s: %q", name, err)
+	}
+	groupID := response.SecurityGroup.GetSecurityGroupId()
+	err = c.tagging.createTags(c.compute, groupID, ResourceLifecycleOwned,
+		map[string]string{TagNameSecurityGroupPool: time.Now().UTC().Format(time.RFC3339)})
+	if err != nil {
+		// Without the TagNameSecurityGroupPool tag, the security group would leak
+		if _, deleteErr := c.compute.DeleteSecurityGroup(&osc.DeleteSecurityGroupRequest{SecurityGroupId: &groupID}); deleteErr != nil {
+			klog.Warningf("Unable to delete the untagged security group %s of the pool: %q", groupID, deleteErr)
+		}
+		return fmt.Errorf("error tagging security group %s: %q", groupID, err)
+	}
+	klog.V(2).Infof("Created security group %s (%s) in the pool", groupID, name)
+	return nil
+}
+
+// lease leases a security group of the pool to the load balancer security group named name,
+// tagging it with the tags of the load balancer. It returns an empty ID when the pool is
+// disabled or empty, the security group being then created on demand.
+func (p *securityGroupPool) lease(name string, tagging *resourceTagging, additionalTags map[string]string) (string, error) {
+	if p == nil || p.size <= 0 || !strings.HasPrefix(name, p.cloud.tagging.prefixedName("k8s-elb-")) ||
+		(tagging != nil && tagging.clusterID() != p.cloud.tagging.clusterID()) {
+		// The pool only holds the security groups of the load balancers owned by the cluster
+		return "", nil
+	}
+	c := p.cloud
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	available, err := p.available()
+	if err != nil {
+		return "", err
+	}
+	if len(available) == 0 {
+		klog.V(2).Infof("The security group pool is empty, creating security group %s", name)
+		return "", nil
+	}
+	group := available[0]
+	groupID := group.GetSecurityGroupId()
+	tags := map[string]string{TagNameSecurityGroupLease: name}
+	for key, value := range additionalTags {
+		tags[key] = value
+	}
+	if err := c.tagging.createTags(c.compute, groupID, ResourceLifecycleOwned, tags); err != nil {
+		return "", fmt.Errorf("error leasing security group %s: %q", groupID, err)
+	}
+	_, err = c.compute.DeleteTags(&osc.DeleteTagsRequest{
+		ResourceIds: []string{groupID},
+		Tags:        []osc.ResourceTag{{Key: TagNameSecurityGroupPool}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error removing security group %s from the pool: %q", groupID, err)
+	}
+	klog.V(2).Infof("Leased security group %s (%s) of the pool for %s", groupID, group.GetSecurityGroupName(), name)
+	return groupID, nil
+}
+
+// loadBalancerSecurityGroupName returns the name of the load balancer security group the
+// security group stands for: the TagNameSecurityGroupLease tag of a security group leased
+// from the pool, or else its name
+func loadBalancerSecurityGroupName(group *osc.SecurityGroup) string {
+	if name, found := findTag(group.Tags, TagNameSecurityGroupLease); found {
+		return name
+	}
+	return group.GetSecurityGroupName()
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestSecurityGroupPoolDisabled(t *testing.T) {
+	var unset *securityGroupPool
+	unset.run(make(chan struct{}))
+	groupID, err := unset.lease("k8s-elb-web", nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, groupID)
+
+	groupID, err = newSecurityGroupPool(&Cloud{}, 0).lease("k8s-elb-web", nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, groupID)
+}
+
+func TestLoadBalancerSecurityGroupName(t *testing.T) {
+	group := osc.SecurityGroup{SecurityGroupName: osc.PtrString("k8s-elb-web")}
+	assert.Equal(t, "k8s-elb-web", loadBalancerSecurityGroupName(&group))
+	group.SecurityGroupName = osc.PtrString("k8s-sg-pool-abc")
+	group.Tags = &[]osc.ResourceTag{{Key: TagNameSecurityGroupLease, Value: "k8s-elb-web"}}
+	assert.Equal(t, "k8s-elb-web", loadBalancerSecurityGroupName(&group))
+}
+
+func TestSecurityGroupPool(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	c.securityGroupPool = newSecurityGroupPool(c, 1)
+	c.securityGroupService.(*securityGroupService).pool = c.securityGroupPool
+
+	c.securityGroupPool.refill()
+	available, err := c.securityGroupPool.available()
+	require.NoError(t, err)
+	require.Len(t, available, 1)
+	pooled := available[0].GetSecurityGroupId()
+	assert.True(t, c.tagging.hasClusterTag(available[0].Tags))
+
+	// The pool is full
+	created := s.Calls("CreateSecurityGroup")
+	c.securityGroupPool.refill()
+	assert.Equal(t, created, s.Calls("CreateSecurityGroup"))
+
+	// The security group of a new load balancer is leased from the pool
+	web := newFakeAPIService("web")
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, web, []*v1.Node{node})
+	require.NoError(t, err)
+	assert.Equal(t, created, s.Calls("CreateSecurityGroup"))
+	lb, found := s.LoadBalancer(c.GetLoadBalancerName(context.TODO(), TestClusterName, web))
+	require.True(t, found)
+	assert.Equal(t, []string{pooled}, aws.StringValueSlice(lb.SecurityGroups))
+	group, found := s.SecurityGroup(pooled)
+	require.True(t, found)
+	lease, _ := findTag(group.Tags, TagNameSecurityGroupLease)
+	assert.Equal(t, c.tagging.prefixedName("k8s-elb-"+aws.StringValue(lb.LoadBalancerName)), lease)
+	_, pooledTag := findTag(group.Tags, TagNameSecurityGroupPool)
+	assert.False(t, pooledTag)
+	serviceTag, _ := findTag(group.Tags, TagNameKubernetesService)
+	assert.Equal(t, "default/web", serviceTag)
+
+	// The leased security group is found again by its lease
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, web, []*v1.Node{node})
+	require.NoError(t, err)
+	assert.Equal(t, created, s.Calls("CreateSecurityGroup"))
+
+	// The security group is created on demand when the pool is empty
+	api := newFakeAPIService("api")
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, api, []*v1.Node{node})
+	require.NoError(t, err)
+	assert.Equal(t, created+1, s.Calls("CreateSecurityGroup"))
+
+	// The leased security group is deleted with its load balancer
+	require.NoError(t, c.EnsureLoadBalancerDeleted(context.TODO(), TestClusterName, web))
+	_, found = s.SecurityGroup(pooled)
+	assert.False(t, found)
+}
+
+func TestSecurityGroupPoolResize(t *testing.T) {
+	c, s, _ := newFakeAPICloud(t)
+	c.securityGroupPool = newSecurityGroupPool(c, 3)
+	deleted := s.Calls("DeleteSecurityGroup")
+	assert.True(t, c.securityGroupPool.refill())
+	available, err := c.securityGroupPool.available()
+	require.NoError(t, err)
+	require.Len(t, available, 3)
+
+	// The newest security groups beyond a lowered size are deleted
+	c.securityGroupPool.size = 1
+	assert.True(t, c.securityGroupPool.refill())
+	remaining, err := c.securityGroupPool.available()
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, available[0].GetSecurityGroupId(), remaining[0].GetSecurityGroupId())
+
+	// A disabled pool is emptied
+	c.securityGroupPool.size = 0
+	assert.True(t, c.securityGroupPool.refill())
+	remaining, err = c.securityGroupPool.available()
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+	assert.Equal(t, deleted+3, s.Calls("DeleteSecurityGroup"))
+}
+
+func TestSecurityGroupPoolQuietPeriod(t *testing.T) {
+	c, s, _ := newFakeAPICloud(t)
+	c.securityGroupPool = newSecurityGroupPool(c, 1)
+	c.shutdown = newShutdownManager(c, 0)
+	created := s.Calls("CreateSecurityGroup")
+
+	// The refill is postponed while a load balancer is being reconciled, and until the
+	// quiet period elapsed
+	end, err := c.shutdown.begin(newFakeAPIService("web"), "web")
+	require.NoError(t, err)
+	c.securityGroupPool.tick()
+	assert.Equal(t, created, s.Calls("CreateSecurityGroup"))
+	end(nil)
+	c.securityGroupPool.tick()
+	assert.Equal(t, created, s.Calls("CreateSecurityGroup"))
+
+	c.shutdown.idleSince = time.Now().Add(-securityGroupPoolQuietPeriod)
+	c.securityGroupPool.tick()
+	assert.Equal(t, created+1, s.Calls("CreateSecurityGroup"))
+}
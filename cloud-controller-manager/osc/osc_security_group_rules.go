@@ -0,0 +1,213 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Security Group Rule Ownership *********************
+
+// Security group rules have no description, so the rules created by the cloud provider
+// are marked in tags of their security group. A tag per rule would exhaust the tags of the
+// group, so the hashes of the marked rules are aggregated: the tags whose keys are a prefix
+// followed by an index hold up to ruleMarkersPerTag hashes separated by spaces.
+
+// ruleMarkersPerTag is the number of hashes held by a marker tag, whose value is limited to
+// 255 characters
+const ruleMarkersPerTag = 15
+
+// ruleHash returns the hash identifying the ungrouped rule in the markers
+func ruleHash(rule osc.SecurityGroupRule) string {
+	sum := sha256.Sum256([]byte(keyForIPRules(&rule)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ruleMarkerKey returns the key of the legacy tag marking the ungrouped rule alone
+func ruleMarkerKey(rule osc.SecurityGroupRule) string {
+	return TagNameRulePrefix + ruleHash(rule)
+}
+
+// ruleMarkers are the hashes of the rules marked in the tags of a security group
+type ruleMarkers struct {
+	prefix string
+	// keepFirst keeps the first tag when no rule is marked
+	keepFirst bool
+	hashes    map[string]bool
+	// Values of the tags holding the hashes by key, including the legacy tags
+	tags map[string]string
+}
+
+// readRuleMarkers returns the rules marked in the tags with keys starting with prefix. The
+// legacy tags marking a single rule, for which legacy returns the hash, are read too, to be
+// replaced by the next write.
+func readRuleMarkers(tags []osc.ResourceTag, prefix string, legacy func(tag osc.ResourceTag) (string, bool)) ruleMarkers {
+	markers := ruleMarkers{prefix: prefix, hashes: make(map[string]bool), tags: make(map[string]string)}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag.GetKey(), prefix) {
+			markers.tags[tag.GetKey()] = tag.GetValue()
+			for _, hash := range strings.Fields(tag.GetValue()) {
+				markers.hashes[hash] = true
+			}
+		} else if hash, ok := legacy(tag); ok {
+			markers.tags[tag.GetKey()] = tag.GetValue()
+			markers.hashes[hash] = true
+		}
+	}
+	return markers
+}
+
+// has returns whether the ungrouped rule is marked
+func (m *ruleMarkers) has(rule osc.SecurityGroupRule) bool {
+	return m.hashes[ruleHash(rule)]
+}
+
+// write marks exactly the rules of the hashes in the tags of the security group, the tags
+// no longer needed being deleted. With keepFirst, the first tag is kept even when no rule is
+// marked, so that the group is not taken for a group without markers.
+func (m *ruleMarkers) write(compute Compute, securityGroupID string, hashes map[string]bool) error {
+	sorted := make([]string, 0, len(hashes))
+	for hash := range hashes {
+		sorted = append(sorted, hash)
+	}
+	sort.Strings(sorted)
+	desired := make(map[string]string)
+	if m.keepFirst {
+		desired[m.prefix+"0"] = ""
+	}
+	for i := 0; i*ruleMarkersPerTag < len(sorted); i++ {
+		last := (i + 1) * ruleMarkersPerTag
+		if last > len(sorted) {
+			last = len(sorted)
+		}
+		desired[fmt.Sprintf("%s%d", m.prefix, i)] = strings.Join(sorted[i*ruleMarkersPerTag:last], " ")
+	}
+
+	created := []osc.ResourceTag{}
+	for key, value := range desired {
+		if current, found := m.tags[key]; !found || current != value {
+			created = append(created, osc.ResourceTag{Key: key, Value: value})
+		}
+	}
+	deleted := []osc.ResourceTag{}
+	for key := range m.tags {
+		if _, found := desired[key]; !found {
+			deleted = append(deleted, osc.ResourceTag{Key: key})
+		}
+	}
+	sort.Slice(created, func(i, j int) bool { return created[i].Key < created[j].Key })
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].Key < deleted[j].Key })
+
+	if len(created) > 0 {
+		if _, err := compute.CreateTags(&osc.CreateTagsRequest{ResourceIds: []string{securityGroupID}, Tags: created}); err != nil {
+			return fmt.Errorf("error marking the rules of security group %q: %q", securityGroupID, err)
+		}
+	}
+	if len(deleted) > 0 {
+		if _, err := compute.DeleteTags(&osc.DeleteTagsRequest{ResourceIds: []string{securityGroupID}, Tags: deleted}); err != nil {
+			return fmt.Errorf("error unmarking the rules of security group %q: %q", securityGroupID, err)
+		}
+	}
+	m.hashes = make(map[string]bool, len(hashes))
+	for hash := range hashes {
+		m.hashes[hash] = true
+	}
+	m.tags = desired
+	return nil
+}
+
+// rulesHashes returns the hashes of the ungrouped rules
+func rulesHashes(rules IPRulesSet) map[string]bool {
+	hashes := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		hashes[ruleHash(rule)] = true
+	}
+	return hashes
+}
+
+// securityGroupRuleOwnership tells the rules of a security group created by the cloud
+// provider from the rules added by other tools
+type securityGroupRuleOwnership struct {
+	markers ruleMarkers
+	// adopted tells the rules of the groups without markers, created by older versions of
+	// the cloud provider, which are adopted
+	adopted func(rule osc.SecurityGroupRule) bool
+}
+
+// ruleOwnership returns the ownership of the rules of the security group. The groups without
+// markers were reconciled by older versions of the cloud provider: all the rules of the
+// groups the cloud provider created are adopted, and the rules opened to security groups,
+// as to the load balancers, of the other groups of the cluster such as the node groups.
+func (s *securityGroupService) ruleOwnership(group *osc.SecurityGroup) securityGroupRuleOwnership {
+	ownership := securityGroupRuleOwnership{
+		markers: readRuleMarkers(group.GetTags(), TagNameRuleMarkersPrefix, func(tag osc.ResourceTag) (string, bool) {
+			if !strings.HasPrefix(tag.GetKey(), TagNameRulePrefix) {
+				return "", false
+			}
+			return strings.TrimPrefix(tag.GetKey(), TagNameRulePrefix), true
+		}),
+		adopted: func(osc.SecurityGroupRule) bool { return false },
+	}
+	ownership.markers.keepFirst = true
+	if len(ownership.markers.tags) > 0 {
+		return ownership
+	}
+	name := group.GetSecurityGroupName()
+	for _, prefix := range []string{"k8s-elb-", "k8s-shared-elb", "k8s-sg-pool-"} {
+		if strings.HasPrefix(name, s.tagging.prefixedName(prefix)) {
+			ownership.adopted = func(osc.SecurityGroupRule) bool { return true }
+			return ownership
+		}
+	}
+	if s.tagging.hasClusterTag(group.Tags) {
+		ownership.adopted = func(rule osc.SecurityGroupRule) bool { return len(rule.GetSecurityGroupsMembers()) > 0 }
+	}
+	return ownership
+}
+
+// owns returns whether the ungrouped rule was created by the cloud provider
+func (o securityGroupRuleOwnership) owns(rule osc.SecurityGroupRule) bool {
+	return o.markers.has(rule) || o.adopted(rule)
+}
+
+// markRules marks the ungrouped rules in the tags of the security group, besides the rules
+// already marked
+func (s *securityGroupService) markRules(securityGroupID string, ownership *securityGroupRuleOwnership, rules IPRulesSet) error {
+	klog.V(5).Infof("markRules(%v,%v)", securityGroupID, rules.List())
+	hashes := rulesHashes(rules)
+	for hash := range ownership.markers.hashes {
+		hashes[hash] = true
+	}
+	if len(hashes) == len(ownership.markers.hashes) {
+		return nil
+	}
+	return ownership.markers.write(s.compute, securityGroupID, hashes)
+}
+
+// unmarkRules marks exactly the owned ungrouped rules in the tags of the security group,
+// the legacy markers being replaced
+func (s *securityGroupService) unmarkRules(securityGroupID string, ownership *securityGroupRuleOwnership, owned IPRulesSet) error {
+	klog.V(5).Infof("unmarkRules(%v,%v)", securityGroupID, owned.List())
+	return ownership.markers.write(s.compute, securityGroupID, rulesHashes(owned))
+}
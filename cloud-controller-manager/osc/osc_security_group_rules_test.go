@@ -0,0 +1,230 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func tcpIngressRule(port int32, ipRange string) osc.SecurityGroupRule {
+	rule := osc.SecurityGroupRule{}
+	rule.SetIpProtocol("tcp")
+	rule.SetFromPortRange(port)
+	rule.SetToPortRange(port)
+	rule.SetIpRanges([]string{ipRange})
+	return rule
+}
+
+// markedRules returns the hashes of the rules marked in the security group, sorted
+func markedRules(group *osc.SecurityGroup) []string {
+	markers := readRuleMarkers(group.GetTags(), TagNameRuleMarkersPrefix, func(osc.ResourceTag) (string, bool) { return "", false })
+	hashes := []string{}
+	for hash := range markers.hashes {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+func newTestSecurityGroupService(t *testing.T, name string, rules ...osc.SecurityGroupRule) (*securityGroupService, *osc.SecurityGroup) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	tagging := &resourceTagging{}
+	assert.NoError(t, tagging.init("", TestClusterID))
+	group := awsServices.compute.(*FakeComputeImpl).MainSecurityGroup
+	group.SetSecurityGroupName(name)
+	group.SetInboundRules(rules)
+	return newSecurityGroupService(awsServices.compute, tagging, &cloudNetwork{}, "", 0, nil), group
+}
+
+func TestSetSecurityGroupIngressKeepsForeignRules(t *testing.T) {
+	ssh := tcpIngressRule(22, "10.0.0.0/8")
+	http := tcpIngressRule(80, "0.0.0.0/0")
+	https := tcpIngressRule(443, "0.0.0.0/0")
+	service, group := newTestSecurityGroupService(t, "shared", ssh)
+
+	changed, err := service.setSecurityGroupIngress("sg-1234", NewIPRulesSet(http))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, http}, group.GetInboundRules())
+	assert.Equal(t, []string{ruleHash(http)}, markedRules(group))
+
+	changed, err = service.setSecurityGroupIngress("sg-1234", NewIPRulesSet(https))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, https}, group.GetInboundRules())
+	assert.Equal(t, []string{ruleHash(https)}, markedRules(group))
+
+	changed, err = service.setSecurityGroupIngress("sg-1234", NewIPRulesSet(https))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// A foreign rule matching a desired rule is used but not adopted
+	changed, err = service.setSecurityGroupIngress("sg-1234", NewIPRulesSet(https, ssh))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, []string{ruleHash(https)}, markedRules(group))
+
+	changed, err = service.setSecurityGroupIngress("sg-1234", NewIPRulesSet())
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []osc.SecurityGroupRule{ssh}, group.GetInboundRules())
+	assert.Empty(t, markedRules(group))
+}
+
+func TestSetSecurityGroupIngressAdoptsLegacyRules(t *testing.T) {
+	ssh := tcpIngressRule(22, "10.0.0.0/8")
+	http := tcpIngressRule(80, "0.0.0.0/0")
+	service, group := newTestSecurityGroupService(t, "k8s-elb-legacy", ssh, http)
+
+	changed, err := service.setSecurityGroupIngress("sg-1234", NewIPRulesSet(http))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []osc.SecurityGroupRule{http}, group.GetInboundRules())
+	assert.Equal(t, []string{ruleHash(http)}, markedRules(group))
+
+	// Once marked, the rules added afterwards are foreign
+	group.SetInboundRules(append(group.GetInboundRules(), ssh))
+	changed, err = service.setSecurityGroupIngress("sg-1234", NewIPRulesSet(http))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{ssh, http}, group.GetInboundRules())
+}
+
+func TestIPRulesSetCompact(t *testing.T) {
+	member := osc.SecurityGroupRule{}
+	member.SetIpProtocol("-1")
+	member.SetSecurityGroupsMembers([]osc.SecurityGroupsMember{{SecurityGroupId: osc.PtrString("sg-0000000a")}})
+	rules := NewIPRulesSet(
+		tcpIngressRule(80, "10.0.0.0/8"),
+		tcpIngressRule(80, "192.168.0.0/16"),
+		tcpIngressRule(443, "10.0.0.0/8"),
+		member,
+	)
+
+	compacted := rules.Compact()
+	http := tcpIngressRule(80, "10.0.0.0/8")
+	http.SetIpRanges([]string{"10.0.0.0/8", "192.168.0.0/16"})
+	assert.ElementsMatch(t, []osc.SecurityGroupRule{http, tcpIngressRule(443, "10.0.0.0/8"), member}, compacted)
+	assert.Equal(t, compacted, rules.Compact(), "the compacted rules are sorted")
+	assert.Equal(t, rules, NewIPRulesSet(compacted...).Ungroup())
+}
+
+func TestSetSecurityGroupIngressRuleLimit(t *testing.T) {
+	ssh := tcpIngressRule(22, "10.0.0.0/8")
+	service, group := newTestSecurityGroupService(t, "shared", ssh)
+	service.ruleLimit = 3
+
+	// 2 ports opened to 3 ranges are 2 rules once compacted
+	permissions := NewIPRulesSet()
+	for _, port := range []int32{80, 443} {
+		for _, ipRange := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"} {
+			permissions.Insert(tcpIngressRule(port, ipRange))
+		}
+	}
+	changed, err := service.setSecurityGroupIngress("sg-1234", permissions)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, group.GetInboundRules(), 3)
+	assert.Equal(t, permissions.Union(NewIPRulesSet(ssh)), NewIPRulesSet(group.GetInboundRules()...).Ungroup())
+
+	// The foreign rules count toward the limit, and nothing is changed once exceeded
+	permissions.Insert(tcpIngressRule(8443, "10.0.0.0/8"))
+	_, err = service.setSecurityGroupIngress("sg-1234", permissions)
+	assert.EqualError(t, err, "security group sg-1234 would have 4 inbound rules, more than the limit of 3: reduce the source ranges or the ports of the load balancer")
+	assert.Len(t, group.GetInboundRules(), 3)
+	assert.Len(t, markedRules(group), 6)
+}
+
+func TestRuleMarkersAggregated(t *testing.T) {
+	service, group := newTestSecurityGroupService(t, "shared")
+	permissions := NewIPRulesSet()
+	for port := int32(1); port <= 40; port++ {
+		permissions.Insert(tcpIngressRule(port, "0.0.0.0/0"))
+	}
+
+	_, err := service.setSecurityGroupIngress("sg-1234", permissions)
+	assert.NoError(t, err)
+	assert.Len(t, group.GetInboundRules(), 40)
+	assert.Len(t, markedRules(group), 40)
+	// The 40 rules are marked in 3 tags besides the cluster tags
+	assert.Len(t, group.GetTags(), 5)
+	for _, tag := range group.GetTags() {
+		assert.LessOrEqual(t, len(tag.GetValue()), 255)
+	}
+
+	_, err = service.setSecurityGroupIngress("sg-1234", NewIPRulesSet(tcpIngressRule(1, "0.0.0.0/0")))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ruleHash(tcpIngressRule(1, "0.0.0.0/0"))}, markedRules(group))
+	assert.Len(t, group.GetTags(), 3)
+
+	// A group without rule left stays marked, its rules added afterwards being foreign
+	_, err = service.setSecurityGroupIngress("sg-1234", NewIPRulesSet())
+	assert.NoError(t, err)
+	assert.Empty(t, group.GetInboundRules())
+	group.SetSecurityGroupName("k8s-elb-emptied")
+	group.SetInboundRules([]osc.SecurityGroupRule{tcpIngressRule(22, "10.0.0.0/8")})
+	_, err = service.setSecurityGroupIngress("sg-1234", NewIPRulesSet())
+	assert.NoError(t, err)
+	assert.Len(t, group.GetInboundRules(), 1)
+}
+
+func TestRuleMarkersLegacyTags(t *testing.T) {
+	ssh := tcpIngressRule(22, "10.0.0.0/8")
+	http := tcpIngressRule(80, "0.0.0.0/0")
+	service, group := newTestSecurityGroupService(t, "shared", ssh, http)
+	group.SetTags(append(group.GetTags(), osc.ResourceTag{Key: ruleMarkerKey(http), Value: "tcp 80-80 from 0.0.0.0/0"}))
+
+	// The legacy marker of a rule is honored and replaced
+	_, err := service.setSecurityGroupIngress("sg-1234", NewIPRulesSet())
+	assert.NoError(t, err)
+	assert.Equal(t, []osc.SecurityGroupRule{ssh}, group.GetInboundRules())
+	for _, tag := range group.GetTags() {
+		assert.NotContains(t, tag.GetKey(), TagNameRulePrefix)
+	}
+}
+
+func TestRuleOwnershipAdoption(t *testing.T) {
+	member := osc.SecurityGroupRule{}
+	member.SetIpProtocol("tcp")
+	member.SetFromPortRange(30080)
+	member.SetToPortRange(30080)
+	member.SetSecurityGroupsMembers([]osc.SecurityGroupsMember{{SecurityGroupId: osc.PtrString("sg-elb")}})
+	ssh := tcpIngressRule(22, "10.0.0.0/8")
+
+	for _, name := range []string{"k8s-elb-legacy", "k8s-shared-elb", "k8s-sg-pool-abcde"} {
+		service, group := newTestSecurityGroupService(t, name)
+		ownership := service.ruleOwnership(group)
+		assert.True(t, ownership.owns(ssh), name)
+		assert.True(t, ownership.owns(member), name)
+	}
+
+	// The other groups of the cluster, e.g. of the nodes, adopt the rules opened to the
+	// security groups of the load balancers
+	service, group := newTestSecurityGroupService(t, "nodes")
+	ownership := service.ruleOwnership(group)
+	assert.False(t, ownership.owns(ssh))
+	assert.True(t, ownership.owns(member))
+
+	group.SetTags([]osc.ResourceTag{})
+	ownership = service.ruleOwnership(group)
+	assert.False(t, ownership.owns(member), fmt.Sprintf("untagged group %s", group.GetSecurityGroupName()))
+}
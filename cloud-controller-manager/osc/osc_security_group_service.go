@@ -0,0 +1,602 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Security Group Service *********************
+
+// defaultSecurityGroupRuleLimit is the maximum number of inbound rules of a security group
+// when SecurityGroupRuleLimit is not set
+const defaultSecurityGroupRuleLimit = 100
+
+// SecurityGroupService manages the security groups and their rules
+type SecurityGroupService interface {
+	findSecurityGroup(securityGroupID string) (*osc.SecurityGroup, error)
+	setSecurityGroupIngress(securityGroupID string, permissions IPRulesSet) (bool, error)
+	addSecurityGroupRules(securityGroupID string, addPermissions *[]osc.SecurityGroupRule, isPublicCloud bool) (bool, error)
+	removeSecurityGroupRules(securityGroupID string, removePermissions *[]osc.SecurityGroupRule, isPublicCloud bool) (bool, error)
+	ensureSecurityGroup(name string, description string, tagging *resourceTagging, additionalTags map[string]string) (string, bool, error)
+	getTaggedSecurityGroups() (map[string]osc.SecurityGroup, error)
+	readTaggedSecurityGroups() (map[string]osc.SecurityGroup, error)
+	findSecurityGroupBySelector(selector map[string]string) (string, error)
+}
+
+// securityGroupService implements SecurityGroupService with the oAPI
+type securityGroupService struct {
+	compute Compute
+	tagging *resourceTagging
+	network *cloudNetwork
+	// Security group shared by the load balancers, never modified
+	elbSecurityGroup string
+	// Maximum number of inbound rules of a security group, once compacted
+	ruleLimit int
+	// Security groups tagged for the cluster, disabled when nil
+	cache *securityGroupCache
+	// Pre-created security groups leased to the new load balancers, disabled when nil
+	pool *securityGroupPool
+}
+
+func newSecurityGroupService(compute Compute, tagging *resourceTagging, network *cloudNetwork, elbSecurityGroup string,
+	ruleLimit int, cache *securityGroupCache) *securityGroupService {
+	if ruleLimit <= 0 {
+		ruleLimit = defaultSecurityGroupRuleLimit
+	}
+	return &securityGroupService{
+		compute:          compute,
+		tagging:          tagging,
+		network:          network,
+		elbSecurityGroup: elbSecurityGroup,
+		ruleLimit:        ruleLimit,
+		cache:            cache,
+	}
+}
+
+// Retrieves the specified security group from the AWS API, or returns nil if not found
+func (s *securityGroupService) findSecurityGroup(securityGroupID string) (*osc.SecurityGroup, error) {
+	klog.V(5).Infof("findSecurityGroup(%v)", securityGroupID)
+	readSecurityGroupsRequest := osc.ReadSecurityGroupsRequest{
+		Filters: &osc.FiltersSecurityGroup{
+			SecurityGroupIds: &[]string{
+				securityGroupID,
+			},
+		},
+	}
+	// We don't apply our tag filters because we are retrieving by ID
+
+	groups, err := s.compute.ReadSecurityGroups(&readSecurityGroupsRequest)
+	if err != nil {
+		klog.Warningf("Error retrieving security group: %q", err)
+		return nil, err
+	}
+
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	if len(groups) != 1 {
+		// This should not be possible - ids should be unique
+		return nil, fmt.Errorf("multiple security groups found with same id %q", securityGroupID)
+	}
+	group := groups[0]
+	return &group, nil
+}
+
+// Makes sure the security group ingress is exactly the specified permissions
+// Returns true if and only if changes were made
+// The security group must already exist
+func (s *securityGroupService) setSecurityGroupIngress(securityGroupID string, permissions IPRulesSet) (bool, error) {
+	klog.V(5).Infof("setSecurityGroupIngress(%v,%v)", securityGroupID, permissions)
+	// We do not want to make changes to the Global defined SG
+	if securityGroupID == s.elbSecurityGroup {
+		return false, nil
+	}
+
+	group, err := s.findSecurityGroup(securityGroupID)
+	if err != nil {
+		klog.Warningf("Error retrieving security group %q", err)
+		return false, err
+	}
+
+	if group == nil {
+		return false, fmt.Errorf("security group not found: %s", securityGroupID)
+	}
+
+	klog.V(2).Infof("Existing security group ingress: %s %v", securityGroupID, group.GetInboundRules())
+
+	actual := NewIPRulesSet(group.GetInboundRules()...)
+
+	// OSC groups rules together, for example combining:
+	//
+	// { Port=80, Range=[A] } and { Port=80, Range=[B] }
+	//
+	// into { Port=80, Range=[A,B] }
+	//
+	// We have to ungroup them, because otherwise the logic becomes really
+	// complicated, and also because if we have Range=[A,B] and we try to
+	// add Range=[A] then OSC complains about a duplicate rule.
+	permissions = permissions.Ungroup()
+	actual = actual.Ungroup()
+
+	// Only the rules created by the cloud provider are removed, the rules added by other
+	// tools are kept
+	ownership := s.ruleOwnership(group)
+	remove := actual.Difference(permissions)
+	for key, rule := range remove {
+		if !ownership.owns(rule) {
+			klog.V(4).Infof("Keeping security group ingress not managed by the cloud provider: %s %v", securityGroupID, rule)
+			delete(remove, key)
+		}
+	}
+	add := permissions.Difference(actual)
+
+	// The rules are written compacted, and the security group must stay under the rule
+	// limit once they are, which is checked before any change
+	if count := len(writtenRules(actual.Difference(remove).Union(permissions))); count > s.ruleLimit {
+		return false, fmt.Errorf("security group %s would have %d inbound rules, more than the limit of %d: reduce the source ranges or the ports of the load balancer",
+			securityGroupID, count, s.ruleLimit)
+	}
+
+	// The rules are marked before being created, so that a rule is never created without
+	// its marker
+	owned := NewIPRulesSet()
+	for key, rule := range permissions {
+		if _, found := actual[key]; !found || ownership.owns(rule) {
+			owned[key] = rule
+		}
+	}
+	if err := s.markRules(securityGroupID, &ownership, owned); err != nil {
+		return false, err
+	}
+
+	if add.Len() == 0 && remove.Len() == 0 {
+		return false, s.unmarkRules(securityGroupID, &ownership, owned)
+	}
+
+	if add.Len() != 0 {
+		klog.V(2).Infof("Adding security group ingress: %s %v", securityGroupID, add.List())
+
+		list := writtenRules(add)
+		request := osc.CreateSecurityGroupRuleRequest{
+			Flow:            "Inbound",
+			SecurityGroupId: securityGroupID,
+			Rules:           &list,
+		}
+
+		_, err = s.compute.CreateSecurityGroupRule(&request)
+		if err != nil {
+			return false, fmt.Errorf("error authorizing security group ingress: %q", err)
+		}
+	}
+	if remove.Len() != 0 {
+		klog.V(2).Infof("Remove security group ingress: %s %v", securityGroupID, remove.List())
+
+		list := writtenRules(remove)
+		request := osc.DeleteSecurityGroupRuleRequest{
+			Flow:            "Inbound",
+			SecurityGroupId: securityGroupID,
+			Rules:           &list,
+		}
+
+		_, err = s.compute.DeleteSecurityGroupRule(&request)
+		if err != nil {
+			return false, fmt.Errorf("error revoking security group ingress: %q", err)
+		}
+	}
+
+	if err := s.unmarkRules(securityGroupID, &ownership, owned); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// writtenRules returns the rules as written in the security groups, compacted unless the
+// SecurityGroupRuleCompaction feature is disabled
+func writtenRules(rules IPRulesSet) []osc.SecurityGroupRule {
+	if featureEnabled(SecurityGroupRuleCompaction) {
+		return rules.Compact()
+	}
+	return rules.List()
+}
+
+// Makes sure the security group includes the specified permissions
+// Returns true if and only if changes were made
+// The security group must already exist
+func (s *securityGroupService) addSecurityGroupRules(securityGroupID string, addPermissions *[]osc.SecurityGroupRule, isPublicCloud bool) (bool, error) {
+	klog.V(5).Infof("addSecurityGroupRules(%v,%v,%v)", securityGroupID, addPermissions, isPublicCloud)
+	// We do not want to make changes to the Global defined SG
+	if securityGroupID == s.elbSecurityGroup {
+		return false, nil
+	}
+
+	group, err := s.findSecurityGroup(securityGroupID)
+	if err != nil {
+		klog.Warningf("Error retrieving security group: %q", err)
+		return false, err
+	}
+
+	if group == nil {
+		return false, fmt.Errorf("security group not found: %s", securityGroupID)
+	}
+
+	klog.Infof("Existing security group ingress: %s %v", securityGroupID, group.GetInboundRules())
+
+	changes := []osc.SecurityGroupRule{}
+	for _, addPermission := range *addPermissions {
+		hasUserID := false
+		for _, member := range addPermission.GetSecurityGroupsMembers() {
+			if member.HasAccountId() {
+				hasUserID = true
+			}
+		}
+
+		found := false
+		for _, groupPermission := range group.GetInboundRules() {
+			if ruleExists(&addPermission, &groupPermission, hasUserID) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			changes = append(changes, addPermission)
+		}
+	}
+
+	if len(changes) == 0 && !isPublicCloud {
+		return false, nil
+	}
+
+	klog.Infof("Adding security group ingress: %s %v isPublic %v)", securityGroupID, changes, isPublicCloud)
+
+	request := osc.CreateSecurityGroupRuleRequest{
+		Flow:            "Inbound",
+		SecurityGroupId: securityGroupID,
+	}
+	if !isPublicCloud {
+		request.SetRules(changes)
+	} else {
+		request.SetSecurityGroupNameToLink(DefaultSrcSgName)
+		request.SetSecurityGroupAccountIdToLink(DefaultSgOwnerID)
+	}
+	_, err = s.compute.CreateSecurityGroupRule(&request)
+	if err != nil {
+		ignore := false
+		if isPublicCloud {
+			if strings.Contains(err.Error(), "Conflict") {
+				klog.V(2).Infof("Ignoring Duplicate for security group (%s), assuming is used by other public LB", securityGroupID)
+				ignore = true
+
+			}
+		}
+		if !ignore {
+			klog.Warningf("Error authorizing security group ingress %q", err)
+			return false, fmt.Errorf("error authorizing security group ingress: %q", err)
+		}
+	}
+
+	return true, nil
+}
+
+// Makes sure the security group no longer includes the specified permissions
+// Returns true if and only if changes were made
+// If the security group no longer exists, will return (false, nil)
+func (s *securityGroupService) removeSecurityGroupRules(securityGroupID string, removePermissions *[]osc.SecurityGroupRule, isPublicCloud bool) (bool, error) {
+	klog.V(5).Infof("removeSecurityGroupRules(%v,%v)", securityGroupID, removePermissions)
+	// We do not want to make changes to the Global defined SG
+	if securityGroupID == s.elbSecurityGroup {
+		return false, nil
+	}
+
+	group, err := s.findSecurityGroup(securityGroupID)
+	if err != nil {
+		klog.Warningf("Error retrieving security group: %q", err)
+		return false, err
+	}
+
+	if group == nil {
+		klog.Warning("Security group not found: ", securityGroupID)
+		return false, nil
+	}
+
+	changes := []osc.SecurityGroupRule{}
+	for _, removePermission := range *removePermissions {
+		hasUserID := false
+		for _, member := range removePermission.GetSecurityGroupsMembers() {
+			if member.HasAccountId() {
+				hasUserID = true
+			}
+		}
+
+		for _, groupPermission := range group.GetInboundRules() {
+			if ruleExists(&removePermission, &groupPermission, hasUserID) {
+				changes = append(changes, removePermission)
+				break
+			}
+		}
+
+	}
+
+	if len(changes) == 0 && !isPublicCloud {
+		return false, nil
+	}
+
+	klog.Infof("Removing security group ingress: %s %v", securityGroupID, changes)
+
+	request := osc.DeleteSecurityGroupRuleRequest{
+		Flow:            "Inbound",
+		SecurityGroupId: securityGroupID,
+	}
+	if !isPublicCloud {
+		request.SetRules(changes)
+	} else {
+		request.SetSecurityGroupNameToUnlink(DefaultSrcSgName)
+		request.SetSecurityGroupAccountIdToUnlink(DefaultSgOwnerID)
+	}
+
+	_, err = s.compute.DeleteSecurityGroupRule(&request)
+	if err != nil {
+		klog.Warningf("Error revoking security group ingress: %q", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Makes sure the security group exists.
+// For multi-cluster isolation, name must be globally unique, for example derived from the service UUID.
+// Additional tags can be specified, and the group is tagged with tagging (the tagging of the
+// cluster when nil)
+// Returns the security group id and whether it was created, or error
+func (s *securityGroupService) ensureSecurityGroup(name string, description string, tagging *resourceTagging, additionalTags map[string]string) (string, bool, error) {
+	klog.V(5).Infof("ensureSecurityGroup (%v,%v,%v,%v)", name, description, tagging, additionalTags)
+	if tagging == nil {
+		tagging = s.tagging
+	}
+
+	groupID := ""
+	attempt := 0
+	for {
+		attempt++
+
+		// Note that we do _not_ add our tag filters; group-name + vpc-id is the EC2 primary key.
+		// However, we do check that it matches our tags.
+		// If it doesn't have any tags, we tag it; this is how we recover if we failed to tag before.
+		// If it has a different cluster's tags, that is an error.
+		// This shouldn't happen because name is expected to be globally unique (UUID derived)
+		request := osc.ReadSecurityGroupsRequest{
+			Filters: &osc.FiltersSecurityGroup{
+				SecurityGroupNames: &[]string{name},
+			},
+		}
+
+		if s.network.vpcID != "" {
+			request.Filters.NetIds = &[]string{s.network.vpcID}
+		}
+
+		securityGroups, err := s.compute.ReadSecurityGroups(&request)
+		if err != nil {
+			return "", false, err
+		}
+		if len(securityGroups) == 0 {
+			// The security group may have been leased from the pool under another name
+			request.Filters.SecurityGroupNames = nil
+			request.Filters.Tags = &[]string{fmt.Sprintf("%s=%s", TagNameSecurityGroupLease, name)}
+			if securityGroups, err = s.compute.ReadSecurityGroups(&request); err != nil {
+				return "", false, err
+			}
+		}
+
+		if len(securityGroups) >= 1 {
+			if len(securityGroups) > 1 {
+				klog.Warningf("Found multiple security groups with name: %q", name)
+			}
+			err := tagging.readRepairClusterTags(
+				s.compute, securityGroups[0].GetSecurityGroupId(),
+				ResourceLifecycleOwned, nil, securityGroups[0].Tags)
+			if err != nil {
+				return "", false, err
+			}
+			if err := s.cancelSecurityGroupDeletion(&securityGroups[0]); err != nil {
+				return "", false, err
+			}
+
+			return securityGroups[0].GetSecurityGroupId(), false, nil
+		}
+
+		if groupID, err := s.pool.lease(name, tagging, additionalTags); err != nil || groupID != "" {
+			return groupID, groupID != "", err
+		}
+
+		createRequest := osc.CreateSecurityGroupRequest{}
+		if s.network.vpcID != "" {
+			createRequest.SetNetId(s.network.vpcID)
+		}
+		createRequest.SetSecurityGroupName(name)
+		createRequest.SetDescription(description)
+
+		createResponse, err := s.compute.CreateSecurityGroup(&createRequest)
+		if err != nil {
+			ignore := false
+			if strings.Contains(err.Error(), "Conflict") && attempt < MaxReadThenCreateRetries {
+				klog.V(2).Infof("Got InvalidGroup.Duplicate while creating security group (race?); will retry")
+				ignore = true
+			}
+			if !ignore {
+				klog.Errorf("Error creating security group: %q", err)
+				return "", false, err
+			}
+			time.Sleep(1 * time.Second)
+		} else {
+			groupID = createResponse.SecurityGroup.GetSecurityGroupId()
+			break
+		}
+	}
+	if groupID == "" {
+		return "", false, fmt.Errorf("created security group, but id was not returned: %s", name)
+	}
+
+	err := tagging.createTags(s.compute, groupID, ResourceLifecycleOwned, additionalTags)
+	if err != nil {
+		// If we retry, ensureClusterTags will recover from this - it
+		// will add the missing tags.  We could delete the security
+		// group here, but that doesn't feel like the right thing, as
+		// the caller is likely to retry the create
+		return "", false, fmt.Errorf("error tagging security group: %q", err)
+	}
+	return groupID, true, nil
+}
+
+// Return all the security groups that are tagged as being part of our cluster, from the
+// cache when enabled
+func (s *securityGroupService) getTaggedSecurityGroups() (map[string]osc.SecurityGroup, error) {
+	return s.cache.get(s.readTaggedSecurityGroups)
+}
+
+// readTaggedSecurityGroups lists the security groups tagged for the cluster, indexed by ID
+func (s *securityGroupService) readTaggedSecurityGroups() (map[string]osc.SecurityGroup, error) {
+	klog.V(5).Infof("readTaggedSecurityGroups()")
+	request := osc.ReadSecurityGroupsRequest{
+		Filters: &osc.FiltersSecurityGroup{
+			TagKeys: s.tagging.clusterTagKeysFilter(),
+			Tags:    &[]string{fmt.Sprintf("%s%s=%s", TagNameMainSG, s.tagging.clusterID(), "True")},
+		},
+	}
+
+	groups, err := s.compute.ReadSecurityGroups(&request)
+	if err != nil {
+		return nil, fmt.Errorf("error querying security groups: %q", err)
+	}
+
+	m := make(map[string]osc.SecurityGroup)
+	for _, group := range groups {
+		if !s.tagging.hasClusterTag(group.Tags) {
+			continue
+		}
+
+		id := group.GetSecurityGroupId()
+		if id == "" {
+			klog.Warningf("Ignoring group without id: %v", group)
+			continue
+		}
+		m[id] = group
+	}
+	return m, nil
+}
+
+// findSecurityGroupBySelector returns the id of the security group of the VPC matching
+// all the tags of the selector. When several groups match, the one tagged for the
+// cluster is preferred; any remaining ambiguity is reported as an error.
+func (s *securityGroupService) findSecurityGroupBySelector(selector map[string]string) (string, error) {
+	klog.V(5).Infof("findSecurityGroupBySelector(%v)", selector)
+	if len(selector) == 0 {
+		return "", fmt.Errorf("empty security group selector")
+	}
+
+	filterTags := []string{}
+	filterTagKeys := []string{}
+	for key, value := range selector {
+		if value == "" {
+			filterTagKeys = append(filterTagKeys, key)
+		} else {
+			filterTags = append(filterTags, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	filters := osc.FiltersSecurityGroup{}
+	if s.network.vpcID != "" {
+		filters.SetNetIds([]string{s.network.vpcID})
+	}
+	if len(filterTags) > 0 {
+		filters.SetTags(filterTags)
+	}
+	if len(filterTagKeys) > 0 {
+		filters.SetTagKeys(filterTagKeys)
+	}
+
+	groups, err := s.compute.ReadSecurityGroups(&osc.ReadSecurityGroupsRequest{Filters: &filters})
+	if err != nil {
+		return "", fmt.Errorf("error querying security groups with selector %v: %q", selector, err)
+	}
+
+	matches := []osc.SecurityGroup{}
+	for _, group := range groups {
+		if group.GetSecurityGroupId() != "" && securityGroupMatchesSelector(group, selector) {
+			matches = append(matches, group)
+		}
+	}
+	if len(matches) > 1 {
+		owned := []osc.SecurityGroup{}
+		for _, group := range matches {
+			if s.tagging.hasClusterTag(group.Tags) {
+				owned = append(owned, group)
+			}
+		}
+		if len(owned) > 0 {
+			matches = owned
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no security group matches selector %v", selector)
+	case 1:
+		if err := s.protectSelectedSecurityGroup(&matches[0]); err != nil {
+			return "", err
+		}
+		return matches[0].GetSecurityGroupId(), nil
+	default:
+		ids := []string{}
+		for _, group := range matches {
+			ids = append(ids, group.GetSecurityGroupId())
+		}
+		sort.Strings(ids)
+		return "", fmt.Errorf("security group selector %v is ambiguous, it matches %v", selector, ids)
+	}
+}
+
+// protectSelectedSecurityGroup tags a security group selected by a Service with
+// TagNameSecurityGroupSelected, so that it is not deleted with the load balancer even once
+// the selector annotation is removed
+func (s *securityGroupService) protectSelectedSecurityGroup(group *osc.SecurityGroup) error {
+	if isSelectedSecurityGroup(group.Tags) {
+		return nil
+	}
+	klog.V(2).Infof("Tagging security group %s selected by a service as %s", group.GetSecurityGroupId(), TagNameSecurityGroupSelected)
+	_, err := s.compute.CreateTags(&osc.CreateTagsRequest{
+		ResourceIds: []string{group.GetSecurityGroupId()},
+		Tags:        []osc.ResourceTag{{Key: TagNameSecurityGroupSelected, Value: "true"}},
+	})
+	if err != nil {
+		return fmt.Errorf("error tagging selected security group %s: %q", group.GetSecurityGroupId(), err)
+	}
+	return nil
+}
+
+// isSelectedSecurityGroup returns whether the security group has been selected by a Service
+// with ServiceAnnotationLoadBalancerSecurityGroupSelector
+func isSelectedSecurityGroup(tags *[]osc.ResourceTag) bool {
+	_, found := findTag(tags, TagNameSecurityGroupSelected)
+	return found
+}
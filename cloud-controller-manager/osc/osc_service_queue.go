@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Service Queue *********************
+
+const (
+	// serviceQueueBaseDelay is the delay of the first retry of a service
+	serviceQueueBaseDelay = 5 * time.Second
+	// serviceQueueMaxDelay caps the delay of the retries of a service
+	serviceQueueMaxDelay = 5 * time.Minute
+)
+
+// serviceQueue reconciles the services put in its queue with sync, from the services and the
+// nodes of the informers. A service whose sync fails is retried with an exponential backoff.
+type serviceQueue struct {
+	cloud *Cloud
+	name  string
+	queue workqueue.RateLimitingInterface
+	sync  func(service *v1.Service, nodes []*v1.Node) error
+}
+
+func newServiceQueue(cloud *Cloud, name string, sync func(service *v1.Service, nodes []*v1.Node) error) *serviceQueue {
+	return &serviceQueue{
+		cloud: cloud,
+		name:  name,
+		queue: workqueue.NewNamedRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(serviceQueueBaseDelay, serviceQueueMaxDelay), name),
+		sync: sync,
+	}
+}
+
+// enqueue puts the service in the queue
+func (q *serviceQueue) enqueue(service *v1.Service) {
+	if q == nil {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(service)
+	if err != nil {
+		klog.Warningf("Unable to queue service %s/%s: %v", service.Namespace, service.Name, err)
+		return
+	}
+	q.queue.Add(key)
+}
+
+// retry puts the service in the queue after the backoff of its previous retries
+func (q *serviceQueue) retry(service *v1.Service) {
+	if q == nil {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(service)
+	if err != nil {
+		klog.Warningf("Unable to queue service %s/%s: %v", service.Namespace, service.Name, err)
+		return
+	}
+	q.queue.AddRateLimited(key)
+}
+
+// run starts the workers of the queue until stop is closed
+func (q *serviceQueue) run(stop <-chan struct{}) {
+	if q == nil {
+		return
+	}
+
+	klog.Infof("Starting the %s service queue", q.name)
+	for i := 0; i < q.cloud.backendWorkers(); i++ {
+		go wait.Until(q.worker, time.Second, stop)
+	}
+	go func() {
+		<-stop
+		q.queue.ShutDown()
+	}()
+}
+
+func (q *serviceQueue) worker() {
+	for q.processNext() {
+	}
+}
+
+// processNext syncs the next service of the queue, returning false once the queue is shut down
+func (q *serviceQueue) processNext() bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+
+	key := item.(string)
+	service, nodes, err := q.get(key)
+	if err == nil && service != nil {
+		err = q.sync(service, nodes)
+	}
+	if err != nil {
+		klog.Warningf("Unable to sync service %s in the %s service queue, retrying: %v", key, q.name, err)
+		q.queue.AddRateLimited(key)
+		return true
+	}
+	q.queue.Forget(key)
+	return true
+}
+
+// get returns the service of the key and the nodes to register to its load balancer, or a
+// nil service when it no longer exists
+func (q *serviceQueue) get(key string) (*v1.Service, []*v1.Node, error) {
+	c := q.cloud
+	if c.serviceInformer == nil || c.nodeInformer == nil ||
+		(c.serviceInformerHasSynced != nil && !c.serviceInformerHasSynced()) ||
+		(c.nodeInformerHasSynced != nil && !c.nodeInformerHasSynced()) {
+		return nil, nil, fmt.Errorf("informers not synced")
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	service, err := c.serviceInformer.Lister().Services(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := c.nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return nil, nil, err
+	}
+	return service.DeepCopy(), loadBalancerClassNodes(nodes), nil
+}
+
+// resyncBackends updates the backends of the load balancer of the service, the update
+// failing while instances are not serving yet
+func (c *Cloud) resyncBackends(service *v1.Service, nodes []*v1.Node) error {
+	if service.DeletionTimestamp != nil || service.Spec.Type != v1.ServiceTypeLoadBalancer ||
+		!c.managesLoadBalancerClass(service) || !hasLoadBalancerFinalizer(service) {
+		return nil
+	}
+	return c.UpdateLoadBalancer(context.TODO(), "", service, nodes)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestServiceQueue(t *testing.T) {
+	var unset *serviceQueue
+	unset.run(make(chan struct{}))
+	unset.enqueue(&v1.Service{})
+
+	c, err := newCloud(CloudConfig{}, NewFakeAWSServices(TestClusterID))
+	require.NoError(t, err)
+	c.SetInformers(informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0))
+	c.serviceInformerHasSynced = func() bool { return true }
+	c.nodeInformerHasSynced = func() bool { return true }
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"}}
+	require.NoError(t, c.serviceInformer.Informer().GetIndexer().Add(service))
+	ready := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ready"},
+		Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}},
+	}
+	require.NoError(t, c.nodeInformer.Informer().GetIndexer().Add(ready))
+	require.NoError(t, c.nodeInformer.Informer().GetIndexer().Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "not-ready"}}))
+
+	synced := 0
+	failure := errors.New("instances not serving yet")
+	q := newServiceQueue(c, "test", func(s *v1.Service, nodes []*v1.Node) error {
+		synced++
+		assert.Equal(t, "web", s.Name)
+		assert.Equal(t, []*v1.Node{ready}, nodes)
+		return failure
+	})
+	q.queue = workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond))
+
+	// A failed sync is retried
+	q.enqueue(service)
+	assert.True(t, q.processNext())
+	assert.Equal(t, 1, q.queue.NumRequeues("shop/web"))
+	failure = nil
+	assert.True(t, q.processNext())
+	assert.Equal(t, 2, synced)
+	assert.Equal(t, 0, q.queue.NumRequeues("shop/web"))
+
+	// A deleted service is dropped
+	q.enqueue(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: "shop"}})
+	assert.True(t, q.processNext())
+	assert.Equal(t, 2, synced)
+	assert.Equal(t, 0, q.queue.Len())
+
+	q.queue.ShutDown()
+	assert.False(t, q.processNext())
+}
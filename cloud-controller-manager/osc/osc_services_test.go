@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceServiceDescribeInstances(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	tagging := &resourceTagging{}
+	assert.NoError(t, tagging.init("", TestClusterID))
+
+	clusterTags := []osc.ResourceTag{{
+		Key:   fmt.Sprintf("%s%s", TagNameKubernetesClusterPrefix, TestClusterID),
+		Value: ResourceLifecycleOwned,
+	}}
+	awsServices.instances = []*osc.Vm{
+		{VmId: aws.String("i-cluster"), Tags: &clusterTags},
+		{VmId: aws.String("i-other"), Tags: &[]osc.ResourceTag{}},
+	}
+
+	service := newInstanceService(awsServices.compute, tagging, &nodeNameStrategy{})
+	instances, err := service.describeInstances(&osc.FiltersVm{})
+	assert.NoError(t, err)
+	assert.Len(t, instances, 1)
+	assert.Equal(t, "i-cluster", instances[0].GetVmId())
+
+	instance, err := service.getInstanceByID("i-other")
+	assert.NoError(t, err)
+	assert.Equal(t, "i-other", instance.GetVmId())
+}
+
+func TestLoadBalancerServiceDescribeLoadBalancer(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	awsServices.elb.(*FakeELB).LoadBalancers = map[string]*elb.LoadBalancerDescription{
+		"lb-service": {LoadBalancerName: aws.String("lb-service")},
+	}
+
+	service := newLoadBalancerService(awsServices.elb)
+	lb, err := service.describeLoadBalancer("lb-service")
+	assert.NoError(t, err)
+	assert.Equal(t, "lb-service", aws.StringValue(lb.LoadBalancerName))
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Graceful Shutdown *********************
+
+// EventResumedLoadBalancer is recorded on a service when the reconciliation of its load
+// balancer interrupted by the shutdown of the CCM is completed
+const EventResumedLoadBalancer = "ResumedLoadBalancerReconciliation"
+
+// Phases of the reconciliation of a load balancer, persisted in the TagNameResumeHint tag
+// when the reconciliation is interrupted by the shutdown of the CCM
+const (
+	// shutdownPhaseSecurityGroups is the creation of the security groups and of their rules
+	shutdownPhaseSecurityGroups = "SecurityGroups"
+	// shutdownPhaseLoadBalancer is the creation or the update of the load balancer
+	shutdownPhaseLoadBalancer = "LoadBalancer"
+	// shutdownPhaseBackends is the configuration of the health check, of the backend rules and
+	// of the backends of the load balancer
+	shutdownPhaseBackends = "Backends"
+)
+
+// errShuttingDown is returned by the reconciliations started once the shutdown began
+var errShuttingDown = errors.New("the cloud provider is shutting down")
+
+// shutdownOperation is an in-flight reconciliation of a load balancer
+type shutdownOperation struct {
+	service *v1.Service
+	phase   string
+	// Security groups created by the reconciliation, deleted when it is interrupted before
+	// the load balancer is created
+	createdSecurityGroups []string
+}
+
+// shutdownManager tracks the in-flight reconciliations of the load balancers, so that on
+// shutdown they are given a grace period to complete. The reconciliations still running
+// after it are rolled back when the load balancer was not created yet, and otherwise
+// tagged with TagNameResumeHint so that the next leader logs and reports their resumption.
+type shutdownManager struct {
+	cloud       *Cloud
+	gracePeriod time.Duration
+
+	mutex        sync.Mutex
+	shuttingDown bool
+	// In-flight reconciliations by load balancer name
+	operations map[string]*shutdownOperation
+	// Closed when the last in-flight reconciliation ends during the shutdown
+	drained chan struct{}
+	// Phases of the TagNameResumeHint tags found on the load balancers being reconciled
+	resumeHints map[string]string
+	// When the last in-flight reconciliation ended
+	idleSince time.Time
+}
+
+func newShutdownManager(cloud *Cloud, gracePeriod time.Duration) *shutdownManager {
+	return &shutdownManager{
+		cloud:       cloud,
+		gracePeriod: gracePeriod,
+		operations:  make(map[string]*shutdownOperation),
+		resumeHints: make(map[string]string),
+	}
+}
+
+// begin tracks the reconciliation of a load balancer until end is called with its result.
+// It fails once the shutdown began.
+func (m *shutdownManager) begin(service *v1.Service, loadBalancerName string) (end func(error), err error) {
+	if m == nil {
+		return func(error) {}, nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.shuttingDown {
+		return nil, errShuttingDown
+	}
+	operation := &shutdownOperation{service: service, phase: shutdownPhaseSecurityGroups}
+	m.operations[loadBalancerName] = operation
+	return func(err error) { m.end(loadBalancerName, operation, err) }, nil
+}
+
+func (m *shutdownManager) end(loadBalancerName string, operation *shutdownOperation, err error) {
+	m.mutex.Lock()
+	if m.operations[loadBalancerName] == operation {
+		delete(m.operations, loadBalancerName)
+		if len(m.operations) == 0 {
+			m.idleSince = time.Now()
+		}
+	}
+	if m.shuttingDown && len(m.operations) == 0 && m.drained != nil {
+		close(m.drained)
+		m.drained = nil
+	}
+	phase, resumed := m.resumeHints[loadBalancerName]
+	if err == nil {
+		delete(m.resumeHints, loadBalancerName)
+	}
+	m.mutex.Unlock()
+
+	if err != nil || !resumed {
+		return
+	}
+	c := m.cloud
+	if err := c.loadBalancerService.removeLoadBalancerTags(loadBalancerName, []string{TagNameResumeHint}); err != nil {
+		klog.Warningf("Unable to remove the resume hint of load balancer %s: %v", loadBalancerName, err)
+		return
+	}
+	c.recordLoadBalancerEvent(operation.service, EventResumedLoadBalancer,
+		"Completed the reconciliation of load balancer %s interrupted by the shutdown of the cloud provider during phase %s",
+		loadBalancerName, phase)
+}
+
+// setPhase records the phase of the reconciliation of a load balancer
+func (m *shutdownManager) setPhase(loadBalancerName string, phase string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if operation, found := m.operations[loadBalancerName]; found {
+		operation.phase = phase
+	}
+}
+
+// busy returns whether load balancers are being reconciled
+func (m *shutdownManager) busy() bool {
+	if m == nil {
+		return false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.operations) > 0
+}
+
+// quiet returns whether no load balancer has been reconciled for the given period
+func (m *shutdownManager) quiet(period time.Duration) bool {
+	if m == nil {
+		return true
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.operations) == 0 && time.Since(m.idleSince) >= period
+}
+
+// securityGroupCreated records a security group created by the reconciliation of a load balancer
+func (m *shutdownManager) securityGroupCreated(loadBalancerName string, securityGroupID string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if operation, found := m.operations[loadBalancerName]; found {
+		operation.createdSecurityGroups = append(operation.createdSecurityGroups, securityGroupID)
+	}
+}
+
+// resumeHint records the TagNameResumeHint tag found on a load balancer, removed once its
+// reconciliation completes
+func (m *shutdownManager) resumeHint(loadBalancerName string, phase string) {
+	if m == nil {
+		return
+	}
+	klog.Infof("Resuming the reconciliation of load balancer %s interrupted by the shutdown of the cloud provider during phase %s",
+		loadBalancerName, phase)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.resumeHints[loadBalancerName] = phase
+}
+
+// shutdown refuses the new reconciliations, waits up to the grace period for the in-flight
+// ones and then rolls back or tags the ones still running
+func (m *shutdownManager) shutdown() {
+	m.mutex.Lock()
+	m.shuttingDown = true
+	drained := make(chan struct{})
+	if len(m.operations) == 0 {
+		close(drained)
+	} else {
+		m.drained = drained
+	}
+	klog.Infof("Shutting down, waiting up to %v for %d load balancer reconciliations", m.gracePeriod, len(m.operations))
+	m.mutex.Unlock()
+
+	select {
+	case <-drained:
+		return
+	case <-time.After(m.gracePeriod):
+	}
+
+	m.mutex.Lock()
+	names := make([]string, 0, len(m.operations))
+	operations := make(map[string]shutdownOperation, len(m.operations))
+	for name, operation := range m.operations {
+		names = append(names, name)
+		operations[name] = *operation
+	}
+	m.mutex.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		operation := operations[name]
+		if err := m.interrupt(name, &operation); err != nil {
+			klog.Errorf("Unable to interrupt the reconciliation of load balancer %s: %v", name, err)
+		}
+	}
+}
+
+// interrupt rolls back the reconciliation of a load balancer not created yet, and otherwise
+// tags the load balancer with the phase of the reconciliation
+func (m *shutdownManager) interrupt(loadBalancerName string, operation *shutdownOperation) error {
+	c := m.cloud
+	loadBalancer, err := c.loadBalancerService.describeLoadBalancer(loadBalancerName)
+	if err != nil {
+		return err
+	}
+	if loadBalancer == nil {
+		if len(operation.createdSecurityGroups) == 0 {
+			return nil
+		}
+		klog.Warningf("Rolling back the creation of load balancer %s interrupted during phase %s: deleting security groups %v",
+			loadBalancerName, operation.phase, operation.createdSecurityGroups)
+		serviceName := types.NamespacedName{Namespace: operation.service.Namespace, Name: operation.service.Name}
+		return c.deleteLoadBalancerSecurityGroups(serviceName.String(), operation.createdSecurityGroups)
+	}
+	klog.Warningf("Reconciliation of load balancer %s interrupted during phase %s, tagging it to be resumed",
+		loadBalancerName, operation.phase)
+	return c.loadBalancerService.addLoadBalancerTags(loadBalancerName, map[string]string{TagNameResumeHint: operation.phase})
+}
+
+// HandleShutdown interrupts the in-flight load balancer reconciliations on SIGTERM or SIGINT,
+// see ShutdownGracePeriodSeconds, before exiting. It does nothing when the graceful shutdown
+// is disabled.
+func HandleShutdown(cloud cloudprovider.Interface) error {
+	c, ok := cloud.(*Cloud)
+	if !ok {
+		return fmt.Errorf("unexpected cloud provider %T", cloud)
+	}
+	if c.shutdown.gracePeriod <= 0 {
+		return nil
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		klog.Infof("Received %v, shutting down gracefully", sig)
+		// A second signal exits immediately
+		go func() {
+			<-signals
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}()
+		c.shutdown.shutdown()
+		klog.FlushAndExit(klog.ExitFlushTimeout, 0)
+	}()
+	return nil
+}
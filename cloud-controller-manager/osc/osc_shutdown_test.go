@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestShutdownRefusesNewReconciliations(t *testing.T) {
+	c, _, node := newFakeAPICloud(t)
+	c.shutdown.gracePeriod = time.Second
+	c.shutdown.shutdown()
+
+	_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, newFakeAPIService("web"), []*v1.Node{node})
+	assert.ErrorIs(t, err, errShuttingDown)
+}
+
+func TestShutdownWaitsForInFlightReconciliations(t *testing.T) {
+	c, _, _ := newFakeAPICloud(t)
+	c.shutdown.gracePeriod = time.Minute
+	end, err := c.shutdown.begin(newFakeAPIService("web"), "lb-web")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		c.shutdown.shutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("shutdown returned before the end of the reconciliation")
+	case <-time.After(50 * time.Millisecond):
+	}
+	end(nil)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not return after the end of the reconciliation")
+	}
+}
+
+func TestShutdownRollsBackSecurityGroups(t *testing.T) {
+	c, s, _ := newFakeAPICloud(t)
+	c.shutdown.gracePeriod = time.Millisecond
+	groupID := s.AddSecurityGroup(osc.SecurityGroup{SecurityGroupName: osc.PtrString("k8s-elb-lb-web"), NetId: osc.PtrString("vpc-1")})
+	_, err := c.shutdown.begin(newFakeAPIService("web"), "lb-web")
+	require.NoError(t, err)
+	c.shutdown.securityGroupCreated("lb-web", groupID)
+
+	// The load balancer was not created yet, the security group it was created for is deleted
+	c.shutdown.shutdown()
+	_, found := s.SecurityGroup(groupID)
+	assert.False(t, found)
+}
+
+func TestShutdownResumeHint(t *testing.T) {
+	c, s, node := newFakeAPICloud(t)
+	c.shutdown.gracePeriod = time.Millisecond
+	service := newFakeAPIService("web")
+	name := c.GetLoadBalancerName(context.TODO(), TestClusterName, service)
+	_, err := c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	groups := s.SecurityGroups()
+
+	// The load balancer exists, the interrupted reconciliation is tagged to be resumed
+	_, err = c.shutdown.begin(service, name)
+	require.NoError(t, err)
+	c.shutdown.setPhase(name, shutdownPhaseBackends)
+	c.shutdown.shutdown()
+	assert.Equal(t, shutdownPhaseBackends, s.LoadBalancerTags(name)[TagNameResumeHint])
+	assert.Equal(t, groups, s.SecurityGroups())
+
+	// The next leader removes the hint once the reconciliation completes
+	next := c.shutdown
+	c.shutdown = newShutdownManager(c, time.Millisecond)
+	defer func() { c.shutdown = next }()
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{node})
+	require.NoError(t, err)
+	_, found := s.LoadBalancerTags(name)[TagNameResumeHint]
+	assert.False(t, found)
+	assert.Empty(t, c.shutdown.resumeHints)
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Subnet Service *********************
+
+// SubnetService selects the subnets of the load balancers
+type SubnetService interface {
+	findSubnets() ([]*osc.Subnet, error)
+	findELBSubnets(internalELB bool) ([]string, error)
+	findELBSubnetsByAZ(internalELB bool) (map[string]string, error)
+}
+
+// subnetService implements SubnetService with the oAPI
+type subnetService struct {
+	compute     Compute
+	tagging     *resourceTagging
+	network     *cloudNetwork
+	routeTables *routeTableCache
+}
+
+func newSubnetService(compute Compute, tagging *resourceTagging, network *cloudNetwork, routeTables *routeTableCache) *subnetService {
+	return &subnetService{
+		compute:     compute,
+		tagging:     tagging,
+		network:     network,
+		routeTables: routeTables,
+	}
+}
+
+// Finds the subnets associated with the cluster, by matching tags.
+// For maximal backwards compatibility, if no subnets are tagged, it will fall-back to the current subnet.
+// However, in future this will likely be treated as an error.
+func (s *subnetService) findSubnets() ([]*osc.Subnet, error) {
+	klog.V(5).Infof("findSubnets()")
+	request := osc.ReadSubnetsRequest{}
+	if s.network.vpcID != "" {
+		request.SetFilters(osc.FiltersSubnet{
+			NetIds: &[]string{
+				s.network.vpcID,
+			},
+		})
+
+		subnets, err := s.compute.DescribeSubnets(&request)
+		if err != nil {
+			return nil, fmt.Errorf("error describing subnets: %q", err)
+		}
+
+		var matches []*osc.Subnet
+		for _, subnet := range subnets {
+			if s.tagging.hasClusterTag(subnet.Tags) {
+				subnetRef := subnet
+				matches = append(matches, &subnetRef)
+			}
+		}
+
+		if len(matches) != 0 {
+			return matches, nil
+		}
+	}
+
+	if s.network.selfSubnetID != "" {
+		// Fall back to the current instance subnets, if nothing is tagged
+		klog.Warningf("No tagged subnets found; will fall-back to the current subnet only.  This is likely to be an error in a future version of k8s.")
+		request = osc.ReadSubnetsRequest{}
+		request.SetFilters(osc.FiltersSubnet{
+			SubnetIds: &[]string{
+				s.network.selfSubnetID,
+			},
+		})
+		subnets, err := s.compute.DescribeSubnets(&request)
+		if err != nil {
+			return nil, fmt.Errorf("error describing subnets: %q", err)
+		}
+
+		var matches []*osc.Subnet
+		for _, subnet := range subnets {
+			subnetRef := subnet
+			matches = append(matches, &subnetRef)
+		}
+		return matches, nil
+
+	}
+
+	return []*osc.Subnet{}, nil
+
+}
+
+// Finds the subnets to use for an ELB we are creating, ordered by AZ.
+// Normal (Internet-facing) ELBs must use public subnets, so we skip private subnets.
+// Internal ELBs can use public or private subnets, but if we have a private subnet we should prefer that.
+func (s *subnetService) findELBSubnets(internalELB bool) ([]string, error) {
+	klog.V(5).Infof("findELBSubnets(%v)", internalELB)
+	subnetsByAZ, err := s.findELBSubnetsByAZ(internalELB)
+	if err != nil {
+		return nil, err
+	}
+	return sortedSubnetIDs(subnetsByAZ), nil
+}
+
+// sortedSubnetIDs returns the subnet IDs of a map of subnet ID by AZ, ordered by AZ
+func sortedSubnetIDs(subnetsByAZ map[string]string) []string {
+	var azNames []string
+	for key := range subnetsByAZ {
+		azNames = append(azNames, key)
+	}
+
+	sort.Strings(azNames)
+
+	var subnetIDs []string
+	for _, key := range azNames {
+		subnetIDs = append(subnetIDs, subnetsByAZ[key])
+	}
+	return subnetIDs
+}
+
+// Finds the subnet to use for an ELB in each AZ, see findELBSubnets, and returns the
+// subnet IDs by AZ.
+func (s *subnetService) findELBSubnetsByAZ(internalELB bool) (map[string]string, error) {
+	klog.V(5).Infof("findELBSubnetsByAZ(%v)", internalELB)
+
+	// The subnets and the route tables are read concurrently
+	var subnets []*osc.Subnet
+	var rt []osc.RouteTable
+	group := newDiscoveryGroup()
+	group.Go(func() error {
+		var err error
+		subnets, err = s.findSubnets()
+		return err
+	})
+	if s.network.vpcID != "" {
+		group.Go(func() error {
+			readRequest := osc.ReadRouteTablesRequest{
+				Filters: &osc.FiltersRouteTable{
+					NetIds: &[]string{s.network.vpcID},
+				},
+			}
+			var err error
+			rt, err = s.routeTables.get(func() ([]osc.RouteTable, error) {
+				return s.compute.ReadRouteTables(&readRequest)
+			})
+			if err != nil {
+				return fmt.Errorf("error describe route table: %q", err)
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Try to break the tie using a tag
+	var tagName string
+	if internalELB {
+		tagName = TagNameSubnetInternalELB
+	} else {
+		tagName = TagNameSubnetPublicELB
+	}
+
+	subnetsByAZ := make(map[string]*osc.Subnet)
+	for _, subnet := range subnets {
+		az := subnet.GetSubregionName()
+		id := subnet.GetSubnetId()
+		if az == "" || id == "" {
+			klog.Warningf("Ignoring subnet with empty az/id: %v", subnet)
+			continue
+		}
+
+		isPublic, err := isSubnetPublic(&rt, id)
+		if err != nil {
+			return nil, err
+		}
+		if !internalELB && !isPublic {
+			klog.V(2).Infof("Ignoring private subnet for public ELB %q", id)
+			continue
+		}
+
+		existing := subnetsByAZ[az]
+		_, subnetHasTag := findTag(subnet.Tags, tagName)
+		if existing == nil {
+			if subnetHasTag {
+				subnetsByAZ[az] = subnet
+			} else if isPublic && !internalELB {
+				subnetsByAZ[az] = subnet
+			}
+			continue
+		}
+
+		_, existingHasTag := findTag(existing.Tags, tagName)
+
+		if existingHasTag != subnetHasTag {
+			if subnetHasTag {
+				subnetsByAZ[az] = subnet
+			}
+			continue
+		}
+
+		// If we have two subnets for the same AZ we arbitrarily choose the one that is first lexicographically.
+		// TODO: Should this be an error.
+		if strings.Compare(existing.GetSubnetId(), subnet.GetSubnetId()) > 0 {
+			klog.Warningf("Found multiple subnets in AZ %q; choosing %q between subnets %q and %q", az, *subnet.SubnetId, *existing.SubnetId, *subnet.SubnetId)
+			subnetsByAZ[az] = subnet
+			continue
+		}
+
+		klog.Warningf("Found multiple subnets in AZ %q; choosing %q between subnets %q and %q", az, *existing.SubnetId, *existing.SubnetId, *subnet.SubnetId)
+		continue
+	}
+
+	subnetIDs := make(map[string]string, len(subnetsByAZ))
+	for az, subnet := range subnetsByAZ {
+		subnetIDs[az] = aws.StringValue(subnet.SubnetId)
+	}
+
+	return subnetIDs, nil
+}
+
+// selectLoadBalancerSubnetByAZ returns the subnet of the AZ requested with the
+// ServiceAnnotationLoadBalancerSubnetAZ annotation, among the discovered subnets by AZ
+func selectLoadBalancerSubnetByAZ(subnetsByAZ map[string]string, az string) (string, error) {
+	if subnetID, found := subnetsByAZ[az]; found {
+		return subnetID, nil
+	}
+	var azNames []string
+	for key := range subnetsByAZ {
+		azNames = append(azNames, key)
+	}
+	sort.Strings(azNames)
+	if len(azNames) == 0 {
+		return "", fmt.Errorf("no suitable subnet found for the subregion %q of the annotation %v", az, ServiceAnnotationLoadBalancerSubnetAZ)
+	}
+	return "", fmt.Errorf("no suitable subnet found in the subregion %q of the annotation %v, the suitable subnets are in the subregions %v",
+		az, ServiceAnnotationLoadBalancerSubnetAZ, azNames)
+}
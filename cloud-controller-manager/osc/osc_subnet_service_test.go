@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSelectLoadBalancerSubnetByAZ(t *testing.T) {
+	subnetsByAZ := map[string]string{"eu-west-2a": "subnet-a0000001", "eu-west-2b": "subnet-b0000001"}
+	subnetID, err := selectLoadBalancerSubnetByAZ(subnetsByAZ, "eu-west-2b")
+	assert.NoError(t, err)
+	assert.Equal(t, "subnet-b0000001", subnetID)
+
+	_, err = selectLoadBalancerSubnetByAZ(subnetsByAZ, "eu-west-2c")
+	assert.EqualError(t, err, `no suitable subnet found in the subregion "eu-west-2c" of the annotation `+
+		ServiceAnnotationLoadBalancerSubnetAZ+`, the suitable subnets are in the subregions [eu-west-2a eu-west-2b]`)
+	_, err = selectLoadBalancerSubnetByAZ(map[string]string{}, "eu-west-2c")
+	assert.ErrorContains(t, err, "no suitable subnet found")
+}
+
+func TestEnsureLoadBalancerSubnetAZ(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	c.vpcID = "vpc-123456"
+	c.eventRecorder = record.NewFakeRecorder(20)
+
+	awsServices.compute.RemoveSubnets()
+	for _, subnet := range constructSubnets(map[int]map[string]string{
+		0: {"id": "subnet-a0000001", "az": "af-south-1a"},
+		1: {"id": "subnet-b0000001", "az": "af-south-1b"},
+		2: {"id": "subnet-c0000001", "az": "af-south-1c"},
+	}) {
+		subnet.Tags = append(subnet.Tags, &ec2.Tag{Key: aws.String(TagNameSubnetInternalELB), Value: aws.String("1")})
+		awsServices.compute.CreateSubnet(subnet)
+	}
+	awsServices.compute.RemoveRouteTables()
+	for _, rt := range constructRouteTables(map[string]bool{
+		"subnet-a0000001": false, "subnet-b0000001": false, "subnet-c0000001": false,
+	}) {
+		awsServices.compute.CreateRouteTable(rt)
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "internal",
+			UID:  "anuid",
+			Annotations: map[string]string{
+				ServiceAnnotationLoadBalancerInternal: "true",
+				ServiceAnnotationLoadBalancerSubnetAZ: "af-south-1b",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityNone,
+			Ports:           []v1.ServicePort{{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP}},
+		},
+	}
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	require.NoError(t, err)
+	loadBalancer, err := c.loadBalancerService.describeLoadBalancer(c.GetLoadBalancerName(context.TODO(), TestClusterName, service))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"subnet-b0000001"}, aws.StringValueSlice(loadBalancer.Subnets))
+
+	// The subregion must have a suitable subnet
+	service.Annotations[ServiceAnnotationLoadBalancerSubnetAZ] = "af-south-1d"
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.ErrorContains(t, err, "the suitable subnets are in the subregions [af-south-1a af-south-1b af-south-1c]")
+
+	// The subnets cannot be selected twice
+	service.Annotations[ServiceAnnotationLoadBalancerSubnetID] = "subnet-a0000001"
+	_, err = c.EnsureLoadBalancer(context.TODO(), TestClusterName, service, []*v1.Node{})
+	assert.ErrorContains(t, err, "mutually exclusive")
+}
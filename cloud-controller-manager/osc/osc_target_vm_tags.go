@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	osc "github.com/outscale/osc-sdk-go/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Target VM Tags *********************
+
+// defaultTargetVMTagsResyncInterval is the default interval of the resync of the backends
+// selected by tags, see TargetVMTagsResyncIntervalSeconds
+const defaultTargetVMTagsResyncInterval = time.Minute
+
+// parseTargetVMTags parses the comma separated list of "<key>=<value>" tags of the
+// ServiceAnnotationLoadBalancerTargetVMTags annotation
+func parseTargetVMTags(value string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, tagValue, found := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("target tag %q: expected <key>=<value>", entry)
+		}
+		if _, duplicate := tags[key]; duplicate {
+			return nil, fmt.Errorf("target tag %q: tag %s is selected twice", entry, key)
+		}
+		tags[key] = strings.TrimSpace(tagValue)
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no target tag")
+	}
+	return tags, nil
+}
+
+// getTargetVMTags returns the tags selecting the backend VMs of the service, or nil when the
+// backends are the nodes of the cluster
+func getTargetVMTags(annotations map[string]string) (map[string]string, error) {
+	value, found := annotations[ServiceAnnotationLoadBalancerTargetVMTags]
+	if !found {
+		return nil, nil
+	}
+	tags, err := parseTargetVMTags(value)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing service annotation %s=%s: %v", ServiceAnnotationLoadBalancerTargetVMTags, value, err)
+	}
+	return tags, nil
+}
+
+// hasTargetVMTags returns whether the backend VMs of the service are selected by tags
+// rather than from the nodes
+func hasTargetVMTags(annotations map[string]string) bool {
+	_, found := annotations[ServiceAnnotationLoadBalancerTargetVMTags]
+	return found
+}
+
+// findBackendInstances returns the backend instances of the load balancer: the running VMs of
+// the net of the cluster having the tags of the ServiceAnnotationLoadBalancerTargetVMTags
+// annotation when set, the VMs of the nodes otherwise
+func (c *Cloud) findBackendInstances(annotations map[string]string, nodes []*v1.Node) (map[InstanceID]*osc.Vm, error) {
+	klog.V(5).Infof("findBackendInstances(%v, %v)", annotations, nodes)
+	tags, err := getTargetVMTags(annotations)
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		return c.findInstancesForELB(nodes)
+	}
+	instances, err := c.instanceService.getInstancesByTags(c.vpcID, tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		klog.Warningf("No running VM has the target tags %s", formatResourceTags(tags))
+	}
+	return instances, nil
+}
+
+// filterNodeBackendInstances filters the instances on the local endpoints of the service, see
+// filterLocalEndpointInstances, unless the backends are selected by tags: these VMs are not
+// necessarily nodes.
+func (c *Cloud) filterNodeBackendInstances(service *v1.Service, annotations map[string]string, nodes []*v1.Node,
+	instances map[InstanceID]*osc.Vm) map[InstanceID]*osc.Vm {
+	if hasTargetVMTags(annotations) {
+		return instances
+	}
+	return c.filterLocalEndpointInstances(service, nodes, instances)
+}
+
+// targetVMTagsResync periodically updates the backends of the services whose backend VMs
+// are selected by tags: the VMs are not nodes, so the service controller is not notified
+// when they are created, stopped or tagged.
+type targetVMTagsResync struct {
+	cloud    *Cloud
+	interval time.Duration
+}
+
+func newTargetVMTagsResync(cloud *Cloud, interval time.Duration) *targetVMTagsResync {
+	if interval == 0 {
+		interval = defaultTargetVMTagsResyncInterval
+	}
+	return &targetVMTagsResync{
+		cloud:    cloud,
+		interval: interval,
+	}
+}
+
+// run queues the services every interval until stop is closed
+func (r *targetVMTagsResync) run(stop <-chan struct{}) {
+	if r == nil || r.interval <= 0 {
+		return
+	}
+
+	klog.Infof("Starting target VM tags resync (interval %v)", r.interval)
+	go wait.Until(r.sync, r.interval, stop)
+}
+
+// sync puts the services selecting their backend VMs by tags in the backendResync queue
+func (r *targetVMTagsResync) sync() {
+	c := r.cloud
+	if c.serviceInformer == nil || (c.serviceInformerHasSynced != nil && !c.serviceInformerHasSynced()) {
+		klog.V(4).Infof("Service informer not ready, skipping target VM tags resync")
+		return
+	}
+	services, err := c.serviceInformer.Lister().List(labels.Everything())
+	if err != nil {
+		klog.Warningf("Unable to list services for target VM tags resync: %q", err)
+		return
+	}
+	for _, service := range services {
+		if hasTargetVMTags(service.Annotations) {
+			c.backendResync.enqueue(service)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseTargetVMTags(t *testing.T) {
+	tags, err := parseTargetVMTags(" pool=ingress, tier = edge,empty=")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"pool": "ingress", "tier": "edge", "empty": ""}, tags)
+
+	for _, value := range []string{"", "pool", "=ingress", "pool=a,pool=b"} {
+		_, err = parseTargetVMTags(value)
+		assert.Error(t, err, value)
+	}
+
+	tags, err = getTargetVMTags(map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, tags)
+	_, err = getTargetVMTags(map[string]string{ServiceAnnotationLoadBalancerTargetVMTags: "pool"})
+	assert.Error(t, err)
+}
+
+func TestFindBackendInstancesByTags(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	c.vpcID = "vpc-123456"
+
+	newVM := func(id, netID, state string, tags ...osc.ResourceTag) *osc.Vm {
+		return &osc.Vm{VmId: aws.String(id), NetId: aws.String(netID), State: aws.String(state), Tags: &tags}
+	}
+	pool := osc.ResourceTag{Key: "pool", Value: "ingress"}
+	tier := osc.ResourceTag{Key: "tier", Value: "edge"}
+	awsServices.instances = []*osc.Vm{
+		newVM("i-ingress", "vpc-123456", "running", pool, tier),
+		newVM("i-other-tier", "vpc-123456", "running", pool, osc.ResourceTag{Key: "tier", Value: "core"}),
+		newVM("i-stopped", "vpc-123456", "stopped", pool, tier),
+		newVM("i-other-net", "vpc-other", "running", pool, tier),
+	}
+
+	instances, err := c.findBackendInstances(map[string]string{ServiceAnnotationLoadBalancerTargetVMTags: "pool=ingress,tier=edge"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, instances, 1)
+	assert.Contains(t, instances, InstanceID("i-ingress"))
+
+	// Without the annotation, the backends are the nodes
+	instances, err = c.findBackendInstances(map[string]string{}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+
+	assert.True(t, hasTargetVMTags(map[string]string{ServiceAnnotationLoadBalancerTargetVMTags: "pool=ingress"}))
+	assert.False(t, hasTargetVMTags(nil))
+}
+
+func TestTargetVMTagsResync(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	tagged := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "ingress",
+		Annotations: map[string]string{ServiceAnnotationLoadBalancerTargetVMTags: "pool=ingress"},
+	}}
+	nodes := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	client := fake.NewSimpleClientset(tagged, nodes)
+	c.serviceInformer = informers.NewSharedInformerFactory(client, 0).Core().V1().Services()
+	c.serviceInformerHasSynced = func() bool { return true }
+	assert.NoError(t, c.serviceInformer.Informer().GetStore().Add(tagged))
+	assert.NoError(t, c.serviceInformer.Informer().GetStore().Add(nodes))
+
+	// Only the services selecting their VMs by tags are resynced
+	resync := newTargetVMTagsResync(c, 0)
+	assert.Equal(t, defaultTargetVMTagsResyncInterval, resync.interval)
+	resync.sync()
+	if assert.Equal(t, 1, c.backendResync.queue.Len()) {
+		item, _ := c.backendResync.queue.Get()
+		assert.Equal(t, "default/ingress", item)
+	}
+}
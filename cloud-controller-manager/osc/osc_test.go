@@ -684,6 +684,73 @@ func TestNodeAddressesWithMetadata(t *testing.T) {
 	testHasNodeAddress(t, addrs, v1.NodeExternalIP, "2.3.4.5")
 }
 
+func TestNodeAddressesWithMetadataDualStack(t *testing.T) {
+	var instance osc.Vm
+	var tag osc.ResourceTag
+	tag.SetKey(TagNameKubernetesClusterLegacy)
+	tag.SetValue(TestClusterID)
+	instance.SetVmId("i-0")
+	instance.SetPrivateDnsName("instance.ec2.internal")
+	instance.SetPlacement(osc.Placement{SubregionName: aws.String("us-east-1a")})
+	instance.SetTags([]osc.ResourceTag{tag})
+	instance.State = aws.String("running")
+
+	awsCloud, awsServices := mockInstancesResp(&instance, []*osc.Vm{&instance})
+	awsServices.networkInterfacesMacs = []string{"0a:26:89:f3:9c:f6"}
+	awsServices.networkInterfacesPrivateIPs = [][]string{{"192.168.0.1"}}
+	awsServices.networkInterfacesIPv6s = [][]string{{"2001:db8::1"}}
+
+	addrs, err := awsCloud.NodeAddresses(context.TODO(), "")
+	assert.NoError(t, err)
+	for _, addr := range addrs {
+		assert.NotEqual(t, "2001:db8::1", addr.Address, "IPv6 addresses are only reported when enabled")
+	}
+
+	awsCloud.nodeIPFamilies = []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol}
+	addrs, err = awsCloud.NodeAddresses(context.TODO(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, v1.NodeAddress{Type: v1.NodeInternalIP, Address: "2001:db8::1"}, addrs[0])
+	testHasNodeAddress(t, addrs, v1.NodeInternalIP, "192.168.0.1")
+}
+
+func TestSortNodeAddressesByIPFamily(t *testing.T) {
+	addresses := []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+		{Type: v1.NodeInternalIP, Address: "2001:db8::1"},
+		{Type: v1.NodeExternalIP, Address: "2.3.4.5"},
+		{Type: v1.NodeHostName, Address: "ip-10-0-0-1"},
+	}
+
+	assert.Equal(t, addresses, sortNodeAddressesByIPFamily(addresses, nil))
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+		{Type: v1.NodeExternalIP, Address: "2.3.4.5"},
+		{Type: v1.NodeHostName, Address: "ip-10-0-0-1"},
+		{Type: v1.NodeInternalIP, Address: "2001:db8::1"},
+	}, sortNodeAddressesByIPFamily(addresses, []v1.IPFamily{v1.IPv4Protocol}))
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "2001:db8::1"},
+		{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+		{Type: v1.NodeExternalIP, Address: "2.3.4.5"},
+		{Type: v1.NodeHostName, Address: "ip-10-0-0-1"},
+	}, sortNodeAddressesByIPFamily(addresses, []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol}))
+}
+
+func TestParseNodeIPFamilies(t *testing.T) {
+	families, err := parseNodeIPFamilies("")
+	assert.NoError(t, err)
+	assert.Empty(t, families)
+
+	families, err = parseNodeIPFamilies("IPv6, ipv4")
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol}, families)
+
+	_, err = parseNodeIPFamilies("ipv4,ipv4")
+	assert.Error(t, err)
+	_, err = parseNodeIPFamilies("ipv5")
+	assert.Error(t, err)
+}
+
 func TestParseMetadataLocalHostname(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -863,10 +930,10 @@ func TestSubnetIDsinVPC(t *testing.T) {
 	rt, err := awsServices.compute.ReadRouteTables(request2222)
 	t.Logf("awsServices.ec2.DescribeRouteTables----: %v", rt)
 
-	subnetsRes, err := c.findSubnets()
+	subnetsRes, err := c.subnetService.findSubnets()
 	t.Logf("subnetsRes, err----: %v", subnetsRes)
 
-	result, err := c.findELBSubnets(false)
+	result, err := c.subnetService.findELBSubnets(false)
 	if err != nil {
 		t.Errorf("Error listing subnets: %v", err)
 		return
@@ -896,7 +963,7 @@ func TestSubnetIDsinVPC(t *testing.T) {
 		awsServices.compute.CreateRouteTable(rt)
 	}
 
-	result, err = c.findELBSubnets(false)
+	result, err = c.subnetService.findELBSubnets(false)
 	if err != nil {
 		t.Errorf("Error listing subnets: %v", err)
 		return
@@ -942,7 +1009,7 @@ func TestSubnetIDsinVPC(t *testing.T) {
 		awsServices.compute.CreateRouteTable(rt)
 	}
 
-	result, err = c.findELBSubnets(false)
+	result, err = c.subnetService.findELBSubnets(false)
 	if err != nil {
 		t.Errorf("Error listing subnets: %v", err)
 		return
@@ -989,7 +1056,7 @@ func TestSubnetIDsinVPC(t *testing.T) {
 	for _, rt := range constructedRouteTables {
 		awsServices.compute.CreateRouteTable(rt)
 	}
-	result, err = c.findELBSubnets(false)
+	result, err = c.subnetService.findELBSubnets(false)
 	if err != nil {
 		t.Errorf("Error listing subnets: %v", err)
 		return
@@ -1183,7 +1250,7 @@ func TestFindInstanceByNodeNameExcludesTerminatedInstances(t *testing.T) {
 			return
 		}
 
-		resultInstance, err := c.findInstanceByNodeName(nodeName)
+		resultInstance, err := c.instanceService.findInstanceByNodeName(nodeName)
 
 		if awsState.expected {
 			if err != nil || resultInstance == nil {
@@ -1225,7 +1292,7 @@ func TestGetInstanceByNodeNameBatching(t *testing.T) {
 
 	}
 
-	instances, err := c.getInstancesByNodeNames(nodeNames)
+	instances, err := c.instanceService.getInstancesByNodeNames(nodeNames)
 	assert.Nil(t, err, "Error getting instances by nodeNames %v: %v", nodeNames, err)
 	assert.NotEmpty(t, instances)
 	assert.Equal(t, 200, len(instances), "Expected 200 but got less")
@@ -1514,9 +1581,9 @@ func TestLBExtraSecurityGroupsAnnotation(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			serviceName := types.NamespacedName{Namespace: "default", Name: "myservice"}
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "myservice"}}
 
-			sgList, err := c.buildELBSecurityGroupList(serviceName, "aid", test.annotations)
+			sgList, err := c.buildELBSecurityGroupList(service, "aid", test.annotations)
 			assert.NoError(t, err, "buildELBSecurityGroupList failed")
 			extraSGs := sgList[1:]
 			assert.True(t, sets.NewString(test.expectedSGs...).Equal(sets.NewString(extraSGs...)),
@@ -1548,9 +1615,9 @@ func TestLBSecurityGroupsAnnotation(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			serviceName := types.NamespacedName{Namespace: "default", Name: "myservice"}
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "myservice"}}
 
-			sgList, err := c.buildELBSecurityGroupList(serviceName, "aid", test.annotations)
+			sgList, err := c.buildELBSecurityGroupList(service, "aid", test.annotations)
 			assert.NoError(t, err, "buildELBSecurityGroupList failed")
 			assert.True(t, sets.NewString(test.expectedSGs...).Equal(sets.NewString(sgList...)),
 				"Security Groups expected=%q , returned=%q", test.expectedSGs, sgList)
@@ -1578,7 +1645,7 @@ func TestAddLoadBalancerTags(t *testing.T) {
 	}
 	awsServices.elb.(*MockedFakeELB).On("AddTags", expectedAddTagsRequest).Return(&elb.AddTagsOutput{})
 
-	err := c.addLoadBalancerTags(loadBalancerName, want)
+	err := c.loadBalancerService.addLoadBalancerTags(loadBalancerName, want)
 	assert.Nil(t, err, "Error adding load balancer tags: %v", err)
 	awsServices.elb.(*MockedFakeELB).AssertExpectations(t)
 }
@@ -1634,6 +1701,30 @@ func TestEnsureLoadBalancerHealthCheck(t *testing.T) {
 		})
 	}
 
+	t.Run("uses cluster-wide defaults from the cloud config", func(t *testing.T) {
+		awsServices := newMockedFakeAWSServices(TestClusterID)
+		cfg := CloudConfig{}
+		cfg.Global.HealthCheckInterval = 30
+		cfg.Global.HealthCheckUnhealthyThreshold = 3
+		c, err := newCloud(cfg, awsServices)
+		assert.Nil(t, err, "Error building aws cloud: %v", err)
+		expectedHC := *defaultHC
+		interval := int64(30)
+		unhealthyThreshold := int64(3)
+		expectedHC.Interval = &interval
+		expectedHC.UnhealthyThreshold = &unhealthyThreshold
+		// The annotation still takes precedence over the cluster-wide default
+		timeout := int64(7)
+		expectedHC.Timeout = &timeout
+		awsServices.elb.(*MockedFakeELB).expectConfigureHealthCheck(&lbName, &expectedHC, nil)
+
+		err = c.ensureLoadBalancerHealthCheck(elbDesc, protocol, port, path,
+			map[string]string{ServiceAnnotationLoadBalancerHCTimeout: "7"})
+
+		require.Nil(t, err)
+		awsServices.elb.(*MockedFakeELB).AssertExpectations(t)
+	})
+
 	t.Run("does not make an API call if the current health check is the same", func(t *testing.T) {
 		awsServices := newMockedFakeAWSServices(TestClusterID)
 		c, err := newCloud(CloudConfig{}, awsServices)
@@ -1704,7 +1795,7 @@ func TestFindSecurityGroupForInstance(t *testing.T) {
 		SecurityGroups: &[]osc.SecurityGroupLight{
 			{SecurityGroupId: aws.String("sg123"), SecurityGroupName: aws.String("my_group")},
 		},
-	}, groups)
+	}, groups, "")
 	if err != nil {
 		t.Error()
 	}
@@ -1719,7 +1810,7 @@ func TestFindSecurityGroupForInstanceMultipleTagged(t *testing.T) {
 			{SecurityGroupId: aws.String("sg123"), SecurityGroupName: aws.String("my_group")},
 			{SecurityGroupId: aws.String("sg123"), SecurityGroupName: aws.String("another_group")},
 		},
-	}, groups)
+	}, groups, "")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "sg123(my_group)")
 	assert.Contains(t, err.Error(), "sg123(another_group)")
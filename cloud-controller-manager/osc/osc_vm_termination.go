@@ -0,0 +1,232 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM VM Termination Controller *********************
+
+// vmTerminatingStates are the VM states announcing that the VM is about to be reclaimed
+var vmTerminatingStates = []string{"stopping", "shutting-down"}
+
+// vmTerminationController cordons and drains the nodes whose VM is being stopped or
+// terminated. Outscale does not publish interruption notices on the metadata service,
+// so the VM state reported by oAPI is used as the termination notice.
+type vmTerminationController struct {
+	cloud    *Cloud
+	interval time.Duration
+
+	// Nodes whose pods were all evicted, which are not drained again, by UID
+	drained map[types.UID]bool
+}
+
+func newVMTerminationController(cloud *Cloud, interval time.Duration) *vmTerminationController {
+	return &vmTerminationController{
+		cloud:    cloud,
+		interval: interval,
+		drained:  make(map[types.UID]bool),
+	}
+}
+
+// run polls the VMs of the nodes every interval until stop is closed
+func (t *vmTerminationController) run(stop <-chan struct{}) {
+	if t == nil || t.interval <= 0 {
+		return
+	}
+
+	klog.Infof("Starting VM termination controller (interval %v)", t.interval)
+	go wait.Until(t.sync, t.interval, stop)
+}
+
+// sync cordons and drains the nodes whose VM is terminating, and uncordons the nodes whose
+// VM is running again
+func (t *vmTerminationController) sync() {
+	c := t.cloud
+	if c.kubeClient == nil || c.nodeInformerHasSynced == nil || !c.nodeInformerHasSynced() {
+		klog.V(4).Infof("Node informer not ready, skipping VM termination check")
+		return
+	}
+
+	nodes, err := c.nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		klog.Warningf("Unable to list nodes for VM termination check: %q", err)
+		return
+	}
+
+	instanceIDs := []string{}
+	for _, id := range mapToAWSInstanceIDsTolerant(nodes) {
+		instanceIDs = append(instanceIDs, string(id))
+	}
+	vms, err := c.instanceService.getInstancesByIDs(&instanceIDs)
+	if err != nil {
+		klog.Warningf("Unable to read the VMs of the nodes for VM termination check: %q", err)
+		return
+	}
+
+	terminating := make(map[types.UID]bool)
+	for _, node := range nodes {
+		if node.Spec.ProviderID == "" {
+			continue
+		}
+		instanceID, err := KubernetesInstanceID(node.Spec.ProviderID).MapToAWSInstanceID()
+		if err != nil {
+			continue
+		}
+		vm, found := vms[string(instanceID)]
+		_, cordoned := node.Annotations[NodeAnnotationVMTermination]
+		if found && cordoned && vm.GetState() == "running" {
+			// The VM was started again, the termination was cancelled
+			if err := t.uncordon(node); err != nil {
+				klog.Warningf("Unable to uncordon node %s: %q", node.Name, err)
+				continue
+			}
+			klog.Infof("VM %s of node %s is running again, uncordoning the node", instanceID, node.Name)
+			if c.eventRecorder != nil {
+				c.eventRecorder.Eventf(node, v1.EventTypeNormal, "VMTerminationCancelled",
+					"VM %s is running again, uncordoning the node", instanceID)
+			}
+			continue
+		}
+		if !found || !Contains(vmTerminatingStates, vm.GetState()) {
+			continue
+		}
+		terminating[node.UID] = true
+
+		if !cordoned {
+			if err := t.cordon(node, vm.GetState()); err != nil {
+				klog.Warningf("Unable to cordon node %s: %q", node.Name, err)
+				continue
+			}
+			klog.Infof("VM %s of node %s is %s, cordoning and draining the node", instanceID, node.Name, vm.GetState())
+			if c.eventRecorder != nil {
+				c.eventRecorder.Eventf(node, v1.EventTypeWarning, "VMTerminating",
+					"VM %s is %s, cordoning and draining the node", instanceID, vm.GetState())
+			}
+		}
+		if !t.drained[node.UID] && t.drain(node) {
+			t.drained[node.UID] = true
+		}
+	}
+	// The nodes no longer terminating, or deleted, are forgotten
+	for uid := range t.drained {
+		if !terminating[uid] {
+			delete(t.drained, uid)
+		}
+	}
+}
+
+// cordon marks the node unschedulable and records the state of its VM
+func (t *vmTerminationController) cordon(node *v1.Node, state string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				NodeAnnotationVMTermination: state,
+			},
+		},
+		"spec": map[string]interface{}{
+			"unschedulable": true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = t.cloud.kubeClient.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// uncordon marks the node schedulable and removes the state of its VM
+func (t *vmTerminationController) uncordon(node *v1.Node) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				NodeAnnotationVMTermination: nil,
+			},
+		},
+		"spec": map[string]interface{}{
+			"unschedulable": false,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = t.cloud.kubeClient.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// drain evicts the pods of the node, except the mirror and DaemonSet pods, and returns
+// whether all of them were evicted. Evictions refused by a PodDisruptionBudget are retried
+// on the next sync.
+func (t *vmTerminationController) drain(node *v1.Node) bool {
+	ctx := context.TODO()
+	pods, err := t.cloud.kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+	})
+	if err != nil {
+		klog.Warningf("Unable to list the pods of node %s: %q", node.Name, err)
+		return false
+	}
+
+	drained := true
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !evictablePod(pod) {
+			continue
+		}
+		eviction := &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		}
+		err := t.cloud.kubeClient.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		if err != nil {
+			klog.V(2).Infof("Unable to evict pod %s/%s from node %s: %q", pod.Namespace, pod.Name, node.Name, err)
+			drained = false
+			continue
+		}
+		klog.V(2).Infof("Evicted pod %s/%s from node %s", pod.Namespace, pod.Name, node.Name)
+	}
+	return drained
+}
+
+// evictablePod checks whether the pod must be evicted when draining its node
+func evictablePod(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return false
+	}
+	if _, mirror := pod.Annotations[v1.MirrorPodAnnotationKey]; mirror {
+		return false
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestEvictablePod(t *testing.T) {
+	assert.True(t, evictablePod(&v1.Pod{}))
+	assert.False(t, evictablePod(&v1.Pod{Status: v1.PodStatus{Phase: v1.PodSucceeded}}))
+	assert.False(t, evictablePod(&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{v1.MirrorPodAnnotationKey: "mirror"},
+	}}))
+	assert.False(t, evictablePod(&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "kube-proxy"}},
+	}}))
+}
+
+func TestVMTerminationController(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	assert.NoError(t, err)
+
+	vm := &osc.Vm{VmId: aws.String("i-aaaaaaaa"), State: aws.String("running")}
+	awsServices.instances = append(awsServices.instances, vm)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       v1.NodeSpec{ProviderID: "aws:///eu-west-2a/i-aaaaaaaa"},
+	}
+	appPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: "node-a"},
+	}
+	daemonPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "kube-proxy",
+			Namespace:       "kube-system",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "kube-proxy"}},
+		},
+		Spec: v1.PodSpec{NodeName: "node-a"},
+	}
+
+	client := fake.NewSimpleClientset(node, appPod, daemonPod)
+	c.kubeClient = client
+	c.nodeInformer = informers.NewSharedInformerFactory(client, 0).Core().V1().Nodes()
+	c.nodeInformerHasSynced = func() bool { return true }
+	assert.NoError(t, c.nodeInformer.Informer().GetStore().Add(node))
+
+	evicted := []string{}
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "eviction" {
+			eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+			evicted = append(evicted, eviction.Namespace+"/"+eviction.Name)
+			return true, nil, nil
+		}
+		return false, nil, nil
+	})
+
+	controller := newVMTerminationController(c, time.Minute)
+	controller.sync()
+	current, err := client.CoreV1().Nodes().Get(context.TODO(), "node-a", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.False(t, current.Spec.Unschedulable, "nodes with a running VM are left untouched")
+	assert.Empty(t, evicted)
+
+	vm.State = aws.String("stopping")
+	controller.sync()
+	current, err = client.CoreV1().Nodes().Get(context.TODO(), "node-a", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.True(t, current.Spec.Unschedulable)
+	assert.Equal(t, "stopping", current.Annotations[NodeAnnotationVMTermination])
+	assert.Equal(t, []string{"default/app"}, evicted)
+
+	// The drained node is not drained again
+	assert.NoError(t, c.nodeInformer.Informer().GetStore().Update(current))
+	controller.sync()
+	assert.Equal(t, []string{"default/app"}, evicted)
+
+	// The node is uncordoned when the VM is running again
+	vm.State = aws.String("running")
+	controller.sync()
+	current, err = client.CoreV1().Nodes().Get(context.TODO(), "node-a", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.False(t, current.Spec.Unschedulable)
+	assert.NotContains(t, current.Annotations, NodeAnnotationVMTermination)
+	assert.Empty(t, controller.drained)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// ********************* CCM Cluster Zones *********************
+
+// zoneCacheTTL is how long the zones of the cluster are cached: subnets are rarely added
+const zoneCacheTTL = 5 * time.Minute
+
+// ClusterZone is a subregion where the cluster has subnets
+type ClusterZone struct {
+	// Name of the subregion, e.g. eu-west-2a
+	Name string
+	// SubnetIDs are the sorted IDs of the subnets of the cluster in the subregion
+	SubnetIDs []string
+	// AvailableIPs is the number of available IPs of these subnets, a hint of the capacity
+	// left in the subregion
+	AvailableIPs int
+}
+
+// ZoneLister is implemented by the cloud provider for the other controllers of the cluster,
+// e.g. for the CSI topology or the cluster autoscaler, which get the cloud provider with
+// cloudprovider.GetCloudProvider(ProviderName, config)
+type ZoneLister interface {
+	// GetClusterZones returns the subregions where the cluster has subnets, sorted by name
+	GetClusterZones(ctx context.Context) ([]ClusterZone, error)
+}
+
+var _ ZoneLister = &Cloud{}
+
+// zoneCache caches the zones of the cluster, built from the subnets tagged for the cluster
+type zoneCache struct {
+	subnets    SubnetService
+	ttl        time.Duration
+	mutex      sync.Mutex
+	zones      []ClusterZone
+	expiry     time.Time
+	timeSource func() time.Time
+}
+
+func newZoneCache(subnets SubnetService, ttl time.Duration) *zoneCache {
+	return &zoneCache{subnets: subnets, ttl: ttl, timeSource: time.Now}
+}
+
+// list returns the cached zones, listed again once expired
+func (z *zoneCache) list() ([]ClusterZone, error) {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	now := z.timeSource()
+	if z.zones == nil || !now.Before(z.expiry) {
+		subnets, err := z.subnets.findSubnets()
+		if err != nil {
+			return nil, err
+		}
+		byName := make(map[string]*ClusterZone)
+		for _, subnet := range subnets {
+			name := subnet.GetSubregionName()
+			if name == "" {
+				continue
+			}
+			zone, found := byName[name]
+			if !found {
+				zone = &ClusterZone{Name: name}
+				byName[name] = zone
+			}
+			zone.SubnetIDs = append(zone.SubnetIDs, subnet.GetSubnetId())
+			zone.AvailableIPs += int(subnet.GetAvailableIpsCount())
+		}
+		z.zones = make([]ClusterZone, 0, len(byName))
+		for _, zone := range byName {
+			sort.Strings(zone.SubnetIDs)
+			z.zones = append(z.zones, *zone)
+		}
+		sort.Slice(z.zones, func(i, j int) bool { return z.zones[i].Name < z.zones[j].Name })
+		z.expiry = now.Add(z.ttl)
+		klog.V(4).Infof("Listed the zones of the cluster: %v", z.zones)
+	}
+
+	// The callers get their own copy
+	zones := make([]ClusterZone, len(z.zones))
+	for i, zone := range z.zones {
+		zones[i] = zone
+		zones[i].SubnetIDs = append([]string{}, zone.SubnetIDs...)
+	}
+	return zones, nil
+}
+
+// GetClusterZones returns the subregions where the cluster has tagged subnets, or the subnet
+// of the CCM when none is tagged, with the available IPs of the subnets as capacity hint. The
+// zones are cached for zoneCacheTTL.
+func (c *Cloud) GetClusterZones(ctx context.Context) ([]ClusterZone, error) {
+	klog.V(5).Infof("GetClusterZones()")
+	return c.zones.list()
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	osc "github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetClusterZones(t *testing.T) {
+	awsServices := NewFakeAWSServices(TestClusterID)
+	c, err := newCloud(CloudConfig{}, awsServices)
+	require.NoError(t, err)
+	c.vpcID = "vpc-123456"
+	now := time.Now()
+	c.zones.timeSource = func() time.Time { return now }
+
+	clusterTag := osc.ResourceTag{Key: fmt.Sprintf("%s%s", TagNameKubernetesClusterPrefix, TestClusterID), Value: ResourceLifecycleOwned}
+	newSubnet := func(id, az string, availableIPs int32, tags ...osc.ResourceTag) osc.Subnet {
+		return osc.Subnet{SubnetId: aws.String(id), SubregionName: aws.String(az), AvailableIpsCount: &availableIPs, Tags: &tags}
+	}
+	compute := awsServices.compute.(*FakeComputeImpl)
+	compute.Subnets = []osc.Subnet{
+		newSubnet("subnet-b2", "eu-west-2b", 10, clusterTag),
+		newSubnet("subnet-a", "eu-west-2a", 250, clusterTag),
+		newSubnet("subnet-b1", "eu-west-2b", 5, clusterTag),
+		newSubnet("subnet-other", "eu-west-2c", 100),
+	}
+
+	expected := []ClusterZone{
+		{Name: "eu-west-2a", SubnetIDs: []string{"subnet-a"}, AvailableIPs: 250},
+		{Name: "eu-west-2b", SubnetIDs: []string{"subnet-b1", "subnet-b2"}, AvailableIPs: 15},
+	}
+	zones, err := c.GetClusterZones(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, expected, zones)
+
+	// The zones are cached, and the callers can't change the cache
+	zones[0].SubnetIDs[0] = "changed"
+	compute.Subnets = append(compute.Subnets, newSubnet("subnet-c", "eu-west-2c", 100, clusterTag))
+	zones, err = c.GetClusterZones(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, expected, zones)
+
+	now = now.Add(zoneCacheTTL)
+	zones, err = c.GetClusterZones(context.TODO())
+	require.NoError(t, err)
+	assert.Len(t, zones, 3)
+}
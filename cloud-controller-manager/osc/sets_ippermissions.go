@@ -22,6 +22,7 @@ package osc
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/outscale/osc-sdk-go/v2"
@@ -136,6 +137,55 @@ func (s IPRulesSet) Ungroup() IPRulesSet {
 	return NewIPRulesSet(l3...)
 }
 
+// Compact regroups the rules with the same protocol and ports opened to IP ranges into a
+// single rule with the merged ranges, as OSC groups them. The rules opened to security
+// groups or services are returned unchanged. The result is sorted, for stable requests.
+func (s IPRulesSet) Compact() []osc.SecurityGroupRule {
+	grouped := make(map[string]*osc.SecurityGroupRule)
+	ranges := make(map[string]map[string]bool)
+	l := []osc.SecurityGroupRule{}
+	for _, p := range s {
+		if len(p.GetIpRanges()) == 0 || len(p.GetSecurityGroupsMembers()) > 0 || len(p.GetServiceIds()) > 0 {
+			l = append(l, p)
+			continue
+		}
+		k := fmt.Sprintf("%s/%d/%d", p.GetIpProtocol(), p.GetFromPortRange(), p.GetToPortRange())
+		if _, found := grouped[k]; !found {
+			c := p
+			grouped[k] = &c
+			ranges[k] = make(map[string]bool)
+		}
+		for _, ipRange := range p.GetIpRanges() {
+			ranges[k][ipRange] = true
+		}
+	}
+	for k, p := range grouped {
+		ipRanges := make([]string, 0, len(ranges[k]))
+		for ipRange := range ranges[k] {
+			ipRanges = append(ipRanges, ipRange)
+		}
+		sort.Strings(ipRanges)
+		p.IpRanges = &ipRanges
+		l = append(l, *p)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return keyForIPRules(&l[i]) < keyForIPRules(&l[j])
+	})
+	return l
+}
+
+// Union returns a set of the objects in s or in s2
+func (s IPRulesSet) Union(s2 IPRulesSet) IPRulesSet {
+	result := NewIPRulesSet()
+	for k, v := range s {
+		result[k] = v
+	}
+	for k, v := range s2 {
+		result[k] = v
+	}
+	return result
+}
+
 // Insert adds items to the set.
 func (s IPRulesSet) Insert(items ...osc.SecurityGroupRule) {
 	for _, p := range items {
@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -66,10 +67,54 @@ type resourceTagging struct {
 
 	// usesLegacyTags is true if we are using the legacy TagNameKubernetesClusterLegacy tags
 	usesLegacyTags bool
+
+	// namePrefix is prepended to the names of the resources created by the cloud provider
+	namePrefix string
+
+	// managedBy is the ClusterID of the cluster reconciling the resources, when they are
+	// owned by another cluster
+	managedBy string
+
+	// extraTags are set on all the resources created by the cloud provider, see ResourceTags
+	extraTags map[string]string
+
+	// prefix is the prefix of the cluster tag key, TagNameKubernetesClusterPrefix when empty,
+	// see KubernetesClusterTagPrefix
+	prefix string
+
+	// legacyPrefixes are the prefixes of the cluster tag keys which are also recognized when
+	// reading the resources, but never set, see LegacyKubernetesClusterTagPrefixes
+	legacyPrefixes []string
+}
+
+// parseClusterTagPrefixes parses the KubernetesClusterTagPrefix and the comma separated
+// LegacyKubernetesClusterTagPrefixes of the cloud config. The legacy prefixes are returned
+// without the prefix of the cluster and without duplicates.
+func parseClusterTagPrefixes(prefix string, legacyPrefixes string) (string, []string, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		prefix = TagNameKubernetesClusterPrefix
+	}
+	if strings.ContainsAny(prefix, "=,") {
+		return "", nil, fmt.Errorf("invalid cluster tag prefix %q", prefix)
+	}
+	legacy := []string{}
+	seen := map[string]bool{prefix: true}
+	for _, legacyPrefix := range strings.Split(legacyPrefixes, ",") {
+		legacyPrefix = strings.TrimSpace(legacyPrefix)
+		if legacyPrefix == "" || seen[legacyPrefix] {
+			continue
+		}
+		if strings.Contains(legacyPrefix, "=") {
+			return "", nil, fmt.Errorf("invalid legacy cluster tag prefix %q", legacyPrefix)
+		}
+		seen[legacyPrefix] = true
+		legacy = append(legacy, legacyPrefix)
+	}
+	return prefix, legacy, nil
 }
 
 func tagNameKubernetesCluster() string {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("tagNameKubernetesCluster()")
 	val, ok := os.LookupEnv("TAG_NAME_KUBERNETES_CLUSTER")
 	if !ok {
@@ -78,22 +123,27 @@ func tagNameKubernetesCluster() string {
 	return val
 }
 
-// Extracts the legacy & new cluster ids from the given tags, if they are present
+// Extracts the legacy & new cluster ids from the given tags, if they are present, the new
+// cluster id being read from the tags with one of the given prefixes
 // If duplicate tags are found, returns an error
-func findClusterIDs(tags *[]osc.ResourceTag) (string, string, error) {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("findClusterIDs(%v)", tags)
+func findClusterIDs(tags *[]osc.ResourceTag, prefixes []string) (string, string, error) {
+	klog.V(5).Infof("findClusterIDs(%v, %v)", tags, prefixes)
 	legacyClusterID := ""
 	newClusterID := ""
 
 	for _, tag := range *tags {
 		tagKey := tag.GetKey()
-		if strings.HasPrefix(tagKey, TagNameKubernetesClusterPrefix) {
-			id := strings.TrimPrefix(tagKey, TagNameKubernetesClusterPrefix)
-			if newClusterID != "" {
-				return "", "", fmt.Errorf("Found multiple cluster tags with prefix %s (%q and %q)", TagNameKubernetesClusterPrefix, newClusterID, id)
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(tagKey, prefix) {
+				continue
+			}
+			// A resource migrated from other tooling may have the cluster tag with several prefixes
+			id := strings.TrimPrefix(tagKey, prefix)
+			if newClusterID != "" && newClusterID != id {
+				return "", "", fmt.Errorf("Found multiple cluster tags with prefixes %v (%q and %q)", prefixes, newClusterID, id)
 			}
 			newClusterID = id
+			break
 		}
 
 		if tagKey == tagNameKubernetesCluster() {
@@ -109,7 +159,6 @@ func findClusterIDs(tags *[]osc.ResourceTag) (string, string, error) {
 }
 
 func (t *resourceTagging) init(legacyClusterID string, clusterID string) error {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("init(%v,%v)", legacyClusterID, clusterID)
 	if legacyClusterID != "" {
 		if clusterID != "" && legacyClusterID != clusterID {
@@ -134,37 +183,139 @@ func (t *resourceTagging) init(legacyClusterID string, clusterID string) error {
 // If no clusterID is found, returns "", nil
 // If multiple (different) clusterIDs are found, returns an error
 func (t *resourceTagging) initFromTags(tags *[]osc.ResourceTag) error {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("initFromTags(%v)", tags)
-	legacyClusterID, newClusterID, err := findClusterIDs(tags)
+	legacyClusterID, newClusterID, err := findClusterIDs(tags, t.clusterTagPrefixes())
 	if err != nil {
 		return err
 	}
 
 	if legacyClusterID == "" && newClusterID == "" {
-		klog.Errorf("Tag %q nor %q not found; Kubernetes may behave unexpectedly.", tagNameKubernetesCluster(), TagNameKubernetesClusterPrefix+"...")
+		klog.Errorf("Tag %q nor %q not found; Kubernetes may behave unexpectedly.", tagNameKubernetesCluster(), t.clusterTagPrefix()+"...")
 	}
 
 	return t.init(legacyClusterID, newClusterID)
 }
 
+// clusterTagPrefix returns the prefix of the cluster tag key set on the resources
+func (t *resourceTagging) clusterTagPrefix() string {
+	if t.prefix == "" {
+		return TagNameKubernetesClusterPrefix
+	}
+	return t.prefix
+}
+
+// clusterTagPrefixes returns the prefixes of the cluster tag keys recognized when reading
+// the resources: the prefix of the cluster then the legacy prefixes
+func (t *resourceTagging) clusterTagPrefixes() []string {
+	return append([]string{t.clusterTagPrefix()}, t.legacyPrefixes...)
+}
+
 func (t *resourceTagging) clusterTagKey() string {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("clusterTagKey()")
-	return TagNameKubernetesClusterPrefix + t.ClusterID
+	return t.clusterTagPrefix() + t.ClusterID
+}
+
+// clusterTagKeys returns the cluster tag keys recognized when reading the resources, to
+// filter them: the resources match any of the keys
+func (t *resourceTagging) clusterTagKeys() []string {
+	keys := []string{}
+	for _, prefix := range t.clusterTagPrefixes() {
+		keys = append(keys, prefix+t.ClusterID)
+	}
+	return keys
+}
+
+// clusterTagKeysFilter returns the cluster tag keys as a TagKeys filter of the oAPI
+func (t *resourceTagging) clusterTagKeysFilter() *[]string {
+	keys := t.clusterTagKeys()
+	return &keys
+}
+
+// isClusterTagKey returns whether the key is one of the cluster tag keys
+func (t *resourceTagging) isClusterTagKey(key string) bool {
+	for _, prefix := range t.clusterTagPrefixes() {
+		if key == prefix+t.ClusterID {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterTagLifecycle returns the value of the cluster tag in the given tags, read from
+// the key of the cluster first then the legacy keys, or "" when the tag is missing
+func (t *resourceTagging) clusterTagLifecycle(tags map[string]string) string {
+	for _, key := range t.clusterTagKeys() {
+		if value, found := tags[key]; found {
+			return value
+		}
+	}
+	return ""
 }
 
 // To delete after last call to this function
 func (t *resourceTagging) hasClusterAWSTag(tags []*ec2.Tag) bool {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("hasClusterAWSTag(%v)", tags)
 	// if the clusterID is not configured -- we consider all instances.
 	if len(t.ClusterID) == 0 {
 		return true
 	}
-	clusterTagKey := t.clusterTagKey()
 	for _, tag := range tags {
-		if aws.StringValue(tag.Key) == clusterTagKey {
+		if t.isClusterTagKey(aws.StringValue(tag.Key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// withOwner returns the tagging of the resources owned by the given cluster but reconciled
+// by this one, or t itself when the owner is this cluster
+func (t *resourceTagging) withOwner(ownerClusterID string) *resourceTagging {
+	if ownerClusterID == "" || ownerClusterID == t.ClusterID {
+		return t
+	}
+	return &resourceTagging{
+		ClusterID:      ownerClusterID,
+		namePrefix:     t.namePrefix,
+		managedBy:      t.ClusterID,
+		extraTags:      t.extraTags,
+		prefix:         t.prefix,
+		legacyPrefixes: t.legacyPrefixes,
+	}
+}
+
+// withoutExtraTags returns the tagging without the extraTags, for the resources which are
+// not created by the cloud provider
+func (t *resourceTagging) withoutExtraTags() *resourceTagging {
+	if len(t.extraTags) == 0 {
+		return t
+	}
+	tagging := *t
+	tagging.extraTags = nil
+	return &tagging
+}
+
+// isManagedBy returns whether the resource is owned by another cluster but reconciled
+// by this one
+func (t *resourceTagging) isManagedBy(tags *[]osc.ResourceTag) bool {
+	if len(t.ClusterID) == 0 || tags == nil {
+		return false
+	}
+	for _, tag := range *tags {
+		if tag.GetKey() == TagNameManagedBy && tag.GetValue() == t.ClusterID {
+			return true
+		}
+	}
+	return false
+}
+
+// isManagedByOtherCluster returns whether the resource is reconciled by another cluster,
+// which alone may delete it
+func (t *resourceTagging) isManagedByOtherCluster(tags *[]osc.ResourceTag) bool {
+	if tags == nil {
+		return false
+	}
+	for _, tag := range *tags {
+		if tag.GetKey() == TagNameManagedBy && tag.GetValue() != t.ClusterID {
 			return true
 		}
 	}
@@ -172,15 +323,13 @@ func (t *resourceTagging) hasClusterAWSTag(tags []*ec2.Tag) bool {
 }
 
 func (t *resourceTagging) hasClusterTag(tags *[]osc.ResourceTag) bool {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("hasClusterTag(%v)", tags)
 	// if the clusterID is not configured -- we consider all instances.
 	if len(t.ClusterID) == 0 {
 		return true
 	}
-	clusterTagKey := t.clusterTagKey()
 	for _, tag := range *tags {
-		if tag.GetKey() == clusterTagKey {
+		if t.isClusterTagKey(tag.GetKey()) {
 			return true
 		}
 	}
@@ -191,7 +340,6 @@ func (t *resourceTagging) hasClusterTag(tags *[]osc.ResourceTag) bool {
 // If it has no tags, we assume that this was a problem caused by an error in between creation and tagging,
 // and we add the tags.  If it has a different cluster's tags, that is an error.
 func (t *resourceTagging) readRepairClusterTags(client Compute, resourceID string, lifecycle ResourceLifecycle, additionalTags map[string]string, observedTags *[]osc.ResourceTag) error {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("readRepairClusterTags(%v, %v, %v, %v, %v)",
 		client, resourceID, lifecycle, additionalTags, observedTags)
 	actualTagMap := make(map[string]string)
@@ -233,7 +381,6 @@ func (t *resourceTagging) readRepairClusterTags(client Compute, resourceID strin
 // We retry mainly because if we create an object, we cannot tag it until it is "fully created" (eventual consistency)
 // The error code varies though (depending on what we are tagging), so we simply retry on all errors
 func (t *resourceTagging) createTags(client Compute, resourceID string, lifecycle ResourceLifecycle, additionalTags map[string]string) error {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("createTags(%v,%v,%v,%v)", client, resourceID, lifecycle, additionalTags)
 
 	tags := t.buildTags(lifecycle, additionalTags)
@@ -285,7 +432,6 @@ func (t *resourceTagging) createTags(client Compute, resourceID string, lifecycl
 // Add additional filters, to match on our tags
 // This lets us run multiple k8s clusters in a single EC2 AZ
 func (t *resourceTagging) addFilters(filters []*ec2.Filter) []*ec2.Filter {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("addFilters(%v)", filters)
 	// if there are no clusterID configured - no filtering by special tag names
 	// should be applied to revert to legacy behaviour.
@@ -298,7 +444,7 @@ func (t *resourceTagging) addFilters(filters []*ec2.Filter) []*ec2.Filter {
 		return filters
 	}
 
-	f := newEc2Filter("tag-key", t.clusterTagKey())
+	f := newEc2Filter("tag-key", t.clusterTagKeys()...)
 	filters = append(filters, f)
 	return filters
 }
@@ -308,7 +454,6 @@ func (t *resourceTagging) addFilters(filters []*ec2.Filter) []*ec2.Filter {
 //
 // This lets us run multiple k8s clusters in a single EC2 AZ
 func (t *resourceTagging) addLegacyFilters(filters []*ec2.Filter) []*ec2.Filter {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("addLegacyFilters(%v)", filters)
 	// if there are no clusterID configured - no filtering by special tag names
 	// should be applied to revert to legacy behaviour.
@@ -330,12 +475,20 @@ func (t *resourceTagging) addLegacyFilters(filters []*ec2.Filter) []*ec2.Filter
 }
 
 func (t *resourceTagging) buildTags(lifecycle ResourceLifecycle, additionalTags map[string]string) map[string]string {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("buildTags(%v,%v)", lifecycle, additionalTags)
 	tags := make(map[string]string)
+	for k, v := range t.extraTags {
+		tags[k] = v
+	}
 	for k, v := range additionalTags {
 		tags[k] = v
 	}
+	if t.namePrefix != "" {
+		tags[TagNameResourceNamePrefix] = t.namePrefix
+	}
+	if t.managedBy != "" {
+		tags[TagNameManagedBy] = t.managedBy
+	}
 
 	// no clusterID is a sign of misconfigured cluster, but we can't be tagging the resources with empty
 	// strings
@@ -353,7 +506,34 @@ func (t *resourceTagging) buildTags(lifecycle ResourceLifecycle, additionalTags
 }
 
 func (t *resourceTagging) clusterID() string {
-	debugPrintCallerFunctionName()
 	klog.V(5).Infof("clusterID()")
 	return t.ClusterID
 }
+
+// prefixedName prepends the resource name prefix of the cluster to the name
+func (t *resourceTagging) prefixedName(name string) string {
+	if t.namePrefix == "" {
+		return name
+	}
+	return t.namePrefix + "-" + name
+}
+
+// sanitizeLoadBalancerName turns the name into a valid load balancer name part:
+// characters other than alphanumerics and hyphens are replaced by hyphens
+func sanitizeLoadBalancerName(name string) string {
+	sanitized := strings.Trim(regexp.MustCompile("[^a-zA-Z0-9-]+").ReplaceAllString(name, "-"), "-")
+	return regexp.MustCompile("-{2,}").ReplaceAllString(sanitized, "-")
+}
+
+// sanitizeResourceNamePrefix turns the prefix into a valid load balancer name part,
+// see sanitizeLoadBalancerName
+func sanitizeResourceNamePrefix(prefix string) (string, error) {
+	sanitized := sanitizeLoadBalancerName(prefix)
+	if prefix != "" && sanitized == "" {
+		return "", fmt.Errorf("prefix %q has no alphanumeric character", prefix)
+	}
+	if len(sanitized) > ResourceNamePrefixMaxLength {
+		return "", fmt.Errorf("prefix %q is longer than %d characters", sanitized, ResourceNamePrefixMaxLength)
+	}
+	return sanitized, nil
+}
@@ -20,11 +20,16 @@ limitations under the License.
 package osc
 
 import (
+	"context"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestFilterTags(t *testing.T) {
@@ -95,7 +100,7 @@ func TestFindClusterID(t *testing.T) {
 		for k, v := range g.Tags {
 			ec2Tags = append(ec2Tags, osc.ResourceTag{Key: k, Value: v})
 		}
-		actualLegacy, actualNew, err := findClusterIDs(&ec2Tags)
+		actualLegacy, actualNew, err := findClusterIDs(&ec2Tags, []string{TagNameKubernetesClusterPrefix})
 		if g.ExpectError {
 			if err == nil {
 				t.Errorf("expected error for tags %v", g.Tags)
@@ -184,3 +189,82 @@ func TestHasClusterTag(t *testing.T) {
 		}
 	}
 }
+
+func TestSanitizeResourceNamePrefix(t *testing.T) {
+	for prefix, expected := range map[string]string{
+		"":         "",
+		"prod-eu/": "prod-eu",
+		"prod/eu":  "prod-eu",
+		"a  b":     "a-b",
+	} {
+		sanitized, err := sanitizeResourceNamePrefix(prefix)
+		assert.NoError(t, err, prefix)
+		assert.Equal(t, expected, sanitized, prefix)
+	}
+
+	_, err := sanitizeResourceNamePrefix("///")
+	assert.Error(t, err)
+	_, err = sanitizeResourceNamePrefix("a-very-long-cluster-prefix")
+	assert.Error(t, err)
+}
+
+func TestResourceNamePrefix(t *testing.T) {
+	cfg := CloudConfig{}
+	cfg.Global.ResourceNamePrefix = "prod/eu"
+	c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{UID: "a7b3c2f1-0e4d-4a5b-9c8d-7e6f5a4b3c2d"}}
+	assert.Equal(t, "prod-eu-a7b3c2f10e4d4a5b9c8d7e6f", c.GetLoadBalancerName(context.TODO(), "", service))
+
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerName: "custom"}
+	assert.Equal(t, "custom", c.GetLoadBalancerName(context.TODO(), "", service))
+
+	tags := c.tagging.buildTags(ResourceLifecycleOwned, nil)
+	assert.Equal(t, "prod-eu", tags[TagNameResourceNamePrefix])
+	assert.Equal(t, "prod-eu-k8s-elb-custom", c.tagging.prefixedName("k8s-elb-custom"))
+}
+
+func TestClusterTagPrefixes(t *testing.T) {
+	prefix, legacy, err := parseClusterTagPrefixes("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, TagNameKubernetesClusterPrefix, prefix)
+	assert.Empty(t, legacy)
+
+	prefix, legacy, err = parseClusterTagPrefixes(" kubernetes.io/cluster/ ", "OscK8sClusterID/, kubernetes.io/cluster/,,k8s.io/")
+	assert.NoError(t, err)
+	assert.Equal(t, "kubernetes.io/cluster/", prefix)
+	assert.Equal(t, []string{"OscK8sClusterID/", "k8s.io/"}, legacy)
+
+	_, _, err = parseClusterTagPrefixes("cluster=", "")
+	assert.Error(t, err)
+	_, _, err = parseClusterTagPrefixes("", "cluster=")
+	assert.Error(t, err)
+
+	// The resources tagged with a legacy prefix are recognized, the new tags use the prefix
+	cfg := CloudConfig{}
+	cfg.Global.KubernetesClusterTagPrefix = "kubernetes.io/cluster/"
+	cfg.Global.LegacyKubernetesClusterTagPrefixes = TagNameKubernetesClusterPrefix
+	c, err := newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.NoError(t, err)
+	assert.Equal(t, TestClusterID, c.tagging.ClusterID)
+
+	legacyTags := []osc.ResourceTag{{Key: TagNameKubernetesClusterPrefix + TestClusterID, Value: ResourceLifecycleShared}}
+	assert.True(t, c.tagging.hasClusterTag(&legacyTags))
+	otherTags := []osc.ResourceTag{{Key: "kubernetes.io/cluster/other", Value: ResourceLifecycleOwned}}
+	assert.False(t, c.tagging.hasClusterTag(&otherTags))
+	assert.Equal(t, []string{"kubernetes.io/cluster/" + TestClusterID, TagNameKubernetesClusterPrefix + TestClusterID},
+		c.tagging.clusterTagKeys())
+	assert.Equal(t, ResourceLifecycleShared, c.tagging.clusterTagLifecycle(map[string]string{
+		TagNameKubernetesClusterPrefix + TestClusterID: ResourceLifecycleShared,
+	}))
+
+	tags := c.tagging.buildTags(ResourceLifecycleOwned, nil)
+	assert.Equal(t, ResourceLifecycleOwned, tags["kubernetes.io/cluster/"+TestClusterID])
+	assert.NotContains(t, tags, TagNameKubernetesClusterPrefix+TestClusterID)
+
+	// The cluster tags can't be set as resource tags
+	cfg.Global.ResourceTags = "kubernetes.io/cluster/other=owned"
+	_, err = newCloud(cfg, NewFakeAWSServices(TestClusterID))
+	assert.Error(t, err)
+}
@@ -28,12 +28,11 @@ import (
 	"github.com/outscale/osc-sdk-go/v2"
 	"net"
 	"os"
-	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 )
@@ -42,9 +41,13 @@ import (
 
 // SetupMetadataResolver resolver for osc metadata service
 func SetupMetadataResolver() endpoints.ResolverFunc {
+	url := apiClients.endpoint(metadataServiceName, "")
+	if url == "" {
+		url = "http://169.254.169.254/latest"
+	}
 	return func(service, region string, optFns ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
 		return endpoints.ResolvedEndpoint{
-			URL:           "http://169.254.169.254/latest",
+			URL:           url,
 			SigningRegion: "custom-signing-region",
 		}, nil
 	}
@@ -64,8 +67,10 @@ func SetupServiceResolver(region string) endpoints.ResolverFunc {
 			endpoints.Ec2ServiceID:                  "fcu",
 			endpoints.ElasticloadbalancingServiceID: "lbu",
 			endpoints.IamServiceID:                  "eim",
+			endpoints.StsServiceID:                  "eim",
 			endpoints.DirectconnectServiceID:        "directlink",
 			endpoints.KmsServiceID:                  "kms",
+			endpoints.S3ServiceID:                   "oos",
 		}
 		var oscService string
 		var ok bool
@@ -76,9 +81,14 @@ func SetupServiceResolver(region string) endpoints.ResolverFunc {
 				url = os.Getenv("OSC_ENDPOINT_LBU")
 			case os.Getenv("OSC_ENDPOINT_FCU") != "" && service == endpoints.Ec2ServiceID:
 				url = os.Getenv("OSC_ENDPOINT_FCU")
-			case os.Getenv("OSC_ENDPOINT_EIM") != "" && service == endpoints.IamServiceID:
+			case os.Getenv("OSC_ENDPOINT_EIM") != "" && (service == endpoints.IamServiceID || service == endpoints.StsServiceID):
 				url = os.Getenv("OSC_ENDPOINT_EIM")
+			case os.Getenv("OSC_ENDPOINT_OOS") != "" && service == endpoints.S3ServiceID:
+				url = os.Getenv("OSC_ENDPOINT_OOS")
 			default:
+				if resolved, found := apiClients.resolve(service, oscService, region); found {
+					return resolved, nil
+				}
 				url = Endpoint(region, oscService)
 			}
 			return endpoints.ResolvedEndpoint{
@@ -98,6 +108,7 @@ func SetupServiceResolver(region string) endpoints.ResolverFunc {
 func newEC2MetadataSvc() *ec2metadata.EC2Metadata {
 	awsConfig := &aws.Config{
 		EndpointResolver: endpoints.ResolverFunc(SetupMetadataResolver()),
+		HTTPClient:       apiClients.metadataHTTPClient(),
 	}
 	awsConfig.WithLogLevel(aws.LogDebugWithSigning | aws.LogDebugWithHTTPBody | aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors)
 
@@ -146,6 +157,7 @@ func NewSession(meta EC2Metadata) (*session.Session, error) {
 		Credentials:                   credentials.NewChainCredentials(provider),
 		CredentialsChainVerboseErrors: aws.Bool(true),
 		EndpointResolver:              endpoints.ResolverFunc(SetupServiceResolver(metadata.GetRegion())),
+		HTTPClient:                    apiClients.httpClient(),
 	}
 	awsConfig.WithLogLevel(aws.LogDebugWithSigning | aws.LogDebugWithHTTPBody | aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors)
 	sess, err := session.NewSession(awsConfig)
@@ -165,22 +177,13 @@ func newEc2Filter(name string, values ...string) *ec2.Filter {
 	return filter
 }
 
-// mapNodeNameToPrivateDNSName maps a k8s NodeName to an AWS Instance PrivateDNSName
-// This is a simple string cast
-func mapNodeNameToPrivateDNSName(nodeName types.NodeName) string {
-	return string(nodeName)
-}
-
-// mapInstanceToNodeName maps an OSC instance to a k8s NodeName, by extracting the PrivateDNSName
-func mapInstanceToNodeName(i *osc.Vm) types.NodeName {
-	return types.NodeName(aws.StringValue(i.PrivateDnsName))
-}
-
 // Returns the first security group for an instance, or nil
 // We only create instances with one security group, so we don't expect multiple security groups.
 // However, if there are multiple security groups, we will choose the one tagged with our cluster filter.
 // Otherwise we will return an error.
-func findSecurityGroupForInstance(instance *osc.Vm, taggedSecurityGroups map[string]osc.SecurityGroup) (*osc.SecurityGroupLight, error) {
+// The security groups are the ones of the NIC carrying the NodePort traffic, see nodePortSecurityGroups.
+func findSecurityGroupForInstance(instance *osc.Vm, taggedSecurityGroups map[string]osc.SecurityGroup,
+	nodePortNic string) (*osc.SecurityGroupLight, error) {
 	instanceID := instance.GetVmId()
 
 	klog.Infof("findSecurityGroupForInstance instance.InstanceId : %v", instance.GetVmId())
@@ -189,7 +192,7 @@ func findSecurityGroupForInstance(instance *osc.Vm, taggedSecurityGroups map[str
 
 	var tagged []osc.SecurityGroupLight
 	var untagged []osc.SecurityGroupLight
-	for _, group := range instance.GetSecurityGroups() {
+	for _, group := range nodePortSecurityGroups(instance, nodePortNic) {
 		groupID := group.GetSecurityGroupId()
 		if groupID == "" {
 			klog.Warningf("Ignoring security group without id for instance %q: %v", instanceID, group)
@@ -244,12 +247,30 @@ func buildListener(port v1.ServicePort, annotations map[string]string, sslPorts
 	protocol := strings.ToLower(string(port.Protocol))
 	instanceProtocol := protocol
 
+	backendProtocol, err := getBackendProtocol(port, annotations)
+	if err != nil {
+		return nil, err
+	}
+
 	listener := &elb.Listener{}
 	listener.InstancePort = &instancePort
 	listener.LoadBalancerPort = &loadBalancerPort
 	certID := annotations[ServiceAnnotationLoadBalancerCertificate]
+	if port.Protocol == v1.ProtocolSCTP {
+		// SCTP is passed through, neither terminated nor translated
+		if certID != "" && sslPorts != nil && (sslPorts.numbers.Has(loadBalancerPort) || sslPorts.names.Has(portName)) {
+			return nil, fmt.Errorf("SCTP port %d can't be terminated with %s", loadBalancerPort, ServiceAnnotationLoadBalancerCertificate)
+		}
+		if backendProtocol != "" && backendProtocol != "sctp" {
+			return nil, fmt.Errorf("Invalid backend protocol %s for SCTP port %d in %s", backendProtocol, loadBalancerPort, ServiceAnnotationLoadBalancerBEProtocol)
+		}
+		sctp := string(v1.ProtocolSCTP)
+		listener.Protocol = &sctp
+		listener.InstanceProtocol = &sctp
+		return listener, nil
+	}
 	if certID != "" && (sslPorts == nil || sslPorts.numbers.Has(loadBalancerPort) || sslPorts.names.Has(portName)) {
-		instanceProtocol = annotations[ServiceAnnotationLoadBalancerBEProtocol]
+		instanceProtocol = backendProtocol
 		if instanceProtocol == "" {
 			protocol = "ssl"
 			instanceProtocol = "tcp"
@@ -260,8 +281,8 @@ func buildListener(port v1.ServicePort, annotations map[string]string, sslPorts
 			}
 		}
 		listener.SSLCertificateId = &certID
-	} else if annotationProtocol := annotations[ServiceAnnotationLoadBalancerBEProtocol]; annotationProtocol == "http" {
-		instanceProtocol = annotationProtocol
+	} else if backendProtocol == "http" {
+		instanceProtocol = backendProtocol
 		protocol = "http"
 	}
 	protocol = strings.ToUpper(protocol)
@@ -568,8 +589,8 @@ func isRegionValid(region string, metadata EC2Metadata) bool {
 	return false
 }
 
-// newAWSInstance creates a new awsInstance object
-func newAWSInstance(ec2Service Compute, instance *osc.Vm) *VM {
+// newAWSInstance creates a new awsInstance object, named after the node name strategy
+func newAWSInstance(ec2Service Compute, instance *osc.Vm, nodeNames *nodeNameStrategy) *VM {
 	az := ""
 	if instance.Placement != nil {
 		az = instance.Placement.GetSubregionName()
@@ -577,7 +598,7 @@ func newAWSInstance(ec2Service Compute, instance *osc.Vm) *VM {
 	self := &VM{
 		compute:          ec2Service,
 		vmID:             instance.GetVmId(),
-		nodeName:         mapInstanceToNodeName(instance),
+		nodeName:         nodeNames.nodeName(instance),
 		availabilityZone: az,
 		instanceType:     instance.GetVmType(),
 		vpcID:            instance.GetNetId(),
@@ -587,8 +608,9 @@ func newAWSInstance(ec2Service Compute, instance *osc.Vm) *VM {
 	return self
 }
 
-// extractNodeAddresses maps the instance information from OSC to an array of NodeAddresses
-func extractNodeAddresses(instance *osc.Vm) ([]v1.NodeAddress, error) {
+// extractNodeAddresses maps the instance information from OSC to an array of NodeAddresses,
+// the private IPs of the NICs being ordered by the priority
+func extractNodeAddresses(instance *osc.Vm, priority *nodeAddressPriority) ([]v1.NodeAddress, error) {
 	// Not clear if the order matters here, but we might as well indicate a sensible preference order
 
 	if instance == nil {
@@ -599,22 +621,29 @@ func extractNodeAddresses(instance *osc.Vm) ([]v1.NodeAddress, error) {
 
 	// handle internal network interfaces
 	if len(instance.GetNics()) > 0 {
+		nics := []nicAddresses{}
 		for _, networkInterface := range instance.GetNics() {
 			// skip network interfaces that are not currently in use
 			if *networkInterface.State != "in-use" {
 				continue
 			}
 
+			nic := nicAddresses{subnetID: networkInterface.GetSubnetId()}
+			if networkInterface.LinkNic != nil {
+				nic.deviceNumber = networkInterface.LinkNic.GetDeviceNumber()
+			}
 			for _, internalIP := range networkInterface.GetPrivateIps() {
 				if ipAddress := internalIP.GetPrivateIp(); ipAddress != "" {
 					ip := net.ParseIP(ipAddress)
 					if ip == nil {
 						return nil, fmt.Errorf("OSC instance had invalid private address: %s (%q)", instance.GetVmId(), ipAddress)
 					}
-					addresses = append(addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: ip.String()})
+					nic.addresses = append(nic.addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: ip.String()})
 				}
 			}
+			nics = append(nics, nic)
 		}
+		addresses = append(addresses, priority.forInstance(instance).order(nics)...)
 	} else {
 		privateIPAddress := instance.GetPrivateIp()
 		if privateIPAddress != "" {
@@ -647,6 +676,81 @@ func extractNodeAddresses(instance *osc.Vm) ([]v1.NodeAddress, error) {
 	return addresses, nil
 }
 
+// parseNodeIPFamilies parses the NodeIPFamilies setting of the cloud config
+func parseNodeIPFamilies(value string) ([]v1.IPFamily, error) {
+	families := []v1.IPFamily{}
+	for _, family := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(family)) {
+		case "":
+			continue
+		case "ipv4":
+			families = append(families, v1.IPv4Protocol)
+		case "ipv6":
+			families = append(families, v1.IPv6Protocol)
+		default:
+			return nil, fmt.Errorf("unknown IP family %q", family)
+		}
+	}
+	if len(families) > 2 || (len(families) == 2 && families[0] == families[1]) {
+		return nil, fmt.Errorf("invalid IP families %q", value)
+	}
+	return families, nil
+}
+
+// hasIPFamily checks whether the family is part of the configured families
+func hasIPFamily(families []v1.IPFamily, family v1.IPFamily) bool {
+	for _, f := range families {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
+
+// getNodeAddressIPFamily returns the IP family of an InternalIP or ExternalIP node address
+func getNodeAddressIPFamily(address v1.NodeAddress) (v1.IPFamily, bool) {
+	if address.Type != v1.NodeInternalIP && address.Type != v1.NodeExternalIP {
+		return "", false
+	}
+	ip := net.ParseIP(address.Address)
+	if ip == nil {
+		return "", false
+	}
+	if ip.To4() != nil {
+		return v1.IPv4Protocol, true
+	}
+	return v1.IPv6Protocol, true
+}
+
+// sortNodeAddressesByIPFamily orders the IP addresses by family preference, keeping the
+// discovery order within a family. Non-IP addresses are kept after the IP addresses of the
+// configured families, and the IP addresses of the other families are appended at the end.
+// When no family is configured, the addresses are returned unchanged.
+func sortNodeAddressesByIPFamily(addresses []v1.NodeAddress, families []v1.IPFamily) []v1.NodeAddress {
+	if len(families) == 0 {
+		return addresses
+	}
+
+	rank := func(address v1.NodeAddress) int {
+		family, isIP := getNodeAddressIPFamily(address)
+		if !isIP {
+			return len(families)
+		}
+		for i, f := range families {
+			if f == family {
+				return i
+			}
+		}
+		return len(families) + 1
+	}
+
+	sorted := append([]v1.NodeAddress{}, addresses...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+	return sorted
+}
+
 // parseMetadataLocalHostname parses the output of "local-hostname" metadata.
 // If a DHCP option set is configured for a VPC and it has multiple domain names, GetMetadata
 // returns a string containing first the hostname followed by additional domain names,
@@ -689,64 +793,17 @@ func updateConfigZone(cfg *CloudConfig, metadata EC2Metadata) error {
 	return nil
 }
 
-func newAWSSDKProvider(creds *credentials.Credentials, cfg *CloudConfig) *awsSDKProvider {
-	debugPrintCallerFunctionName()
-	klog.V(5).Infof("newAWSSDKProvider(%v,%v)", creds, cfg)
+func newAWSSDKProvider(creds *credentials.Credentials, refreshedCreds bool, cfg *CloudConfig) *awsSDKProvider {
+	klog.V(5).Infof("newAWSSDKProvider(%v,%v,%v)", creds, refreshedCreds, cfg)
 	return &awsSDKProvider{
 		creds:          creds,
+		refreshedCreds: refreshedCreds,
 		cfg:            cfg,
 		regionDelayers: make(map[string]*CrossRequestRetryDelay),
+		throttling:     newAPIThrottling(cfg),
 	}
 }
 
-// *** DEBUG FUNCTIONS
-
-func debugGetFrame(skipFrames int) runtime.Frame {
-	// We need the frame at index skipFrames+2, since we never want runtime.Callers and getFrame
-	targetFrameIndex := skipFrames + 2
-
-	// Set size to targetFrameIndex+2 to ensure we have room for one more caller than we need
-	programCounters := make([]uintptr, targetFrameIndex+2)
-	n := runtime.Callers(0, programCounters)
-
-	frame := runtime.Frame{Function: "unknown"}
-	if n > 0 {
-		frames := runtime.CallersFrames(programCounters[:n])
-		for more, frameIndex := true, 0; more && frameIndex <= targetFrameIndex; frameIndex++ {
-			var frameCandidate runtime.Frame
-			frameCandidate, more = frames.Next()
-			if frameIndex == targetFrameIndex {
-				frame = frameCandidate
-			}
-		}
-	}
-
-	return frame
-}
-
-func debugPrintCallerFunctionName() {
-	called := debugGetFrame(1)
-	caller := debugGetFrame(2)
-	klog.V(5).Infof(
-		"DebugStack %s{"+
-			"\n\t call	 {\n\t\tFunc:%s, \n\t\tFile:(%s:%d)\n\t}"+
-			"\n\t called {\n\t\tFunc:%s, \n\t\tFile:(%s:%d)\n\t}"+
-			"\n}",
-		called.Function,
-		called.Function, called.File, called.Line,
-		caller.Function, caller.File, caller.Line)
-}
-
-func debugGetCurrentFunctionName() string {
-	// Skip debugGetCurrentFunctionName
-	return debugGetFrame(1).Function
-}
-
-func debugGetCallerFunctionName() string {
-	// Skip debugGetCallerFunctionName and the function to get the caller of
-	return debugGetFrame(2).Function
-}
-
 // Contains checks if the element is present in the list
 func Contains(list []string, element string) bool {
 	for _, el := range list {
@@ -0,0 +1,406 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testutil provides an in-process fake of the Outscale APIs used by the cloud
+// provider (oAPI, LBU and the metadata service), so that the tests run the real API clients
+// against a stateful server which can also page, throttle and lag behind the writes.
+package testutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// Path prefixes of the oAPI and LBU endpoints, the other paths being the metadata service
+	oapiPath = "/api/v1"
+	lbuPath  = "/lbu"
+)
+
+// fault is an error returned by the next calls of an operation
+type fault struct {
+	times  int
+	status int
+	code   string
+}
+
+// FakeAPIServer is a fake of the Outscale APIs used by the cloud provider, serving the
+// oAPI at OapiEndpoint, LBU at LbuEndpoint and the metadata service at MetadataEndpoint.
+// Its state is only changed by the API calls and by its methods, which are safe for
+// concurrent use.
+type FakeAPIServer struct {
+	server *httptest.Server
+
+	mutex  sync.Mutex
+	nextID int
+	// Number of calls by operation, e.g. ReadVms or DescribeLoadBalancers
+	calls  map[string]int
+	faults map[string]*fault
+
+	// Number of load balancers listed by a DescribeLoadBalancers page, unpaged when 0
+	pageSize int
+	// Number of reads the resources created or deleted by the API stay stale for
+	consistencyDelay int
+	// Reads left before the created resources appear, by id (or name for load balancers)
+	hidden map[string]int
+
+	metadata       map[string]string
+	vms            map[string]*osc.Vm
+	securityGroups map[string]*osc.SecurityGroup
+	subnets        map[string]*osc.Subnet
+	routeTables    map[string]*osc.RouteTable
+	publicIps      map[string]*osc.PublicIp
+	loadBalancers  map[string]*fakeLoadBalancer
+	// Deleted load balancers still holding their security groups, with the number of
+	// deletions of the security groups left before they are released
+	deletingLoadBalancers map[string]*fakeLoadBalancer
+	// Health state of the backends, by VM id, Unknown when not set
+	instanceHealth map[string]string
+}
+
+// NewFakeAPIServer starts a fake API server, to be closed with Close
+func NewFakeAPIServer() *FakeAPIServer {
+	s := &FakeAPIServer{
+		calls:                 make(map[string]int),
+		faults:                make(map[string]*fault),
+		hidden:                make(map[string]int),
+		metadata:              make(map[string]string),
+		vms:                   make(map[string]*osc.Vm),
+		securityGroups:        make(map[string]*osc.SecurityGroup),
+		subnets:               make(map[string]*osc.Subnet),
+		routeTables:           make(map[string]*osc.RouteTable),
+		publicIps:             make(map[string]*osc.PublicIp),
+		loadBalancers:         make(map[string]*fakeLoadBalancer),
+		deletingLoadBalancers: make(map[string]*fakeLoadBalancer),
+		instanceHealth:        make(map[string]string),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close shuts the server down
+func (s *FakeAPIServer) Close() {
+	s.server.Close()
+}
+
+// URL returns the base URL of the server
+func (s *FakeAPIServer) URL() string {
+	return s.server.URL
+}
+
+// OapiEndpoint returns the endpoint of the oAPI, e.g. for EndpointAPI
+func (s *FakeAPIServer) OapiEndpoint() string {
+	return s.server.URL + oapiPath
+}
+
+// LbuEndpoint returns the endpoint of LBU, e.g. for EndpointLBU
+func (s *FakeAPIServer) LbuEndpoint() string {
+	return s.server.URL + lbuPath
+}
+
+// MetadataEndpoint returns the endpoint of the metadata service, e.g. for EndpointMetadata
+func (s *FakeAPIServer) MetadataEndpoint() string {
+	return s.server.URL + "/latest"
+}
+
+func (s *FakeAPIServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, oapiPath+"/"):
+		s.serveOapi(w, r, strings.TrimPrefix(r.URL.Path, oapiPath+"/"))
+	case strings.HasPrefix(r.URL.Path, lbuPath):
+		s.serveLbu(w, r)
+	default:
+		s.serveMetadata(w, r)
+	}
+}
+
+// serveMetadata answers the IMDSv2 token requests and the meta-data paths set with SetMetadata
+func (s *FakeAPIServer) serveMetadata(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/api/token") {
+		w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", r.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds"))
+		fmt.Fprint(w, "fake-token")
+		return
+	}
+	_, path, found := strings.Cut(r.URL.Path, "/meta-data/")
+	s.mutex.Lock()
+	value, set := s.metadata[path]
+	s.mutex.Unlock()
+	if !found || !set {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprint(w, value)
+}
+
+// SetMetadata sets the instance-id, instance-type and placement/availability-zone of the
+// metadata service
+func (s *FakeAPIServer) SetMetadata(instanceID, instanceType, availabilityZone string) {
+	s.SetMetadataPath("instance-id", instanceID)
+	s.SetMetadataPath("instance-type", instanceType)
+	s.SetMetadataPath("placement/availability-zone", availabilityZone)
+}
+
+// SetMetadataPath sets the value of a path of the metadata service, relative to meta-data/
+func (s *FakeAPIServer) SetMetadataPath(path, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.metadata[path] = value
+}
+
+// Calls returns the number of calls of the operation, e.g. ReadVms or CreateLoadBalancer,
+// including the failed ones
+func (s *FakeAPIServer) Calls(operation string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.calls[operation]
+}
+
+// Throttle throttles the next calls of the operation, as the API does once the rate limit
+// of the account is exceeded
+func (s *FakeAPIServer) Throttle(operation string, times int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults[operation] = &fault{times: times, status: http.StatusServiceUnavailable, code: "RequestLimitExceeded"}
+}
+
+// Fail fails the next calls of the operation with the HTTP status and error code
+func (s *FakeAPIServer) Fail(operation string, times int, status int, code string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults[operation] = &fault{times: times, status: status, code: code}
+}
+
+// SetPageSize sets the number of load balancers listed by a DescribeLoadBalancers page,
+// 0 listing them all at once
+func (s *FakeAPIServer) SetPageSize(pageSize int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pageSize = pageSize
+}
+
+// SetConsistencyDelay makes the API eventually consistent: the load balancers and the
+// security groups created afterwards are missing from the next reads listing them, and
+// the security groups of the deleted load balancers stay in use for the next deletions,
+// as the load balancers are deleted in the background
+func (s *FakeAPIServer) SetConsistencyDelay(reads int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.consistencyDelay = reads
+}
+
+// call records a call of the operation and returns the fault it must fail with, if any
+func (s *FakeAPIServer) call(operation string) *fault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls[operation]++
+	f := s.faults[operation]
+	if f == nil || f.times <= 0 {
+		return nil
+	}
+	f.times--
+	return f
+}
+
+// newID returns a new resource id with the prefix, e.g. sg
+func (s *FakeAPIServer) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%08x", prefix, s.nextID)
+}
+
+// hide hides a created resource from the next reads, with SetConsistencyDelay
+func (s *FakeAPIServer) hide(id string) {
+	if s.consistencyDelay > 0 {
+		s.hidden[id] = s.consistencyDelay
+	}
+}
+
+// visible returns whether a resource is returned by a read, counting the read
+func (s *FakeAPIServer) visible(id string) bool {
+	reads, found := s.hidden[id]
+	if !found {
+		return true
+	}
+	if reads <= 1 {
+		delete(s.hidden, id)
+	} else {
+		s.hidden[id] = reads - 1
+	}
+	return false
+}
+
+// AddVm adds a VM, its id being generated when not set
+func (s *FakeAPIServer) AddVm(vm osc.Vm) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if vm.GetVmId() == "" {
+		vm.SetVmId(s.newID("i"))
+	}
+	if !vm.HasState() {
+		vm.SetState("running")
+	}
+	if !vm.HasTags() {
+		vm.SetTags([]osc.ResourceTag{})
+	}
+	s.vms[vm.GetVmId()] = &vm
+	return vm.GetVmId()
+}
+
+// DeleteVm deletes the VM
+func (s *FakeAPIServer) DeleteVm(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.vms, id)
+}
+
+// AddSubnet adds a subnet, its id being generated when not set
+func (s *FakeAPIServer) AddSubnet(subnet osc.Subnet) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if subnet.GetSubnetId() == "" {
+		subnet.SetSubnetId(s.newID("subnet"))
+	}
+	if !subnet.HasTags() {
+		subnet.SetTags([]osc.ResourceTag{})
+	}
+	s.subnets[subnet.GetSubnetId()] = &subnet
+	return subnet.GetSubnetId()
+}
+
+// AddRouteTable adds a route table, its id being generated when not set
+func (s *FakeAPIServer) AddRouteTable(routeTable osc.RouteTable) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if routeTable.GetRouteTableId() == "" {
+		routeTable.SetRouteTableId(s.newID("rtb"))
+	}
+	if !routeTable.HasTags() {
+		routeTable.SetTags([]osc.ResourceTag{})
+	}
+	if !routeTable.HasRoutes() {
+		routeTable.SetRoutes([]osc.Route{})
+	}
+	s.routeTables[routeTable.GetRouteTableId()] = &routeTable
+	return routeTable.GetRouteTableId()
+}
+
+// AddSecurityGroup adds a security group, its id being generated when not set
+func (s *FakeAPIServer) AddSecurityGroup(group osc.SecurityGroup) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if group.GetSecurityGroupId() == "" {
+		group.SetSecurityGroupId(s.newID("sg"))
+	}
+	s.securityGroups[group.GetSecurityGroupId()] = newSecurityGroup(group)
+	return group.GetSecurityGroupId()
+}
+
+// SecurityGroup returns a copy of the security group
+func (s *FakeAPIServer) SecurityGroup(id string) (osc.SecurityGroup, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	group, found := s.securityGroups[id]
+	if !found {
+		return osc.SecurityGroup{}, false
+	}
+	return copySecurityGroup(group), true
+}
+
+// SecurityGroups returns a copy of the security groups, sorted by id
+func (s *FakeAPIServer) SecurityGroups() []osc.SecurityGroup {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	groups := []osc.SecurityGroup{}
+	for _, id := range sets.StringKeySet(s.securityGroups).List() {
+		groups = append(groups, copySecurityGroup(s.securityGroups[id]))
+	}
+	return groups
+}
+
+// PublicIps returns a copy of the public IPs, sorted by id
+func (s *FakeAPIServer) PublicIps() []osc.PublicIp {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	publicIps := []osc.PublicIp{}
+	for _, id := range sets.StringKeySet(s.publicIps).List() {
+		publicIps = append(publicIps, *awsutil.CopyOf(s.publicIps[id]).(*osc.PublicIp))
+	}
+	return publicIps
+}
+
+// LoadBalancer returns a copy of the description of the load balancer
+func (s *FakeAPIServer) LoadBalancer(name string) (*elb.LoadBalancerDescription, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lb, found := s.loadBalancers[name]
+	if !found {
+		return nil, false
+	}
+	return awsutil.CopyOf(lb.description).(*elb.LoadBalancerDescription), true
+}
+
+// LoadBalancerNames returns the names of the load balancers, sorted
+func (s *FakeAPIServer) LoadBalancerNames() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sets.StringKeySet(s.loadBalancers).List()
+}
+
+// LoadBalancerTags returns the tags of the load balancer
+func (s *FakeAPIServer) LoadBalancerTags(name string) map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tags := map[string]string{}
+	if lb, found := s.loadBalancers[name]; found {
+		for _, tag := range lb.tags {
+			tags[*tag.Key] = stringValue(tag.Value)
+		}
+	}
+	return tags
+}
+
+// UpdateLoadBalancer updates the description of the load balancer out of band, e.g. to
+// simulate a change from the console
+func (s *FakeAPIServer) UpdateLoadBalancer(name string, update func(*elb.LoadBalancerDescription)) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lb, found := s.loadBalancers[name]
+	if found {
+		update(lb.description)
+	}
+	return found
+}
+
+// SetInstanceHealth sets the health state of the VM in the load balancers, e.g. InService
+func (s *FakeAPIServer) SetInstanceHealth(vmID, state string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.instanceHealth[vmID] = state
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
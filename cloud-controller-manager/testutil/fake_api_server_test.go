@@ -0,0 +1,219 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/outscale/osc-sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClients(t *testing.T) (*FakeAPIServer, *osc.APIClient, *elb.ELB) {
+	s := NewFakeAPIServer()
+	t.Cleanup(s.Close)
+
+	config := osc.NewConfiguration()
+	config.Servers = osc.ServerConfigurations{{URL: s.OapiEndpoint()}}
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-2"),
+		Endpoint:    aws.String(s.LbuEndpoint()),
+		Credentials: credentials.NewStaticCredentials("access", "secret", ""),
+		MaxRetries:  aws.Int(3),
+	})
+	require.NoError(t, err)
+	return s, osc.NewAPIClient(config), elb.New(sess)
+}
+
+func TestFakeAPIServerSecurityGroups(t *testing.T) {
+	s, client, _ := newTestClients(t)
+	s.SetConsistencyDelay(1)
+
+	created, _, err := client.SecurityGroupApi.CreateSecurityGroup(context.TODO()).CreateSecurityGroupRequest(osc.CreateSecurityGroupRequest{
+		SecurityGroupName: "lb", Description: "lb", NetId: osc.PtrString("vpc-1"),
+	}).Execute()
+	require.NoError(t, err)
+	id := created.SecurityGroup.GetSecurityGroupId()
+
+	_, httpRes, err := client.SecurityGroupApi.CreateSecurityGroup(context.TODO()).CreateSecurityGroupRequest(osc.CreateSecurityGroupRequest{
+		SecurityGroupName: "lb", Description: "lb", NetId: osc.PtrString("vpc-1"),
+	}).Execute()
+	require.Error(t, err)
+	assert.Equal(t, http.StatusConflict, httpRes.StatusCode)
+
+	// The created security group is missing from the first read
+	request := osc.ReadSecurityGroupsRequest{Filters: &osc.FiltersSecurityGroup{SecurityGroupNames: &[]string{"lb"}}}
+	for _, expected := range []int{0, 1} {
+		read, _, err := client.SecurityGroupApi.ReadSecurityGroups(context.TODO()).ReadSecurityGroupsRequest(request).Execute()
+		require.NoError(t, err)
+		assert.Len(t, read.GetSecurityGroups(), expected)
+	}
+
+	for _, port := range []int32{80, 443} {
+		_, _, err = client.SecurityGroupRuleApi.CreateSecurityGroupRule(context.TODO()).CreateSecurityGroupRuleRequest(osc.CreateSecurityGroupRuleRequest{
+			Flow: "Inbound", SecurityGroupId: id, IpProtocol: osc.PtrString("tcp"),
+			FromPortRange: osc.PtrInt32(port), ToPortRange: osc.PtrInt32(port), IpRange: osc.PtrString("10.0.0.0/16"),
+		}).Execute()
+		require.NoError(t, err)
+	}
+	_, _, err = client.SecurityGroupRuleApi.CreateSecurityGroupRule(context.TODO()).CreateSecurityGroupRuleRequest(osc.CreateSecurityGroupRuleRequest{
+		Flow: "Inbound", SecurityGroupId: id, Rules: &[]osc.SecurityGroupRule{{
+			IpProtocol: osc.PtrString("tcp"), FromPortRange: osc.PtrInt32(80), ToPortRange: osc.PtrInt32(80),
+			IpRanges: &[]string{"10.1.0.0/16"},
+		}},
+	}).Execute()
+	require.NoError(t, err)
+	group, found := s.SecurityGroup(id)
+	require.True(t, found)
+	require.Len(t, group.GetInboundRules(), 2)
+	assert.Equal(t, []string{"10.0.0.0/16", "10.1.0.0/16"}, group.GetInboundRules()[0].GetIpRanges())
+
+	_, _, err = client.SecurityGroupRuleApi.DeleteSecurityGroupRule(context.TODO()).DeleteSecurityGroupRuleRequest(osc.DeleteSecurityGroupRuleRequest{
+		Flow: "Inbound", SecurityGroupId: id, IpProtocol: osc.PtrString("tcp"),
+		FromPortRange: osc.PtrInt32(443), ToPortRange: osc.PtrInt32(443), IpRange: osc.PtrString("10.0.0.0/16"),
+	}).Execute()
+	require.NoError(t, err)
+	group, _ = s.SecurityGroup(id)
+	assert.Len(t, group.GetInboundRules(), 1)
+
+	_, _, err = client.SecurityGroupApi.DeleteSecurityGroup(context.TODO()).DeleteSecurityGroupRequest(osc.DeleteSecurityGroupRequest{
+		SecurityGroupId: osc.PtrString(id),
+	}).Execute()
+	require.NoError(t, err)
+	assert.Empty(t, s.SecurityGroups())
+}
+
+func TestFakeAPIServerLoadBalancers(t *testing.T) {
+	s, client, lbu := newTestClients(t)
+	subnet := s.AddSubnet(osc.Subnet{NetId: osc.PtrString("vpc-1")})
+	group := s.AddSecurityGroup(osc.SecurityGroup{SecurityGroupName: osc.PtrString("lb"), NetId: osc.PtrString("vpc-1")})
+	s.SetPageSize(2)
+	listener := &elb.Listener{
+		InstancePort: aws.Int64(30080), InstanceProtocol: aws.String("TCP"),
+		LoadBalancerPort: aws.Int64(80), Protocol: aws.String("TCP"),
+	}
+
+	for _, name := range []string{"lb-a", "lb-b", "lb-c"} {
+		_, err := lbu.CreateLoadBalancer(&elb.CreateLoadBalancerInput{
+			LoadBalancerName: aws.String(name),
+			Subnets:          aws.StringSlice([]string{subnet}),
+			SecurityGroups:   aws.StringSlice([]string{group}),
+			Listeners:        []*elb.Listener{listener},
+			Tags:             []*elb.Tag{{Key: aws.String("cluster"), Value: aws.String("test")}},
+		})
+		require.NoError(t, err)
+	}
+	_, err := lbu.CreateLoadBalancer(&elb.CreateLoadBalancerInput{LoadBalancerName: aws.String("lb-a"), Listeners: []*elb.Listener{listener}})
+	require.Error(t, err)
+	assert.Equal(t, elb.ErrCodeDuplicateAccessPointNameException, err.(awserr.Error).Code())
+
+	names := []string{}
+	pages := 0
+	err = lbu.DescribeLoadBalancersPages(&elb.DescribeLoadBalancersInput{}, func(page *elb.DescribeLoadBalancersOutput, last bool) bool {
+		pages++
+		for _, lb := range page.LoadBalancerDescriptions {
+			names = append(names, aws.StringValue(lb.LoadBalancerName))
+		}
+		return true
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lb-a", "lb-b", "lb-c"}, names)
+	assert.Equal(t, 2, pages)
+
+	described, err := lbu.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{LoadBalancerNames: aws.StringSlice([]string{"lb-a"})})
+	require.NoError(t, err)
+	require.Len(t, described.LoadBalancerDescriptions, 1)
+	lb := described.LoadBalancerDescriptions[0]
+	assert.Equal(t, "vpc-1", aws.StringValue(lb.VPCId))
+	assert.Equal(t, int64(30080), aws.Int64Value(lb.ListenerDescriptions[0].Listener.InstancePort))
+	assert.Equal(t, map[string]string{"cluster": "test"}, s.LoadBalancerTags("lb-a"))
+
+	_, err = lbu.ModifyLoadBalancerAttributes(&elb.ModifyLoadBalancerAttributesInput{
+		LoadBalancerName:       aws.String("lb-a"),
+		LoadBalancerAttributes: &elb.LoadBalancerAttributes{ConnectionSettings: &elb.ConnectionSettings{IdleTimeout: aws.Int64(120)}},
+	})
+	require.NoError(t, err)
+	attributes, err := lbu.DescribeLoadBalancerAttributes(&elb.DescribeLoadBalancerAttributesInput{LoadBalancerName: aws.String("lb-a")})
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), aws.Int64Value(attributes.LoadBalancerAttributes.ConnectionSettings.IdleTimeout))
+	assert.False(t, aws.BoolValue(attributes.LoadBalancerAttributes.ConnectionDraining.Enabled))
+
+	// The oAPI view of the load balancers
+	read, _, err := client.LoadBalancerApi.ReadLoadBalancers(context.TODO()).ReadLoadBalancersRequest(osc.ReadLoadBalancersRequest{
+		Filters: &osc.FiltersLoadBalancer{LoadBalancerNames: &[]string{"lb-b"}},
+	}).Execute()
+	require.NoError(t, err)
+	require.Len(t, read.GetLoadBalancers(), 1)
+	assert.Equal(t, []string{group}, read.GetLoadBalancers()[0].GetSecurityGroups())
+
+	// The security groups are released once the load balancers are deleted
+	_, httpRes, err := client.SecurityGroupApi.DeleteSecurityGroup(context.TODO()).DeleteSecurityGroupRequest(osc.DeleteSecurityGroupRequest{
+		SecurityGroupId: osc.PtrString(group),
+	}).Execute()
+	require.Error(t, err)
+	assert.Equal(t, http.StatusConflict, httpRes.StatusCode)
+
+	s.SetConsistencyDelay(1)
+	for _, name := range []string{"lb-a", "lb-b", "lb-c", "lb-d"} {
+		_, err = lbu.DeleteLoadBalancer(&elb.DeleteLoadBalancerInput{LoadBalancerName: aws.String(name)})
+		require.NoError(t, err)
+	}
+	_, err = lbu.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{LoadBalancerNames: aws.StringSlice([]string{"lb-a"})})
+	require.Error(t, err)
+	assert.Equal(t, elb.ErrCodeAccessPointNotFoundException, err.(awserr.Error).Code())
+	for _, status := range []int{http.StatusConflict, http.StatusConflict, http.StatusConflict, http.StatusOK} {
+		_, httpRes, _ = client.SecurityGroupApi.DeleteSecurityGroup(context.TODO()).DeleteSecurityGroupRequest(osc.DeleteSecurityGroupRequest{
+			SecurityGroupId: osc.PtrString(group),
+		}).Execute()
+		assert.Equal(t, status, httpRes.StatusCode)
+	}
+}
+
+func TestFakeAPIServerFaults(t *testing.T) {
+	s, client, lbu := newTestClients(t)
+	s.AddVm(osc.Vm{VmId: osc.PtrString("i-1")})
+
+	// LBU throttling is retried by the SDK
+	s.Throttle("DescribeLoadBalancers", 2)
+	_, err := lbu.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.Calls("DescribeLoadBalancers"))
+
+	s.Fail("DescribeLoadBalancers", 1, http.StatusBadRequest, "InvalidConfigurationRequest")
+	_, err = lbu.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{})
+	require.Error(t, err)
+	assert.Equal(t, "InvalidConfigurationRequest", err.(awserr.Error).Code())
+
+	s.Throttle("ReadVms", 1)
+	_, httpRes, err := client.VmApi.ReadVms(context.TODO()).ReadVmsRequest(osc.ReadVmsRequest{}).Execute()
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, httpRes.StatusCode)
+	read, _, err := client.VmApi.ReadVms(context.TODO()).ReadVmsRequest(osc.ReadVmsRequest{
+		Filters: &osc.FiltersVm{VmIds: &[]string{"i-1", "i-2"}},
+	}).Execute()
+	require.NoError(t, err)
+	require.Len(t, read.GetVms(), 1)
+	assert.Equal(t, "running", read.GetVms()[0].GetState())
+}
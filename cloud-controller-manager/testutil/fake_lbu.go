@@ -0,0 +1,865 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ********************* Fake LBU *********************
+
+// fakeLoadBalancer is the state of a load balancer of the fake LBU
+type fakeLoadBalancer struct {
+	description *elb.LoadBalancerDescription
+	tags        []*elb.Tag
+	attributes  *elb.LoadBalancerAttributes
+	// Policies created on the load balancer, by name
+	policies map[string]*elb.PolicyDescription
+	// Public IP set with the oAPI UpdateLoadBalancer
+	publicIP string
+	// Deletions of its security groups left before they are released, once deleted
+	pendingDeletions int
+}
+
+func (lb *fakeLoadBalancer) hasSecurityGroup(id string) bool {
+	for _, group := range lb.description.SecurityGroups {
+		if aws.StringValue(group) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// lbuError is an error of an LBU call
+type lbuError struct {
+	status  int
+	code    string
+	message string
+}
+
+func lbuClientError(code string, format string, args ...interface{}) *lbuError {
+	return &lbuError{status: http.StatusBadRequest, code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func loadBalancerNotFound(name *string) *lbuError {
+	return lbuClientError(elb.ErrCodeAccessPointNotFoundException, "load balancer %s not found", aws.StringValue(name))
+}
+
+// lbuAction decodes the parameters of an action, and returns its output or error
+type lbuAction func(s *FakeAPIServer, params url.Values) (interface{}, *lbuError)
+
+// lbuActions are the LBU actions used by the cloud provider
+var lbuActions = map[string]lbuAction{
+	"CreateLoadBalancer":                      (*FakeAPIServer).createLoadBalancer,
+	"DeleteLoadBalancer":                      (*FakeAPIServer).deleteLoadBalancer,
+	"DescribeLoadBalancers":                   (*FakeAPIServer).describeLoadBalancers,
+	"AddTags":                                 (*FakeAPIServer).addTags,
+	"RemoveTags":                              (*FakeAPIServer).removeTags,
+	"DescribeTags":                            (*FakeAPIServer).describeTags,
+	"RegisterInstancesWithLoadBalancer":       (*FakeAPIServer).registerInstances,
+	"DeregisterInstancesFromLoadBalancer":     (*FakeAPIServer).deregisterInstances,
+	"CreateLoadBalancerPolicy":                (*FakeAPIServer).createLoadBalancerPolicy,
+	"CreateLBCookieStickinessPolicy":          (*FakeAPIServer).createLBCookieStickinessPolicy,
+	"CreateAppCookieStickinessPolicy":         (*FakeAPIServer).createAppCookieStickinessPolicy,
+	"SetLoadBalancerPoliciesForBackendServer": (*FakeAPIServer).setBackendServerPolicies,
+	"SetLoadBalancerPoliciesOfListener":       (*FakeAPIServer).setListenerPolicies,
+	"DescribeLoadBalancerPolicies":            (*FakeAPIServer).describeLoadBalancerPolicies,
+	"DeleteLoadBalancerPolicy":                (*FakeAPIServer).deleteLoadBalancerPolicy,
+	"DetachLoadBalancerFromSubnets":           (*FakeAPIServer).detachSubnets,
+	"AttachLoadBalancerToSubnets":             (*FakeAPIServer).attachSubnets,
+	"CreateLoadBalancerListeners":             (*FakeAPIServer).createListeners,
+	"DeleteLoadBalancerListeners":             (*FakeAPIServer).deleteListeners,
+	"ApplySecurityGroupsToLoadBalancer":       (*FakeAPIServer).applySecurityGroups,
+	"ConfigureHealthCheck":                    (*FakeAPIServer).configureHealthCheck,
+	"DescribeLoadBalancerAttributes":          (*FakeAPIServer).describeAttributes,
+	"ModifyLoadBalancerAttributes":            (*FakeAPIServer).modifyAttributes,
+	"DescribeInstanceHealth":                  (*FakeAPIServer).describeInstanceHealth,
+}
+
+// serveLbu serves an LBU call, POST /lbu with the form parameters of the query protocol
+func (s *FakeAPIServer) serveLbu(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeLbuError(w, lbuClientError("MalformedQueryString", "%v", err))
+		return
+	}
+	action := r.Form.Get("Action")
+	handler, found := lbuActions[action]
+	if !found {
+		writeLbuError(w, lbuClientError("InvalidAction", "action %s is not supported", action))
+		return
+	}
+	if f := s.call(action); f != nil {
+		if f.code == "RequestLimitExceeded" {
+			// LBU reports the throttling as a client error, retried by the SDK
+			writeLbuError(w, lbuClientError("Throttling", "rate exceeded"))
+		} else {
+			writeLbuError(w, &lbuError{status: f.status, code: f.code, message: "injected fault"})
+		}
+		return
+	}
+
+	s.mutex.Lock()
+	output, err := handler(s, r.Form)
+	s.mutex.Unlock()
+	if err != nil {
+		writeLbuError(w, err)
+		return
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<%sResponse><%sResult>", action, action)
+	if buildErr := xmlutil.BuildXML(output, xml.NewEncoder(&body)); buildErr != nil {
+		writeLbuError(w, &lbuError{status: http.StatusInternalServerError, code: "InternalError", message: buildErr.Error()})
+		return
+	}
+	fmt.Fprintf(&body, "</%sResult><ResponseMetadata><RequestId>fake</RequestId></ResponseMetadata></%sResponse>", action, action)
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = w.Write(body.Bytes())
+}
+
+func writeLbuError(w http.ResponseWriter, err *lbuError) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(err.status)
+	var message bytes.Buffer
+	_ = xml.EscapeText(&message, []byte(err.message))
+	fmt.Fprintf(w, "<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>fake</RequestId></ErrorResponse>",
+		err.code, message.String())
+}
+
+// decodeParams decodes the parameters of the query protocol into the input of an action,
+// the lists being named <name>.member.<index> and the structures <name>.<field>
+func decodeParams(params url.Values, input interface{}) *lbuError {
+	if err := decodeStruct(params, reflect.ValueOf(input).Elem(), ""); err != nil {
+		return lbuClientError("InvalidParameterValue", "%v", err)
+	}
+	return nil
+}
+
+// hasParams returns whether a parameter is named prefix, or starts with prefix.
+func hasParams(params url.Values, prefix string) bool {
+	for name := range params {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeStruct(params url.Values, value reflect.Value, prefix string) error {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Tag.Get("locationName")
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if err := decodeValue(params, value.Field(i), name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeValue(params url.Values, value reflect.Value, name string) error {
+	if !hasParams(params, name) {
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Slice:
+		list := reflect.MakeSlice(value.Type(), 0, 0)
+		for i := 1; hasParams(params, fmt.Sprintf("%s.member.%d", name, i)); i++ {
+			item := reflect.New(value.Type().Elem().Elem())
+			if err := decodeValue(params, item, fmt.Sprintf("%s.member.%d", name, i)); err != nil {
+				return err
+			}
+			list = reflect.Append(list, item)
+		}
+		value.Set(list)
+		return nil
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		if value.Elem().Kind() == reflect.Struct {
+			return decodeStruct(params, value.Elem(), name)
+		}
+		return decodeValue(params, value.Elem(), name)
+	case reflect.String:
+		value.SetString(params.Get(name))
+	case reflect.Int64:
+		i, err := strconv.ParseInt(params.Get(name), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+		value.SetInt(i)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(params.Get(name))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+		value.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported parameter %s", name)
+	}
+	return nil
+}
+
+// loadBalancer returns the load balancer, or a LoadBalancerNotFound error
+func (s *FakeAPIServer) loadBalancer(name *string) (*fakeLoadBalancer, *lbuError) {
+	lb, found := s.loadBalancers[aws.StringValue(name)]
+	if !found {
+		return nil, loadBalancerNotFound(name)
+	}
+	return lb, nil
+}
+
+func (s *FakeAPIServer) createLoadBalancer(params url.Values) (interface{}, *lbuError) {
+	var input elb.CreateLoadBalancerInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.LoadBalancerName)
+	if _, found := s.loadBalancers[name]; found {
+		return nil, lbuClientError(elb.ErrCodeDuplicateAccessPointNameException, "load balancer %s already exists", name)
+	}
+	for _, group := range input.SecurityGroups {
+		if _, found := s.securityGroups[aws.StringValue(group)]; !found {
+			return nil, lbuClientError(elb.ErrCodeInvalidSecurityGroupException, "security group %s not found", aws.StringValue(group))
+		}
+	}
+	description := &elb.LoadBalancerDescription{
+		LoadBalancerName:          input.LoadBalancerName,
+		DNSName:                   aws.String(fmt.Sprintf("%s.lbu.example.com", name)),
+		AvailabilityZones:         input.AvailabilityZones,
+		Subnets:                   input.Subnets,
+		SecurityGroups:            input.SecurityGroups,
+		Scheme:                    aws.String("internet-facing"),
+		HealthCheck:               &elb.HealthCheck{},
+		Instances:                 []*elb.Instance{},
+		BackendServerDescriptions: []*elb.BackendServerDescription{},
+		ListenerDescriptions:      []*elb.ListenerDescription{},
+	}
+	if input.Scheme != nil {
+		description.Scheme = input.Scheme
+	}
+	for _, subnet := range input.Subnets {
+		if s.subnets[aws.StringValue(subnet)] != nil {
+			description.VPCId = s.subnets[aws.StringValue(subnet)].NetId
+		}
+	}
+	for _, listener := range input.Listeners {
+		description.ListenerDescriptions = append(description.ListenerDescriptions,
+			&elb.ListenerDescription{Listener: listener, PolicyNames: []*string{}})
+	}
+	s.loadBalancers[name] = &fakeLoadBalancer{
+		description: description,
+		tags:        input.Tags,
+		attributes: &elb.LoadBalancerAttributes{
+			ConnectionDraining: &elb.ConnectionDraining{Enabled: aws.Bool(false)},
+			ConnectionSettings: &elb.ConnectionSettings{IdleTimeout: aws.Int64(60)},
+		},
+		policies: make(map[string]*elb.PolicyDescription),
+	}
+	s.hide(name)
+	return &elb.CreateLoadBalancerOutput{DNSName: description.DNSName}, nil
+}
+
+// deleteLoadBalancer deletes the load balancer, which keeps its security groups in use
+// for a while with SetConsistencyDelay. As LBU, it succeeds when it is not found.
+func (s *FakeAPIServer) deleteLoadBalancer(params url.Values) (interface{}, *lbuError) {
+	var input elb.DeleteLoadBalancerInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.LoadBalancerName)
+	if lb, found := s.loadBalancers[name]; found {
+		delete(s.loadBalancers, name)
+		delete(s.hidden, name)
+		if s.consistencyDelay > 0 {
+			lb.pendingDeletions = s.consistencyDelay
+			s.deletingLoadBalancers[name] = lb
+		}
+	}
+	return &elb.DeleteLoadBalancerOutput{}, nil
+}
+
+// describeLoadBalancers describes the given load balancers, or pages through all of them
+// with SetPageSize
+func (s *FakeAPIServer) describeLoadBalancers(params url.Values) (interface{}, *lbuError) {
+	var input elb.DescribeLoadBalancersInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	output := &elb.DescribeLoadBalancersOutput{LoadBalancerDescriptions: []*elb.LoadBalancerDescription{}}
+	if len(input.LoadBalancerNames) > 0 {
+		for _, name := range input.LoadBalancerNames {
+			lb, found := s.loadBalancers[aws.StringValue(name)]
+			if !found || !s.visible(aws.StringValue(name)) {
+				return nil, loadBalancerNotFound(name)
+			}
+			output.LoadBalancerDescriptions = append(output.LoadBalancerDescriptions, lb.description)
+		}
+		return output, nil
+	}
+
+	names := []string{}
+	for _, name := range sets.StringKeySet(s.loadBalancers).List() {
+		if name > aws.StringValue(input.Marker) && s.visible(name) {
+			names = append(names, name)
+		}
+	}
+	if s.pageSize > 0 && len(names) > s.pageSize {
+		names = names[:s.pageSize]
+		output.NextMarker = aws.String(names[len(names)-1])
+	}
+	for _, name := range names {
+		output.LoadBalancerDescriptions = append(output.LoadBalancerDescriptions, s.loadBalancers[name].description)
+	}
+	return output, nil
+}
+
+func (s *FakeAPIServer) addTags(params url.Values) (interface{}, *lbuError) {
+	var input elb.AddTagsInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	for _, name := range input.LoadBalancerNames {
+		lb, err := s.loadBalancer(name)
+		if err != nil {
+			return nil, err
+		}
+		tags := []*elb.Tag{}
+		for _, tag := range lb.tags {
+			updated := false
+			for _, added := range input.Tags {
+				updated = updated || aws.StringValue(added.Key) == aws.StringValue(tag.Key)
+			}
+			if !updated {
+				tags = append(tags, tag)
+			}
+		}
+		lb.tags = append(tags, input.Tags...)
+	}
+	return &elb.AddTagsOutput{}, nil
+}
+
+func (s *FakeAPIServer) removeTags(params url.Values) (interface{}, *lbuError) {
+	var input elb.RemoveTagsInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	for _, name := range input.LoadBalancerNames {
+		lb, err := s.loadBalancer(name)
+		if err != nil {
+			return nil, err
+		}
+		tags := []*elb.Tag{}
+		for _, tag := range lb.tags {
+			removed := false
+			for _, key := range input.Tags {
+				removed = removed || aws.StringValue(key.Key) == aws.StringValue(tag.Key)
+			}
+			if !removed {
+				tags = append(tags, tag)
+			}
+		}
+		lb.tags = tags
+	}
+	return &elb.RemoveTagsOutput{}, nil
+}
+
+func (s *FakeAPIServer) describeTags(params url.Values) (interface{}, *lbuError) {
+	var input elb.DescribeTagsInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	output := &elb.DescribeTagsOutput{TagDescriptions: []*elb.TagDescription{}}
+	for _, name := range input.LoadBalancerNames {
+		lb, err := s.loadBalancer(name)
+		if err != nil {
+			return nil, err
+		}
+		output.TagDescriptions = append(output.TagDescriptions, &elb.TagDescription{LoadBalancerName: name, Tags: lb.tags})
+	}
+	return output, nil
+}
+
+func (s *FakeAPIServer) registerInstances(params url.Values) (interface{}, *lbuError) {
+	var input elb.RegisterInstancesWithLoadBalancerInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	registered := sets.NewString()
+	for _, instance := range lb.description.Instances {
+		registered.Insert(aws.StringValue(instance.InstanceId))
+	}
+	for _, instance := range input.Instances {
+		if _, found := s.vms[aws.StringValue(instance.InstanceId)]; !found {
+			return nil, lbuClientError(elb.ErrCodeInvalidEndPointException, "VM %s not found", aws.StringValue(instance.InstanceId))
+		}
+		if !registered.Has(aws.StringValue(instance.InstanceId)) {
+			registered.Insert(aws.StringValue(instance.InstanceId))
+			lb.description.Instances = append(lb.description.Instances, &elb.Instance{InstanceId: instance.InstanceId})
+		}
+	}
+	return &elb.RegisterInstancesWithLoadBalancerOutput{Instances: lb.description.Instances}, nil
+}
+
+func (s *FakeAPIServer) deregisterInstances(params url.Values) (interface{}, *lbuError) {
+	var input elb.DeregisterInstancesFromLoadBalancerInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	removed := sets.NewString()
+	for _, instance := range input.Instances {
+		removed.Insert(aws.StringValue(instance.InstanceId))
+	}
+	instances := []*elb.Instance{}
+	for _, instance := range lb.description.Instances {
+		if !removed.Has(aws.StringValue(instance.InstanceId)) {
+			instances = append(instances, instance)
+		}
+	}
+	lb.description.Instances = instances
+	return &elb.DeregisterInstancesFromLoadBalancerOutput{Instances: instances}, nil
+}
+
+// addPolicy adds a policy to the load balancer, updating the policies of its description
+func (s *FakeAPIServer) addPolicy(lbName *string, policy *elb.PolicyDescription) *lbuError {
+	lb, err := s.loadBalancer(lbName)
+	if err != nil {
+		return err
+	}
+	name := aws.StringValue(policy.PolicyName)
+	if _, found := lb.policies[name]; found {
+		return lbuClientError(elb.ErrCodeDuplicatePolicyNameException, "policy %s already exists", name)
+	}
+	lb.policies[name] = policy
+	if lb.description.Policies == nil {
+		lb.description.Policies = &elb.Policies{}
+	}
+	policies := lb.description.Policies
+	switch aws.StringValue(policy.PolicyTypeName) {
+	case "LBCookieStickinessPolicyType":
+		policies.LBCookieStickinessPolicies = append(policies.LBCookieStickinessPolicies, &elb.LBCookieStickinessPolicy{PolicyName: policy.PolicyName})
+	case "AppCookieStickinessPolicyType":
+		policies.AppCookieStickinessPolicies = append(policies.AppCookieStickinessPolicies, &elb.AppCookieStickinessPolicy{PolicyName: policy.PolicyName})
+	default:
+		policies.OtherPolicies = append(policies.OtherPolicies, policy.PolicyName)
+	}
+	return nil
+}
+
+func (s *FakeAPIServer) createLoadBalancerPolicy(params url.Values) (interface{}, *lbuError) {
+	var input elb.CreateLoadBalancerPolicyInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	policy := &elb.PolicyDescription{PolicyName: input.PolicyName, PolicyTypeName: input.PolicyTypeName}
+	for _, attribute := range input.PolicyAttributes {
+		policy.PolicyAttributeDescriptions = append(policy.PolicyAttributeDescriptions, &elb.PolicyAttributeDescription{
+			AttributeName:  attribute.AttributeName,
+			AttributeValue: attribute.AttributeValue,
+		})
+	}
+	if err := s.addPolicy(input.LoadBalancerName, policy); err != nil {
+		return nil, err
+	}
+	return &elb.CreateLoadBalancerPolicyOutput{}, nil
+}
+
+func (s *FakeAPIServer) createLBCookieStickinessPolicy(params url.Values) (interface{}, *lbuError) {
+	var input elb.CreateLBCookieStickinessPolicyInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	policy := &elb.PolicyDescription{PolicyName: input.PolicyName, PolicyTypeName: aws.String("LBCookieStickinessPolicyType")}
+	if input.CookieExpirationPeriod != nil {
+		policy.PolicyAttributeDescriptions = []*elb.PolicyAttributeDescription{{
+			AttributeName:  aws.String("CookieExpirationPeriod"),
+			AttributeValue: aws.String(strconv.FormatInt(*input.CookieExpirationPeriod, 10)),
+		}}
+	}
+	if err := s.addPolicy(input.LoadBalancerName, policy); err != nil {
+		return nil, err
+	}
+	return &elb.CreateLBCookieStickinessPolicyOutput{}, nil
+}
+
+func (s *FakeAPIServer) createAppCookieStickinessPolicy(params url.Values) (interface{}, *lbuError) {
+	var input elb.CreateAppCookieStickinessPolicyInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	policy := &elb.PolicyDescription{
+		PolicyName:     input.PolicyName,
+		PolicyTypeName: aws.String("AppCookieStickinessPolicyType"),
+		PolicyAttributeDescriptions: []*elb.PolicyAttributeDescription{{
+			AttributeName:  aws.String("CookieName"),
+			AttributeValue: input.CookieName,
+		}},
+	}
+	if err := s.addPolicy(input.LoadBalancerName, policy); err != nil {
+		return nil, err
+	}
+	return &elb.CreateAppCookieStickinessPolicyOutput{}, nil
+}
+
+// checkPolicies returns a PolicyNotFound error when a policy is missing
+func checkPolicies(lb *fakeLoadBalancer, names []*string) *lbuError {
+	for _, name := range names {
+		if _, found := lb.policies[aws.StringValue(name)]; !found {
+			return lbuClientError(elb.ErrCodePolicyNotFoundException, "policy %s not found", aws.StringValue(name))
+		}
+	}
+	return nil
+}
+
+func (s *FakeAPIServer) setBackendServerPolicies(params url.Values) (interface{}, *lbuError) {
+	var input elb.SetLoadBalancerPoliciesForBackendServerInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPolicies(lb, input.PolicyNames); err != nil {
+		return nil, err
+	}
+	if input.PolicyNames == nil {
+		input.PolicyNames = []*string{}
+	}
+	for _, backend := range lb.description.BackendServerDescriptions {
+		if aws.Int64Value(backend.InstancePort) == aws.Int64Value(input.InstancePort) {
+			backend.PolicyNames = input.PolicyNames
+			return &elb.SetLoadBalancerPoliciesForBackendServerOutput{}, nil
+		}
+	}
+	lb.description.BackendServerDescriptions = append(lb.description.BackendServerDescriptions, &elb.BackendServerDescription{
+		InstancePort: input.InstancePort,
+		PolicyNames:  input.PolicyNames,
+	})
+	return &elb.SetLoadBalancerPoliciesForBackendServerOutput{}, nil
+}
+
+func (s *FakeAPIServer) setListenerPolicies(params url.Values) (interface{}, *lbuError) {
+	var input elb.SetLoadBalancerPoliciesOfListenerInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPolicies(lb, input.PolicyNames); err != nil {
+		return nil, err
+	}
+	if input.PolicyNames == nil {
+		input.PolicyNames = []*string{}
+	}
+	for _, listener := range lb.description.ListenerDescriptions {
+		if aws.Int64Value(listener.Listener.LoadBalancerPort) == aws.Int64Value(input.LoadBalancerPort) {
+			listener.PolicyNames = input.PolicyNames
+			return &elb.SetLoadBalancerPoliciesOfListenerOutput{}, nil
+		}
+	}
+	return nil, lbuClientError(elb.ErrCodeListenerNotFoundException, "listener on port %d not found", aws.Int64Value(input.LoadBalancerPort))
+}
+
+func (s *FakeAPIServer) describeLoadBalancerPolicies(params url.Values) (interface{}, *lbuError) {
+	var input elb.DescribeLoadBalancerPoliciesInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPolicies(lb, input.PolicyNames); err != nil {
+		return nil, err
+	}
+	names := input.PolicyNames
+	if len(names) == 0 {
+		names = aws.StringSlice(sets.StringKeySet(lb.policies).List())
+	}
+	output := &elb.DescribeLoadBalancerPoliciesOutput{PolicyDescriptions: []*elb.PolicyDescription{}}
+	for _, name := range names {
+		output.PolicyDescriptions = append(output.PolicyDescriptions, lb.policies[aws.StringValue(name)])
+	}
+	return output, nil
+}
+
+func (s *FakeAPIServer) deleteLoadBalancerPolicy(params url.Values) (interface{}, *lbuError) {
+	var input elb.DeleteLoadBalancerPolicyInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.PolicyName)
+	for _, listener := range lb.description.ListenerDescriptions {
+		if sets.NewString(aws.StringValueSlice(listener.PolicyNames)...).Has(name) {
+			return nil, lbuClientError(elb.ErrCodeInvalidConfigurationRequestException, "policy %s is used by listener %d",
+				name, aws.Int64Value(listener.Listener.LoadBalancerPort))
+		}
+	}
+	delete(lb.policies, name)
+	if policies := lb.description.Policies; policies != nil {
+		lbCookie := []*elb.LBCookieStickinessPolicy{}
+		for _, policy := range policies.LBCookieStickinessPolicies {
+			if aws.StringValue(policy.PolicyName) != name {
+				lbCookie = append(lbCookie, policy)
+			}
+		}
+		appCookie := []*elb.AppCookieStickinessPolicy{}
+		for _, policy := range policies.AppCookieStickinessPolicies {
+			if aws.StringValue(policy.PolicyName) != name {
+				appCookie = append(appCookie, policy)
+			}
+		}
+		other := []*string{}
+		for _, policy := range policies.OtherPolicies {
+			if aws.StringValue(policy) != name {
+				other = append(other, policy)
+			}
+		}
+		policies.LBCookieStickinessPolicies, policies.AppCookieStickinessPolicies, policies.OtherPolicies = lbCookie, appCookie, other
+	}
+	return &elb.DeleteLoadBalancerPolicyOutput{}, nil
+}
+
+func (s *FakeAPIServer) detachSubnets(params url.Values) (interface{}, *lbuError) {
+	var input elb.DetachLoadBalancerFromSubnetsInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	detached := sets.NewString(aws.StringValueSlice(input.Subnets)...)
+	subnets := []*string{}
+	for _, subnet := range lb.description.Subnets {
+		if !detached.Has(aws.StringValue(subnet)) {
+			subnets = append(subnets, subnet)
+		}
+	}
+	lb.description.Subnets = subnets
+	return &elb.DetachLoadBalancerFromSubnetsOutput{Subnets: subnets}, nil
+}
+
+func (s *FakeAPIServer) attachSubnets(params url.Values) (interface{}, *lbuError) {
+	var input elb.AttachLoadBalancerToSubnetsInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	attached := sets.NewString(aws.StringValueSlice(lb.description.Subnets)...)
+	for _, subnet := range input.Subnets {
+		if _, found := s.subnets[aws.StringValue(subnet)]; !found {
+			return nil, lbuClientError(elb.ErrCodeSubnetNotFoundException, "subnet %s not found", aws.StringValue(subnet))
+		}
+		if !attached.Has(aws.StringValue(subnet)) {
+			attached.Insert(aws.StringValue(subnet))
+			lb.description.Subnets = append(lb.description.Subnets, subnet)
+		}
+	}
+	return &elb.AttachLoadBalancerToSubnetsOutput{Subnets: lb.description.Subnets}, nil
+}
+
+func (s *FakeAPIServer) createListeners(params url.Values) (interface{}, *lbuError) {
+	var input elb.CreateLoadBalancerListenersInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	for _, listener := range input.Listeners {
+		for _, description := range lb.description.ListenerDescriptions {
+			if aws.Int64Value(description.Listener.LoadBalancerPort) == aws.Int64Value(listener.LoadBalancerPort) &&
+				!reflect.DeepEqual(description.Listener, listener) {
+				return nil, lbuClientError(elb.ErrCodeDuplicateListenerException, "listener on port %d already exists",
+					aws.Int64Value(listener.LoadBalancerPort))
+			}
+		}
+	}
+	for _, listener := range input.Listeners {
+		lb.description.ListenerDescriptions = append(lb.description.ListenerDescriptions,
+			&elb.ListenerDescription{Listener: listener, PolicyNames: []*string{}})
+	}
+	sort.SliceStable(lb.description.ListenerDescriptions, func(i, j int) bool {
+		return aws.Int64Value(lb.description.ListenerDescriptions[i].Listener.LoadBalancerPort) <
+			aws.Int64Value(lb.description.ListenerDescriptions[j].Listener.LoadBalancerPort)
+	})
+	return &elb.CreateLoadBalancerListenersOutput{}, nil
+}
+
+func (s *FakeAPIServer) deleteListeners(params url.Values) (interface{}, *lbuError) {
+	var input elb.DeleteLoadBalancerListenersInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	removed := make(map[int64]bool)
+	for _, port := range input.LoadBalancerPorts {
+		removed[aws.Int64Value(port)] = true
+	}
+	kept := []*elb.ListenerDescription{}
+	for _, description := range lb.description.ListenerDescriptions {
+		if !removed[aws.Int64Value(description.Listener.LoadBalancerPort)] {
+			kept = append(kept, description)
+		}
+	}
+	lb.description.ListenerDescriptions = kept
+	return &elb.DeleteLoadBalancerListenersOutput{}, nil
+}
+
+func (s *FakeAPIServer) applySecurityGroups(params url.Values) (interface{}, *lbuError) {
+	var input elb.ApplySecurityGroupsToLoadBalancerInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range input.SecurityGroups {
+		if _, found := s.securityGroups[aws.StringValue(group)]; !found {
+			return nil, lbuClientError(elb.ErrCodeInvalidSecurityGroupException, "security group %s not found", aws.StringValue(group))
+		}
+	}
+	lb.description.SecurityGroups = input.SecurityGroups
+	return &elb.ApplySecurityGroupsToLoadBalancerOutput{SecurityGroups: input.SecurityGroups}, nil
+}
+
+func (s *FakeAPIServer) configureHealthCheck(params url.Values) (interface{}, *lbuError) {
+	var input elb.ConfigureHealthCheckInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	lb.description.HealthCheck = input.HealthCheck
+	return &elb.ConfigureHealthCheckOutput{HealthCheck: input.HealthCheck}, nil
+}
+
+func (s *FakeAPIServer) describeAttributes(params url.Values) (interface{}, *lbuError) {
+	var input elb.DescribeLoadBalancerAttributesInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	return &elb.DescribeLoadBalancerAttributesOutput{LoadBalancerAttributes: lb.attributes}, nil
+}
+
+// modifyAttributes updates the attributes set by the request, keeping the others
+func (s *FakeAPIServer) modifyAttributes(params url.Values) (interface{}, *lbuError) {
+	var input elb.ModifyLoadBalancerAttributesInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	attributes := awsutil.CopyOf(lb.attributes).(*elb.LoadBalancerAttributes)
+	if modified := input.LoadBalancerAttributes; modified != nil {
+		if modified.AccessLog != nil {
+			attributes.AccessLog = modified.AccessLog
+		}
+		if modified.ConnectionDraining != nil {
+			attributes.ConnectionDraining = modified.ConnectionDraining
+		}
+		if modified.ConnectionSettings != nil {
+			attributes.ConnectionSettings = modified.ConnectionSettings
+		}
+		if modified.CrossZoneLoadBalancing != nil {
+			attributes.CrossZoneLoadBalancing = modified.CrossZoneLoadBalancing
+		}
+	}
+	lb.attributes = attributes
+	return &elb.ModifyLoadBalancerAttributesOutput{LoadBalancerName: input.LoadBalancerName, LoadBalancerAttributes: attributes}, nil
+}
+
+// describeInstanceHealth returns the health set with SetInstanceHealth of the given
+// instances, or of all the instances of the load balancer
+func (s *FakeAPIServer) describeInstanceHealth(params url.Values) (interface{}, *lbuError) {
+	var input elb.DescribeInstanceHealthInput
+	if err := decodeParams(params, &input); err != nil {
+		return nil, err
+	}
+	lb, err := s.loadBalancer(input.LoadBalancerName)
+	if err != nil {
+		return nil, err
+	}
+	instances := input.Instances
+	if len(instances) == 0 {
+		instances = lb.description.Instances
+	}
+	output := &elb.DescribeInstanceHealthOutput{InstanceStates: []*elb.InstanceState{}}
+	for _, instance := range instances {
+		state, found := s.instanceHealth[aws.StringValue(instance.InstanceId)]
+		if !found {
+			state = "Unknown"
+		}
+		output.InstanceStates = append(output.InstanceStates, &elb.InstanceState{InstanceId: instance.InstanceId, State: aws.String(state)})
+	}
+	return output, nil
+}
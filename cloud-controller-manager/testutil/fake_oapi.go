@@ -0,0 +1,698 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/outscale/osc-sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ********************* Fake oAPI *********************
+
+// oapiError is an error of an oAPI call
+type oapiError struct {
+	status int
+	code   string
+	reason string
+}
+
+func (e *oapiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.code, e.reason)
+}
+
+func invalidResource(format string, args ...interface{}) *oapiError {
+	return &oapiError{status: http.StatusBadRequest, code: "InvalidResource", reason: fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...interface{}) *oapiError {
+	return &oapiError{status: http.StatusConflict, code: "ResourceConflict", reason: fmt.Sprintf(format, args...)}
+}
+
+// oapiOperation decodes the request of an operation, and returns its response or error
+type oapiOperation func(s *FakeAPIServer, decode func(interface{}) error) (interface{}, *oapiError)
+
+// oapiOperations are the oAPI operations used by the cloud provider
+var oapiOperations = map[string]oapiOperation{
+	"ReadVms":                 (*FakeAPIServer).readVms,
+	"UpdateVm":                (*FakeAPIServer).updateVM,
+	"ReadSecurityGroups":      (*FakeAPIServer).readSecurityGroups,
+	"CreateSecurityGroup":     (*FakeAPIServer).createSecurityGroup,
+	"DeleteSecurityGroup":     (*FakeAPIServer).deleteSecurityGroup,
+	"CreateSecurityGroupRule": (*FakeAPIServer).createSecurityGroupRule,
+	"DeleteSecurityGroupRule": (*FakeAPIServer).deleteSecurityGroupRule,
+	"ReadSubnets":             (*FakeAPIServer).readSubnets,
+	"CreateTags":              (*FakeAPIServer).createTags,
+	"DeleteTags":              (*FakeAPIServer).deleteTags,
+	"ReadRouteTables":         (*FakeAPIServer).readRouteTables,
+	"CreateRoute":             (*FakeAPIServer).createRoute,
+	"DeleteRoute":             (*FakeAPIServer).deleteRoute,
+	"ReadPublicIps":           (*FakeAPIServer).readPublicIps,
+	"CreatePublicIp":          (*FakeAPIServer).createPublicIP,
+	"DeletePublicIp":          (*FakeAPIServer).deletePublicIP,
+	"ReadLoadBalancers":       (*FakeAPIServer).readLoadBalancers,
+	"UpdateLoadBalancer":      (*FakeAPIServer).updateLoadBalancer,
+}
+
+// serveOapi serves an oAPI call, POST /api/v1/<operation> with a JSON body
+func (s *FakeAPIServer) serveOapi(w http.ResponseWriter, r *http.Request, operation string) {
+	handler, found := oapiOperations[operation]
+	if !found {
+		writeOapiError(w, &oapiError{status: http.StatusNotFound, code: "OperationNotSupported", reason: operation})
+		return
+	}
+	if f := s.call(operation); f != nil {
+		writeOapiError(w, &oapiError{status: f.status, code: f.code, reason: "injected fault"})
+		return
+	}
+
+	decode := func(request interface{}) error {
+		return json.NewDecoder(r.Body).Decode(request)
+	}
+	s.mutex.Lock()
+	response, err := handler(s, decode)
+	s.mutex.Unlock()
+	if err != nil {
+		writeOapiError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func writeOapiError(w http.ResponseWriter, err *oapiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.status)
+	_ = json.NewEncoder(w).Encode(osc.ErrorResponse{
+		Errors: &[]osc.Errors{{Code: osc.PtrString(err.code), Type: osc.PtrString(err.code), Details: osc.PtrString(err.reason)}},
+	})
+}
+
+// decodeRequest decodes the request, as a bad request on failure
+func decodeRequest(decode func(interface{}) error, request interface{}) *oapiError {
+	if err := decode(request); err != nil {
+		return &oapiError{status: http.StatusBadRequest, code: "InvalidParameterValue", reason: err.Error()}
+	}
+	return nil
+}
+
+// matchTags returns whether the tags have all the keys, values and key=value pairs
+func matchTags(tags []osc.ResourceTag, keys, values, pairs []string) bool {
+	byKey := map[string]string{}
+	byValue := sets.NewString()
+	for _, tag := range tags {
+		byKey[tag.Key] = tag.Value
+		byValue.Insert(tag.Value)
+	}
+	for _, key := range keys {
+		if _, found := byKey[key]; !found {
+			return false
+		}
+	}
+	if !byValue.HasAll(values...) {
+		return false
+	}
+	for _, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		if current, found := byKey[key]; !found || current != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny returns whether the value is one of the filter values, when filtered
+func matchAny(filter *[]string, value string) bool {
+	return filter == nil || sets.NewString(*filter...).Has(value)
+}
+
+func (s *FakeAPIServer) readVms(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.ReadVmsRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	filters := request.GetFilters()
+	vms := []osc.Vm{}
+	for _, id := range sets.StringKeySet(s.vms).List() {
+		vm := s.vms[id]
+		if matchAny(filters.VmIds, id) && matchTags(vm.GetTags(), filters.GetTagKeys(), filters.GetTagValues(), filters.GetTags()) {
+			vms = append(vms, *vm)
+		}
+	}
+	return osc.ReadVmsResponse{Vms: &vms}, nil
+}
+
+// updateVM only updates the source/dest check of the VM
+func (s *FakeAPIServer) updateVM(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.UpdateVmRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	vm, found := s.vms[request.VmId]
+	if !found {
+		return nil, invalidResource("VM %s not found", request.VmId)
+	}
+	if request.IsSourceDestChecked != nil {
+		vm.SetIsSourceDestChecked(request.GetIsSourceDestChecked())
+	}
+	return osc.UpdateVmResponse{Vm: vm}, nil
+}
+
+func (s *FakeAPIServer) readSecurityGroups(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.ReadSecurityGroupsRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	filters := request.GetFilters()
+	groups := []osc.SecurityGroup{}
+	for _, id := range sets.StringKeySet(s.securityGroups).List() {
+		group := s.securityGroups[id]
+		if !matchAny(filters.SecurityGroupIds, id) || !matchAny(filters.SecurityGroupNames, group.GetSecurityGroupName()) ||
+			!matchAny(filters.NetIds, group.GetNetId()) ||
+			!matchTags(group.GetTags(), filters.GetTagKeys(), filters.GetTagValues(), filters.GetTags()) {
+			continue
+		}
+		if filters.InboundRuleSecurityGroupIds != nil {
+			linked := false
+			for _, rule := range group.GetInboundRules() {
+				for _, member := range rule.GetSecurityGroupsMembers() {
+					linked = linked || matchAny(filters.InboundRuleSecurityGroupIds, member.GetSecurityGroupId())
+				}
+			}
+			if !linked {
+				continue
+			}
+		}
+		if s.visible(id) {
+			groups = append(groups, copySecurityGroup(group))
+		}
+	}
+	return osc.ReadSecurityGroupsResponse{SecurityGroups: &groups}, nil
+}
+
+func (s *FakeAPIServer) createSecurityGroup(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.CreateSecurityGroupRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	if request.GetDryRun() {
+		return osc.CreateSecurityGroupResponse{}, nil
+	}
+	for _, group := range s.securityGroups {
+		if group.GetSecurityGroupName() == request.SecurityGroupName && group.GetNetId() == request.GetNetId() {
+			return nil, conflict("security group %s already exists", request.SecurityGroupName)
+		}
+	}
+	group := newSecurityGroup(osc.SecurityGroup{
+		SecurityGroupId:   osc.PtrString(s.newID("sg")),
+		SecurityGroupName: osc.PtrString(request.SecurityGroupName),
+		Description:       osc.PtrString(request.Description),
+		NetId:             request.NetId,
+	})
+	s.securityGroups[group.GetSecurityGroupId()] = group
+	s.hide(group.GetSecurityGroupId())
+	created := copySecurityGroup(group)
+	return osc.CreateSecurityGroupResponse{SecurityGroup: &created}, nil
+}
+
+// deleteSecurityGroup deletes a security group, unless it is used by a load balancer
+func (s *FakeAPIServer) deleteSecurityGroup(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.DeleteSecurityGroupRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	id := request.GetSecurityGroupId()
+	if _, found := s.securityGroups[id]; !found {
+		return nil, invalidResource("security group %s not found", id)
+	}
+	for name, lb := range s.loadBalancers {
+		if lb.hasSecurityGroup(id) {
+			return nil, conflict("security group %s is used by load balancer %s", id, name)
+		}
+	}
+	for name, lb := range s.deletingLoadBalancers {
+		if lb.hasSecurityGroup(id) {
+			if lb.pendingDeletions--; lb.pendingDeletions <= 0 {
+				delete(s.deletingLoadBalancers, name)
+			}
+			return nil, conflict("security group %s is used by load balancer %s being deleted", id, name)
+		}
+	}
+	delete(s.securityGroups, id)
+	return osc.DeleteSecurityGroupResponse{}, nil
+}
+
+// requestRules returns the rules of a CreateSecurityGroupRule or DeleteSecurityGroupRule
+// request, set either as Rules or as a single rule
+func (s *FakeAPIServer) requestRules(rules *[]osc.SecurityGroupRule, protocol *string, from, to *int32, ipRange *string,
+	groupName, accountID *string) []osc.SecurityGroupRule {
+	if rules != nil {
+		return *rules
+	}
+	rule := osc.SecurityGroupRule{IpProtocol: protocol, FromPortRange: from, ToPortRange: to}
+	if ipRange != nil {
+		rule.IpRanges = &[]string{*ipRange}
+	}
+	if groupName != nil {
+		member := osc.SecurityGroupsMember{SecurityGroupName: groupName, AccountId: accountID}
+		for _, group := range s.securityGroups {
+			if group.GetSecurityGroupName() == *groupName {
+				member.SecurityGroupId = group.SecurityGroupId
+			}
+		}
+		rule.SecurityGroupsMembers = &[]osc.SecurityGroupsMember{member}
+	}
+	return []osc.SecurityGroupRule{rule}
+}
+
+func (s *FakeAPIServer) createSecurityGroupRule(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.CreateSecurityGroupRuleRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	if request.GetDryRun() {
+		return osc.CreateSecurityGroupRuleResponse{}, nil
+	}
+	group, found := s.securityGroups[request.SecurityGroupId]
+	if !found {
+		return nil, invalidResource("security group %s not found", request.SecurityGroupId)
+	}
+	current := group.InboundRules
+	if request.Flow == "Outbound" {
+		current = group.OutboundRules
+	}
+	existing := map[string]bool{}
+	for _, rule := range *current {
+		existing[ruleKey(rule)] = true
+	}
+	added := ungroupRules(s.requestRules(request.Rules, request.IpProtocol, request.FromPortRange, request.ToPortRange,
+		request.IpRange, request.SecurityGroupNameToLink, request.SecurityGroupAccountIdToLink))
+	for _, rule := range added {
+		if existing[ruleKey(rule)] {
+			return nil, conflict("rule %s already exists", ruleKey(rule))
+		}
+		existing[ruleKey(rule)] = true
+	}
+	*current = append(*current, added...)
+	updated := copySecurityGroup(group)
+	return osc.CreateSecurityGroupRuleResponse{SecurityGroup: &updated}, nil
+}
+
+func (s *FakeAPIServer) deleteSecurityGroupRule(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.DeleteSecurityGroupRuleRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	group, found := s.securityGroups[request.SecurityGroupId]
+	if !found {
+		return nil, invalidResource("security group %s not found", request.SecurityGroupId)
+	}
+	current := group.InboundRules
+	if request.Flow == "Outbound" {
+		current = group.OutboundRules
+	}
+	removed := map[string]bool{}
+	for _, rule := range ungroupRules(s.requestRules(request.Rules, request.IpProtocol, request.FromPortRange, request.ToPortRange,
+		request.IpRange, request.SecurityGroupNameToUnlink, request.SecurityGroupAccountIdToUnlink)) {
+		removed[ruleKey(rule)] = true
+	}
+	kept := []osc.SecurityGroupRule{}
+	for _, rule := range *current {
+		if removed[ruleKey(rule)] {
+			delete(removed, ruleKey(rule))
+		} else {
+			kept = append(kept, rule)
+		}
+	}
+	for key := range removed {
+		return nil, invalidResource("rule %s not found", key)
+	}
+	*current = kept
+	updated := copySecurityGroup(group)
+	return osc.DeleteSecurityGroupRuleResponse{SecurityGroup: &updated}, nil
+}
+
+func (s *FakeAPIServer) readSubnets(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.ReadSubnetsRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	filters := request.GetFilters()
+	subnets := []osc.Subnet{}
+	for _, id := range sets.StringKeySet(s.subnets).List() {
+		subnet := s.subnets[id]
+		if matchAny(filters.SubnetIds, id) && matchAny(filters.NetIds, subnet.GetNetId()) &&
+			matchAny(filters.SubregionNames, subnet.GetSubregionName()) &&
+			matchTags(subnet.GetTags(), filters.GetTagKeys(), filters.GetTagValues(), filters.GetTags()) {
+			subnets = append(subnets, *subnet)
+		}
+	}
+	return osc.ReadSubnetsResponse{Subnets: &subnets}, nil
+}
+
+// resourceTags returns the tags of a VM, security group, subnet, route table or public IP
+func (s *FakeAPIServer) resourceTags(id string) *[]osc.ResourceTag {
+	switch {
+	case s.vms[id] != nil:
+		return s.vms[id].Tags
+	case s.securityGroups[id] != nil:
+		return s.securityGroups[id].Tags
+	case s.subnets[id] != nil:
+		return s.subnets[id].Tags
+	case s.routeTables[id] != nil:
+		return s.routeTables[id].Tags
+	case s.publicIps[id] != nil:
+		return s.publicIps[id].Tags
+	}
+	return nil
+}
+
+func (s *FakeAPIServer) createTags(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.CreateTagsRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	for _, id := range request.ResourceIds {
+		if s.resourceTags(id) == nil {
+			return nil, invalidResource("resource %s not found", id)
+		}
+	}
+	if request.GetDryRun() {
+		return osc.CreateTagsResponse{}, nil
+	}
+	for _, id := range request.ResourceIds {
+		resourceTags := s.resourceTags(id)
+		tags := []osc.ResourceTag{}
+		for _, tag := range *resourceTags {
+			replaced := false
+			for _, added := range request.Tags {
+				replaced = replaced || added.Key == tag.Key
+			}
+			if !replaced {
+				tags = append(tags, tag)
+			}
+		}
+		*resourceTags = append(tags, request.Tags...)
+	}
+	return osc.CreateTagsResponse{}, nil
+}
+
+func (s *FakeAPIServer) deleteTags(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.DeleteTagsRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	for _, id := range request.ResourceIds {
+		resourceTags := s.resourceTags(id)
+		if resourceTags == nil {
+			return nil, invalidResource("resource %s not found", id)
+		}
+		tags := []osc.ResourceTag{}
+		for _, tag := range *resourceTags {
+			deleted := false
+			for _, removed := range request.Tags {
+				deleted = deleted || (removed.Key == tag.Key && (removed.Value == "" || removed.Value == tag.Value))
+			}
+			if !deleted {
+				tags = append(tags, tag)
+			}
+		}
+		*resourceTags = tags
+	}
+	return osc.DeleteTagsResponse{}, nil
+}
+
+func (s *FakeAPIServer) readRouteTables(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.ReadRouteTablesRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	filters := request.GetFilters()
+	routeTables := []osc.RouteTable{}
+	for _, id := range sets.StringKeySet(s.routeTables).List() {
+		routeTable := s.routeTables[id]
+		if !matchAny(filters.RouteTableIds, id) || !matchAny(filters.NetIds, routeTable.GetNetId()) ||
+			!matchTags(routeTable.GetTags(), filters.GetTagKeys(), filters.GetTagValues(), filters.GetTags()) {
+			continue
+		}
+		if filters.LinkSubnetIds != nil {
+			linked := false
+			for _, link := range routeTable.GetLinkRouteTables() {
+				linked = linked || matchAny(filters.LinkSubnetIds, link.GetSubnetId())
+			}
+			if !linked {
+				continue
+			}
+		}
+		routeTables = append(routeTables, *routeTable)
+	}
+	return osc.ReadRouteTablesResponse{RouteTables: &routeTables}, nil
+}
+
+func (s *FakeAPIServer) createRoute(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.CreateRouteRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	routeTable, found := s.routeTables[request.RouteTableId]
+	if !found {
+		return nil, invalidResource("route table %s not found", request.RouteTableId)
+	}
+	for _, route := range routeTable.GetRoutes() {
+		if route.GetDestinationIpRange() == request.DestinationIpRange {
+			return nil, conflict("route to %s already exists", request.DestinationIpRange)
+		}
+	}
+	routes := append(routeTable.GetRoutes(), osc.Route{
+		CreationMethod:     osc.PtrString("CreateRoute"),
+		DestinationIpRange: osc.PtrString(request.DestinationIpRange),
+		GatewayId:          request.GatewayId,
+		NatServiceId:       request.NatServiceId,
+		NetPeeringId:       request.NetPeeringId,
+		NicId:              request.NicId,
+		State:              osc.PtrString("active"),
+		VmId:               request.VmId,
+	})
+	routeTable.SetRoutes(routes)
+	return osc.CreateRouteResponse{RouteTable: routeTable}, nil
+}
+
+func (s *FakeAPIServer) deleteRoute(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.DeleteRouteRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	routeTable, found := s.routeTables[request.RouteTableId]
+	if !found {
+		return nil, invalidResource("route table %s not found", request.RouteTableId)
+	}
+	routes := []osc.Route{}
+	for _, route := range routeTable.GetRoutes() {
+		if route.GetDestinationIpRange() != request.DestinationIpRange {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == len(routeTable.GetRoutes()) {
+		return nil, invalidResource("route to %s not found", request.DestinationIpRange)
+	}
+	routeTable.SetRoutes(routes)
+	return osc.DeleteRouteResponse{RouteTable: routeTable}, nil
+}
+
+func (s *FakeAPIServer) readPublicIps(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.ReadPublicIpsRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	filters := request.GetFilters()
+	publicIps := []osc.PublicIp{}
+	for _, id := range sets.StringKeySet(s.publicIps).List() {
+		publicIP := s.publicIps[id]
+		if matchAny(filters.PublicIpIds, id) && matchAny(filters.PublicIps, publicIP.GetPublicIp()) &&
+			matchTags(publicIP.GetTags(), filters.GetTagKeys(), filters.GetTagValues(), filters.GetTags()) {
+			publicIps = append(publicIps, *publicIP)
+		}
+	}
+	return osc.ReadPublicIpsResponse{PublicIps: &publicIps}, nil
+}
+
+func (s *FakeAPIServer) createPublicIP(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.CreatePublicIpRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	if request.GetDryRun() {
+		return osc.CreatePublicIpResponse{}, nil
+	}
+	publicIP := &osc.PublicIp{
+		PublicIpId: osc.PtrString(s.newID("eipalloc")),
+		PublicIp:   osc.PtrString(fmt.Sprintf("198.51.100.%d", s.nextID%256)),
+		Tags:       &[]osc.ResourceTag{},
+	}
+	s.publicIps[publicIP.GetPublicIpId()] = publicIP
+	return osc.CreatePublicIpResponse{PublicIp: publicIP}, nil
+}
+
+func (s *FakeAPIServer) deletePublicIP(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.DeletePublicIpRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	for id, publicIP := range s.publicIps {
+		if id == request.GetPublicIpId() || (request.PublicIp != nil && publicIP.GetPublicIp() == request.GetPublicIp()) {
+			for name, lb := range s.loadBalancers {
+				if lb.publicIP == publicIP.GetPublicIp() {
+					return nil, conflict("public IP %s is used by load balancer %s", publicIP.GetPublicIp(), name)
+				}
+			}
+			delete(s.publicIps, id)
+			return osc.DeletePublicIpResponse{}, nil
+		}
+	}
+	return nil, invalidResource("public IP %s%s not found", request.GetPublicIpId(), request.GetPublicIp())
+}
+
+// readLoadBalancers returns the oAPI view of the load balancers managed with LBU
+func (s *FakeAPIServer) readLoadBalancers(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.ReadLoadBalancersRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	filters := request.GetFilters()
+	loadBalancers := []osc.LoadBalancer{}
+	for _, name := range sets.StringKeySet(s.loadBalancers).List() {
+		if !matchAny(filters.LoadBalancerNames, name) || !s.visible(name) {
+			continue
+		}
+		lb := s.loadBalancers[name]
+		loadBalancer := osc.LoadBalancer{
+			LoadBalancerName: osc.PtrString(name),
+			LoadBalancerType: lb.description.Scheme,
+			SecurityGroups:   &[]string{},
+			Subnets:          &[]string{},
+		}
+		loadBalancer.SetDnsName(stringValue(lb.description.DNSName))
+		for _, group := range lb.description.SecurityGroups {
+			*loadBalancer.SecurityGroups = append(*loadBalancer.SecurityGroups, *group)
+		}
+		for _, subnet := range lb.description.Subnets {
+			*loadBalancer.Subnets = append(*loadBalancer.Subnets, *subnet)
+		}
+		if lb.publicIP != "" {
+			loadBalancer.SetPublicIp(lb.publicIP)
+		}
+		loadBalancers = append(loadBalancers, loadBalancer)
+	}
+	return osc.ReadLoadBalancersResponse{LoadBalancers: &loadBalancers}, nil
+}
+
+// updateLoadBalancer only updates the public IP of the load balancer, the other attributes
+// being updated with LBU
+func (s *FakeAPIServer) updateLoadBalancer(decode func(interface{}) error) (interface{}, *oapiError) {
+	var request osc.UpdateLoadBalancerRequest
+	if err := decodeRequest(decode, &request); err != nil {
+		return nil, err
+	}
+	lb, found := s.loadBalancers[request.LoadBalancerName]
+	if !found {
+		return nil, invalidResource("load balancer %s not found", request.LoadBalancerName)
+	}
+	if request.PublicIp != nil {
+		lb.publicIP = request.GetPublicIp()
+	}
+	return osc.UpdateLoadBalancerResponse{}, nil
+}
+
+// newSecurityGroup returns the stored security group, with ungrouped rules
+func newSecurityGroup(group osc.SecurityGroup) *osc.SecurityGroup {
+	group.SetInboundRules(ungroupRules(group.GetInboundRules()))
+	group.SetOutboundRules(ungroupRules(group.GetOutboundRules()))
+	if !group.HasTags() {
+		group.SetTags([]osc.ResourceTag{})
+	}
+	return &group
+}
+
+// copySecurityGroup returns a copy of the stored security group, with the rules grouped by
+// protocol and ports as in the API
+func copySecurityGroup(group *osc.SecurityGroup) osc.SecurityGroup {
+	copied := *awsutil.CopyOf(group).(*osc.SecurityGroup)
+	copied.SetInboundRules(groupRules(group.GetInboundRules()))
+	copied.SetOutboundRules(groupRules(group.GetOutboundRules()))
+	return copied
+}
+
+// ungroupRules splits the rules into rules of a single IP range or security group
+func ungroupRules(rules []osc.SecurityGroupRule) []osc.SecurityGroupRule {
+	ungrouped := []osc.SecurityGroupRule{}
+	for _, rule := range rules {
+		for _, ipRange := range rule.GetIpRanges() {
+			single := osc.SecurityGroupRule{IpProtocol: rule.IpProtocol, FromPortRange: rule.FromPortRange, ToPortRange: rule.ToPortRange}
+			single.SetIpRanges([]string{ipRange})
+			ungrouped = append(ungrouped, single)
+		}
+		for _, member := range rule.GetSecurityGroupsMembers() {
+			single := osc.SecurityGroupRule{IpProtocol: rule.IpProtocol, FromPortRange: rule.FromPortRange, ToPortRange: rule.ToPortRange}
+			single.SetSecurityGroupsMembers([]osc.SecurityGroupsMember{member})
+			ungrouped = append(ungrouped, single)
+		}
+	}
+	return ungrouped
+}
+
+// groupRules groups the ungrouped rules by protocol and ports
+func groupRules(rules []osc.SecurityGroupRule) []osc.SecurityGroupRule {
+	grouped := []osc.SecurityGroupRule{}
+	index := map[string]int{}
+	for _, rule := range rules {
+		key := fmt.Sprintf("%s|%d|%d", rule.GetIpProtocol(), rule.GetFromPortRange(), rule.GetToPortRange())
+		i, found := index[key]
+		if !found {
+			i = len(grouped)
+			index[key] = i
+			grouped = append(grouped, osc.SecurityGroupRule{
+				IpProtocol:    rule.IpProtocol,
+				FromPortRange: rule.FromPortRange,
+				ToPortRange:   rule.ToPortRange,
+			})
+		}
+		if rule.IpRanges != nil {
+			grouped[i].SetIpRanges(append(grouped[i].GetIpRanges(), rule.GetIpRanges()...))
+		}
+		if rule.SecurityGroupsMembers != nil {
+			grouped[i].SetSecurityGroupsMembers(append(grouped[i].GetSecurityGroupsMembers(), rule.GetSecurityGroupsMembers()...))
+		}
+	}
+	return grouped
+}
+
+// ruleKey identifies an ungrouped rule
+func ruleKey(rule osc.SecurityGroupRule) string {
+	target := strings.Join(rule.GetIpRanges(), ",")
+	for _, member := range rule.GetSecurityGroupsMembers() {
+		target = member.GetSecurityGroupId()
+		if target == "" {
+			target = member.GetAccountId() + "/" + member.GetSecurityGroupName()
+		}
+	}
+	return fmt.Sprintf("%s|%d|%d|%s", rule.GetIpProtocol(), rule.GetFromPortRange(), rule.GetToPortRange(), target)
+}
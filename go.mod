@@ -4,20 +4,27 @@ go 1.19
 
 require (
 	github.com/aws/aws-sdk-go v1.44.116
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/onsi/ginkgo/v2 v2.8.1
 	github.com/onsi/gomega v1.26.0
 	github.com/outscale/osc-sdk-go/v2 v2.18.1
 	github.com/prometheus/client_golang v1.14.0
+	github.com/spf13/cobra v1.6.0
 	github.com/stretchr/testify v1.8.0
+	golang.org/x/net v0.17.0
+	golang.org/x/sync v0.3.0
 	gopkg.in/gcfg.v1 v1.2.3
 	k8s.io/api v0.26.8
 	k8s.io/apimachinery v0.26.8
+	k8s.io/apiserver v0.26.8
 	k8s.io/client-go v0.26.8
 	k8s.io/cloud-provider v0.26.8
 	k8s.io/component-base v0.26.8
 	k8s.io/klog/v2 v2.80.1
 	k8s.io/kubernetes v1.26.8
 	k8s.io/pod-security-admission v0.0.0
+	k8s.io/utils v0.0.0-20221107191617-1a15be271d1d
+	sigs.k8s.io/yaml v1.3.0
 )
 
 require (
@@ -35,7 +42,6 @@ require (
 	github.com/emicklei/go-restful/v3 v3.9.0 // indirect
 	github.com/evanphx/json-patch v4.12.0+incompatible // indirect
 	github.com/felixge/httpsnoop v1.0.3 // indirect
-	github.com/fsnotify/fsnotify v1.6.0 // indirect
 	github.com/go-logr/logr v1.2.3 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/go-openapi/jsonpointer v0.19.5 // indirect
@@ -70,7 +76,6 @@ require (
 	github.com/prometheus/client_model v0.3.0 // indirect
 	github.com/prometheus/common v0.37.0 // indirect
 	github.com/prometheus/procfs v0.8.0 // indirect
-	github.com/spf13/cobra v1.6.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/stoewer/go-strcase v1.2.0 // indirect
 	github.com/stretchr/objx v0.4.0 // indirect
@@ -92,9 +97,7 @@ require (
 	go.uber.org/multierr v1.8.0 // indirect
 	go.uber.org/zap v1.21.0 // indirect
 	golang.org/x/crypto v0.14.0 // indirect
-	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/oauth2 v0.11.0 // indirect
-	golang.org/x/sync v0.3.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/term v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
@@ -110,18 +113,15 @@ require (
 	gopkg.in/warnings.v0 v0.1.1 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	k8s.io/apiserver v0.26.8 // indirect
 	k8s.io/component-helpers v0.26.8 // indirect
 	k8s.io/controller-manager v0.26.8 // indirect
 	k8s.io/kms v0.26.8 // indirect
 	k8s.io/kube-openapi v0.0.0-20221012153701-172d655c2280 // indirect
 	k8s.io/kubectl v0.0.0 // indirect
 	k8s.io/kubelet v0.0.0 // indirect
-	k8s.io/utils v0.0.0-20221107191617-1a15be271d1d // indirect
 	sigs.k8s.io/apiserver-network-proxy/konnectivity-client v0.0.37 // indirect
 	sigs.k8s.io/json v0.0.0-20220713155537-f223a00ba0e2 // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.2.3 // indirect
-	sigs.k8s.io/yaml v1.3.0 // indirect
 )
 
 replace (
@@ -153,5 +153,4 @@ replace (
 	k8s.io/mount-utils => k8s.io/mount-utils v0.26.8
 	k8s.io/pod-security-admission => k8s.io/pod-security-admission v0.26.8
 	k8s.io/sample-apiserver => k8s.io/sample-apiserver v0.26.8
-
 )